@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// the keys and labels the operator maintains, see pkg/controller/mongodb
+	connectionStringSecretLabelKey  = "mongodb.com/v1.connectionStringOf"
+	connectionStringStandardKey     = "connectionString.standard"
+	connectionStringSRVKey          = "connectionString.standardSrv"
+	collectDiagnosticsAnnotationKey = "mongodb.com/v1.collectDiagnostics"
+	diagnosticsKey                  = "diagnostics.tar.gz"
+
+	diagnosticsPollingInterval = 2 * time.Second
+	defaultDiagnosticsTimeout  = 2 * time.Minute
+)
+
+func (p plugin) mergePatch(mdb *mdbv1.MongoDB, patch map[string]interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	if err := p.client.Patch(context.TODO(), mdb, client.RawPatch(types.MergePatchType, data)); err != nil {
+		return fmt.Errorf("error patching MongoDB %s: %s", mdb.Name, err)
+	}
+	return nil
+}
+
+// connectionStringCommand prints the connection strings of the users from the Secrets the operator
+// writes for them, or the connection string of the replica set when authentication is disabled
+func connectionStringCommand() command {
+	flags := flag.NewFlagSet("connection-string", flag.ExitOnError)
+	user := flags.String("user", "", "only print the connection string of this user")
+	srv := flags.Bool("srv", false, "print the mongodb+srv:// connection strings")
+	return command{
+		usage: "connection-string <name> [--user <username>] [--srv]",
+		flags: flags,
+		run: func(p plugin, name string) error {
+			mdb, err := p.getResource(name)
+			if err != nil {
+				return err
+			}
+			if !mdb.Spec.Security.Authentication.Enabled {
+				fmt.Println(mdb.MongoURI())
+				return nil
+			}
+
+			secrets := corev1.SecretList{}
+			if err := p.client.List(context.TODO(), &secrets, client.InNamespace(p.namespace), client.MatchingLabels{connectionStringSecretLabelKey: name}); err != nil {
+				return fmt.Errorf("error listing the connection string Secrets: %s", err)
+			}
+			key := connectionStringStandardKey
+			if *srv {
+				key = connectionStringSRVKey
+			}
+			var lines []string
+			for _, s := range secrets.Items {
+				username := string(s.Data["username"])
+				if *user == "" {
+					lines = append(lines, fmt.Sprintf("%s\t%s", username, s.Data[key]))
+				} else if username == *user {
+					// a single connection string is printed alone, so that it can be used in scripts
+					lines = append(lines, string(s.Data[key]))
+				}
+			}
+			if len(lines) == 0 {
+				return fmt.Errorf("there is no connection string Secret of MongoDB %s for this user, they are written for the users of spec.users", name)
+			}
+			if *user != "" {
+				fmt.Println(strings.Join(lines, "\n"))
+				return nil
+			}
+			sort.Strings(lines)
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "USER\tCONNECTION STRING")
+			for _, line := range lines {
+				fmt.Fprintln(w, line)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// statusCommand prints the phase and the conditions of the resource, and the state, replication lag
+// and progress of its members, as recorded in its status by the operator
+func statusCommand() command {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	return command{
+		usage: "status <name>",
+		flags: flags,
+		run: func(p plugin, name string) error {
+			mdb, err := p.getResource(name)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(w, "Name:\t%s\n", mdb.Name)
+			fmt.Fprintf(w, "Phase:\t%s\n", mdb.Status.Phase)
+			fmt.Fprintf(w, "Version:\t%s\n", mdb.Status.Version)
+			fmt.Fprintf(w, "Members Ready:\t%d/%d\n", mdb.Status.ReadyMembers, mdb.Spec.Members)
+			if mdb.Spec.Paused {
+				fmt.Fprintf(w, "Paused:\ttrue\n")
+			}
+			if mdb.Status.Message != "" {
+				fmt.Fprintf(w, "Message:\t%s\n", mdb.Status.Message)
+			}
+
+			fmt.Fprintln(w, "\nMEMBER\tSTATE\tLAG\tLAST HEARTBEAT\tAUTOMATION CONFIG\tSTEP")
+			for _, member := range mdb.Status.Members {
+				lag, heartbeat, step := "-", "-", "-"
+				if member.ReplicationLagSeconds != nil {
+					lag = fmt.Sprintf("%ds", *member.ReplicationLagSeconds)
+					if member.LaggingSince != nil {
+						lag += fmt.Sprintf(" (lagging for %s)", since(member.LaggingSince.Time))
+					}
+				}
+				if member.LastHeartbeat != nil {
+					heartbeat = since(member.LastHeartbeat.Time) + " ago"
+				}
+				if member.CurrentStep != "" {
+					step = member.CurrentStep
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d/%d\t%s\n", member.Name, valueOrDash(member.State), lag, heartbeat, member.LastVersionAchieved, member.GoalVersion, step)
+			}
+
+			fmt.Fprintln(w, "\nCONDITION\tSTATUS\tREASON\tMESSAGE")
+			for _, condition := range mdb.Status.Conditions {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", condition.Type, condition.Status, valueOrDash(condition.Reason), valueOrDash(condition.Message))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// restartCommand sets spec.restartedAt, so that the operator restarts the members one at a time.
+// The restart is refused while the replica set isn't healthy, as restarting a member would then
+// lose the majority, unless forced.
+func restartCommand() command {
+	flags := flag.NewFlagSet("restart", flag.ExitOnError)
+	force := flags.Bool("force", false, "restart the members even if the replica set isn't running or a member isn't healthy")
+	return command{
+		usage: "restart <name> [--force]",
+		flags: flags,
+		run: func(p plugin, name string) error {
+			mdb, err := p.getResource(name)
+			if err != nil {
+				return err
+			}
+			if mdb.Spec.Paused {
+				return fmt.Errorf("the reconciliation of MongoDB %s is paused, the members can't be restarted until it is resumed", name)
+			}
+			if !*force {
+				if mdb.Status.Phase != mdbv1.Running {
+					return fmt.Errorf("MongoDB %s is %s, not Running, use --force to restart the members anyway", name, mdb.Status.Phase)
+				}
+				for _, member := range mdb.Status.Members {
+					if member.State != "" && member.State != livecluster.PrimaryState && member.State != livecluster.SecondaryState && member.State != "ARBITER" {
+						return fmt.Errorf("the member %s is %s, use --force to restart the members anyway", member.Name, member.State)
+					}
+				}
+			}
+			restartedAt := time.Now().UTC().Format(time.RFC3339)
+			if err := p.mergePatch(&mdb, map[string]interface{}{"spec": map[string]interface{}{"restartedAt": restartedAt}}); err != nil {
+				return err
+			}
+			fmt.Printf("Requested a rolling restart of the members of MongoDB %s at %s, the operator restarts them one at a time\n", name, restartedAt)
+			return nil
+		},
+	}
+}
+
+// pauseCommand sets or clears spec.paused
+func pauseCommand(pause bool) command {
+	verb, done := "resume", "Resumed the reconciliation of MongoDB %s\n"
+	var paused interface{}
+	if pause {
+		verb, done, paused = "pause", "Paused the reconciliation of MongoDB %s, the operator makes no change to it until it is resumed\n", true
+	}
+	flags := flag.NewFlagSet(verb, flag.ExitOnError)
+	return command{
+		usage: verb + " <name>",
+		flags: flags,
+		run: func(p plugin, name string) error {
+			mdb, err := p.getResource(name)
+			if err != nil {
+				return err
+			}
+			if err := p.mergePatch(&mdb, map[string]interface{}{"spec": map[string]interface{}{"paused": paused}}); err != nil {
+				return err
+			}
+			fmt.Printf(done, name)
+			return nil
+		},
+	}
+}
+
+// diagnosticsCommand annotates the resource so that the operator collects its diagnostics bundle,
+// waits for the operator to remove the annotation once the bundle is collected, and writes the bundle
+// to a file
+func diagnosticsCommand() command {
+	flags := flag.NewFlagSet("diagnostics", flag.ExitOnError)
+	output := flags.String("output", "", "the file the bundle is written to, defaults to <name>-diagnostics.tar.gz")
+	timeout := flags.Duration("timeout", defaultDiagnosticsTimeout, "how long to wait for the operator to collect the bundle")
+	return command{
+		usage: "diagnostics <name> [--output <file>] [--timeout <duration>]",
+		flags: flags,
+		run: func(p plugin, name string) error {
+			mdb, err := p.getResource(name)
+			if err != nil {
+				return err
+			}
+			patch := map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{collectDiagnosticsAnnotationKey: "true"}}}
+			if err := p.mergePatch(&mdb, patch); err != nil {
+				return err
+			}
+			fmt.Printf("Waiting for the operator to collect the diagnostics of MongoDB %s\n", name)
+			err = wait.PollImmediate(diagnosticsPollingInterval, *timeout, func() (bool, error) {
+				mdb, err := p.getResource(name)
+				if err != nil {
+					return false, err
+				}
+				_, pending := mdb.Annotations[collectDiagnosticsAnnotationKey]
+				return !pending, nil
+			})
+			if err != nil {
+				return fmt.Errorf("the diagnostics weren't collected: %s", err)
+			}
+
+			diagnostics := corev1.Secret{}
+			if err := p.client.Get(context.TODO(), p.nsName(name+"-diagnostics"), &diagnostics); err != nil {
+				return fmt.Errorf("error reading the diagnostics Secret: %s", err)
+			}
+			path := *output
+			if path == "" {
+				path = name + "-diagnostics.tar.gz"
+			}
+			if err := ioutil.WriteFile(path, diagnostics.Data[diagnosticsKey], 0600); err != nil {
+				return fmt.Errorf("error writing the diagnostics: %s", err)
+			}
+			fmt.Printf("Wrote the diagnostics to %s\n", path)
+			return nil
+		},
+	}
+}
+
+func since(t time.Time) string {
+	return time.Since(t).Round(time.Second).String()
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
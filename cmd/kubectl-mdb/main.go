@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/apis"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// command is a subcommand of the plugin, run with the name of the resource and the flags set on its
+// flag set
+type command struct {
+	usage string
+	flags *flag.FlagSet
+	run   func(p plugin, name string) error
+}
+
+// plugin holds the client of the cluster and the namespace the resources are read from
+type plugin struct {
+	client    client.Client
+	namespace string
+}
+
+func (p plugin) nsName(name string) types.NamespacedName {
+	return types.NamespacedName{Name: name, Namespace: p.namespace}
+}
+
+func (p plugin) getResource(name string) (mdbv1.MongoDB, error) {
+	mdb := mdbv1.MongoDB{}
+	if err := p.client.Get(context.TODO(), p.nsName(name), &mdb); err != nil {
+		return mdb, fmt.Errorf("error getting MongoDB %s: %s", name, err)
+	}
+	return mdb, nil
+}
+
+func main() {
+	commands := map[string]command{
+		"connection-string": connectionStringCommand(),
+		"status":            statusCommand(),
+		"restart":           restartCommand(),
+		"pause":             pauseCommand(true),
+		"resume":            pauseCommand(false),
+		"diagnostics":       diagnosticsCommand(),
+	}
+	if len(os.Args) < 2 || commands[os.Args[1]].run == nil {
+		printUsage(commands)
+		os.Exit(2)
+	}
+	cmd := commands[os.Args[1]]
+	cmd.flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: kubectl mdb %s\n", cmd.usage)
+		cmd.flags.PrintDefaults()
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{}
+	cmd.flags.StringVar(&loadingRules.ExplicitPath, "kubeconfig", "", "the kubeconfig file, defaults to the KUBECONFIG variable or ~/.kube/config")
+	cmd.flags.StringVar(&overrides.CurrentContext, "context", "", "the context of the kubeconfig file, defaults to the current context")
+	cmd.flags.StringVar(&overrides.Context.Namespace, "namespace", "", "the namespace of the resource, defaults to the namespace of the context")
+	cmd.flags.StringVar(&overrides.Context.Namespace, "n", "", "shorthand for --namespace")
+	args, err := parseArgs(cmd.flags, os.Args[2:])
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		cmd.flags.Usage()
+		os.Exit(2)
+	}
+
+	p, err := newPlugin(loadingRules, overrides)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to the cluster: %s\n", err)
+		os.Exit(1)
+	}
+	if err := cmd.run(p, args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func printUsage(commands map[string]command) {
+	fmt.Fprintln(os.Stderr, "kubectl mdb runs day-2 operations on the MongoDB resources managed by the MongoDB Kubernetes Operator.")
+	fmt.Fprintln(os.Stderr, "\nUsage:")
+	for _, name := range []string{"connection-string", "status", "restart", "pause", "resume", "diagnostics"} {
+		fmt.Fprintf(os.Stderr, "  kubectl mdb %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun kubectl mdb <command> -h for the flags of a command.")
+}
+
+// parseArgs parses the flags of the arguments, which can come before or after the name of the
+// resource as with kubectl, and returns the other arguments
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// newPlugin connects to the cluster of the kubeconfig file as kubectl does
+func newPlugin(loadingRules *clientcmd.ClientConfigLoadingRules, overrides *clientcmd.ConfigOverrides) (plugin, error) {
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return plugin{}, err
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return plugin{}, err
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return plugin{}, err
+	}
+	if err := apis.AddToScheme(scheme); err != nil {
+		return plugin{}, err
+	}
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return plugin{}, err
+	}
+	return plugin{client: c, namespace: strings.TrimSpace(namespace)}, nil
+}
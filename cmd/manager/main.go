@@ -1,22 +1,126 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"net/http"
+	"net/http/pprof"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/acendpoint"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/apis"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/controller"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/controller/mongodb"
+	kubernetesClient "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/permissions"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/selectivecache"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/watchnamespace"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/tracing"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/vault"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 )
 
-func configureLogger() (*zap.Logger, error) {
-	// TODO: configure non development logger
-	logger, err := zap.NewDevelopment()
+const (
+	logLevelEnv                  = "LOG_LEVEL"
+	logEncodingEnv               = "LOG_ENCODING"
+	healthProbeBindAddressEnv    = "HEALTH_PROBE_BIND_ADDRESS"
+	pprofBindAddressEnv          = "PPROF_BIND_ADDRESS"
+	leaderElectEnv               = "LEADER_ELECT"
+	leaderElectionNamespaceEnv   = "LEADER_ELECTION_NAMESPACE"
+	leaderElectionIDEnv          = "LEADER_ELECTION_ID"
+	resourceSelectorEnv          = "RESOURCE_SELECTOR"
+	maxConcurrentReconcilesEnv   = "MAX_CONCURRENT_RECONCILES"
+	enableWebhookEnv             = "ENABLE_WEBHOOK"
+	webhookCertDirEnv            = "WEBHOOK_CERT_DIR"
+	syncPeriodEnv                = "SYNC_PERIOD"
+	healthCheckIntervalEnv       = "HEALTH_CHECK_INTERVAL"
+	kubeAPIQPSEnv                = "KUBE_API_QPS"
+	kubeAPIBurstEnv              = "KUBE_API_BURST"
+	reconcileFailureThresholdEnv = "RECONCILE_FAILURE_THRESHOLD"
+	reconcileFailureBackoffEnv   = "RECONCILE_FAILURE_BACKOFF"
+	shutdownTimeoutEnv           = "SHUTDOWN_TIMEOUT"
+
+	automationConfigServerBindAddressEnv = "AUTOMATION_CONFIG_SERVER_BIND_ADDRESS"
+	automationConfigServerCertDirEnv     = "AUTOMATION_CONFIG_SERVER_CERT_DIR"
+	automationConfigServerURLEnv         = "AUTOMATION_CONFIG_SERVER_URL"
+
+	defaultHealthProbeBindAddr = ":8081"
+
+	// defaultLeaderElectionID is the name of the ConfigMap the replicas of the operator elect their
+	// leader with
+	defaultLeaderElectionID = "mongodb-kubernetes-operator-leader"
+)
+
+// configureLogger builds the global logger of the operator with the level and the encoding,
+// "json" or "console", of the flags, which default to the LOG_LEVEL and LOG_ENCODING variables
+func configureLogger(level, encoding string) (*zap.Logger, error) {
+	zapLevel := zap.NewAtomicLevel()
+	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %s: %s", level, err)
+	}
+	if encoding != "json" && encoding != "console" {
+		return nil, fmt.Errorf("invalid log encoding %s, must be json or console", encoding)
+	}
+
+	cfg := zap.NewProductionConfig()
+	if encoding == "console" {
+		cfg = zap.NewDevelopmentConfig()
+	}
+	cfg.Level = zapLevel
+	cfg.Encoding = encoding
+	logger, err := cfg.Build()
+	if err != nil {
+		return nil, err
+	}
 	zap.ReplaceGlobals(logger)
-	return logger, err
+	return logger, nil
+}
+
+// pprofServer serves the profiles of net/http/pprof on its own address, so that they are only
+// exposed when requested. It implements manager.Runnable.
+type pprofServer struct {
+	addr string
+}
+
+func (s pprofServer) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Addr: s.addr, Handler: mux}
+	go func() {
+		<-stop
+		server.Close()
+	}()
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection returns false, so that the profiles of every replica of the operator are served
+func (s pprofServer) NeedLeaderElection() bool {
+	return false
+}
+
+func envOrDefault(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
 }
 
 func hasRequiredVariables(logger *zap.Logger, envVariables ...string) bool {
@@ -31,8 +135,36 @@ func hasRequiredVariables(logger *zap.Logger, envVariables ...string) bool {
 }
 
 func main() {
-	log, err := configureLogger()
+	if len(os.Args) > 1 && os.Args[1] == renderCommand {
+		os.Exit(render(os.Args[2:]))
+	}
+
+	logLevel := flag.String("log-level", envOrDefault(logLevelEnv, "info"), "the level of the logs: debug, info, warn or error")
+	logEncoding := flag.String("log-encoding", envOrDefault(logEncodingEnv, "json"), "the encoding of the logs: json or console")
+	healthProbeBindAddress := flag.String("health-probe-bind-address", envOrDefault(healthProbeBindAddressEnv, defaultHealthProbeBindAddr), "the address /healthz and /readyz are served on")
+	pprofBindAddress := flag.String("pprof-bind-address", os.Getenv(pprofBindAddressEnv), "the address the pprof profiles are served on, they aren't served if it is empty")
+	leaderElect := flag.Bool("leader-elect", os.Getenv(leaderElectEnv) == "true", "elect a leader among the replicas of the operator, only the leader reconciles the resources")
+	leaderElectionNamespace := flag.String("leader-election-namespace", os.Getenv(leaderElectionNamespaceEnv), "the namespace of the leader election ConfigMap, defaults to the namespace of the operator")
+	leaderElectionID := flag.String("leader-election-id", envOrDefault(leaderElectionIDEnv, defaultLeaderElectionID), "the name of the leader election ConfigMap, which must be unique for each operator of a namespace")
+	resourceSelector := flag.String("resource-selector", os.Getenv(resourceSelectorEnv), "only reconcile the MongoDB resources whose labels match this selector, such as team=payments, all of them if it is empty")
+	maxConcurrentReconciles := flag.String("max-concurrent-reconciles", envOrDefault(maxConcurrentReconcilesEnv, "1"), "how many MongoDB resources are reconciled at the same time")
+	enableWebhook := flag.Bool("enable-webhook", os.Getenv(enableWebhookEnv) == "true", "serve the webhooks setting the defaults of the MongoDB resources and validating them on port 9443")
+	webhookCertDir := flag.String("webhook-cert-dir", os.Getenv(webhookCertDirEnv), "the directory of the tls.crt and tls.key files of the webhook, defaults to /tmp/k8s-webhook-server/serving-certs")
+	syncPeriod := flag.String("sync-period", envOrDefault(syncPeriodEnv, "10h"), "how often every MongoDB resource is reconciled, even though it hasn't changed")
+	healthCheckInterval := flag.String("health-check-interval", envOrDefault(healthCheckIntervalEnv, "30s"), "how often the state of the members of every replica set is read and its drift detected, 0 disables it")
+	kubeAPIQPS := flag.String("kube-api-qps", envOrDefault(kubeAPIQPSEnv, "20"), "how many requests per second the operator sends to the Kubernetes API on average")
+	kubeAPIBurst := flag.String("kube-api-burst", envOrDefault(kubeAPIBurstEnv, "30"), "how many requests the operator sends to the Kubernetes API at once, above the average rate")
+	reconcileFailureThreshold := flag.String("reconcile-failure-threshold", envOrDefault(reconcileFailureThresholdEnv, "10"), "how many consecutive reconciliations of a MongoDB resource can fail before it is only retried every reconcile failure backoff, 0 disables it")
+	reconcileFailureBackoff := flag.String("reconcile-failure-backoff", envOrDefault(reconcileFailureBackoffEnv, "15m"), "how long a MongoDB resource which failed too many consecutive times waits before being reconciled again")
+	shutdownTimeout := flag.String("shutdown-timeout", envOrDefault(shutdownTimeoutEnv, "25s"), "how long the operator waits for the reconciliations in progress to finish when it is stopped")
+	automationConfigServerBindAddress := flag.String("automation-config-server-bind-address", os.Getenv(automationConfigServerBindAddressEnv), "the address the automation configs are served on to the agents of the resources with the Endpoint delivery, they aren't served if it is empty")
+	automationConfigServerCertDir := flag.String("automation-config-server-cert-dir", envOrDefault(automationConfigServerCertDirEnv, "/tmp/automation-config-server/serving-certs"), "the directory of the tls.crt, tls.key and ca.crt files of the automation config server")
+	automationConfigServerURL := flag.String("automation-config-server-url", os.Getenv(automationConfigServerURLEnv), "the URL the agents reach the automation config server at, such as https://mongodb-kubernetes-operator-automation-config.<namespace>.svc:8443")
+	flag.Parse()
+
+	log, err := configureLogger(*logLevel, *logEncoding)
 	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring the logger: %s\n", err)
 		os.Exit(1)
 	}
 
@@ -40,29 +172,158 @@ func main() {
 		os.Exit(1)
 	}
 
-	// get watch namespace from environment variable
-	namespace, nsSpecified := os.LookupEnv("WATCH_NAMESPACE")
+	// get watch namespace from environment variable, a comma-separated list of namespaces, all the
+	// namespaces are watched if it is empty
+	watchNamespace, nsSpecified := os.LookupEnv("WATCH_NAMESPACE")
 	if !nsSpecified {
 		os.Exit(1)
 	}
+	namespaces := watchnamespace.Parse(watchNamespace)
+
+	options := manager.Options{
+		HealthProbeBindAddress:  *healthProbeBindAddress,
+		LivenessEndpointName:    "/healthz",
+		ReadinessEndpointName:   "/readyz",
+		LeaderElection:          *leaderElect,
+		LeaderElectionID:        *leaderElectionID,
+		LeaderElectionNamespace: *leaderElectionNamespace,
+		CertDir:                 *webhookCertDir,
+	}
+	var newCache cache.NewCacheFunc
+	switch len(namespaces) {
+	case 0:
+		log.Info("Watching all namespaces")
+	case 1:
+		options.Namespace = namespaces[0]
+		log.Info(fmt.Sprintf("Watching namespace: %s", namespaces[0]))
+	default:
+		newCache = watchnamespace.NewCacheFunc(namespaces)
+		log.Info(fmt.Sprintf("Watching namespaces: %s", strings.Join(namespaces, ", ")))
+	}
+	// only the Secrets and ConfigMaps written or referenced by the operator are cached
+	options.NewCache = selectivecache.NewCacheFunc(newCache, namespaces, labels.SelectorFromSet(labels.Set{kubernetesClient.WatchedLabelKey: "true"}))
+
+	selector, err := labels.Parse(*resourceSelector)
+	if err != nil {
+		log.Error(fmt.Sprintf("Invalid resource selector %s: %s", *resourceSelector, err))
+		os.Exit(1)
+	}
+	if !selector.Empty() {
+		mongodb.SetResourceSelector(selector)
+		log.Info(fmt.Sprintf("Only reconciling the MongoDB resources matching %s", selector))
+	}
+
+	concurrency, err := strconv.Atoi(*maxConcurrentReconciles)
+	if err != nil || concurrency < 1 {
+		log.Error(fmt.Sprintf("Invalid max concurrent reconciles %s, must be a positive integer", *maxConcurrentReconciles))
+		os.Exit(1)
+	}
+	mongodb.SetMaxConcurrentReconciles(concurrency)
+	log.Info(fmt.Sprintf("Reconciling up to %d MongoDB resources at the same time", concurrency))
 
-	log.Info(fmt.Sprintf("Watching namespace: %s", namespace))
+	resync, err := time.ParseDuration(*syncPeriod)
+	if err != nil || resync <= 0 {
+		log.Error(fmt.Sprintf("Invalid sync period %s, must be a positive duration such as 1h", *syncPeriod))
+		os.Exit(1)
+	}
+	options.SyncPeriod = &resync
+	log.Info(fmt.Sprintf("Reconciling every MongoDB resource every %s", resync))
+
+	interval, err := time.ParseDuration(*healthCheckInterval)
+	if err != nil || interval < 0 {
+		log.Error(fmt.Sprintf("Invalid health check interval %s, must be a duration such as 30s", *healthCheckInterval))
+		os.Exit(1)
+	}
+	mongodb.SetHealthCheckInterval(interval)
+	if interval == 0 {
+		log.Info("The health checks of the replica sets are disabled")
+	} else {
+		log.Info(fmt.Sprintf("Checking the health of the replica sets every %s", interval))
+	}
+
+	failureThreshold, err := strconv.Atoi(*reconcileFailureThreshold)
+	if err != nil || failureThreshold < 0 {
+		log.Error(fmt.Sprintf("Invalid reconcile failure threshold %s, must be a positive integer or 0", *reconcileFailureThreshold))
+		os.Exit(1)
+	}
+	failureBackoff, err := time.ParseDuration(*reconcileFailureBackoff)
+	if err != nil || failureBackoff <= 0 {
+		log.Error(fmt.Sprintf("Invalid reconcile failure backoff %s, must be a positive duration such as 15m", *reconcileFailureBackoff))
+		os.Exit(1)
+	}
+	mongodb.SetReconcileFailureThreshold(failureThreshold)
+	mongodb.SetReconcileFailureBackoff(failureBackoff)
+	if failureThreshold == 0 {
+		log.Info("The MongoDB resources failing repeatedly are retried with the backoff of the controller")
+	} else {
+		log.Info(fmt.Sprintf("Retrying the MongoDB resources every %s after %d consecutive failures", failureBackoff, failureThreshold))
+	}
+
+	shutdownGracePeriod, err := time.ParseDuration(*shutdownTimeout)
+	if err != nil || shutdownGracePeriod < 0 {
+		log.Error(fmt.Sprintf("Invalid shutdown timeout %s, must be a duration such as 25s", *shutdownTimeout))
+		os.Exit(1)
+	}
+
+	if *leaderElect {
+		log.Info("Leader election is enabled, waiting to be elected before reconciling")
+	}
 
 	// Get a config to talk to the apiserver
 	cfg, err := config.GetConfig()
 	if err != nil {
 		os.Exit(1)
 	}
+	qps, err := strconv.ParseFloat(*kubeAPIQPS, 32)
+	if err != nil || qps <= 0 {
+		log.Error(fmt.Sprintf("Invalid Kubernetes API QPS %s, must be a positive number", *kubeAPIQPS))
+		os.Exit(1)
+	}
+	burst, err := strconv.Atoi(*kubeAPIBurst)
+	if err != nil || burst < 1 {
+		log.Error(fmt.Sprintf("Invalid Kubernetes API burst %s, must be a positive integer", *kubeAPIBurst))
+		os.Exit(1)
+	}
+	cfg.QPS, cfg.Burst = float32(qps), burst
+	log.Info(fmt.Sprintf("Sending up to %g requests per second to the Kubernetes API, with bursts of %d", qps, burst))
 
 	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := manager.New(cfg, manager.Options{
-		Namespace: namespace,
-	})
+	// the replicas which aren't the leader only serve the health probes, and take over within the
+	// lease duration, 15 seconds, if the leader stops renewing it
+	mgr, err := manager.New(cfg, options)
 
 	if err != nil {
 		os.Exit(1)
 	}
 
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
+		os.Exit(1)
+	}
+
+	// the operator isn't ready while it is missing some of the permissions the controllers need in the
+	// watched namespaces
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		os.Exit(1)
+	}
+	permissionsChecker := permissions.NewChecker(clientset.AuthorizationV1().SelfSubjectAccessReviews(), controller.RequiredPermissions, namespaces)
+	if err := mgr.Add(permissionsChecker); err != nil {
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("permissions", permissionsChecker.Readyz); err != nil {
+		os.Exit(1)
+	}
+
+	if *pprofBindAddress != "" {
+		if err := mgr.Add(pprofServer{addr: *pprofBindAddress}); err != nil {
+			os.Exit(1)
+		}
+		log.Info(fmt.Sprintf("Serving pprof profiles on %s", *pprofBindAddress))
+	}
+
 	log.Info("Registering Components.")
 
 	// Setup Scheme for all resources
@@ -70,15 +331,77 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the reconciliations are traced if an OTLP endpoint is configured
+	if exporter, ok := tracing.NewOTLPExporterFromEnv(); ok {
+		tracer := tracing.NewTracer(exporter, func(err error) {
+			zap.S().Warnf("Error exporting traces: %s", err)
+		})
+		tracing.ReplaceGlobal(tracer)
+		if err := mgr.Add(tracer); err != nil {
+			os.Exit(1)
+		}
+		log.Info("Exporting traces with OTLP")
+	}
+
+	// the secrets the resources reference in Vault are read if the address of Vault is configured
+	vaultClient, ok, err := vault.NewClientFromEnv(vault.NewTokenRequester(clientset.CoreV1()))
+	if err != nil {
+		log.Error(fmt.Sprintf("Invalid Vault configuration: %s", err))
+		os.Exit(1)
+	}
+	if ok {
+		mongodb.SetVaultReader(vaultClient)
+		log.Info(fmt.Sprintf("Reading the secrets stored in Vault at %s", vaultClient.Addr()))
+	}
+
+	// the automation configs are served by every replica, the leader or not, so that the agents
+	// keep getting them during a leader election
+	if *automationConfigServerBindAddress != "" {
+		if *automationConfigServerURL == "" {
+			log.Error(fmt.Sprintf("%s is required to serve the automation configs", automationConfigServerURLEnv))
+			os.Exit(1)
+		}
+		server := acendpoint.Server{
+			Addr:    *automationConfigServerBindAddress,
+			CertDir: *automationConfigServerCertDir,
+			Handler: acendpoint.Handler(mongodb.NewAutomationConfigSource(mgr.GetClient())),
+		}
+		if err := mgr.Add(server); err != nil {
+			os.Exit(1)
+		}
+		mongodb.SetAutomationConfigServer(*automationConfigServerURL, filepath.Join(*automationConfigServerCertDir, acendpoint.CAFileName))
+		log.Info(fmt.Sprintf("Serving the automation configs on %s", *automationConfigServerBindAddress))
+	}
+
 	// Setup all Controllers
 	if err := controller.AddToManager(mgr); err != nil {
 		os.Exit(1)
 	}
 
+	// the webhooks are served by every replica, the leader or not
+	if *enableWebhook {
+		mongodb.AddWebhooks(mgr)
+		log.Info("Serving the defaulting and validating webhooks of the MongoDB resources")
+	}
+
 	log.Info("Starting the Cmd.")
 
+	// the Manager is only stopped once the reconciliations in progress have finished, so that they can
+	// still use its client and the leader keeps its lease in the meantime. A second signal exits
+	// straight away.
+	stop := signals.SetupSignalHandler()
+	mgrStop := make(chan struct{})
+	go func() {
+		<-stop
+		log.Info(fmt.Sprintf("Stopping, waiting up to %s for the reconciliations in progress", shutdownGracePeriod))
+		if !mongodb.Shutdown(shutdownGracePeriod) {
+			log.Warn("Some reconciliations were still in progress after the shutdown timeout")
+		}
+		close(mgrStop)
+	}()
+
 	// Start the Cmd
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(mgrStop); err != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/controller/mongodb"
+	"sigs.k8s.io/yaml"
+)
+
+// renderCommand is the first argument of the operator printing the objects it would create for a
+// MongoDB manifest, instead of running
+const renderCommand = "render"
+
+// render prints the objects the operator creates for the MongoDB resource of a manifest, as YAML
+// documents, so that they can be reviewed before the manifest is applied. args are the arguments
+// following the render command, it returns the exit code.
+func render(args []string) int {
+	flags := flag.NewFlagSet(renderCommand, flag.ExitOnError)
+	file := flags.String("f", "-", "the file of the MongoDB manifest, it is read from the standard input if it is -")
+	namespace := flags.String("namespace", "default", "the namespace of the resource, if the manifest doesn't set it")
+	_ = flags.Parse(args)
+
+	var manifest []byte
+	var err error
+	if *file == "-" {
+		manifest, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		manifest, err = ioutil.ReadFile(*file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the manifest: %s\n", err)
+		return 1
+	}
+
+	mdb := mdbv1.MongoDB{}
+	if err := yaml.UnmarshalStrict(manifest, &mdb); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing the manifest: %s\n", err)
+		return 1
+	}
+	if mdb.APIVersion != mdbv1.SchemeGroupVersion.String() || mdb.Kind != "MongoDB" {
+		fmt.Fprintf(os.Stderr, "The manifest must be a MongoDB resource of %s, got %s %s\n", mdbv1.SchemeGroupVersion, mdb.APIVersion, mdb.Kind)
+		return 1
+	}
+	if mdb.Namespace == "" {
+		mdb.Namespace = *namespace
+	}
+
+	objects, err := mongodb.Render(mdb)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering the resource: %s\n", err)
+		return 1
+	}
+	for i, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error printing the objects: %s\n", err)
+			return 1
+		}
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Print(string(data))
+	}
+	return 0
+}
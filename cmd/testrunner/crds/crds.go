@@ -10,18 +10,24 @@ import (
 	"strings"
 
 	"github.com/ghodss/yaml"
-	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
-	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 )
 
+// crdResource is the resource of the apiextensions.k8s.io/v1 CustomResourceDefinitions. They're created
+// unstructured, as the typed ones of the client don't hold the CEL validation rules of the schemas.
+var crdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
 // EnsureCreation will locate all crd files "*_crd.yaml" in the given deploy directory and ensure that these
 // CRDs are created into the kubernetes cluster
 func EnsureCreation(config *rest.Config, deployDir string) error {
-	apiextensionsClientSet, err := apiextensionsclientset.NewForConfig(config)
+	dynamicClient, err := dynamic.NewForConfig(config)
 	if err != nil {
-		return fmt.Errorf("error creating apiextensions client set: %v", err)
+		return fmt.Errorf("error creating dynamic client: %v", err)
 	}
 
 	crdFilePaths, err := allCrds(deployDir)
@@ -30,7 +36,7 @@ func EnsureCreation(config *rest.Config, deployDir string) error {
 	}
 
 	for _, filePath := range crdFilePaths {
-		crd := &apiextensionsv1beta1.CustomResourceDefinition{}
+		crd := &unstructured.Unstructured{}
 		data, err := ioutil.ReadFile(filePath)
 		if err != nil {
 			return fmt.Errorf("error reading file: %v", err)
@@ -38,7 +44,7 @@ func EnsureCreation(config *rest.Config, deployDir string) error {
 		if err := marshalCRDFromYAMLBytes(data, crd); err != nil {
 			return fmt.Errorf("error converting yaml bytes to CRD: %v", err)
 		}
-		_, err = apiextensionsClientSet.ApiextensionsV1beta1().CustomResourceDefinitions().Create(crd)
+		_, err = dynamicClient.Resource(crdResource).Create(crd, metav1.CreateOptions{})
 
 		if apierrors.IsAlreadyExists(err) {
 			fmt.Println("CRD already exists")
@@ -52,12 +58,12 @@ func EnsureCreation(config *rest.Config, deployDir string) error {
 	return nil
 }
 
-func marshalCRDFromYAMLBytes(bytes []byte, crd *apiextensionsv1beta1.CustomResourceDefinition) error {
+func marshalCRDFromYAMLBytes(bytes []byte, crd *unstructured.Unstructured) error {
 	jsonBytes, err := yaml.YAMLToJSON(bytes)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(jsonBytes, &crd)
+	return json.Unmarshal(jsonBytes, &crd.Object)
 }
 
 func allCrds(deployDir string) ([]string, error) {
@@ -37,10 +37,11 @@ type flags struct {
 	testImage               string
 	test                    string
 	performCleanup          string
+	environment             string
 }
 
 func parseFlags() flags {
-	var namespace, deployDir, operatorImage, versionUpgradeHookImage, testImage, test, performCleanup *string
+	var namespace, deployDir, operatorImage, versionUpgradeHookImage, testImage, test, performCleanup, environment *string
 	namespace = flag.String("namespace", "default", "the namespace the operator and tests should be deployed in")
 	deployDir = flag.String("deployDir", "deploy/", "the path to the directory which contains the yaml deployment files")
 	operatorImage = flag.String("operatorImage", "quay.io/mongodb/community-operator-dev:latest", "the image which should be used for the operator deployment")
@@ -48,6 +49,7 @@ func parseFlags() flags {
 	testImage = flag.String("testImage", "quay.io/mongodb/community-operator-e2e:latest", "the image which should be used for the operator e2e tests")
 	test = flag.String("test", "", "test e2e test that should be run. (name of folder containing the test)")
 	performCleanup = flag.String("performCleanup", "1", "specifies whether to performing a cleanup the context or not")
+	environment = flag.String("environment", "existing", "the environment of the cluster the tests run against: kind, openshift or existing")
 	flag.Parse()
 
 	return flags{
@@ -58,6 +60,7 @@ func parseFlags() flags {
 		testImage:               *testImage,
 		test:                    *test,
 		performCleanup:          *performCleanup,
+		environment:             *environment,
 	}
 }
 
@@ -97,7 +100,7 @@ func runCmd(f flags) error {
 	fmt.Println("Successfully deployed the operator")
 
 	testToRun := "test/operator-sdk-test.yaml"
-	if err := buildKubernetesResourceFromYamlFile(c, testToRun, &corev1.Pod{}, withNamespace(f.namespace), withTestImage(f.testImage), withTest(f.test), withEnvVar("PERFORM_CLEANUP", f.performCleanup)); err != nil {
+	if err := buildKubernetesResourceFromYamlFile(c, testToRun, &corev1.Pod{}, withNamespace(f.namespace), withTestImage(f.testImage), withTest(f.test), withEnvVar("PERFORM_CLEANUP", f.performCleanup), withEnvVar("E2E_ENVIRONMENT", f.environment)); err != nil {
 		return fmt.Errorf("error deploying test: %v", err)
 	}
 
@@ -1,42 +1,111 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/acendpoint"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/backupcrypt"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/readiness"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
 	agentStatusFilePathEnv = "AGENT_STATUS_FILEPATH"
+	dataPathEnv            = "DATA_PATH"
+	mongodDownTimeoutEnv   = "READINESS_MONGOD_DOWN_TIMEOUT"
+	healthStatusTimeoutEnv = "READINESS_HEALTH_STATUS_TIMEOUT"
+	encryptionKeyEnv       = "BACKUP_ENCRYPTION_KEY"
+
+	automationConfigURLEnv       = "AUTOMATION_CONFIG_URL"
+	automationConfigTokenFileEnv = "AUTOMATION_CONFIG_TOKEN_FILE"
+	automationConfigCAFileEnv    = "AUTOMATION_CONFIG_CA_FILE"
+	automationConfigFileEnv      = "AUTOMATION_CONFIG_FILE"
 
 	defaultNamespace = "default"
 
 	pollingInterval time.Duration = 1 * time.Second
 	pollingDuration time.Duration = 60 * time.Second
+
+	automationConfigPollingInterval = 3 * time.Second
 )
 
+// healthStatusFilePath is the path of the agent health status file
+var healthStatusFilePath string
+
+// publishedStatusFilePath is the path of the file recording the last member status published
+var publishedStatusFilePath string
+
 func main() {
+	reportHealth := flag.Bool("report-health", false, "publish the agent health status of this member as an annotation on its Pod and exit")
+	checkReadiness := flag.Bool("readiness", false, "check whether this member is ready from the agent health status, exit with a non-zero code if it isn't")
+	flag.StringVar(&healthStatusFilePath, "health-status-file", os.Getenv(agentStatusFilePathEnv), "the path of the agent health status file, defaults to the "+agentStatusFilePathEnv+" environment variable")
+	flag.StringVar(&publishedStatusFilePath, "published-status-file", "/hooks/published-member-status", "the path of the file recording the last member status published with -report-health, which must live as long as the Pod")
+	mongodDownTimeout := flag.Duration("mongod-down-timeout", durationFromEnv(mongodDownTimeoutEnv, readiness.DefaultConfig.MongodDownTimeout), "how long mongod can be down while the agent expects it to be up before the member is unready, defaults to the "+mongodDownTimeoutEnv+" environment variable")
+	healthStatusTimeout := flag.Duration("health-status-timeout", durationFromEnv(healthStatusTimeoutEnv, readiness.DefaultConfig.HealthStatusTimeout), "how long the agent can go without updating its health status before the member is unready, 0 to disable, defaults to the "+healthStatusTimeoutEnv+" environment variable")
+	encrypt := flag.Bool("encrypt", false, "encrypt stdin to stdout with the backup encryption key and exit")
+	decrypt := flag.Bool("decrypt", false, "decrypt stdin to stdout with the backup encryption key and exit, with a non-zero code if it can't be authenticated")
+	keyEnv := flag.String("key-env", encryptionKeyEnv, "the environment variable with the backup encryption key, encoded in base64")
+	pollAutomationConfig := flag.Bool("poll-automation-config", false, "poll the automation config from the operator to the file the agent reads it from, until the process is stopped")
+	flag.Parse()
+
+	if *encrypt || *decrypt {
+		if err := runBackupCrypt(*encrypt, os.Getenv(*keyEnv)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encrypting or decrypting the backup: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *checkReadiness {
+		os.Exit(runReadinessProbe(readiness.Config{MongodDownTimeout: *mongodDownTimeout, HealthStatusTimeout: *healthStatusTimeout}))
+	}
+
 	logger := setupLogger()
 
-	logger.Info("Running version change post-start hook")
+	if *pollAutomationConfig {
+		zap.ReplaceGlobals(logger.Desugar())
+		poller := &acendpoint.Poller{
+			URL:       os.Getenv(automationConfigURLEnv),
+			TokenFile: os.Getenv(automationConfigTokenFileEnv),
+			CAFile:    os.Getenv(automationConfigCAFileEnv),
+			File:      os.Getenv(automationConfigFileEnv),
+		}
+		logger.Infof("Polling the automation config from %s", poller.URL)
+		poller.Run(automationConfigPollingInterval, nil)
+		return
+	}
 
-	if statusPath := os.Getenv(agentStatusFilePathEnv); statusPath == "" {
+	if healthStatusFilePath == "" {
 		logger.Fatalf(`Required environment variable "%s" not set`, agentStatusFilePathEnv)
 		return
 	}
 
+	if *reportHealth {
+		// Reporting is best effort, failures must never cause the readiness probe to fail.
+		if err := reportMemberStatus(); err != nil {
+			logger.Errorf("Error reporting the agent health status: %s", err)
+		}
+		return
+	}
+
+	logger.Info("Running version change post-start hook")
+
 	logger.Info("Waiting for agent health status...")
 	health, err := waitForAgentHealthStatus()
 	if err != nil {
@@ -77,6 +146,84 @@ func main() {
 	}
 }
 
+// runReadinessProbe checks whether this member is ready and logs why as JSON, so that the reason
+// appears in the events of the Pod if the probe fails. It returns the exit code of the probe.
+func runReadinessProbe(cfg readiness.Config) int {
+	log, err := zap.NewProduction()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building logger: %s\n", err)
+		return 1
+	}
+	logger := log.With(zap.String("hostname", getHostname()))
+	defer func() { _ = logger.Sync() }()
+
+	if healthStatusFilePath == "" {
+		logger.Error("Not ready", zap.Bool("ready", false), zap.String("reason", "the path of the agent health status file is not set"))
+		return 1
+	}
+	result, err := checkReadiness(cfg, time.Now())
+	if err != nil {
+		// the agent hasn't written its health status yet, or the file is being written
+		logger.Info("Not ready", zap.Bool("ready", false), zap.String("reason", err.Error()))
+		return 1
+	}
+	if !result.Ready {
+		logger.Info("Not ready", zap.Bool("ready", false), zap.String("reason", result.Reason))
+		return 1
+	}
+	logger.Debug("Ready", zap.Bool("ready", true), zap.String("reason", result.Reason))
+	return 0
+}
+
+// checkReadiness reads the agent health status file and checks whether this member is ready
+func checkReadiness(cfg readiness.Config, now time.Time) (readiness.Result, error) {
+	health, updatedAt, err := agenthealth.ReadFile(healthStatusFilePath)
+	if err != nil {
+		return readiness.Result{}, err
+	}
+	return readiness.Check(health, getHostname(), updatedAt, cfg, now), nil
+}
+
+// runBackupCrypt encrypts or decrypts stdin to stdout with the given key, so that the archives of the
+// backups are encrypted before they leave the Pod taking them
+func runBackupCrypt(encrypt bool, encodedKey string) error {
+	key, err := backupcrypt.ParseKey(encodedKey)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriterSize(os.Stdout, 1<<20)
+	if encrypt {
+		w, err := backupcrypt.NewWriter(out, key)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, bufio.NewReaderSize(os.Stdin, 1<<20)); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+	r, err := backupcrypt.NewReader(bufio.NewReaderSize(os.Stdin, 1<<20), key)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// durationFromEnv returns the duration set by the environment variable, or defaultValue if it
+// isn't set or isn't a valid duration
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return d
+	}
+	return defaultValue
+}
+
 func setupLogger() *zap.SugaredLogger {
 	log, err := zap.NewDevelopment()
 	if err != nil {
@@ -101,7 +248,7 @@ func waitForAgentHealthStatus() (agenthealth.Health, error) {
 		}
 		totalTime += pollingInterval
 
-		health, err := getAgentHealthStatus()
+		health, _, err := agenthealth.ReadFile(healthStatusFilePath)
 		if err != nil {
 			return agenthealth.Health{}, err
 		}
@@ -121,34 +268,6 @@ func waitForAgentHealthStatus() (agenthealth.Health, error) {
 
 }
 
-// getAgentHealthStatus returns an instance of agenthealth.Health read
-// from the health file on disk
-func getAgentHealthStatus() (agenthealth.Health, error) {
-	f, err := os.Open(os.Getenv(agentStatusFilePathEnv))
-	if err != nil {
-		return agenthealth.Health{}, fmt.Errorf("error opening file: %s", err)
-	}
-	defer f.Close()
-
-	h, err := readAgentHealthStatus(f)
-	if err != nil {
-		return agenthealth.Health{}, fmt.Errorf("error reading health status: %s", err)
-	}
-	return h, err
-}
-
-// readAgentHealthStatus reads an instance of health.Health from the provided
-// io.Reader
-func readAgentHealthStatus(reader io.Reader) (agenthealth.Health, error) {
-	var h agenthealth.Health
-	data, err := ioutil.ReadAll(reader)
-	if err != nil {
-		return h, err
-	}
-	err = json.Unmarshal(data, &h)
-	return h, err
-}
-
 func getHostname() string {
 	return os.Getenv("HOSTNAME")
 }
@@ -161,25 +280,77 @@ func shouldDeletePod(health agenthealth.Health) (bool, error) {
 	if !ok {
 		return false, fmt.Errorf("hostname %s was not in the process plans", getHostname())
 	}
-	return isWaitingToBeDeleted(status), nil
+	return status.IsChangingVersion(), nil
 }
 
-// isWaitingToBeDeleted determines if the agent is currently waiting
-// on the mongod pod to be restarted. In order to do this, we need to check the agent
-// status file and determine if the mongod has been stopped and if we are in the process
-// of a version change.
-func isWaitingToBeDeleted(healthStatus agenthealth.MmsDirectorStatus) bool {
-	if len(healthStatus.Plans) == 0 {
-		return false
-	}
-	lastPlan := healthStatus.Plans[len(healthStatus.Plans)-1]
-	for _, m := range lastPlan.Moves {
-		// When changing version the plan will contain a "ChangeVersion" step
-		if m.Move == "ChangeVersion" {
-			return true
+// reportMemberStatus reads the agent health status file and publishes the summary
+// of this member as an annotation on its Pod. The Pod is only patched if the
+// summary differs from the last one published, which is recorded in a file.
+func reportMemberStatus() error {
+	health, _, err := agenthealth.ReadFile(healthStatusFilePath)
+	if err != nil {
+		return err
+	}
+	status, ok := health.MemberStatusFor(getHostname())
+	if !ok {
+		return fmt.Errorf("hostname %s was not in the process plans", getHostname())
+	}
+	if dataPath := os.Getenv(dataPathEnv); dataPath != "" {
+		usage, err := volumeUsage(dataPath)
+		if err != nil {
+			return fmt.Errorf("error reading disk usage of %s: %s", dataPath, err)
 		}
+		status.DataVolume = &usage
+	}
+	annotation, err := agenthealth.MemberStatusAnnotation(status)
+	if err != nil {
+		return err
+	}
+
+	// the probe runs every few seconds, the API server is only called when the summary changes
+	if published, err := ioutil.ReadFile(publishedStatusFilePath); err == nil && string(published) == annotation {
+		return nil
+	}
+
+	thisPod, err := getThisPod()
+	if err != nil {
+		return fmt.Errorf("error getting this pod: %s", err)
+	}
+	k8sClient, err := inClusterClient()
+	if err != nil {
+		return fmt.Errorf("error getting client: %s", err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{agenthealth.MemberStatusAnnotationKey: annotation},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := k8sClient.Patch(context.TODO(), &thisPod, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return fmt.Errorf("error patching pod: %s", err)
+	}
+	// the file lives as long as the Pod and its annotations, in the hooks volume
+	if err := ioutil.WriteFile(publishedStatusFilePath, []byte(annotation), 0644); err != nil {
+		return fmt.Errorf("error recording the published status: %s", err)
+	}
+	return nil
+}
+
+// volumeUsage returns the disk usage of the volume mounted at the given path. The used bytes
+// are rounded down to a percent of the capacity, so that the Pod is not patched on every write.
+func volumeUsage(path string) (agenthealth.VolumeUsage, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return agenthealth.VolumeUsage{}, err
+	}
+	capacity := int64(stat.Blocks) * int64(stat.Bsize)
+	used := int64(stat.Blocks-stat.Bfree) * int64(stat.Bsize)
+	if percent := capacity / 100; percent > 0 {
+		used = used / percent * percent
 	}
-	return false
+	return agenthealth.VolumeUsage{UsedBytes: used, CapacityBytes: capacity}, nil
 }
 
 // deletePod attempts to delete the pod this mongod is running in
@@ -5,6 +5,7 @@ go 1.13
 require (
 	github.com/Azure/go-autorest v14.0.1+incompatible // indirect
 	github.com/cespare/xxhash/v2 v2.1.1 // indirect
+	github.com/evanphx/json-patch v4.5.0+incompatible
 	github.com/ghodss/yaml v1.0.1-0.20190212211648-25d852aebe32
 	github.com/gobuffalo/envy v1.7.1 // indirect
 	github.com/golang/protobuf v1.3.5 // indirect
@@ -15,10 +16,12 @@ require (
 	github.com/klauspost/compress v1.9.8 // indirect
 	github.com/konsorten/go-windows-terminal-sequences v1.0.3 // indirect
 	github.com/operator-framework/operator-sdk v0.17.0
+	github.com/prometheus/client_golang v1.5.1
 	github.com/prometheus/procfs v0.0.11 // indirect
 	github.com/rogpeppe/go-internal v1.5.2 // indirect
 	github.com/spf13/cobra v0.0.7 // indirect
 	github.com/stretchr/testify v1.4.0
+	github.com/xdg/stringprep v1.0.0
 	go.mongodb.org/mongo-driver v1.3.2
 	go.uber.org/zap v1.14.1
 	google.golang.org/appengine v1.6.6 // indirect
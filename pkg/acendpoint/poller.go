@@ -0,0 +1,132 @@
+package acendpoint
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Poller downloads the automation config served at URL to File, where the agent reads it. The token
+// and the CA are read from their files at every poll, so that they can be rotated without restarting
+// the agent container.
+type Poller struct {
+	URL       string
+	TokenFile string
+	CAFile    string
+	File      string
+
+	client *http.Client
+	caPEM  []byte
+	etag   string
+}
+
+// Run polls the automation config every interval until the stop channel is closed, the errors are
+// logged and retried at the next poll.
+func (p *Poller) Run(interval time.Duration, stop <-chan struct{}) {
+	wait.Until(func() {
+		updated, err := p.Poll()
+		if err != nil {
+			zap.S().Warnf("Error polling the automation config: %s", err)
+			return
+		}
+		if updated {
+			zap.S().Infof("Wrote the automation config to %s", p.File)
+		}
+	}, interval, stop)
+}
+
+// Poll downloads the automation config, and writes it to File if it changed since the last poll.
+// It returns true if the automation config was written.
+func (p *Poller) Poll() (bool, error) {
+	client, err := p.httpClient()
+	if err != nil {
+		return false, err
+	}
+	token, err := ioutil.ReadFile(p.TokenFile)
+	if err != nil {
+		return false, fmt.Errorf("error reading the token: %s", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	if p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("error reading the automation config: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s answered %s: %s", p.URL, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if err := writeFileAtomically(p.File, body); err != nil {
+		return false, fmt.Errorf("error writing the automation config: %s", err)
+	}
+	p.etag = resp.Header.Get("ETag")
+	return true, nil
+}
+
+// httpClient returns the client verifying the server with the CA of CAFile, which is built again if
+// the CA changed
+func (p *Poller) httpClient() (*http.Client, error) {
+	caPEM, err := ioutil.ReadFile(p.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the CA: %s", err)
+	}
+	if p.client != nil && bytes.Equal(caPEM, p.caPEM) {
+		return p.client, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificate found in %s", p.CAFile)
+	}
+	p.client = &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		},
+	}
+	p.caPEM = caPEM
+	return p.client, nil
+}
+
+// writeFileAtomically replaces the file with the data, so that the agent never reads a partial file
+func writeFileAtomically(file string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
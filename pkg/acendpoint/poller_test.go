@@ -0,0 +1,111 @@
+package acendpoint
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPoller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acendpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mdb := types.NamespacedName{Namespace: "my-ns", Name: "my-rs"}
+	source := mockSource{
+		automationConfigs: map[types.NamespacedName][]byte{mdb: []byte(`{"version":1}`)},
+		tokens:            map[types.NamespacedName]string{mdb: "my-token"},
+	}
+	server := httptest.NewTLSServer(Handler(source))
+	defer server.Close()
+
+	caFile := filepath.Join(dir, CAFileName)
+	assert.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("my-token\n"), 0600))
+	p := &Poller{
+		URL:       server.URL + PathPrefix + "my-ns/my-rs",
+		TokenFile: tokenFile,
+		CAFile:    caFile,
+		File:      filepath.Join(dir, "automation-config"),
+	}
+
+	t.Run("The automation config is written", func(t *testing.T) {
+		updated, err := p.Poll()
+		assert.NoError(t, err)
+		assert.True(t, updated)
+		data, err := ioutil.ReadFile(p.File)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"version":1}`, string(data))
+	})
+
+	t.Run("The automation config is only written when it changes", func(t *testing.T) {
+		updated, err := p.Poll()
+		assert.NoError(t, err)
+		assert.False(t, updated)
+
+		source.automationConfigs[mdb] = []byte(`{"version":2}`)
+		updated, err = p.Poll()
+		assert.NoError(t, err)
+		assert.True(t, updated)
+		data, err := ioutil.ReadFile(p.File)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"version":2}`, string(data))
+	})
+
+	t.Run("The automation config is kept when it can't be downloaded", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("rotated-token"), 0600))
+		_, err := p.Poll()
+		assert.Error(t, err)
+		data, err := ioutil.ReadFile(p.File)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"version":2}`, string(data))
+
+		// the rotated token is read at the next poll
+		source.tokens[mdb] = "rotated-token"
+		source.automationConfigs[mdb] = []byte(`{"version":3}`)
+		updated, err := p.Poll()
+		assert.NoError(t, err)
+		assert.True(t, updated)
+	})
+
+	t.Run("The server is verified with the CA", func(t *testing.T) {
+		otherCAFile := filepath.Join(dir, "other-ca.crt")
+		assert.NoError(t, ioutil.WriteFile(otherCAFile, selfSignedCertificate(t), 0600))
+		untrusted := &Poller{URL: p.URL, TokenFile: tokenFile, CAFile: otherCAFile, File: filepath.Join(dir, "untrusted")}
+		_, err := untrusted.Poll()
+		assert.Error(t, err)
+		_, err = os.Stat(untrusted.File)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func selfSignedCertificate(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,178 @@
+// Package acendpoint serves the automation configs of the MongoDB resources over HTTPS, and polls
+// them from the agent container, so that the agents get a new automation config within seconds
+// instead of waiting for the kubelet to update a mounted ConfigMap.
+package acendpoint
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// PathPrefix is the path the automation config of a resource is served at, followed by
+	// <namespace>/<name>
+	PathPrefix = "/automation-config/"
+
+	certFileName = "tls.crt"
+	keyFileName  = "tls.key"
+	// CAFileName is the file of the certificate directory holding the CA of the certificate of the
+	// server, which the agents verify it with
+	CAFileName = "ca.crt"
+)
+
+// Source reads the automation configs served, and the tokens the agents of each resource
+// authenticate with. The errors for which errors.IsNotFound is true are reported as such.
+type Source interface {
+	// AutomationConfig returns the automation config of the resource, uncompressed
+	AutomationConfig(nsName types.NamespacedName) ([]byte, error)
+	// Token returns the token the agents of the resource authenticate with
+	Token(nsName types.NamespacedName) (string, error)
+}
+
+// Handler serves the automation config of a resource at PathPrefix<namespace>/<name> to the
+// requests with its token as a bearer token. The ETag of the response is the hash of the
+// automation config, so that the agents only download it when it changes.
+func Handler(source Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(req.URL.Path, PathPrefix), "/")
+		if !strings.HasPrefix(req.URL.Path, PathPrefix) || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			http.NotFound(w, req)
+			return
+		}
+		nsName := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+
+		// the resources without a token can't be told apart from a wrong token, so that the
+		// resources can't be listed without one
+		token, err := source.Token(nsName)
+		if err != nil && !errors.IsNotFound(err) {
+			zap.S().Warnf("Error reading the automation config token of %s: %s", nsName, err)
+			http.Error(w, "error reading the token", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || !validToken(req, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		ac, err := source.AutomationConfig(nsName)
+		if errors.IsNotFound(err) {
+			http.NotFound(w, req)
+			return
+		}
+		if err != nil {
+			zap.S().Warnf("Error reading the automation config of %s: %s", nsName, err)
+			http.Error(w, "error reading the automation config", http.StatusInternalServerError)
+			return
+		}
+		etag := ETag(ac)
+		w.Header().Set("ETag", etag)
+		if req.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(ac)
+	})
+}
+
+func validToken(req *http.Request, token string) bool {
+	const prefix = "Bearer "
+	header := req.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, prefix)), []byte(token)) == 1
+}
+
+// ETag returns the entity tag of the automation config
+func ETag(ac []byte) string {
+	hash := sha256.Sum256(ac)
+	return `"` + hex.EncodeToString(hash[:]) + `"`
+}
+
+// Server serves the Handler with TLS on Addr, with the tls.crt and tls.key files of CertDir, which are
+// read again when they change, e.g. when cert-manager renews the certificate. It implements
+// manager.Runnable.
+type Server struct {
+	Addr    string
+	CertDir string
+	Handler http.Handler
+}
+
+func (s Server) Start(stop <-chan struct{}) error {
+	certificate := &certificateReloader{
+		certFile: filepath.Join(s.CertDir, certFileName),
+		keyFile:  filepath.Join(s.CertDir, keyFileName),
+	}
+	if _, err := certificate.get(nil); err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s.Handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certificate.get,
+		},
+	}
+	go func() {
+		<-stop
+		server.Close()
+	}()
+	if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection returns false, so that every replica of the operator serves the automation configs
+func (s Server) NeedLeaderElection() bool {
+	return false
+}
+
+// certificateReloader loads the certificate and its key again when the certificate file changes
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+func (c *certificateReloader) get(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the certificate of the automation config server: %s", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.certificate != nil && info.ModTime().Equal(c.modTime) {
+		return c.certificate, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the certificate of the automation config server: %s", err)
+	}
+	c.certificate, c.modTime = &certificate, info.ModTime()
+	return c.certificate, nil
+}
@@ -0,0 +1,93 @@
+package acendpoint
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// mockSource serves the automation configs and the tokens of the map keys
+type mockSource struct {
+	automationConfigs map[types.NamespacedName][]byte
+	tokens            map[types.NamespacedName]string
+}
+
+func notFound(nsName types.NamespacedName) error {
+	return errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, nsName.Name)
+}
+
+func (s mockSource) AutomationConfig(nsName types.NamespacedName) ([]byte, error) {
+	if ac, ok := s.automationConfigs[nsName]; ok {
+		return ac, nil
+	}
+	return nil, notFound(nsName)
+}
+
+func (s mockSource) Token(nsName types.NamespacedName) (string, error) {
+	if token, ok := s.tokens[nsName]; ok {
+		return token, nil
+	}
+	return "", notFound(nsName)
+}
+
+func TestHandler(t *testing.T) {
+	mdb := types.NamespacedName{Namespace: "my-ns", Name: "my-rs"}
+	other := types.NamespacedName{Namespace: "my-ns", Name: "other-rs"}
+	source := mockSource{
+		automationConfigs: map[types.NamespacedName][]byte{mdb: []byte(`{"version":1}`), other: []byte(`{"version":2}`)},
+		tokens:            map[types.NamespacedName]string{mdb: "my-token", other: "other-token"},
+	}
+	handler := Handler(source)
+	get := func(path, token, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("The automation config is served with the token of the resource", func(t *testing.T) {
+		rec := get("/automation-config/my-ns/my-rs", "my-token", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"version":1}`, rec.Body.String())
+		assert.Equal(t, ETag([]byte(`{"version":1}`)), rec.Header().Get("ETag"))
+	})
+
+	t.Run("The automation config isn't sent again if it hasn't changed", func(t *testing.T) {
+		rec := get("/automation-config/my-ns/my-rs", "my-token", ETag([]byte(`{"version":1}`)))
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.String())
+
+		rec = get("/automation-config/my-ns/my-rs", "my-token", ETag([]byte(`{"version":0}`)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("The requests without the token of the resource are rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, get("/automation-config/my-ns/my-rs", "", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, get("/automation-config/my-ns/my-rs", "wrong-token", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, get("/automation-config/my-ns/my-rs", "other-token", "").Code, "the tokens are per resource")
+		assert.Equal(t, http.StatusUnauthorized, get("/automation-config/my-ns/unknown-rs", "my-token", "").Code, "unknown resources can't be told apart")
+	})
+
+	t.Run("Only the automation configs are served", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/automation-config/my-ns", "my-token", "").Code)
+		assert.Equal(t, http.StatusNotFound, get("/automation-config/my-ns/my-rs/more", "my-token", "").Code)
+		assert.Equal(t, http.StatusNotFound, get("/other/my-ns/my-rs", "my-token", "").Code)
+
+		req := httptest.NewRequest(http.MethodPost, "/automation-config/my-ns/my-rs", nil)
+		req.Header.Set("Authorization", "Bearer my-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
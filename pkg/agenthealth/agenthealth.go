@@ -13,6 +13,8 @@ type ProcessHealth struct {
 	IsInGoalState   bool  `json:"IsInGoalState"`
 	ExpectedToBeUp  bool  `json:"ExpectedToBeUp"`
 	LastMongoUpTime int64 `json:"LastMongoUpTime"`
+	// ReplicationStatus is the replica set state of the process, e.g. 1 for PRIMARY, if it is known
+	ReplicationStatus *int `json:"ReplicationStatus,omitempty"`
 }
 
 type MmsDirectorStatus struct {
@@ -38,3 +40,66 @@ type StepStatus struct {
 	Completed *time.Time `json:"completed"`
 	Result    string     `json:"result"`
 }
+
+// MemberStatusAnnotationKey is the Pod annotation under which the summary of the
+// agent health status of a member is published, so it can be read by the operator.
+const MemberStatusAnnotationKey = "mongodb.com/v1.agentStatus"
+
+// MemberStatus summarizes the progress of the agent of a single member.
+type MemberStatus struct {
+	LastGoalVersionAchieved int64  `json:"lastGoalVersionAchieved"`
+	IsInGoalState           bool   `json:"isInGoalState"`
+	CurrentStep             string `json:"currentStep,omitempty"`
+	// CurrentStepSince is when the plan last made progress: the start of the current step, or
+	// the completion of the previous one if the current step hasn't started yet.
+	CurrentStepSince *time.Time   `json:"currentStepSince,omitempty"`
+	DataVolume       *VolumeUsage `json:"dataVolume,omitempty"`
+}
+
+// VolumeUsage is the disk usage of a volume
+type VolumeUsage struct {
+	UsedBytes     int64 `json:"usedBytes"`
+	CapacityBytes int64 `json:"capacityBytes"`
+}
+
+// MemberStatusFor returns the MemberStatus of the process with the given hostname.
+// The boolean is false if the health status doesn't contain the process.
+func (h Health) MemberStatusFor(hostname string) (MemberStatus, bool) {
+	plans, ok := h.ProcessPlans[hostname]
+	if !ok {
+		return MemberStatus{}, false
+	}
+	step, since := currentStep(plans)
+	return MemberStatus{
+		LastGoalVersionAchieved: plans.LastGoalStateClusterConfigVersion,
+		IsInGoalState:           h.Healthiness[hostname].IsInGoalState,
+		CurrentStep:             step,
+		CurrentStepSince:        since,
+	}, true
+}
+
+// currentStep returns the first step not yet completed of the last plan
+// in the form "<move>/<step>", or an empty string if no plan is in progress,
+// and the time the plan last made progress.
+func currentStep(status MmsDirectorStatus) (string, *time.Time) {
+	if len(status.Plans) == 0 {
+		return "", nil
+	}
+	lastPlan := status.Plans[len(status.Plans)-1]
+	if lastPlan.Completed != nil {
+		return "", nil
+	}
+	since := lastPlan.Started
+	for _, m := range lastPlan.Moves {
+		for _, s := range m.Steps {
+			if s.Completed == nil {
+				if s.Started != nil {
+					since = s.Started
+				}
+				return m.Move + "/" + s.Step, since
+			}
+			since = s.Completed
+		}
+	}
+	return "", nil
+}
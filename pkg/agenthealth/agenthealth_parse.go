@@ -0,0 +1,80 @@
+package agenthealth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Parse reads the health status written by the agent
+func Parse(reader io.Reader) (Health, error) {
+	var h Health
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return h, err
+	}
+	err = json.Unmarshal(data, &h)
+	return h, err
+}
+
+// ReadFile reads the health status file of the agent, and returns when it was last updated
+func ReadFile(path string) (Health, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Health{}, time.Time{}, fmt.Errorf("error opening file: %s", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Health{}, time.Time{}, fmt.Errorf("error reading file: %s", err)
+	}
+	h, err := Parse(f)
+	if err != nil {
+		return Health{}, time.Time{}, fmt.Errorf("error reading health status: %s", err)
+	}
+	return h, info.ModTime(), nil
+}
+
+// IsChangingVersion returns whether the last plan of the agent changes the version of the process, in
+// which case the agent waits for mongod to be restarted with the new version
+func (s MmsDirectorStatus) IsChangingVersion() bool {
+	if len(s.Plans) == 0 {
+		return false
+	}
+	lastPlan := s.Plans[len(s.Plans)-1]
+	for _, m := range lastPlan.Moves {
+		// When changing version the plan will contain a "ChangeVersion" step
+		if m.Move == "ChangeVersion" {
+			return true
+		}
+	}
+	return false
+}
+
+// MemberStatusAnnotation returns the value of the MemberStatusAnnotationKey annotation publishing the
+// status on the Pod of the member
+func MemberStatusAnnotation(status MemberStatus) (string, error) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// MemberStatusFromAnnotations returns the status published in the annotations of the Pod of a member.
+// The boolean is false if the Pod has no status yet.
+func MemberStatusFromAnnotations(annotations map[string]string) (MemberStatus, bool, error) {
+	annotation, ok := annotations[MemberStatusAnnotationKey]
+	if !ok {
+		return MemberStatus{}, false, nil
+	}
+	status := MemberStatus{}
+	if err := json.Unmarshal([]byte(annotation), &status); err != nil {
+		return MemberStatus{}, false, err
+	}
+	return status, true, nil
+}
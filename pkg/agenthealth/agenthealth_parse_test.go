@@ -0,0 +1,77 @@
+package agenthealth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testHealthStatus = `{
+	"statuses": {"my-rs-0": {"IsInGoalState": true, "LastMongoUpTime": 1568222195, "ExpectedToBeUp": true}},
+	"mmsStatus": {
+		"my-rs-0": {
+			"name": "my-rs-0",
+			"lastGoalVersionAchieved": 2,
+			"plans": [{"moves": [{"move": "ChangeVersion", "steps": [{"step": "Stop", "isWaitStep": false}]}]}]
+		}
+	}
+}`
+
+func TestParse(t *testing.T) {
+	health, err := Parse(strings.NewReader(testHealthStatus))
+	assert.NoError(t, err)
+	assert.True(t, health.Healthiness["my-rs-0"].IsInGoalState)
+	assert.Equal(t, int64(2), health.ProcessPlans["my-rs-0"].LastGoalStateClusterConfigVersion)
+	assert.True(t, health.ProcessPlans["my-rs-0"].IsChangingVersion())
+
+	_, err = Parse(strings.NewReader("{"))
+	assert.Error(t, err)
+}
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agenthealth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "agent-health-status.json")
+	_, _, err = ReadFile(path)
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(testHealthStatus), 0644))
+	health, updatedAt, err := ReadFile(path)
+	assert.NoError(t, err)
+	info, _ := os.Stat(path)
+	assert.Equal(t, info.ModTime(), updatedAt)
+	assert.Contains(t, health.Healthiness, "my-rs-0")
+}
+
+func TestIsChangingVersion(t *testing.T) {
+	assert.False(t, MmsDirectorStatus{}.IsChangingVersion())
+	status := MmsDirectorStatus{Plans: []*PlanStatus{
+		{Moves: []*MoveStatus{{Move: "ChangeVersion"}}},
+		{Moves: []*MoveStatus{{Move: "Start"}}},
+	}}
+	assert.False(t, status.IsChangingVersion(), "only the last plan is checked")
+}
+
+func TestMemberStatusAnnotation(t *testing.T) {
+	status := MemberStatus{LastGoalVersionAchieved: 3, IsInGoalState: true, CurrentStep: "Start/StartFresh"}
+	annotation, err := MemberStatusAnnotation(status)
+	assert.NoError(t, err)
+
+	parsed, ok, err := MemberStatusFromAnnotations(map[string]string{MemberStatusAnnotationKey: annotation})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, status, parsed)
+
+	_, ok, err = MemberStatusFromAnnotations(nil)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = MemberStatusFromAnnotations(map[string]string{MemberStatusAnnotationKey: "{"})
+	assert.Error(t, err)
+}
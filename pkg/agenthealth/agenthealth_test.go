@@ -0,0 +1,72 @@
+package agenthealth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemberStatusFor(t *testing.T) {
+	now := time.Now()
+	health := Health{
+		Healthiness: map[string]ProcessHealth{
+			"my-rs-0": {IsInGoalState: true},
+			"my-rs-1": {IsInGoalState: false},
+		},
+		ProcessPlans: map[string]MmsDirectorStatus{
+			"my-rs-0": {
+				LastGoalStateClusterConfigVersion: 3,
+				Plans: []*PlanStatus{{
+					Started:   &now,
+					Completed: &now,
+					Moves:     []*MoveStatus{{Move: "Start", Steps: []*StepStatus{{Step: "StartFresh", Completed: &now}}}},
+				}},
+			},
+			"my-rs-1": {
+				LastGoalStateClusterConfigVersion: 2,
+				Plans: []*PlanStatus{{
+					Started: &now,
+					Moves: []*MoveStatus{
+						{Move: "Download", Steps: []*StepStatus{{Step: "Download", Completed: &now}}},
+						{Move: "ChangeVersion", Steps: []*StepStatus{{Step: "Stop", Started: &now}, {Step: "Start"}}},
+					},
+				}},
+			},
+		},
+	}
+
+	status, ok := health.MemberStatusFor("my-rs-0")
+	assert.True(t, ok)
+	assert.Equal(t, MemberStatus{LastGoalVersionAchieved: 3, IsInGoalState: true}, status)
+
+	status, ok = health.MemberStatusFor("my-rs-1")
+	assert.True(t, ok)
+	assert.Equal(t, MemberStatus{LastGoalVersionAchieved: 2, IsInGoalState: false, CurrentStep: "ChangeVersion/Stop", CurrentStepSince: &now}, status)
+
+	_, ok = health.MemberStatusFor("my-rs-2")
+	assert.False(t, ok)
+}
+
+func TestMemberStatusFor_CurrentStepSinceCompletionOfPreviousStep(t *testing.T) {
+	started := time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC)
+	downloaded := started.Add(time.Minute)
+	health := Health{
+		ProcessPlans: map[string]MmsDirectorStatus{
+			"my-rs-0": {
+				Plans: []*PlanStatus{{
+					Started: &started,
+					Moves: []*MoveStatus{
+						{Move: "Download", Steps: []*StepStatus{{Step: "Download", Started: &started, Completed: &downloaded}}},
+						{Move: "Start", Steps: []*StepStatus{{Step: "StartFresh"}}},
+					},
+				}},
+			},
+		},
+	}
+
+	status, ok := health.MemberStatusFor("my-rs-0")
+	assert.True(t, ok)
+	assert.Equal(t, "Start/StartFresh", status.CurrentStep)
+	assert.Equal(t, &downloaded, status.CurrentStepSince)
+}
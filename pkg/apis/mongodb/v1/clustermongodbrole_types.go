@@ -0,0 +1,77 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterMongoDBRoleSpec defines a custom role, created in the admin database of the MongoDB resources
+// referencing it from spec.security.roleRefs
+type ClusterMongoDBRoleSpec struct {
+	// Role is the name of the role, it defaults to the name of the ClusterMongoDBRole
+	// +optional
+	Role string `json:"role,omitempty"`
+	// Privileges are the actions the role allows on the resources
+	// +optional
+	Privileges []Privilege `json:"privileges,omitempty"`
+	// Roles are the roles it inherits from, built-in roles or other custom roles
+	// +optional
+	Roles []Role `json:"roles,omitempty"`
+}
+
+// Privilege allows the actions on a resource
+type Privilege struct {
+	Resource PrivilegeResource `json:"resource"`
+	// Actions are the privilege actions allowed on the resource, e.g. find or insert
+	// +kubebuilder:validation:MinItems=1
+	Actions []string `json:"actions"`
+}
+
+// PrivilegeResource is either a database and a collection, where an empty name matches all of them,
+// or the cluster
+// +kubebuilder:validation:XValidation:rule="has(self.cluster) && self.cluster ? !has(self.db) && !has(self.collection) : has(self.db) && has(self.collection)",message="either cluster or db and collection must be set"
+type PrivilegeResource struct {
+	// DB is the database of the resource, an empty name matches all the databases
+	// +optional
+	DB *string `json:"db,omitempty"`
+	// Collection is the collection of the resource, an empty name matches all the collections
+	// +optional
+	Collection *string `json:"collection,omitempty"`
+	// Cluster is true for the cluster-wide actions, such as replSetGetStatus
+	// +optional
+	Cluster bool `json:"cluster,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterMongoDBRole is a custom role shared by the MongoDB resources of all the namespaces. The
+// resources referencing it are updated when it changes.
+// +kubebuilder:resource:path=clustermongodbroles,scope=Cluster,shortName=mdbrole
+// +kubebuilder:printcolumn:name="Role",type="string",JSONPath=".spec.role",description="Name of the role, if it isn't the name of the resource"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ClusterMongoDBRole struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterMongoDBRoleSpec `json:"spec,omitempty"`
+}
+
+// RoleName returns the name of the role created by the ClusterMongoDBRole
+func (r ClusterMongoDBRole) RoleName() string {
+	if r.Spec.Role != "" {
+		return r.Spec.Role
+	}
+	return r.Name
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterMongoDBRoleList contains a list of ClusterMongoDBRole
+type ClusterMongoDBRoleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterMongoDBRole `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterMongoDBRole{}, &ClusterMongoDBRoleList{})
+}
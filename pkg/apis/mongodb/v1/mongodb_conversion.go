@@ -0,0 +1,5 @@
+package v1
+
+// Hub marks v1 as the version the other versions of the MongoDB resources are converted to and
+// from, it's the version they're stored in
+func (*MongoDB) Hub() {}
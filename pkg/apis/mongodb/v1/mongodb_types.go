@@ -6,7 +6,9 @@ import (
 
 	"k8s.io/apimachinery/pkg/types"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 type Type string
@@ -17,26 +19,87 @@ const (
 
 type Phase string
 
+// VolumeReclaimPolicy defines what happens to the volumes of the members removed on scale-down
+type VolumeReclaimPolicy string
+
+const (
+	// RetainVolumes keeps the volumes, they are reused if the replica set is scaled up again
+	RetainVolumes VolumeReclaimPolicy = "Retain"
+	// DeleteVolumes deletes the volumes
+	DeleteVolumes VolumeReclaimPolicy = "Delete"
+	// LabelVolumes keeps the volumes but labels them for later cleanup
+	LabelVolumes VolumeReclaimPolicy = "Label"
+)
+
+// AutomationConfigDelivery defines how the automation config reaches the agents
+type AutomationConfigDelivery string
+
+const (
+	// ConfigMapDelivery mounts the ConfigMap of the automation config in the Pods
+	ConfigMapDelivery AutomationConfigDelivery = "ConfigMap"
+	// EndpointDelivery makes the agents poll the automation config from the operator over HTTPS
+	EndpointDelivery AutomationConfigDelivery = "Endpoint"
+)
+
+// DeletionPolicy defines what happens to the resources of the deployment when the MongoDB
+// resource is deleted
+type DeletionPolicy string
+
+const (
+	// RetainResources keeps the volumes, and the Secrets, Services and ConfigMaps owned by the
+	// resource such as the generated credentials and the automation config, so that the
+	// deployment can be recreated with its data
+	RetainResources DeletionPolicy = "Retain"
+	// DeleteResources deletes them
+	DeleteResources DeletionPolicy = "Delete"
+)
+
+// DependentResourceKind is the kind of an object listed in spec.dependentResources
+type DependentResourceKind string
+
+const (
+	DependentSecret    DependentResourceKind = "Secret"
+	DependentConfigMap DependentResourceKind = "ConfigMap"
+)
+
 const (
 	Running Phase = "Running"
+	Failed  Phase = "Failed"
+	Paused  Phase = "Paused"
+	// Pending means the reconciliation failed with an error which is retried
+	Pending Phase = "Pending"
 )
 
 // MongoDBSpec defines the desired state of MongoDB
+// +kubebuilder:validation:XValidation:rule="!has(self.initFrom) || !has(self.storage) || !has(self.storage.ephemeral) || !self.storage.ephemeral",message="spec.initFrom can't be used with ephemeral storage"
 type MongoDBSpec struct {
-	// Members is the number of members in the replica set
+	// Members is the number of members in the replica set. Defaults to 3 if 0
+	// +kubebuilder:validation:Minimum=0
 	// +optional
 	Members int `json:"members"`
 	// Type defines which type of MongoDB deployment the resource should create
 	// +kubebuilder:validation:Enum=ReplicaSet
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec.type can't be changed"
 	Type Type `json:"type"`
-	// Version defines which version of MongoDB will be used
+	// Version defines which version of MongoDB will be used, a semantic version such as 4.2.6
+	// +kubebuilder:validation:Pattern=`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?$`
 	Version string `json:"version"`
 
 	// FeatureCompatibilityVersion configures the feature compatibility version that will
-	// be set for the deployment
+	// be set for the deployment, a release series such as 4.2
+	// +kubebuilder:validation:Pattern=`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)$`
 	// +optional
 	FeatureCompatibilityVersion string `json:"featureCompatibilityVersion,omitempty"`
 
+	// AdditionalMongodConfig are the options of mongod the resource has no field for, as nested
+	// objects like in the configuration file of mongod, e.g. {"setParameter": {"cursorTimeoutMillis": 600000}}.
+	// The options set by the operator, such as net.port, net.tls, storage.dbPath and
+	// replication.replSetName, take precedence. The options removed by the release series of
+	// spec.version are dropped when it always behaves as they configure it, and rejected otherwise.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	AdditionalMongodConfig *runtime.RawExtension `json:"additionalMongodConfig,omitempty"`
+
 	// Security configures security features, such as TLS, and authentication settings for a deployment
 	// +optional
 	Security Security `json:"security"`
@@ -44,6 +107,773 @@ type MongoDBSpec struct {
 	// Users specifies the MongoDB users that should be configured in your deployment
 	// +required
 	Users []MongoDBUser `json:"users"`
+
+	// Storage configures the persistent volumes of the members
+	// +optional
+	Storage Storage `json:"storage,omitempty"`
+
+	// AutomationFreeze stops the operator from publishing new versions of the automation config
+	// while Kubernetes resources keep being reconciled. This allows manual maintenance to be
+	// performed without the agents reverting it. Changes to the resource which require a new
+	// automation config, such as scaling or changing version, only take effect once unfrozen.
+	// +optional
+	AutomationFreeze bool `json:"automationFreeze,omitempty"`
+
+	// AutomationConfigDelivery is how the agents get the automation config. With ConfigMap, the
+	// default, the ConfigMap of the automation config is mounted in the Pods, and a new version takes
+	// up to a minute to be propagated by the kubelet. With Endpoint, the agents poll it every few
+	// seconds from the operator over HTTPS, authenticated with a token generated for the resource,
+	// which requires the operator to be configured with the URL it is served at. Changing it restarts
+	// the members one at a time
+	// +kubebuilder:validation:Enum=ConfigMap;Endpoint
+	// +optional
+	AutomationConfigDelivery AutomationConfigDelivery `json:"automationConfigDelivery,omitempty"`
+
+	// Paused stops the operator from making any change to the deployment, including the
+	// Kubernetes resources, so that manual interventions aren't reverted. The status keeps
+	// being updated. Changes to the resource only take effect once unpaused.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// MaintenanceWindow restricts the disruptive changes, such as version changes and rolling
+	// restarts of the members, to recurring windows. The changes made outside of a window are
+	// applied once the next one starts.
+	// +optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+
+	// RestartedAt triggers a rolling restart of the members whose Pod was created before this
+	// time. The secondaries are restarted one at a time, and the primary is stepped down and
+	// restarted last.
+	// +optional
+	RestartedAt *metav1.Time `json:"restartedAt,omitempty"`
+
+	// DependentResources are Secrets and ConfigMaps used by the members, such as a CA bundle or the
+	// configuration of a sidecar mounted with spec.statefulSet, whose changes trigger a rolling
+	// restart of the members, like spec.restartedAt
+	// +optional
+	DependentResources []DependentResource `json:"dependentResources,omitempty"`
+
+	// DeletionPolicy defines what happens to the volumes, and the Secrets, Services and
+	// ConfigMaps owned by the resource, when the resource is deleted, once the replica set has
+	// been shut down. Defaults to Retain
+	// +kubebuilder:validation:Enum=Retain;Delete
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// Adopt takes over an existing replica set which isn't managed by the operator yet, e.g.
+	// deployed with a Helm chart. Its configuration and users are read to generate the automation
+	// config, and the members are replaced one at a time, keeping their volumes.
+	// +optional
+	Adopt *Adoption `json:"adopt,omitempty"`
+
+	// InitFrom seeds the data of a new deployment from another MongoDB resource or a
+	// VolumeSnapshot. It is only used when the deployment is created.
+	// +optional
+	InitFrom *InitFrom `json:"initFrom,omitempty"`
+
+	// Bootstrap loads a dataset into the replica set once it is first initialized. It is only
+	// used when the deployment is created.
+	// +optional
+	Bootstrap *Bootstrap `json:"bootstrap,omitempty"`
+
+	// InitScripts are run once, in order, once the replica set is healthy, e.g. to create
+	// indexes or seed collections
+	// +optional
+	InitScripts []InitScript `json:"initScripts,omitempty"`
+
+	// Resources are the compute resources of the containers of the members. A change is applied to
+	// one member at a time, and the primary is stepped down and restarted last.
+	// +optional
+	Resources *Resources `json:"resources,omitempty"`
+
+	// StuckPlanTimeout is how long the plan of an agent can make no progress before the operator
+	// tries to recover it, by publishing the automation config again, and then by restarting the
+	// agent. It defaults to 15 minutes, and 0 disables the recovery.
+	// +optional
+	StuckPlanTimeout *metav1.Duration `json:"stuckPlanTimeout,omitempty"`
+
+	// GatedRollout makes the operator wait for an approval after each member is updated by a
+	// version upgrade, a rolling restart or a change of the resources, before updating the next
+	// one. The update of the next member is approved by annotating the resource with
+	// mongodb.com/v1.approveRollout set to the member last updated, given in status.rollout.
+	// +optional
+	GatedRollout bool `json:"gatedRollout,omitempty"`
+
+	// ExternalAccess exposes every member outside of the cluster with a Service of its own, whose
+	// hostname is published by external-dns and advertised to the clients as a replica set horizon.
+	// It requires TLS, as the clients select the horizon with the SNI of their connection.
+	// +optional
+	ExternalAccess *ExternalAccess `json:"externalAccess,omitempty"`
+
+	// Prometheus deploys mongodb_exporter as a sidecar of every member, which exposes the metrics
+	// of the member on a port of its Pod. If authentication is enabled, the exporter authenticates
+	// as a user with the clusterMonitor role created by the operator.
+	// +optional
+	Prometheus *Prometheus `json:"prometheus,omitempty"`
+
+	// OpsManager registers the members with the monitoring of Cloud Manager or Ops Manager, and
+	// deploys a MongoDB Agent monitoring them. If authentication is enabled, the agent authenticates
+	// as a user with the clusterMonitor role created by the operator.
+	// +optional
+	OpsManager *OpsManagerMonitoring `json:"opsManager,omitempty"`
+
+	// Migration migrates the data between the replica set and a MongoDB Atlas cluster, in either
+	// direction, with mongosync or mongomirror run by a Job. The changes keep being replicated until
+	// spec.migration.cutover is set, then the writes to the source are paused, the remaining changes
+	// applied and the connection string Secrets of the users flipped to the destination.
+	// +optional
+	Migration *Migration `json:"migration,omitempty"`
+
+	// Standby keeps the replica set restored from the backups, and the archived oplog, written to
+	// object storage by a MongoDB resource of another cluster, as a warm standby for disaster
+	// recovery. The restores stop once spec.standby.promote is set.
+	// +optional
+	Standby *Standby `json:"standby,omitempty"`
+
+	// RepairDrift makes the operator publish the automation config again when the running replica
+	// set has drifted from it, such as after a manual rs.reconfig() or createUser, so that the
+	// agents revert the changes made out-of-band. The drift is reported by the InSync condition
+	// whether it is repaired or not.
+	// +optional
+	RepairDrift bool `json:"repairDrift,omitempty"`
+
+	// ReplicationLagThreshold configures when the replication lag of a secondary degrades the
+	// resource. It defaults to a lag of 60 seconds sustained for 5 minutes.
+	// +optional
+	ReplicationLagThreshold *ReplicationLagThreshold `json:"replicationLagThreshold,omitempty"`
+
+	// Backup schedules backups of the replica set, taken from a secondary by a CronJob managed
+	// by the operator, or by the operator itself with the snapshot method. The CronJob is deleted
+	// when spec.backup is removed, the backups are kept.
+	// +optional
+	Backup *Backup `json:"backup,omitempty"`
+
+	// BackupHooks lets backup tools outside the operator, such as Velero or the snapshots of a
+	// storage array, lock the writes of a member while they back its volumes up, so that the
+	// backups are consistent.
+	// +optional
+	BackupHooks *BackupHooks `json:"backupHooks,omitempty"`
+
+	// VersionChangeHooks are containers run with a Job before and after a change of spec.version,
+	// e.g. to check the compatibility of the applications or to build indexes
+	// +optional
+	VersionChangeHooks *VersionChangeHooks `json:"versionChangeHooks,omitempty"`
+
+	// StatefulSetConfiguration overrides the StatefulSet of the members built by the operator, for
+	// the settings the resource doesn't have, such as the priority class or the sidecars of the Pods
+	// +optional
+	StatefulSetConfiguration *StatefulSetConfiguration `json:"statefulSet,omitempty"`
+}
+
+// VersionChangeHooks are run in the sequence of a change of spec.version, one after the other in
+// order. A hook only runs once the ones before it succeeded, and once for each version change.
+type VersionChangeHooks struct {
+	// Pre are run once the pre-flight checks passed and the backup of
+	// spec.backup.beforeVersionChange was taken, before any member is changed. A failed hook
+	// blocks the version change until the resource is changed.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Pre []VersionChangeHook `json:"pre,omitempty"`
+	// Post are run once all the members run the new version, before the version change is
+	// complete. A failed hook sets the resource to the Failed phase until it is changed.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Post []VersionChangeHook `json:"post,omitempty"`
+}
+
+// VersionChangeHook is a container run with a Job for a version change. It connects to the replica
+// set as the agent with the environment variables set by the operator, and succeeds if it exits
+// with 0.
+type VersionChangeHook struct {
+	// Name identifies the hook in status.versionChangeHooks and names its Job
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=32
+	Name string `json:"name"`
+	// Image is the image of the container, it defaults to the image of mongod of the version the
+	// replica set runs when the hook is run
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Command is the entrypoint of the container, it defaults to the one of the image
+	// +optional
+	Command []string `json:"command,omitempty"`
+	// Args are the arguments of the entrypoint
+	// +optional
+	Args []string `json:"args,omitempty"`
+	// Env are added to the environment variables set by the operator
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// ActiveDeadlineSeconds is how long the hook can run before it fails, it isn't limited by
+	// default
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// BackoffLimit is how many times the hook is retried before it fails, it defaults to 0 as
+	// the hooks may not be idempotent
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackoffLimit int32 `json:"backoffLimit,omitempty"`
+}
+
+// BackupHooks configures how the backup tools outside the operator lock the writes of the members
+type BackupHooks struct {
+	// Velero annotates the Pods of the members with Velero backup hooks, which lock the writes of
+	// the member with fsyncLock before Velero backs its volumes up, and unlock them after.
+	// Changing it restarts the members.
+	// +optional
+	Velero bool `json:"velero,omitempty"`
+	// FreezeTimeoutSeconds is how long the writes of a member locked with the
+	// mongodb.com/v1.backupFreeze annotation stay locked at most, the operator unlocks them once
+	// it has elapsed. Defaults to 300
+	// +optional
+	FreezeTimeoutSeconds int `json:"freezeTimeoutSeconds,omitempty"`
+}
+
+// StatefulSetConfiguration overrides the StatefulSet of the members
+type StatefulSetConfiguration struct {
+	// Spec is merged into the spec of the StatefulSet with a strategic merge patch, e.g. the
+	// containers of its Pod template are merged by name. The replicas, selector, serviceName and
+	// updateStrategy are managed by the operator and can't be overridden.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Spec runtime.RawExtension `json:"spec"`
+}
+
+// BackupMethod is the tool used to take the backups
+type BackupMethod string
+
+const (
+	// BackupMethodMongodump takes the backups with mongodump, as gzipped archives
+	BackupMethodMongodump BackupMethod = "mongodump"
+	// BackupMethodSnapshot takes the backups as CSI VolumeSnapshots of the volumes of a secondary,
+	// whose writes are locked with fsyncLock while the snapshots are cut
+	BackupMethodSnapshot BackupMethod = "snapshot"
+	// BackupMethodPBM takes the backups with Percona Backup for MongoDB, whose pbm-agent runs next to
+	// the mongod of every member
+	BackupMethodPBM BackupMethod = "pbm"
+)
+
+// Backup configures the scheduled backups of the replica set
+type Backup struct {
+	// Schedule is a cron expression with the five standard fields, evaluated in the time zone
+	// of the kube-controller-manager, usually UTC, e.g. "0 3 * * *" for every day at 3am
+	Schedule string `json:"schedule"`
+	// Method is the tool used to take the backups, mongodump, snapshot or pbm, it defaults to
+	// mongodump. The snapshot method requires a volumeSnapshot target, and the pbm method an s3 target.
+	// +kubebuilder:validation:Enum=mongodump;snapshot;pbm
+	// +optional
+	Method BackupMethod `json:"method,omitempty"`
+	// Target is where the backups are stored
+	Target BackupTarget `json:"target"`
+	// PBM configures Percona Backup for MongoDB with the pbm method
+	// +optional
+	PBM *BackupPBM `json:"pbm,omitempty"`
+	// Suspend stops the scheduling of new backups, without deleting the CronJob
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+	// Retention prunes the backups which aren't kept by any of its rules from the target. The
+	// backups are kept forever when it isn't set.
+	// +optional
+	Retention *BackupRetention `json:"retention,omitempty"`
+	// BeforeVersionChange takes a backup with the method and the target of spec.backup before a
+	// change of spec.version starts, the version change waits for it to succeed
+	// +optional
+	BeforeVersionChange bool `json:"beforeVersionChange,omitempty"`
+	// PointInTime archives the oplog continuously to the s3 target, so that a MongoDBRestore can
+	// replay it up to any time after a backup. It requires the mongodump method and an s3 target,
+	// or the pbm method, with which the oplog is archived by the pbm-agents.
+	// +optional
+	PointInTime *BackupPointInTime `json:"pointInTime,omitempty"`
+	// Encryption encrypts the archives and the archived oplog in the Pods taking them, before they
+	// are written to the target. It requires the mongodump method.
+	// +optional
+	Encryption *BackupEncryption `json:"encryption,omitempty"`
+	// Verification restores the most recent scheduled backup into an ephemeral standalone mongod on
+	// its own schedule, and checks it. It requires the mongodump method.
+	// +optional
+	Verification *BackupVerification `json:"verification,omitempty"`
+}
+
+// BackupPBM configures the backups taken by Percona Backup for MongoDB
+type BackupPBM struct {
+	// Type is the type of the backups, logical or physical, it defaults to logical. The physical
+	// backups copy the data files of a member, which requires Percona Server for MongoDB.
+	// +kubebuilder:validation:Enum=logical;physical
+	// +optional
+	Type string `json:"type,omitempty"`
+	// Image is the image of Percona Backup for MongoDB, running the pbm-agents and the pbm CLI.
+	// Defaults to percona/percona-backup-mongodb:2.3.1
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Resources are the compute resources of the pbm-agent containers
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// BackupVerification checks that the scheduled backups can be restored
+type BackupVerification struct {
+	// Schedule is a cron expression with the five standard fields, e.g. "0 6 * * 0" for every
+	// Sunday at 6am
+	Schedule string `json:"schedule"`
+	// Checks are evaluated against the restored backup after the collections were validated, the
+	// verification fails if any of them doesn't hold
+	// +optional
+	Checks []BackupVerificationCheck `json:"checks,omitempty"`
+}
+
+// BackupVerificationCheck is a mongo shell expression which must be true for the restored backup
+type BackupVerificationCheck struct {
+	// Name identifies the check in the result of the verification
+	Name string `json:"name"`
+	// Database is the database the expression is evaluated against, as db
+	Database string `json:"database"`
+	// Expression is a mongo shell expression, e.g. "db.orders.countDocuments({}) > 1000"
+	Expression string `json:"expression"`
+}
+
+// BackupEncryption encrypts the backups client-side with AES-256-GCM
+type BackupEncryption struct {
+	// KeySecretName is the name of a Secret in the namespace of the resource, whose "key" key is a
+	// key of 32 random bytes encoded in base64, e.g. generated with "openssl rand -base64 32". The
+	// backups can't be restored without it.
+	KeySecretName string `json:"keySecretName"`
+}
+
+// BackupPointInTime configures the archiving of the oplog
+type BackupPointInTime struct {
+	// IntervalSeconds is how often the new entries of the oplog are archived, it defaults to 60.
+	// The oplog can only be replayed up to the last archived entry.
+	// +kubebuilder:validation:Minimum=10
+	// +optional
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+}
+
+// BackupRetention defines which scheduled backups are kept, a backup is kept if any rule keeps it
+type BackupRetention struct {
+	// KeepLast keeps the given number of most recent backups
+	// +optional
+	KeepLast int `json:"keepLast,omitempty"`
+	// KeepDaily keeps the most recent backup of each of the given number of most recent days
+	// with backups
+	// +optional
+	KeepDaily int `json:"keepDaily,omitempty"`
+	// KeepWeekly keeps the most recent backup of each of the given number of most recent weeks
+	// with backups
+	// +optional
+	KeepWeekly int `json:"keepWeekly,omitempty"`
+}
+
+// BackupTarget is where the backups are stored, exactly one target must be set
+// +kubebuilder:validation:XValidation:rule="[has(self.persistentVolumeClaim), has(self.s3), has(self.volumeSnapshot)].filter(set, set).size() == 1",message="exactly one target must be set"
+type BackupTarget struct {
+	// PersistentVolumeClaim stores the backups in an existing PersistentVolumeClaim, which
+	// must be in the namespace of the resource
+	// +optional
+	PersistentVolumeClaim *BackupVolumeTarget `json:"persistentVolumeClaim,omitempty"`
+	// S3 streams the backups to a bucket of an S3 compatible object storage, such as Amazon S3,
+	// Google Cloud Storage or MinIO, without an intermediate volume
+	// +optional
+	S3 *BackupS3Target `json:"s3,omitempty"`
+	// VolumeSnapshot takes CSI VolumeSnapshots of the volumes of a secondary, in the namespace of
+	// the resource. It is only supported by the snapshot method of spec.backup.
+	// +optional
+	VolumeSnapshot *BackupVolumeSnapshotTarget `json:"volumeSnapshot,omitempty"`
+}
+
+// BackupVolumeSnapshotTarget stores the backups as CSI VolumeSnapshots
+type BackupVolumeSnapshotTarget struct {
+	// VolumeSnapshotClassName is the VolumeSnapshotClass of the snapshots, it defaults to the
+	// default VolumeSnapshotClass of the CSI driver of the volumes
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// BackupS3Target stores the backups in a bucket of an S3 compatible object storage
+type BackupS3Target struct {
+	// Bucket is the name of the bucket
+	Bucket string `json:"bucket"`
+	// Prefix is prepended to the keys of the backups, e.g. "my-replica-set/"
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// Endpoint is the URL of the object storage when it isn't Amazon S3, e.g.
+	// https://storage.googleapis.com for Google Cloud Storage or the URL of a MinIO service
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region is the region of the bucket
+	// +optional
+	Region string `json:"region,omitempty"`
+	// CredentialsSecretName is the name of a Secret with the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY keys. It can be omitted when the credentials are provided to the Pods
+	// otherwise, e.g. with IAM roles for service accounts.
+	// +optional
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+	// ServerSideEncryption encrypts the backups at rest with the object storage
+	// +optional
+	ServerSideEncryption *BackupServerSideEncryption `json:"serverSideEncryption,omitempty"`
+}
+
+// BackupServerSideEncryption configures the server-side encryption of the backups
+type BackupServerSideEncryption struct {
+	// Algorithm is the server-side encryption algorithm, AES256 or aws:kms
+	// +kubebuilder:validation:Enum=AES256;"aws:kms"
+	Algorithm string `json:"algorithm"`
+	// KMSKeyID is the ID of the KMS key used with the aws:kms algorithm, it defaults to the
+	// AWS managed key
+	// +optional
+	KMSKeyID string `json:"kmsKeyId,omitempty"`
+}
+
+// BackupVolumeTarget stores the backups in a PersistentVolumeClaim
+type BackupVolumeTarget struct {
+	// ClaimName is the name of the PersistentVolumeClaim
+	ClaimName string `json:"claimName"`
+	// Path is the directory of the volume the backups are written to, it defaults to the root
+	// of the volume
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// ReplicationLagThreshold is the replication lag above which a secondary is considered lagging
+type ReplicationLagThreshold struct {
+	// Lag is how far a secondary can be behind the primary, it defaults to 60 seconds
+	// +optional
+	Lag *metav1.Duration `json:"lag,omitempty"`
+	// For is how long a secondary has to be lagging before the ReplicationLagBelowThreshold condition
+	// is false, so that a short spike of the lag is ignored. It defaults to 5 minutes.
+	// +optional
+	For *metav1.Duration `json:"for,omitempty"`
+}
+
+// ExternalDNSSource is how external-dns is configured to publish the external hostnames of the members
+type ExternalDNSSource string
+
+const (
+	// ExternalDNSService annotates the Services of the members with their hostname
+	ExternalDNSService ExternalDNSSource = "Service"
+	// ExternalDNSEndpoint creates a DNSEndpoint with the addresses of the Services of the members
+	ExternalDNSEndpoint ExternalDNSSource = "DNSEndpoint"
+	// ExternalDNSNone leaves the publication of the hostnames to the user
+	ExternalDNSNone ExternalDNSSource = "None"
+)
+
+// ExternalAccess configures the Services exposing the members outside of the cluster, and the
+// publication of their hostnames
+// +kubebuilder:validation:XValidation:rule="self.domain.size() > 0",message="domain must be set"
+type ExternalAccess struct {
+	// Domain is the DNS zone the hostnames of the members are published in, the hostname of a
+	// member is <metadata.name>-<index>.<domain>
+	Domain string `json:"domain"`
+	// HorizonName is the name of the replica set horizon of the external hostnames. Defaults to
+	// "external"
+	// +optional
+	HorizonName string `json:"horizonName,omitempty"`
+	// ServiceType is the type of the Services of the members. Defaults to LoadBalancer
+	// +kubebuilder:validation:Enum=LoadBalancer;NodePort
+	// +optional
+	ServiceType corev1.ServiceType `json:"serviceType,omitempty"`
+	// ExternalDNS is how external-dns publishes the hostnames: from the annotations of the
+	// Services, from a DNSEndpoint holding the addresses of the Services, which requires the
+	// crd source of external-dns, or not at all. Defaults to Service
+	// +kubebuilder:validation:Enum=Service;DNSEndpoint;None
+	// +optional
+	ExternalDNS ExternalDNSSource `json:"externalDNS,omitempty"`
+	// Annotations are added to the Services of the members, for example to configure their
+	// load balancers
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// MigrationDirection is the direction of a migration between the replica set and Atlas
+type MigrationDirection string
+
+const (
+	// MigrationToAtlas migrates the data of the replica set to the Atlas cluster
+	MigrationToAtlas MigrationDirection = "ToAtlas"
+	// MigrationFromAtlas migrates the data of the Atlas cluster to the replica set
+	MigrationFromAtlas MigrationDirection = "FromAtlas"
+)
+
+// MigrationTool is the tool migrating the data
+type MigrationTool string
+
+const (
+	MigrationToolMongosync   MigrationTool = "mongosync"
+	MigrationToolMongomirror MigrationTool = "mongomirror"
+)
+
+// Migration configures a live migration between the replica set and a MongoDB Atlas cluster
+type Migration struct {
+	// Direction is whether the data is migrated to or from the Atlas cluster
+	// +kubebuilder:validation:Enum=ToAtlas;FromAtlas
+	Direction MigrationDirection `json:"direction"`
+	// Tool is the tool migrating the data, mongomirror only migrates to Atlas. Defaults to mongosync
+	// +kubebuilder:validation:Enum=mongosync;mongomirror
+	// +optional
+	Tool MigrationTool `json:"tool,omitempty"`
+	// Image is the image of the Job running the tool, which must also provide sh and curl
+	// +kubebuilder:validation:MinLength=1
+	Image string `json:"image"`
+	// AtlasSecretRef references the Secret of the Atlas cluster. Its connectionString key holds the
+	// connection string of the cluster, with the credentials of a user allowed to migrate the data.
+	// mongomirror reads the <replicaSet>/<hosts> seed list of the cluster from its host key and the
+	// credentials from its username and password keys instead.
+	AtlasSecretRef LocalObjectReference `json:"atlasSecretRef"`
+	// Cutover completes the migration: the writes to the source are paused, the remaining changes
+	// are applied to the destination, and the connection string Secrets of the users are flipped to
+	// the destination
+	// +optional
+	Cutover bool `json:"cutover,omitempty"`
+}
+
+// Standby configures the replica set as the warm standby of a MongoDB resource of another cluster
+type Standby struct {
+	// Source is the s3 target of spec.backup of the source resource, with the same bucket and prefix
+	Source BackupS3Target `json:"source"`
+	// SourceName is the name of the source resource, after which its scheduled backups are named
+	// <sourceName>-<time>.archive.gz
+	// +kubebuilder:validation:MinLength=1
+	SourceName string `json:"sourceName"`
+	// IntervalSeconds is how often the target is checked for a newer backup and newly archived oplog,
+	// it defaults to 300
+	// +kubebuilder:validation:Minimum=30
+	// +optional
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	// PointInTime replays the oplog archived by spec.backup.pointInTime of the source after each
+	// backup is restored, and the newly archived entries at every interval
+	// +optional
+	PointInTime bool `json:"pointInTime,omitempty"`
+	// Promote stops the restores, so that the replica set takes over from the source. A promoted
+	// standby isn't restored again until spec.standby is removed.
+	// +optional
+	Promote bool `json:"promote,omitempty"`
+}
+
+// Prometheus configures the mongodb_exporter sidecar of the members
+type Prometheus struct {
+	// Image is the image of mongodb_exporter. Defaults to "percona/mongodb_exporter:0.40.0"
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Port is the port of the Pods the metrics are exposed on. Defaults to 9216
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int `json:"port,omitempty"`
+	// Resources are the compute resources of the exporter container
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// PodMonitor generates a PodMonitor scraping the exporter and the agent of the members, if
+	// the Prometheus Operator is installed
+	// +optional
+	PodMonitor *PodMonitor `json:"podMonitor,omitempty"`
+	// PrometheusRule generates a PrometheusRule alerting on the metrics of the operator and of the
+	// exporter, if the Prometheus Operator is installed
+	// +optional
+	PrometheusRule *PrometheusRule `json:"prometheusRule,omitempty"`
+}
+
+// OpsManagerMonitoring configures the registration of the members with the monitoring of Cloud
+// Manager or Ops Manager
+// +kubebuilder:validation:XValidation:rule="(has(self.projectId) && self.projectId.size() > 0) != (has(self.projectName) && self.projectName.size() > 0)",message="exactly one of projectId and projectName must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.projectName) || (has(self.orgId) && self.orgId.size() > 0)",message="orgId is required with projectName"
+type OpsManagerMonitoring struct {
+	// BaseURL is the URL of Ops Manager. Defaults to "https://cloud.mongodb.com", Cloud Manager
+	// +optional
+	BaseURL string `json:"baseUrl,omitempty"`
+	// ProjectID is the ID of the project the members are registered in
+	// +optional
+	ProjectID string `json:"projectId,omitempty"`
+	// ProjectName is the name of the project the members are registered in, which is created in
+	// the organization OrgID if it doesn't exist
+	// +optional
+	ProjectName string `json:"projectName,omitempty"`
+	// OrgID is the ID of the organization the project of ProjectName is created in
+	// +optional
+	OrgID string `json:"orgId,omitempty"`
+	// APIKeySecretRef is the Secret holding the programmatic API key the operator registers the
+	// members with, in its publicKey and privateKey fields. The key needs the Project Owner role,
+	// and the Organization Project Creator role to create the project of ProjectName.
+	APIKeySecretRef LocalObjectReference `json:"apiKeySecretRef"`
+	// Resources are the compute resources of the monitoring agent
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// PodMonitor configures the PodMonitor of the members for the Prometheus Operator
+type PodMonitor struct {
+	// Interval is the interval at which the members are scraped. Defaults to the interval of Prometheus
+	// +optional
+	Interval string `json:"interval,omitempty"`
+	// Labels are added to the PodMonitor, so that it is selected by the podMonitorSelector of Prometheus
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// PrometheusRule configures the alerts of the PrometheusRule of the resource for the Prometheus Operator
+type PrometheusRule struct {
+	// Labels are added to the PrometheusRule, so that it is selected by the ruleSelector of Prometheus
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// CertificateExpiryThreshold is how long before the TLS certificate of the members expires the
+	// alert fires. Defaults to 336h, 14 days
+	// +optional
+	CertificateExpiryThreshold *metav1.Duration `json:"certificateExpiryThreshold,omitempty"`
+}
+
+// Resources are the compute resources of the containers of a member. Each container defaults to
+// limits of 1 CPU and 500M of memory, and requests of 0.5 CPU and 400M of memory.
+type Resources struct {
+	// MongoD are the resources of the mongod container
+	// +optional
+	MongoD *corev1.ResourceRequirements `json:"mongod,omitempty"`
+	// Agent are the resources of the agent container
+	// +optional
+	Agent *corev1.ResourceRequirements `json:"agent,omitempty"`
+}
+
+// InitScript references the scripts of a ConfigMap
+type InitScript struct {
+	// ConfigMapName is the name of a ConfigMap whose keys are JavaScript files, which are run with
+	// the mongo shell in the order of their keys
+	ConfigMapName string `json:"configMapName"`
+}
+
+// Bootstrap describes the dataset loaded into a new replica set
+type Bootstrap struct {
+	// ArchiveURL is the s3://, http:// or https:// URL of a gzipped archive created with
+	// "mongodump --archive --gzip", which is restored with mongorestore
+	ArchiveURL string `json:"archiveURL"`
+	// CredentialsSecretName is the name of a Secret whose keys are exposed as environment variables
+	// to download the archive: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_DEFAULT_REGION for
+	// an s3:// URL, or username and password for basic authentication to an http(s):// URL
+	// +optional
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+}
+
+// InitFrom is the source of the data of a new deployment. Exactly one of its fields must be set.
+// The data volume of the first member is provisioned from the source, and the other members
+// perform an initial sync from it.
+// +kubebuilder:validation:XValidation:rule="(has(self.mongodb) && self.mongodb.size() > 0) != (has(self.volumeSnapshot) && self.volumeSnapshot.size() > 0)",message="exactly one of spec.initFrom.mongodb and spec.initFrom.volumeSnapshot must be set"
+type InitFrom struct {
+	// MongoDB is the name of a MongoDB resource in the same namespace whose first member's data
+	// volume is cloned. The storage class of the data volume must support volume cloning
+	// +optional
+	MongoDB string `json:"mongodb,omitempty"`
+	// VolumeSnapshot is the name of a VolumeSnapshot, in the same namespace, of the data volume
+	// of a member of a replica set
+	// +optional
+	VolumeSnapshot string `json:"volumeSnapshot,omitempty"`
+}
+
+// Adoption configures how an existing replica set is taken over. The StatefulSet of the
+// replica set must be named after the resource, use the "<name>-svc" Service, and have a
+// "data-volume" volume claim template, so that the members keep their data.
+type Adoption struct {
+	// CredentialsSecretName is the name of a Secret with the "username" and "password" of a user
+	// of the existing replica set allowed to read its configuration and users
+	CredentialsSecretName string `json:"credentialsSecretName"`
+	// KeyFileSecretName is the name of a Secret with the "keyfile" the existing members use to
+	// authenticate to each other. It is required if authentication is enabled
+	// +optional
+	KeyFileSecretName string `json:"keyFileSecretName,omitempty"`
+}
+
+// MaintenanceWindow is a recurring window during which disruptive changes can be applied
+type MaintenanceWindow struct {
+	// Schedule is a cron expression, in UTC, of the start of the windows,
+	// e.g. "0 2 * * 6" for every Saturday at 2am
+	Schedule string `json:"schedule"`
+	// Duration is the length of every window, e.g. "4h"
+	Duration metav1.Duration `json:"duration"`
+}
+
+// Storage configures the persistent volumes of the members
+type Storage struct {
+	// Data configures the volume storing the MongoDB data files
+	// +optional
+	Data VolumeClaim `json:"data,omitempty"`
+
+	// Journal configures a dedicated volume for the journal of the members, which allows
+	// it to be placed on a different storage tier than the data files. The journal is
+	// stored on the data volume if not set
+	// +optional
+	Journal *VolumeClaim `json:"journal,omitempty"`
+
+	// Logs configures a dedicated volume for the logs of mongod and the agent, so that
+	// they can't fill up the data volume. The logs are stored in the containers if not set
+	// +optional
+	Logs *VolumeClaim `json:"logs,omitempty"`
+
+	// ReclaimPolicy defines what happens to the volumes of the members removed when the
+	// replica set is scaled down. Defaults to Retain
+	// +kubebuilder:validation:Enum=Retain;Delete;Label
+	// +optional
+	ReclaimPolicy VolumeReclaimPolicy `json:"reclaimPolicy,omitempty"`
+
+	// Ephemeral stores the data of the members in emptyDir volumes instead of persistent
+	// volumes. The data is lost whenever a Pod is deleted, so it must only be used for
+	// throwaway deployments, e.g. for testing. It can't be changed once the resource has
+	// been created
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec.storage.ephemeral can't be changed"
+	// +optional
+	Ephemeral bool `json:"ephemeral,omitempty"`
+
+	// DataPath is the directory the data volume is mounted at and mongod stores its data
+	// files in. It can't be changed once the resource has been created. Defaults to "/data"
+	// +optional
+	DataPath string `json:"dataPath,omitempty"`
+
+	// LogsPath is the directory mongod and the agent write their logs to, where the logs
+	// volume is mounted. Defaults to "/var/log/mongodb" if the logs volume is configured,
+	// the logs are written to the default locations otherwise
+	// +optional
+	LogsPath string `json:"logsPath,omitempty"`
+
+	// UsageWarningThreshold is the percentage of the capacity of the data volume above which
+	// a warning is reported for a member. Defaults to 80
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	UsageWarningThreshold int `json:"usageWarningThreshold,omitempty"`
+
+	// UnschedulableVolumeTimeout is how long the Pod of a member can't be scheduled because of
+	// the node affinity of its volumes, with none of the nodes they can be attached to existing and
+	// ready, before the volumes are recreated and the member resyncs its data, e.g. when the zone of
+	// a zonal disk has no node left. The cordoned nodes are still considered available. The
+	// volumes are never recreated if it isn't set or is 0, which is the default
+	// +optional
+	UnschedulableVolumeTimeout *metav1.Duration `json:"unschedulableVolumeTimeout,omitempty"`
+}
+
+// VolumeClaim configures the PersistentVolumeClaim template of a volume. The settings
+// can't be changed once the StatefulSet has been created, except for increasing the size
+// and the labels and annotations.
+type VolumeClaim struct {
+	// StorageClassName is the name of the StorageClass of the volume. The default
+	// StorageClass of the cluster is used if not set
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// Size is the requested size of the volume, e.g. "20Gi". Defaults to "10G"
+	// +optional
+	Size string `json:"size,omitempty"`
+
+	// AccessModes of the volume. Defaults to ["ReadWriteOnce"]
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+
+	// Selector is a label query over the PersistentVolumes to bind to
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Labels are added to the PersistentVolumeClaims of the volume, e.g. to be selected
+	// by backup tools. Changes are applied to the existing PersistentVolumeClaims
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the PersistentVolumeClaims of the volume. Changes are
+	// applied to the existing PersistentVolumeClaims
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type MongoDBUser struct {
@@ -55,8 +885,14 @@ type MongoDBUser struct {
 	DB string `json:"db"`
 
 	// PasswordSecretRef is a reference to the secret containing this user's password
+	// +optional
 	PasswordSecretRef SecretKeyReference `json:"passwordSecretRef"`
 
+	// PasswordVaultRef is a reference to the Vault secret containing this user's password, used
+	// instead of PasswordSecretRef. It requires spec.security.vault.
+	// +optional
+	PasswordVaultRef *VaultSecretKeyReference `json:"passwordVaultRef,omitempty"`
+
 	// Roles is an array of roles assigned to this user
 	Roles []Role `json:"roles"`
 }
@@ -71,6 +907,18 @@ type SecretKeyReference struct {
 	Key string `json:"key"`
 }
 
+// VaultSecretKeyReference is a reference to a key of a secret of the KV version 2 secrets engine of Vault
+type VaultSecretKeyReference struct {
+	// Path is the path of the secret, such as secret/mongodb/my-rs/app-user, where secret is the
+	// mount path of the engine
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+
+	// Key is the key in the secret storing this password. Defaults to "password"
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
 // Role is the database role this user should have
 type Role struct {
 	// DB is the database the role can act on
@@ -85,9 +933,31 @@ type Security struct {
 	// TLS configuration for both client-server and server-server communication
 	// +optional
 	TLS TLS `json:"tls"`
+	// Vault configures how the secrets stored in HashiCorp Vault are read, by the operator and by the
+	// members, instead of Kubernetes Secrets and ConfigMaps
+	// +optional
+	Vault *Vault `json:"vault,omitempty"`
+	// RoleRefs are the ClusterMongoDBRoles created as custom roles in the admin database, which can
+	// be granted to the users
+	// +optional
+	RoleRefs []LocalObjectReference `json:"roleRefs,omitempty"`
+}
+
+// Vault is the configuration of the secrets read from HashiCorp Vault. The operator reads them with
+// the Kubernetes auth method, the members and the Jobs have them written in their containers by the
+// Vault Agent injector.
+type Vault struct {
+	// Role is the role of the Kubernetes auth method the operator, the members and the Jobs log in
+	// with. It must be bound to their service accounts in the namespace of the resource, the operator
+	// logging in with a token of the mongodb-kubernetes-operator service account of the members, and
+	// its policies must allow reading the secrets of the resource.
+	// +kubebuilder:validation:MinLength=1
+	Role string `json:"role"`
 }
 
 // TLS is the configuration used to set up TLS encryption
+// +kubebuilder:validation:XValidation:rule="!has(self.enabled) || !self.enabled || has(self.vaultSecretPath) || (has(self.certificateKeySecretRef) && self.certificateKeySecretRef.name.size() > 0)",message="spec.security.tls.certificateKeySecretRef.name is required when TLS is enabled without spec.security.tls.vaultSecretPath"
+// +kubebuilder:validation:XValidation:rule="!has(self.enabled) || !self.enabled || has(self.vaultSecretPath) || (has(self.caConfigMapRef) && self.caConfigMapRef.name.size() > 0)",message="spec.security.tls.caConfigMapRef.name is required when TLS is enabled without spec.security.tls.vaultSecretPath"
 type TLS struct {
 	Enabled bool `json:"enabled"`
 
@@ -105,6 +975,22 @@ type TLS struct {
 	// The certificate is expected to be available under the key "ca.crt"
 	// +optional
 	CaConfigMap LocalObjectReference `json:"caConfigMapRef"`
+
+	// VaultSecretPath is the path of the Vault secret containing the certificate, the key and the
+	// certificate of the CA in "tls.crt", "tls.key" and "ca.crt", such as secret/mongodb/my-rs/tls,
+	// where secret is the mount path of the KV version 2 secrets engine. It is used instead of
+	// CertificateKeySecret and CaConfigMap, and requires spec.security.vault.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	VaultSecretPath string `json:"vaultSecretPath,omitempty"`
+}
+
+// DependentResource is a Secret or a ConfigMap in the namespace of the resource
+type DependentResource struct {
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	Kind DependentResourceKind `json:"kind"`
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
 }
 
 // LocalObjectReference is a reference to another Kubernetes object by name.
@@ -119,7 +1005,9 @@ type Authentication struct {
 	// Enabled specifies if authentication should be enabled
 	Enabled bool `json:"enabled"`
 
-	// Modes is an array specifying which authentication methods should be enabled
+	// Modes is an array specifying which authentication methods should be enabled, each at
+	// most once. Defaults to SCRAM
+	// +listType=set
 	Modes []AuthMode `json:"modes"`
 }
 
@@ -130,15 +1018,559 @@ type AuthMode string
 type MongoDBStatus struct {
 	MongoURI string `json:"mongoUri"`
 	Phase    Phase  `json:"phase"`
+
+	// ObservedGeneration is the generation of the resource last reconciled
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Message describes the change in progress, or why the resource can't be reconciled
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Version is the MongoDB version run by all the members
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Replicas is the number of members the replica set is currently scaled to
+	Replicas int `json:"replicas,omitempty"`
+	// ReadyMembers is the number of members which are ready
+	ReadyMembers int `json:"readyMembers,omitempty"`
+	// DesiredMembers is the number of members of the resource
+	DesiredMembers int `json:"desiredMembers,omitempty"`
+	// MembersReady is the number of members which are ready out of the members of the resource,
+	// e.g. "2/3", shown by kubectl get
+	MembersReady string `json:"membersReady,omitempty"`
+	// LabelSelector selects the Pods of the members, for the scale subresource
+	LabelSelector string `json:"labelSelector,omitempty"`
+
+	// Members describes the progress of the agent of every member
+	// towards the latest automation config
+	Members []MemberStatus `json:"members,omitempty"`
+
+	// VolumeExpansions lists the volumes of the members which are being expanded
+	VolumeExpansions []VolumeExpansionStatus `json:"volumeExpansions,omitempty"`
+
+	// PendingVolumes lists the volumes of the members which are not bound yet, or which
+	// prevent the Pod of their member from being scheduled, with the reason
+	PendingVolumes []PendingVolumeStatus `json:"pendingVolumes,omitempty"`
+
+	// Conditions describe the state of the aspects of the deployment which can prevent it
+	// from becoming ready
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// PendingMaintenance describes the disruptive changes waiting for the next maintenance window
+	PendingMaintenance *PendingMaintenanceStatus `json:"pendingMaintenance,omitempty"`
+
+	// Bootstrap describes the progress of the restore of spec.bootstrap
+	Bootstrap *BootstrapStatus `json:"bootstrap,omitempty"`
+	// Backup describes the last scheduled backup, it is only set when spec.backup is set
+	// +optional
+	Backup *BackupStatus `json:"backup,omitempty"`
+	// VersionChangeBackup describes the backup taken before the last change of spec.version, when
+	// spec.backup.beforeVersionChange is set
+	// +optional
+	VersionChangeBackup *VersionChangeBackupStatus `json:"versionChangeBackup,omitempty"`
+	// VersionChangeHooks describes the progress of the hooks of spec.versionChangeHooks run for the
+	// last change of spec.version
+	// +optional
+	VersionChangeHooks []VersionChangeHookStatus `json:"versionChangeHooks,omitempty"`
+
+	// InitScripts describes the progress of spec.initScripts
+	InitScripts []InitScriptStatus `json:"initScripts,omitempty"`
+
+	// Rollout describes the progress of a rollout with spec.gatedRollout
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// BackupFreeze describes the member whose writes are locked for the mongodb.com/v1.backupFreeze
+	// annotation
+	// +optional
+	BackupFreeze *BackupFreezeStatus `json:"backupFreeze,omitempty"`
+
+	// OpsManager describes the registration of the members with the monitoring of Ops Manager, it is
+	// only set when spec.opsManager is set
+	// +optional
+	OpsManager *OpsManagerStatus `json:"opsManager,omitempty"`
+
+	// Migration describes the progress of the migration of spec.migration
+	// +optional
+	Migration *MigrationStatus `json:"migration,omitempty"`
+
+	// Standby describes the restores of spec.standby
+	// +optional
+	Standby *StandbyStatus `json:"standby,omitempty"`
+}
+
+// MigrationPhase is the progress of a migration
+type MigrationPhase string
+
+const (
+	// MigrationRunning means the data is copied and the changes replicated to the destination
+	MigrationRunning MigrationPhase = "Running"
+	// MigrationCuttingOver means the writes to the source are paused and the remaining changes
+	// applied to the destination
+	MigrationCuttingOver MigrationPhase = "CuttingOver"
+	// MigrationCompleted means the destination holds the data, the connection string Secrets of the
+	// users are flipped to it
+	MigrationCompleted MigrationPhase = "Completed"
+	// MigrationFailed means the Job of the migration failed, it isn't retried
+	MigrationFailed MigrationPhase = "Failed"
+)
+
+// MigrationStatus describes the progress of a migration between the replica set and Atlas
+type MigrationStatus struct {
+	Phase MigrationPhase `json:"phase"`
+	// Job is the Job running the tool
+	Job string `json:"job"`
+	// WritesPausedOn is the primary whose writes were locked with fsyncLock for the cutover of a
+	// migration with mongomirror
+	// +optional
+	WritesPausedOn string `json:"writesPausedOn,omitempty"`
+	// CompletedAt is when the migration completed
+	// +optional
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+	// Message describes why the migration failed
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// StandbyPhase is the progress of a standby
+type StandbyPhase string
+
+const (
+	// StandbyRestoring means the Job restoring the latest backup or oplog of the source is running
+	StandbyRestoring StandbyPhase = "Restoring"
+	// StandbySynced means the latest backup and oplog of the source were restored, the target is
+	// checked again after the interval
+	StandbySynced StandbyPhase = "Synced"
+	// StandbyFailed means the last restore failed, it is retried after the interval
+	StandbyFailed StandbyPhase = "Failed"
+	// StandbyPromoted means the restores stopped once spec.standby.promote was set
+	StandbyPromoted StandbyPhase = "Promoted"
+)
+
+// StandbyStatus describes the data of the source restored into a standby
+type StandbyStatus struct {
+	Phase StandbyPhase `json:"phase"`
+	// Job is the Job restoring the latest backup or oplog of the source
+	// +optional
+	Job string `json:"job,omitempty"`
+	// Archive is the backup of the source last restored
+	// +optional
+	Archive string `json:"archive,omitempty"`
+	// OplogEntry is the last entry of the archived oplog of the source replayed, as <t>.<i>
+	// +optional
+	OplogEntry string `json:"oplogEntry,omitempty"`
+	// RestoredTo is the time the data of the source is restored at: the time of the last entry
+	// replayed, or of the backup if no entry was replayed since it was restored
+	// +optional
+	RestoredTo *metav1.Time `json:"restoredTo,omitempty"`
+	// LastCheckTime is when the last restore completed or failed
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+	// PromotedAt is when the standby was promoted
+	// +optional
+	PromotedAt *metav1.Time `json:"promotedAt,omitempty"`
+	// Message describes why the last restore failed
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// OpsManagerStatus describes the members registered with the monitoring of Ops Manager
+type OpsManagerStatus struct {
+	// ProjectID is the ID of the project the members are registered in
+	ProjectID string `json:"projectId"`
+	// Hosts are the hostnames of the members registered in the project
+	// +optional
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// BackupFreezeStatus describes the member whose writes are locked for a backup taken outside the
+// operator
+type BackupFreezeStatus struct {
+	// Member is the member whose writes are locked
+	Member string `json:"member"`
+	// LockedAt is when the writes were locked
+	LockedAt metav1.Time `json:"lockedAt"`
+	// Expired is true once the writes were unlocked because spec.backupHooks.freezeTimeoutSeconds
+	// elapsed before the annotation was removed
+	// +optional
+	Expired bool `json:"expired,omitempty"`
+}
+
+// RolloutStatus describes the progress of a rollout with spec.gatedRollout
+type RolloutStatus struct {
+	// UpdatedMember is the member last updated
+	UpdatedMember string `json:"updatedMember"`
+	// AwaitingApproval is true while the update of the next member waits for an approval
+	// +optional
+	AwaitingApproval bool `json:"awaitingApproval,omitempty"`
+}
+
+// InitScriptPhase is the progress of the scripts of a ConfigMap of spec.initScripts
+type InitScriptPhase string
+
+const (
+	// InitScriptRunning means the Job running the scripts is running
+	InitScriptRunning InitScriptPhase = "Running"
+	// InitScriptCompleted means the scripts have been run, they aren't run again
+	InitScriptCompleted InitScriptPhase = "Completed"
+	// InitScriptFailed means the Job running the scripts failed, the scripts and the
+	// next ones aren't run
+	InitScriptFailed InitScriptPhase = "Failed"
+)
+
+// InitScriptStatus describes the progress of the scripts of a ConfigMap of spec.initScripts
+type InitScriptStatus struct {
+	ConfigMapName string          `json:"configMapName"`
+	Phase         InitScriptPhase `json:"phase"`
+	// Message describes why the scripts failed
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// BootstrapPhase is the progress of the restore of spec.bootstrap
+type BootstrapPhase string
+
+const (
+	// BootstrapPending means the archive will be restored once the replica set is ready
+	BootstrapPending BootstrapPhase = "Pending"
+	// BootstrapRunning means the restore Job is running
+	BootstrapRunning BootstrapPhase = "Running"
+	// BootstrapCompleted means the archive has been restored
+	BootstrapCompleted BootstrapPhase = "Completed"
+	// BootstrapFailed means the restore Job failed, it isn't retried
+	BootstrapFailed BootstrapPhase = "Failed"
+)
+
+// BackupPhase is the outcome of the last backup
+type BackupPhase string
+
+const (
+	// BackupPending means the backup will be taken once the replica set is running, only used by
+	// MongoDBBackup
+	BackupPending BackupPhase = "Pending"
+	// BackupRunning means the last backup is being taken
+	BackupRunning BackupPhase = "Running"
+	// BackupSucceeded means the last backup was taken
+	BackupSucceeded BackupPhase = "Succeeded"
+	// BackupFailed means the last backup failed
+	BackupFailed BackupPhase = "Failed"
+)
+
+// BackupStatus describes the scheduled backups of spec.backup
+type BackupStatus struct {
+	// LastScheduleTime is when the last backup was scheduled
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastSuccessfulTime is when the last successful backup completed
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// LastJob is the name of the Job which took the last backup, it isn't set with the snapshot
+	// method
+	// +optional
+	LastJob string `json:"lastJob,omitempty"`
+	// LastPhase is the outcome of the last backup
+	// +optional
+	LastPhase BackupPhase `json:"lastPhase,omitempty"`
+	// Message describes why the last backup failed
+	// +optional
+	Message string `json:"message,omitempty"`
+	// LastSize is the size in bytes of the last successful backup: the size of its archive, or the
+	// sum of the restore sizes of its VolumeSnapshots. It isn't set when the size isn't reported.
+	// +optional
+	LastSize int64 `json:"lastSize,omitempty"`
+	// ConsecutiveFailures is the number of backups which failed since the last successful one
+	// +optional
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+	// Archives are the successful backups stored in the target which are subject to
+	// spec.backup.retention, most recent first. It is only set when a retention is set.
+	// +optional
+	Archives []BackupArchive `json:"archives,omitempty"`
+	// LastPruneTime is when expired backups were last deleted
+	// +optional
+	LastPruneTime *metav1.Time `json:"lastPruneTime,omitempty"`
+	// LastPruned are the locations of the backups deleted by the last prune
+	// +optional
+	LastPruned []string `json:"lastPruned,omitempty"`
+	// NextScheduleTime is when the next backup is scheduled, it is only set with the snapshot
+	// method
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+	// LastSnapshots are the names of the VolumeSnapshots of the last backup, it is only set with
+	// the snapshot method
+	// +optional
+	LastSnapshots []string `json:"lastSnapshots,omitempty"`
+	// LastVerification is the outcome of the last verification of spec.backup.verification
+	// +optional
+	LastVerification *BackupVerificationStatus `json:"lastVerification,omitempty"`
+}
+
+// BackupVerificationStatus describes the last verification of the scheduled backups
+type BackupVerificationStatus struct {
+	// Job is the name of the Job which verified the backup
+	Job string `json:"job"`
+	// Phase is the outcome of the verification
+	Phase BackupPhase `json:"phase"`
+	// Archive is the name of the archive verified
+	// +optional
+	Archive string `json:"archive,omitempty"`
+	// Collections is the number of collections restored
+	// +optional
+	Collections int `json:"collections,omitempty"`
+	// Documents is the number of documents restored
+	// +optional
+	Documents int64 `json:"documents,omitempty"`
+	// Message describes why the verification failed
+	// +optional
+	Message string `json:"message,omitempty"`
+	// CompletionTime is when the verification succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// LastSuccessfulTime is when the last successful verification completed
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+}
+
+// VersionChangeBackupStatus describes the backup taken before a change of spec.version, which is a
+// restore point if the version change fails
+type VersionChangeBackupStatus struct {
+	// FromVersion is the version the replica set was running when the backup was taken
+	FromVersion string `json:"fromVersion"`
+	// ToVersion is the version spec.version was changed to
+	ToVersion string `json:"toVersion"`
+	// Phase is Running until the backup succeeds or fails, the version change only starts once it
+	// succeeded
+	Phase BackupPhase `json:"phase"`
+	// Job is the name of the Job taking the backup, it isn't set with the snapshot method
+	// +optional
+	Job string `json:"job,omitempty"`
+	// Location is where the archive is stored, it isn't set with the snapshot method
+	// +optional
+	Location string `json:"location,omitempty"`
+	// Snapshots are the names of the VolumeSnapshots of the backup, it is only set with the
+	// snapshot method
+	// +optional
+	Snapshots []string `json:"snapshots,omitempty"`
+	// StartTime is when the backup started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the backup succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message describes why the backup failed
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Generation is the generation of the resource the backup was taken for, a failed backup is
+	// retried once the resource is changed
+	Generation int64 `json:"generation"`
+}
+
+// VersionChangeHookStage is when a hook of spec.versionChangeHooks is run in the sequence of a
+// version change
+type VersionChangeHookStage string
+
+const (
+	// VersionChangeHookPre is run before any member is changed
+	VersionChangeHookPre VersionChangeHookStage = "Pre"
+	// VersionChangeHookPost is run once all the members run the new version
+	VersionChangeHookPost VersionChangeHookStage = "Post"
+)
+
+// VersionChangeHookPhase is the progress of a hook of spec.versionChangeHooks
+type VersionChangeHookPhase string
+
+const (
+	// VersionChangeHookRunning means the Job running the hook is running
+	VersionChangeHookRunning VersionChangeHookPhase = "Running"
+	// VersionChangeHookSucceeded means the hook succeeded, it isn't run again for the version change
+	VersionChangeHookSucceeded VersionChangeHookPhase = "Succeeded"
+	// VersionChangeHookFailed means the Job running the hook failed, it is run again once the
+	// resource is changed
+	VersionChangeHookFailed VersionChangeHookPhase = "Failed"
+)
+
+// VersionChangeHookStatus describes the progress of a hook of spec.versionChangeHooks for a change of
+// spec.version
+type VersionChangeHookStatus struct {
+	// Name is the name of the hook
+	Name string `json:"name"`
+	// Stage is Pre or Post
+	Stage VersionChangeHookStage `json:"stage"`
+	// FromVersion is the version the replica set was running before the version change
+	FromVersion string `json:"fromVersion"`
+	// ToVersion is the version spec.version was changed to
+	ToVersion string `json:"toVersion"`
+	// Phase is Running until the hook succeeds or fails
+	Phase VersionChangeHookPhase `json:"phase"`
+	// Job is the name of the Job running the hook
+	Job string `json:"job"`
+	// Message describes why the hook failed
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Generation is the generation of the resource the hook was run for, a failed hook is run
+	// again once the resource is changed
+	Generation int64 `json:"generation"`
+}
+
+// BackupArchive is a backup stored in the target
+type BackupArchive struct {
+	// Location is s3://<bucket>/<key> for an s3 target, or <claim name>:<path> for a
+	// persistentVolumeClaim target
+	Location string `json:"location"`
+	// Time is when the backup was scheduled
+	Time metav1.Time `json:"time"`
+}
+
+// BootstrapStatus describes the progress of the restore of spec.bootstrap
+type BootstrapStatus struct {
+	Phase BootstrapPhase `json:"phase"`
+	// Message describes why the restore failed
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PendingMaintenanceStatus describes the disruptive changes waiting for the next maintenance window
+type PendingMaintenanceStatus struct {
+	// Changes lists the disruptive changes which haven't been applied yet
+	Changes []string `json:"changes"`
+	// NextWindow is the start of the next maintenance window, if any
+	// +optional
+	NextWindow *metav1.Time `json:"nextWindow,omitempty"`
+}
+
+// ConditionType is the type of a Condition
+type ConditionType string
+
+const (
+	// Ready is true once the deployment matches the resource
+	Ready ConditionType = "Ready"
+	// Progressing is true while a change of the resource is being applied to the deployment
+	Progressing ConditionType = "Progressing"
+	// Degraded is true when the resource can't be reconciled, or some members have a problem
+	Degraded ConditionType = "Degraded"
+	// TLSReady is true once TLS is enabled on all the members, it is only set when spec.security.tls
+	// is enabled
+	TLSReady ConditionType = "TLSReady"
+	// UsersReady is true once the agents of all the members applied the automation config with
+	// the users of the resource
+	UsersReady ConditionType = "UsersReady"
+
+	// VolumesProvisioned is false when the volumes of some members can't be created or provisioned
+	VolumesProvisioned ConditionType = "VolumesProvisioned"
+	// DataVolumeUsageBelowThreshold is false when the usage of the data volume of some members
+	// is above the warning threshold
+	DataVolumeUsageBelowThreshold ConditionType = "DataVolumeUsageBelowThreshold"
+	// VersionChangeAllowed is false when spec.version can't be changed because a pre-flight
+	// check of the version change fails, the reason of the condition tells which one
+	VersionChangeAllowed ConditionType = "VersionChangeAllowed"
+	// ConfigurationValid is false when the resource can't be reconciled until the resource, or one of
+	// the resources it depends on, is changed, the reason of the condition tells which
+	ConfigurationValid ConditionType = "ConfigurationValid"
+	// ReferencedResourcesFound is false when a Secret or ConfigMap referenced by the resource doesn't
+	// exist, the reason tells its kind and the message names it
+	ReferencedResourcesFound ConditionType = "ReferencedResourcesFound"
+	// MonitoringRegistered is true once the members are registered with the monitoring of Ops Manager,
+	// it is only set when spec.opsManager is set
+	MonitoringRegistered ConditionType = "MonitoringRegistered"
+	// WaitingForSecret is true while a Secret referenced by the resource doesn't exist yet, such as one
+	// synced by the External Secrets Operator, the message names it. It is removed once the Secrets exist.
+	WaitingForSecret ConditionType = "WaitingForSecret"
+	// InSync is false when the configuration of the running replica set, its users or the feature
+	// compatibility version of its members have drifted from the automation config
+	InSync ConditionType = "InSync"
+	// ReplicationLagBelowThreshold is false when some secondaries have been lagging behind the
+	// primary for longer than spec.replicationLagThreshold allows
+	ReplicationLagBelowThreshold ConditionType = "ReplicationLagBelowThreshold"
+	// Complete is true once the Job of a MongoDBBackup or a MongoDBRestore has succeeded, and false
+	// with the Failed reason once it has failed
+	Complete ConditionType = "Complete"
+)
+
+// Condition describes the state of an aspect of the deployment
+type Condition struct {
+	Type   ConditionType          `json:"type"`
+	Status corev1.ConditionStatus `json:"status"`
+	// Reason is a machine readable explanation of the status
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable explanation of the status
+	// +optional
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the last time the status changed
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// MemberStatus describes the progress of the agent of a single member
+type MemberStatus struct {
+	Name string `json:"name"`
+	// GoalVersion is the version of the automation config the agent should reach
+	GoalVersion int `json:"goalVersion"`
+	// LastVersionAchieved is the last version of the automation config the agent reached goal state for
+	LastVersionAchieved int64 `json:"lastVersionAchieved"`
+	// CurrentStep is the step of the plan the agent is currently executing, if any, in the form
+	// <move>/<step>, e.g. WaitRsInit/WaitRsInit or ChangeVersion/Download
+	CurrentStep string `json:"currentStep,omitempty"`
+	// CurrentStepSince is the last time the plan made progress: when the current step started, or
+	// when the previous step completed if the current step hasn't started yet
+	// +optional
+	CurrentStepSince *metav1.Time `json:"currentStepSince,omitempty"`
+	// DataVolumeUsage is the disk usage of the data volume of the member, if reported
+	DataVolumeUsage *VolumeUsage `json:"dataVolumeUsage,omitempty"`
+	// State is the replica set state of the member, e.g. PRIMARY, SECONDARY, RECOVERING or ARBITER
+	// +optional
+	State string `json:"state,omitempty"`
+	// ReplicationLagSeconds is how far the member is behind the primary, only set for secondaries
+	// +optional
+	ReplicationLagSeconds *int64 `json:"replicationLagSeconds,omitempty"`
+	// LaggingSince is when the replication lag of the member went above spec.replicationLagThreshold
+	// +optional
+	LaggingSince *metav1.Time `json:"laggingSince,omitempty"`
+	// LastHeartbeat is the last time the member answered a heartbeat of the primary
+	// +optional
+	LastHeartbeat *metav1.Time `json:"lastHeartbeat,omitempty"`
+}
+
+// VolumeUsage is the disk usage of a volume
+type VolumeUsage struct {
+	UsedBytes     int64 `json:"usedBytes"`
+	CapacityBytes int64 `json:"capacityBytes"`
+	UsedPercent   int   `json:"usedPercent"`
+}
+
+// VolumeExpansionStatus describes a PersistentVolumeClaim which is being expanded
+type VolumeExpansionStatus struct {
+	Name string `json:"name"`
+	// RequestedSize is the size the volume is being expanded to
+	RequestedSize string `json:"requestedSize"`
+	// Capacity is the current size of the volume
+	Capacity string `json:"capacity,omitempty"`
+}
+
+// PendingVolumeStatus describes a PersistentVolumeClaim which is not bound yet, or
+// which prevents the Pod of its member from being scheduled
+type PendingVolumeStatus struct {
+	Name string `json:"name"`
+	// Reason is one of WaitingForFirstConsumer, Provisioning, ProvisioningFailed, CreationFailed,
+	// Unschedulable or VolumeNodeAffinityConflict
+	Reason string `json:"reason"`
+	// Message gives details about the reason, e.g. why the Pod of the member can't be scheduled
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // MongoDB is the Schema for the mongodbs API
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.members,statuspath=.status.replicas,selectorpath=.status.labelSelector
 // +kubebuilder:resource:path=mongodb,scope=Namespaced,shortName=mdb
 // +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Current state of the MongoDB deployment"
 // +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.version",description="Version of MongoDB server"
+// +kubebuilder:printcolumn:name="Members Ready",type="string",JSONPath=".status.membersReady",description="Number of members which are ready out of the members of the resource"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.message",description="Change in progress, or why the resource can't be reconciled",priority=1
 type MongoDB struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -152,6 +1584,52 @@ func (m *MongoDB) UpdateSuccess() {
 	m.Status.Phase = Running
 }
 
+// GetCondition returns the condition of the given type, or nil if it isn't set
+func (m MongoDB) GetCondition(conditionType ConditionType) *Condition {
+	return getCondition(m.Status.Conditions, conditionType)
+}
+
+// SetCondition adds or replaces the condition of the same type. The last transition
+// time is only updated if the status of the condition changes.
+func (m *MongoDB) SetCondition(condition Condition) {
+	setCondition(&m.Status.Conditions, condition)
+}
+
+// RemoveCondition removes the condition of the given type, if any
+func (m *MongoDB) RemoveCondition(conditionType ConditionType) {
+	conditions := m.Status.Conditions[:0]
+	for _, condition := range m.Status.Conditions {
+		if condition.Type != conditionType {
+			conditions = append(conditions, condition)
+		}
+	}
+	m.Status.Conditions = conditions
+}
+
+func getCondition(conditions []Condition, conditionType ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+func setCondition(conditions *[]Condition, condition Condition) {
+	existing := getCondition(*conditions, condition.Type)
+	if existing == nil {
+		condition.LastTransitionTime = metav1.Now()
+		*conditions = append(*conditions, condition)
+		return
+	}
+	if existing.Status == condition.Status {
+		condition.LastTransitionTime = existing.LastTransitionTime
+	} else {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	*existing = condition
+}
+
 // MongoURI returns a mongo uri which can be used to connect to this deployment
 func (m MongoDB) MongoURI() string {
 	members := make([]string, m.Spec.Members)
@@ -179,10 +1657,37 @@ func (m MongoDB) ServiceName() string {
 	return m.Name + "-svc"
 }
 
+// ExternalServiceName returns the name of the Service exposing the member with the index outside of
+// the cluster
+func (m MongoDB) ExternalServiceName(index int) string {
+	return fmt.Sprintf("%s-%d-external", m.Name, index)
+}
+
+// ExternalHostname returns the hostname the member with the index is published with, if
+// spec.externalAccess is set
+func (m MongoDB) ExternalHostname(index int) string {
+	if m.Spec.ExternalAccess == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s-%d.%s", m.Name, index, strings.TrimSuffix(m.Spec.ExternalAccess.Domain, "."))
+}
+
 func (m MongoDB) ConfigMapName() string {
 	return m.Name + "-config"
 }
 
+// AutomationConfigTokenSecretName returns the name of the Secret holding the token the agents
+// authenticate with to poll the automation config from the operator
+func (m MongoDB) AutomationConfigTokenSecretName() string {
+	return m.Name + "-automation-config-token"
+}
+
+// ChangeHistoryConfigMapName returns the name of the ConfigMap recording the history
+// of the changes to the spec applied by the operator
+func (m MongoDB) ChangeHistoryConfigMapName() string {
+	return m.Name + "-change-history"
+}
+
 // TLSConfigMapNamespacedName will get the namespaced name of the ConfigMap containing the CA certificate
 // As the ConfigMap will be mounted to our pods, it has to be in the same namespace as the MongoDB resource
 func (m MongoDB) TLSConfigMapNamespacedName() types.NamespacedName {
@@ -204,8 +1709,34 @@ func (m MongoDB) NamespacedName() types.NamespacedName {
 	return types.NamespacedName{Name: m.Name, Namespace: m.Namespace}
 }
 
+// MetricsUserSecretNamespacedName returns the namespaced name of the Secret created by the operator
+// containing the password of the user of mongodb_exporter
+func (m MongoDB) MetricsUserSecretNamespacedName() types.NamespacedName {
+	return types.NamespacedName{Name: m.Name + "-metrics-user", Namespace: m.Namespace}
+}
+
+// PBMUserSecretNamespacedName returns the namespaced name of the Secret created by the operator
+// containing the password of the user of Percona Backup for MongoDB
+func (m MongoDB) PBMUserSecretNamespacedName() types.NamespacedName {
+	return types.NamespacedName{Name: m.Name + "-pbm-user", Namespace: m.Namespace}
+}
+
+// OpsManagerAgentAPIKeySecretNamespacedName returns the namespaced name of the Secret created by the
+// operator containing the agent API key of the project of spec.opsManager
+func (m MongoDB) OpsManagerAgentAPIKeySecretNamespacedName() types.NamespacedName {
+	return types.NamespacedName{Name: m.Name + "-ops-manager-agent-api-key", Namespace: m.Namespace}
+}
+
+// MonitoringUserSecretNamespacedName returns the namespaced name of the Secret created by the operator
+// containing the password of the user of the monitoring agent of Ops Manager
+func (m MongoDB) MonitoringUserSecretNamespacedName() types.NamespacedName {
+	return types.NamespacedName{Name: m.Name + "-monitoring-user", Namespace: m.Namespace}
+}
+
+// ScramCredentialsNamespacedName returns the namespaced name of the Secret holding the password and the
+// keyfile of the agents, generated by the operator
 func (m *MongoDB) ScramCredentialsNamespacedName() types.NamespacedName {
-	return types.NamespacedName{Name: "agent-scram-credentials", Namespace: m.Namespace}
+	return types.NamespacedName{Name: m.Name + "-agent-scram-credentials", Namespace: m.Namespace}
 }
 
 // GetFCV returns the feature compatibility version. If no FeatureCompatibilityVersion is specified.
@@ -2,8 +2,10 @@ package v1
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -40,3 +42,34 @@ func newReplicaSet(members int, name, namespace string) MongoDB {
 		},
 	}
 }
+
+func TestMongoDB_SetCondition(t *testing.T) {
+	mdb := newReplicaSet(3, "my-rs", "my-ns")
+	assert.Nil(t, mdb.GetCondition(VolumesProvisioned))
+
+	mdb.SetCondition(Condition{Type: VolumesProvisioned, Status: corev1.ConditionTrue})
+	condition := mdb.GetCondition(VolumesProvisioned)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	transitionTime := metav1.NewTime(condition.LastTransitionTime.Add(-time.Hour))
+	condition.LastTransitionTime = transitionTime
+
+	mdb.SetCondition(Condition{Type: VolumesProvisioned, Status: corev1.ConditionTrue, Message: "updated"})
+	assert.Len(t, mdb.Status.Conditions, 1)
+	assert.Equal(t, "updated", mdb.GetCondition(VolumesProvisioned).Message)
+	assert.Equal(t, transitionTime, mdb.GetCondition(VolumesProvisioned).LastTransitionTime, "the transition time is kept if the status doesn't change")
+
+	mdb.SetCondition(Condition{Type: VolumesProvisioned, Status: corev1.ConditionFalse})
+	assert.True(t, transitionTime.Before(&mdb.GetCondition(VolumesProvisioned).LastTransitionTime))
+}
+
+func TestMongoDB_RemoveCondition(t *testing.T) {
+	mdb := newReplicaSet(3, "my-rs", "my-ns")
+	mdb.SetCondition(Condition{Type: VolumesProvisioned, Status: corev1.ConditionTrue})
+	mdb.SetCondition(Condition{Type: TLSReady, Status: corev1.ConditionTrue})
+
+	mdb.RemoveCondition(VolumesProvisioned)
+	assert.Nil(t, mdb.GetCondition(VolumesProvisioned))
+	assert.NotNil(t, mdb.GetCondition(TLSReady))
+	mdb.RemoveCondition(VolumesProvisioned)
+	assert.Len(t, mdb.Status.Conditions, 1)
+}
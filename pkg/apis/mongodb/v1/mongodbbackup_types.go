@@ -0,0 +1,107 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// MongoDBBackupSpec defines an on-demand backup of a MongoDB resource
+type MongoDBBackupSpec struct {
+	// MongoDB is the name of the MongoDB resource to back up, in the namespace of the backup
+	MongoDB string `json:"mongodb"`
+	// Method is the tool used to take the backup, it defaults to mongodump
+	// +kubebuilder:validation:Enum=mongodump
+	// +optional
+	Method BackupMethod `json:"method,omitempty"`
+	// Target is where the backup is stored, as an archive named after the MongoDBBackup
+	Target BackupTarget `json:"target"`
+	// Encryption encrypts the archive in the Pod taking it, before it is written to the target
+	// +optional
+	Encryption *BackupEncryption `json:"encryption,omitempty"`
+}
+
+// MongoDBBackupStatus describes the progress of the backup
+type MongoDBBackupStatus struct {
+	// Phase is Pending until the replica set is running, then Running, and Succeeded or Failed
+	// once the backup Job completes
+	// +optional
+	Phase BackupPhase `json:"phase,omitempty"`
+	// Job is the name of the Job taking the backup
+	// +optional
+	Job string `json:"job,omitempty"`
+	// Location is where the archive is stored: s3://<bucket>/<key> for an s3 target, or
+	// <claim name>:<path> for a persistentVolumeClaim target
+	// +optional
+	Location string `json:"location,omitempty"`
+	// Size is the size of the archive in bytes, once the backup succeeded
+	// +optional
+	Size int64 `json:"size,omitempty"`
+	// StartTime is when the backup Job was created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the backup succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message describes why the backup is pending or failed
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Conditions describe the progress of the backup
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MongoDBBackup is an on-demand backup of a MongoDB resource. It is taken once, and isn't
+// updated by changes to its spec.
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=mongodbbackups,scope=Namespaced,shortName=mdbbackup
+// +kubebuilder:printcolumn:name="MongoDB",type="string",JSONPath=".spec.mongodb",description="MongoDB resource backed up"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Progress of the backup"
+// +kubebuilder:printcolumn:name="Location",type="string",JSONPath=".status.location",description="Where the archive is stored"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type MongoDBBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MongoDBBackupSpec   `json:"spec,omitempty"`
+	Status MongoDBBackupStatus `json:"status,omitempty"`
+}
+
+// GetCondition returns the condition of the given type, or nil if it isn't set
+func (b MongoDBBackup) GetCondition(conditionType ConditionType) *Condition {
+	return getCondition(b.Status.Conditions, conditionType)
+}
+
+// SetCondition adds or replaces the condition of the same type. The last transition
+// time is only updated if the status of the condition changes.
+func (b *MongoDBBackup) SetCondition(condition Condition) {
+	setCondition(&b.Status.Conditions, condition)
+}
+
+// IsFinished returns true once the backup succeeded or failed
+func (b MongoDBBackup) IsFinished() bool {
+	return b.Status.Phase == BackupSucceeded || b.Status.Phase == BackupFailed
+}
+
+func (b MongoDBBackup) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{Name: b.Name, Namespace: b.Namespace}
+}
+
+// MongoDBNamespacedName returns the name of the MongoDB resource backed up
+func (b MongoDBBackup) MongoDBNamespacedName() types.NamespacedName {
+	return types.NamespacedName{Name: b.Spec.MongoDB, Namespace: b.Namespace}
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MongoDBBackupList contains a list of MongoDBBackup
+type MongoDBBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MongoDBBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MongoDBBackup{}, &MongoDBBackupList{})
+}
@@ -0,0 +1,163 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// MongoDBRestoreSpec defines the restore of an archive into a MongoDB resource. Exactly one of
+// backup and archiveURL must be set.
+// +kubebuilder:validation:XValidation:rule="(has(self.backup) && self.backup.size() > 0) != (has(self.archiveURL) && self.archiveURL.size() > 0)",message="exactly one of backup and archiveURL must be set"
+type MongoDBRestoreSpec struct {
+	// MongoDB is the name of the MongoDB resource the archive is restored into, in the namespace
+	// of the restore
+	MongoDB string `json:"mongodb"`
+	// Backup is the name of a MongoDBBackup in the namespace of the restore, whose archive is restored
+	// once it succeeded
+	// +optional
+	Backup string `json:"backup,omitempty"`
+	// ArchiveURL is the s3://, http:// or https:// URL of a gzipped archive created with
+	// "mongodump --archive --gzip", such as a scheduled backup
+	// +optional
+	ArchiveURL string `json:"archiveURL,omitempty"`
+	// CredentialsSecretName is the name of a Secret whose keys are exposed as environment variables
+	// to download the archive of archiveURL: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_DEFAULT_REGION for an s3:// URL, or username and password for basic authentication to an
+	// http(s):// URL
+	// +optional
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+	// Drop drops the collections of the archive before restoring them
+	// +optional
+	Drop bool `json:"drop,omitempty"`
+	// PointInTime replays the archived oplog of a MongoDB resource after restoring the archive, up
+	// to the given time
+	// +optional
+	PointInTime *RestorePointInTime `json:"pointInTime,omitempty"`
+	// Clone creates the MongoDB resource of spec.mongodb, which must not exist yet, as a new replica
+	// set, and restores the archive into it once it is running, instead of restoring into an
+	// existing resource
+	// +optional
+	Clone *RestoreClone `json:"clone,omitempty"`
+	// Encryption decrypts the archive and the archived oplog with the given key. It defaults to the
+	// encryption of the MongoDBBackup of spec.backup for the archive, and to the one of spec.backup
+	// of the resource whose oplog is replayed for the oplog.
+	// +optional
+	Encryption *BackupEncryption `json:"encryption,omitempty"`
+}
+
+// RestoreClone describes the MongoDB resource created by a restore
+type RestoreClone struct {
+	// Source is the name of the MongoDB resource whose spec is copied, in the namespace of the
+	// restore, without its spec.backup, spec.bootstrap, spec.initFrom and spec.adopt. It defaults to
+	// the resource of the MongoDBBackup of spec.backup.
+	// +optional
+	Source string `json:"source,omitempty"`
+	// Members is the number of members of the new replica set, it defaults to the one of the source
+	// +optional
+	Members int `json:"members,omitempty"`
+}
+
+// RestorePointInTime restores the data as it was at a given time, by replaying the oplog archived
+// by spec.backup.pointInTime of a MongoDB resource from the time the archive was taken at
+type RestorePointInTime struct {
+	// Time is when the data is restored at, e.g. "2026-01-03T10:15:00Z", the entries of the oplog
+	// up to the end of this second are replayed
+	Time metav1.Time `json:"time"`
+	// MongoDB is the name of the MongoDB resource whose archived oplog is replayed, in the
+	// namespace of the restore. It defaults to spec.mongodb.
+	// +optional
+	MongoDB string `json:"mongodb,omitempty"`
+}
+
+// RestorePhase is the progress of a MongoDBRestore
+type RestorePhase string
+
+const (
+	// RestorePending means the archive will be restored once the replica set is running and the
+	// backup succeeded
+	RestorePending RestorePhase = "Pending"
+	// RestoreRunning means the restore Job is running
+	RestoreRunning RestorePhase = "Running"
+	// RestoreSucceeded means the archive has been restored
+	RestoreSucceeded RestorePhase = "Succeeded"
+	// RestoreFailed means the restore Job failed, or the backup to restore failed
+	RestoreFailed RestorePhase = "Failed"
+)
+
+// MongoDBRestoreStatus describes the progress of the restore
+type MongoDBRestoreStatus struct {
+	// Phase is Pending until the replica set is running and the backup succeeded, then Running,
+	// and Succeeded or Failed once the restore Job completes
+	// +optional
+	Phase RestorePhase `json:"phase,omitempty"`
+	// Job is the name of the Job restoring the archive
+	// +optional
+	Job string `json:"job,omitempty"`
+	// StartTime is when the restore Job was created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the restore succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message describes why the restore is pending or failed
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Conditions describe the progress of the restore
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MongoDBRestore restores an archive into a MongoDB resource. It is restored once, and isn't
+// updated by changes to its spec.
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=mongodbrestores,scope=Namespaced,shortName=mdbrestore
+// +kubebuilder:printcolumn:name="MongoDB",type="string",JSONPath=".spec.mongodb",description="MongoDB resource restored into"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Progress of the restore"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type MongoDBRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MongoDBRestoreSpec   `json:"spec,omitempty"`
+	Status MongoDBRestoreStatus `json:"status,omitempty"`
+}
+
+// GetCondition returns the condition of the given type, or nil if it isn't set
+func (r MongoDBRestore) GetCondition(conditionType ConditionType) *Condition {
+	return getCondition(r.Status.Conditions, conditionType)
+}
+
+// SetCondition adds or replaces the condition of the same type. The last transition
+// time is only updated if the status of the condition changes.
+func (r *MongoDBRestore) SetCondition(condition Condition) {
+	setCondition(&r.Status.Conditions, condition)
+}
+
+// IsFinished returns true once the restore succeeded or failed
+func (r MongoDBRestore) IsFinished() bool {
+	return r.Status.Phase == RestoreSucceeded || r.Status.Phase == RestoreFailed
+}
+
+func (r MongoDBRestore) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{Name: r.Name, Namespace: r.Namespace}
+}
+
+// MongoDBNamespacedName returns the name of the MongoDB resource restored into
+func (r MongoDBRestore) MongoDBNamespacedName() types.NamespacedName {
+	return types.NamespacedName{Name: r.Spec.MongoDB, Namespace: r.Namespace}
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MongoDBRestoreList contains a list of MongoDBRestore
+type MongoDBRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MongoDBRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MongoDBRestore{}, &MongoDBRestoreList{})
+}
@@ -0,0 +1,7 @@
+// Package v1beta1 contains API Schema definitions for the mongodb v1beta1 API group. It's the first
+// version of the MongoDB resources, which only configures the members, the version, the security
+// and the users of the replica set. The resources are stored in v1, which holds the fields added
+// since, and are converted between the versions by the conversion webhook of the operator.
+// +k8s:deepcopy-gen=package,register
+// +groupName=mongodb.com
+package v1beta1
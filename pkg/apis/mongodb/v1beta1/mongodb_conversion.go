@@ -0,0 +1,177 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// conversionDataAnnotationKey is the annotation of the v1beta1 resources holding the spec and the
+// status of the v1 resource they were converted from, when they have fields v1beta1 doesn't, so
+// that these fields aren't lost when the resource is converted back to v1
+const conversionDataAnnotationKey = "mongodb.com/v1.conversionData"
+
+var _ conversion.Convertible = &MongoDB{}
+
+// conversionData is the content of the conversionDataAnnotationKey annotation
+type conversionData struct {
+	Spec   mdbv1.MongoDBSpec   `json:"spec"`
+	Status mdbv1.MongoDBStatus `json:"status"`
+}
+
+// ConvertTo converts the resource to v1. The fields v1beta1 doesn't have are restored from the
+// conversionDataAnnotationKey annotation if it's set, the other fields are taken from the resource,
+// as they may have been changed since it was converted from v1.
+func (m *MongoDB) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*mdbv1.MongoDB)
+	if !ok {
+		return fmt.Errorf("can't convert a MongoDB resource to %T", dstRaw)
+	}
+	dst.ObjectMeta = *m.ObjectMeta.DeepCopy()
+	dst.Spec, dst.Status = mdbv1.MongoDBSpec{}, mdbv1.MongoDBStatus{}
+	if data, ok := dst.Annotations[conversionDataAnnotationKey]; ok {
+		restored := conversionData{}
+		if err := json.Unmarshal([]byte(data), &restored); err != nil {
+			return fmt.Errorf("error reading the %s annotation: %s", conversionDataAnnotationKey, err)
+		}
+		dst.Spec, dst.Status = restored.Spec, restored.Status
+		delete(dst.Annotations, conversionDataAnnotationKey)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	dst.Spec.Members = m.Spec.Members
+	dst.Spec.Type = mdbv1.Type(m.Spec.Type)
+	dst.Spec.Version = m.Spec.Version
+	dst.Spec.FeatureCompatibilityVersion = m.Spec.FeatureCompatibilityVersion
+	dst.Spec.Security.Authentication.Enabled = m.Spec.Security.Authentication.Enabled
+	dst.Spec.Security.Authentication.Modes = nil
+	if m.Spec.Security.Authentication.Modes != nil {
+		dst.Spec.Security.Authentication.Modes = make([]mdbv1.AuthMode, len(m.Spec.Security.Authentication.Modes))
+		for i, mode := range m.Spec.Security.Authentication.Modes {
+			dst.Spec.Security.Authentication.Modes[i] = mdbv1.AuthMode(mode)
+		}
+	}
+	tls := &dst.Spec.Security.TLS
+	tls.Enabled = m.Spec.Security.TLS.Enabled
+	tls.Optional = m.Spec.Security.TLS.Optional
+	tls.CertificateKeySecret.Name = m.Spec.Security.TLS.CertificateKeySecret.Name
+	tls.CaConfigMap.Name = m.Spec.Security.TLS.CaConfigMap.Name
+	restoredUsers := dst.Spec.Users
+	dst.Spec.Users = nil
+	if m.Spec.Users != nil {
+		dst.Spec.Users = make([]mdbv1.MongoDBUser, len(m.Spec.Users))
+		for i, user := range m.Spec.Users {
+			dst.Spec.Users[i] = convertUserTo(user)
+			// the reference to the Vault secret of the password is kept while the user isn't changed
+			if i < len(restoredUsers) && restoredUsers[i].Name == user.Name && restoredUsers[i].DB == user.DB {
+				dst.Spec.Users[i].PasswordVaultRef = restoredUsers[i].PasswordVaultRef
+			}
+		}
+	}
+
+	dst.Status.MongoURI = m.Status.MongoURI
+	dst.Status.Phase = mdbv1.Phase(m.Status.Phase)
+	return nil
+}
+
+// ConvertFrom converts the v1 resource to v1beta1. Its spec and status are kept in the
+// conversionDataAnnotationKey annotation if they have fields v1beta1 doesn't.
+func (m *MongoDB) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*mdbv1.MongoDB)
+	if !ok {
+		return fmt.Errorf("can't convert a MongoDB resource from %T", srcRaw)
+	}
+	m.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(m.Annotations, conversionDataAnnotationKey)
+
+	m.Spec = MongoDBSpec{
+		Members:                     src.Spec.Members,
+		Type:                        Type(src.Spec.Type),
+		Version:                     src.Spec.Version,
+		FeatureCompatibilityVersion: src.Spec.FeatureCompatibilityVersion,
+		Security: Security{
+			Authentication: Authentication{Enabled: src.Spec.Security.Authentication.Enabled},
+			TLS: TLS{
+				Enabled:              src.Spec.Security.TLS.Enabled,
+				Optional:             src.Spec.Security.TLS.Optional,
+				CertificateKeySecret: LocalObjectReference{Name: src.Spec.Security.TLS.CertificateKeySecret.Name},
+				CaConfigMap:          LocalObjectReference{Name: src.Spec.Security.TLS.CaConfigMap.Name},
+			},
+		},
+	}
+	if src.Spec.Security.Authentication.Modes != nil {
+		m.Spec.Security.Authentication.Modes = make([]AuthMode, len(src.Spec.Security.Authentication.Modes))
+		for i, mode := range src.Spec.Security.Authentication.Modes {
+			m.Spec.Security.Authentication.Modes[i] = AuthMode(mode)
+		}
+	}
+	if src.Spec.Users != nil {
+		m.Spec.Users = make([]MongoDBUser, len(src.Spec.Users))
+		for i, user := range src.Spec.Users {
+			m.Spec.Users[i] = convertUserFrom(user)
+		}
+	}
+	m.Status = MongoDBStatus{
+		MongoURI: src.Status.MongoURI,
+		Phase:    Phase(src.Status.Phase),
+	}
+
+	// the annotation is only set if the resource can't be converted back to v1 without it
+	convertedBack := mdbv1.MongoDB{}
+	if err := m.ConvertTo(&convertedBack); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(convertedBack.Spec, src.Spec) && equality.Semantic.DeepEqual(convertedBack.Status, src.Status) {
+		return nil
+	}
+	data, err := json.Marshal(conversionData{Spec: src.Spec, Status: src.Status})
+	if err != nil {
+		return fmt.Errorf("error writing the %s annotation: %s", conversionDataAnnotationKey, err)
+	}
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	m.Annotations[conversionDataAnnotationKey] = string(data)
+	return nil
+}
+
+func convertUserTo(user MongoDBUser) mdbv1.MongoDBUser {
+	converted := mdbv1.MongoDBUser{
+		Name: user.Name,
+		DB:   user.DB,
+		PasswordSecretRef: mdbv1.SecretKeyReference{
+			Name: user.PasswordSecretRef.Name,
+			Key:  user.PasswordSecretRef.Key,
+		},
+	}
+	if user.Roles != nil {
+		converted.Roles = make([]mdbv1.Role, len(user.Roles))
+		for i, role := range user.Roles {
+			converted.Roles[i] = mdbv1.Role{DB: role.DB, Name: role.Name}
+		}
+	}
+	return converted
+}
+
+func convertUserFrom(user mdbv1.MongoDBUser) MongoDBUser {
+	converted := MongoDBUser{
+		Name: user.Name,
+		DB:   user.DB,
+		PasswordSecretRef: SecretKeyReference{
+			Name: user.PasswordSecretRef.Name,
+			Key:  user.PasswordSecretRef.Key,
+		},
+	}
+	if user.Roles != nil {
+		converted.Roles = make([]Role, len(user.Roles))
+		for i, role := range user.Roles {
+			converted.Roles[i] = Role{DB: role.DB, Name: role.Name}
+		}
+	}
+	return converted
+}
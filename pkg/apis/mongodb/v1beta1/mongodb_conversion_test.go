@@ -0,0 +1,140 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newReplicaSet() MongoDB {
+	return MongoDB{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-rs",
+			Namespace:   "my-ns",
+			Labels:      map[string]string{"team": "payments"},
+			Annotations: map[string]string{"owner": "payments"},
+		},
+		Spec: MongoDBSpec{
+			Members:                     3,
+			Type:                        "ReplicaSet",
+			Version:                     "4.2.6",
+			FeatureCompatibilityVersion: "4.0",
+			Security: Security{
+				Authentication: Authentication{Enabled: true, Modes: []AuthMode{"SCRAM"}},
+				TLS: TLS{
+					Enabled:              true,
+					Optional:             true,
+					CertificateKeySecret: LocalObjectReference{Name: "tls-secret"},
+					CaConfigMap:          LocalObjectReference{Name: "ca-config-map"},
+				},
+			},
+			Users: []MongoDBUser{{
+				Name:              "alice",
+				DB:                "admin",
+				PasswordSecretRef: SecretKeyReference{Name: "alice-password", Key: "pwd"},
+				Roles:             []Role{{DB: "app", Name: "readWrite"}, {DB: "admin", Name: "clusterMonitor"}},
+			}},
+		},
+		Status: MongoDBStatus{MongoURI: "mongodb://my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017", Phase: "Running"},
+	}
+}
+
+// newV1ReplicaSet returns the v1 resource with fields v1beta1 doesn't have
+func newV1ReplicaSet(t *testing.T) mdbv1.MongoDB {
+	v1 := mdbv1.MongoDB{}
+	mdb := newReplicaSet()
+	assert.NoError(t, mdb.ConvertTo(&v1))
+	v1.Spec.Storage.Data.Size = "20Gi"
+	v1.Spec.Storage.Logs = &mdbv1.VolumeClaim{Size: "1Gi"}
+	v1.Spec.Paused = true
+	v1.Spec.Security.Vault = &mdbv1.Vault{Role: "my-rs"}
+	v1.Spec.Users[0].PasswordVaultRef = &mdbv1.VaultSecretKeyReference{Path: "secret/mongodb/alice"}
+	v1.Status.ObservedGeneration = 2
+	v1.Status.Version = "4.2.6"
+	v1.Status.Conditions = []mdbv1.Condition{{Type: mdbv1.Ready, Status: corev1.ConditionTrue, Reason: "Running"}}
+	return v1
+}
+
+func TestConvert_V1beta1RoundTrip(t *testing.T) {
+	mdb := newReplicaSet()
+	v1 := mdbv1.MongoDB{}
+	assert.NoError(t, mdb.ConvertTo(&v1))
+	assert.Equal(t, mdb.ObjectMeta, v1.ObjectMeta)
+	assert.Equal(t, 3, v1.Spec.Members)
+	assert.Equal(t, mdbv1.ReplicaSet, v1.Spec.Type)
+	assert.Equal(t, []mdbv1.AuthMode{"SCRAM"}, v1.Spec.Security.Authentication.Modes)
+	assert.Equal(t, "tls-secret", v1.Spec.Security.TLS.CertificateKeySecret.Name)
+	assert.Equal(t, []mdbv1.Role{{DB: "app", Name: "readWrite"}, {DB: "admin", Name: "clusterMonitor"}}, v1.Spec.Users[0].Roles)
+	assert.Equal(t, mdbv1.Running, v1.Status.Phase)
+
+	converted := MongoDB{}
+	assert.NoError(t, converted.ConvertFrom(&v1))
+	assert.Equal(t, mdb, converted)
+	assert.NotContains(t, converted.Annotations, conversionDataAnnotationKey, "the resource is converted back without the annotation")
+}
+
+func TestConvert_V1RoundTrip(t *testing.T) {
+	v1 := newV1ReplicaSet(t)
+
+	mdb := MongoDB{}
+	assert.NoError(t, mdb.ConvertFrom(&v1))
+	assert.Equal(t, "payments", mdb.Annotations["owner"])
+	assert.Contains(t, mdb.Annotations, conversionDataAnnotationKey)
+	assert.NotContains(t, v1.Annotations, conversionDataAnnotationKey, "the v1 resource isn't changed")
+
+	converted := mdbv1.MongoDB{}
+	assert.NoError(t, mdb.ConvertTo(&converted))
+	assert.Equal(t, v1, converted)
+
+	// the resource is stored in v1 once converted back, so it's sent through JSON to the API server
+	data, err := json.Marshal(mdb)
+	assert.NoError(t, err)
+	fromJSON := MongoDB{}
+	assert.NoError(t, json.Unmarshal(data, &fromJSON))
+	converted = mdbv1.MongoDB{}
+	assert.NoError(t, fromJSON.ConvertTo(&converted))
+	assert.Equal(t, v1.Spec, converted.Spec)
+	assert.Equal(t, v1.Status.Conditions[0].Reason, converted.Status.Conditions[0].Reason)
+}
+
+func TestConvert_KeepsTheV1beta1Changes(t *testing.T) {
+	v1 := newV1ReplicaSet(t)
+	mdb := MongoDB{}
+	assert.NoError(t, mdb.ConvertFrom(&v1))
+
+	mdb.Spec.Members = 5
+	mdb.Spec.Version = "4.4.0"
+	mdb.Spec.Security.TLS.Enabled = false
+	mdb.Spec.Users = nil
+	converted := mdbv1.MongoDB{}
+	assert.NoError(t, mdb.ConvertTo(&converted))
+
+	assert.Equal(t, 5, converted.Spec.Members)
+	assert.Equal(t, "4.4.0", converted.Spec.Version)
+	assert.False(t, converted.Spec.Security.TLS.Enabled)
+	assert.Nil(t, converted.Spec.Users)
+	assert.Equal(t, v1.Spec.Storage, converted.Spec.Storage, "the fields v1beta1 doesn't have are kept")
+	assert.True(t, converted.Spec.Paused)
+}
+
+func TestConvert_EmptyLists(t *testing.T) {
+	mdb := newReplicaSet()
+	mdb.Spec.Users = []MongoDBUser{}
+	mdb.Spec.Security.Authentication.Modes = nil
+	v1 := mdbv1.MongoDB{}
+	assert.NoError(t, mdb.ConvertTo(&v1))
+
+	assert.NotNil(t, v1.Spec.Users, "the empty lists are kept, as they're serialized differently")
+	assert.Empty(t, v1.Spec.Users)
+	assert.Nil(t, v1.Spec.Security.Authentication.Modes)
+}
+
+func TestConvert_InvalidAnnotation(t *testing.T) {
+	mdb := newReplicaSet()
+	mdb.Annotations[conversionDataAnnotationKey] = "{"
+	assert.Error(t, mdb.ConvertTo(&mdbv1.MongoDB{}))
+}
@@ -0,0 +1,143 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type Type string
+
+type Phase string
+
+// MongoDBSpec defines the desired state of MongoDB
+type MongoDBSpec struct {
+	// Members is the number of members in the replica set
+	// +optional
+	Members int `json:"members"`
+	// Type defines which type of MongoDB deployment the resource should create
+	// +kubebuilder:validation:Enum=ReplicaSet
+	Type Type `json:"type"`
+	// Version defines which version of MongoDB will be used
+	Version string `json:"version"`
+
+	// FeatureCompatibilityVersion configures the feature compatibility version that will
+	// be set for the deployment
+	// +optional
+	FeatureCompatibilityVersion string `json:"featureCompatibilityVersion,omitempty"`
+
+	// Security configures security features, such as TLS, and authentication settings for a deployment
+	// +optional
+	Security Security `json:"security"`
+
+	// Users specifies the MongoDB users that should be configured in your deployment
+	// +required
+	Users []MongoDBUser `json:"users"`
+}
+
+type MongoDBUser struct {
+	// Name is the username of the user
+	Name string `json:"name"`
+
+	// DB is the database the user is stored in. Defaults to "admin"
+	// +optional
+	DB string `json:"db"`
+
+	// PasswordSecretRef is a reference to the secret containing this user's password
+	PasswordSecretRef SecretKeyReference `json:"passwordSecretRef"`
+
+	// Roles is an array of roles assigned to this user
+	Roles []Role `json:"roles"`
+}
+
+// SecretKeyReference is a reference to the secret containing the user's password
+type SecretKeyReference struct {
+	// Name is the name of the secret storing this user's password
+	Name string `json:"name"`
+
+	// Key is the key in the secret storing this password. Defaults to "password"
+	// +optional
+	Key string `json:"key"`
+}
+
+// Role is the database role this user should have
+type Role struct {
+	// DB is the database the role can act on
+	DB string `json:"db"`
+	// Name is the name of the role
+	Name string `json:"name"`
+}
+
+type Security struct {
+	// +optional
+	Authentication Authentication `json:"authentication"`
+	// TLS configuration for both client-server and server-server communication
+	// +optional
+	TLS TLS `json:"tls"`
+}
+
+// TLS is the configuration used to set up TLS encryption
+type TLS struct {
+	Enabled bool `json:"enabled"`
+
+	// Optional configures if TLS should be required or optional for connections
+	// +optional
+	Optional bool `json:"optional"`
+
+	// CertificateKeySecret is a reference to a Secret containing a private key and certificate to use for TLS.
+	// The key and cert are expected to be PEM encoded and available at "tls.key" and "tls.crt".
+	// +optional
+	CertificateKeySecret LocalObjectReference `json:"certificateKeySecretRef"`
+
+	// CaConfigMap is a reference to a ConfigMap containing the certificate for the CA which signed the server certificates
+	// The certificate is expected to be available under the key "ca.crt"
+	// +optional
+	CaConfigMap LocalObjectReference `json:"caConfigMapRef"`
+}
+
+// LocalObjectReference is a reference to another Kubernetes object by name.
+type LocalObjectReference struct {
+	Name string `json:"name"`
+}
+
+type Authentication struct {
+	// Enabled specifies if authentication should be enabled
+	Enabled bool `json:"enabled"`
+
+	// Modes is an array specifying which authentication methods should be enabled
+	Modes []AuthMode `json:"modes"`
+}
+
+// +kubebuilder:validation:Enum=SCRAM
+type AuthMode string
+
+// MongoDBStatus defines the observed state of MongoDB
+type MongoDBStatus struct {
+	MongoURI string `json:"mongoUri"`
+	Phase    Phase  `json:"phase"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MongoDB is the Schema for the mongodbs API
+// +kubebuilder:unservedversion
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=mongodb,scope=Namespaced,shortName=mdb
+type MongoDB struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MongoDBSpec   `json:"spec,omitempty"`
+	Status MongoDBStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MongoDBList contains a list of MongoDB
+type MongoDBList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MongoDB `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MongoDB{}, &MongoDBList{})
+}
@@ -8,12 +8,13 @@ import (
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/generate"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
 
-// EnsureAgentSecret make sure that the agent password and keyfile exist in the secret and returns
-// an automation config modification function with these values
-func EnsureAgentSecret(getUpdateCreator secret.GetUpdateCreator, secretNsName types.NamespacedName) (automationconfig.Modification, error) {
+// EnsureAgentSecret make sure that the agent password and keyfile exist in the secret, owned by the
+// given owner references, and returns an automation config modification function with these values
+func EnsureAgentSecret(getUpdateCreator secret.GetUpdateCreator, secretNsName types.NamespacedName, ownerReferences []metav1.OwnerReference) (automationconfig.Modification, error) {
 	generatedPassword, err := generate.RandomFixedLengthStringOfSize(20)
 	if err != nil {
 		return automationconfig.NOOP(), fmt.Errorf("error generating password: %s", err)
@@ -32,6 +33,7 @@ func EnsureAgentSecret(getUpdateCreator secret.GetUpdateCreator, secretNsName ty
 				SetName(secretNsName.Name).
 				SetField(AgentPasswordKey, generatedPassword).
 				SetField(AgentKeyfileKey, generatedContents).
+				SetOwnerReferences(ownerReferences).
 				Build()
 			return automationConfigModification(generatedPassword, generatedContents, []automationconfig.MongoDBUser{}), getUpdateCreator.CreateSecret(s)
 		}
@@ -46,6 +48,7 @@ func EnsureAgentSecret(getUpdateCreator secret.GetUpdateCreator, secretNsName ty
 	if _, ok := agentSecret.Data[AgentKeyfileKey]; !ok {
 		agentSecret.Data[AgentKeyfileKey] = []byte(generatedContents)
 	}
+	agentSecret.OwnerReferences = ownerReferences
 
 	return automationConfigModification(
 		string(agentSecret.Data[AgentPasswordKey]),
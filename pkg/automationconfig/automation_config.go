@@ -21,6 +21,8 @@ type AutomationConfig struct {
 	Versions     []MongoDbVersionConfig `json:"mongoDbVersions"`
 	ToolsVersion ToolsVersion           `json:"mongoDbToolsVersion"`
 	Options      Options                `json:"options"`
+	// Roles are the custom roles created in the admin database, which can be granted to the users
+	Roles []CustomRole `json:"roles,omitempty"`
 }
 
 type Role struct {
@@ -28,6 +30,29 @@ type Role struct {
 	Database string `json:"db"`
 }
 
+// CustomRole is a user-defined role, with its privileges and the roles it inherits from
+type CustomRole struct {
+	Role       string      `json:"role"`
+	Database   string      `json:"db"`
+	Privileges []Privilege `json:"privileges"`
+	Roles      []Role      `json:"roles"`
+}
+
+// Privilege allows the actions on the resource
+type Privilege struct {
+	Resource Resource `json:"resource"`
+	Actions  []string `json:"actions"`
+}
+
+// Resource is the resource of a privilege, either a database and a collection, where an empty
+// name matches all of them, the cluster, or any resource
+type Resource struct {
+	Database    *string `json:"db,omitempty"`
+	Collection  *string `json:"collection,omitempty"`
+	Cluster     bool    `json:"cluster,omitempty"`
+	AnyResource bool    `json:"anyResource,omitempty"`
+}
+
 type Process struct {
 	Name                        string      `json:"name"`
 	HostName                    string      `json:"hostname"`
@@ -55,7 +80,7 @@ func newProcess(name, hostName, version, replSetName string, opts ...func(proces
 		Args26: Args26{
 			Net: Net{
 				Port: 27017,
-				TLS: MongoDBTLS{
+				TLS: &MongoDBTLS{
 					Mode: TLSModeDisabled,
 				},
 			},
@@ -78,11 +103,18 @@ type Args26 struct {
 	Security    Security    `json:"security"`
 	Storage     Storage     `json:"storage"`
 	Replication Replication `json:"replication"`
+
+	// Additional are the options of mongod which have no field, as nested objects like in its
+	// configuration file, e.g. {"setParameter": {"cursorTimeoutMillis": 600000}}. They are
+	// serialized along with the fields, which take precedence, see MarshalJSON.
+	Additional map[string]interface{} `json:"-"`
 }
 
+// Net configures either tls, or ssl which is how MongoDB versions before 4.2 name it
 type Net struct {
-	Port int        `json:"port"`
-	TLS  MongoDBTLS `json:"tls"`
+	Port int         `json:"port"`
+	TLS  *MongoDBTLS `json:"tls,omitempty"`
+	SSL  *MongoDBSSL `json:"ssl,omitempty"`
 }
 
 type TLSMode string
@@ -101,6 +133,24 @@ type MongoDBTLS struct {
 	AllowConnectionsWithoutCertificate bool    `json:"allowConnectionsWithoutCertificates"`
 }
 
+type SSLMode string
+
+const (
+	SSLModeDisabled  SSLMode = "disabled"
+	SSLModeAllowed   SSLMode = "allowSSL"
+	SSLModePreferred SSLMode = "preferSSL"
+	SSLModeRequired  SSLMode = "requireSSL"
+)
+
+// MongoDBSSL are the net.ssl options of MongoDB versions before 4.2, which were renamed to
+// net.tls in 4.2
+type MongoDBSSL struct {
+	Mode                               SSLMode `json:"mode"`
+	PEMKeyFile                         string  `json:"PEMKeyFile,omitempty"`
+	CAFile                             string  `json:"CAFile,omitempty"`
+	AllowConnectionsWithoutCertificate bool    `json:"allowConnectionsWithoutCertificates"`
+}
+
 type Security struct {
 	ClusterAuthMode string `json:"clusterAuthMode,omitempty"`
 }
@@ -140,6 +190,9 @@ type ReplicaSetMember struct {
 	Priority    int    `json:"priority"`
 	ArbiterOnly bool   `json:"arbiterOnly"`
 	Votes       int    `json:"votes"`
+	// Horizons are the hostnames the member is advertised with to the clients connecting through
+	// each horizon, by name
+	Horizons map[string]string `json:"horizons,omitempty"`
 }
 
 func newReplicaSetMember(p Process, id int) ReplicaSetMember {
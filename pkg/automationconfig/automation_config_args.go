@@ -0,0 +1,154 @@
+package automationconfig
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// args26Fields are the fields of Args26 without its methods, so that they are serialized by
+// encoding/json
+type args26Fields Args26
+
+// MarshalJSON serializes the fields of the arguments merged over the additional options. Without
+// additional options only the fields are serialized, in their order, so that the automation
+// configs written before the additional options existed are serialized to the same bytes.
+func (a Args26) MarshalJSON() ([]byte, error) {
+	if len(a.Additional) == 0 {
+		return json.Marshal(args26Fields(a))
+	}
+	options, err := a.options()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(options)
+}
+
+// UnmarshalJSON reads the fields of the arguments, the options which don't match any field are
+// kept as the additional options.
+func (a *Args26) UnmarshalJSON(data []byte) error {
+	fields := args26Fields{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	options := map[string]interface{}{}
+	if err := json.Unmarshal(data, &options); err != nil {
+		return err
+	}
+	known, err := fieldOptions(fields)
+	if err != nil {
+		return err
+	}
+	subtractOptions(options, known)
+
+	*a = Args26(fields)
+	a.Additional = nil
+	if len(options) > 0 {
+		a.Additional = options
+	}
+	return nil
+}
+
+// options returns the arguments as nested objects, the fields merged over the additional options
+func (a Args26) options() (map[string]interface{}, error) {
+	fields, err := fieldOptions(args26Fields(a))
+	if err != nil {
+		return nil, err
+	}
+	options := copyOptions(a.Additional)
+	mergeOptions(options, fields)
+	return options, nil
+}
+
+func fieldOptions(fields args26Fields) (map[string]interface{}, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	options := map[string]interface{}{}
+	if err := json.Unmarshal(data, &options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// mergeOptions sets the options of src in dst, the objects present in both are merged
+func mergeOptions(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcObject, srcIsObject := v.(map[string]interface{})
+		dstObject, dstIsObject := dst[k].(map[string]interface{})
+		if srcIsObject && dstIsObject {
+			mergeOptions(dstObject, srcObject)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// subtractOptions removes the options of removed from options, the objects left empty are removed
+func subtractOptions(options, removed map[string]interface{}) {
+	for k, v := range removed {
+		removedObject, removedIsObject := v.(map[string]interface{})
+		object, isObject := options[k].(map[string]interface{})
+		if removedIsObject && isObject {
+			subtractOptions(object, removedObject)
+			if len(object) > 0 {
+				continue
+			}
+		}
+		delete(options, k)
+	}
+}
+
+// lookupOption returns the option at the dotted path, e.g. net.tls.mode
+func lookupOption(options map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		object, ok := options[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		options = object
+	}
+	value, ok := options[keys[len(keys)-1]]
+	return value, ok
+}
+
+// deleteOption removes the option at the dotted path, and the objects it leaves empty
+func deleteOption(options map[string]interface{}, path string) {
+	keys := strings.SplitN(path, ".", 2)
+	if len(keys) == 1 {
+		delete(options, path)
+		return
+	}
+	object, ok := options[keys[0]].(map[string]interface{})
+	if !ok {
+		return
+	}
+	deleteOption(object, keys[1])
+	if len(object) == 0 {
+		delete(options, keys[0])
+	}
+}
+
+func copyOptions(options map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		copied[k] = copyOption(v)
+	}
+	return copied
+}
+
+func copyOption(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyOptions(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyOption(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
@@ -156,12 +156,27 @@ func (b *Builder) Build() (AutomationConfig, error) {
 		modification(&currentAc)
 	}
 
+	for i := range currentAc.Processes {
+		if err := translateProcessArgs(&currentAc.Processes[i]); err != nil {
+			return AutomationConfig{}, fmt.Errorf("invalid automation config: %s", err)
+		}
+	}
+
+	// Make sure the ordering of lists doesn't depend on the order in which
+	// processes, users or roles were added, so that re-orderings alone never
+	// result in a new version.
+	currentAc = normalize(currentAc)
+
+	if err := Validate(currentAc); err != nil {
+		return AutomationConfig{}, fmt.Errorf("invalid automation config: %s", err)
+	}
+
 	// Here we compare the bytes of the two automationconfigs,
 	// we can't use reflect.DeepEqual() as it treats nil entries as different from empty ones,
 	// and in the AutomationConfig Struct we use omitempty to set empty field to nil
 	// The agent requires the nil value we provide, otherwise the agent attempts to configure authentication.
 
-	newAcBytes, err := json.Marshal(b.previousAC)
+	newAcBytes, err := json.Marshal(normalize(b.previousAC))
 	if err != nil {
 		return AutomationConfig{}, err
 	}
@@ -0,0 +1,148 @@
+package automationconfig
+
+// DeepCopy returns a copy of the automation config which shares no slice, map or pointer with it,
+// so that either can be modified without changing the other. Nil and empty slices are kept as they
+// are, as they aren't serialized the same way.
+func (ac AutomationConfig) DeepCopy() AutomationConfig {
+	copied := ac
+	if ac.Processes != nil {
+		copied.Processes = make([]Process, len(ac.Processes))
+		for i, process := range ac.Processes {
+			copied.Processes[i] = process
+			copied.Processes[i].Args26 = process.Args26.deepCopy()
+		}
+	}
+	if ac.ReplicaSets != nil {
+		copied.ReplicaSets = make([]ReplicaSet, len(ac.ReplicaSets))
+		for i, rs := range ac.ReplicaSets {
+			copied.ReplicaSets[i] = rs
+			if rs.Members != nil {
+				copied.ReplicaSets[i].Members = make([]ReplicaSetMember, len(rs.Members))
+				for j, member := range rs.Members {
+					copied.ReplicaSets[i].Members[j] = member
+					if member.Horizons != nil {
+						copied.ReplicaSets[i].Members[j].Horizons = map[string]string{}
+						for k, v := range member.Horizons {
+							copied.ReplicaSets[i].Members[j].Horizons[k] = v
+						}
+					}
+				}
+			}
+		}
+	}
+	copied.Auth = ac.Auth.deepCopy()
+	if ac.Roles != nil {
+		copied.Roles = make([]CustomRole, len(ac.Roles))
+		for i, role := range ac.Roles {
+			copied.Roles[i] = role
+			if role.Roles != nil {
+				copied.Roles[i].Roles = make([]Role, len(role.Roles))
+				copy(copied.Roles[i].Roles, role.Roles)
+			}
+			if role.Privileges != nil {
+				copied.Roles[i].Privileges = make([]Privilege, len(role.Privileges))
+				for j, privilege := range role.Privileges {
+					copied.Roles[i].Privileges[j] = Privilege{Resource: privilege.Resource.deepCopy(), Actions: copyStrings(privilege.Actions)}
+				}
+			}
+		}
+	}
+	copied.Versions = copyVersions(ac.Versions)
+	if ac.ToolsVersion.URLs != nil {
+		copied.ToolsVersion.URLs = make(map[string]map[string]string, len(ac.ToolsVersion.URLs))
+		for platform, urls := range ac.ToolsVersion.URLs {
+			if urls == nil {
+				copied.ToolsVersion.URLs[platform] = nil
+				continue
+			}
+			copied.ToolsVersion.URLs[platform] = make(map[string]string, len(urls))
+			for k, v := range urls {
+				copied.ToolsVersion.URLs[platform][k] = v
+			}
+		}
+	}
+	return copied
+}
+
+func (a Args26) deepCopy() Args26 {
+	copied := a
+	if a.Net.TLS != nil {
+		tls := *a.Net.TLS
+		copied.Net.TLS = &tls
+	}
+	if a.Net.SSL != nil {
+		ssl := *a.Net.SSL
+		copied.Net.SSL = &ssl
+	}
+	if a.Additional != nil {
+		copied.Additional = copyOptions(a.Additional)
+	}
+	return copied
+}
+
+func (r Resource) deepCopy() Resource {
+	copied := r
+	if r.Database != nil {
+		database := *r.Database
+		copied.Database = &database
+	}
+	if r.Collection != nil {
+		collection := *r.Collection
+		copied.Collection = &collection
+	}
+	return copied
+}
+
+func (a Auth) deepCopy() Auth {
+	copied := a
+	copied.AutoAuthMechanisms = copyStrings(a.AutoAuthMechanisms)
+	copied.DeploymentAuthMechanisms = copyStrings(a.DeploymentAuthMechanisms)
+	if a.Users != nil {
+		copied.Users = make([]MongoDBUser, len(a.Users))
+		for i, user := range a.Users {
+			copied.Users[i] = user
+			copied.Users[i].Mechanisms = copyStrings(user.Mechanisms)
+			copied.Users[i].AuthenticationRestrictions = copyStrings(user.AuthenticationRestrictions)
+			if user.Roles != nil {
+				copied.Users[i].Roles = make([]Role, len(user.Roles))
+				copy(copied.Users[i].Roles, user.Roles)
+			}
+			if user.ScramSha256Creds != nil {
+				creds := *user.ScramSha256Creds
+				copied.Users[i].ScramSha256Creds = &creds
+			}
+			if user.ScramSha1Creds != nil {
+				creds := *user.ScramSha1Creds
+				copied.Users[i].ScramSha1Creds = &creds
+			}
+		}
+	}
+	return copied
+}
+
+func copyVersions(versions []MongoDbVersionConfig) []MongoDbVersionConfig {
+	if versions == nil {
+		return nil
+	}
+	copied := make([]MongoDbVersionConfig, len(versions))
+	for i, version := range versions {
+		copied[i] = version
+		if version.Builds != nil {
+			copied[i].Builds = make([]BuildConfig, len(version.Builds))
+			for j, build := range version.Builds {
+				copied[i].Builds[j] = build
+				copied[i].Builds[j].Modules = copyStrings(build.Modules)
+			}
+		}
+	}
+	return copied
+}
+
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	copied := make([]string, len(values))
+	copy(copied, values)
+	return copied
+}
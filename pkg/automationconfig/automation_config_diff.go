@@ -0,0 +1,47 @@
+package automationconfig
+
+import (
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/diff"
+)
+
+const redacted = diff.Redacted
+
+// sensitiveFields are the json keys whose values must never be logged or attached
+// to an event. Any change to them is still reported, but their values are redacted.
+var sensitiveFields = map[string]bool{
+	"key":              true,
+	"autoPwd":          true,
+	"scramSha1Creds":   true,
+	"scramSha256Creds": true,
+}
+
+// Change describes a single difference between two automation configs.
+type Change = diff.Change
+
+// Diff returns the list of structural changes between the previous and the current
+// automation config, ordered by path. Values of sensitive fields are redacted and
+// the top level version is ignored as it changes on every update.
+func Diff(previous, current AutomationConfig) ([]Change, error) {
+	previousTree, err := diff.ToTree(normalize(previous))
+	if err != nil {
+		return nil, err
+	}
+	currentTree, err := diff.ToTree(normalize(current))
+	if err != nil {
+		return nil, err
+	}
+	delete(previousTree, "version")
+	delete(currentTree, "version")
+	return diff.Trees(previousTree, currentTree, sensitiveFields), nil
+}
+
+// Redacted returns the automation config as a tree of maps and slices, with the values of the
+// sensitive fields redacted, so that it can be shared.
+func Redacted(ac AutomationConfig) (map[string]interface{}, error) {
+	tree, err := diff.ToTree(ac)
+	if err != nil {
+		return nil, err
+	}
+	diff.Redact(tree, sensitiveFields)
+	return tree, nil
+}
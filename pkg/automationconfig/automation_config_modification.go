@@ -0,0 +1,27 @@
+package automationconfig
+
+// Merge returns a Modification applying the given ones in order
+func Merge(modifications ...Modification) Modification {
+	return func(ac *AutomationConfig) {
+		for _, modification := range modifications {
+			modification(ac)
+		}
+	}
+}
+
+// If returns the modification if the condition is true, and NOOP otherwise
+func If(condition bool, modification Modification) Modification {
+	if condition {
+		return modification
+	}
+	return NOOP()
+}
+
+// ForEachProcess returns a Modification changing each process of the automation config with f
+func ForEachProcess(f func(process *Process)) Modification {
+	return func(ac *AutomationConfig) {
+		for i := range ac.Processes {
+			f(&ac.Processes[i])
+		}
+	}
+}
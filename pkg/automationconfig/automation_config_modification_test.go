@@ -0,0 +1,41 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	var applied []string
+	record := func(name string) Modification {
+		return func(*AutomationConfig) { applied = append(applied, name) }
+	}
+	ac := AutomationConfig{}
+	Merge(record("a"), Merge(record("b"), record("c")), NOOP())(&ac)
+	assert.Equal(t, []string{"a", "b", "c"}, applied, "the modifications are applied in order")
+
+	applied = nil
+	Merge()(&ac)
+	assert.Empty(t, applied)
+}
+
+func TestIf(t *testing.T) {
+	incrementVersion := func(config *AutomationConfig) {
+		config.Version += 1
+	}
+	ac := AutomationConfig{}
+	If(false, incrementVersion)(&ac)
+	assert.Equal(t, 0, ac.Version)
+	If(true, incrementVersion)(&ac)
+	assert.Equal(t, 1, ac.Version)
+}
+
+func TestForEachProcess(t *testing.T) {
+	ac := AutomationConfig{Processes: []Process{{Name: "my-rs-0"}, {Name: "my-rs-1"}}}
+	ForEachProcess(func(process *Process) {
+		process.Args26.Storage.DBPath = "/data/" + process.Name
+	})(&ac)
+	assert.Equal(t, "/data/my-rs-0", ac.Processes[0].Args26.Storage.DBPath)
+	assert.Equal(t, "/data/my-rs-1", ac.Processes[1].Args26.Storage.DBPath)
+}
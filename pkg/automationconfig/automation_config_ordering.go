@@ -0,0 +1,138 @@
+package automationconfig
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// normalize returns a copy of the given AutomationConfig in which every list whose order
+// has no meaning to the agent is sorted. Map keys don't need any special handling as
+// encoding/json always marshals them in sorted order.
+// This guarantees that two semantically equal automation configs are always serialized
+// to the same bytes, so the version is only incremented on real changes.
+func normalize(ac AutomationConfig) AutomationConfig {
+	ac.Processes = sortedProcesses(ac.Processes)
+	ac.ReplicaSets = sortedReplicaSets(ac.ReplicaSets)
+	ac.Versions = sortedVersions(ac.Versions)
+	ac.Auth = sortedAuth(ac.Auth)
+	return ac
+}
+
+func sortedProcesses(processes []Process) []Process {
+	if processes == nil {
+		return nil
+	}
+	sorted := make([]Process, len(processes))
+	copy(sorted, processes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return lessByOrdinal(sorted[i].Name, sorted[j].Name)
+	})
+	return sorted
+}
+
+func sortedReplicaSets(replicaSets []ReplicaSet) []ReplicaSet {
+	if replicaSets == nil {
+		return nil
+	}
+	sorted := make([]ReplicaSet, len(replicaSets))
+	copy(sorted, replicaSets)
+	for i := range sorted {
+		members := make([]ReplicaSetMember, len(sorted[i].Members))
+		copy(members, sorted[i].Members)
+		sort.SliceStable(members, func(a, b int) bool {
+			return members[a].Id < members[b].Id
+		})
+		if sorted[i].Members != nil {
+			sorted[i].Members = members
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Id < sorted[j].Id
+	})
+	return sorted
+}
+
+func sortedVersions(versions []MongoDbVersionConfig) []MongoDbVersionConfig {
+	if versions == nil {
+		return nil
+	}
+	sorted := make([]MongoDbVersionConfig, len(versions))
+	copy(sorted, versions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+func sortedAuth(auth Auth) Auth {
+	auth.AutoAuthMechanisms = sortedStrings(auth.AutoAuthMechanisms)
+	auth.DeploymentAuthMechanisms = sortedStrings(auth.DeploymentAuthMechanisms)
+	if auth.Users == nil {
+		return auth
+	}
+
+	users := make([]MongoDBUser, len(auth.Users))
+	copy(users, auth.Users)
+	for i := range users {
+		users[i].Mechanisms = sortedStrings(users[i].Mechanisms)
+		users[i].Roles = sortedRoles(users[i].Roles)
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].Database != users[j].Database {
+			return users[i].Database < users[j].Database
+		}
+		return users[i].Username < users[j].Username
+	})
+	auth.Users = users
+	return auth
+}
+
+func sortedRoles(roles []Role) []Role {
+	if roles == nil {
+		return nil
+	}
+	sorted := make([]Role, len(roles))
+	copy(sorted, roles)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Database != sorted[j].Database {
+			return sorted[i].Database < sorted[j].Database
+		}
+		return sorted[i].Role < sorted[j].Role
+	})
+	return sorted
+}
+
+func sortedStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	sorted := make([]string, len(s))
+	copy(sorted, s)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// lessByOrdinal compares two process names of the form "<name>-<ordinal>" so that
+// "my-rs-2" is ordered before "my-rs-10". Names without a numeric suffix are
+// compared lexicographically.
+func lessByOrdinal(a, b string) bool {
+	aPrefix, aOrdinal, aOk := splitOrdinal(a)
+	bPrefix, bOrdinal, bOk := splitOrdinal(b)
+	if aOk && bOk && aPrefix == bPrefix {
+		return aOrdinal < bOrdinal
+	}
+	return a < b
+}
+
+func splitOrdinal(name string) (string, int, bool) {
+	idx := strings.LastIndex(name, "-")
+	if idx == -1 {
+		return name, 0, false
+	}
+	ordinal, err := strconv.Atoi(name[idx+1:])
+	if err != nil {
+		return name, 0, false
+	}
+	return name[:idx], ordinal, true
+}
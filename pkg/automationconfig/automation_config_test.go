@@ -1,9 +1,13 @@
 package automationconfig
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scramcredentials"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/versions"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -189,3 +193,346 @@ func TestModifications(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 4, ac.Version)
 }
+
+func TestOrderingIsDeterministic(t *testing.T) {
+	userA := MongoDBUser{Username: "a", Database: "admin", Roles: []Role{{Role: "readWrite", Database: "test"}, {Role: "clusterAdmin", Database: "admin"}}}
+	userB := MongoDBUser{Username: "b", Database: "admin", Roles: []Role{{Role: "read", Database: "test"}}}
+
+	withUsers := func(users ...MongoDBUser) Modification {
+		return func(config *AutomationConfig) {
+			config.Auth.Users = users
+		}
+	}
+
+	ac, err := NewBuilder().
+		SetName("my-rs").
+		SetDomain("my-ns.svc.cluster.local").
+		SetMongoDBVersion("4.2.0").
+		SetMembers(11).
+		AddVersion(defaultMongoDbVersion("4.2.0")).
+		AddVersion(defaultMongoDbVersion("4.0.0")).
+		AddModifications(withUsers(userB, userA)).
+		Build()
+	assert.NoError(t, err)
+
+	t.Run("Lists are sorted", func(t *testing.T) {
+		assert.Equal(t, "my-rs-2", ac.Processes[2].Name)
+		assert.Equal(t, "my-rs-10", ac.Processes[10].Name)
+		assert.Equal(t, "4.0.0", ac.Versions[0].Name)
+		assert.Equal(t, "a", ac.Auth.Users[0].Username)
+		assert.Equal(t, "admin", ac.Auth.Users[0].Roles[0].Database)
+	})
+
+	t.Run("Re-ordering does not bump the version", func(t *testing.T) {
+		reordered := ac
+		reordered.Processes = []Process{ac.Processes[1], ac.Processes[0]}
+		reordered.Processes = append(reordered.Processes, ac.Processes[2:]...)
+
+		newAc, err := NewBuilder().
+			SetName("my-rs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("4.2.0").
+			SetMembers(11).
+			SetPreviousAutomationConfig(reordered).
+			AddVersion(defaultMongoDbVersion("4.0.0")).
+			AddVersion(defaultMongoDbVersion("4.2.0")).
+			AddModifications(withUsers(userA, userB)).
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, ac.Version, newAc.Version)
+	})
+}
+
+func TestVersionGates(t *testing.T) {
+	build := func(version, fcv string, modifications ...Modification) error {
+		_, err := NewBuilder().
+			SetName("my-rs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion(version).
+			SetFCV(fcv).
+			SetMembers(3).
+			AddModifications(modifications...).
+			Build()
+		return err
+	}
+
+	t.Run("FCV of the same or previous release series is accepted", func(t *testing.T) {
+		assert.NoError(t, build("4.2.6", "4.2"))
+		assert.NoError(t, build("4.2.6", "4.0"))
+	})
+
+	t.Run("FCV newer than the server is rejected", func(t *testing.T) {
+		err := build("4.0.6", "4.2")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "featureCompatibilityVersion 4.2 is not supported by MongoDB 4.0.6")
+	})
+
+	t.Run("FCV more than one release behind is rejected", func(t *testing.T) {
+		assert.Error(t, build("4.4.0", "4.0"))
+	})
+
+	t.Run("Invalid versions are rejected", func(t *testing.T) {
+		assert.Error(t, build("latest", ""))
+	})
+
+	t.Run("SCRAM-SHA-256 requires 4.0", func(t *testing.T) {
+		enableScram := func(config *AutomationConfig) {
+			config.Auth.Disabled = false
+			config.Auth.DeploymentAuthMechanisms = []string{"SCRAM-SHA-256"}
+		}
+		assert.NoError(t, build("4.0.6", "4.0", enableScram))
+		assert.Error(t, build("3.6.17", "3.6", enableScram))
+	})
+
+	t.Run("TLS options require 4.2", func(t *testing.T) {
+		withOptions := func(options string) Modification {
+			return ForEachProcess(func(p *Process) {
+				assert.NoError(t, json.Unmarshal([]byte(options), &p.Args26.Additional))
+			})
+		}
+		tests := []struct {
+			version string
+			fcv     string
+			options string
+			err     string
+		}{
+			{version: "4.0.28", fcv: "4.0", options: `{"net":{"tls":{"mode":"requireTLS"}}}`, err: "net.tls with mode requireTLS requires MongoDB 4.2 or later, got 4.0.28 which names it net.ssl"},
+			{version: "4.2.0", fcv: "4.2", options: `{"net":{"tls":{"mode":"requireTLS"}}}`},
+			{version: "4.0.28", fcv: "4.0", options: `{"net":{"tls":{"certificateKeyFile":"/certs/server.pem"}}}`, err: "net.tls requires MongoDB 4.2 or later, got 4.0.28 which names it net.ssl"},
+			{version: "4.2.0", fcv: "4.2", options: `{"net":{"tls":{"certificateKeyFile":"/certs/server.pem"}}}`},
+			{version: "4.0.28", fcv: "4.0", options: `{"setParameter":{"tlsWithholdClientCertificate":true}}`, err: "setParameter tlsWithholdClientCertificate requires MongoDB 4.2 or later, got 4.0.28 which names the tls parameters ssl"},
+			{version: "4.2.0", fcv: "4.2", options: `{"setParameter":{"tlsWithholdClientCertificate":true}}`},
+			{version: "4.0.28", fcv: "4.0", options: `{"net":{"ssl":{"PEMKeyFile":"/certs/server.pem"}}}`},
+		}
+		for _, tt := range tests {
+			err := build(tt.version, tt.fcv, withOptions(tt.options))
+			if tt.err == "" {
+				assert.NoError(t, err, tt.options)
+			} else if assert.Error(t, err, tt.options) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		}
+
+		// the TLS options set by the operator are named net.ssl before 4.2
+		err := build("4.0.28", "4.0", ForEachProcess(func(p *Process) {
+			p.Args26.Net.TLS = &MongoDBTLS{Mode: TLSModeRequired, PEMKeyFile: "/certs/server.pem"}
+		}))
+		assert.NoError(t, err)
+		p := newProcess("my-rs-0", "my-rs-0.my-ns", "4.0.28", "my-rs")
+		assert.EqualError(t, validateTLSNaming(AutomationConfig{}, p, versions.MustParse(p.Version)), "net.tls with mode disabled requires MongoDB 4.2 or later, got 4.0.28 which names it net.ssl")
+	})
+
+	t.Run("Parameters require the version introducing them", func(t *testing.T) {
+		tests := []struct {
+			version   string
+			fcv       string
+			parameter string
+			err       string
+		}{
+			{version: "4.4.29", fcv: "4.4", parameter: "allowDiskUseByDefault", err: "setParameter allowDiskUseByDefault requires MongoDB 6.0.0 or later, got 4.4.29"},
+			{version: "5.0.26", fcv: "5.0", parameter: "allowDiskUseByDefault", err: "setParameter allowDiskUseByDefault requires MongoDB 6.0.0 or later, got 5.0.26"},
+			{version: "6.0.0", fcv: "6.0", parameter: "allowDiskUseByDefault"},
+			{version: "4.4.29", fcv: "4.4", parameter: "internalQueryFrameworkControl", err: "setParameter internalQueryFrameworkControl requires MongoDB 6.0.0 or later, got 4.4.29"},
+			{version: "6.0.0", fcv: "6.0", parameter: "internalQueryFrameworkControl"},
+			{version: "4.2.24", fcv: "4.2", parameter: "mirrorReads", err: "setParameter mirrorReads requires MongoDB 4.4.0 or later, got 4.2.24"},
+			{version: "4.4.0", fcv: "4.4", parameter: "mirrorReads"},
+			{version: "4.4.29", fcv: "4.4", parameter: "cursorTimeoutMillis"},
+		}
+		for _, tt := range tests {
+			err := build(tt.version, tt.fcv, ForEachProcess(func(p *Process) {
+				p.Args26.Additional = map[string]interface{}{"setParameter": map[string]interface{}{tt.parameter: true}}
+			}))
+			if tt.err == "" {
+				assert.NoError(t, err, tt.version)
+			} else if assert.Error(t, err, tt.version) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		}
+	})
+}
+
+func TestVersionFamilies(t *testing.T) {
+	tests := []struct {
+		version string
+		fcv     string
+	}{
+		{version: "4.0.6", fcv: "4.0"},
+		{version: "4.2.8", fcv: "4.2"},
+		{version: "4.4.1", fcv: "4.4"},
+		{version: "5.0.14", fcv: "5.0"},
+		{version: "6.0.5", fcv: "6.0"},
+		{version: "7.0.2", fcv: "7.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			ac, err := NewBuilder().
+				SetName("my-rs").
+				SetDomain("my-ns.svc.cluster.local").
+				SetMongoDBVersion(tt.version).
+				SetFCV(tt.fcv).
+				SetMembers(3).
+				AddVersion(defaultMongoDbVersion(tt.version)).
+				Build()
+
+			assert.NoError(t, err)
+			assert.Len(t, ac.Processes, 3)
+			for _, p := range ac.Processes {
+				assert.Equal(t, tt.version, p.Version)
+				assert.Equal(t, tt.fcv, p.FeatureCompatibilityVersion)
+			}
+			assert.Equal(t, tt.version, ac.Versions[0].Name)
+		})
+	}
+
+	t.Run("Previous release series is accepted as FCV", func(t *testing.T) {
+		for _, tt := range tests[1:] {
+			_, err := NewBuilder().
+				SetName("my-rs").
+				SetMongoDBVersion(tt.version).
+				SetFCV(previousReleaseSeries[tt.fcv]).
+				SetMembers(3).
+				Build()
+			assert.NoError(t, err, tt.version)
+		}
+	})
+}
+
+func TestDiff(t *testing.T) {
+	build := func(version string, modifications ...Modification) AutomationConfig {
+		ac, err := NewBuilder().
+			SetName("my-rs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion(version).
+			SetMembers(3).
+			AddModifications(modifications...).
+			Build()
+		assert.NoError(t, err)
+		return ac
+	}
+
+	t.Run("Equal automation configs have no changes", func(t *testing.T) {
+		changes, err := Diff(build("4.2.2"), build("4.2.2"))
+		assert.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("Changed process fields are reported", func(t *testing.T) {
+		changes, err := Diff(build("4.2.2"), build("4.2.3"))
+		assert.NoError(t, err)
+		assert.Len(t, changes, 3)
+		for i, c := range changes {
+			assert.Equal(t, fmt.Sprintf("processes[%d].version", i), c.Path)
+			assert.Equal(t, "4.2.2", c.Old)
+			assert.Equal(t, "4.2.3", c.New)
+		}
+		assert.Equal(t, "processes[0].version: 4.2.2 -> 4.2.3", changes[0].String())
+	})
+
+	t.Run("Sensitive values are redacted", func(t *testing.T) {
+		enableAuth := func(config *AutomationConfig) {
+			config.Auth.Disabled = false
+			config.Auth.Key = "super-secret-key"
+			config.Auth.AutoPwd = "super-secret-password"
+			config.Auth.Users = []MongoDBUser{{
+				Username: "my-user",
+				Database: "admin",
+				ScramSha256Creds: &scramcredentials.ScramCreds{
+					IterationCount: 15000,
+					Salt:           "super-secret-salt",
+					ServerKey:      "super-secret-server-key",
+					StoredKey:      "super-secret-stored-key",
+				},
+			}}
+		}
+		changes, err := Diff(build("4.2.2"), build("4.2.2", enableAuth))
+		assert.NoError(t, err)
+
+		paths := map[string]Change{}
+		for _, c := range changes {
+			assert.False(t, strings.Contains(c.String(), "super-secret"), c.String())
+			paths[c.Path] = c
+		}
+		assert.Equal(t, redacted, paths["auth.key"].New)
+		assert.Equal(t, redacted, paths["auth.autoPwd"].New)
+		assert.Equal(t, redacted, paths["auth.usersWanted[0].scramSha256Creds.salt"].New)
+		assert.Equal(t, "my-user", paths["auth.usersWanted[0].user"].New)
+		assert.Equal(t, "false", paths["auth.disabled"].New)
+	})
+}
+
+func TestRedacted(t *testing.T) {
+	ac, err := NewBuilder().
+		SetName("my-rs").
+		SetDomain("my-ns.svc.cluster.local").
+		SetMongoDBVersion("4.2.2").
+		SetMembers(3).
+		AddModifications(func(config *AutomationConfig) {
+			config.Auth.Key = "super-secret-key"
+			config.Auth.Users = []MongoDBUser{{
+				Username:         "my-user",
+				Database:         "admin",
+				ScramSha256Creds: &scramcredentials.ScramCreds{IterationCount: 15000, Salt: "super-secret-salt"},
+			}}
+		}).
+		Build()
+	assert.NoError(t, err)
+
+	tree, err := Redacted(ac)
+	assert.NoError(t, err)
+	bytes, err := json.Marshal(tree)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(bytes), "super-secret")
+
+	auth := tree["auth"].(map[string]interface{})
+	assert.Equal(t, redacted, auth["key"])
+	user := auth["usersWanted"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "my-user", user["user"])
+	assert.Equal(t, redacted, user["scramSha256Creds"])
+}
+
+func TestDeepCopy(t *testing.T) {
+	ac, err := NewBuilder().
+		SetName("my-rs").
+		SetDomain("my-ns.svc.cluster.local").
+		SetMongoDBVersion("4.2.0").
+		SetMembers(3).
+		AddVersion(defaultMongoDbVersion("4.2.0")).
+		Build()
+	assert.NoError(t, err)
+	ac.Auth.Users = []MongoDBUser{{Username: "my-user", Roles: []Role{{Role: "readWrite", Database: "admin"}}, ScramSha256Creds: &scramcredentials.ScramCreds{Salt: "salt"}}}
+	ac.ToolsVersion.URLs = map[string]map[string]string{"linux": {"amd64": "some-url"}}
+	db := "admin"
+	ac.Roles = []CustomRole{{Role: "my-role", Database: "admin", Privileges: []Privilege{{Resource: Resource{Database: &db}, Actions: []string{"find"}}}, Roles: []Role{}}}
+	ac.ReplicaSets[0].Members[0].Horizons = map[string]string{"external": "my-rs-0.example.com:27017"}
+	ac.Processes[0].Args26.Additional = map[string]interface{}{"setParameter": map[string]interface{}{"cursorTimeoutMillis": 600000.0}}
+
+	copied := ac.DeepCopy()
+	assert.Equal(t, ac, copied)
+	acBytes, _ := json.Marshal(ac)
+	copiedBytes, _ := json.Marshal(copied)
+	assert.JSONEq(t, string(acBytes), string(copiedBytes), "nil and empty slices are kept")
+
+	copied.Processes[0].Version = "4.4.0"
+	copied.Processes[0].Args26.Net.TLS.Mode = TLSModeRequired
+	copied.Processes[0].Args26.Additional["setParameter"].(map[string]interface{})["cursorTimeoutMillis"] = 0.0
+	copied.ReplicaSets[0].Members[0].Votes = 0
+	copied.ReplicaSets[0].Members[0].Horizons["external"] = "other:27017"
+	copied.Auth.Users[0].Roles[0].Role = "read"
+	copied.Auth.Users[0].ScramSha256Creds.Salt = "other-salt"
+	copied.Versions[0].Builds[0].Modules = append(copied.Versions[0].Builds[0].Modules, "enterprise")
+	copied.ToolsVersion.URLs["linux"]["amd64"] = "other-url"
+	copied.Roles[0].Privileges[0].Actions[0] = "insert"
+	*copied.Roles[0].Privileges[0].Resource.Database = "local"
+	assert.Equal(t, "4.2.0", ac.Processes[0].Version)
+	assert.Equal(t, TLSModeDisabled, ac.Processes[0].Args26.Net.TLS.Mode)
+	assert.Equal(t, 600000.0, ac.Processes[0].Args26.Additional["setParameter"].(map[string]interface{})["cursorTimeoutMillis"])
+	assert.Equal(t, 1, ac.ReplicaSets[0].Members[0].Votes)
+	assert.Equal(t, "my-rs-0.example.com:27017", ac.ReplicaSets[0].Members[0].Horizons["external"])
+	assert.Equal(t, "readWrite", ac.Auth.Users[0].Roles[0].Role)
+	assert.Equal(t, "salt", ac.Auth.Users[0].ScramSha256Creds.Salt)
+	assert.Empty(t, ac.Versions[0].Builds[0].Modules)
+	assert.Equal(t, "some-url", ac.ToolsVersion.URLs["linux"]["amd64"])
+	assert.Equal(t, "find", ac.Roles[0].Privileges[0].Actions[0])
+	assert.Equal(t, "admin", *ac.Roles[0].Privileges[0].Resource.Database)
+}
@@ -0,0 +1,118 @@
+package automationconfig
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/versions"
+)
+
+// argumentTranslation maps the arguments of the processes running a MongoDB version at least since
+// and before until, when set, to the options that version supports
+type argumentTranslation struct {
+	since     string
+	until     string
+	translate func(args *Args26) error
+}
+
+// argumentTranslations are applied in order to the arguments of every process once all the
+// modifications are applied, so that the modifications only deal with the options of the latest
+// release series. The options which can't be translated are rejected with a precise message.
+var argumentTranslations = []argumentTranslation{
+	// net.tls and its modes were named net.ssl before 4.2
+	{until: "4.2.0", translate: tlsToSSL},
+	{since: "4.2.0", translate: removedValue("storage.engine", "mmapv1", "4.2")},
+	// the log is structured JSON since 4.4, whose timestamps can't have the ctime format, it
+	// falls back to the default iso8601-local format
+	{since: "4.4.0", translate: droppedValue("systemLog.timeStampFormat", "ctime")},
+	{since: "5.0.0", translate: removedOption("net.serviceExecutor", "synchronous", "5.0")},
+	// journaling is always enabled since 6.1
+	{since: "6.1.0", translate: removedOption("storage.journal.enabled", true, "6.1")},
+}
+
+// translateProcessArgs applies the translations of the version of the process to its arguments.
+// The version is validated by Validate.
+func translateProcessArgs(p *Process) error {
+	v, err := versions.Parse(p.Version)
+	if err != nil {
+		return nil
+	}
+	// the additional options may be shared with the other processes
+	if p.Args26.Additional != nil {
+		p.Args26.Additional = copyOptions(p.Args26.Additional)
+	}
+	for _, translation := range argumentTranslations {
+		if translation.since != "" && v.LessThan(versions.MustParse(translation.since)) {
+			continue
+		}
+		if translation.until != "" && !v.LessThan(versions.MustParse(translation.until)) {
+			continue
+		}
+		if err := translation.translate(&p.Args26); err != nil {
+			return fmt.Errorf("process %s: %s", p.Name, err)
+		}
+	}
+	return nil
+}
+
+var sslModes = map[TLSMode]SSLMode{
+	TLSModeDisabled:  SSLModeDisabled,
+	TLSModeAllowed:   SSLModeAllowed,
+	TLSModePreferred: SSLModePreferred,
+	TLSModeRequired:  SSLModeRequired,
+}
+
+func tlsToSSL(args *Args26) error {
+	tls := args.Net.TLS
+	if tls == nil {
+		return nil
+	}
+	mode, ok := sslModes[tls.Mode]
+	if !ok {
+		return fmt.Errorf("unknown TLS mode %s", tls.Mode)
+	}
+	args.Net.SSL = &MongoDBSSL{
+		Mode:                               mode,
+		PEMKeyFile:                         tls.PEMKeyFile,
+		CAFile:                             tls.CAFile,
+		AllowConnectionsWithoutCertificate: tls.AllowConnectionsWithoutCertificate,
+	}
+	args.Net.TLS = nil
+	return nil
+}
+
+// droppedValue drops the option when it has the value, which the versions no longer support
+func droppedValue(path string, value interface{}) func(*Args26) error {
+	return func(args *Args26) error {
+		if current, ok := lookupOption(args.Additional, path); ok && reflect.DeepEqual(current, value) {
+			deleteOption(args.Additional, path)
+		}
+		return nil
+	}
+}
+
+// removedValue rejects the option when it has the value, which was removed in the release series
+func removedValue(path string, value interface{}, series string) func(*Args26) error {
+	return func(args *Args26) error {
+		if current, ok := lookupOption(args.Additional, path); ok && reflect.DeepEqual(current, value) {
+			return fmt.Errorf("%s %v was removed in MongoDB %s", path, value, series)
+		}
+		return nil
+	}
+}
+
+// removedOption handles an option removed in the release series: it is dropped when it has the
+// value the versions always behave with, and rejected otherwise
+func removedOption(path string, implied interface{}, series string) func(*Args26) error {
+	return func(args *Args26) error {
+		current, ok := lookupOption(args.Additional, path)
+		if !ok {
+			return nil
+		}
+		if !reflect.DeepEqual(current, implied) {
+			return fmt.Errorf("%s was removed in MongoDB %s, which always behaves as if it was %v", path, series, implied)
+		}
+		deleteOption(args.Additional, path)
+		return nil
+	}
+}
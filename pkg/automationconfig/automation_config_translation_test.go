@@ -0,0 +1,237 @@
+package automationconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgs26Serialization(t *testing.T) {
+	args := newProcess("my-rs-0", "my-rs-0.my-ns", "4.2.0", "my-rs").Args26
+
+	t.Run("Only the fields are serialized without additional options", func(t *testing.T) {
+		data, err := json.Marshal(args)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"net":{"port":27017,"tls":{"mode":"disabled","allowConnectionsWithoutCertificates":false}},"security":{},"storage":{"dbPath":"/data"},"replication":{"replSetName":"my-rs"}}`, string(data))
+
+		read := Args26{}
+		assert.NoError(t, json.Unmarshal(data, &read))
+		assert.Equal(t, args, read)
+	})
+
+	t.Run("The fields take precedence over the additional options", func(t *testing.T) {
+		args := args.deepCopy()
+		args.Additional = map[string]interface{}{
+			"net":          map[string]interface{}{"port": 27018.0, "bindIpAll": true},
+			"setParameter": map[string]interface{}{"cursorTimeoutMillis": 600000.0},
+		}
+		data, err := json.Marshal(args)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"net":{"port":27017,"bindIpAll":true,"tls":{"mode":"disabled","allowConnectionsWithoutCertificates":false}},"security":{},"storage":{"dbPath":"/data"},"replication":{"replSetName":"my-rs"},"setParameter":{"cursorTimeoutMillis":600000}}`, string(data))
+
+		read := Args26{}
+		assert.NoError(t, json.Unmarshal(data, &read))
+		assert.Equal(t, map[string]interface{}{
+			"net":          map[string]interface{}{"bindIpAll": true},
+			"setParameter": map[string]interface{}{"cursorTimeoutMillis": 600000.0},
+		}, read.Additional, "only the options without a field are additional")
+		readData, err := json.Marshal(read)
+		assert.NoError(t, err)
+		assert.Equal(t, string(data), string(readData))
+	})
+}
+
+func TestTranslateProcessArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    string
+		additional map[string]interface{}
+		expected   map[string]interface{}
+		err        string
+	}{
+		{
+			name:       "Unchanged options are kept",
+			version:    "7.0.2",
+			additional: map[string]interface{}{"setParameter": map[string]interface{}{"cursorTimeoutMillis": 600000.0}},
+			expected:   map[string]interface{}{"setParameter": map[string]interface{}{"cursorTimeoutMillis": 600000.0}},
+		},
+		{
+			name:       "The ctime timestamps are kept before the structured log",
+			version:    "4.2.8",
+			additional: map[string]interface{}{"systemLog": map[string]interface{}{"timeStampFormat": "ctime"}},
+			expected:   map[string]interface{}{"systemLog": map[string]interface{}{"timeStampFormat": "ctime"}},
+		},
+		{
+			name:       "The ctime timestamps are dropped with the structured log",
+			version:    "4.4.0",
+			additional: map[string]interface{}{"systemLog": map[string]interface{}{"timeStampFormat": "ctime", "verbosity": 1.0}},
+			expected:   map[string]interface{}{"systemLog": map[string]interface{}{"verbosity": 1.0}},
+		},
+		{
+			name:       "The ISO 8601 timestamps are kept with the structured log",
+			version:    "4.4.0",
+			additional: map[string]interface{}{"systemLog": map[string]interface{}{"timeStampFormat": "iso8601-utc"}},
+			expected:   map[string]interface{}{"systemLog": map[string]interface{}{"timeStampFormat": "iso8601-utc"}},
+		},
+		{
+			name:       "The service executor is kept before 5.0",
+			version:    "4.4.18",
+			additional: map[string]interface{}{"net": map[string]interface{}{"serviceExecutor": "adaptive"}},
+			expected:   map[string]interface{}{"net": map[string]interface{}{"serviceExecutor": "adaptive"}},
+		},
+		{
+			name:       "The synchronous service executor is dropped since 5.0",
+			version:    "5.0.0",
+			additional: map[string]interface{}{"net": map[string]interface{}{"serviceExecutor": "synchronous"}},
+			expected:   nil,
+		},
+		{
+			name:       "The adaptive service executor is rejected since 5.0",
+			version:    "5.0.0",
+			additional: map[string]interface{}{"net": map[string]interface{}{"serviceExecutor": "adaptive"}},
+			err:        "process my-rs-0: net.serviceExecutor was removed in MongoDB 5.0, which always behaves as if it was synchronous",
+		},
+		{
+			name:       "Journaling can be disabled before 6.1",
+			version:    "6.0.5",
+			additional: map[string]interface{}{"storage": map[string]interface{}{"journal": map[string]interface{}{"enabled": false}}},
+			expected:   map[string]interface{}{"storage": map[string]interface{}{"journal": map[string]interface{}{"enabled": false}}},
+		},
+		{
+			name:       "Enabling journaling is dropped since 6.1",
+			version:    "7.0.2",
+			additional: map[string]interface{}{"storage": map[string]interface{}{"journal": map[string]interface{}{"enabled": true, "commitIntervalMs": 100.0}}},
+			expected:   map[string]interface{}{"storage": map[string]interface{}{"journal": map[string]interface{}{"commitIntervalMs": 100.0}}},
+		},
+		{
+			name:       "Disabling journaling is rejected since 6.1",
+			version:    "6.1.0",
+			additional: map[string]interface{}{"storage": map[string]interface{}{"journal": map[string]interface{}{"enabled": false}}},
+			err:        "process my-rs-0: storage.journal.enabled was removed in MongoDB 6.1, which always behaves as if it was true",
+		},
+		{
+			name:       "MMAPv1 is rejected since 4.2",
+			version:    "4.2.0",
+			additional: map[string]interface{}{"storage": map[string]interface{}{"engine": "mmapv1"}},
+			err:        "process my-rs-0: storage.engine mmapv1 was removed in MongoDB 4.2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProcess("my-rs-0", "my-rs-0.my-ns", tt.version, "my-rs")
+			p.Args26.Additional = tt.additional
+			err := translateProcessArgs(&p)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.expected == nil {
+				assert.Empty(t, p.Args26.Additional)
+			} else {
+				assert.Equal(t, tt.expected, p.Args26.Additional)
+			}
+		})
+	}
+
+	t.Run("The options shared with other processes aren't changed", func(t *testing.T) {
+		shared := map[string]interface{}{"net": map[string]interface{}{"serviceExecutor": "synchronous"}}
+		p := newProcess("my-rs-0", "my-rs-0.my-ns", "5.0.0", "my-rs")
+		p.Args26.Additional = shared
+		assert.NoError(t, translateProcessArgs(&p))
+		assert.Equal(t, map[string]interface{}{"net": map[string]interface{}{"serviceExecutor": "synchronous"}}, shared)
+	})
+}
+
+func TestTranslateProcessArgs_TLSIsNamedSSLBefore42(t *testing.T) {
+	tls := &MongoDBTLS{Mode: TLSModePreferred, PEMKeyFile: "/certs/server.pem", CAFile: "/certs/ca.crt", AllowConnectionsWithoutCertificate: true}
+
+	p := newProcess("my-rs-0", "my-rs-0.my-ns", "4.0.6", "my-rs")
+	p.Args26.Net.TLS = tls
+	assert.NoError(t, translateProcessArgs(&p))
+	assert.Nil(t, p.Args26.Net.TLS)
+	assert.Equal(t, &MongoDBSSL{Mode: SSLModePreferred, PEMKeyFile: "/certs/server.pem", CAFile: "/certs/ca.crt", AllowConnectionsWithoutCertificate: true}, p.Args26.Net.SSL)
+	data, err := json.Marshal(p.Args26.Net)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"port":27017,"ssl":{"mode":"preferSSL","PEMKeyFile":"/certs/server.pem","CAFile":"/certs/ca.crt","allowConnectionsWithoutCertificates":true}}`, string(data))
+
+	p = newProcess("my-rs-0", "my-rs-0.my-ns", "4.2.0", "my-rs")
+	p.Args26.Net.TLS = tls
+	assert.NoError(t, translateProcessArgs(&p))
+	assert.Equal(t, tls, p.Args26.Net.TLS)
+	assert.Nil(t, p.Args26.Net.SSL)
+}
+
+func TestUpgradePath(t *testing.T) {
+	additional := map[string]interface{}{
+		"net":          map[string]interface{}{"serviceExecutor": "synchronous"},
+		"storage":      map[string]interface{}{"journal": map[string]interface{}{"enabled": true}},
+		"setParameter": map[string]interface{}{"cursorTimeoutMillis": 600000.0},
+	}
+	build := func(previous AutomationConfig, version, fcv string) (AutomationConfig, error) {
+		return NewBuilder().
+			SetName("my-rs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion(version).
+			SetFCV(fcv).
+			SetMembers(3).
+			SetPreviousAutomationConfig(previous).
+			AddVersion(defaultMongoDbVersion(version)).
+			AddModifications(ForEachProcess(func(p *Process) {
+				p.Args26.Additional = additional
+			})).
+			Build()
+	}
+
+	// the binaries are upgraded first with the FCV of the previous release series, which is
+	// then upgraded once the replica set runs the new version
+	steps := []struct {
+		version string
+		fcv     string
+		journal bool
+	}{
+		{version: "5.0.14", fcv: "5.0", journal: true},
+		{version: "6.0.5", fcv: "5.0", journal: true},
+		{version: "6.0.5", fcv: "6.0", journal: true},
+		{version: "7.0.2", fcv: "6.0", journal: false},
+		{version: "7.0.2", fcv: "7.0", journal: false},
+	}
+	ac := AutomationConfig{}
+	for _, step := range steps {
+		previous := ac
+		var err error
+		ac, err = build(previous, step.version, step.fcv)
+		assert.NoError(t, err, step.version)
+		assert.Equal(t, previous.Version+1, ac.Version, step.version)
+		for _, p := range ac.Processes {
+			assert.Equal(t, step.version, p.Version)
+			assert.Equal(t, step.fcv, p.FeatureCompatibilityVersion)
+			_, hasServiceExecutor := lookupOption(p.Args26.Additional, "net.serviceExecutor")
+			assert.False(t, hasServiceExecutor, "net.serviceExecutor was removed in 5.0")
+			_, hasJournal := lookupOption(p.Args26.Additional, "storage.journal.enabled")
+			assert.Equal(t, step.journal, hasJournal, step.version)
+			cursorTimeout, _ := lookupOption(p.Args26.Additional, "setParameter.cursorTimeoutMillis")
+			assert.Equal(t, 600000.0, cursorTimeout)
+		}
+
+		// the automation config read back from its ConfigMap is built to the same version
+		data, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		read := AutomationConfig{}
+		assert.NoError(t, json.Unmarshal(data, &read))
+		rebuilt, err := build(read, step.version, step.fcv)
+		assert.NoError(t, err)
+		assert.Equal(t, ac.Version, rebuilt.Version, step.version)
+	}
+
+	t.Run("A release series can't be skipped", func(t *testing.T) {
+		_, err := build(AutomationConfig{}, "7.0.2", "5.0")
+		assert.Error(t, err)
+	})
+
+	t.Run("8.0 is not a known release series yet", func(t *testing.T) {
+		_, err := build(ac, "8.0.0", "7.0")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,157 @@
+package automationconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/versions"
+)
+
+const (
+	scramSha256 = "SCRAM-SHA-256"
+)
+
+// previousReleaseSeries maps each release series to the one preceding it.
+// A server can only run with a featureCompatibilityVersion of either its own
+// release series or the previous one.
+var previousReleaseSeries = map[string]string{
+	"3.6": "3.4",
+	"4.0": "3.6",
+	"4.2": "4.0",
+	"4.4": "4.2",
+	"5.0": "4.4",
+	"6.0": "5.0",
+	"7.0": "6.0",
+}
+
+// versionGate validates a single process of the automation config against the MongoDB
+// version the process is going to run. It returns a descriptive error if the generated
+// options are not supported by that version.
+type versionGate func(ac AutomationConfig, process Process, version versions.MongoDBVersion) error
+
+var versionGates = []versionGate{
+	validateFeatureCompatibilityVersion,
+	validateScramSha256,
+	validateTLSNaming,
+	validateParameters,
+}
+
+// parametersSince are the server parameters introduced after MongoDB 4.0, with the first version
+// supporting them. mongod doesn't start with a parameter it doesn't know.
+var parametersSince = map[string]string{
+	"enableFlowControl":                            "4.2.0",
+	"mirrorReads":                                  "4.4.0",
+	"minSnapshotHistoryWindowInSeconds":            "5.0.0",
+	"allowDiskUseByDefault":                        "6.0.0",
+	"internalQueryFrameworkControl":                "6.0.0",
+	"queryAnalysisSamplerConfigurationRefreshSecs": "7.0.0",
+}
+
+// Validate ensures that every option configured for a process is supported by the
+// MongoDB version that process runs. Failing early with a precise message is preferred
+// over handing the agent a goal state it can never reach.
+func Validate(ac AutomationConfig) error {
+	var errs error
+	for _, p := range ac.Processes {
+		v, err := versions.Parse(p.Version)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("process %s: %s", p.Name, err))
+			continue
+		}
+		for _, gate := range versionGates {
+			if err := gate(ac, p, v); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("process %s: %s", p.Name, err))
+			}
+		}
+	}
+	return errs
+}
+
+func validateFeatureCompatibilityVersion(_ AutomationConfig, p Process, v versions.MongoDBVersion) error {
+	fcv := p.FeatureCompatibilityVersion
+	if fcv == "" || SupportsFeatureCompatibilityVersion(v, fcv) {
+		return nil
+	}
+	return fmt.Errorf("featureCompatibilityVersion %s is not supported by MongoDB %s", fcv, v)
+}
+
+// SupportsFeatureCompatibilityVersion returns true if MongoDB can run with the given
+// featureCompatibilityVersion, which is the case for its own release series and the previous one.
+func SupportsFeatureCompatibilityVersion(v versions.MongoDBVersion, fcv string) bool {
+	if fcv == v.MajorMinor() {
+		return true
+	}
+	previous, ok := previousReleaseSeries[v.MajorMinor()]
+	return ok && previous == fcv
+}
+
+func validateScramSha256(ac AutomationConfig, _ Process, v versions.MongoDBVersion) error {
+	if ac.Auth.Disabled || !hasMechanism(ac.Auth.DeploymentAuthMechanisms, scramSha256) {
+		return nil
+	}
+	if v.LessThan(versions.MustParse("4.0.0")) {
+		return fmt.Errorf("%s authentication requires MongoDB 4.0 or later, got %s", scramSha256, v)
+	}
+	return nil
+}
+
+func hasMechanism(mechanisms []string, mechanism string) bool {
+	for _, m := range mechanisms {
+		if m == mechanism {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTLSNaming rejects the tls options before MongoDB 4.2, which named them ssl: net.tls and
+// its requireTLS mode were net.ssl and requireSSL, and the tls parameters were ssl ones.
+func validateTLSNaming(_ AutomationConfig, p Process, v versions.MongoDBVersion) error {
+	if !v.LessThan(versions.MustParse("4.2.0")) {
+		return nil
+	}
+	options, err := p.Args26.options()
+	if err != nil {
+		return err
+	}
+	if mode, ok := lookupOption(options, "net.tls.mode"); ok {
+		return fmt.Errorf("net.tls with mode %v requires MongoDB 4.2 or later, got %s which names it net.ssl", mode, v)
+	}
+	if _, ok := lookupOption(options, "net.tls"); ok {
+		return fmt.Errorf("net.tls requires MongoDB 4.2 or later, got %s which names it net.ssl", v)
+	}
+	for _, name := range parameterNames(options) {
+		if strings.HasPrefix(name, "tls") {
+			return fmt.Errorf("setParameter %s requires MongoDB 4.2 or later, got %s which names the tls parameters ssl", name, v)
+		}
+	}
+	return nil
+}
+
+// validateParameters rejects the server parameters introduced after the version of the process
+func validateParameters(_ AutomationConfig, p Process, v versions.MongoDBVersion) error {
+	options, err := p.Args26.options()
+	if err != nil {
+		return err
+	}
+	for _, name := range parameterNames(options) {
+		since, ok := parametersSince[name]
+		if ok && v.LessThan(versions.MustParse(since)) {
+			return fmt.Errorf("setParameter %s requires MongoDB %s or later, got %s", name, since, v)
+		}
+	}
+	return nil
+}
+
+// parameterNames returns the sorted names of the setParameter options
+func parameterNames(options map[string]interface{}) []string {
+	parameters, _ := options["setParameter"].(map[string]interface{})
+	var names []string
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
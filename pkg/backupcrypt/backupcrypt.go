@@ -0,0 +1,232 @@
+// Package backupcrypt encrypts and decrypts the archives of the backups as a stream, with AES-256-GCM.
+//
+// The stream starts with a header made of a magic string, the version of the format and a random
+// nonce prefix, followed by chunks of at most chunkSize bytes of plaintext, each sealed separately and
+// prefixed with the length of its ciphertext. The nonce of a chunk is the nonce prefix, the counter of
+// the chunk and a flag set on the last chunk only, so that chunks can't be reordered, and a truncated
+// stream is detected as it doesn't end with the last chunk. The header is authenticated with every
+// chunk.
+package backupcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// KeySize is the size of the keys, in bytes
+	KeySize = 32
+
+	magic          = "MDBCRYPT"
+	version        = 1
+	noncePrefixLen = 7
+	headerLen      = len(magic) + 1 + noncePrefixLen
+
+	chunkSize = 64 * 1024
+	lengthLen = 4
+	maxChunks = 1<<32 - 1
+)
+
+var (
+	// ErrTruncated is returned when the stream ends before its last chunk
+	ErrTruncated = errors.New("the encrypted stream is truncated")
+	// ErrAuthentication is returned when a chunk can't be decrypted, because the key is wrong or the
+	// stream was modified
+	ErrAuthentication = errors.New("the encrypted stream can't be authenticated, the key is wrong or the stream was modified")
+)
+
+// ParseKey returns the key encoded in base64 in the given string
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("the key must be encoded in base64: %s", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("the key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(header []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[len(magic)+1:])
+	binary.BigEndian.PutUint32(nonce[noncePrefixLen:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint32
+	closed  bool
+}
+
+// NewWriter returns a writer encrypting what is written to it with the given key to w. It must be
+// closed to write the last chunk, without which the stream is truncated.
+func NewWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerLen)
+	copy(header, magic)
+	header[len(magic)] = version
+	if _, err := io.ReadFull(rand.Reader, header[len(magic)+1:]); err != nil {
+		return nil, fmt.Errorf("error generating the nonce: %s", err)
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &writer{w: w, aead: aead, header: header, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to a closed writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data comes, as the last chunk is sealed differently
+		if len(w.buf) == chunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *writer) seal(last bool) error {
+	if w.counter == maxChunks {
+		return errors.New("the stream is too long")
+	}
+	sealed := w.aead.Seal(make([]byte, lengthLen, lengthLen+len(w.buf)+w.aead.Overhead()), chunkNonce(w.header, w.counter, last), w.buf, w.header)
+	binary.BigEndian.PutUint32(sealed, uint32(len(sealed)-lengthLen))
+	if _, err := w.w.Write(sealed); err != nil {
+		return err
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes the last chunk, it doesn't close the underlying writer
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+type reader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint32
+	done    bool
+	err     error
+}
+
+// NewReader returns a reader decrypting the stream read from r with the given key. Only authenticated
+// chunks are returned, and reading fails with ErrTruncated if the stream ends before its last chunk.
+func NewReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncated
+		}
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, errors.New("the stream isn't encrypted")
+	}
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("unsupported version %d of the encrypted stream", header[len(magic)])
+	}
+	return &reader{r: r, aead: aead, header: header}, nil
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.open()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk
+func (r *reader) open() error {
+	if r.counter == maxChunks {
+		return ErrAuthentication
+	}
+	length := make([]byte, lengthLen)
+	if _, err := io.ReadFull(r.r, length); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
+	sealedLen := binary.BigEndian.Uint32(length)
+	if sealedLen < uint32(r.aead.Overhead()) || sealedLen > uint32(chunkSize+r.aead.Overhead()) {
+		return ErrAuthentication
+	}
+	sealed := make([]byte, sealedLen)
+	if _, err := io.ReadFull(r.r, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
+	// the chunk isn't decrypted in place, as the ciphertext is needed again if it's the last one
+	plaintext, err := r.aead.Open(nil, chunkNonce(r.header, r.counter, false), sealed, r.header)
+	if err != nil {
+		if plaintext, err = r.aead.Open(nil, chunkNonce(r.header, r.counter, true), sealed, r.header); err != nil {
+			return ErrAuthentication
+		}
+		// nothing may follow the last chunk
+		if _, err := io.ReadFull(r.r, make([]byte, 1)); err != io.EOF {
+			return ErrAuthentication
+		}
+		r.done = true
+	}
+	r.counter++
+	r.buf = plaintext
+	return nil
+}
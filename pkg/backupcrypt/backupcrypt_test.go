@@ -0,0 +1,105 @@
+package backupcrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newKey(t *testing.T) []byte {
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	return key
+}
+
+func encrypt(t *testing.T, key, plaintext []byte) []byte {
+	encrypted := bytes.Buffer{}
+	w, err := NewWriter(&encrypted, key)
+	assert.NoError(t, err)
+	// written in small pieces, so that the chunks are filled across writes
+	for len(plaintext) > 0 {
+		n := 1000
+		if n > len(plaintext) {
+			n = len(plaintext)
+		}
+		_, err = w.Write(plaintext[:n])
+		assert.NoError(t, err)
+		plaintext = plaintext[n:]
+	}
+	assert.NoError(t, w.Close())
+	return encrypted.Bytes()
+}
+
+func decrypt(key, encrypted []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := newKey(t)
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plaintext := make([]byte, size)
+		_, _ = rand.Read(plaintext)
+		decrypted, err := decrypt(key, encrypt(t, key, plaintext))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(plaintext, decrypted), "size %d", size)
+	}
+}
+
+func TestDecrypt_RejectsAModifiedStream(t *testing.T) {
+	key := newKey(t)
+	encrypted := encrypt(t, key, make([]byte, 2*chunkSize))
+	encrypted[headerLen+lengthLen+10] ^= 1
+	_, err := decrypt(key, encrypted)
+	assert.Equal(t, ErrAuthentication, err)
+
+	_, err = decrypt(newKey(t), encrypt(t, key, []byte("archive")))
+	assert.Equal(t, ErrAuthentication, err, "the key is wrong")
+
+	_, err = decrypt(key, append(encrypt(t, key, []byte("archive")), 0))
+	assert.Equal(t, ErrAuthentication, err, "data follows the last chunk")
+}
+
+func TestDecrypt_RejectsATruncatedStream(t *testing.T) {
+	key := newKey(t)
+	encrypted := encrypt(t, key, make([]byte, 2*chunkSize+10))
+	firstChunkEnd := headerLen + lengthLen + chunkSize + 16
+
+	r, err := NewReader(bytes.NewReader(encrypted[:firstChunkEnd]), key)
+	assert.NoError(t, err)
+	decrypted, err := ioutil.ReadAll(r)
+	assert.Equal(t, ErrTruncated, err)
+	assert.Len(t, decrypted, chunkSize, "the authenticated chunks are returned")
+
+	_, err = decrypt(key, encrypted[:firstChunkEnd+100])
+	assert.Equal(t, ErrTruncated, err)
+
+	_, err = decrypt(key, encrypted[:headerLen-1])
+	assert.Equal(t, ErrTruncated, err)
+}
+
+func TestDecrypt_RejectsAStreamWhichIsntEncrypted(t *testing.T) {
+	_, err := NewReader(bytes.NewReader(bytes.Repeat([]byte{0}, 100)), newKey(t))
+	assert.EqualError(t, err, "the stream isn't encrypted")
+}
+
+func TestParseKey(t *testing.T) {
+	key := newKey(t)
+	parsed, err := ParseKey(base64.StdEncoding.EncodeToString(key) + "\n")
+	assert.NoError(t, err)
+	assert.Equal(t, key, parsed)
+
+	_, err = ParseKey(base64.StdEncoding.EncodeToString(key[:16]))
+	assert.EqualError(t, err, "the key must be 32 bytes, got 16")
+
+	_, err = ParseKey("not base64")
+	assert.Error(t, err)
+}
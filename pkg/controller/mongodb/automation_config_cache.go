@@ -0,0 +1,61 @@
+package mongodb
+
+import (
+	"sync"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// parsedAutomationConfigs holds the automation config last parsed for each resource, so that a large
+// automation config isn't decompressed and unmarshaled again at every reconciliation
+var parsedAutomationConfigs = newAutomationConfigCache()
+
+// automationConfigCache holds the automation configs parsed from the ConfigMaps, along with the
+// resource version of the ConfigMap they were parsed from. A ConfigMap without a resource version
+// is never cached.
+type automationConfigCache struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]cachedAutomationConfig
+}
+
+type cachedAutomationConfig struct {
+	resourceVersion string
+	ac              automationconfig.AutomationConfig
+}
+
+func newAutomationConfigCache() *automationConfigCache {
+	return &automationConfigCache{entries: map[types.NamespacedName]cachedAutomationConfig{}}
+}
+
+// get returns a copy of the automation config parsed from the given version of the ConfigMap, if
+// it's cached
+func (c *automationConfigCache) get(nsName types.NamespacedName, resourceVersion string) (automationconfig.AutomationConfig, bool) {
+	if resourceVersion == "" {
+		return automationconfig.AutomationConfig{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[nsName]
+	if !ok || cached.resourceVersion != resourceVersion {
+		return automationconfig.AutomationConfig{}, false
+	}
+	return cached.ac.DeepCopy(), true
+}
+
+// set caches a copy of the automation config parsed from the given version of the ConfigMap
+func (c *automationConfigCache) set(nsName types.NamespacedName, resourceVersion string, ac automationconfig.AutomationConfig) {
+	if resourceVersion == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[nsName] = cachedAutomationConfig{resourceVersion: resourceVersion, ac: ac.DeepCopy()}
+}
+
+// delete forgets the automation config of a ConfigMap which doesn't exist anymore
+func (c *automationConfigCache) delete(nsName types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, nsName)
+}
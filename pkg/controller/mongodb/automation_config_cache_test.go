@@ -0,0 +1,45 @@
+package mongodb
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestGetCurrentAutomationConfig_IsCachedByResourceVersion(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	nsName := types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}
+	defer parsedAutomationConfigs.delete(nsName)
+
+	cm, err := automationConfigConfigMap(mdb, automationconfig.AutomationConfig{Version: 1})
+	assert.NoError(t, err)
+	cm.ResourceVersion = "100"
+	assert.NoError(t, c.CreateConfigMap(cm))
+	ac, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ac.Version)
+
+	ac.Version = 5
+	cm.Data[AutomationConfigKey] = `{"version":2}`
+	assert.NoError(t, c.UpdateConfigMap(cm))
+	ac, _ = getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, 1, ac.Version, "the automation config isn't parsed again while its ConfigMap doesn't change")
+
+	cm.ResourceVersion = "101"
+	assert.NoError(t, c.UpdateConfigMap(cm))
+	ac, _ = getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, 2, ac.Version)
+
+	assert.NoError(t, c.DeleteConfigMap(nsName))
+	ac, err = getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+	assert.Zero(t, ac.Version)
+	_, ok := parsedAutomationConfigs.get(nsName, "101")
+	assert.False(t, ok, "the automation config of a deleted ConfigMap is forgotten")
+}
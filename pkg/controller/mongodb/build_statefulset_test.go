@@ -9,8 +9,13 @@ import (
 
 	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
 
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/resourcerequirements"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
 	"github.com/stretchr/testify/assert"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func init() {
@@ -18,7 +23,7 @@ func init() {
 }
 
 func TestMultipleCalls_DoNotCauseSideEffects(t *testing.T) {
-	mdb := newTestReplicaSet()
+	mdb := testutils.NewTestReplicaSet()
 	stsFunc := buildStatefulSetModificationFunction(mdb)
 	sts := &appsv1.StatefulSet{}
 
@@ -44,7 +49,7 @@ func assertStatefulSetIsBuiltCorrectly(t *testing.T, mdb mdbv1.MongoDB, sts *app
 	assert.Equal(t, mdb.Namespace, sts.Namespace)
 	assert.Equal(t, appsv1.RollingUpdateStatefulSetStrategyType, sts.Spec.UpdateStrategy.Type)
 	assert.Equal(t, operatorServiceAccountName, sts.Spec.Template.Spec.ServiceAccountName)
-	assert.Len(t, sts.Spec.Template.Spec.Containers[0].Env, 1)
+	assert.Len(t, sts.Spec.Template.Spec.Containers[0].Env, 2)
 	assert.Len(t, sts.Spec.Template.Spec.Containers[1].Env, 1)
 
 	agentContainer := sts.Spec.Template.Spec.Containers[0]
@@ -53,7 +58,7 @@ func assertStatefulSetIsBuiltCorrectly(t *testing.T, mdb mdbv1.MongoDB, sts *app
 	assert.True(t, reflect.DeepEqual(probes.New(defaultReadiness()), *probe))
 	assert.Equal(t, int32(240), probe.FailureThreshold)
 	assert.Equal(t, int32(5), probe.InitialDelaySeconds)
-	assert.Len(t, agentContainer.VolumeMounts, 3)
+	assert.Len(t, agentContainer.VolumeMounts, 5)
 
 	mongodContainer := sts.Spec.Template.Spec.Containers[1]
 	assert.Equal(t, "mongo:4.2.2", mongodContainer.Image)
@@ -65,3 +70,163 @@ func assertStatefulSetIsBuiltCorrectly(t *testing.T, mdb mdbv1.MongoDB, sts *app
 	assert.Equal(t, "version-upgrade-hook-image", initContainer.Image)
 	assert.Len(t, initContainer.VolumeMounts, 1)
 }
+
+func TestStatefulSet_DataVolumeClaim(t *testing.T) {
+	t.Run("Defaults are used when storage is not configured", func(t *testing.T) {
+		sts, err := buildStatefulSet(testutils.NewTestReplicaSet())
+		assert.NoError(t, err)
+
+		assert.Len(t, sts.Spec.VolumeClaimTemplates, 1)
+		pvc := sts.Spec.VolumeClaimTemplates[0]
+		assert.Equal(t, dataVolumeName, pvc.Name)
+		assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}, pvc.Spec.AccessModes)
+		assert.Equal(t, resourcerequirements.BuildDefaultStorageRequirements(), pvc.Spec.Resources.Requests)
+		assert.Nil(t, pvc.Spec.StorageClassName)
+		assert.Nil(t, pvc.Spec.Selector)
+	})
+
+	t.Run("Storage configuration is applied", func(t *testing.T) {
+		mdb := testutils.NewTestReplicaSet()
+		storageClass := "fast"
+		selector := &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "ssd"}}
+		mdb.Spec.Storage.Data = mdbv1.VolumeClaim{
+			StorageClassName: &storageClass,
+			Size:             "20Gi",
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			Selector:         selector,
+		}
+		assert.NoError(t, validateStorage(mdb))
+
+		sts, err := buildStatefulSet(mdb)
+		assert.NoError(t, err)
+
+		pvc := sts.Spec.VolumeClaimTemplates[0]
+		assert.Equal(t, "fast", *pvc.Spec.StorageClassName)
+		assert.Equal(t, resource.MustParse("20Gi"), pvc.Spec.Resources.Requests[corev1.ResourceStorage])
+		assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}, pvc.Spec.AccessModes)
+		assert.Equal(t, selector, pvc.Spec.Selector)
+	})
+
+	t.Run("Invalid size is rejected", func(t *testing.T) {
+		mdb := testutils.NewTestReplicaSet()
+		mdb.Spec.Storage.Data.Size = "twenty gigs"
+		assert.Error(t, validateStorage(mdb))
+	})
+}
+
+func TestStatefulSet_JournalVolumeClaim(t *testing.T) {
+	t.Run("Journal is stored on the data volume by default", func(t *testing.T) {
+		sts, err := buildStatefulSet(testutils.NewTestReplicaSet())
+		assert.NoError(t, err)
+
+		assert.Len(t, sts.Spec.VolumeClaimTemplates, 1)
+		for _, c := range sts.Spec.Template.Spec.Containers {
+			for _, m := range c.VolumeMounts {
+				assert.NotEqual(t, journalVolumeName, m.Name)
+			}
+		}
+	})
+
+	t.Run("Journal volume is created and mounted", func(t *testing.T) {
+		mdb := testutils.NewTestReplicaSet()
+		storageClass := "io-optimized"
+		mdb.Spec.Storage.Journal = &mdbv1.VolumeClaim{
+			StorageClassName: &storageClass,
+			Size:             "2Gi",
+		}
+		assert.NoError(t, validateStorage(mdb))
+
+		sts, err := buildStatefulSet(mdb)
+		assert.NoError(t, err)
+
+		assert.Len(t, sts.Spec.VolumeClaimTemplates, 2)
+		pvc := sts.Spec.VolumeClaimTemplates[1]
+		assert.Equal(t, journalVolumeName, pvc.Name)
+		assert.Equal(t, "io-optimized", *pvc.Spec.StorageClassName)
+		assert.Equal(t, resource.MustParse("2Gi"), pvc.Spec.Resources.Requests[corev1.ResourceStorage])
+
+		for _, c := range sts.Spec.Template.Spec.Containers {
+			assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: journalVolumeName, MountPath: "/data/journal"}, "container %s", c.Name)
+		}
+	})
+
+	t.Run("Invalid journal size is rejected", func(t *testing.T) {
+		mdb := testutils.NewTestReplicaSet()
+		mdb.Spec.Storage.Journal = &mdbv1.VolumeClaim{Size: "a lot"}
+		assert.Error(t, validateStorage(mdb))
+	})
+}
+
+func TestStatefulSet_LogsVolumeClaim(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.Logs = &mdbv1.VolumeClaim{Size: "1Gi"}
+	assert.NoError(t, validateStorage(mdb))
+
+	sts, err := buildStatefulSet(mdb)
+	assert.NoError(t, err)
+
+	assert.Len(t, sts.Spec.VolumeClaimTemplates, 2)
+	pvc := sts.Spec.VolumeClaimTemplates[1]
+	assert.Equal(t, logsVolumeName, pvc.Name)
+	assert.Equal(t, resource.MustParse("1Gi"), pvc.Spec.Resources.Requests[corev1.ResourceStorage])
+
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: logsVolumeName, MountPath: "/var/log/mongodb"}, "container %s", c.Name)
+	}
+	agentCommand := sts.Spec.Template.Spec.Containers[0].Command
+	assert.Contains(t, agentCommand[len(agentCommand)-1], "-logFile=/var/log/mongodb/automation-agent.log")
+}
+
+func TestStatefulSet_EphemeralStorage(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.Ephemeral = true
+	mdb.Spec.Storage.Data.Size = "1Gi"
+	mdb.Spec.Storage.Logs = &mdbv1.VolumeClaim{}
+
+	sts, err := buildStatefulSet(mdb)
+	assert.NoError(t, err)
+
+	assert.Empty(t, sts.Spec.VolumeClaimTemplates)
+
+	volumes := map[string]corev1.Volume{}
+	for _, v := range sts.Spec.Template.Spec.Volumes {
+		volumes[v.Name] = v
+	}
+	assert.NotNil(t, volumes[dataVolumeName].EmptyDir)
+	assert.Equal(t, resource.MustParse("1Gi"), *volumes[dataVolumeName].EmptyDir.SizeLimit)
+	assert.NotNil(t, volumes[logsVolumeName].EmptyDir)
+	assert.Nil(t, volumes[logsVolumeName].EmptyDir.SizeLimit)
+}
+
+func TestStatefulSet_DataAndLogsPaths(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.DataPath = "/var/lib/mongo"
+	mdb.Spec.Storage.LogsPath = "/mnt/logs"
+	mdb.Spec.Storage.Journal = &mdbv1.VolumeClaim{}
+	mdb.Spec.Storage.Logs = &mdbv1.VolumeClaim{}
+	assert.NoError(t, validateStorage(mdb))
+
+	sts, err := buildStatefulSet(mdb)
+	assert.NoError(t, err)
+
+	agent, mongod := sts.Spec.Template.Spec.Containers[0], sts.Spec.Template.Spec.Containers[1]
+	for _, c := range []corev1.Container{agent, mongod} {
+		assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: dataVolumeName, MountPath: "/var/lib/mongo"})
+		assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: journalVolumeName, MountPath: "/var/lib/mongo/journal"})
+		assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: logsVolumeName, MountPath: "/mnt/logs"})
+	}
+	assert.Contains(t, mongod.Command[2], "mongod -f /var/lib/mongo/automation-mongod.conf")
+	assert.Contains(t, agent.Command[2], "-logFile=/mnt/logs/automation-agent.log")
+}
+
+func TestValidateStorage_Paths(t *testing.T) {
+	for _, p := range []string{"data", "/data/../data", "/", "/hooks", "/var/lib/automation"} {
+		mdb := testutils.NewTestReplicaSet()
+		mdb.Spec.Storage.DataPath = p
+		assert.Error(t, validateStorage(mdb), p)
+	}
+
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.LogsPath = "/data"
+	assert.Error(t, validateStorage(mdb), "the data and logs paths must be different")
+}
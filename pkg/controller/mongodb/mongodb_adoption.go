@@ -0,0 +1,175 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	adoptedEventReason = "Adopted"
+
+	adoptionUsernameKey = "username"
+	adoptionPasswordKey = "password"
+	adoptionKeyFileKey  = "keyfile"
+)
+
+// adoptReplicaSet takes over the existing replica set described by spec.adopt. The automation config
+// is generated from the configuration and the users of the running replica set, and the existing
+// StatefulSet is deleted without its Pods. The StatefulSet created by the operator adopts the Pods
+// and replaces them one at a time with members running the agent, which keep their volumes and
+// don't need to resync. Nothing is done once the automation config exists.
+func (r *ReplicaSetReconciler) adoptReplicaSet(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.Adopt == nil {
+		return nil
+	}
+	_, err := r.client.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace})
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting automation config: %s", err)
+	}
+
+	sts := appsv1.StatefulSet{}
+	if err := r.client.Get(context.TODO(), mdb.NamespacedName(), &sts); err != nil {
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("there is no StatefulSet %s to adopt", mdb.NamespacedName())
+		}
+		return fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	if err := validateAdoptedStatefulSet(mdb, sts); err != nil {
+		return err
+	}
+
+	credential, err := r.adoptionCredential(mdb)
+	if err != nil {
+		return err
+	}
+	if mdb.Spec.Security.Authentication.Enabled {
+		if err := r.ensureAdoptedKeyFile(mdb); err != nil {
+			return err
+		}
+	}
+
+	// the existing members are reached through the Service of the operator
+	if err := r.ensureService(mdb); err != nil {
+		return fmt.Errorf("error ensuring the service exists: %s", err)
+	}
+	if err := r.labelAdoptedPods(mdb, sts); err != nil {
+		return err
+	}
+
+	rsConfig, users, err := r.readLiveClusterAs(mdb, credential)
+	if err != nil {
+		return err
+	}
+	version, err := r.writeLiveClusterAutomationConfig(mdb, rsConfig, users, 0)
+	if err != nil {
+		return err
+	}
+	r.log.Infof("Generated the automation config with version %d from the adopted replica set", version)
+
+	// the Pods are kept running and adopted by the StatefulSet created by the operator
+	if err := r.client.Delete(context.TODO(), &sts, k8sClient.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting the adopted StatefulSet: %s", err)
+	}
+	if r.recorder != nil {
+		r.recorder.Eventf(&mdb, corev1.EventTypeNormal, adoptedEventReason, "Adopted the replica set of StatefulSet %s", sts.Name)
+	}
+	return nil
+}
+
+// validateAdoptedStatefulSet returns an error if the members of the StatefulSet can't be taken
+// over without losing their data or being reachable by the operator.
+func validateAdoptedStatefulSet(mdb mdbv1.MongoDB, sts appsv1.StatefulSet) error {
+	var problems []string
+	if owner := metav1.GetControllerOf(&sts); owner != nil && owner.UID != mdb.UID {
+		problems = append(problems, fmt.Sprintf("it is managed by %s %s", owner.Kind, owner.Name))
+	}
+	if sts.Spec.ServiceName != mdb.ServiceName() {
+		problems = append(problems, fmt.Sprintf("its Service is %s, expected %s", sts.Spec.ServiceName, mdb.ServiceName()))
+	}
+	hasDataVolume := false
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		if template.Name == dataVolumeName {
+			hasDataVolume = true
+		}
+	}
+	if !hasDataVolume {
+		problems = append(problems, fmt.Sprintf("it has no %s volume claim template", dataVolumeName))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("StatefulSet %s can't be adopted: %s", sts.Name, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// adoptionCredential reads the credential of the user of the existing replica set
+func (r *ReplicaSetReconciler) adoptionCredential(mdb mdbv1.MongoDB) (*livecluster.Credential, error) {
+	if mdb.Spec.Adopt.CredentialsSecretName == "" {
+		return nil, nil
+	}
+	nsName := types.NamespacedName{Name: mdb.Spec.Adopt.CredentialsSecretName, Namespace: mdb.Namespace}
+	username, err := secret.ReadKey(r.client, adoptionUsernameKey, nsName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading username of the adopted replica set: %s", err)
+	}
+	password, err := secret.ReadKey(r.client, adoptionPasswordKey, nsName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading password of the adopted replica set: %s", err)
+	}
+	return &livecluster.Credential{Username: username, Password: password}, nil
+}
+
+// ensureAdoptedKeyFile makes the agents use the keyfile of the existing members, so that the
+// members running the agent can authenticate to the existing ones.
+func (r *ReplicaSetReconciler) ensureAdoptedKeyFile(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.Adopt.KeyFileSecretName == "" {
+		return fmt.Errorf("spec.adopt.keyFileSecretName is required when authentication is enabled")
+	}
+	keyFile, err := secret.ReadKey(r.client, adoptionKeyFileKey, types.NamespacedName{Name: mdb.Spec.Adopt.KeyFileSecretName, Namespace: mdb.Namespace})
+	if err != nil {
+		return fmt.Errorf("error reading keyfile of the adopted replica set: %s", err)
+	}
+
+	// the agent password is generated with the automation config, in the same Secret
+	return secret.CreateOrPatch(r.client, secret.Builder().
+		SetName(mdb.ScramCredentialsNamespacedName().Name).
+		SetNamespace(mdb.Namespace).
+		SetField(scram.AgentKeyfileKey, keyFile).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
+		Build())
+}
+
+// labelAdoptedPods adds the label selected by the Service and the StatefulSet of the operator to
+// the Pods of the existing members.
+func (r *ReplicaSetReconciler) labelAdoptedPods(mdb mdbv1.MongoDB, sts appsv1.StatefulSet) error {
+	replicas := 1
+	if sts.Spec.Replicas != nil {
+		replicas = int(*sts.Spec.Replicas)
+	}
+	for i := 0; i < replicas; i++ {
+		pod := corev1.Pod{}
+		if err := r.client.GetAndUpdate(types.NamespacedName{Name: fmt.Sprintf("%s-%d", sts.Name, i), Namespace: sts.Namespace}, &pod, func() {
+			if pod.Labels == nil {
+				pod.Labels = map[string]string{}
+			}
+			pod.Labels["app"] = mdb.ServiceName()
+		}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error labeling pod %s-%d: %s", sts.Name, i, err)
+		}
+	}
+	return nil
+}
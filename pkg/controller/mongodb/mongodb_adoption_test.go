@@ -0,0 +1,110 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// existingStatefulSet is a StatefulSet deployed without the operator, e.g. by a Helm chart
+func existingStatefulSet(mdb mdbv1.MongoDB) appsv1.StatefulSet {
+	replicas := int32(mdb.Spec.Members)
+	return appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: mdb.Name, Namespace: mdb.Namespace},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:             &replicas,
+			ServiceName:          mdb.ServiceName(),
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: dataVolumeName}}},
+		},
+	}
+}
+
+func TestAdoptReplicaSet(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.Adopt = &mdbv1.Adoption{CredentialsSecretName: "existing-admin", KeyFileSecretName: "existing-keyfile"}
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	sts := existingStatefulSet(mdb)
+	assert.NoError(t, mgrClient.Create(context.TODO(), &sts))
+	for i := 0; i < mdb.Spec.Members; i++ {
+		pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", mdb.Name, i), Namespace: mdb.Namespace, Labels: map[string]string{"app.kubernetes.io/name": "mongodb"}}}
+		assert.NoError(t, mgrClient.Create(context.TODO(), &pod))
+	}
+	assert.NoError(t, mgrClient.CreateSecret(secret.Builder().SetName("existing-admin").SetNamespace(mdb.Namespace).
+		SetField("username", "root").SetField("password", "secret").Build()))
+	assert.NoError(t, mgrClient.CreateSecret(secret.Builder().SetName("existing-keyfile").SetNamespace(mdb.Namespace).
+		SetField("keyfile", "existing-keyfile-contents").Build()))
+
+	var usedCredential *livecluster.Credential
+	r.connectToLiveCluster = func(_ string, credential *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		usedCredential = credential
+		return mockLiveCluster{
+			rsConfig: livecluster.ReplicaSetConfig{
+				Name:            mdb.Name,
+				ProtocolVersion: 1,
+				Members: []livecluster.ReplicaSetMember{
+					{Id: 0, Host: "my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017", Priority: 1, Votes: 1},
+					{Id: 1, Host: "my-rs-1.my-rs-svc.my-ns.svc.cluster.local:27017", Priority: 1, Votes: 1},
+					{Id: 2, Host: "my-rs-2.my-rs-svc.my-ns.svc.cluster.local:27017", Priority: 0, Votes: 0},
+				},
+			},
+			users: []livecluster.User{{Username: "app-user", Database: "admin", Roles: []livecluster.Role{{Role: "readWrite", Database: "app"}}}},
+		}, nil
+	}
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	assert.Equal(t, &livecluster.Credential{Username: "root", Password: "secret"}, usedCredential)
+
+	ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+	assert.NoError(t, err)
+	assert.Len(t, ac.ReplicaSets[0].Members, 3)
+	assert.Equal(t, 0, ac.ReplicaSets[0].Members[2].Priority)
+	assert.Equal(t, 0, ac.ReplicaSets[0].Members[2].Votes)
+	assert.Len(t, ac.Auth.Users, 1)
+	assert.Equal(t, "app-user", ac.Auth.Users[0].Username)
+
+	keyFile, err := secret.ReadKey(mgrClient, scram.AgentKeyfileKey, mdb.ScramCredentialsNamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, "existing-keyfile-contents", keyFile, "the agents use the keyfile of the existing members")
+
+	sts, err = mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Len(t, sts.OwnerReferences, 1, "the StatefulSet is managed by the operator")
+
+	for i := 0; i < mdb.Spec.Members; i++ {
+		pod := corev1.Pod{}
+		assert.NoError(t, mgrClient.Get(context.TODO(), types.NamespacedName{Name: fmt.Sprintf("%s-%d", mdb.Name, i), Namespace: mdb.Namespace}, &pod))
+		assert.Equal(t, mdb.ServiceName(), pod.Labels["app"])
+	}
+}
+
+func TestValidateAdoptedStatefulSet(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	sts := existingStatefulSet(mdb)
+	assert.NoError(t, validateAdoptedStatefulSet(mdb, sts))
+
+	sts.Spec.ServiceName = "mongodb-headless"
+	sts.Spec.VolumeClaimTemplates[0].Name = "datadir"
+	err := validateAdoptedStatefulSet(mdb, sts)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "mongodb-headless")
+	assert.Contains(t, err.Error(), dataVolumeName)
+}
@@ -0,0 +1,398 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/connectionstring"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	migrationStartedEventReason   = "MigrationStarted"
+	migrationCutoverEventReason   = "MigrationCutover"
+	migrationCompletedEventReason = "MigrationCompleted"
+	migrationFailedEventReason    = "MigrationFailed"
+
+	// the keys of the Secret of spec.migration.atlasSecretRef
+	atlasConnectionStringKey = "connectionString"
+	atlasHostKey             = "host"
+	atlasUsernameKey         = "username"
+	atlasPasswordKey         = "password"
+
+	// migrationCutoverKey is the key of the ConfigMap of the migration set to true once the Job can
+	// complete the cutover, the ConfigMap is mounted in the Job, which polls it
+	migrationCutoverKey       = "cutover"
+	migrationControlMountPath = "/migration"
+	// migrationStatusPort is the port the HTTP API of mongosync, or the status of mongomirror, is
+	// served on in the Pod of the Job
+	migrationStatusPort   = 27182
+	migrationBackoffLimit = 2
+)
+
+func migrationTool(mdb mdbv1.MongoDB) mdbv1.MigrationTool {
+	if mdb.Spec.Migration.Tool != "" {
+		return mdb.Spec.Migration.Tool
+	}
+	return mdbv1.MigrationToolMongosync
+}
+
+// validateMigration ensures the tool of spec.migration supports its direction
+func validateMigration(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.Migration == nil {
+		return nil
+	}
+	if migrationTool(mdb) == mdbv1.MigrationToolMongomirror && mdb.Spec.Migration.Direction != mdbv1.MigrationToAtlas {
+		return fmt.Errorf("mongomirror only migrates to Atlas")
+	}
+	return nil
+}
+
+func migrationJobNamespacedName(mdb mdbv1.MongoDB) types.NamespacedName {
+	return types.NamespacedName{Name: mdb.Name + "-migration", Namespace: mdb.Namespace}
+}
+
+// updateMigration runs the migration of spec.migration with a Job once the replica set is running,
+// and records its progress in status.migration. When spec.migration.cutover is set, the ConfigMap
+// polled by the Job lets it complete the cutover, once the operator has paused the writes to the
+// replica set for mongomirror, mongosync pausing the writes to the source itself. The Job and the
+// ConfigMap are deleted, and the status cleared, when spec.migration is removed.
+func (r *ReplicaSetReconciler) updateMigration(mdb mdbv1.MongoDB) error {
+	if mdb.DeletionTimestamp != nil {
+		return nil
+	}
+	if mdb.Spec.Migration == nil {
+		return r.removeMigration(mdb)
+	}
+	status := mdbv1.MigrationStatus{}
+	if mdb.Status.Migration != nil {
+		status = *mdb.Status.Migration
+	}
+	if status.Phase == mdbv1.MigrationCompleted || status.Phase == mdbv1.MigrationFailed {
+		return nil
+	}
+	if status.Phase == "" && mdb.Status.Phase != mdbv1.Running {
+		// the migration starts once the replica set is running
+		return nil
+	}
+
+	if mdb.Spec.Migration.Cutover && migrationTool(mdb) == mdbv1.MigrationToolMongomirror && status.Phase != "" && status.WritesPausedOn == "" {
+		member, err := r.pauseWrites(mdb)
+		if err != nil {
+			return err
+		}
+		status.WritesPausedOn = member
+		if err := r.setMigrationStatus(mdb, &status); err != nil {
+			return err
+		}
+	}
+	if err := configmap.CreateOrUpdate(r.client, buildMigrationConfigMap(mdb, status)); err != nil {
+		return fmt.Errorf("error applying the ConfigMap of the migration: %s", err)
+	}
+
+	previousPhase := status.Phase
+	job := batchv1.Job{}
+	err := r.client.Get(context.TODO(), migrationJobNamespacedName(mdb), &job)
+	if errors.IsNotFound(err) {
+		job = buildMigrationJob(mdb)
+		if err := r.client.Create(context.TODO(), &job); err != nil {
+			return fmt.Errorf("error creating the Job of the migration: %s", err)
+		}
+		r.log.Infof("Migrating %s with %s", migrationDescription(mdb), migrationTool(mdb))
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, migrationStartedEventReason, "Migrating %s with Job %s", migrationDescription(mdb), job.Name)
+		}
+	} else if err != nil {
+		return fmt.Errorf("error getting the Job of the migration: %s", err)
+	}
+
+	status.Job, status.Phase = job.Name, mdbv1.MigrationRunning
+	if mdb.Spec.Migration.Cutover {
+		status.Phase = mdbv1.MigrationCuttingOver
+	}
+	if job.Status.Succeeded > 0 {
+		status.Phase, status.CompletedAt = mdbv1.MigrationCompleted, job.Status.CompletionTime
+	}
+	if message, failed := jobFailure(job); failed {
+		status.Phase, status.Message = mdbv1.MigrationFailed, message
+	}
+	if err := r.setMigrationStatus(mdb, &status); err != nil {
+		return err
+	}
+	if status.Phase == previousPhase {
+		return nil
+	}
+
+	switch status.Phase {
+	case mdbv1.MigrationCuttingOver:
+		r.log.Infof("Cutting the migration %s over", migrationDescription(mdb))
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, migrationCutoverEventReason, "Pausing the writes to the source and applying the remaining changes")
+		}
+	case mdbv1.MigrationCompleted:
+		r.log.Infof("Migrated %s", migrationDescription(mdb))
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, migrationCompletedEventReason, "Migrated %s, the connection string Secrets point to the destination", migrationDescription(mdb))
+		}
+		// the connection string Secrets are flipped right away, not at the next reconciliation
+		mdb.Status.Migration = &status
+		return r.ensureConnectionStringSecrets(mdb)
+	case mdbv1.MigrationFailed:
+		r.log.Warnf("Error migrating %s: %s", migrationDescription(mdb), status.Message)
+		if r.recorder != nil {
+			r.recorder.Event(&mdb, corev1.EventTypeWarning, migrationFailedEventReason, status.Message)
+		}
+	}
+	return nil
+}
+
+func migrationDescription(mdb mdbv1.MongoDB) string {
+	if mdb.Spec.Migration.Direction == mdbv1.MigrationToAtlas {
+		return "the replica set to Atlas"
+	}
+	return "Atlas to the replica set"
+}
+
+// pauseWrites locks the writes of the primary with fsyncLock, which pauses the writes to the replica
+// set, and returns the name of the primary
+func (r *ReplicaSetReconciler) pauseWrites(mdb mdbv1.MongoDB) (string, error) {
+	primary := ""
+	for _, member := range mdb.Status.Members {
+		if member.State == livecluster.PrimaryState {
+			primary = member.Name
+		}
+	}
+	if primary == "" {
+		return "", fmt.Errorf("the writes can't be paused as the replica set has no primary")
+	}
+	reader, err := r.connectLiveClusterMember(mdb, primary)
+	if err != nil {
+		return "", err
+	}
+	defer r.disconnectLiveCluster(context.TODO(), reader)
+	ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+	defer cancel()
+	if err := reader.FsyncLock(ctx); err != nil {
+		return "", fmt.Errorf("error locking the writes of %s: %s", primary, err)
+	}
+	r.log.Infof("Locked the writes of %s for the cutover of the migration", primary)
+	return primary, nil
+}
+
+// removeMigration deletes the Job and the ConfigMap of the migration, and clears its status
+func (r *ReplicaSetReconciler) removeMigration(mdb mdbv1.MongoDB) error {
+	if mdb.Status.Migration == nil {
+		return nil
+	}
+	job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: migrationJobNamespacedName(mdb).Name, Namespace: mdb.Namespace}}
+	if err := r.client.Delete(context.TODO(), &job, k8sClient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting the Job of the migration: %s", err)
+	}
+	if err := r.client.DeleteConfigMap(migrationJobNamespacedName(mdb)); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting the ConfigMap of the migration: %s", err)
+	}
+	return r.setMigrationStatus(mdb, nil)
+}
+
+// buildMigrationConfigMap returns the ConfigMap polled by the Job of the migration, which lets it
+// complete the cutover once spec.migration.cutover is set and the writes are paused for mongomirror
+func buildMigrationConfigMap(mdb mdbv1.MongoDB, status mdbv1.MigrationStatus) corev1.ConfigMap {
+	cutover := mdb.Spec.Migration.Cutover
+	if migrationTool(mdb) == mdbv1.MigrationToolMongomirror {
+		cutover = cutover && status.WritesPausedOn != ""
+	}
+	return configmap.Builder().
+		SetName(migrationJobNamespacedName(mdb).Name).
+		SetNamespace(mdb.Namespace).
+		SetField(migrationCutoverKey, fmt.Sprintf("%t", cutover)).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
+		Build()
+}
+
+// buildMigrationJob returns the Job running the tool of spec.migration, which connects to the replica
+// set as the agent, and to the Atlas cluster with the Secret of spec.migration.atlasSecretRef
+func buildMigrationJob(mdb mdbv1.MongoDB) batchv1.Job {
+	const containerName = "migration"
+	controlVolume := statefulset.CreateVolumeFromConfigMap("migration-control", migrationJobNamespacedName(mdb).Name)
+	atlasKey := func(key string) corev1.EnvVar {
+		return corev1.EnvVar{Name: "ATLAS_" + strings.ToUpper(key), ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: mdb.Spec.Migration.AtlasSecretRef.Name},
+			Key:                  key,
+		}}}
+	}
+	script := mongosyncScript(mdb)
+	envs := []corev1.EnvVar{atlasKey(atlasConnectionStringKey)}
+	if migrationTool(mdb) == mdbv1.MigrationToolMongomirror {
+		script = mongomirrorScript(mdb)
+		envs = []corev1.EnvVar{atlasKey(atlasHostKey), atlasKey(atlasUsernameKey), atlasKey(atlasPasswordKey)}
+	}
+
+	_, _, connection := mongoToolConnection(mdb, containerName)
+	labels := map[string]string{"app": migrationJobNamespacedName(mdb).Name}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		podtemplatespec.WithVolume(controlVolume),
+		podtemplatespec.WithContainer(containerName, container.Apply(
+			container.WithName(containerName),
+			container.WithImage(mdb.Spec.Migration.Image),
+			container.WithCommand([]string{"/bin/sh", "-c", script}),
+			container.WithEnvs(envs...),
+			container.WithVolumeMounts([]corev1.VolumeMount{statefulset.CreateVolumeMount(controlVolume.Name, migrationControlMountPath, statefulset.WithReadOnly(true))}),
+		)),
+		connection,
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	backoffLimit := int32(migrationBackoffLimit)
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            migrationJobNamespacedName(mdb).Name,
+			Namespace:       mdb.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}
+}
+
+// localMigrationURI returns the connection string of the replica set used by mongosync, with the
+// password of the agent expanded by the shell
+func localMigrationURI(mdb mdbv1.MongoDB) string {
+	credentials := ""
+	options := "replicaSet=" + mdb.Name
+	if mdb.Spec.Security.Authentication.Enabled {
+		credentials = scram.AgentName + `:${AGENT_PASSWORD}@`
+		options += "&authSource=admin"
+	}
+	if mdb.Spec.Security.TLS.Enabled {
+		options += "&tls=true&tlsCAFile=" + mongoToolCAFile(mdb)
+	}
+	return fmt.Sprintf("mongodb://%s%s/?%s", credentials, strings.Join(connectionstring.Hosts(mdb, ""), ","), options)
+}
+
+// waitForCutover is the shell loop waiting for the ConfigMap of the migration to allow the cutover,
+// and for the condition to be true
+func waitForCutover(condition string) string {
+	return fmt.Sprintf(`until [ "$(cat %s/%s 2>/dev/null)" = "true" ] && %s; do sleep 10; done`, migrationControlMountPath, migrationCutoverKey, condition)
+}
+
+// mongosyncScript returns the script running mongosync in the background and driving it through its
+// HTTP API: the migration is started with the writes to the source blocked on commit, and committed
+// once the cutover is allowed and mongosync can commit. It exits once the destination accepts writes.
+func mongosyncScript(mdb mdbv1.MongoDB) string {
+	source, destination := `"$LOCAL_URI"`, `"$ATLAS_CONNECTIONSTRING"`
+	if mdb.Spec.Migration.Direction == mdbv1.MigrationFromAtlas {
+		source, destination = destination, source
+	}
+	api := fmt.Sprintf("http://localhost:%d/api/v1", migrationStatusPort)
+	return strings.Join([]string{
+		fmt.Sprintf(`LOCAL_URI="%s"`, localMigrationURI(mdb)),
+		fmt.Sprintf(`mongosync --cluster0 %s --cluster1 %s --port %d &`, source, destination, migrationStatusPort),
+		fmt.Sprintf(`until curl -s %s/progress > /dev/null; do sleep 1; done`, api),
+		// a restarted mongosync resumes the migration, it can't be started again
+		fmt.Sprintf(`curl -s -X POST %s/start --data '{"source":"cluster0","destination":"cluster1","enableUserWriteBlocking":true}'`, api),
+		waitForCutover(fmt.Sprintf(`curl -s %s/progress | grep -q '"canCommit":true'`, api)),
+		fmt.Sprintf(`curl -sf -X POST %s/commit --data '{}'`, api),
+		fmt.Sprintf(`until curl -s %s/progress | grep -q '"canWrite":true'; do sleep 5; done`, api),
+	}, "\n")
+}
+
+// mongomirrorScript returns the script running mongomirror in the background, and stopping it once the
+// cutover is allowed, which means the writes to the replica set are paused, and mongomirror has
+// applied all the changes
+func mongomirrorScript(mdb mdbv1.MongoDB) string {
+	hosts := fmt.Sprintf("%s/%s", mdb.Name, strings.Join(connectionstring.Hosts(mdb, ""), ","))
+	options := ""
+	if mdb.Spec.Security.Authentication.Enabled {
+		options += fmt.Sprintf(` --username %s --password "$AGENT_PASSWORD" --authenticationDatabase admin`, scram.AgentName)
+	}
+	if mdb.Spec.Security.TLS.Enabled {
+		options += fmt.Sprintf(" --ssl --sslCAFile %s", mongoToolCAFile(mdb))
+	}
+	status := fmt.Sprintf("http://localhost:%d", migrationStatusPort)
+	return strings.Join([]string{
+		fmt.Sprintf(`mongomirror --host "%s"%s --destination "$ATLAS_HOST" --destinationUsername "$ATLAS_USERNAME" --destinationPassword "$ATLAS_PASSWORD" --httpStatusPort %d &`, hosts, options, migrationStatusPort),
+		`pid=$!`,
+		waitForCutover(fmt.Sprintf(`curl -s %s | grep -q '"stage":"oplog sync"'`, status)),
+		fmt.Sprintf(`until curl -s %s | grep -q '"lagTimeSeconds":0'; do kill -0 $pid || exit 1; sleep 5; done`, status),
+		`kill $pid`,
+	}, "\n")
+}
+
+// migrationPointsToAtlas returns true if the connection string Secrets of the users point to the
+// Atlas cluster: once a migration to Atlas is completed, and until a migration from Atlas is
+func migrationPointsToAtlas(mdb mdbv1.MongoDB) bool {
+	if mdb.Spec.Migration == nil {
+		return false
+	}
+	completed := mdb.Status.Migration != nil && mdb.Status.Migration.Phase == mdbv1.MigrationCompleted
+	if mdb.Spec.Migration.Direction == mdbv1.MigrationToAtlas {
+		return completed
+	}
+	return !completed
+}
+
+// readAtlasConnectionString returns the connection string of the Atlas cluster of spec.migration
+func (r *ReplicaSetReconciler) readAtlasConnectionString(mdb mdbv1.MongoDB) (string, error) {
+	nsName := types.NamespacedName{Name: mdb.Spec.Migration.AtlasSecretRef.Name, Namespace: mdb.Namespace}
+	uri, err := secret.ReadKey(r.client, atlasConnectionStringKey, nsName)
+	if err != nil {
+		return "", fmt.Errorf("error reading the connection string of Atlas from Secret %s: %s", nsName.Name, err)
+	}
+	return uri, nil
+}
+
+// atlasConnectionString returns the connection string of the Atlas cluster authenticating as the user
+func atlasConnectionString(uri string, user mdbv1.MongoDBUser, password string) (string, error) {
+	atlasURL, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection string of Atlas: %s", err)
+	}
+	database := user.DB
+	if database == "" {
+		database = "admin"
+	}
+	atlasURL.User = url.UserPassword(user.Name, password)
+	query := atlasURL.Query()
+	query.Set("authSource", database)
+	atlasURL.RawQuery = query.Encode()
+	if atlasURL.Path == "" {
+		atlasURL.Path = "/"
+	}
+	return atlasURL.String(), nil
+}
+
+func (r *ReplicaSetReconciler) setMigrationStatus(mdb mdbv1.MongoDB, status *mdbv1.MigrationStatus) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if reflect.DeepEqual(newMdb.Status.Migration, status) {
+		return nil
+	}
+	newMdb.Status.Migration = status
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package mongodb
 
 import (
+	"fmt"
+
 	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
@@ -8,10 +10,15 @@ import (
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/contains"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 const (
 	scramShaOption = "SCRAM"
+
+	defaultUserPasswordKey = "password"
 )
 
 // getAuthConfigModification returns a modification function that
@@ -23,7 +30,7 @@ func getAuthConfigModification(getUpdateCreator secret.GetUpdateCreator, mdb mdb
 
 	// currently, just enable auth if it's in the list as there is only one option
 	if contains.AuthMode(mdb.Spec.Security.Authentication.Modes, scramShaOption) {
-		enabler, err := scram.EnsureAgentSecret(getUpdateCreator, mdb.ScramCredentialsNamespacedName())
+		enabler, err := scram.EnsureAgentSecret(getUpdateCreator, mdb.ScramCredentialsNamespacedName(), []metav1.OwnerReference{getOwnerReference(mdb)})
 		if err != nil {
 			return automationconfig.NOOP(), err
 		}
@@ -52,3 +59,36 @@ func buildScramPodSpecModification(mdb mdbv1.MongoDB) podtemplatespec.Modificati
 		podtemplatespec.WithVolumeMounts(mongodbName, keyFileVolumeVolumeMountMongod),
 	)
 }
+
+// checkUserPasswordSecrets returns a terminal error if the Secret holding the password of a user of
+// spec.users doesn't exist or doesn't hold the password. The Secrets are watched, so that the resource
+// is reconciled again once they are fixed. The Vault secrets aren't, reading them is retried.
+func (r *ReplicaSetReconciler) checkUserPasswordSecrets(mdb mdbv1.MongoDB) error {
+	for i, user := range mdb.Spec.Users {
+		if user.PasswordVaultRef != nil {
+			password, err := r.readUserPassword(mdb, user)
+			if err != nil {
+				return fmt.Errorf("error reading the password of user %s: %s", user.Name, err)
+			}
+			if password == "" {
+				return fmt.Errorf(`Vault secret %s should have the password of user %s in field "%s"`, user.PasswordVaultRef.Path, user.Name, userPasswordKey(user.PasswordVaultRef.Key))
+			}
+			continue
+		}
+
+		nsName := types.NamespacedName{Name: user.PasswordSecretRef.Name, Namespace: mdb.Namespace}
+
+		data, err := secret.ReadStringData(r.client, nsName)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return referencedResourceNotFound("Secret", nsName, fmt.Sprintf("spec.users[%d].passwordSecretRef", i))
+			}
+			return fmt.Errorf("error reading the password of user %s: %s", user.Name, err)
+		}
+		key := userPasswordKey(user.PasswordSecretRef.Key)
+		if data[key] == "" {
+			return missingPrerequisite(`Secret "%s" should have the password of user %s in field "%s"`, nsName, user.Name, key)
+		}
+	}
+	return nil
+}
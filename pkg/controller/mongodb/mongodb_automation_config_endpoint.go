@@ -0,0 +1,145 @@
+package mongodb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/acendpoint"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	kubernetesClient "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/generate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// automationConfigTokenKey is the key of the token in the Secret the agents authenticate with to
+	// the automation config endpoint
+	automationConfigTokenKey = "token"
+	// automationConfigEndpointMountPath is where the token and the CA of the endpoint are mounted in
+	// the agent container
+	automationConfigEndpointMountPath = "/var/lib/automation/endpoint"
+
+	// the environment variables the version upgrade hook polls the automation config with, see
+	// cmd/versionhook
+	automationConfigURLEnv       = "AUTOMATION_CONFIG_URL"
+	automationConfigTokenFileEnv = "AUTOMATION_CONFIG_TOKEN_FILE"
+	automationConfigCAFileEnv    = "AUTOMATION_CONFIG_CA_FILE"
+	automationConfigFileEnv      = "AUTOMATION_CONFIG_FILE"
+)
+
+// automationConfigServerURL is the URL the agents reach the automation config endpoint of the
+// operator at, it is empty if the operator doesn't serve it
+var automationConfigServerURL string
+
+// automationConfigServerCAFile is the file holding the CA of the certificate of the automation
+// config endpoint
+var automationConfigServerCAFile string
+
+// SetAutomationConfigServer configures the operator to make the agents of the resources with the
+// Endpoint delivery poll their automation config from url, verifying its certificate with the CA
+// of caFile. It must be called before the controllers are added to the Manager.
+func SetAutomationConfigServer(url, caFile string) {
+	automationConfigServerURL = strings.TrimSuffix(url, "/")
+	automationConfigServerCAFile = caFile
+}
+
+// usesAutomationConfigEndpoint returns true if the agents poll the automation config from the
+// operator instead of reading it from the mounted ConfigMap
+func usesAutomationConfigEndpoint(mdb mdbv1.MongoDB) bool {
+	return mdb.Spec.AutomationConfigDelivery == mdbv1.EndpointDelivery
+}
+
+// ensureAutomationConfigToken ensures the Secret mounted in the agent container with the token the
+// agents authenticate with and the CA they verify the endpoint with. The token is generated the
+// first time, it is rotated by deleting the Secret.
+func (r *ReplicaSetReconciler) ensureAutomationConfigToken(mdb mdbv1.MongoDB) error {
+	if !usesAutomationConfigEndpoint(mdb) {
+		return nil
+	}
+	if automationConfigServerURL == "" {
+		return fmt.Errorf("the automation config delivery is %s but the operator doesn't serve the automation config endpoint", mdbv1.EndpointDelivery)
+	}
+	ca, err := ioutil.ReadFile(automationConfigServerCAFile)
+	if err != nil {
+		return fmt.Errorf("error reading the CA of the automation config endpoint: %s", err)
+	}
+
+	nsName := types.NamespacedName{Name: mdb.AutomationConfigTokenSecretName(), Namespace: mdb.Namespace}
+	token, err := secret.ReadKey(r.client, automationConfigTokenKey, nsName)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error reading token of Secret %s: %s", nsName.Name, err)
+	}
+	if err != nil {
+		token, err = generate.RandomFixedLengthStringOfSize(32)
+		if err != nil {
+			return fmt.Errorf("error generating token: %s", err)
+		}
+	}
+	s := secret.Builder().
+		SetName(nsName.Name).
+		SetNamespace(nsName.Namespace).
+		SetField(automationConfigTokenKey, token).
+		SetField(acendpoint.CAFileName, string(ca)).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
+		Build()
+	if err := secret.CreateOrUpdate(r.client, s); err != nil {
+		return fmt.Errorf("error creating or updating Secret %s: %s", nsName.Name, err)
+	}
+	return nil
+}
+
+// buildAutomationConfigEndpointPodSpecModification mounts the token and the CA of the endpoint in
+// the agent container, and configures the version upgrade hook to poll the automation config, if
+// the resource uses the Endpoint delivery
+func buildAutomationConfigEndpointPodSpecModification(mdb mdbv1.MongoDB) podtemplatespec.Modification {
+	if !usesAutomationConfigEndpoint(mdb) {
+		return podtemplatespec.NOOP()
+	}
+	tokenVolume := statefulset.CreateVolumeFromSecret("automation-config-token", mdb.AutomationConfigTokenSecretName())
+	tokenVolumeMount := statefulset.CreateVolumeMount(tokenVolume.Name, automationConfigEndpointMountPath, statefulset.WithReadOnly(true))
+	return podtemplatespec.Apply(
+		podtemplatespec.WithVolume(tokenVolume),
+		podtemplatespec.WithVolumeMounts(agentName, tokenVolumeMount),
+		podtemplatespec.WithContainer(agentName, container.WithEnvs(
+			corev1.EnvVar{Name: automationConfigURLEnv, Value: automationConfigServerURL + acendpoint.PathPrefix + mdb.Namespace + "/" + mdb.Name},
+			corev1.EnvVar{Name: automationConfigTokenFileEnv, Value: automationConfigEndpointMountPath + "/" + automationConfigTokenKey},
+			corev1.EnvVar{Name: automationConfigCAFileEnv, Value: automationConfigEndpointMountPath + "/" + acendpoint.CAFileName},
+			corev1.EnvVar{Name: automationConfigFileEnv, Value: clusterFilePath},
+		)),
+	)
+}
+
+// automationConfigSource serves the automation configs of the ConfigMaps and the tokens of the
+// Secrets of the resources to the automation config endpoint
+type automationConfigSource struct {
+	client kubernetesClient.Client
+}
+
+// NewAutomationConfigSource returns the acendpoint.Source reading the automation configs and the
+// tokens of the resources with the client
+func NewAutomationConfigSource(c k8sClient.Client) acendpoint.Source {
+	return automationConfigSource{client: kubernetesClient.NewClient(c)}
+}
+
+func (s automationConfigSource) AutomationConfig(nsName types.NamespacedName) ([]byte, error) {
+	mdb := mdbv1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: nsName.Name, Namespace: nsName.Namespace}}
+	cm, err := s.client.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	return automationConfigBytes(cm)
+}
+
+func (s automationConfigSource) Token(nsName types.NamespacedName) (string, error) {
+	mdb := mdbv1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: nsName.Name, Namespace: nsName.Namespace}}
+	return secret.ReadKey(s.client, automationConfigTokenKey, types.NamespacedName{Name: mdb.AutomationConfigTokenSecretName(), Namespace: mdb.Namespace})
+}
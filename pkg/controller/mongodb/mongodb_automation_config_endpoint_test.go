@@ -0,0 +1,124 @@
+package mongodb
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/acendpoint"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newAutomationConfigEndpointReplicaSet() mdbv1.MongoDB {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.AutomationConfigDelivery = mdbv1.EndpointDelivery
+	return mdb
+}
+
+// setAutomationConfigServer configures the automation config endpoint with a CA file until the
+// returned function is called
+func setAutomationConfigServer(t *testing.T) func() {
+	caFile, err := ioutil.TempFile("", "ca.crt")
+	assert.NoError(t, err)
+	_, err = caFile.WriteString("my-ca")
+	assert.NoError(t, err)
+	assert.NoError(t, caFile.Close())
+	SetAutomationConfigServer("https://operator.my-ns.svc:8443/", caFile.Name())
+	return func() {
+		SetAutomationConfigServer("", "")
+		os.Remove(caFile.Name())
+	}
+}
+
+func TestReconcile_AutomationConfigEndpoint(t *testing.T) {
+	defer setAutomationConfigServer(t)()
+	mdb := newAutomationConfigEndpointReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	tokenSecret := types.NamespacedName{Name: "my-rs-automation-config-token", Namespace: mdb.Namespace}
+	token, err := secret.ReadKey(r.client, automationConfigTokenKey, tokenSecret)
+	assert.NoError(t, err)
+	assert.Len(t, token, 32)
+	ca, err := secret.ReadKey(r.client, acendpoint.CAFileName, tokenSecret)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-ca", ca)
+
+	t.Run("The agents poll the automation config instead of mounting its ConfigMap", func(t *testing.T) {
+		sts := appsv1.StatefulSet{}
+		assert.NoError(t, mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &sts))
+		for _, v := range sts.Spec.Template.Spec.Volumes {
+			assert.NotEqual(t, "automation-config", v.Name)
+		}
+		assert.Contains(t, sts.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name:         "automation-config-token",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: tokenSecret.Name}},
+		})
+
+		agent := sts.Spec.Template.Spec.Containers[0]
+		assert.Equal(t, agentName, agent.Name)
+		assert.Contains(t, agent.VolumeMounts, corev1.VolumeMount{Name: "automation-config-token", MountPath: "/var/lib/automation/endpoint", ReadOnly: true})
+		assert.Contains(t, agent.Env, corev1.EnvVar{Name: automationConfigURLEnv, Value: "https://operator.my-ns.svc:8443/automation-config/my-ns/my-rs"})
+		assert.Contains(t, agent.Env, corev1.EnvVar{Name: automationConfigTokenFileEnv, Value: "/var/lib/automation/endpoint/token"})
+		assert.Contains(t, agent.Env, corev1.EnvVar{Name: automationConfigCAFileEnv, Value: "/var/lib/automation/endpoint/ca.crt"})
+		assert.Contains(t, agent.Env, corev1.EnvVar{Name: automationConfigFileEnv, Value: clusterFilePath})
+		assert.Contains(t, agent.Command[len(agent.Command)-1], "(/hooks/version-upgrade -poll-automation-config; kill 1) &")
+		assert.NotContains(t, agent.Command[len(agent.Command)-1], automationConfigMountPath)
+	})
+
+	t.Run("The automation config is served with the token of the resource", func(t *testing.T) {
+		cm, err := r.client.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace})
+		assert.NoError(t, err)
+		expected, err := automationConfigBytes(cm)
+		assert.NoError(t, err)
+
+		handler := acendpoint.Handler(NewAutomationConfigSource(mgr.GetClient()))
+		req := httptest.NewRequest(http.MethodGet, "/automation-config/my-ns/my-rs", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, string(expected), rec.Body.String())
+	})
+
+	t.Run("The token is kept", func(t *testing.T) {
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		readToken, err := secret.ReadKey(r.client, automationConfigTokenKey, tokenSecret)
+		assert.NoError(t, err)
+		assert.Equal(t, token, readToken)
+	})
+}
+
+func TestEnsureAutomationConfigToken_RequiresTheEndpoint(t *testing.T) {
+	mdb := newAutomationConfigEndpointReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	assert.Error(t, r.ensureAutomationConfigToken(mdb), "the operator doesn't serve the automation configs")
+
+	mdb.Spec.AutomationConfigDelivery = mdbv1.ConfigMapDelivery
+	assert.NoError(t, r.ensureAutomationConfigToken(mdb))
+	_, err := r.client.GetSecret(types.NamespacedName{Name: mdb.AutomationConfigTokenSecretName(), Namespace: mdb.Namespace})
+	assert.Error(t, err, "the token is only generated for the Endpoint delivery")
+}
+
+func TestAgentCommand_ConfigMapDelivery(t *testing.T) {
+	command := agentCommand(testutils.NewTestReplicaSet(), "")
+	assert.Contains(t, command, "gunzip -c /var/lib/automation/config/automation-config.gz > /tmp/automation-config.tmp")
+	assert.NotContains(t, command, "-poll-automation-config")
+}
@@ -0,0 +1,510 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/cron"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	backupCompletedEventReason = "BackupCompleted"
+	backupFailedEventReason    = "BackupFailed"
+
+	backupContainerName       = "backup"
+	backupUploadContainerName = "upload"
+	// backupMountPath is where the volume the backups are stored in is mounted in the backup container
+	backupMountPath = "/backup"
+	// backupStreamPath is where the volume holding the pipe the archive is streamed through is mounted
+	backupStreamPath = "/stream"
+	// backupBackoffLimit is the number of times a backup is retried before it is considered failed
+	backupBackoffLimit = 2
+
+	s3SSEAES256 = "AES256"
+	s3SSEKMS    = "aws:kms"
+)
+
+// validateBackup ensures the schedule of spec.backup can be parsed and a target supported by the
+// method is set
+func validateBackup(mdb mdbv1.MongoDB) error {
+	backup := mdb.Spec.Backup
+	if backup == nil {
+		return nil
+	}
+	if _, err := cron.Parse(backup.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule: %s", err)
+	}
+	if backup.Method == mdbv1.BackupMethodPBM {
+		if err := validatePBMBackup(*backup); err != nil {
+			return err
+		}
+	} else if backup.Method == mdbv1.BackupMethodSnapshot {
+		if backup.Target.VolumeSnapshot == nil {
+			return fmt.Errorf("the snapshot method requires a volumeSnapshot target")
+		}
+		if backup.Retention != nil {
+			return fmt.Errorf("a retention isn't supported with the snapshot method")
+		}
+		if backup.Encryption != nil {
+			return fmt.Errorf("encryption isn't supported with the snapshot method, encrypt the volumes with their StorageClass instead")
+		}
+	} else {
+		if err := validateBackupMethod(backup.Method); err != nil {
+			return err
+		}
+		if backup.Target.VolumeSnapshot != nil {
+			return fmt.Errorf("a volumeSnapshot target requires the snapshot method")
+		}
+	}
+	if err := validateBackupRetention(backup.Retention); err != nil {
+		return err
+	}
+	if err := validateBackupPointInTime(*backup); err != nil {
+		return err
+	}
+	if err := validateBackupEncryption(backup.Encryption); err != nil {
+		return err
+	}
+	if err := validateBackupVerification(*backup); err != nil {
+		return err
+	}
+	return validateBackupTarget(backup.Target)
+}
+
+func validateBackupMethod(method mdbv1.BackupMethod) error {
+	if method != "" && method != mdbv1.BackupMethodMongodump {
+		return fmt.Errorf("unsupported method %s", method)
+	}
+	return nil
+}
+
+// validateBackupTarget ensures exactly one target is set, and that it is valid
+func validateBackupTarget(target mdbv1.BackupTarget) error {
+	volume, s3, snapshot := target.PersistentVolumeClaim, target.S3, target.VolumeSnapshot
+	targets := 0
+	for _, set := range []bool{volume != nil, s3 != nil, snapshot != nil} {
+		if set {
+			targets++
+		}
+	}
+	switch {
+	case targets == 0:
+		return fmt.Errorf("a target must be set")
+	case targets > 1:
+		return fmt.Errorf("only one target can be set")
+	case volume != nil:
+		if volume.ClaimName == "" {
+			return fmt.Errorf("the claim name of the target must be set")
+		}
+		if strings.Contains(volume.Path, "..") {
+			return fmt.Errorf("the path of the target must not contain \"..\"")
+		}
+	case s3 != nil:
+		return validateS3BackupTarget(*s3)
+	}
+	return nil
+}
+
+func validateS3BackupTarget(s3 mdbv1.BackupS3Target) error {
+	if s3.Bucket == "" {
+		return fmt.Errorf("the bucket of the target must be set")
+	}
+	if s3.Endpoint != "" {
+		if endpoint, err := url.Parse(s3.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return fmt.Errorf("the endpoint of the target must be an http:// or https:// URL")
+		}
+	}
+	if sse := s3.ServerSideEncryption; sse != nil {
+		if sse.Algorithm != s3SSEAES256 && sse.Algorithm != s3SSEKMS {
+			return fmt.Errorf("unsupported server-side encryption algorithm %s", sse.Algorithm)
+		}
+		if sse.KMSKeyID != "" && sse.Algorithm != s3SSEKMS {
+			return fmt.Errorf("a KMS key can only be used with the %s server-side encryption algorithm", s3SSEKMS)
+		}
+	}
+	return nil
+}
+
+func backupCronJobNamespacedName(mdb mdbv1.MongoDB) types.NamespacedName {
+	return types.NamespacedName{Name: mdb.Name + "-backup", Namespace: mdb.Namespace}
+}
+
+// ensureBackupCronJob creates or updates the CronJob taking the backups of spec.backup, or deletes it
+// and clears status.backup once spec.backup is removed. There is no CronJob with the snapshot method,
+// whose backups are taken by the operator.
+func (r *ReplicaSetReconciler) ensureBackupCronJob(mdb mdbv1.MongoDB) error {
+	nsName := backupCronJobNamespacedName(mdb)
+	existing := batchv1beta1.CronJob{}
+	err := r.client.Get(context.TODO(), nsName, &existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting backup CronJob: %s", err)
+	}
+	found := err == nil
+
+	if mdb.Spec.Backup == nil || mdb.Spec.Backup.Method == mdbv1.BackupMethodSnapshot {
+		if found {
+			if err := r.client.Delete(context.TODO(), &existing); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("error deleting backup CronJob: %s", err)
+			}
+			r.log.Infof("Deleted the backup CronJob %s", nsName.Name)
+		}
+		if mdb.Spec.Backup != nil {
+			return nil
+		}
+		return r.setBackupStatus(mdb, nil)
+	}
+
+	desired := buildBackupCronJob(mdb)
+	if !found {
+		if err := r.client.Create(context.TODO(), &desired); err != nil {
+			return fmt.Errorf("error creating backup CronJob: %s", err)
+		}
+		r.log.Infof("Scheduled backups with the CronJob %s", nsName.Name)
+		return nil
+	}
+	if reflect.DeepEqual(existing.Spec, desired.Spec) {
+		return nil
+	}
+	existing.Spec = desired.Spec
+	if err := r.client.Update(context.TODO(), &existing); err != nil {
+		return fmt.Errorf("error updating backup CronJob: %s", err)
+	}
+	return nil
+}
+
+// buildBackupCronJob returns the CronJob taking the backups of spec.backup on its schedule, as
+// archives named after the resource and the time the backup was scheduled at, which is read from
+// the name of the Job so that the operator knows the name of the archive of each Job. With the pbm
+// method, the backups are named by PBM.
+func buildBackupCronJob(mdb mdbv1.MongoDB) batchv1beta1.CronJob {
+	backup := mdb.Spec.Backup
+	labels := map[string]string{"app": mdb.Name + "-backup"}
+	var template corev1.PodTemplateSpec
+	if usesPBM(mdb) {
+		template = pbmBackupPodTemplate(mdb, labels)
+	} else {
+		template = backupPodTemplate(mdb, backup.Target, backup.Encryption, mdb.Name+"-${timestamp}.archive.gz", scheduledBackupTimestampScript, labels)
+	}
+	for _, c := range template.Spec.Containers {
+		podtemplatespec.WithContainer(c.Name, container.WithEnvs(corev1.EnvVar{
+			Name:      "JOB_NAME",
+			ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels['job-name']"}},
+		}))(&template)
+	}
+
+	backoffLimit := int32(backupBackoffLimit)
+	suspend := backup.Suspend
+	nsName := backupCronJobNamespacedName(mdb)
+	return batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            nsName.Name,
+			Namespace:       nsName.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:          backup.Schedule,
+			ConcurrencyPolicy: batchv1beta1.ForbidConcurrent,
+			Suspend:           &suspend,
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template:     template,
+				},
+			},
+		},
+	}
+}
+
+// backupPodTemplate returns the template of the Pods running mongodump against a secondary, which
+// write a gzipped archive with the given name, which is evaluated by the shell after the setup script,
+// to the target, encrypted with the key of the encryption if any. The agent user is used when
+// authentication is enabled.
+func backupPodTemplate(mdb mdbv1.MongoDB, target mdbv1.BackupTarget, encryption *mdbv1.BackupEncryption, archiveName, setup string, labels map[string]string) corev1.PodTemplateSpec {
+	uri, connectionOptions, connection := mongoToolConnection(mdb, backupContainerName)
+	mongodump := fmt.Sprintf(`mongodump --uri "%s"%s --readPreference=secondaryPreferred --gzip`, uri, connectionOptions)
+	encrypted := encryption != nil
+	var targetModification podtemplatespec.Modification
+	if target.S3 != nil {
+		targetModification = s3BackupTarget(mdb, *target.S3, archiveName, setup, mongodump, encrypted)
+	} else {
+		targetModification = volumeBackupTarget(mdb, *target.PersistentVolumeClaim, archiveName, setup, mongodump, encrypted)
+	}
+	encryptionModification := podtemplatespec.NOOP()
+	if encrypted {
+		encryptionModification = podtemplatespec.Apply(
+			withBackupCrypt(backupContainerName),
+			podtemplatespec.WithContainer(backupContainerName, encryptionKey(*encryption, encryptionKeyEnv)),
+		)
+	}
+
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		targetModification,
+		encryptionModification,
+		connection,
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	return template
+}
+
+// backupLocation returns where the archive with the given name is stored in the target
+func backupLocation(target mdbv1.BackupTarget, archiveName string) string {
+	if target.S3 != nil {
+		return s3BackupObject(*target.S3, archiveName)
+	}
+	return fmt.Sprintf("%s:%s", target.PersistentVolumeClaim.ClaimName, path.Join("/", target.PersistentVolumeClaim.Path, archiveName))
+}
+
+func s3BackupObject(target mdbv1.BackupS3Target, archiveName string) string {
+	return fmt.Sprintf("s3://%s/%s", target.Bucket, path.Join(target.Prefix, archiveName))
+}
+
+// s3EndpointOption returns the option of the AWS CLI to use the endpoint of the target, if any
+func s3EndpointOption(target mdbv1.BackupS3Target) string {
+	if target.Endpoint == "" {
+		return ""
+	}
+	return fmt.Sprintf(` --endpoint-url "%s"`, target.Endpoint)
+}
+
+// s3EncryptionOptions returns the options of "aws s3 cp" encrypting the uploaded objects with the
+// server-side encryption of the target, if any
+func s3EncryptionOptions(target mdbv1.BackupS3Target) string {
+	sse := target.ServerSideEncryption
+	if sse == nil {
+		return ""
+	}
+	options := fmt.Sprintf(" --sse %s", sse.Algorithm)
+	if sse.KMSKeyID != "" {
+		options += fmt.Sprintf(` --sse-kms-key-id "%s"`, sse.KMSKeyID)
+	}
+	return options
+}
+
+// s3Credentials returns the modification providing the region and the credentials of the target to
+// the container running the AWS CLI
+func s3Credentials(target mdbv1.BackupS3Target) container.Modification {
+	var envs []corev1.EnvVar
+	if target.Region != "" {
+		envs = append(envs, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: target.Region})
+	}
+	credentials := container.NOOP()
+	if target.CredentialsSecretName != "" {
+		credentials = container.WithEnvFrom(corev1.EnvFromSource{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: target.CredentialsSecretName}},
+		})
+	}
+	return container.Apply(container.WithEnvs(envs...), credentials)
+}
+
+// volumeBackupTarget returns the modification writing the archive to the PersistentVolumeClaim of the
+// target, the backup container reports the size of the archive as its termination message
+func volumeBackupTarget(mdb mdbv1.MongoDB, target mdbv1.BackupVolumeTarget, archiveName, setup, mongodump string, encrypted bool) podtemplatespec.Modification {
+	volume := statefulset.CreateVolumeFromPersistentVolumeClaim("backup", target.ClaimName)
+	volumeMount := statefulset.CreateVolumeMount(volume.Name, backupMountPath, statefulset.WithReadOnly(false))
+	dir := path.Join(backupMountPath, target.Path)
+	dump := fmt.Sprintf(`%s --archive="%s/%s"`, mongodump, dir, archiveName)
+	if encrypted {
+		dump = encryptedDump(mongodump, fmt.Sprintf(`> "%s/%s"`, dir, archiveName))
+	}
+	command := fmt.Sprintf(`%smkdir -p %s && %s && wc -c < "%s/%s" > %s`, setup, dir, dump, dir, archiveName, corev1.TerminationMessagePathDefault)
+	return podtemplatespec.Apply(
+		podtemplatespec.WithVolume(volume),
+		podtemplatespec.WithContainer(backupContainerName, container.Apply(
+			container.WithName(backupContainerName),
+			container.WithImage(fmt.Sprintf("mongo:%s", mdb.Spec.Version)),
+			container.WithCommand([]string{"/bin/sh", "-c", command}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+		)),
+	)
+}
+
+// s3BackupTarget returns the modification streaming the archive to the bucket of the target. mongodump
+// writes the archive to a named pipe, created by an init container in a volume shared with the upload
+// container, which reads it with the AWS CLI. As the upload completes even if mongodump fails, the exit
+// code of mongodump is written to the volume before the pipe is closed, and the upload container
+// deletes the incomplete archive and fails when it isn't 0. Otherwise, the upload container reports the
+// size of the uploaded archive as its termination message.
+func s3BackupTarget(mdb mdbv1.MongoDB, target mdbv1.BackupS3Target, archiveName, setup, mongodump string, encrypted bool) podtemplatespec.Modification {
+	volume := statefulset.CreateVolumeFromEmptyDir("stream")
+	volumeMount := statefulset.CreateVolumeMount(volume.Name, backupStreamPath, statefulset.WithReadOnly(false))
+	pipe, exitCode := backupStreamPath+"/archive", backupStreamPath+"/exit-code"
+
+	dump := mongodump + " --archive >&3"
+	if encrypted {
+		dump = encryptedDump(mongodump, ">&3")
+	}
+	dumpCommand := fmt.Sprintf(`exec 3>%s; %s; code=$?; echo $code > %s; exec 3>&-; exit $code`, pipe, dump, exitCode)
+
+	endpoint := s3EndpointOption(target)
+	cpOptions := s3EncryptionOptions(target)
+	reportSize := fmt.Sprintf(`aws%s s3api head-object --bucket "%s" --key "%s" --query ContentLength --output text > %s`,
+		endpoint, target.Bucket, path.Join(target.Prefix, archiveName), corev1.TerminationMessagePathDefault)
+	uploadCommand := fmt.Sprintf(`%sobject="%s"; aws%s s3 cp%s - "$object" < %s && [ "$(cat %s)" = 0 ] && { %s; exit 0; }; aws%s s3 rm "$object"; exit 1`,
+		setup, s3BackupObject(target, archiveName), endpoint, cpOptions, pipe, exitCode, reportSize, endpoint)
+
+	mongoImage := fmt.Sprintf("mongo:%s", mdb.Spec.Version)
+	return podtemplatespec.Apply(
+		podtemplatespec.WithVolume(volume),
+		podtemplatespec.WithInitContainer("create-stream", container.Apply(
+			container.WithName("create-stream"),
+			container.WithImage(mongoImage),
+			container.WithCommand([]string{"/bin/sh", "-c", fmt.Sprintf("rm -f %s %s && mkfifo %s", pipe, exitCode, pipe)}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+		)),
+		podtemplatespec.WithContainer(backupContainerName, container.Apply(
+			container.WithName(backupContainerName),
+			container.WithImage(mongoImage),
+			container.WithCommand([]string{"/bin/sh", "-c", dumpCommand}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+		)),
+		podtemplatespec.WithContainer(backupUploadContainerName, container.Apply(
+			container.WithName(backupUploadContainerName),
+			container.WithImage(awsCLIImage),
+			container.WithCommand([]string{"/bin/sh", "-c", uploadCommand}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+			s3Credentials(target),
+		)),
+	)
+}
+
+// updateBackupStatus records the outcome of the last backup scheduled by the backup CronJob in
+// status.backup, and emits an event once it completes or fails. The successful backups are tracked
+// and the expired ones pruned when spec.backup.retention is set, and the outcome of the last
+// verification is recorded when spec.backup.verification is set. The backups of the snapshot method
+// are taken here, as there is no CronJob.
+func (r *ReplicaSetReconciler) updateBackupStatus(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.Backup == nil || mdb.DeletionTimestamp != nil {
+		return nil
+	}
+	if mdb.Spec.Backup.Method == mdbv1.BackupMethodSnapshot {
+		return r.updateSnapshotBackup(mdb)
+	}
+	cronJob := batchv1beta1.CronJob{}
+	if err := r.client.Get(context.TODO(), backupCronJobNamespacedName(mdb), &cronJob); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting backup CronJob: %s", err)
+	}
+
+	status := mdbv1.BackupStatus{}
+	if mdb.Status.Backup != nil {
+		status = *mdb.Status.Backup
+	}
+	previousJob, previousPhase := status.LastJob, status.LastPhase
+	job, err := r.lastBackupJob(cronJob)
+	if err != nil {
+		return err
+	}
+	if cronJob.Status.LastScheduleTime != nil {
+		status.LastScheduleTime = cronJob.Status.LastScheduleTime
+	}
+	if job != nil {
+		status.LastJob, status.LastPhase, status.Message = job.Name, mdbv1.BackupRunning, ""
+		if job.Status.Succeeded > 0 {
+			status.LastPhase = mdbv1.BackupSucceeded
+			status.LastSuccessfulTime = job.Status.CompletionTime
+		}
+		if message, failed := jobFailure(*job); failed {
+			status.LastPhase, status.Message = mdbv1.BackupFailed, message
+		}
+	}
+	changed := job != nil && (previousJob != status.LastJob || previousPhase != status.LastPhase)
+	if changed && status.LastPhase == mdbv1.BackupSucceeded {
+		size, err := jobArchiveSize(r.client, *job)
+		if err != nil {
+			return err
+		}
+		status.LastSize, status.ConsecutiveFailures = size, 0
+	}
+	if changed && status.LastPhase == mdbv1.BackupFailed {
+		status.ConsecutiveFailures++
+	}
+	if changed && status.LastPhase == mdbv1.BackupSucceeded && mdb.Spec.Backup.Retention != nil {
+		status.Archives = trackBackupArchive(status.Archives, mdbv1.BackupArchive{
+			Location: backupLocation(mdb.Spec.Backup.Target, scheduledBackupArchiveName(mdb, status.LastScheduleTime.Time)),
+			Time:     *status.LastScheduleTime,
+		})
+	}
+	if err := r.pruneBackups(mdb, &status); err != nil {
+		return err
+	}
+	previousVerification := status.LastVerification
+	if err := r.updateBackupVerification(mdb, &status); err != nil {
+		return err
+	}
+	if err := r.setBackupStatus(mdb, &status); err != nil {
+		return err
+	}
+	r.recordBackupVerificationEvents(mdb, previousVerification, status.LastVerification)
+
+	if !changed {
+		return nil
+	}
+	switch status.LastPhase {
+	case mdbv1.BackupSucceeded:
+		r.log.Infof("Backup %s completed", job.Name)
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, backupCompletedEventReason, "Backup %s completed", job.Name)
+		}
+	case mdbv1.BackupFailed:
+		r.log.Warnf("Backup failed: %s", status.Message)
+		if r.recorder != nil {
+			r.recorder.Event(&mdb, corev1.EventTypeWarning, backupFailedEventReason, status.Message)
+		}
+	}
+	return nil
+}
+
+// lastBackupJob returns the Job of the last backup scheduled by the CronJob, or nil if there is none
+func (r *ReplicaSetReconciler) lastBackupJob(cronJob batchv1beta1.CronJob) (*batchv1.Job, error) {
+	lastScheduleTime := cronJob.Status.LastScheduleTime
+	if lastScheduleTime == nil {
+		return nil, nil
+	}
+	// the CronJob controller names the Jobs after the minute they are scheduled at
+	jobName := fmt.Sprintf("%s-%d", cronJob.Name, lastScheduleTime.Unix()/60)
+	job := batchv1.Job{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: jobName, Namespace: cronJob.Namespace}, &job); err != nil {
+		if errors.IsNotFound(err) {
+			// the Job isn't created yet, or was deleted with the history of the CronJob
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting backup job %s: %s", jobName, err)
+	}
+	return &job, nil
+}
+
+func (r *ReplicaSetReconciler) setBackupStatus(mdb mdbv1.MongoDB, status *mdbv1.BackupStatus) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	recordBackupMetrics(mdb.NamespacedName(), status)
+	if reflect.DeepEqual(newMdb.Status.Backup, status) {
+		return nil
+	}
+	newMdb.Status.Backup = status
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package mongodb
+
+import (
+	"fmt"
+	"os"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	backupCryptName = "backup-crypt"
+	// backupCryptPath is where the volume holding the encryption tool is mounted
+	backupCryptPath = "/backup-crypt"
+	// backupCryptCommand encrypts or decrypts stdin to stdout, it is the version upgrade hook binary
+	backupCryptCommand = backupCryptPath + "/backup-crypt"
+
+	// the environment variables with the keys of the archive and of the archived oplog, read by
+	// backupCryptCommand, and the key of the Secrets holding them
+	encryptionKeyEnv       = "BACKUP_ENCRYPTION_KEY"
+	oplogEncryptionKeyEnv  = "OPLOG_ENCRYPTION_KEY"
+	encryptionKeySecretKey = "key"
+)
+
+// validateBackupEncryption ensures the Secret of the key is set
+func validateBackupEncryption(encryption *mdbv1.BackupEncryption) error {
+	if encryption != nil && encryption.KeySecretName == "" {
+		return fmt.Errorf("the keySecretName of encryption must be set")
+	}
+	return nil
+}
+
+// withBackupCrypt returns the modification copying the encryption tool from the version upgrade hook
+// image to a volume mounted in the given containers, with an init container
+func withBackupCrypt(containerNames ...string) podtemplatespec.Modification {
+	volume := statefulset.CreateVolumeFromEmptyDir(backupCryptName)
+	volumeMount := statefulset.CreateVolumeMount(volume.Name, backupCryptPath, statefulset.WithReadOnly(false))
+	mods := []podtemplatespec.Modification{
+		podtemplatespec.WithVolume(volume),
+		podtemplatespec.WithInitContainer(backupCryptName, container.Apply(
+			container.WithName(backupCryptName),
+			container.WithImage(os.Getenv(versionUpgradeHookImageEnv)),
+			container.WithCommand([]string{"cp", "version-upgrade-hook", backupCryptCommand}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+		)),
+	}
+	for _, name := range containerNames {
+		mods = append(mods, podtemplatespec.WithVolumeMounts(name, volumeMount))
+	}
+	return podtemplatespec.Apply(mods...)
+}
+
+// encryptionKey returns the modification exposing the key of the encryption to the container, as the
+// given environment variable
+func encryptionKey(encryption mdbv1.BackupEncryption, env string) container.Modification {
+	return container.WithEnvs(corev1.EnvVar{
+		Name: env,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: encryption.KeySecretName},
+				Key:                  encryptionKeySecretKey,
+			},
+		},
+	})
+}
+
+// encryptedDump returns the command running mongodump with its archive written to stdout, and
+// encrypted to the given redirection. Its exit code is the one of mongodump, unless the encryption
+// fails.
+func encryptedDump(mongodump, redirection string) string {
+	return fmt.Sprintf(`( { %s --archive; echo $? > /tmp/dump-code; } | %s -encrypt %s && exit "$(cat /tmp/dump-code)" )`,
+		mongodump, backupCryptCommand, redirection)
+}
+
+// decryptCommand returns the command decrypting the given file to stdout with the key of the given
+// environment variable
+func decryptCommand(file, keyEnv string) string {
+	return fmt.Sprintf(`%s -decrypt -key-env %s < %s`, backupCryptCommand, keyEnv, file)
+}
@@ -0,0 +1,114 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func assertEncryptionKey(t *testing.T, c corev1.Container, env, secretName string) {
+	for _, e := range c.Env {
+		if e.Name == env {
+			if assert.NotNil(t, e.ValueFrom) && assert.NotNil(t, e.ValueFrom.SecretKeyRef) {
+				assert.Equal(t, secretName, e.ValueFrom.SecretKeyRef.Name)
+				assert.Equal(t, "key", e.ValueFrom.SecretKeyRef.Key)
+			}
+			return
+		}
+	}
+	t.Errorf("the environment variable %s isn't set in the container %s", env, c.Name)
+}
+
+func assertHasBackupCrypt(t *testing.T, podSpec corev1.PodSpec, containerName string) {
+	var initContainer *corev1.Container
+	for i := range podSpec.InitContainers {
+		if podSpec.InitContainers[i].Name == backupCryptName {
+			initContainer = &podSpec.InitContainers[i]
+		}
+	}
+	if assert.NotNil(t, initContainer) {
+		assert.Equal(t, []string{"cp", "version-upgrade-hook", "/backup-crypt/backup-crypt"}, initContainer.Command)
+	}
+	for _, c := range podSpec.Containers {
+		if c.Name == containerName {
+			assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: backupCryptName, MountPath: backupCryptPath})
+		}
+	}
+}
+
+func TestBuildBackupCronJob_Encryption(t *testing.T) {
+	t.Run("To a volume", func(t *testing.T) {
+		mdb := newBackupReplicaSet()
+		mdb.Spec.Backup.Encryption = &mdbv1.BackupEncryption{KeySecretName: "backup-key"}
+		podSpec := buildBackupCronJob(mdb).Spec.JobTemplate.Spec.Template.Spec
+		assertHasBackupCrypt(t, podSpec, backupContainerName)
+		backupContainer := podSpec.Containers[0]
+		assert.Contains(t, backupContainer.Command[2], `--gzip --archive; echo $? > /tmp/dump-code; } | /backup-crypt/backup-crypt -encrypt > "/backup/my-rs/my-rs-${timestamp}.archive.gz" && exit "$(cat /tmp/dump-code)" )`)
+		assertEncryptionKey(t, backupContainer, encryptionKeyEnv, "backup-key")
+	})
+
+	t.Run("To S3", func(t *testing.T) {
+		mdb := newPointInTimeReplicaSet()
+		mdb.Spec.Backup.Encryption = &mdbv1.BackupEncryption{KeySecretName: "backup-key"}
+		podSpec := buildBackupCronJob(mdb).Spec.JobTemplate.Spec.Template.Spec
+		assertHasBackupCrypt(t, podSpec, backupContainerName)
+		backupContainer := podSpec.Containers[0]
+		assert.Contains(t, backupContainer.Command[2], `| /backup-crypt/backup-crypt -encrypt >&3 && exit "$(cat /tmp/dump-code)" ); code=$?; echo $code > /stream/exit-code`)
+		assertEncryptionKey(t, backupContainer, encryptionKeyEnv, "backup-key")
+
+		archive := buildOplogArchiveDeployment(mdb).Spec.Template.Spec
+		assertHasBackupCrypt(t, archive, oplogArchiveContainerName)
+		assert.Contains(t, archive.Containers[0].Command[2], `| gzip | /backup-crypt/backup-crypt -encrypt > "$slice.tmp"`)
+		assertEncryptionKey(t, archive.Containers[0], encryptionKeyEnv, "backup-key")
+	})
+}
+
+func TestBuildRestoreJob_DecryptsTheArchive(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	backup := newTestMongoDBBackup()
+	backup.Spec.Encryption = &mdbv1.BackupEncryption{KeySecretName: "backup-key"}
+	restore := newTestMongoDBRestore()
+	replay := oplogReplay{
+		target:     *newPointInTimeReplicaSet().Spec.Backup.Target.S3,
+		encryption: &mdbv1.BackupEncryption{KeySecretName: "oplog-key"},
+		from:       time.Date(2026, 1, 3, 3, 0, 0, 0, time.UTC),
+		until:      time.Date(2026, 1, 3, 10, 15, 0, 0, time.UTC),
+	}
+	podSpec := buildRestoreJob(restore, mdb, &backup, &replay).Spec.Template.Spec
+
+	assertHasBackupCrypt(t, podSpec, restoreContainerName)
+	restoreContainer := podSpec.Containers[0]
+	command := restoreContainer.Command[2]
+	assert.Contains(t, command, `for slice in /oplog/*.bson.gz; do /backup-crypt/backup-crypt -decrypt -key-env OPLOG_ENCRYPTION_KEY < "$slice" > "$slice.dec" && gunzip < "$slice.dec" >> /oplog/oplog.bson && rm "$slice.dec" || exit 1; done`)
+	assert.Contains(t, command, `{ /backup-crypt/backup-crypt -decrypt -key-env BACKUP_ENCRYPTION_KEY < /backup/my-rs/before-migration.archive.gz; echo $? > /tmp/decrypt-code; } | mongorestore`)
+	assert.Contains(t, command, `--archive --gzip --drop && [ "$(cat /tmp/decrypt-code)" = 0 ] && exec mongorestore`)
+	assertEncryptionKey(t, restoreContainer, encryptionKeyEnv, "backup-key")
+	assertEncryptionKey(t, restoreContainer, oplogEncryptionKeyEnv, "oplog-key")
+
+	t.Run("The key of the restore is used for an archiveURL", func(t *testing.T) {
+		restore.Spec.Backup, restore.Spec.ArchiveURL = "", "https://backups.example.com/my-rs.archive.gz"
+		restore.Spec.Encryption = &mdbv1.BackupEncryption{KeySecretName: "restore-key"}
+		podSpec := buildRestoreJob(restore, mdb, nil, nil).Spec.Template.Spec
+		command := podSpec.Containers[0].Command[2]
+		assert.Contains(t, command, "-decrypt -key-env BACKUP_ENCRYPTION_KEY < /archive/archive.gz")
+		assert.NotContains(t, command, "exec", "mongorestore isn't the only command")
+		assertEncryptionKey(t, podSpec.Containers[0], encryptionKeyEnv, "restore-key")
+	})
+}
+
+func TestValidateBackup_Encryption(t *testing.T) {
+	mdb := newBackupReplicaSet()
+	mdb.Spec.Backup.Encryption = &mdbv1.BackupEncryption{KeySecretName: "backup-key"}
+	assert.NoError(t, validateBackup(mdb))
+
+	mdb.Spec.Backup.Encryption.KeySecretName = ""
+	assert.EqualError(t, validateBackup(mdb), "the keySecretName of encryption must be set")
+
+	mdb = newSnapshotBackupReplicaSet()
+	mdb.Spec.Backup.Encryption = &mdbv1.BackupEncryption{KeySecretName: "backup-key"}
+	assert.EqualError(t, validateBackup(mdb), "encryption isn't supported with the snapshot method, encrypt the volumes with their StorageClass instead")
+}
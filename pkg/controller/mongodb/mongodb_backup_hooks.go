@@ -0,0 +1,234 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	backupFreezeStartedEventReason  = "BackupFreezeStarted"
+	backupFreezeReleasedEventReason = "BackupFreezeReleased"
+	backupFreezeExpiredEventReason  = "BackupFreezeExpired"
+
+	// backupFreezeAnnotationKey requests the writes of the member it is set to to be locked, until
+	// it is removed
+	backupFreezeAnnotationKey = "mongodb.com/v1.backupFreeze"
+	// backupCheckpointAnnotationKey is set on the Pod of the member whose writes are locked for the
+	// backupFreeze annotation, to the time they were locked at, so that the backup tool knows when
+	// its volumes can be backed up
+	backupCheckpointAnnotationKey = "mongodb.com/v1.backupCheckpoint"
+
+	defaultBackupFreezeTimeout = 5 * time.Minute
+
+	// the annotations of the Pods read by Velero, see https://velero.io/docs/main/backup-hooks/
+	veleroPreHookContainerAnnotationKey  = "pre.hook.backup.velero.io/container"
+	veleroPreHookCommandAnnotationKey    = "pre.hook.backup.velero.io/command"
+	veleroPostHookContainerAnnotationKey = "post.hook.backup.velero.io/container"
+	veleroPostHookCommandAnnotationKey   = "post.hook.backup.velero.io/command"
+)
+
+// backupFreezeTimeout returns how long the writes of a member stay locked for the backupFreeze
+// annotation at most
+func backupFreezeTimeout(mdb mdbv1.MongoDB) time.Duration {
+	if mdb.Spec.BackupHooks == nil || mdb.Spec.BackupHooks.FreezeTimeoutSeconds == 0 {
+		return defaultBackupFreezeTimeout
+	}
+	return time.Duration(mdb.Spec.BackupHooks.FreezeTimeoutSeconds) * time.Second
+}
+
+func validateBackupHooks(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.BackupHooks != nil && mdb.Spec.BackupHooks.FreezeTimeoutSeconds < 0 {
+		return fmt.Errorf("freezeTimeoutSeconds can't be negative")
+	}
+	return nil
+}
+
+// buildBackupHooksPodSpecModification annotates the Pods of the members with the Velero backup hooks
+// when spec.backupHooks.velero is set. The hooks run the mongo shell in the mongod container, which
+// connects to its member as the agent.
+func buildBackupHooksPodSpecModification(mdb mdbv1.MongoDB) podtemplatespec.Modification {
+	if mdb.Spec.BackupHooks == nil || !mdb.Spec.BackupHooks.Velero {
+		return podtemplatespec.NOOP()
+	}
+	_, options, credentials := mongoToolConnection(mdb, mongodbName)
+	// the member is reached by the name of its Pod, which its TLS certificate is valid for
+	shell := fmt.Sprintf(`mongo --host "$(hostname -f)" --port 27017 --quiet%s admin --eval`, options)
+	hook := func(command string) string {
+		script := fmt.Sprintf(`%s "var res = %s; if (!res.ok) { print(tojson(res)); quit(1); }"`, shell, command)
+		encoded, _ := json.Marshal([]string{"/bin/sh", "-c", script})
+		return string(encoded)
+	}
+	return podtemplatespec.Apply(
+		credentials,
+		func(podTemplateSpec *corev1.PodTemplateSpec) {
+			if podTemplateSpec.Annotations == nil {
+				podTemplateSpec.Annotations = map[string]string{}
+			}
+			podTemplateSpec.Annotations[veleroPreHookContainerAnnotationKey] = mongodbName
+			podTemplateSpec.Annotations[veleroPreHookCommandAnnotationKey] = hook("db.fsyncLock()")
+			podTemplateSpec.Annotations[veleroPostHookContainerAnnotationKey] = mongodbName
+			podTemplateSpec.Annotations[veleroPostHookCommandAnnotationKey] = hook("db.fsyncUnlock()")
+		},
+	)
+}
+
+// reconcileBackupFreeze locks the writes of the member set in the backupFreeze annotation of the
+// resource with fsyncLock, and sets the backupCheckpoint annotation on its Pod once they are. The
+// writes are unlocked and the checkpoint removed when the annotation is removed or changed, or once
+// the freeze timeout has elapsed. The member whose writes are locked is recorded in
+// status.backupFreeze, so that they are unlocked by a later reconciliation.
+func (r *ReplicaSetReconciler) reconcileBackupFreeze(mdb mdbv1.MongoDB) error {
+	requested := mdb.Annotations[backupFreezeAnnotationKey]
+	current := mdb.Status.BackupFreeze
+	if current != nil && current.Member != requested {
+		if !current.Expired {
+			if err := r.unlockBackupFreeze(mdb, *current); err != nil {
+				return err
+			}
+			r.log.Infof("Unlocked the writes of %s", current.Member)
+			if r.recorder != nil {
+				r.recorder.Eventf(&mdb, corev1.EventTypeNormal, backupFreezeReleasedEventReason, "Unlocked the writes of %s", current.Member)
+			}
+		}
+		current = nil
+		if err := r.setBackupFreezeStatus(mdb, nil); err != nil {
+			return err
+		}
+	}
+	if requested == "" {
+		return nil
+	}
+
+	if current == nil {
+		if !isMemberPod(mdb, requested) {
+			return fmt.Errorf("%s isn't a member of the replica set", requested)
+		}
+		if err := r.lockBackupFreeze(mdb, requested); err != nil {
+			return err
+		}
+		current = &mdbv1.BackupFreezeStatus{Member: requested, LockedAt: metav1.NewTime(r.now())}
+		if err := r.setBackupFreezeStatus(mdb, current); err != nil {
+			return err
+		}
+		r.log.Infof("Locked the writes of %s for a backup", requested)
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, backupFreezeStartedEventReason, "Locked the writes of %s for a backup", requested)
+		}
+	}
+	if current.Expired {
+		return nil
+	}
+
+	expiresAt := current.LockedAt.Add(backupFreezeTimeout(mdb))
+	if r.now().Before(expiresAt) {
+		r.backupFreezeExpiresAt = expiresAt
+		return nil
+	}
+	if err := r.unlockBackupFreeze(mdb, *current); err != nil {
+		return err
+	}
+	expired := *current
+	expired.Expired = true
+	if err := r.setBackupFreezeStatus(mdb, &expired); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Unlocked the writes of %s after %s, remove the %s annotation once the backup is taken", current.Member, backupFreezeTimeout(mdb), backupFreezeAnnotationKey)
+	r.log.Warn(message)
+	if r.recorder != nil {
+		r.recorder.Event(&mdb, corev1.EventTypeWarning, backupFreezeExpiredEventReason, message)
+	}
+	return nil
+}
+
+// isMemberPod returns true if the Pod with the given name runs one of the members of the resource
+func isMemberPod(mdb mdbv1.MongoDB, podName string) bool {
+	for i := 0; i < mdb.Spec.Members; i++ {
+		if podName == fmt.Sprintf("%s-%d", mdb.Name, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockBackupFreeze locks the writes of the member and sets the checkpoint annotation on its Pod. The
+// writes are unlocked if the annotation can't be set.
+func (r *ReplicaSetReconciler) lockBackupFreeze(mdb mdbv1.MongoDB, member string) error {
+	reader, err := r.connectLiveClusterMember(mdb, member)
+	if err != nil {
+		return err
+	}
+	defer r.disconnectLiveCluster(context.TODO(), reader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+	defer cancel()
+	if err := reader.FsyncLock(ctx); err != nil {
+		return fmt.Errorf("error locking the writes of %s: %s", member, err)
+	}
+	nsName := types.NamespacedName{Name: member, Namespace: mdb.Namespace}
+	if err := r.setPodAnnotation(nsName, backupCheckpointAnnotationKey, r.now().UTC().Format(time.RFC3339)); err != nil {
+		if unlockErr := reader.FsyncUnlock(ctx); unlockErr != nil {
+			r.log.Warnf("Error unlocking the writes of %s: %s", member, unlockErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// unlockBackupFreeze removes the checkpoint annotation from the Pod of the locked member and unlocks
+// its writes. A member whose Pod is gone, or was recreated since, isn't locked anymore.
+func (r *ReplicaSetReconciler) unlockBackupFreeze(mdb mdbv1.MongoDB, freeze mdbv1.BackupFreezeStatus) error {
+	member := freeze.Member
+	nsName := types.NamespacedName{Name: member, Namespace: mdb.Namespace}
+	pod := corev1.Pod{}
+	if err := r.client.Get(context.TODO(), nsName, &pod); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting pod %s: %s", member, err)
+	}
+	if _, ok := pod.Annotations[backupCheckpointAnnotationKey]; ok {
+		if err := r.setPodAnnotation(nsName, backupCheckpointAnnotationKey, ""); err != nil {
+			return err
+		}
+	}
+	if freeze.LockedAt.Before(&pod.CreationTimestamp) {
+		return nil
+	}
+
+	reader, err := r.connectLiveClusterMember(mdb, member)
+	if err != nil {
+		return err
+	}
+	defer r.disconnectLiveCluster(context.TODO(), reader)
+	ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+	defer cancel()
+	if err := reader.FsyncUnlock(ctx); err != nil {
+		return fmt.Errorf("error unlocking the writes of %s: %s", member, err)
+	}
+	return nil
+}
+
+func (r *ReplicaSetReconciler) setBackupFreezeStatus(mdb mdbv1.MongoDB, status *mdbv1.BackupFreezeStatus) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if reflect.DeepEqual(newMdb.Status.BackupFreeze, status) {
+		return nil
+	}
+	newMdb.Status.BackupFreeze = status
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
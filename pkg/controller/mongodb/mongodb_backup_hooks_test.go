@@ -0,0 +1,124 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestBackupHooks_Velero(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.BackupHooks = &mdbv1.BackupHooks{Velero: true}
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	annotations := sts.Spec.Template.Annotations
+	assert.Equal(t, "true", annotations[safeToEvictAnnotationKey])
+	assert.Equal(t, mongodbName, annotations[veleroPreHookContainerAnnotationKey])
+	assert.Equal(t, mongodbName, annotations[veleroPostHookContainerAnnotationKey])
+
+	var preHook, postHook []string
+	assert.NoError(t, json.Unmarshal([]byte(annotations[veleroPreHookCommandAnnotationKey]), &preHook))
+	assert.NoError(t, json.Unmarshal([]byte(annotations[veleroPostHookCommandAnnotationKey]), &postHook))
+	assert.Equal(t, `mongo --host "$(hostname -f)" --port 27017 --quiet --username mms-automation --password "$AGENT_PASSWORD" --authenticationDatabase admin admin --eval "var res = db.fsyncLock(); if (!res.ok) { print(tojson(res)); quit(1); }"`, preHook[2])
+	assert.Contains(t, postHook[2], "var res = db.fsyncUnlock();")
+
+	mongod := sts.Spec.Template.Spec.Containers[1]
+	assert.Equal(t, mongodbName, mongod.Name)
+	var passwordEnv *corev1.EnvVar
+	for i := range mongod.Env {
+		if mongod.Env[i].Name == "AGENT_PASSWORD" {
+			passwordEnv = &mongod.Env[i]
+		}
+	}
+	if assert.NotNil(t, passwordEnv, "the hooks authenticate as the agent") {
+		assert.Equal(t, mdb.ScramCredentialsNamespacedName().Name, passwordEnv.ValueFrom.SecretKeyRef.Name)
+	}
+}
+
+func TestReconcileBackupFreeze(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Annotations = map[string]string{backupFreezeAnnotationKey: "my-rs-1"}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "my-rs-1", Namespace: mdb.Namespace}}
+	assert.NoError(t, c.Create(context.TODO(), &pod))
+
+	var fsyncCalls []string
+	var connectedTo string
+	r.connectToLiveCluster = func(uri string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		connectedTo = uri
+		return mockLiveCluster{fsyncCalls: &fsyncCalls}, nil
+	}
+	lockedAt := time.Date(2026, 1, 3, 3, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return lockedAt }
+
+	assert.NoError(t, r.reconcileBackupFreeze(mdb))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, "mongodb://my-rs-1.my-rs-svc.my-ns.svc.cluster.local:27017/?connect=direct", connectedTo)
+	assert.Equal(t, []string{"lock"}, fsyncCalls)
+	assert.Equal(t, "my-rs-1", mdb.Status.BackupFreeze.Member)
+	assert.True(t, lockedAt.Equal(mdb.Status.BackupFreeze.LockedAt.Time))
+	assert.Equal(t, lockedAt.Add(5*time.Minute), r.backupFreezeExpiresAt)
+	_ = c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-1", Namespace: mdb.Namespace}, &pod)
+	assert.Equal(t, "2026-01-03T03:00:00Z", pod.Annotations[backupCheckpointAnnotationKey])
+
+	assert.NoError(t, r.reconcileBackupFreeze(mdb))
+	assert.Equal(t, []string{"lock"}, fsyncCalls, "the writes are only locked once")
+
+	t.Run("The writes are unlocked when the annotation is removed", func(t *testing.T) {
+		delete(mdb.Annotations, backupFreezeAnnotationKey)
+		assert.NoError(t, r.reconcileBackupFreeze(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, []string{"lock", "unlock"}, fsyncCalls)
+		assert.Nil(t, mdb.Status.BackupFreeze)
+		_ = c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-1", Namespace: mdb.Namespace}, &pod)
+		assert.NotContains(t, pod.Annotations, backupCheckpointAnnotationKey)
+	})
+
+	t.Run("The writes are unlocked once the freeze expires", func(t *testing.T) {
+		fsyncCalls = nil
+		mdb.Annotations[backupFreezeAnnotationKey] = "my-rs-1"
+		mdb.Spec.BackupHooks = &mdbv1.BackupHooks{FreezeTimeoutSeconds: 60}
+		assert.NoError(t, c.Update(context.TODO(), &mdb))
+		assert.NoError(t, r.reconcileBackupFreeze(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+
+		r.now = func() time.Time { return lockedAt.Add(time.Minute) }
+		assert.NoError(t, r.reconcileBackupFreeze(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, []string{"lock", "unlock"}, fsyncCalls)
+		assert.True(t, mdb.Status.BackupFreeze.Expired)
+
+		assert.NoError(t, r.reconcileBackupFreeze(mdb))
+		assert.Equal(t, []string{"lock", "unlock"}, fsyncCalls, "the expired freeze isn't locked again")
+		delete(mdb.Annotations, backupFreezeAnnotationKey)
+		assert.NoError(t, r.reconcileBackupFreeze(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, []string{"lock", "unlock"}, fsyncCalls, "the expired freeze isn't unlocked twice")
+		assert.Nil(t, mdb.Status.BackupFreeze)
+	})
+
+	t.Run("Only a member can be locked", func(t *testing.T) {
+		mdb.Annotations[backupFreezeAnnotationKey] = "my-rs-7"
+		assert.EqualError(t, r.reconcileBackupFreeze(mdb), "my-rs-7 isn't a member of the replica set")
+	})
+}
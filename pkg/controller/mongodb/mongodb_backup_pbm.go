@@ -0,0 +1,381 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	pbmAgentName    = "pbm-agent"
+	defaultPBMImage = "percona/percona-backup-mongodb:2.3.1"
+
+	pbmBackupTypeLogical  = "logical"
+	pbmBackupTypePhysical = "physical"
+
+	// pbmUserName is the user the pbm-agents and the pbm CLI authenticate as, its password is stored
+	// in the Secret returned by PBMUserSecretNamespacedName
+	pbmUserName = "pbm"
+	// pbmAnyActionRole is the custom role PBM requires to restore the backups and replay the oplog
+	pbmAnyActionRole = "pbmAnyAction"
+
+	// pbmConfigHashLabelKey is set on the Jobs applying the configuration of PBM to the hash of the
+	// configuration they apply
+	pbmConfigHashLabelKey = "mongodb.com/v1.pbmConfigHash"
+	// pbmDefaultRegion is the region PBM requires when the target doesn't set one
+	pbmDefaultRegion = "us-east-1"
+)
+
+// pbmUserRoles are the roles PBM requires, see
+// https://docs.percona.com/percona-backup-mongodb/install/configure-authentication.html
+var pbmUserRoles = []automationconfig.Role{
+	{Role: pbmAnyActionRole, Database: "admin"},
+	{Role: "readWrite", Database: "admin"},
+	{Role: "backup", Database: "admin"},
+	{Role: "clusterMonitor", Database: "admin"},
+	{Role: "restore", Database: "admin"},
+}
+
+// usesPBM returns true if the backups of spec.backup are taken with Percona Backup for MongoDB
+func usesPBM(mdb mdbv1.MongoDB) bool {
+	return mdb.Spec.Backup != nil && mdb.Spec.Backup.Method == mdbv1.BackupMethodPBM
+}
+
+func pbmImage(mdb mdbv1.MongoDB) string {
+	if pbm := mdb.Spec.Backup.PBM; pbm != nil && pbm.Image != "" {
+		return pbm.Image
+	}
+	return defaultPBMImage
+}
+
+func pbmBackupType(mdb mdbv1.MongoDB) string {
+	if pbm := mdb.Spec.Backup.PBM; pbm != nil && pbm.Type != "" {
+		return pbm.Type
+	}
+	return pbmBackupTypeLogical
+}
+
+// validatePBMBackup ensures the features of spec.backup are supported by the pbm method
+func validatePBMBackup(backup mdbv1.Backup) error {
+	if backup.Target.S3 == nil {
+		return fmt.Errorf("the pbm method requires an s3 target")
+	}
+	if backup.Retention != nil {
+		return fmt.Errorf("a retention isn't supported with the pbm method, delete the backups with \"pbm delete-backup\" instead")
+	}
+	if backup.Encryption != nil {
+		return fmt.Errorf("encryption isn't supported with the pbm method, use the server-side encryption of the s3 target instead")
+	}
+	if backup.Verification != nil {
+		return fmt.Errorf("verification isn't supported with the pbm method")
+	}
+	if pbm := backup.PBM; pbm != nil && pbm.Type != "" && pbm.Type != pbmBackupTypeLogical && pbm.Type != pbmBackupTypePhysical {
+		return fmt.Errorf("unsupported pbm backup type %s", pbm.Type)
+	}
+	return nil
+}
+
+// getPBMUserModification returns a modification which adds the user of PBM, and the custom role it
+// requires, to the automation config if the backups are taken with PBM and authentication is enabled
+func (r ReplicaSetReconciler) getPBMUserModification(mdb mdbv1.MongoDB, currentAC automationconfig.AutomationConfig) (automationconfig.Modification, error) {
+	if !usesPBM(mdb) || !mdb.Spec.Security.Authentication.Enabled {
+		return automationconfig.NOOP(), nil
+	}
+	userModification, err := r.generatedUserModification(mdb, currentAC, pbmUserName, pbmUserRoles, mdb.PBMUserSecretNamespacedName())
+	if err != nil {
+		return automationconfig.NOOP(), err
+	}
+	role := automationconfig.CustomRole{
+		Role:       pbmAnyActionRole,
+		Database:   "admin",
+		Privileges: []automationconfig.Privilege{{Resource: automationconfig.Resource{AnyResource: true}, Actions: []string{"anyAction"}}},
+		Roles:      []automationconfig.Role{},
+	}
+	return automationconfig.Merge(userModification, func(ac *automationconfig.AutomationConfig) {
+		roles := []automationconfig.CustomRole{role}
+		for _, existing := range ac.Roles {
+			if existing.Role != role.Role || existing.Database != role.Database {
+				roles = append(roles, existing)
+			}
+		}
+		ac.Roles = roles
+	}), nil
+}
+
+// pbmConnection returns the environment variables providing the connection string to the hosts to the
+// pbm-agent or pbm CLI, as PBM_MONGODB_URI, with the credentials of the user of PBM when
+// authentication is enabled and the CA certificate of the members when TLS is enabled. The variables
+// defined before them are expanded in the hosts.
+func pbmConnection(mdb mdbv1.MongoDB, hosts, options string) []corev1.EnvVar {
+	var envs []corev1.EnvVar
+	credentials := ""
+	if mdb.Spec.Security.Authentication.Enabled {
+		envs = append(envs,
+			corev1.EnvVar{Name: "PBM_USER", Value: pbmUserName},
+			corev1.EnvVar{Name: "PBM_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: mdb.PBMUserSecretNamespacedName().Name},
+				Key:                  generatedUserPasswordKey,
+			}}},
+		)
+		credentials = "$(PBM_USER):$(PBM_PASSWORD)@"
+		options += "&authSource=admin"
+	}
+	if mdb.Spec.Security.TLS.Enabled {
+		options += "&tls=true&tlsCAFile=" + pbmCAFile(mdb)
+	}
+	return append(envs, corev1.EnvVar{
+		Name:  "PBM_MONGODB_URI",
+		Value: fmt.Sprintf("mongodb://%s%s/?%s", credentials, hosts, options),
+	})
+}
+
+// pbmCAFile returns the path of the CA certificate of the members in the containers of PBM
+func pbmCAFile(mdb mdbv1.MongoDB) string {
+	if usesVaultTLS(mdb) {
+		return vaultSecretsPath + tlsCACertName
+	}
+	return tlsCAMountPath + tlsCACertName
+}
+
+// buildPBMPodSpecModification adds the pbm-agent container to the members if the backups are taken
+// with PBM. The agent connects to the mongod of its member, and writes the backups and the oplog to
+// the s3 target with its credentials. It reads the data files of the member for the physical backups.
+func buildPBMPodSpecModification(mdb mdbv1.MongoDB) podtemplatespec.Modification {
+	if !usesPBM(mdb) {
+		return podtemplatespec.NOOP()
+	}
+
+	envs := []corev1.EnvVar{
+		{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+	}
+	host := fmt.Sprintf("$(POD_NAME).%s:27017", getDomain(mdb.ServiceName(), mdb.Namespace, ""))
+	envs = append(envs, pbmConnection(mdb, host, "connect=direct")...)
+
+	var volumeMounts []corev1.VolumeMount
+	if mdb.Spec.Security.TLS.Enabled && !usesVaultTLS(mdb) {
+		volumeMounts = append(volumeMounts, statefulset.CreateVolumeMount("tls-ca", tlsCAMountPath, statefulset.WithReadOnly(true)))
+	}
+	if pbmBackupType(mdb) == pbmBackupTypePhysical {
+		volumeMounts = append(volumeMounts, statefulset.CreateVolumeMount(dataVolumeName, dataPath(mdb)))
+	}
+	resources := corev1.ResourceRequirements{}
+	if pbm := mdb.Spec.Backup.PBM; pbm != nil && pbm.Resources != nil {
+		resources = *pbm.Resources
+	}
+
+	return podtemplatespec.WithContainer(pbmAgentName, container.Apply(
+		container.WithName(pbmAgentName),
+		container.WithImage(pbmImage(mdb)),
+		container.WithCommand([]string{"pbm-agent"}),
+		container.WithEnvs(envs...),
+		container.WithResourceRequirements(resources),
+		container.WithVolumeMounts(volumeMounts),
+		s3Credentials(*mdb.Spec.Backup.Target.S3),
+	))
+}
+
+// pbmStorage is the storage section of the configuration of PBM
+type pbmStorage struct {
+	Type string       `json:"type"`
+	S3   pbmS3Storage `json:"s3"`
+}
+
+type pbmS3Storage struct {
+	Region               string                   `json:"region"`
+	Bucket               string                   `json:"bucket"`
+	Prefix               string                   `json:"prefix,omitempty"`
+	EndpointURL          string                   `json:"endpointUrl,omitempty"`
+	ServerSideEncryption *pbmServerSideEncryption `json:"serverSideEncryption,omitempty"`
+}
+
+type pbmServerSideEncryption struct {
+	Algorithm string `json:"sseAlgorithm"`
+	KMSKeyID  string `json:"kmsKeyID,omitempty"`
+}
+
+type pbmPITR struct {
+	Enabled      bool    `json:"enabled"`
+	OplogSpanMin float64 `json:"oplogSpanMin,omitempty"`
+}
+
+type pbmConfig struct {
+	Storage pbmStorage `json:"storage"`
+	PITR    pbmPITR    `json:"pitr"`
+}
+
+// buildPBMConfig returns the configuration of PBM, storing the backups in the s3 target of
+// spec.backup, whose credentials are provided to the pbm-agents, and archiving the oplog every
+// interval of spec.backup.pointInTime if it is set
+func buildPBMConfig(mdb mdbv1.MongoDB) (string, error) {
+	target := *mdb.Spec.Backup.Target.S3
+	config := pbmConfig{Storage: pbmStorage{Type: "s3", S3: pbmS3Storage{
+		Region:      target.Region,
+		Bucket:      target.Bucket,
+		Prefix:      target.Prefix,
+		EndpointURL: target.Endpoint,
+	}}}
+	if config.Storage.S3.Region == "" {
+		config.Storage.S3.Region = pbmDefaultRegion
+	}
+	if sse := target.ServerSideEncryption; sse != nil {
+		config.Storage.S3.ServerSideEncryption = &pbmServerSideEncryption{Algorithm: sse.Algorithm, KMSKeyID: sse.KMSKeyID}
+	}
+	if pointInTime := mdb.Spec.Backup.PointInTime; pointInTime != nil {
+		interval := pointInTime.IntervalSeconds
+		if interval == 0 {
+			interval = defaultOplogArchiveIntervalSeconds
+		}
+		config.PITR = pbmPITR{Enabled: true, OplogSpanMin: float64(interval) / 60}
+	}
+	bytes, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// pbmCLIContainer returns the modification running the pbm CLI against the replica set with the
+// script, in the container with the name
+func pbmCLIContainer(mdb mdbv1.MongoDB, name, script string) podtemplatespec.Modification {
+	hosts := ""
+	domain := getDomain(mdb.ServiceName(), mdb.Namespace, "")
+	for i := 0; i < mdb.Spec.Members; i++ {
+		if i > 0 {
+			hosts += ","
+		}
+		hosts += fmt.Sprintf("%s-%d.%s:27017", mdb.Name, i, domain)
+	}
+	var volumeMounts []corev1.VolumeMount
+	caModification := podtemplatespec.NOOP()
+	if usesVaultTLS(mdb) {
+		caModification = podtemplatespec.WithAdditionalAnnotations(vaultAgentAnnotations(mdb, mdb.Spec.Security.TLS.VaultSecretPath, true, map[string][]string{
+			tlsCACertName: {tlsCACertName},
+		}))
+	} else if mdb.Spec.Security.TLS.Enabled {
+		caVolume := statefulset.CreateVolumeFromConfigMap("tls-ca", mdb.TLSConfigMapNamespacedName().Name)
+		caModification = podtemplatespec.WithVolume(caVolume)
+		volumeMounts = append(volumeMounts, statefulset.CreateVolumeMount(caVolume.Name, tlsCAMountPath, statefulset.WithReadOnly(true)))
+	}
+	return podtemplatespec.Apply(
+		podtemplatespec.WithContainer(name, container.Apply(
+			container.WithName(name),
+			container.WithImage(pbmImage(mdb)),
+			container.WithCommand([]string{"/bin/sh", "-c", script}),
+			container.WithEnvs(pbmConnection(mdb, hosts, "replicaSet="+mdb.Name)...),
+			container.WithVolumeMounts(volumeMounts),
+		)),
+		caModification,
+	)
+}
+
+// pbmBackupPodTemplate returns the template of the Pods taking a backup with the pbm CLI, which waits
+// for the pbm-agents to complete it and reports its size as its termination message
+func pbmBackupPodTemplate(mdb mdbv1.MongoDB, labels map[string]string) corev1.PodTemplateSpec {
+	script := fmt.Sprintf(`set -o pipefail; name=$(pbm backup --type=%s --compression=gzip --wait | tee /dev/stderr | sed -n "s/^Starting backup '\([^']*\)'.*/\1/p") && `+
+		`pbm describe-backup "$name" --out=json | grep -o '"size":[0-9]*' | head -n 1 | cut -d: -f2 > %s`,
+		pbmBackupType(mdb), corev1.TerminationMessagePathDefault)
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		pbmCLIContainer(mdb, backupContainerName, script),
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	return template
+}
+
+// ensurePBMConfig applies the configuration of PBM with a Job run whenever it changes, the Jobs which
+// applied the previous configurations are deleted
+func (r *ReplicaSetReconciler) ensurePBMConfig(mdb mdbv1.MongoDB) error {
+	if !usesPBM(mdb) {
+		return r.deletePBMConfigJobs(mdb, "")
+	}
+	config, err := buildPBMConfig(mdb)
+	if err != nil {
+		return fmt.Errorf("error building the configuration of PBM: %s", err)
+	}
+	hash, err := specHash(config)
+	if err != nil {
+		return err
+	}
+	hash = hash[:10]
+	if err := r.deletePBMConfigJobs(mdb, hash); err != nil {
+		return err
+	}
+
+	job := buildPBMConfigJob(mdb, config, hash)
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, &batchv1.Job{}); err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting the Job applying the configuration of PBM: %s", err)
+	}
+	if err := r.client.Create(context.TODO(), &job); err != nil {
+		return fmt.Errorf("error creating the Job applying the configuration of PBM: %s", err)
+	}
+	r.log.Infof("Applying the configuration of PBM with the Job %s", job.Name)
+	return nil
+}
+
+// deletePBMConfigJobs deletes the Jobs applying the configuration of PBM, except the one applying the
+// configuration with the hash
+func (r *ReplicaSetReconciler) deletePBMConfigJobs(mdb mdbv1.MongoDB, keepHash string) error {
+	jobs := batchv1.JobList{}
+	if err := r.client.List(context.TODO(), &jobs, k8sClient.InNamespace(mdb.Namespace), k8sClient.MatchingLabels(pbmConfigJobLabels(mdb))); err != nil {
+		return fmt.Errorf("error listing the Jobs applying the configuration of PBM: %s", err)
+	}
+	for i := range jobs.Items {
+		if jobs.Items[i].Labels[pbmConfigHashLabelKey] == keepHash {
+			continue
+		}
+		if err := r.client.Delete(context.TODO(), &jobs.Items[i], k8sClient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting Job %s: %s", jobs.Items[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func pbmConfigJobLabels(mdb mdbv1.MongoDB) map[string]string {
+	return map[string]string{"app": mdb.Name + "-pbm-config"}
+}
+
+// buildPBMConfigJob returns the Job applying the configuration of PBM with "pbm config", named after
+// the hash of the configuration
+func buildPBMConfigJob(mdb mdbv1.MongoDB, config, hash string) batchv1.Job {
+	labels := pbmConfigJobLabels(mdb)
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		pbmCLIContainer(mdb, "config", `echo "$PBM_CONFIG" > /tmp/pbm-config.yaml && pbm config --file /tmp/pbm-config.yaml`),
+		podtemplatespec.WithContainer("config", container.WithEnvs(corev1.EnvVar{Name: "PBM_CONFIG", Value: config})),
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	jobLabels := map[string]string{pbmConfigHashLabelKey: hash}
+	for k, v := range labels {
+		jobLabels[k] = v
+	}
+	backoffLimit := int32(backupBackoffLimit)
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-pbm-config-%s", mdb.Name, hash),
+			Namespace:       mdb.Namespace,
+			Labels:          jobLabels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}
+}
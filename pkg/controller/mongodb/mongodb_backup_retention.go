@@ -0,0 +1,255 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/contains"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	backupsPrunedEventReason      = "BackupsPruned"
+	backupPruneFailedEventReason  = "BackupPruneFailed"
+	backupPruneContainerName      = "prune"
+	prunedArchivesAnnotationKey   = "mongodb.com/v1.prunedArchives"
+	scheduledBackupTimestampFmt   = "20060102T150405Z"
+	scheduledBackupTimestampShell = "%Y%m%dT%H%M%SZ"
+)
+
+// scheduledBackupTimestampScript sets $timestamp to the time the Job of the backup CronJob was scheduled
+// at, which is the suffix of its name in minutes, or to the current time if the Job was created manually
+var scheduledBackupTimestampScript = fmt.Sprintf(`minutes=${JOB_NAME##*-}; case "$minutes" in ''|*[!0-9]*) timestamp=$(date -u +%[1]s) ;; *) timestamp=$(date -u -d @$((minutes * 60)) +%[1]s) ;; esac; `,
+	scheduledBackupTimestampShell)
+
+// scheduledBackupArchiveName is the name of the archive of the backup scheduled at the given time
+func scheduledBackupArchiveName(mdb mdbv1.MongoDB, scheduledAt time.Time) string {
+	return fmt.Sprintf("%s-%s.archive.gz", mdb.Name, scheduledAt.UTC().Format(scheduledBackupTimestampFmt))
+}
+
+func validateBackupRetention(retention *mdbv1.BackupRetention) error {
+	if retention == nil {
+		return nil
+	}
+	if retention.KeepLast < 0 || retention.KeepDaily < 0 || retention.KeepWeekly < 0 {
+		return fmt.Errorf("the retention can't be negative")
+	}
+	if retention.KeepLast == 0 && retention.KeepDaily == 0 && retention.KeepWeekly == 0 {
+		return fmt.Errorf("the retention must keep at least one backup")
+	}
+	return nil
+}
+
+// trackBackupArchive adds the archive to the tracked archives, keeping the most recent first
+func trackBackupArchive(archives []mdbv1.BackupArchive, archive mdbv1.BackupArchive) []mdbv1.BackupArchive {
+	for _, existing := range archives {
+		if existing.Location == archive.Location {
+			return archives
+		}
+	}
+	archives = append(archives, archive)
+	sort.SliceStable(archives, func(i, j int) bool {
+		return archives[i].Time.After(archives[j].Time.Time)
+	})
+	return archives
+}
+
+// expiredBackupArchives returns the archives which aren't kept by any rule of the retention. The days
+// and the weeks are the ones of UTC.
+func expiredBackupArchives(archives []mdbv1.BackupArchive, retention mdbv1.BackupRetention) []mdbv1.BackupArchive {
+	sorted := append([]mdbv1.BackupArchive{}, archives...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.After(sorted[j].Time.Time)
+	})
+
+	days, weeks := map[string]bool{}, map[string]bool{}
+	var expired []mdbv1.BackupArchive
+	for i, archive := range sorted {
+		scheduledAt := archive.Time.UTC()
+		day := scheduledAt.Format("2006-01-02")
+		year, isoWeek := scheduledAt.ISOWeek()
+		week := fmt.Sprintf("%d-%d", year, isoWeek)
+
+		keep := i < retention.KeepLast
+		if !days[day] && len(days) < retention.KeepDaily {
+			days[day], keep = true, true
+		}
+		if !weeks[week] && len(weeks) < retention.KeepWeekly {
+			weeks[week], keep = true, true
+		}
+		if !keep {
+			expired = append(expired, archive)
+		}
+	}
+	return expired
+}
+
+// isInBackupTarget returns true if the archive is stored in the target, the archives stored in a
+// previous target can't be pruned
+func isInBackupTarget(location string, target mdbv1.BackupTarget) bool {
+	if target.S3 != nil {
+		return strings.HasPrefix(location, fmt.Sprintf("s3://%s/", target.S3.Bucket))
+	}
+	return strings.HasPrefix(location, target.PersistentVolumeClaim.ClaimName+":")
+}
+
+func backupPruneJobNamespacedName(mdb mdbv1.MongoDB) types.NamespacedName {
+	return types.NamespacedName{Name: mdb.Name + "-backup-prune", Namespace: mdb.Namespace}
+}
+
+// pruneBackups deletes the archives expired by spec.backup.retention from the target with a Job. The
+// archives deleted are removed from status.backup.archives and recorded in status.backup.lastPruned
+// and in an event once the Job succeeds. A Job which fails is deleted, and the archives are pruned
+// again by the next poll.
+func (r *ReplicaSetReconciler) pruneBackups(mdb mdbv1.MongoDB, status *mdbv1.BackupStatus) error {
+	retention := mdb.Spec.Backup.Retention
+	if retention == nil {
+		status.Archives = nil
+		return nil
+	}
+	var archives []mdbv1.BackupArchive
+	for _, archive := range status.Archives {
+		if isInBackupTarget(archive.Location, mdb.Spec.Backup.Target) {
+			archives = append(archives, archive)
+		}
+	}
+	status.Archives = archives
+
+	job := batchv1.Job{}
+	err := r.client.Get(context.TODO(), backupPruneJobNamespacedName(mdb), &job)
+	if err == nil {
+		return r.completeBackupPrune(mdb, status, job)
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting backup prune Job: %s", err)
+	}
+
+	expired := expiredBackupArchives(status.Archives, *retention)
+	if len(expired) == 0 {
+		return nil
+	}
+	var locations []string
+	for _, archive := range expired {
+		locations = append(locations, archive.Location)
+	}
+	job, err = buildBackupPruneJob(mdb, locations)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Create(context.TODO(), &job); err != nil {
+		return fmt.Errorf("error creating backup prune Job: %s", err)
+	}
+	r.log.Infof("Pruning the expired backups %s", strings.Join(locations, ", "))
+	return nil
+}
+
+// completeBackupPrune records the outcome of the prune Job once it has completed, and deletes it
+func (r *ReplicaSetReconciler) completeBackupPrune(mdb mdbv1.MongoDB, status *mdbv1.BackupStatus, job batchv1.Job) error {
+	var pruned []string
+	if err := json.Unmarshal([]byte(job.Annotations[prunedArchivesAnnotationKey]), &pruned); err != nil {
+		return fmt.Errorf("error reading the archives pruned by %s: %s", job.Name, err)
+	}
+	if job.Status.Succeeded > 0 {
+		var archives []mdbv1.BackupArchive
+		for _, archive := range status.Archives {
+			if !contains.String(pruned, archive.Location) {
+				archives = append(archives, archive)
+			}
+		}
+		now := metav1.NewTime(r.now())
+		status.Archives, status.LastPruned, status.LastPruneTime = archives, pruned, &now
+		message := fmt.Sprintf("Deleted the expired backups %s", strings.Join(pruned, ", "))
+		r.log.Info(message)
+		if r.recorder != nil {
+			r.recorder.Event(&mdb, corev1.EventTypeNormal, backupsPrunedEventReason, message)
+		}
+	} else if message, failed := jobFailure(job); failed {
+		r.log.Warnf("Error pruning the expired backups: %s", message)
+		if r.recorder != nil {
+			r.recorder.Event(&mdb, corev1.EventTypeWarning, backupPruneFailedEventReason, message)
+		}
+	} else {
+		return nil
+	}
+	if err := r.client.Delete(context.TODO(), &job, k8sClient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting backup prune Job: %s", err)
+	}
+	return nil
+}
+
+// buildBackupPruneJob returns the Job deleting the archives at the given locations from the target of
+// spec.backup. The locations are recorded in an annotation of the Job.
+func buildBackupPruneJob(mdb mdbv1.MongoDB, locations []string) (batchv1.Job, error) {
+	prunedArchives, err := json.Marshal(locations)
+	if err != nil {
+		return batchv1.Job{}, err
+	}
+	target := mdb.Spec.Backup.Target
+	var prune podtemplatespec.Modification
+	if target.S3 != nil {
+		var commands []string
+		for _, location := range locations {
+			commands = append(commands, fmt.Sprintf(`aws%s s3 rm "%s"`, s3EndpointOption(*target.S3), location))
+		}
+		prune = podtemplatespec.WithContainer(backupPruneContainerName, container.Apply(
+			container.WithName(backupPruneContainerName),
+			container.WithImage(awsCLIImage),
+			container.WithCommand([]string{"/bin/sh", "-c", strings.Join(commands, " && ")}),
+			s3Credentials(*target.S3),
+		))
+	} else {
+		claimName := target.PersistentVolumeClaim.ClaimName
+		var files []string
+		for _, location := range locations {
+			files = append(files, fmt.Sprintf(`"%s"`, path.Join(backupMountPath, strings.TrimPrefix(location, claimName+":"))))
+		}
+		volume := statefulset.CreateVolumeFromPersistentVolumeClaim("backup", claimName)
+		prune = podtemplatespec.Apply(
+			podtemplatespec.WithVolume(volume),
+			podtemplatespec.WithContainer(backupPruneContainerName, container.Apply(
+				container.WithName(backupPruneContainerName),
+				container.WithImage(fmt.Sprintf("mongo:%s", mdb.Spec.Version)),
+				container.WithCommand([]string{"/bin/sh", "-c", "exec rm -f " + strings.Join(files, " ")}),
+				container.WithVolumeMounts([]corev1.VolumeMount{statefulset.CreateVolumeMount(volume.Name, backupMountPath, statefulset.WithReadOnly(false))}),
+			)),
+		)
+	}
+
+	labels := map[string]string{"app": mdb.Name + "-backup-prune"}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		prune,
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	backoffLimit := int32(backupBackoffLimit)
+	nsName := backupPruneJobNamespacedName(mdb)
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            nsName.Name,
+			Namespace:       nsName.Namespace,
+			Labels:          labels,
+			Annotations:     map[string]string{prunedArchivesAnnotationKey: string(prunedArchives)},
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}, nil
+}
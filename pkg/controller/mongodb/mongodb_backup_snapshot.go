@@ -0,0 +1,298 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/cron"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// snapshotBackupLabelKey is the label of the VolumeSnapshots of a backup, set to the name of the backup
+	snapshotBackupLabelKey = "mongodb.com/v1.backup"
+	// snapshotCutTimeout is how long the writes of the secondary stay locked waiting for its volumes to
+	// be snapshotted, the backup fails once it has elapsed
+	snapshotCutTimeout = 2 * time.Minute
+	// snapshotCutPollInterval is how often the snapshots are checked while the writes are locked
+	snapshotCutPollInterval = 2 * time.Second
+)
+
+// volumeSnapshotGVK is the kind of the CSI VolumeSnapshots, they are managed as unstructured objects
+// so that the operator doesn't depend on the CRDs of the snapshot controller being installed
+var volumeSnapshotGVK = schema.GroupVersionKind{Group: volumeSnapshotAPIGroup, Version: "v1beta1", Kind: "VolumeSnapshot"}
+
+// updateSnapshotBackup takes the backups of the snapshot method on the schedule of spec.backup, and
+// records their progress in status.backup. A backup is running until all its VolumeSnapshots are ready
+// to use, and fails if any of them can't be taken.
+func (r *ReplicaSetReconciler) updateSnapshotBackup(mdb mdbv1.MongoDB) error {
+	// an invalid spec.backup is reported by the reconciliation
+	if err := validateBackup(mdb); err != nil {
+		return nil
+	}
+	status := mdbv1.BackupStatus{}
+	if mdb.Status.Backup != nil {
+		status = *mdb.Status.Backup
+	}
+	if status.LastPhase == mdbv1.BackupRunning && len(status.LastSnapshots) > 0 {
+		return r.updateSnapshotsReadiness(mdb, status)
+	}
+
+	schedule, _ := cron.Parse(mdb.Spec.Backup.Schedule)
+	now := r.now()
+	// the next backup is scheduled again when the schedule changes
+	if status.NextScheduleTime == nil || !schedule.Matches(status.NextScheduleTime.Time) {
+		status.NextScheduleTime = nextSnapshotScheduleTime(schedule, now)
+		return r.setBackupStatus(mdb, &status)
+	}
+	if now.Before(status.NextScheduleTime.Time) {
+		return nil
+	}
+	scheduledAt := *status.NextScheduleTime
+	status.NextScheduleTime = nextSnapshotScheduleTime(schedule, now)
+	if mdb.Spec.Backup.Suspend {
+		return r.setBackupStatus(mdb, &status)
+	}
+
+	name := snapshotBackupName(mdb, scheduledAt.Time)
+	status.LastScheduleTime, status.LastJob = &scheduledAt, ""
+	snapshots, err := r.takeVolumeSnapshots(mdb, name)
+	if err != nil {
+		status.LastPhase, status.Message, status.LastSnapshots = mdbv1.BackupFailed, fmt.Sprintf("Backup %s failed: %s", name, err), nil
+		status.ConsecutiveFailures++
+		r.log.Warn(status.Message)
+		if r.recorder != nil {
+			r.recorder.Event(&mdb, corev1.EventTypeWarning, backupFailedEventReason, status.Message)
+		}
+		return r.setBackupStatus(mdb, &status)
+	}
+	status.LastPhase, status.Message, status.LastSnapshots = mdbv1.BackupRunning, "", snapshots
+	return r.setBackupStatus(mdb, &status)
+}
+
+// nextSnapshotScheduleTime returns the time the next backup is scheduled at, or nil if the schedule
+// never matches
+func nextSnapshotScheduleTime(schedule cron.Schedule, after time.Time) *metav1.Time {
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	return &metav1.Time{Time: next}
+}
+
+// updateSnapshotsReadiness marks the running backup as succeeded once all its VolumeSnapshots are
+// ready to use, or as failed if one of them has an error or was deleted
+func (r *ReplicaSetReconciler) updateSnapshotsReadiness(mdb mdbv1.MongoDB, status mdbv1.BackupStatus) error {
+	name := snapshotBackupName(mdb, status.LastScheduleTime.Time)
+	ready, failure, err := r.volumeSnapshotsReadiness(mdb, status.LastSnapshots)
+	if err != nil {
+		return err
+	}
+	if failure != "" {
+		status.LastPhase, status.Message = mdbv1.BackupFailed, fmt.Sprintf("Backup %s failed: %s", name, failure)
+		status.ConsecutiveFailures++
+		r.log.Warn(status.Message)
+		if r.recorder != nil {
+			r.recorder.Event(&mdb, corev1.EventTypeWarning, backupFailedEventReason, status.Message)
+		}
+		return r.setBackupStatus(mdb, &status)
+	}
+	if !ready {
+		return nil
+	}
+
+	size, err := r.volumeSnapshotsSize(mdb, status.LastSnapshots)
+	if err != nil {
+		return err
+	}
+	now := metav1.NewTime(r.now())
+	status.LastPhase, status.LastSuccessfulTime = mdbv1.BackupSucceeded, &now
+	status.LastSize, status.ConsecutiveFailures = size, 0
+	r.log.Infof("Backup %s completed", name)
+	if r.recorder != nil {
+		r.recorder.Eventf(&mdb, corev1.EventTypeNormal, backupCompletedEventReason, "Backup %s completed", name)
+	}
+	return r.setBackupStatus(mdb, &status)
+}
+
+// volumeSnapshotsReadiness returns true once all the VolumeSnapshots are ready to use, or why they
+// can't be used if one of them has an error or was deleted
+func (r *ReplicaSetReconciler) volumeSnapshotsReadiness(mdb mdbv1.MongoDB, snapshots []string) (bool, string, error) {
+	ready := true
+	for _, snapshotName := range snapshots {
+		snapshot := unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: snapshotName, Namespace: mdb.Namespace}, &snapshot)
+		if errors.IsNotFound(err) {
+			return false, fmt.Sprintf("the VolumeSnapshot %s was deleted", snapshotName), nil
+		}
+		if err != nil {
+			return false, "", fmt.Errorf("error getting VolumeSnapshot %s: %s", snapshotName, err)
+		}
+		if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+			return false, fmt.Sprintf("error taking the VolumeSnapshot %s: %s", snapshotName, message), nil
+		}
+		if isReady, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); !isReady {
+			ready = false
+		}
+	}
+	return ready, "", nil
+}
+
+// volumeSnapshotsSize returns the sum of the restore sizes of the VolumeSnapshots, the snapshots whose
+// restore size isn't reported by their CSI driver are ignored
+func (r *ReplicaSetReconciler) volumeSnapshotsSize(mdb mdbv1.MongoDB, snapshots []string) (int64, error) {
+	var size int64
+	for _, snapshotName := range snapshots {
+		snapshot := unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: snapshotName, Namespace: mdb.Namespace}, &snapshot); err != nil {
+			return 0, fmt.Errorf("error getting VolumeSnapshot %s: %s", snapshotName, err)
+		}
+		restoreSize, _, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize")
+		if quantity, err := resource.ParseQuantity(restoreSize); err == nil {
+			size += quantity.Value()
+		}
+	}
+	return size, nil
+}
+
+// snapshotBackupName is the name of the backup of the snapshot method scheduled at the given time,
+// its VolumeSnapshots are named after it
+func snapshotBackupName(mdb mdbv1.MongoDB, scheduledAt time.Time) string {
+	return fmt.Sprintf("%s-%s", mdb.Name, strings.ToLower(scheduledAt.UTC().Format(scheduledBackupTimestampFmt)))
+}
+
+// snapshotMember returns the name of the Pod of the secondary with the lowest replication lag, the
+// backups of the snapshot method are never taken from the primary
+func snapshotMember(mdb mdbv1.MongoDB) (string, error) {
+	member, lowestLag := "", int64(-1)
+	for _, m := range mdb.Status.Members {
+		if m.State != livecluster.SecondaryState {
+			continue
+		}
+		lag := int64(0)
+		if m.ReplicationLagSeconds != nil {
+			lag = *m.ReplicationLagSeconds
+		}
+		if member == "" || lag < lowestLag {
+			member, lowestLag = m.Name, lag
+		}
+	}
+	if member == "" {
+		return "", fmt.Errorf("there is no secondary to take the snapshots from")
+	}
+	return member, nil
+}
+
+// takeVolumeSnapshots locks the writes of a secondary with fsyncLock, takes a VolumeSnapshot of each of
+// its volumes, and unlocks the writes once the snapshots are cut, so that they are consistent. The
+// writes are always unlocked before it returns, and the snapshots are deleted if any of them can't be
+// taken.
+func (r *ReplicaSetReconciler) takeVolumeSnapshots(mdb mdbv1.MongoDB, name string) (snapshots []string, err error) {
+	member, err := snapshotMember(mdb)
+	if err != nil {
+		return nil, err
+	}
+	sts, err := r.client.GetStatefulSet(mdb.NamespacedName())
+	if err != nil {
+		return nil, fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	reader, err := r.connectLiveClusterMember(mdb, member)
+	if err != nil {
+		return nil, err
+	}
+	defer r.disconnectLiveCluster(context.TODO(), reader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+	defer cancel()
+	if err := reader.FsyncLock(ctx); err != nil {
+		return nil, fmt.Errorf("error locking the writes of %s: %s", member, err)
+	}
+	r.log.Infof("Locked the writes of %s to take the snapshots of the backup %s", member, name)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+		defer cancel()
+		if unlockErr := reader.FsyncUnlock(ctx); unlockErr != nil && err == nil {
+			err = fmt.Errorf("error unlocking the writes of %s: %s", member, unlockErr)
+		}
+		if err != nil {
+			r.deleteVolumeSnapshots(mdb, snapshots)
+			snapshots = nil
+		}
+	}()
+
+	for _, claimTemplate := range sts.Spec.VolumeClaimTemplates {
+		snapshot := buildVolumeSnapshot(mdb, name, claimTemplate.Name, fmt.Sprintf("%s-%s", claimTemplate.Name, member))
+		if err := r.client.Create(context.TODO(), &snapshot); err != nil {
+			return snapshots, fmt.Errorf("error creating VolumeSnapshot %s: %s", snapshot.GetName(), err)
+		}
+		snapshots = append(snapshots, snapshot.GetName())
+	}
+	if err := wait.PollImmediate(snapshotCutPollInterval, snapshotCutTimeout, func() (bool, error) {
+		return r.areVolumeSnapshotsCut(mdb, snapshots)
+	}); err != nil {
+		return snapshots, fmt.Errorf("error waiting for the VolumeSnapshots to be taken: %s", err)
+	}
+	return snapshots, nil
+}
+
+// areVolumeSnapshotsCut returns true once the point in time of all the snapshots has been taken, their
+// content may still be uploaded by the storage
+func (r *ReplicaSetReconciler) areVolumeSnapshotsCut(mdb mdbv1.MongoDB, snapshots []string) (bool, error) {
+	for _, snapshotName := range snapshots {
+		snapshot := unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: snapshotName, Namespace: mdb.Namespace}, &snapshot); err != nil {
+			return false, err
+		}
+		if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+			return false, fmt.Errorf("error taking the VolumeSnapshot %s: %s", snapshotName, message)
+		}
+		if _, found, _ := unstructured.NestedString(snapshot.Object, "status", "creationTime"); !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (r *ReplicaSetReconciler) deleteVolumeSnapshots(mdb mdbv1.MongoDB, snapshots []string) {
+	for _, snapshotName := range snapshots {
+		snapshot := unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+		snapshot.SetName(snapshotName)
+		snapshot.SetNamespace(mdb.Namespace)
+		if err := r.client.Delete(context.TODO(), &snapshot); err != nil && !errors.IsNotFound(err) {
+			r.log.Warnf("Error deleting the VolumeSnapshot %s: %s", snapshotName, err)
+		}
+	}
+}
+
+// buildVolumeSnapshot returns the VolumeSnapshot of the given claim, for the backup with the given name.
+// It isn't owned by the resource, so that the backups are kept when the resource is deleted.
+func buildVolumeSnapshot(mdb mdbv1.MongoDB, backupName, volumeName, claimName string) unstructured.Unstructured {
+	snapshot := unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	snapshot.SetName(fmt.Sprintf("%s-%s", backupName, volumeName))
+	snapshot.SetNamespace(mdb.Namespace)
+	snapshot.SetLabels(map[string]string{"app": mdb.Name + "-backup", snapshotBackupLabelKey: backupName})
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{"persistentVolumeClaimName": claimName},
+	}
+	if className := mdb.Spec.Backup.Target.VolumeSnapshot.VolumeSnapshotClassName; className != "" {
+		spec["volumeSnapshotClassName"] = className
+	}
+	snapshot.Object["spec"] = spec
+	return snapshot
+}
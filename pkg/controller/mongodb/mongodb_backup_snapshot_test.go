@@ -0,0 +1,175 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// snapshotControllerClient is a client of a cluster whose snapshot controller sets the given status
+// on the VolumeSnapshots as soon as they are created
+type snapshotControllerClient struct {
+	client.Client
+	status map[string]interface{}
+}
+
+func (c snapshotControllerClient) Create(ctx context.Context, obj runtime.Object, opts ...k8sClient.CreateOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok && u.GroupVersionKind() == volumeSnapshotGVK {
+		u.Object["status"] = c.status
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func newSnapshotBackupReplicaSet() mdbv1.MongoDB {
+	mdb := newBackupReplicaSet()
+	mdb.Spec.Backup.Method = mdbv1.BackupMethodSnapshot
+	mdb.Spec.Backup.Target = mdbv1.BackupTarget{
+		VolumeSnapshot: &mdbv1.BackupVolumeSnapshotTarget{VolumeSnapshotClassName: "csi-snapclass"},
+	}
+	return mdb
+}
+
+func getVolumeSnapshot(c client.Client, mdb mdbv1.MongoDB, name string) (unstructured.Unstructured, error) {
+	snapshot := unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &snapshot)
+	return snapshot, err
+}
+
+func TestSnapshotBackup(t *testing.T) {
+	mdb := newSnapshotBackupReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.now = func() time.Time { return time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC) }
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Error(t, c.Get(context.TODO(), backupCronJobNamespacedName(mdb), &batchv1beta1.CronJob{}), "no CronJob takes the snapshots")
+
+	lag := func(seconds int64) *int64 { return &seconds }
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Status.Members = []mdbv1.MemberStatus{
+		{Name: "my-rs-0", State: livecluster.PrimaryState},
+		{Name: "my-rs-1", State: livecluster.SecondaryState, ReplicationLagSeconds: lag(5)},
+		{Name: "my-rs-2", State: livecluster.SecondaryState, ReplicationLagSeconds: lag(0)},
+	}
+	assert.NoError(t, c.Status().Update(context.TODO(), &mdb))
+
+	var fsyncCalls []string
+	var connectedTo string
+	r.client = snapshotControllerClient{Client: r.client, status: map[string]interface{}{"creationTime": "2026-01-03T03:00:05Z"}}
+	r.connectToLiveCluster = func(uri string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		connectedTo = uri
+		return mockLiveCluster{fsyncCalls: &fsyncCalls}, nil
+	}
+
+	assert.NoError(t, r.updateBackupStatus(mdb))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, time.Date(2026, 1, 3, 3, 0, 0, 0, time.UTC), mdb.Status.Backup.NextScheduleTime.UTC())
+	assert.Empty(t, fsyncCalls, "no backup is taken before the schedule")
+
+	r.now = func() time.Time { return time.Date(2026, 1, 3, 3, 0, 10, 0, time.UTC) }
+	assert.NoError(t, r.updateBackupStatus(mdb))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, "mongodb://my-rs-2.my-rs-svc.my-ns.svc.cluster.local:27017/?connect=direct", connectedTo, "the snapshots are taken from the least lagging secondary")
+	assert.Equal(t, []string{"lock", "unlock"}, fsyncCalls)
+	assert.Equal(t, mdbv1.BackupRunning, mdb.Status.Backup.LastPhase)
+	assert.Equal(t, time.Date(2026, 1, 3, 3, 0, 0, 0, time.UTC), mdb.Status.Backup.LastScheduleTime.UTC())
+	assert.Equal(t, time.Date(2026, 1, 4, 3, 0, 0, 0, time.UTC), mdb.Status.Backup.NextScheduleTime.UTC())
+	assert.Equal(t, []string{"my-rs-20260103t030000z-data-volume"}, mdb.Status.Backup.LastSnapshots)
+
+	snapshot, err := getVolumeSnapshot(c, mdb, "my-rs-20260103t030000z-data-volume")
+	assert.NoError(t, err)
+	claimName, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	assert.Equal(t, "data-volume-my-rs-2", claimName)
+	className, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+	assert.Equal(t, "csi-snapclass", className)
+	assert.Equal(t, "my-rs-20260103t030000z", snapshot.GetLabels()[snapshotBackupLabelKey])
+	assert.Empty(t, snapshot.GetOwnerReferences(), "the snapshots are kept when the resource is deleted")
+
+	t.Run("The backup is running until the snapshots are ready to use", func(t *testing.T) {
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, mdbv1.BackupRunning, mdb.Status.Backup.LastPhase)
+
+		_ = unstructured.SetNestedField(snapshot.Object, true, "status", "readyToUse")
+		_ = unstructured.SetNestedField(snapshot.Object, "10Gi", "status", "restoreSize")
+		assert.NoError(t, c.Update(context.TODO(), &snapshot))
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, mdbv1.BackupSucceeded, mdb.Status.Backup.LastPhase)
+		assert.True(t, r.now().Equal(mdb.Status.Backup.LastSuccessfulTime.Time))
+		assert.Equal(t, int64(10*1024*1024*1024), mdb.Status.Backup.LastSize)
+	})
+
+	t.Run("The backup fails without a secondary", func(t *testing.T) {
+		mdb.Status.Members = mdb.Status.Members[:1]
+		assert.NoError(t, c.Status().Update(context.TODO(), &mdb))
+		r.now = func() time.Time { return time.Date(2026, 1, 4, 3, 0, 10, 0, time.UTC) }
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, mdbv1.BackupFailed, mdb.Status.Backup.LastPhase)
+		assert.Equal(t, "Backup my-rs-20260104t030000z failed: there is no secondary to take the snapshots from", mdb.Status.Backup.Message)
+		assert.Nil(t, mdb.Status.Backup.LastSnapshots)
+		assert.NotNil(t, mdb.Status.Backup.LastSuccessfulTime)
+		assert.Equal(t, 1, mdb.Status.Backup.ConsecutiveFailures)
+	})
+}
+
+func TestValidateBackup_Snapshot(t *testing.T) {
+	mdb := newSnapshotBackupReplicaSet()
+	assert.NoError(t, validateBackup(mdb))
+
+	mdb.Spec.Backup.Retention = &mdbv1.BackupRetention{KeepLast: 7}
+	assert.EqualError(t, validateBackup(mdb), "a retention isn't supported with the snapshot method")
+
+	mdb = newSnapshotBackupReplicaSet()
+	mdb.Spec.Backup.Target = newBackupReplicaSet().Spec.Backup.Target
+	assert.EqualError(t, validateBackup(mdb), "the snapshot method requires a volumeSnapshot target")
+
+	mdb = newSnapshotBackupReplicaSet()
+	mdb.Spec.Backup.Method = mdbv1.BackupMethodMongodump
+	assert.EqualError(t, validateBackup(mdb), "a volumeSnapshot target requires the snapshot method")
+
+	backup := newTestMongoDBBackup()
+	backup.Spec.Target = mdb.Spec.Backup.Target
+	assert.EqualError(t, validateMongoDBBackup(backup), "a volumeSnapshot target is only supported by the snapshot method of spec.backup")
+}
+
+func TestTakeVolumeSnapshots_DeletesTheSnapshotsOnError(t *testing.T) {
+	mdb := newSnapshotBackupReplicaSet()
+	mdb.Status.Members = []mdbv1.MemberStatus{{Name: "my-rs-1", State: livecluster.SecondaryState}}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	var fsyncCalls []string
+	r.connectToLiveCluster = func(_ string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		return mockLiveCluster{fsyncCalls: &fsyncCalls}, nil
+	}
+	r.client = snapshotControllerClient{Client: r.client, status: map[string]interface{}{
+		"error": map[string]interface{}{"message": "the volume doesn't support snapshots"},
+	}}
+
+	snapshots, err := r.takeVolumeSnapshots(mdb, "my-rs-20260103t030000z")
+	assert.EqualError(t, err, "error waiting for the VolumeSnapshots to be taken: error taking the VolumeSnapshot my-rs-20260103t030000z-data-volume: the volume doesn't support snapshots")
+	assert.Nil(t, snapshots)
+	assert.Equal(t, []string{"lock", "unlock"}, fsyncCalls)
+	_, err = getVolumeSnapshot(c, mdb, "my-rs-20260103t030000z-data-volume")
+	assert.Error(t, err, "the snapshot is deleted")
+}
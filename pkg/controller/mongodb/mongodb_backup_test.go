@@ -0,0 +1,359 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newBackupReplicaSet() mdbv1.MongoDB {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.Backup = &mdbv1.Backup{
+		Schedule: "0 3 * * *",
+		Target: mdbv1.BackupTarget{
+			PersistentVolumeClaim: &mdbv1.BackupVolumeTarget{ClaimName: "backups", Path: "my-rs"},
+		},
+	}
+	return mdb
+}
+
+func TestEnsureBackupCronJob(t *testing.T) {
+	mdb := newBackupReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	cronJob := batchv1beta1.CronJob{}
+	assert.NoError(t, c.Get(context.TODO(), backupCronJobNamespacedName(mdb), &cronJob))
+	assert.Equal(t, "0 3 * * *", cronJob.Spec.Schedule)
+	assert.Equal(t, batchv1beta1.ForbidConcurrent, cronJob.Spec.ConcurrencyPolicy)
+	assert.False(t, *cronJob.Spec.Suspend)
+	assert.Equal(t, mdb.Name, cronJob.OwnerReferences[0].Name)
+
+	podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	assert.Equal(t, "backups", podSpec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	backupContainer := podSpec.Containers[0]
+	assert.Equal(t, "mongo:4.2.2", backupContainer.Image)
+	assert.Contains(t, backupContainer.Command[2], "mkdir -p /backup/my-rs && mongodump --uri")
+	assert.Contains(t, backupContainer.Command[2], "--readPreference=secondaryPreferred")
+	assert.Contains(t, backupContainer.Command[2], `--archive="/backup/my-rs/my-rs-${timestamp}.archive.gz" && wc -c < "/backup/my-rs/my-rs-${timestamp}.archive.gz" > /dev/termination-log`)
+	assert.True(t, strings.HasPrefix(backupContainer.Command[2], scheduledBackupTimestampScript))
+	assert.Equal(t, "metadata.labels['job-name']", backupContainer.Env[len(backupContainer.Env)-1].ValueFrom.FieldRef.FieldPath)
+	assert.Contains(t, backupContainer.Command[2], `--password "$AGENT_PASSWORD"`)
+	assert.Equal(t, "AGENT_PASSWORD", backupContainer.Env[0].Name)
+
+	t.Run("The CronJob is updated", func(t *testing.T) {
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		mdb.Spec.Backup.Suspend = true
+		assert.NoError(t, c.Update(context.TODO(), &mdb))
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+		assert.NoError(t, c.Get(context.TODO(), backupCronJobNamespacedName(mdb), &cronJob))
+		assert.True(t, *cronJob.Spec.Suspend)
+	})
+
+	t.Run("The CronJob and the status are deleted with spec.backup", func(t *testing.T) {
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		mdb.Status.Backup = &mdbv1.BackupStatus{LastPhase: mdbv1.BackupSucceeded}
+		assert.NoError(t, c.Status().Update(context.TODO(), &mdb))
+		mdb.Spec.Backup = nil
+		assert.NoError(t, c.Update(context.TODO(), &mdb))
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+		assert.Error(t, c.Get(context.TODO(), backupCronJobNamespacedName(mdb), &cronJob))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Nil(t, mdb.Status.Backup)
+	})
+}
+
+func TestBuildBackupCronJob_S3Target(t *testing.T) {
+	mdb := newBackupReplicaSet()
+	mdb.Spec.Backup.Target = mdbv1.BackupTarget{
+		S3: &mdbv1.BackupS3Target{
+			Bucket:                "backups",
+			Prefix:                "prod",
+			Endpoint:              "https://minio.storage.svc:9000",
+			Region:                "eu-west-1",
+			CredentialsSecretName: "minio-credentials",
+			ServerSideEncryption:  &mdbv1.BackupServerSideEncryption{Algorithm: "aws:kms", KMSKeyID: "my-key"},
+		},
+	}
+	podSpec := buildBackupCronJob(mdb).Spec.JobTemplate.Spec.Template.Spec
+
+	assert.Len(t, podSpec.Volumes, 1)
+	assert.NotNil(t, podSpec.Volumes[0].EmptyDir, "no volume is needed to store the archive")
+	assert.Equal(t, "rm -f /stream/archive /stream/exit-code && mkfifo /stream/archive", podSpec.InitContainers[0].Command[2])
+
+	backupContainer := podSpec.Containers[0]
+	assert.Equal(t, backupContainerName, backupContainer.Name)
+	assert.Contains(t, backupContainer.Command[2], "exec 3>/stream/archive; mongodump --uri")
+	assert.Contains(t, backupContainer.Command[2], "--readPreference=secondaryPreferred --gzip --archive >&3; code=$?; echo $code > /stream/exit-code")
+	assert.Equal(t, "AGENT_PASSWORD", backupContainer.Env[0].Name)
+
+	uploadContainer := podSpec.Containers[1]
+	assert.Equal(t, awsCLIImage, uploadContainer.Image)
+	assert.Equal(t, scheduledBackupTimestampScript+`object="s3://backups/prod/my-rs-${timestamp}.archive.gz"; `+
+		`aws --endpoint-url "https://minio.storage.svc:9000" s3 cp --sse aws:kms --sse-kms-key-id "my-key" - "$object" < /stream/archive && [ "$(cat /stream/exit-code)" = 0 ] && `+
+		`{ aws --endpoint-url "https://minio.storage.svc:9000" s3api head-object --bucket "backups" --key "prod/my-rs-${timestamp}.archive.gz" --query ContentLength --output text > /dev/termination-log; exit 0; }; `+
+		`aws --endpoint-url "https://minio.storage.svc:9000" s3 rm "$object"; exit 1`, uploadContainer.Command[2])
+	assert.Equal(t, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: "eu-west-1"}, uploadContainer.Env[0])
+	assert.Equal(t, "JOB_NAME", uploadContainer.Env[1].Name)
+	assert.Equal(t, "minio-credentials", uploadContainer.EnvFrom[0].SecretRef.Name)
+}
+
+func TestUpdateBackupStatus(t *testing.T) {
+	mdb := newBackupReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	assert.NoError(t, r.ensureBackupCronJob(mdb))
+
+	scheduledAt := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	cronJob := batchv1beta1.CronJob{}
+	assert.NoError(t, c.Get(context.TODO(), backupCronJobNamespacedName(mdb), &cronJob))
+	cronJob.Status.LastScheduleTime = &metav1.Time{Time: scheduledAt}
+	assert.NoError(t, c.Update(context.TODO(), &cronJob))
+
+	jobName := fmt.Sprintf("my-rs-backup-%d", scheduledAt.Unix()/60)
+	job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: mdb.Namespace}}
+	assert.NoError(t, c.Create(context.TODO(), &job))
+
+	assert.NoError(t, r.updateBackupStatus(mdb))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, &mdbv1.BackupStatus{LastScheduleTime: &metav1.Time{Time: scheduledAt}, LastJob: jobName, LastPhase: mdbv1.BackupRunning}, mdb.Status.Backup)
+
+	t.Run("A successful backup is recorded", func(t *testing.T) {
+		completedAt := metav1.NewTime(scheduledAt.Add(10 * time.Minute))
+		job.Status = batchv1.JobStatus{Succeeded: 1, CompletionTime: &completedAt}
+		assert.NoError(t, c.Update(context.TODO(), &job))
+		r.client = jobPodsClient{Client: r.client, pods: []corev1.Pod{succeededJobPod(jobName, "1048576\n")}}
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, mdbv1.BackupSucceeded, mdb.Status.Backup.LastPhase)
+		assert.True(t, completedAt.Equal(mdb.Status.Backup.LastSuccessfulTime))
+		assert.Equal(t, int64(1048576), mdb.Status.Backup.LastSize)
+		assert.Equal(t, float64(completedAt.Unix()), testutil.ToFloat64(lastSuccessfulBackup.WithLabelValues(mdb.Namespace, mdb.Name)))
+		assert.Equal(t, 1048576.0, testutil.ToFloat64(lastBackupSize.WithLabelValues(mdb.Namespace, mdb.Name)))
+	})
+
+	t.Run("A failed backup keeps the last successful time", func(t *testing.T) {
+		job.Status = batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}}
+		assert.NoError(t, c.Update(context.TODO(), &job))
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, mdbv1.BackupFailed, mdb.Status.Backup.LastPhase)
+		assert.Equal(t, fmt.Sprintf("Job %s failed: Job has reached the specified backoff limit", jobName), mdb.Status.Backup.Message)
+		assert.NotNil(t, mdb.Status.Backup.LastSuccessfulTime)
+		assert.Equal(t, 1, mdb.Status.Backup.ConsecutiveFailures)
+		assert.Equal(t, 1.0, testutil.ToFloat64(backupConsecutiveFailures.WithLabelValues(mdb.Namespace, mdb.Name)))
+
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, 1, mdb.Status.Backup.ConsecutiveFailures, "a failure is only counted once")
+	})
+}
+
+// jobPodsClient returns the given Pods when Pods are listed
+type jobPodsClient struct {
+	client.Client
+	pods []corev1.Pod
+}
+
+func (c jobPodsClient) List(ctx context.Context, list runtime.Object, opts ...k8sClient.ListOption) error {
+	if podList, ok := list.(*corev1.PodList); ok {
+		podList.Items = c.pods
+		return nil
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+// succeededJobPod returns a succeeded Pod of the Job, whose container terminated with the message
+func succeededJobPod(jobName, message string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: jobName + "-abcde", Labels: map[string]string{"job-name": jobName}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: backupContainerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}}},
+			},
+		},
+	}
+}
+
+func TestValidateBackup(t *testing.T) {
+	mdb := newBackupReplicaSet()
+	assert.NoError(t, validateBackup(mdb))
+
+	mdb.Spec.Backup.Schedule = "every day"
+	assert.Error(t, validateBackup(mdb))
+
+	mdb = newBackupReplicaSet()
+	mdb.Spec.Backup.Method = "filesystem"
+	assert.EqualError(t, validateBackup(mdb), "unsupported method filesystem")
+
+	mdb = newBackupReplicaSet()
+	mdb.Spec.Backup.Target = mdbv1.BackupTarget{}
+	assert.EqualError(t, validateBackup(mdb), "a target must be set")
+
+	mdb = newBackupReplicaSet()
+	mdb.Spec.Backup.Target.PersistentVolumeClaim.Path = "../other"
+	assert.Error(t, validateBackup(mdb))
+
+	mdb = newBackupReplicaSet()
+	mdb.Spec.Backup.Target.S3 = &mdbv1.BackupS3Target{Bucket: "backups"}
+	assert.EqualError(t, validateBackup(mdb), "only one target can be set")
+
+	mdb.Spec.Backup.Target.PersistentVolumeClaim = nil
+	assert.NoError(t, validateBackup(mdb))
+
+	mdb.Spec.Backup.Target.S3.Endpoint = "minio:9000"
+	assert.EqualError(t, validateBackup(mdb), "the endpoint of the target must be an http:// or https:// URL")
+
+	mdb.Spec.Backup.Target.S3.Endpoint = ""
+	mdb.Spec.Backup.Target.S3.ServerSideEncryption = &mdbv1.BackupServerSideEncryption{Algorithm: "AES256", KMSKeyID: "my-key"}
+	assert.EqualError(t, validateBackup(mdb), "a KMS key can only be used with the aws:kms server-side encryption algorithm")
+
+	mdb.Spec.Backup.Target.S3 = &mdbv1.BackupS3Target{}
+	assert.EqualError(t, validateBackup(mdb), "the bucket of the target must be set")
+
+	mdb = newBackupReplicaSet()
+	mdb.Spec.Backup.Retention = &mdbv1.BackupRetention{KeepDaily: 7, KeepWeekly: 4}
+	assert.NoError(t, validateBackup(mdb))
+
+	mdb.Spec.Backup.Retention = &mdbv1.BackupRetention{}
+	assert.EqualError(t, validateBackup(mdb), "the retention must keep at least one backup")
+
+	mdb.Spec.Backup.Retention = &mdbv1.BackupRetention{KeepLast: -1, KeepDaily: 7}
+	assert.EqualError(t, validateBackup(mdb), "the retention can't be negative")
+}
+
+func TestExpiredBackupArchives(t *testing.T) {
+	// a backup every 12 hours during 3 weeks, the most recent first
+	var archives []mdbv1.BackupArchive
+	for i := 0; i < 42; i++ {
+		scheduledAt := time.Date(2026, 1, 25, 12, 0, 0, 0, time.UTC).Add(time.Duration(-12*i) * time.Hour)
+		archives = append(archives, mdbv1.BackupArchive{Location: fmt.Sprintf("backups:/%d", i), Time: metav1.NewTime(scheduledAt)})
+	}
+	kept := func(retention mdbv1.BackupRetention) []string {
+		expired := map[string]bool{}
+		for _, archive := range expiredBackupArchives(archives, retention) {
+			expired[archive.Location] = true
+		}
+		var locations []string
+		for _, archive := range archives {
+			if !expired[archive.Location] {
+				locations = append(locations, archive.Location)
+			}
+		}
+		return locations
+	}
+
+	assert.Equal(t, []string{"backups:/0", "backups:/1", "backups:/2"}, kept(mdbv1.BackupRetention{KeepLast: 3}))
+	assert.Equal(t, []string{"backups:/0", "backups:/2", "backups:/4"}, kept(mdbv1.BackupRetention{KeepDaily: 3}))
+	// the 25th of January 2026 is a Sunday, the last day of its ISO week
+	assert.Equal(t, []string{"backups:/0", "backups:/14", "backups:/28"}, kept(mdbv1.BackupRetention{KeepWeekly: 3}))
+	assert.Equal(t, []string{"backups:/0", "backups:/1", "backups:/2", "backups:/14"}, kept(mdbv1.BackupRetention{KeepLast: 2, KeepDaily: 2, KeepWeekly: 2}))
+	assert.Len(t, expiredBackupArchives(archives, mdbv1.BackupRetention{KeepLast: 50}), 0)
+}
+
+func TestPruneBackups(t *testing.T) {
+	mdb := newBackupReplicaSet()
+	mdb.Spec.Backup.Retention = &mdbv1.BackupRetention{KeepLast: 2}
+	mdb.Status.Backup = &mdbv1.BackupStatus{Archives: []mdbv1.BackupArchive{
+		{Location: "backups:/my-rs/my-rs-20260102T030000Z.archive.gz", Time: metav1.NewTime(time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC))},
+		{Location: "backups:/my-rs/my-rs-20260101T030000Z.archive.gz", Time: metav1.NewTime(time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC))},
+		{Location: "old-backups:/my-rs/my-rs-20251231T030000Z.archive.gz", Time: metav1.NewTime(time.Date(2025, 12, 31, 3, 0, 0, 0, time.UTC))},
+	}}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.now = func() time.Time { return time.Date(2026, 1, 3, 3, 30, 0, 0, time.UTC) }
+	assert.NoError(t, r.ensureBackupCronJob(mdb))
+
+	scheduledAt := time.Date(2026, 1, 3, 3, 0, 0, 0, time.UTC)
+	cronJob := batchv1beta1.CronJob{}
+	assert.NoError(t, c.Get(context.TODO(), backupCronJobNamespacedName(mdb), &cronJob))
+	cronJob.Status.LastScheduleTime = &metav1.Time{Time: scheduledAt}
+	assert.NoError(t, c.Update(context.TODO(), &cronJob))
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("my-rs-backup-%d", scheduledAt.Unix()/60), Namespace: mdb.Namespace},
+		Status:     batchv1.JobStatus{Succeeded: 1},
+	}
+	assert.NoError(t, c.Create(context.TODO(), &job))
+
+	assert.NoError(t, r.updateBackupStatus(mdb))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, []string{
+		"backups:/my-rs/my-rs-20260103T030000Z.archive.gz",
+		"backups:/my-rs/my-rs-20260102T030000Z.archive.gz",
+		"backups:/my-rs/my-rs-20260101T030000Z.archive.gz",
+	}, archiveLocations(mdb.Status.Backup.Archives), "the archives of a previous target aren't tracked")
+
+	pruneJob := batchv1.Job{}
+	assert.NoError(t, c.Get(context.TODO(), backupPruneJobNamespacedName(mdb), &pruneJob))
+	assert.Equal(t, `["backups:/my-rs/my-rs-20260101T030000Z.archive.gz"]`, pruneJob.Annotations[prunedArchivesAnnotationKey])
+	pruneContainer := pruneJob.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, `exec rm -f "/backup/my-rs/my-rs-20260101T030000Z.archive.gz"`, pruneContainer.Command[2])
+	assert.Equal(t, "backups", pruneJob.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+
+	t.Run("Nothing is recorded while the Job is running", func(t *testing.T) {
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Len(t, mdb.Status.Backup.Archives, 3)
+		assert.Nil(t, mdb.Status.Backup.LastPruneTime)
+	})
+
+	t.Run("The pruned archives are recorded once the Job succeeds", func(t *testing.T) {
+		pruneJob.Status.Succeeded = 1
+		assert.NoError(t, c.Update(context.TODO(), &pruneJob))
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, []string{
+			"backups:/my-rs/my-rs-20260103T030000Z.archive.gz",
+			"backups:/my-rs/my-rs-20260102T030000Z.archive.gz",
+		}, archiveLocations(mdb.Status.Backup.Archives))
+		assert.Equal(t, []string{"backups:/my-rs/my-rs-20260101T030000Z.archive.gz"}, mdb.Status.Backup.LastPruned)
+		assert.True(t, r.now().Equal(mdb.Status.Backup.LastPruneTime.Time))
+		assert.Error(t, c.Get(context.TODO(), backupPruneJobNamespacedName(mdb), &pruneJob), "the Job is deleted")
+	})
+}
+
+func TestBuildBackupPruneJob_S3Target(t *testing.T) {
+	mdb := newBackupReplicaSet()
+	mdb.Spec.Backup.Target = mdbv1.BackupTarget{
+		S3: &mdbv1.BackupS3Target{Bucket: "backups", Endpoint: "https://minio.storage.svc:9000", CredentialsSecretName: "minio-credentials"},
+	}
+	job, err := buildBackupPruneJob(mdb, []string{"s3://backups/my-rs-1.archive.gz", "s3://backups/my-rs-2.archive.gz"})
+	assert.NoError(t, err)
+	pruneContainer := job.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, awsCLIImage, pruneContainer.Image)
+	assert.Equal(t, `aws --endpoint-url "https://minio.storage.svc:9000" s3 rm "s3://backups/my-rs-1.archive.gz" && `+
+		`aws --endpoint-url "https://minio.storage.svc:9000" s3 rm "s3://backups/my-rs-2.archive.gz"`, pruneContainer.Command[2])
+	assert.Equal(t, "minio-credentials", pruneContainer.EnvFrom[0].SecretRef.Name)
+	assert.Len(t, job.Spec.Template.Spec.Volumes, 0)
+}
+
+func archiveLocations(archives []mdbv1.BackupArchive) []string {
+	var locations []string
+	for _, archive := range archives {
+		locations = append(locations, archive.Location)
+	}
+	return locations
+}
@@ -0,0 +1,362 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/cron"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	backupVerifiedEventReason           = "BackupVerified"
+	backupVerificationFailedEventReason = "BackupVerificationFailed"
+
+	verifyContainerName = "verify"
+	// verifyPath is where the volume holding the downloaded archive and the data of the standalone
+	// mongod is mounted
+	verifyPath = "/verify"
+)
+
+// verifyScript is evaluated by the mongo shell against the standalone mongod the archive was restored
+// into, with archive set to the name of the archive and checks to the checks of the verification. It
+// validates every collection, evaluates the checks, and prints the result as JSON on its last line.
+const verifyScript = `var result = {archive: archive, collections: 0, documents: 0, failures: []};
+db.adminCommand({listDatabases: 1}).databases.forEach(function(d) {
+  if (["admin", "config", "local"].indexOf(d.name) >= 0) return;
+  var database = db.getSiblingDB(d.name);
+  database.getCollectionInfos({type: "collection"}).forEach(function(c) {
+    if (c.name.indexOf("system.") === 0) return;
+    var validation = database.runCommand({validate: c.name});
+    if (!validation.ok || !validation.valid) {
+      result.failures.push(d.name + "." + c.name + " is invalid: " + (validation.errors || [validation.errmsg]).join(", "));
+    }
+    result.collections++;
+    result.documents += validation.nrecords || 0;
+  });
+});
+checks.forEach(function(check) {
+  try {
+    if (!(new Function("db", "return (" + check.expression + ");"))(db.getSiblingDB(check.database))) {
+      result.failures.push("the check " + check.name + " doesn't hold");
+    }
+  } catch (e) {
+    result.failures.push("the check " + check.name + " failed: " + e);
+  }
+});
+print(JSON.stringify(result));
+quit(result.failures.length > 0 ? 1 : 0);`
+
+// verificationResult is the result printed by verifyScript
+type verificationResult struct {
+	Archive     string   `json:"archive"`
+	Collections int      `json:"collections"`
+	Documents   int64    `json:"documents"`
+	Failures    []string `json:"failures"`
+}
+
+// validateBackupVerification ensures the verification has a valid schedule and valid checks, and that
+// the backups are archives
+func validateBackupVerification(backup mdbv1.Backup) error {
+	verification := backup.Verification
+	if verification == nil {
+		return nil
+	}
+	if backup.Method == mdbv1.BackupMethodSnapshot {
+		return fmt.Errorf("verification requires the mongodump method")
+	}
+	if _, err := cron.Parse(verification.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule of verification: %s", err)
+	}
+	for _, check := range verification.Checks {
+		if check.Name == "" || check.Database == "" || check.Expression == "" {
+			return fmt.Errorf("the name, the database and the expression of the checks of verification must be set")
+		}
+	}
+	return nil
+}
+
+func backupVerificationCronJobNamespacedName(mdb mdbv1.MongoDB) types.NamespacedName {
+	return types.NamespacedName{Name: mdb.Name + "-backup-verify", Namespace: mdb.Namespace}
+}
+
+// ensureBackupVerificationCronJob creates or updates the CronJob verifying the scheduled backups when
+// spec.backup.verification is set, or deletes it
+func (r *ReplicaSetReconciler) ensureBackupVerificationCronJob(mdb mdbv1.MongoDB) error {
+	nsName := backupVerificationCronJobNamespacedName(mdb)
+	existing := batchv1beta1.CronJob{}
+	err := r.client.Get(context.TODO(), nsName, &existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting backup verification CronJob: %s", err)
+	}
+	found := err == nil
+
+	if mdb.Spec.Backup == nil || mdb.Spec.Backup.Verification == nil || mdb.Spec.Backup.Method == mdbv1.BackupMethodSnapshot {
+		if !found {
+			return nil
+		}
+		if err := r.client.Delete(context.TODO(), &existing, k8sClient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting backup verification CronJob: %s", err)
+		}
+		r.log.Infof("Deleted the backup verification CronJob %s", nsName.Name)
+		return nil
+	}
+
+	desired := buildBackupVerificationCronJob(mdb)
+	if !found {
+		if err := r.client.Create(context.TODO(), &desired); err != nil {
+			return fmt.Errorf("error creating backup verification CronJob: %s", err)
+		}
+		r.log.Infof("Scheduled the verification of the backups with the CronJob %s", nsName.Name)
+		return nil
+	}
+	if reflect.DeepEqual(existing.Spec, desired.Spec) {
+		return nil
+	}
+	existing.Spec = desired.Spec
+	if err := r.client.Update(context.TODO(), &existing); err != nil {
+		return fmt.Errorf("error updating backup verification CronJob: %s", err)
+	}
+	return nil
+}
+
+// scheduledArchivePattern is the extended regular expression matching the names of the archives of
+// the scheduled backups of the named resource, which sort by the time they were taken at
+func scheduledArchivePattern(resourceName string) string {
+	return fmt.Sprintf(`^%s-[0-9]{8}T[0-9]{6}Z\.archive\.gz$`, regexp.QuoteMeta(resourceName))
+}
+
+// buildBackupVerificationCronJob returns the CronJob verifying the most recent scheduled backup on the
+// schedule of spec.backup.verification. Its Pod starts a standalone mongod with its data in an
+// emptyDir volume, restores the archive into it, validates the restored collections and evaluates
+// the checks, and reports the result as the termination message of the verify container. The
+// archive of an s3 target is downloaded by an init container.
+func buildBackupVerificationCronJob(mdb mdbv1.MongoDB) batchv1beta1.CronJob {
+	backup := mdb.Spec.Backup
+	volume := statefulset.CreateVolumeFromEmptyDir("verify")
+	volumeMount := statefulset.CreateVolumeMount(volume.Name, verifyPath, statefulset.WithReadOnly(false))
+	fail := fmt.Sprintf(`fail() { echo "$1"; echo "$1" > %s; exit 1; };`, corev1.TerminationMessagePathDefault)
+
+	var locate string
+	var source podtemplatespec.Modification
+	if target := backup.Target.S3; target != nil {
+		endpoint, dir := s3EndpointOption(*target), s3BackupObject(*target, "")+"/"
+		download := strings.Join([]string{
+			fail,
+			fmt.Sprintf(`name=$(aws%s s3 ls "%s" | awk '{print $4}' | grep -E '%s' | sort | tail -n 1);`, endpoint, dir, scheduledArchivePattern(mdb.Name)),
+			fmt.Sprintf(`[ -n "$name" ] || fail "There is no scheduled backup in %s";`, dir),
+			fmt.Sprintf(`aws%s s3 cp "%s$name" %s/archive.gz > /dev/null || fail "Downloading $name failed"; echo "$name" > %s/archive-name`, endpoint, dir, verifyPath, verifyPath),
+		}, " ")
+		locate = fmt.Sprintf(`name=$(cat %[1]s/archive-name); archive=%[1]s/archive.gz;`, verifyPath)
+		source = podtemplatespec.WithInitContainer("download", container.Apply(
+			container.WithName("download"),
+			container.WithImage(awsCLIImage),
+			container.WithCommand([]string{"/bin/sh", "-c", download}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+			s3Credentials(*target),
+		))
+	} else {
+		target := backup.Target.PersistentVolumeClaim
+		backupVolume := statefulset.CreateVolumeFromPersistentVolumeClaim("backup", target.ClaimName)
+		dir := path.Join(backupMountPath, target.Path)
+		locate = strings.Join([]string{
+			fmt.Sprintf(`name=$(ls %s | grep -E '%s' | sort | tail -n 1);`, dir, scheduledArchivePattern(mdb.Name)),
+			fmt.Sprintf(`[ -n "$name" ] || fail "There is no scheduled backup in %s:%s";`, target.ClaimName, path.Join("/", target.Path)),
+			fmt.Sprintf(`archive="%s/$name";`, dir),
+		}, " ")
+		source = podtemplatespec.Apply(
+			podtemplatespec.WithVolume(backupVolume),
+			podtemplatespec.WithVolumeMounts(verifyContainerName, statefulset.CreateVolumeMount(backupVolume.Name, backupMountPath, statefulset.WithReadOnly(true))),
+		)
+	}
+
+	restore := `mongorestore --port 27017 --archive="$archive" --gzip --quiet`
+	encryption := podtemplatespec.NOOP()
+	if backup.Encryption != nil {
+		restore = fmt.Sprintf(`{ { %s; echo $? > /tmp/decrypt-code; } | mongorestore --port 27017 --archive --gzip --quiet && [ "$(cat /tmp/decrypt-code)" = 0 ]; }`,
+			decryptCommand(`"$archive"`, encryptionKeyEnv))
+		encryption = podtemplatespec.Apply(
+			withBackupCrypt(verifyContainerName),
+			podtemplatespec.WithContainer(verifyContainerName, encryptionKey(*backup.Encryption, encryptionKeyEnv)),
+		)
+	}
+	verify := strings.Join([]string{
+		fail,
+		locate,
+		fmt.Sprintf(`mkdir -p %[1]s/db && mongod --dbpath %[1]s/db --port 27017 --bind_ip 127.0.0.1 --fork --logpath %[1]s/mongod.log > /dev/null || fail "mongod didn't start: $(tail -n 5 %[1]s/mongod.log)";`, verifyPath),
+		fmt.Sprintf(`%s || fail "Restoring $name failed";`, restore),
+		fmt.Sprintf(`mongo --quiet --port 27017 --eval "var archive = \"$name\", checks = $VERIFY_CHECKS; $VERIFY_SCRIPT" > %[1]s/result; code=$?;`, verifyPath),
+		fmt.Sprintf(`cat %[1]s/result; tail -n 1 %[1]s/result > %[2]s; exit $code`, verifyPath, corev1.TerminationMessagePathDefault),
+	}, " ")
+
+	checks := backup.Verification.Checks
+	if checks == nil {
+		checks = []mdbv1.BackupVerificationCheck{}
+	}
+	checksJSON, _ := json.Marshal(checks)
+
+	labels := map[string]string{"app": mdb.Name + "-backup-verify"}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		podtemplatespec.WithVolume(volume),
+		podtemplatespec.WithContainer(verifyContainerName, container.Apply(
+			container.WithName(verifyContainerName),
+			container.WithImage(fmt.Sprintf("mongo:%s", mdb.Spec.Version)),
+			container.WithCommand([]string{"/bin/sh", "-c", verify}),
+			container.WithEnvs(
+				corev1.EnvVar{Name: "VERIFY_SCRIPT", Value: verifyScript},
+				corev1.EnvVar{Name: "VERIFY_CHECKS", Value: string(checksJSON)},
+			),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+		)),
+		source,
+		encryption,
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	// a verification which failed isn't retried, it would fail again
+	backoffLimit := int32(0)
+	suspend := backup.Suspend
+	nsName := backupVerificationCronJobNamespacedName(mdb)
+	return batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            nsName.Name,
+			Namespace:       nsName.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:          backup.Verification.Schedule,
+			ConcurrencyPolicy: batchv1beta1.ForbidConcurrent,
+			Suspend:           &suspend,
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template:     template,
+				},
+			},
+		},
+	}
+}
+
+// updateBackupVerification records the outcome of the last verification scheduled by the verification
+// CronJob in status.backup.lastVerification, from the result reported by its Pod
+func (r *ReplicaSetReconciler) updateBackupVerification(mdb mdbv1.MongoDB, status *mdbv1.BackupStatus) error {
+	if mdb.Spec.Backup.Verification == nil {
+		return nil
+	}
+	cronJob := batchv1beta1.CronJob{}
+	if err := r.client.Get(context.TODO(), backupVerificationCronJobNamespacedName(mdb), &cronJob); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting backup verification CronJob: %s", err)
+	}
+	job, err := r.lastBackupJob(cronJob)
+	if err != nil || job == nil {
+		return err
+	}
+	previous := status.LastVerification
+	if previous != nil && previous.Job == job.Name && previous.Phase != mdbv1.BackupRunning {
+		return nil
+	}
+
+	verification := mdbv1.BackupVerificationStatus{Job: job.Name, Phase: mdbv1.BackupRunning}
+	if previous != nil {
+		verification.LastSuccessfulTime = previous.LastSuccessfulTime
+	}
+	failure, failed := jobFailure(*job)
+	if job.Status.Succeeded == 0 && !failed {
+		status.LastVerification = &verification
+		return nil
+	}
+
+	message, err := jobTerminationMessage(r.client, *job)
+	if err != nil {
+		return err
+	}
+	result := verificationResult{}
+	parsed := json.Unmarshal([]byte(message), &result) == nil
+	if parsed {
+		verification.Archive, verification.Collections, verification.Documents = result.Archive, result.Collections, result.Documents
+	}
+	now := metav1.NewTime(r.now())
+	verification.CompletionTime = &now
+	if job.Status.Succeeded > 0 {
+		verification.Phase, verification.LastSuccessfulTime = mdbv1.BackupSucceeded, &now
+	} else {
+		verification.Phase, verification.Message = mdbv1.BackupFailed, failure
+		if parsed && len(result.Failures) > 0 {
+			verification.Message = strings.Join(result.Failures, "; ")
+		} else if !parsed && message != "" {
+			verification.Message = message
+		}
+	}
+	status.LastVerification = &verification
+	return nil
+}
+
+// recordBackupVerificationEvents emits an event once a verification completes or fails
+func (r *ReplicaSetReconciler) recordBackupVerificationEvents(mdb mdbv1.MongoDB, previous, current *mdbv1.BackupVerificationStatus) {
+	if current == nil || (previous != nil && previous.Job == current.Job && previous.Phase == current.Phase) {
+		return
+	}
+	switch current.Phase {
+	case mdbv1.BackupSucceeded:
+		message := fmt.Sprintf("Verified the backup %s: restored %d collections and %d documents", current.Archive, current.Collections, current.Documents)
+		r.log.Info(message)
+		if r.recorder != nil {
+			r.recorder.Event(&mdb, corev1.EventTypeNormal, backupVerifiedEventReason, message)
+		}
+	case mdbv1.BackupFailed:
+		message := fmt.Sprintf("The verification of the backup %s failed: %s", current.Archive, current.Message)
+		if current.Archive == "" {
+			message = fmt.Sprintf("The verification of the backups failed: %s", current.Message)
+		}
+		r.log.Warn(message)
+		if r.recorder != nil {
+			r.recorder.Event(&mdb, corev1.EventTypeWarning, backupVerificationFailedEventReason, message)
+		}
+	}
+}
+
+// jobTerminationMessage returns the last termination message written by the containers of the most
+// recent Pod of the Job, or an empty string if there is none
+func jobTerminationMessage(c k8sClient.Reader, job batchv1.Job) (string, error) {
+	pods := corev1.PodList{}
+	if err := c.List(context.TODO(), &pods, k8sClient.InNamespace(job.Namespace), k8sClient.MatchingLabels{"job-name": job.Name}); err != nil {
+		return "", fmt.Errorf("error listing the Pods of the Job %s: %s", job.Name, err)
+	}
+	if len(pods.Items) == 0 {
+		return "", nil
+	}
+	sort.SliceStable(pods.Items, func(i, j int) bool {
+		return pods.Items[j].CreationTimestamp.Before(&pods.Items[i].CreationTimestamp)
+	})
+	message := ""
+	pod := pods.Items[0]
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if terminated := status.State.Terminated; terminated != nil && strings.TrimSpace(terminated.Message) != "" {
+			message = strings.TrimSpace(terminated.Message)
+		}
+	}
+	return message, nil
+}
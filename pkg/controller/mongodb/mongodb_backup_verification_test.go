@@ -0,0 +1,179 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func withBackupVerification(mdb mdbv1.MongoDB) mdbv1.MongoDB {
+	mdb.Spec.Backup.Verification = &mdbv1.BackupVerification{
+		Schedule: "0 6 * * 0",
+		Checks:   []mdbv1.BackupVerificationCheck{{Name: "orders", Database: "shop", Expression: "db.orders.countDocuments({}) > 0"}},
+	}
+	return mdb
+}
+
+func TestEnsureBackupVerificationCronJob(t *testing.T) {
+	mdb := withBackupVerification(newBackupReplicaSet())
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	cronJob := batchv1beta1.CronJob{}
+	assert.NoError(t, c.Get(context.TODO(), backupVerificationCronJobNamespacedName(mdb), &cronJob))
+	assert.Equal(t, "my-rs-backup-verify", cronJob.Name)
+	assert.Equal(t, "0 6 * * 0", cronJob.Spec.Schedule)
+	assert.Equal(t, batchv1beta1.ForbidConcurrent, cronJob.Spec.ConcurrencyPolicy)
+	assert.Equal(t, int32(0), *cronJob.Spec.JobTemplate.Spec.BackoffLimit)
+	assert.Equal(t, mdb.Name, cronJob.OwnerReferences[0].Name)
+
+	podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	assert.Len(t, podSpec.InitContainers, 0)
+	verifyContainer := podSpec.Containers[0]
+	assert.Equal(t, "mongo:4.2.2", verifyContainer.Image)
+	assert.Contains(t, verifyContainer.VolumeMounts, corev1.VolumeMount{Name: "backup", MountPath: "/backup", ReadOnly: true})
+	command := verifyContainer.Command[2]
+	assert.Contains(t, command, `name=$(ls /backup/my-rs | grep -E '^my-rs-[0-9]{8}T[0-9]{6}Z\.archive\.gz$' | sort | tail -n 1); [ -n "$name" ] || fail "There is no scheduled backup in backups:/my-rs"; archive="/backup/my-rs/$name";`)
+	assert.Contains(t, command, "mongod --dbpath /verify/db --port 27017 --bind_ip 127.0.0.1 --fork")
+	assert.Contains(t, command, `mongorestore --port 27017 --archive="$archive" --gzip --quiet || fail "Restoring $name failed";`)
+	assert.Contains(t, command, "tail -n 1 /verify/result > /dev/termination-log; exit $code")
+	for _, env := range verifyContainer.Env {
+		if env.Name == "VERIFY_CHECKS" {
+			checks := []mdbv1.BackupVerificationCheck{}
+			assert.NoError(t, json.Unmarshal([]byte(env.Value), &checks))
+			assert.Equal(t, mdb.Spec.Backup.Verification.Checks, checks)
+		}
+	}
+
+	t.Run("The CronJob is deleted with the verification", func(t *testing.T) {
+		mdb.Spec.Backup.Verification = nil
+		assert.NoError(t, r.ensureBackupVerificationCronJob(mdb))
+		err := c.Get(context.TODO(), backupVerificationCronJobNamespacedName(mdb), &cronJob)
+		assert.Error(t, err)
+	})
+}
+
+func TestBuildBackupVerificationCronJob_S3Target(t *testing.T) {
+	mdb := withBackupVerification(newPointInTimeReplicaSet())
+	mdb.Spec.Backup.Encryption = &mdbv1.BackupEncryption{KeySecretName: "backup-key"}
+	podSpec := buildBackupVerificationCronJob(mdb).Spec.JobTemplate.Spec.Template.Spec
+
+	download := podSpec.InitContainers[0]
+	assert.Equal(t, "download", download.Name)
+	assert.Equal(t, awsCLIImage, download.Image)
+	assert.Equal(t, "minio-credentials", download.EnvFrom[0].SecretRef.Name)
+	assert.Contains(t, download.Command[2], `name=$(aws --endpoint-url "http://minio:9000" s3 ls "s3://backups/my-rs/" | awk '{print $4}' | grep -E '^my-rs-[0-9]{8}T[0-9]{6}Z\.archive\.gz$' | sort | tail -n 1);`)
+	assert.Contains(t, download.Command[2], `s3 cp "s3://backups/my-rs/$name" /verify/archive.gz`)
+
+	assertHasBackupCrypt(t, podSpec, verifyContainerName)
+	verifyContainer := podSpec.Containers[0]
+	assert.Contains(t, verifyContainer.Command[2], "name=$(cat /verify/archive-name); archive=/verify/archive.gz;")
+	assert.Contains(t, verifyContainer.Command[2], `{ { /backup-crypt/backup-crypt -decrypt -key-env BACKUP_ENCRYPTION_KEY < "$archive"; echo $? > /tmp/decrypt-code; } | mongorestore`)
+	assertEncryptionKey(t, verifyContainer, encryptionKeyEnv, "backup-key")
+}
+
+func TestUpdateBackupStatus_Verification(t *testing.T) {
+	mdb := withBackupVerification(newBackupReplicaSet())
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	now := time.Date(2026, 1, 4, 6, 20, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	assert.NoError(t, r.ensureBackupCronJob(mdb))
+	assert.NoError(t, r.ensureBackupVerificationCronJob(mdb))
+
+	schedule := func(scheduledAt time.Time) batchv1.Job {
+		cronJob := batchv1beta1.CronJob{}
+		assert.NoError(t, c.Get(context.TODO(), backupVerificationCronJobNamespacedName(mdb), &cronJob))
+		cronJob.Status.LastScheduleTime = &metav1.Time{Time: scheduledAt}
+		assert.NoError(t, c.Update(context.TODO(), &cronJob))
+		job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("my-rs-backup-verify-%d", scheduledAt.Unix()/60), Namespace: mdb.Namespace}}
+		assert.NoError(t, c.Create(context.TODO(), &job))
+		return job
+	}
+	failed := batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}}
+
+	job := schedule(time.Date(2026, 1, 4, 6, 0, 0, 0, time.UTC))
+	assert.NoError(t, r.updateBackupStatus(mdb))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, &mdbv1.BackupVerificationStatus{Job: job.Name, Phase: mdbv1.BackupRunning}, mdb.Status.Backup.LastVerification)
+
+	t.Run("A successful verification is recorded", func(t *testing.T) {
+		job.Status = batchv1.JobStatus{Succeeded: 1}
+		assert.NoError(t, c.Update(context.TODO(), &job))
+		pod := succeededJobPod(job.Name, `{"archive":"my-rs-20260104T030000Z.archive.gz","collections":12,"documents":48210,"failures":[]}`+"\n")
+		r.client = jobPodsClient{Client: r.client, pods: []corev1.Pod{pod}}
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		verification := mdb.Status.Backup.LastVerification
+		assert.Equal(t, mdbv1.BackupSucceeded, verification.Phase)
+		assert.Equal(t, "my-rs-20260104T030000Z.archive.gz", verification.Archive)
+		assert.Equal(t, 12, verification.Collections)
+		assert.Equal(t, int64(48210), verification.Documents)
+		assert.True(t, now.Equal(verification.LastSuccessfulTime.Time))
+		assert.Equal(t, float64(now.Unix()), testutil.ToFloat64(lastSuccessfulBackupVerification.WithLabelValues(mdb.Namespace, mdb.Name)))
+	})
+
+	t.Run("The failed checks are reported", func(t *testing.T) {
+		job := schedule(time.Date(2026, 1, 11, 6, 0, 0, 0, time.UTC))
+		job.Status = failed
+		assert.NoError(t, c.Update(context.TODO(), &job))
+		pod := succeededJobPod(job.Name, `{"archive":"my-rs-20260111T030000Z.archive.gz","collections":12,"documents":0,"failures":["the check orders doesn't hold"]}`)
+		pod.Status.Phase = corev1.PodFailed
+		r.client = jobPodsClient{Client: r.client, pods: []corev1.Pod{pod}}
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		verification := mdb.Status.Backup.LastVerification
+		assert.Equal(t, mdbv1.BackupFailed, verification.Phase)
+		assert.Equal(t, "the check orders doesn't hold", verification.Message)
+		assert.Equal(t, "my-rs-20260111T030000Z.archive.gz", verification.Archive)
+		assert.True(t, now.Equal(verification.LastSuccessfulTime.Time), "the last successful time is kept")
+	})
+
+	t.Run("The message of a failed init container is reported", func(t *testing.T) {
+		job := schedule(time.Date(2026, 1, 18, 6, 0, 0, 0, time.UTC))
+		job.Status = failed
+		assert.NoError(t, c.Update(context.TODO(), &job))
+		pod := succeededJobPod(job.Name, "")
+		pod.Status.Phase = corev1.PodFailed
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+			{Name: "download", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Message: "There is no scheduled backup in s3://backups/my-rs/\n"}}},
+		}
+		r.client = jobPodsClient{Client: r.client, pods: []corev1.Pod{pod}}
+		assert.NoError(t, r.updateBackupStatus(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, "There is no scheduled backup in s3://backups/my-rs/", mdb.Status.Backup.LastVerification.Message)
+	})
+}
+
+func TestValidateBackup_Verification(t *testing.T) {
+	mdb := withBackupVerification(newBackupReplicaSet())
+	assert.NoError(t, validateBackup(mdb))
+
+	mdb.Spec.Backup.Verification.Schedule = "weekly"
+	assert.Error(t, validateBackup(mdb))
+
+	mdb = withBackupVerification(newBackupReplicaSet())
+	mdb.Spec.Backup.Verification.Checks[0].Expression = ""
+	assert.EqualError(t, validateBackup(mdb), "the name, the database and the expression of the checks of verification must be set")
+
+	mdb = newSnapshotBackupReplicaSet()
+	mdb.Spec.Backup.Verification = &mdbv1.BackupVerification{Schedule: "0 6 * * 0"}
+	assert.EqualError(t, validateBackup(mdb), "verification requires the mongodump method")
+}
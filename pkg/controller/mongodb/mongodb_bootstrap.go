@@ -0,0 +1,252 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	bootstrapEventReason       = "Bootstrap"
+	bootstrapFailedEventReason = "BootstrapFailed"
+
+	// the images used to download the archive, depending on the scheme of its URL
+	awsCLIImage = "amazon/aws-cli:2.0.50"
+	curlImage   = "curlimages/curl:7.72.0"
+
+	bootstrapArchivePath = "/archive/archive.gz"
+	// mongoToolCAPath is where the CA certificate is mounted in the containers running the MongoDB tools
+	mongoToolCAPath = "/tls"
+	// bootstrapBackoffLimit is the number of times the restore is retried before it is considered failed
+	bootstrapBackoffLimit = 2
+)
+
+// validateBootstrap ensures the archive of spec.bootstrap can be downloaded
+func validateBootstrap(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.Bootstrap == nil {
+		return nil
+	}
+	return validateArchiveURL(mdb.Spec.Bootstrap.ArchiveURL)
+}
+
+// validateArchiveURL ensures the archive can be downloaded by downloadArchiveContainer
+func validateArchiveURL(rawURL string) error {
+	archiveURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid archive URL: %s", err)
+	}
+	switch archiveURL.Scheme {
+	case "s3", "http", "https":
+		return nil
+	default:
+		return fmt.Errorf("the archive URL must be an s3://, http:// or https:// URL")
+	}
+}
+
+// initBootstrapStatus marks the restore of spec.bootstrap as pending when the deployment is created.
+// spec.bootstrap is ignored when it is added to an existing deployment, so that no data is loaded
+// into a replica set already in use.
+func (r *ReplicaSetReconciler) initBootstrapStatus(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.Bootstrap == nil || mdb.Status.Bootstrap != nil {
+		return nil
+	}
+	if _, err := r.client.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}); err == nil {
+		r.log.Warn("spec.bootstrap is ignored as the deployment already exists")
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting automation config: %s", err)
+	}
+	return r.updateBootstrapStatus(mdb, &mdbv1.BootstrapStatus{Phase: mdbv1.BootstrapPending})
+}
+
+// bootstrapStep restores the archive of spec.bootstrap with a Job once the replica set is ready.
+// It returns true once the restore is completed or has failed, or if there is nothing to restore.
+// A failed restore is reported in the status and with a Warning event, and isn't retried.
+func (r *ReplicaSetReconciler) bootstrapStep(mdb mdbv1.MongoDB) (bool, error) {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return false, fmt.Errorf("error getting resource: %s", err)
+	}
+	status := newMdb.Status.Bootstrap
+	if mdb.Spec.Bootstrap == nil || status == nil || status.Phase == mdbv1.BootstrapCompleted || status.Phase == mdbv1.BootstrapFailed {
+		return true, nil
+	}
+
+	job := batchv1.Job{}
+	err = r.client.Get(context.TODO(), bootstrapJobNamespacedName(mdb), &job)
+	if errors.IsNotFound(err) {
+		job = buildBootstrapJob(mdb)
+		if err := r.client.Create(context.TODO(), &job); err != nil {
+			return false, fmt.Errorf("error creating bootstrap job: %s", err)
+		}
+		r.log.Infof("Restoring %s", mdb.Spec.Bootstrap.ArchiveURL)
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, bootstrapEventReason, "Restoring %s with Job %s", mdb.Spec.Bootstrap.ArchiveURL, job.Name)
+		}
+		return false, r.updateBootstrapStatus(mdb, &mdbv1.BootstrapStatus{Phase: mdbv1.BootstrapRunning})
+	}
+	if err != nil {
+		return false, fmt.Errorf("error getting bootstrap job: %s", err)
+	}
+
+	if job.Status.Succeeded > 0 {
+		r.log.Infof("Restored %s", mdb.Spec.Bootstrap.ArchiveURL)
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, bootstrapEventReason, "Restored %s", mdb.Spec.Bootstrap.ArchiveURL)
+		}
+		return true, r.updateBootstrapStatus(mdb, &mdbv1.BootstrapStatus{Phase: mdbv1.BootstrapCompleted})
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			message := fmt.Sprintf("Job %s failed: %s", job.Name, condition.Message)
+			r.log.Warnf("Error restoring %s: %s", mdb.Spec.Bootstrap.ArchiveURL, message)
+			if r.recorder != nil {
+				r.recorder.Event(&mdb, corev1.EventTypeWarning, bootstrapFailedEventReason, message)
+			}
+			return true, r.updateBootstrapStatus(mdb, &mdbv1.BootstrapStatus{Phase: mdbv1.BootstrapFailed, Message: message})
+		}
+	}
+	if status.Phase != mdbv1.BootstrapRunning {
+		return false, r.updateBootstrapStatus(mdb, &mdbv1.BootstrapStatus{Phase: mdbv1.BootstrapRunning})
+	}
+	return false, nil
+}
+
+func bootstrapJobNamespacedName(mdb mdbv1.MongoDB) types.NamespacedName {
+	return types.NamespacedName{Name: mdb.Name + "-bootstrap", Namespace: mdb.Namespace}
+}
+
+// buildBootstrapJob returns the Job downloading the archive of spec.bootstrap with an init container
+// and restoring it with mongorestore. The agent user is used when authentication is enabled.
+func buildBootstrapJob(mdb mdbv1.MongoDB) batchv1.Job {
+	archiveVolume := statefulset.CreateVolumeFromEmptyDir("archive")
+	archiveVolumeMount := statefulset.CreateVolumeMount(archiveVolume.Name, "/archive", statefulset.WithReadOnly(false))
+
+	uri, connectionOptions, connection := mongoToolConnection(mdb, "restore")
+	backoffLimit := int32(bootstrapBackoffLimit)
+	labels := map[string]string{"app": mdb.Name + "-bootstrap"}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		podtemplatespec.WithVolume(archiveVolume),
+		podtemplatespec.WithInitContainer("download", downloadArchiveContainer(*mdb.Spec.Bootstrap, archiveVolumeMount)),
+		podtemplatespec.WithContainer("restore", container.Apply(
+			container.WithName("restore"),
+			container.WithImage(fmt.Sprintf("mongo:%s", mdb.Spec.Version)),
+			container.WithCommand([]string{"/bin/sh", "-c", fmt.Sprintf(`exec mongorestore --uri "%s"%s --archive=%s --gzip`, uri, connectionOptions, bootstrapArchivePath)}),
+			container.WithVolumeMounts([]corev1.VolumeMount{archiveVolumeMount}),
+		)),
+		connection,
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            bootstrapJobNamespacedName(mdb).Name,
+			Namespace:       mdb.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}
+}
+
+// downloadArchiveContainer returns the container downloading the archive to the archive volume, with
+// the keys of the credentials Secret as environment variables.
+func downloadArchiveContainer(bootstrap mdbv1.Bootstrap, archiveVolumeMount corev1.VolumeMount) container.Modification {
+	image := curlImage
+	command := fmt.Sprintf(`exec curl --fail --silent --show-error --location ${username:+--user "$username:$password"} --output %s "%s"`, bootstrapArchivePath, bootstrap.ArchiveURL)
+	// the URL has been validated before building the Job
+	if archiveURL, _ := url.Parse(bootstrap.ArchiveURL); archiveURL.Scheme == "s3" {
+		image = awsCLIImage
+		command = fmt.Sprintf(`exec aws s3 cp "%s" %s`, bootstrap.ArchiveURL, bootstrapArchivePath)
+	}
+
+	credentials := container.NOOP()
+	if bootstrap.CredentialsSecretName != "" {
+		credentials = container.WithEnvFrom(corev1.EnvFromSource{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: bootstrap.CredentialsSecretName}},
+		})
+	}
+	return container.Apply(
+		container.WithName("download"),
+		container.WithImage(image),
+		container.WithCommand([]string{"/bin/sh", "-c", command}),
+		container.WithVolumeMounts([]corev1.VolumeMount{archiveVolumeMount}),
+		credentials,
+	)
+}
+
+// mongoToolConnection returns the connection string of the replica set and the options used by
+// the MongoDB tools run in the container to connect to it, with the modification providing them
+// the agent password when authentication is enabled, and the CA certificate when TLS is enabled,
+// written by the Vault Agent injector if the certificates are read from Vault.
+func mongoToolConnection(mdb mdbv1.MongoDB, containerName string) (string, string, podtemplatespec.Modification) {
+	uri := fmt.Sprintf("%s/?replicaSet=%s", mdb.MongoURI(), mdb.Name)
+	options := ""
+	var modifications []podtemplatespec.Modification
+	if mdb.Spec.Security.Authentication.Enabled {
+		options += fmt.Sprintf(` --username %s --password "$AGENT_PASSWORD" --authenticationDatabase admin`, scram.AgentName)
+		modifications = append(modifications, podtemplatespec.WithContainer(containerName, container.WithEnvs(corev1.EnvVar{
+			Name: "AGENT_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: mdb.ScramCredentialsNamespacedName().Name},
+					Key:                  scram.AgentPasswordKey,
+				},
+			},
+		})))
+	}
+	if usesVaultTLS(mdb) {
+		options += fmt.Sprintf(" --ssl --sslCAFile %s", mongoToolCAFile(mdb))
+		modifications = append(modifications, podtemplatespec.WithAdditionalAnnotations(vaultAgentAnnotations(mdb, mdb.Spec.Security.TLS.VaultSecretPath, true, map[string][]string{
+			tlsCACertName: {tlsCACertName},
+		})))
+	} else if mdb.Spec.Security.TLS.Enabled {
+		caVolume := statefulset.CreateVolumeFromConfigMap("tls-ca", mdb.TLSConfigMapNamespacedName().Name)
+		options += fmt.Sprintf(" --ssl --sslCAFile %s", mongoToolCAFile(mdb))
+		modifications = append(modifications,
+			podtemplatespec.WithVolume(caVolume),
+			podtemplatespec.WithVolumeMounts(containerName, statefulset.CreateVolumeMount(caVolume.Name, mongoToolCAPath, statefulset.WithReadOnly(true))),
+		)
+	}
+	return uri, options, podtemplatespec.Apply(modifications...)
+}
+
+// mongoToolCAFile returns the path of the CA certificate in the containers of mongoToolConnection
+func mongoToolCAFile(mdb mdbv1.MongoDB) string {
+	if usesVaultTLS(mdb) {
+		return vaultSecretsPath + tlsCACertName
+	}
+	return fmt.Sprintf("%s/%s", mongoToolCAPath, tlsCACertName)
+}
+
+func (r *ReplicaSetReconciler) updateBootstrapStatus(mdb mdbv1.MongoDB, status *mdbv1.BootstrapStatus) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if reflect.DeepEqual(newMdb.Status.Bootstrap, status) {
+		return nil
+	}
+	newMdb.Status.Bootstrap = status
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newBootstrappedReplicaSet(archiveURL string) mdbv1.MongoDB {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Bootstrap = &mdbv1.Bootstrap{ArchiveURL: archiveURL, CredentialsSecretName: "archive-credentials"}
+	return mdb
+}
+
+func getBootstrapStatus(t *testing.T, c client.Client, mdb mdbv1.MongoDB) *mdbv1.BootstrapStatus {
+	assert.NoError(t, c.Get(context.TODO(), mdb.NamespacedName(), &mdb))
+	return mdb.Status.Bootstrap
+}
+
+func TestBootstrap(t *testing.T) {
+	mdb := newBootstrappedReplicaSet("s3://datasets/reference.archive.gz")
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assert.Equal(t, mdbv1.BootstrapRunning, getBootstrapStatus(t, mgrClient, mdb).Phase)
+
+	job := batchv1.Job{}
+	assert.NoError(t, mgrClient.Get(context.TODO(), bootstrapJobNamespacedName(mdb), &job))
+	assert.Len(t, job.OwnerReferences, 1)
+	download := job.Spec.Template.Spec.InitContainers[0]
+	assert.Equal(t, awsCLIImage, download.Image)
+	assert.Equal(t, "archive-credentials", download.EnvFrom[0].SecretRef.Name)
+	assert.Contains(t, download.Command[2], `aws s3 cp "s3://datasets/reference.archive.gz" /archive/archive.gz`)
+	restore := job.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "mongo:4.2.2", restore.Image)
+	assert.Contains(t, restore.Command[2], "mongorestore --uri \"mongodb://my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017,")
+	assert.NotContains(t, restore.Command[2], "--username")
+
+	// the restore is still running
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+
+	job.Status.Succeeded = 1
+	assert.NoError(t, mgrClient.Update(context.TODO(), &job))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Equal(t, mdbv1.BootstrapCompleted, getBootstrapStatus(t, mgrClient, mdb).Phase)
+}
+
+func TestBootstrap_Failed(t *testing.T) {
+	mdb := newBootstrappedReplicaSet("https://example.com/reference.archive.gz")
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	job := batchv1.Job{}
+	assert.NoError(t, mgrClient.Get(context.TODO(), bootstrapJobNamespacedName(mdb), &job))
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}
+	assert.NoError(t, mgrClient.Update(context.TODO(), &job))
+
+	// the deployment is usable without the dataset
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	status := getBootstrapStatus(t, mgrClient, mdb)
+	assert.Equal(t, mdbv1.BootstrapFailed, status.Phase)
+	assert.Equal(t, "Job my-rs-bootstrap failed: Job has reached the specified backoff limit", status.Message)
+}
+
+func TestBootstrap_IsIgnoredOnExistingDeployment(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	assert.NoError(t, mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb))
+	mdb.Spec.Bootstrap = &mdbv1.Bootstrap{ArchiveURL: "https://example.com/reference.archive.gz"}
+	assert.NoError(t, mgrClient.Update(context.TODO(), &mdb))
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Nil(t, getBootstrapStatus(t, mgrClient, mdb))
+	assert.Error(t, mgrClient.Get(context.TODO(), bootstrapJobNamespacedName(mdb), &batchv1.Job{}))
+}
+
+func TestBuildBootstrapJob(t *testing.T) {
+	mdb := newBootstrappedReplicaSet("https://example.com/reference.archive.gz")
+	mdb.Spec.Security.Authentication.Enabled = true
+	mdb.Spec.Security.TLS.Enabled = true
+
+	job := buildBootstrapJob(mdb)
+	assert.Equal(t, corev1.RestartPolicyNever, job.Spec.Template.Spec.RestartPolicy)
+	download := job.Spec.Template.Spec.InitContainers[0]
+	assert.Equal(t, curlImage, download.Image)
+	assert.Contains(t, download.Command[2], `--output /archive/archive.gz "https://example.com/reference.archive.gz"`)
+
+	restore := job.Spec.Template.Spec.Containers[0]
+	assert.Contains(t, restore.Command[2], `--username mms-automation --password "$AGENT_PASSWORD" --authenticationDatabase admin`)
+	assert.Contains(t, restore.Command[2], "--ssl --sslCAFile /tls/ca.crt")
+	assert.Equal(t, "AGENT_PASSWORD", restore.Env[0].Name)
+	assert.Equal(t, mdb.ScramCredentialsNamespacedName().Name, restore.Env[0].ValueFrom.SecretKeyRef.Name)
+	assert.Len(t, restore.VolumeMounts, 2)
+	assert.Len(t, job.Spec.Template.Spec.Volumes, 2)
+}
+
+func TestValidateBootstrap(t *testing.T) {
+	assert.NoError(t, validateBootstrap(testutils.NewTestReplicaSet()))
+	assert.NoError(t, validateBootstrap(newBootstrappedReplicaSet("s3://datasets/reference.archive.gz")))
+	assert.NoError(t, validateBootstrap(newBootstrappedReplicaSet("http://example.com/reference.archive.gz")))
+	assert.Error(t, validateBootstrap(newBootstrappedReplicaSet("ftp://example.com/reference.archive.gz")))
+	assert.Error(t, validateBootstrap(newBootstrappedReplicaSet("/reference.archive.gz")))
+}
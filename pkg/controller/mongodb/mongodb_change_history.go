@@ -0,0 +1,108 @@
+package mongodb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// lastAppliedSpecKey is the key of the change history ConfigMap holding the last spec applied
+	lastAppliedSpecKey = "lastAppliedSpec"
+	// changeHistoryKey is the key of the change history ConfigMap holding the applied changes
+	changeHistoryKey = "history"
+	// maxAppliedChanges is the number of applied changes kept in the history, the oldest are dropped
+	maxAppliedChanges = 20
+	// initialSpecChange is the change recorded the first time the spec of a resource is applied
+	initialSpecChange = "initial spec"
+)
+
+// appliedChange is a change to the spec the operator acted on
+type appliedChange struct {
+	Time       string   `json:"time"`
+	Generation int64    `json:"generation"`
+	Changes    []string `json:"changes"`
+}
+
+// recordAppliedChange records the changes between the last spec applied and the spec of the resource
+// in its change history ConfigMap, along with the generation of the resource and the time they are
+// applied at. The changes deferred to the next maintenance window are recorded once they are applied.
+// Only the last maxAppliedChanges changes are kept.
+func (r *ReplicaSetReconciler) recordAppliedChange(mdb mdbv1.MongoDB) error {
+	nsName := types.NamespacedName{Name: mdb.ChangeHistoryConfigMapName(), Namespace: mdb.Namespace}
+	data, err := configmap.ReadData(r.client, nsName)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error reading change history: %s", err)
+	}
+
+	var history []appliedChange
+	if historyJSON, ok := data[changeHistoryKey]; ok {
+		if err := json.Unmarshal([]byte(historyJSON), &history); err != nil {
+			return fmt.Errorf("error reading change history: %s", err)
+		}
+	}
+	changes := []string{initialSpecChange}
+	if previousJSON, ok := data[lastAppliedSpecKey]; ok {
+		previous := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(previousJSON), &previous); err != nil {
+			return fmt.Errorf("error reading last applied spec: %s", err)
+		}
+		if changes, err = specChanges(previous, mdb.Spec); err != nil {
+			return err
+		}
+		// the spec may have been changed back before the previous change was applied
+		if len(changes) == 0 {
+			return nil
+		}
+	}
+
+	history = append(history, appliedChange{
+		Time:       r.now().UTC().Format(time.RFC3339),
+		Generation: mdb.Generation,
+		Changes:    changes,
+	})
+	if len(history) > maxAppliedChanges {
+		history = history[len(history)-maxAppliedChanges:]
+	}
+
+	specJSON, err := json.Marshal(mdb.Spec)
+	if err != nil {
+		return err
+	}
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	cm := configmap.Builder().
+		SetName(nsName.Name).
+		SetNamespace(nsName.Namespace).
+		SetField(lastAppliedSpecKey, string(specJSON)).
+		SetField(changeHistoryKey, string(historyJSON)).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
+		Build()
+	if err := configmap.CreateOrUpdate(r.client, cm); err != nil {
+		return fmt.Errorf("error writing change history: %s", err)
+	}
+	r.log.Infof("Recorded the changes applied at generation %d: %v", mdb.Generation, changes)
+	return nil
+}
+
+// specChanges returns the changed fields between the previous spec, decoded from JSON, and the spec
+func specChanges(previous map[string]interface{}, spec mdbv1.MongoDBSpec) ([]string, error) {
+	current, err := diff.ToTree(spec)
+	if err != nil {
+		return nil, err
+	}
+	var changes []string
+	for _, change := range diff.Trees(previous, current, nil) {
+		changes = append(changes, change.String())
+	}
+	return changes, nil
+}
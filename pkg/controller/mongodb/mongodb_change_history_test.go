@@ -0,0 +1,82 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func readChangeHistory(t *testing.T, c client.Client, nsName types.NamespacedName) []appliedChange {
+	historyJSON, err := configmap.ReadKey(c, changeHistoryKey, nsName)
+	assert.NoError(t, err)
+	var history []appliedChange
+	assert.NoError(t, json.Unmarshal([]byte(historyJSON), &history))
+	return history
+}
+
+func TestRecordAppliedChange(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Generation = 1
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.now = func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC) }
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	nsName := types.NamespacedName{Name: mdb.ChangeHistoryConfigMapName(), Namespace: mdb.Namespace}
+	assert.Equal(t, []appliedChange{{Time: "2026-01-01T12:00:00Z", Generation: 1, Changes: []string{initialSpecChange}}}, readChangeHistory(t, c, nsName))
+	cm, err := c.GetConfigMap(nsName)
+	assert.NoError(t, err)
+	assert.Equal(t, mdb.Name, cm.OwnerReferences[0].Name)
+
+	t.Run("An unchanged spec isn't recorded again", func(t *testing.T) {
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+		assert.Len(t, readChangeHistory(t, c, nsName), 1)
+	})
+
+	t.Run("The changed fields are recorded", func(t *testing.T) {
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		mdb.Generation = 2
+		mdb.Spec.RepairDrift = true
+		mdb.Spec.FeatureCompatibilityVersion = "4.0"
+		assert.NoError(t, c.Update(context.TODO(), &mdb))
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+
+		history := readChangeHistory(t, c, nsName)
+		assert.Len(t, history, 2)
+		assert.Equal(t, appliedChange{
+			Time:       "2026-01-01T12:00:00Z",
+			Generation: 2,
+			Changes:    []string{"featureCompatibilityVersion: <none> -> 4.0", "repairDrift: <none> -> true"},
+		}, history[1])
+	})
+}
+
+func TestRecordAppliedChange_KeepsTheLastChanges(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	for i := 1; i <= maxAppliedChanges+5; i++ {
+		mdb.Generation = int64(i)
+		mdb.Spec.Members = i
+		assert.NoError(t, r.recordAppliedChange(mdb))
+	}
+
+	history := readChangeHistory(t, c, types.NamespacedName{Name: mdb.ChangeHistoryConfigMapName(), Namespace: mdb.Namespace})
+	assert.Len(t, history, maxAppliedChanges)
+	assert.Equal(t, int64(6), history[0].Generation)
+	assert.Equal(t, []string{"members: 24 -> 25"}, history[len(history)-1].Changes)
+}
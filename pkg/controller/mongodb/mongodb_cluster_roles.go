@@ -0,0 +1,114 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// readClusterRoles returns the ClusterMongoDBRoles referenced by spec.security.roleRefs, or a terminal
+// error if one of them doesn't exist or two of them define the same role. The ClusterMongoDBRoles are
+// watched, so that the resource is reconciled again once they are fixed.
+func (r ReplicaSetReconciler) readClusterRoles(mdb mdbv1.MongoDB) ([]mdbv1.ClusterMongoDBRole, error) {
+	roles := make([]mdbv1.ClusterMongoDBRole, len(mdb.Spec.Security.RoleRefs))
+	definedBy := map[string]string{}
+	for i, ref := range mdb.Spec.Security.RoleRefs {
+		nsName := types.NamespacedName{Name: ref.Name}
+		if err := r.client.Get(context.TODO(), nsName, &roles[i]); err != nil {
+			if errors.IsNotFound(err) {
+				return nil, referencedResourceNotFound("ClusterMongoDBRole", nsName, fmt.Sprintf("spec.security.roleRefs[%d]", i))
+			}
+			return nil, fmt.Errorf("error reading ClusterMongoDBRole %s: %s", ref.Name, err)
+		}
+		name := roles[i].RoleName()
+		if other, ok := definedBy[name]; ok {
+			return nil, invalidSpec(fmt.Errorf("the ClusterMongoDBRoles %s and %s both define the role %s", other, ref.Name, name))
+		}
+		definedBy[name] = ref.Name
+	}
+	return roles, nil
+}
+
+// checkClusterRoles returns a terminal error if the ClusterMongoDBRoles referenced by the resource can't
+// be created
+func (r *ReplicaSetReconciler) checkClusterRoles(mdb mdbv1.MongoDB) error {
+	_, err := r.readClusterRoles(mdb)
+	return err
+}
+
+// getClusterRolesModification returns a modification which adds the ClusterMongoDBRoles referenced by
+// the resource to the custom roles of the automation config, replacing the roles of the same name.
+// The roles which are no longer referenced aren't kept, as the roles are built from the spec.
+func (r ReplicaSetReconciler) getClusterRolesModification(mdb mdbv1.MongoDB) (automationconfig.Modification, error) {
+	if len(mdb.Spec.Security.RoleRefs) == 0 {
+		return automationconfig.NOOP(), nil
+	}
+	clusterRoles, err := r.readClusterRoles(mdb)
+	if err != nil {
+		return automationconfig.NOOP(), err
+	}
+	return func(ac *automationconfig.AutomationConfig) {
+		for _, clusterRole := range clusterRoles {
+			role := buildCustomRole(clusterRole)
+			roles := []automationconfig.CustomRole{role}
+			for _, existing := range ac.Roles {
+				if existing.Role != role.Role || existing.Database != role.Database {
+					roles = append(roles, existing)
+				}
+			}
+			ac.Roles = roles
+		}
+	}, nil
+}
+
+// buildCustomRole returns the custom role of the admin database defined by the ClusterMongoDBRole
+func buildCustomRole(clusterRole mdbv1.ClusterMongoDBRole) automationconfig.CustomRole {
+	role := automationconfig.CustomRole{
+		Role:       clusterRole.RoleName(),
+		Database:   "admin",
+		Privileges: []automationconfig.Privilege{},
+		Roles:      []automationconfig.Role{},
+	}
+	for _, privilege := range clusterRole.Spec.Privileges {
+		role.Privileges = append(role.Privileges, automationconfig.Privilege{
+			Resource: automationconfig.Resource{
+				Database:   privilege.Resource.DB,
+				Collection: privilege.Resource.Collection,
+				Cluster:    privilege.Resource.Cluster,
+			},
+			Actions: privilege.Actions,
+		})
+	}
+	for _, inherited := range clusterRole.Spec.Roles {
+		role.Roles = append(role.Roles, automationconfig.Role{Role: inherited.Name, Database: inherited.DB})
+	}
+	return role
+}
+
+// resourcesReferencingClusterRole maps a ClusterMongoDBRole to the requests to reconcile the MongoDB
+// resources of all the namespaces which reference it from spec.security.roleRefs
+func (r *ReplicaSetReconciler) resourcesReferencingClusterRole(role handler.MapObject) []reconcile.Request {
+	mdbList, err := listSelectedResources(r.client, r.selector)
+	if err != nil {
+		zap.S().Warnf("Error listing MongoDB resources: %s", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, mdb := range mdbList.Items {
+		for _, ref := range mdb.Spec.Security.RoleRefs {
+			if ref.Name == role.Meta.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: mdb.NamespacedName()})
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,82 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newClusterRole(name string) mdbv1.ClusterMongoDBRole {
+	all := ""
+	return mdbv1.ClusterMongoDBRole{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: mdbv1.ClusterMongoDBRoleSpec{
+			Privileges: []mdbv1.Privilege{
+				{Resource: mdbv1.PrivilegeResource{DB: &all, Collection: &all}, Actions: []string{"find"}},
+				{Resource: mdbv1.PrivilegeResource{Cluster: true}, Actions: []string{"serverStatus"}},
+			},
+			Roles: []mdbv1.Role{{Name: "read", DB: "reporting"}},
+		},
+	}
+}
+
+func TestBuildCustomRole(t *testing.T) {
+	all := ""
+	assert.Equal(t, automationconfig.CustomRole{
+		Role:     "app-reader",
+		Database: "admin",
+		Privileges: []automationconfig.Privilege{
+			{Resource: automationconfig.Resource{Database: &all, Collection: &all}, Actions: []string{"find"}},
+			{Resource: automationconfig.Resource{Cluster: true}, Actions: []string{"serverStatus"}},
+		},
+		Roles: []automationconfig.Role{{Role: "read", Database: "reporting"}},
+	}, buildCustomRole(newClusterRole("app-reader")))
+
+	role := newClusterRole("app-reader")
+	role.Spec.Role = "reader"
+	assert.Equal(t, "reader", buildCustomRole(role).Role)
+}
+
+func TestGetClusterRolesModification(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.Security.RoleRefs = []mdbv1.LocalObjectReference{{Name: "app-reader"}, {Name: "app-writer"}}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	err := r.checkClusterRoles(mdb)
+	assert.EqualError(t, err, `ClusterMongoDBRole "app-reader" referenced by spec.security.roleRefs[0] not found`)
+	terminal := err.(terminalError)
+	assert.Equal(t, "ClusterMongoDBRoleNotFound", referencedResourcesFoundCondition(&terminal).Reason)
+
+	reader, writer := newClusterRole("app-reader"), newClusterRole("app-writer")
+	assert.NoError(t, mgr.Client.Create(context.TODO(), &reader))
+	assert.NoError(t, mgr.Client.Create(context.TODO(), &writer))
+	assert.NoError(t, r.checkClusterRoles(mdb))
+
+	modification, err := r.getClusterRolesModification(mdb)
+	assert.NoError(t, err)
+	ac := automationconfig.AutomationConfig{Roles: []automationconfig.CustomRole{{Role: "app-reader", Database: "admin"}, {Role: pbmAnyActionRole, Database: "admin"}}}
+	modification(&ac)
+	var names []string
+	for _, role := range ac.Roles {
+		names = append(names, role.Role)
+	}
+	assert.ElementsMatch(t, []string{"app-reader", "app-writer", pbmAnyActionRole}, names)
+	for _, role := range ac.Roles {
+		if role.Role == "app-reader" {
+			assert.Len(t, role.Privileges, 2, "the role is replaced")
+		}
+	}
+
+	t.Run("Two ClusterMongoDBRoles can't define the same role", func(t *testing.T) {
+		writer.Spec.Role = "app-reader"
+		assert.NoError(t, mgr.Client.Update(context.TODO(), &writer))
+		assert.EqualError(t, r.checkClusterRoles(mdb), "the ClusterMongoDBRoles app-reader and app-writer both define the role app-reader")
+	})
+}
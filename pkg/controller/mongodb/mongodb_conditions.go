@@ -0,0 +1,175 @@
+package mongodb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// the reasons of the Progressing condition, for the changes in progress
+const (
+	resizingReason            = "Resizing"
+	statefulSetNotReadyReason = "StatefulSetNotReady"
+	upgradingVersionReason    = "UpgradingVersion"
+	restartingReason          = "Restarting"
+	scalingReason             = "Scaling"
+	bootstrappingReason       = "Bootstrapping"
+	runningInitScriptsReason  = "RunningInitScripts"
+	expandingVolumesReason    = "ExpandingVolumes"
+)
+
+// the reasons of the standard conditions, other than the changes in progress and the failures
+const (
+	reconciledReason           = "Reconciled"
+	pausedReason               = "Paused"
+	reconciliationErrorReason  = "ReconciliationError"
+	healthyReason              = "Healthy"
+	tlsRolloutInProgressReason = "TLSRolloutInProgress"
+	tlsEnabledReason           = "TLSEnabled"
+	agentsNotInGoalStateReason = "AgentsNotInGoalState"
+	usersConfiguredReason      = "UsersConfigured"
+)
+
+// reconcileProgress is a change of the resource being applied to the deployment
+type reconcileProgress struct {
+	reason  string
+	message string
+}
+
+// requeueInProgress records the change in progress for the Progressing condition, and requeues the
+// resource to continue it in 10 seconds, or later if it was already waiting for the same thing
+func (r *ReplicaSetReconciler) requeueInProgress(reason, messageFmt string, args ...interface{}) (reconcile.Result, error) {
+	message := fmt.Sprintf(messageFmt, args...)
+	requeueAfter := r.requeueBackoff.next(r.nsName, message)
+	r.log.Infof("%s, retrying in %s", message, requeueAfter.Round(time.Second))
+	r.progress = &reconcileProgress{reason: reason, message: message}
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// setStandardConditions sets the Ready, Progressing, Degraded, TLSReady and UsersReady conditions
+// of the resource from the outcome of the reconciliation, following the Kubernetes conventions, so
+// that tools can tell the health of the resource.
+func (r *ReplicaSetReconciler) setStandardConditions(mdb *mdbv1.MongoDB, reconcileErr error) error {
+	conditions := r.standardConditions(*mdb, reconcileErr)
+	tlsReady, err := r.tlsReadyCondition(*mdb)
+	if err != nil {
+		return err
+	}
+	if tlsReady != nil {
+		conditions = append(conditions, *tlsReady)
+	}
+	for _, condition := range conditions {
+		mdb.SetCondition(condition)
+	}
+	if !mdb.Spec.Security.TLS.Enabled {
+		mdb.RemoveCondition(mdbv1.TLSReady)
+	}
+	return nil
+}
+
+// standardConditions returns the Ready, Progressing, Degraded and UsersReady conditions of the resource.
+// The conditions which can't be told from the outcome of the reconciliation, such as whether the
+// deployment is ready while the reconciliation is retried after an error, are omitted.
+func (r *ReplicaSetReconciler) standardConditions(mdb mdbv1.MongoDB, reconcileErr error) []mdbv1.Condition {
+	conditions := []mdbv1.Condition{usersReadyCondition(mdb)}
+
+	switch failure := failureCondition(mdb); {
+	case mdb.Spec.Paused:
+		return append(conditions, newCondition(mdbv1.Progressing, corev1.ConditionFalse, pausedReason, "reconciliation is paused"))
+	case reconcileErr != nil && isBackedOff(r.consecutiveFailures):
+		return append(conditions, newCondition(mdbv1.Degraded, corev1.ConditionTrue, repeatedFailuresReason, r.backedOffMessage(reconcileErr)))
+	case reconcileErr != nil:
+		return append(conditions, newCondition(mdbv1.Degraded, corev1.ConditionTrue, reconciliationErrorReason, reconcileErr.Error()))
+	case failure != nil:
+		return append(conditions,
+			newCondition(mdbv1.Ready, corev1.ConditionFalse, failure.Reason, failure.Message),
+			newCondition(mdbv1.Progressing, corev1.ConditionFalse, failure.Reason, failure.Message),
+			newCondition(mdbv1.Degraded, corev1.ConditionTrue, failure.Reason, failure.Message),
+		)
+	}
+
+	conditions = append(conditions, degradedCondition(mdb))
+	if r.isReady {
+		conditions = append(conditions, newCondition(mdbv1.Ready, corev1.ConditionTrue, reconciledReason, ""))
+	} else if r.progress != nil {
+		conditions = append(conditions, newCondition(mdbv1.Ready, corev1.ConditionFalse, r.progress.reason, r.progress.message))
+	}
+	if r.progress != nil {
+		conditions = append(conditions, newCondition(mdbv1.Progressing, corev1.ConditionTrue, r.progress.reason, r.progress.message))
+	} else if r.isReady {
+		conditions = append(conditions, newCondition(mdbv1.Progressing, corev1.ConditionFalse, reconciledReason, ""))
+	}
+	return conditions
+}
+
+// failureCondition returns the condition which set the resource to the Failed phase, if any
+func failureCondition(mdb mdbv1.MongoDB) *mdbv1.Condition {
+	if mdb.Status.Phase != mdbv1.Failed {
+		return nil
+	}
+	for _, conditionType := range []mdbv1.ConditionType{mdbv1.ConfigurationValid, mdbv1.VersionChangeAllowed} {
+		if condition := mdb.GetCondition(conditionType); condition != nil && condition.Status == corev1.ConditionFalse {
+			return condition
+		}
+	}
+	return nil
+}
+
+// degradedCondition returns the Degraded condition of a resource which can be reconciled, which is
+// true if the volumes of some members can't be provisioned or are almost full, or if some members have
+// been lagging behind the primary.
+func degradedCondition(mdb mdbv1.MongoDB) mdbv1.Condition {
+	for _, conditionType := range []mdbv1.ConditionType{mdbv1.VolumesProvisioned, mdbv1.DataVolumeUsageBelowThreshold, mdbv1.ReplicationLagBelowThreshold} {
+		if condition := mdb.GetCondition(conditionType); condition != nil && condition.Status == corev1.ConditionFalse {
+			return newCondition(mdbv1.Degraded, corev1.ConditionTrue, condition.Reason, condition.Message)
+		}
+	}
+	return newCondition(mdbv1.Degraded, corev1.ConditionFalse, healthyReason, "")
+}
+
+// usersReadyCondition returns the UsersReady condition, which is true once the agents of all the
+// members reached goal state for the current automation config, which holds the users of the resource
+func usersReadyCondition(mdb mdbv1.MongoDB) mdbv1.Condition {
+	var pending []string
+	for _, member := range mdb.Status.Members {
+		if member.LastVersionAchieved < int64(member.GoalVersion) {
+			pending = append(pending, member.Name)
+		}
+	}
+	if len(mdb.Status.Members) == 0 {
+		return newCondition(mdbv1.UsersReady, corev1.ConditionFalse, agentsNotInGoalStateReason, "no member is running yet")
+	}
+	if len(pending) > 0 {
+		return newCondition(mdbv1.UsersReady, corev1.ConditionFalse, agentsNotInGoalStateReason,
+			fmt.Sprintf("the agents of the members %s haven't applied the current automation config yet", strings.Join(pending, ", ")))
+	}
+	return newCondition(mdbv1.UsersReady, corev1.ConditionTrue, usersConfiguredReason, fmt.Sprintf("%d users are configured", len(mdb.Spec.Users)))
+}
+
+// tlsReadyCondition returns the TLSReady condition, or nil if TLS isn't enabled
+func (r *ReplicaSetReconciler) tlsReadyCondition(mdb mdbv1.MongoDB) (*mdbv1.Condition, error) {
+	if !mdb.Spec.Security.TLS.Enabled {
+		return nil, nil
+	}
+	var condition mdbv1.Condition
+	err := r.checkTLSPrerequisites(mdb)
+	switch terminal, ok := err.(terminalError); {
+	case ok:
+		condition = newCondition(mdbv1.TLSReady, corev1.ConditionFalse, terminal.reason, terminal.Error())
+	case err != nil:
+		return nil, err
+	case !hasRolledOutTLS(mdb):
+		condition = newCondition(mdbv1.TLSReady, corev1.ConditionFalse, tlsRolloutInProgressReason, "the certificates are being mounted in the members")
+	default:
+		condition = newCondition(mdbv1.TLSReady, corev1.ConditionTrue, tlsEnabledReason, "")
+	}
+	return &condition, nil
+}
+
+func newCondition(conditionType mdbv1.ConditionType, status corev1.ConditionStatus, reason, message string) mdbv1.Condition {
+	return mdbv1.Condition{Type: conditionType, Status: status, Reason: reason, Message: message}
+}
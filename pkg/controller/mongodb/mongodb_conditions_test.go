@@ -0,0 +1,113 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// assertCondition asserts the status and reason of the condition of the resource
+func assertCondition(t *testing.T, mdb mdbv1.MongoDB, conditionType mdbv1.ConditionType, status corev1.ConditionStatus, reason string) {
+	condition := mdb.GetCondition(conditionType)
+	if assert.NotNil(t, condition, "condition %s", conditionType) {
+		assert.Equal(t, status, condition.Status, "condition %s", conditionType)
+		assert.Equal(t, reason, condition.Reason, "condition %s", conditionType)
+		assert.False(t, condition.LastTransitionTime.IsZero(), "condition %s", conditionType)
+	}
+}
+
+func TestStandardConditions_FollowTheReconciliation(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.Ready, corev1.ConditionTrue, reconciledReason)
+	assertCondition(t, mdb, mdbv1.Progressing, corev1.ConditionFalse, reconciledReason)
+	assertCondition(t, mdb, mdbv1.Degraded, corev1.ConditionFalse, healthyReason)
+	assert.Nil(t, mdb.GetCondition(mdbv1.TLSReady), "TLS isn't enabled")
+
+	sts, _ := c.GetStatefulSet(mdb.NamespacedName())
+	sts.Status.ReadyReplicas = 2
+	_ = c.Update(context.TODO(), &sts)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.Ready, corev1.ConditionFalse, statefulSetNotReadyReason)
+	assertCondition(t, mdb, mdbv1.Progressing, corev1.ConditionTrue, statefulSetNotReadyReason)
+	assertCondition(t, mdb, mdbv1.Degraded, corev1.ConditionFalse, healthyReason)
+
+	mdb.Spec.MaintenanceWindow = &mdbv1.MaintenanceWindow{Schedule: "0 2 * * 6"}
+	_ = c.Update(context.TODO(), &mdb)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.Ready, corev1.ConditionFalse, invalidSpecReason)
+	assertCondition(t, mdb, mdbv1.Progressing, corev1.ConditionFalse, invalidSpecReason)
+	assertCondition(t, mdb, mdbv1.Degraded, corev1.ConditionTrue, invalidSpecReason)
+}
+
+func TestStandardConditions_TLSReady(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	_, _ = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.TLSReady, corev1.ConditionFalse, missingPrerequisiteReason)
+
+	assert.NoError(t, createTLSSecretAndConfigMap(mgr.GetClient(), mdb))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.TLSReady, corev1.ConditionTrue, tlsEnabledReason)
+	assertCondition(t, mdb, mdbv1.Ready, corev1.ConditionTrue, reconciledReason)
+
+	mdb.Spec.Security.TLS.Enabled = false
+	_ = c.Update(context.TODO(), &mdb)
+	_, _ = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Nil(t, mdb.GetCondition(mdbv1.TLSReady))
+}
+
+func TestUsersReadyCondition(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	assert.Equal(t, corev1.ConditionFalse, usersReadyCondition(mdb).Status, "no member is running")
+
+	mdb.Status.Members = []mdbv1.MemberStatus{
+		{Name: "my-rs-0", GoalVersion: 2, LastVersionAchieved: 2},
+		{Name: "my-rs-1", GoalVersion: 2, LastVersionAchieved: 1},
+	}
+	condition := usersReadyCondition(mdb)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, agentsNotInGoalStateReason, condition.Reason)
+	assert.Contains(t, condition.Message, "my-rs-1")
+
+	mdb.Status.Members[1].LastVersionAchieved = 2
+	assert.Equal(t, corev1.ConditionTrue, usersReadyCondition(mdb).Status)
+}
+
+func TestDegradedCondition(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	assert.Equal(t, corev1.ConditionFalse, degradedCondition(mdb).Status)
+
+	mdb.SetCondition(mdbv1.Condition{Type: mdbv1.DataVolumeUsageBelowThreshold, Status: corev1.ConditionFalse, Reason: dataVolumeUsageHighReason, Message: "full", LastTransitionTime: metav1.Now()})
+	condition := degradedCondition(mdb)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, dataVolumeUsageHighReason, condition.Reason)
+	assert.Equal(t, "full", condition.Message)
+}
@@ -0,0 +1,108 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/connectionstring"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// connectionStringSecretLabelKey labels the connection string Secrets of the users with the name
+	// of their resource, so that the ones of the removed users are deleted
+	connectionStringSecretLabelKey = "mongodb.com/v1.connectionStringOf"
+	connectionStringStandardKey    = "connectionString.standard"
+	connectionStringSRVKey         = "connectionString.standardSrv"
+	// mongodbPortName is the name of the port of the Service, the drivers look up the members in the
+	// SRV records published for it
+	mongodbPortName = "mongodb"
+)
+
+var invalidSecretNameCharacters = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// connectionStringSecretName returns the name of the Secret holding the connection strings of the
+// user: <resource>-<database>-<username>, with the characters which can't be in a name replaced
+func connectionStringSecretName(mdb mdbv1.MongoDB, user mdbv1.MongoDBUser) string {
+	database := user.DB
+	if database == "" {
+		database = "admin"
+	}
+	name := strings.ToLower(fmt.Sprintf("%s-%s-%s", mdb.Name, database, user.Name))
+	return strings.Trim(invalidSecretNameCharacters.ReplaceAllString(name, "-"), "-.")
+}
+
+// buildConnectionStringSecret returns the Secret holding the credentials of the user and the standard
+// and SRV connection strings authenticating as the user
+func buildConnectionStringSecret(mdb mdbv1.MongoDB, user mdbv1.MongoDBUser, password string) corev1.Secret {
+	credentials := &connectionstring.User{Username: user.Name, Password: password, Database: user.DB}
+	return secret.Builder().
+		SetName(connectionStringSecretName(mdb, user)).
+		SetNamespace(mdb.Namespace).
+		SetLabels(map[string]string{connectionStringSecretLabelKey: mdb.Name}).
+		SetField("username", user.Name).
+		SetField("password", password).
+		SetField(connectionStringStandardKey, connectionstring.Standard(mdb, credentials, connectionstring.Options{})).
+		SetField(connectionStringSRVKey, connectionstring.SRV(mdb, credentials, connectionstring.Options{})).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
+		Build()
+}
+
+// ensureConnectionStringSecrets writes a Secret with the connection strings of each user of
+// spec.users when authentication is enabled, and deletes the ones of the users which were removed.
+// The connection strings point to the Atlas cluster of spec.migration while it holds the data, see
+// migrationPointsToAtlas.
+func (r *ReplicaSetReconciler) ensureConnectionStringSecrets(mdb mdbv1.MongoDB) error {
+	desired := map[string]bool{}
+	if mdb.Spec.Security.Authentication.Enabled {
+		atlasURI := ""
+		if migrationPointsToAtlas(mdb) {
+			uri, err := r.readAtlasConnectionString(mdb)
+			if err != nil {
+				return err
+			}
+			atlasURI = uri
+		}
+		for _, user := range mdb.Spec.Users {
+			password, err := r.readUserPassword(mdb, user)
+			if err != nil {
+				return fmt.Errorf("error reading the password of user %s: %s", user.Name, err)
+			}
+			s := buildConnectionStringSecret(mdb, user, password)
+			if atlasURI != "" {
+				uri, err := atlasConnectionString(atlasURI, user, password)
+				if err != nil {
+					return err
+				}
+				s.Data[connectionStringStandardKey], s.Data[connectionStringSRVKey] = []byte(uri), []byte(uri)
+			}
+			if err := r.client.ApplySecret(s); err != nil {
+				return fmt.Errorf("error writing the connection string Secret %s: %s", s.Name, err)
+			}
+			desired[s.Name] = true
+		}
+	}
+
+	existing := corev1.SecretList{}
+	if err := r.client.List(context.TODO(), &existing, k8sClient.InNamespace(mdb.Namespace), k8sClient.MatchingLabels{connectionStringSecretLabelKey: mdb.Name}); err != nil {
+		return fmt.Errorf("error listing the connection string Secrets: %s", err)
+	}
+	for _, s := range existing.Items {
+		if desired[s.Name] {
+			continue
+		}
+		if err := r.client.DeleteSecret(types.NamespacedName{Name: s.Name, Namespace: s.Namespace}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting the connection string Secret %s: %s", s.Name, err)
+		}
+		r.log.Infof("Deleted the connection string Secret %s of a removed user", s.Name)
+	}
+	return nil
+}
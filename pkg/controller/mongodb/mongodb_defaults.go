@@ -0,0 +1,65 @@
+package mongodb
+
+import (
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultMembers     = 3
+	defaultStorageSize = "10G"
+)
+
+// applyDefaults sets the fields of the spec which aren't set to the values the operator uses in
+// their place, so that the stored spec doesn't depend on the defaults of the operator, which may
+// change when it's upgraded. The defaults don't change how the resource is deployed, except for
+// the number of members of a resource which sets none.
+func applyDefaults(mdb *mdbv1.MongoDB) {
+	spec := &mdb.Spec
+	if spec.Members == 0 {
+		spec.Members = defaultMembers
+	}
+	if spec.Type == "" {
+		spec.Type = mdbv1.ReplicaSet
+	}
+	if len(spec.Security.Authentication.Modes) == 0 {
+		spec.Security.Authentication.Modes = []mdbv1.AuthMode{scramShaOption}
+	}
+
+	storage := &spec.Storage
+	if storage.DataPath == "" {
+		storage.DataPath = automationconfig.DefaultMongoDBDataDir
+	}
+	if storage.Logs != nil && storage.LogsPath == "" {
+		storage.LogsPath = defaultLogsPath
+	}
+	if storage.ReclaimPolicy == "" {
+		storage.ReclaimPolicy = mdbv1.RetainVolumes
+	}
+	// the size of an ephemeral volume limits the size of its emptyDir, which is unlimited by default
+	if !storage.Ephemeral {
+		applyVolumeClaimDefaults(&storage.Data)
+		if storage.Journal != nil {
+			applyVolumeClaimDefaults(storage.Journal)
+		}
+		if storage.Logs != nil {
+			applyVolumeClaimDefaults(storage.Logs)
+		}
+	}
+}
+
+func applyVolumeClaimDefaults(claim *mdbv1.VolumeClaim) {
+	if claim.Size == "" {
+		claim.Size = defaultStorageSize
+	}
+	claim.AccessModes = accessModes(*claim)
+}
+
+// accessModes returns the access modes of the volume, ReadWriteOnce if none are configured
+func accessModes(claim mdbv1.VolumeClaim) []corev1.PersistentVolumeAccessMode {
+	if len(claim.AccessModes) == 0 {
+		return []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	return claim.AccessModes
+}
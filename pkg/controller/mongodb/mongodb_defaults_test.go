@@ -0,0 +1,60 @@
+package mongodb
+
+import (
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	mdb := mdbv1.MongoDB{}
+	mdb.Spec.Storage.Logs = &mdbv1.VolumeClaim{Size: "1Gi"}
+	applyDefaults(&mdb)
+
+	assert.Equal(t, 3, mdb.Spec.Members)
+	assert.Equal(t, mdbv1.ReplicaSet, mdb.Spec.Type)
+	assert.Equal(t, []mdbv1.AuthMode{"SCRAM"}, mdb.Spec.Security.Authentication.Modes)
+	assert.False(t, mdb.Spec.Security.Authentication.Enabled, "the authentication isn't enabled")
+	assert.Equal(t, "/data", mdb.Spec.Storage.DataPath)
+	assert.Equal(t, "/var/log/mongodb", mdb.Spec.Storage.LogsPath)
+	assert.Equal(t, mdbv1.RetainVolumes, mdb.Spec.Storage.ReclaimPolicy)
+	rwo := []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	assert.Equal(t, mdbv1.VolumeClaim{Size: "10G", AccessModes: rwo}, mdb.Spec.Storage.Data)
+	assert.Equal(t, &mdbv1.VolumeClaim{Size: "1Gi", AccessModes: rwo}, mdb.Spec.Storage.Logs)
+	assert.Nil(t, mdb.Spec.Storage.Journal)
+
+	defaulted := *mdb.DeepCopy()
+	applyDefaults(&mdb)
+	assert.Equal(t, defaulted, mdb, "the defaults are only set once")
+}
+
+func TestApplyDefaults_KeepsTheSetFields(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.Members = 5
+	mdb.Spec.Storage.Ephemeral = true
+	mdb.Spec.Storage.LogsPath = "/logs"
+	mdb.Spec.Storage.ReclaimPolicy = mdbv1.DeleteVolumes
+	expected := *mdb.DeepCopy()
+	expected.Spec.Type = mdbv1.ReplicaSet
+	expected.Spec.Storage.DataPath = "/data"
+	applyDefaults(&mdb)
+
+	assert.Equal(t, expected, mdb, "the ephemeral volumes aren't limited in size")
+}
+
+func TestApplyDefaults_DontChangeTheStatefulSet(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.Journal = &mdbv1.VolumeClaim{}
+	mdb.Spec.Storage.Logs = &mdbv1.VolumeClaim{}
+	defaulted := *mdb.DeepCopy()
+	applyDefaults(&defaulted)
+
+	sts, err := buildStatefulSet(mdb)
+	assert.NoError(t, err)
+	defaultedSts, err := buildStatefulSet(defaulted)
+	assert.NoError(t, err)
+	assert.Equal(t, sts, defaultedSts)
+}
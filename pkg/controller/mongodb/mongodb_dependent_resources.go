@@ -0,0 +1,130 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// dependentResourcesHashesAnnotationKey holds the hashes of the data of spec.dependentResources,
+	// by kind and name, as they were when the members were last restarted
+	dependentResourcesHashesAnnotationKey = "mongodb.com/v1.dependentResourcesHashes"
+	// dependentResourcesChangedAtAnnotationKey holds when a change of the data of
+	// spec.dependentResources was last detected. The members whose Pod was created before are
+	// restarted, like with spec.restartedAt.
+	dependentResourcesChangedAtAnnotationKey = "mongodb.com/v1.dependentResourcesChangedAt"
+
+	dependentResourceChangedEventReason = "DependentResourceChanged"
+)
+
+// dependentResourceKey returns the key of a dependent resource in the hashes annotation
+func dependentResourceKey(dependent mdbv1.DependentResource) string {
+	return fmt.Sprintf("%s/%s", dependent.Kind, dependent.Name)
+}
+
+// dependentResourcesHashes returns the hashes of the data of spec.dependentResources by key, or a
+// terminal error if one of them doesn't exist
+func (r *ReplicaSetReconciler) dependentResourcesHashes(mdb mdbv1.MongoDB) (map[string]string, error) {
+	hashes := map[string]string{}
+	for i, dependent := range mdb.Spec.DependentResources {
+		nsName := types.NamespacedName{Name: dependent.Name, Namespace: mdb.Namespace}
+		var data interface{}
+		var err error
+		if dependent.Kind == mdbv1.DependentSecret {
+			s := corev1.Secret{}
+			err = r.client.Get(context.TODO(), nsName, &s)
+			data = s.Data
+		} else {
+			cm := corev1.ConfigMap{}
+			err = r.client.Get(context.TODO(), nsName, &cm)
+			data = []interface{}{cm.Data, cm.BinaryData}
+		}
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil, referencedResourceNotFound(string(dependent.Kind), nsName, fmt.Sprintf("spec.dependentResources[%d]", i))
+			}
+			return nil, fmt.Errorf("error reading %s %s: %s", dependent.Kind, dependent.Name, err)
+		}
+		hash, err := specHash(data)
+		if err != nil {
+			return nil, fmt.Errorf("error hashing %s %s: %s", dependent.Kind, dependent.Name, err)
+		}
+		hashes[dependentResourceKey(dependent)] = hash
+	}
+	return hashes, nil
+}
+
+// trackDependentResources compares the data of spec.dependentResources with the data recorded on
+// the resource, and records when one of them changed, so that the members are restarted. The data
+// of a resource newly added to spec.dependentResources is recorded without restarting the members.
+// It returns the resource with the updated annotations.
+func (r *ReplicaSetReconciler) trackDependentResources(mdb mdbv1.MongoDB) (mdbv1.MongoDB, error) {
+	if len(mdb.Spec.DependentResources) == 0 {
+		return mdb, nil
+	}
+	hashes, err := r.dependentResourcesHashes(mdb)
+	if err != nil {
+		return mdb, err
+	}
+
+	recorded := map[string]string{}
+	if value, ok := mdb.Annotations[dependentResourcesHashesAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(value), &recorded); err != nil {
+			return mdb, fmt.Errorf("error reading %s annotation: %s", dependentResourcesHashesAnnotationKey, err)
+		}
+	}
+	var changed []string
+	for _, dependent := range mdb.Spec.DependentResources {
+		key := dependentResourceKey(dependent)
+		if hash, ok := recorded[key]; ok && hash != hashes[key] {
+			changed = append(changed, key)
+		}
+	}
+
+	// a map is always marshalled with sorted keys
+	value, _ := json.Marshal(hashes)
+	if string(value) == mdb.Annotations[dependentResourcesHashesAnnotationKey] {
+		return mdb, nil
+	}
+	annotations := map[string]string{dependentResourcesHashesAnnotationKey: string(value)}
+	if len(changed) > 0 {
+		annotations[dependentResourcesChangedAtAnnotationKey] = r.now().UTC().Format(time.RFC3339)
+		r.log.Infof("Restarting the members as %s changed", strings.Join(changed, ", "))
+		r.recordRestartEvent(mdb, dependentResourceChangedEventReason, "Restarting the members as %s changed", strings.Join(changed, ", "))
+	}
+	if err := r.setAnnotations(mdb.NamespacedName(), annotations); err != nil {
+		return mdb, fmt.Errorf("error setting annotations: %s", err)
+	}
+
+	// the annotations of the given resource are shared with the caller, they're copied rather than updated
+	updated := map[string]string{}
+	for key, val := range mdb.Annotations {
+		updated[key] = val
+	}
+	for key, val := range annotations {
+		updated[key] = val
+	}
+	mdb.Annotations = updated
+	return mdb, nil
+}
+
+// restartRequestedAt returns the time the Pods of the members must have been created after: the
+// latest of spec.restartedAt and of the last change of spec.dependentResources, or nil if no
+// restart was requested
+func restartRequestedAt(mdb mdbv1.MongoDB) *metav1.Time {
+	requestedAt := mdb.Spec.RestartedAt
+	changedAt, err := time.Parse(time.RFC3339, mdb.Annotations[dependentResourcesChangedAtAnnotationKey])
+	if err == nil && (requestedAt == nil || requestedAt.Time.Before(changedAt)) {
+		requestedAt = &metav1.Time{Time: changedAt}
+	}
+	return requestedAt
+}
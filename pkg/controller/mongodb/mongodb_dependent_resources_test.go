@@ -0,0 +1,76 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTrackDependentResources(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.DependentResources = []mdbv1.DependentResource{
+		{Kind: mdbv1.DependentSecret, Name: "ca-bundle"},
+		{Kind: mdbv1.DependentConfigMap, Name: "sidecar-config"},
+	}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	changedAt := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return changedAt }
+
+	_, err := r.trackDependentResources(mdb)
+	assert.EqualError(t, err, `Secret "my-ns/ca-bundle" referenced by spec.dependentResources[0] not found`)
+
+	assert.NoError(t, c.Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle", Namespace: mdb.Namespace},
+		Data:       map[string][]byte{"ca.crt": []byte("first")},
+	}))
+	sidecarConfig := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "sidecar-config", Namespace: mdb.Namespace},
+		Data:       map[string]string{"config.yaml": "level: info"},
+	}
+	assert.NoError(t, c.Create(context.TODO(), &sidecarConfig))
+
+	mdb, err = r.trackDependentResources(mdb)
+	assert.NoError(t, err)
+	assert.Contains(t, mdb.Annotations, dependentResourcesHashesAnnotationKey)
+	assert.Nil(t, restartRequestedAt(mdb), "the members aren't restarted for the data they were started with")
+
+	mdb, err = r.trackDependentResources(mdb)
+	assert.NoError(t, err)
+	assert.Nil(t, restartRequestedAt(mdb))
+
+	t.Run("A change of the data restarts the members", func(t *testing.T) {
+		sidecarConfig.Data["config.yaml"] = "level: debug"
+		assert.NoError(t, c.Update(context.TODO(), &sidecarConfig))
+		mdb, err = r.trackDependentResources(mdb)
+		assert.NoError(t, err)
+		assert.Equal(t, changedAt, restartRequestedAt(mdb).Time)
+
+		newMdb, _ := r.getResource(mdb.NamespacedName())
+		assert.Equal(t, mdb.Annotations[dependentResourcesHashesAnnotationKey], newMdb.Annotations[dependentResourcesHashesAnnotationKey])
+		assert.Equal(t, "2026-03-04T10:00:00Z", newMdb.Annotations[dependentResourcesChangedAtAnnotationKey])
+	})
+}
+
+func TestRestartRequestedAt(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	assert.Nil(t, restartRequestedAt(mdb))
+
+	restartedAt := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	mdb.Spec.RestartedAt = &metav1.Time{Time: restartedAt}
+	assert.Equal(t, restartedAt, restartRequestedAt(mdb).Time)
+
+	mdb.Annotations = map[string]string{dependentResourcesChangedAtAnnotationKey: "2026-03-04T09:00:00Z"}
+	assert.Equal(t, restartedAt, restartRequestedAt(mdb).Time, "the latest request is kept")
+
+	mdb.Annotations[dependentResourcesChangedAtAnnotationKey] = "2026-03-04T11:00:00Z"
+	assert.Equal(t, restartedAt.Add(time.Hour), restartRequestedAt(mdb).Time)
+}
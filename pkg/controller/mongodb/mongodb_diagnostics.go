@@ -0,0 +1,236 @@
+package mongodb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	kubePod "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/pod"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// collectDiagnosticsAnnotationKey makes the operator collect a diagnostics bundle of the resource
+	collectDiagnosticsAnnotationKey = "mongodb.com/v1.collectDiagnostics"
+	diagnosticsCollectedEventReason = "DiagnosticsCollected"
+	// diagnosticsKey is the key of the diagnostics Secret holding the bundle
+	diagnosticsKey = "diagnostics.tar.gz"
+	// diagnosticsLogLines is the number of the last lines of the logs of each container collected
+	diagnosticsLogLines = 1000
+)
+
+// podLogReader returns the last lines of the logs of the container of a Pod
+type podLogReader func(nsName types.NamespacedName, container string, tailLines int64) ([]byte, error)
+
+func newPodLogReader(config *rest.Config) podLogReader {
+	return func(nsName types.NamespacedName, container string, tailLines int64) ([]byte, error) {
+		if config == nil {
+			return nil, fmt.Errorf("no configuration to connect to the Kubernetes API")
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		return clientset.CoreV1().Pods(nsName.Namespace).GetLogs(nsName.Name, &corev1.PodLogOptions{
+			Container: container,
+			TailLines: &tailLines,
+		}).Do().Raw()
+	}
+}
+
+// podExecutor runs a command in the container of a Pod and returns its output
+type podExecutor func(nsName types.NamespacedName, container string, command []string) (kubePod.ExecResult, error)
+
+func newPodExecutor(config *rest.Config) podExecutor {
+	return func(nsName types.NamespacedName, container string, command []string) (kubePod.ExecResult, error) {
+		executor, err := kubePod.NewExecutor(config)
+		if err != nil {
+			return kubePod.ExecResult{}, err
+		}
+		return executor.Exec(nsName, container, command)
+	}
+}
+
+// diagnosticsBundle holds the files of the diagnostics bundle by path
+type diagnosticsBundle map[string][]byte
+
+func (b diagnosticsBundle) addJSON(path string, value interface{}) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		b.addError(path, err)
+		return
+	}
+	b[path] = buf.Bytes()
+}
+
+// addError records why a file couldn't be collected, so that the rest of the bundle is still collected
+func (b diagnosticsBundle) addError(path string, err error) {
+	b[path+".error"] = []byte(err.Error())
+}
+
+// collectDiagnostics gathers the resource, the redacted automation config, the output of
+// replSetGetStatus, the agent status, the logs of the containers, a ping and the disk usage of every
+// member, and the events of the resource and of its Pods, into a gzipped tarball stored in the <name>-diagnostics Secret.
+// The files which can't be collected, such as the replica set status while it is down, are replaced
+// by the error. The annotation requesting the bundle is removed once it is stored.
+func (r *ReplicaSetReconciler) collectDiagnostics(mdb mdbv1.MongoDB) error {
+	bundle := diagnosticsBundle{}
+	bundle.addJSON("mongodb.json", mdb)
+
+	if ac, err := getCurrentAutomationConfig(r.client, mdb); err != nil {
+		bundle.addError("automation-config.json", err)
+	} else if redacted, err := automationconfig.Redacted(ac); err != nil {
+		bundle.addError("automation-config.json", err)
+	} else {
+		bundle.addJSON("automation-config.json", redacted)
+	}
+
+	if rsStatus, err := r.readReplicaSetStatus(mdb); err != nil {
+		bundle.addError("replica-set-status.json", err)
+	} else {
+		bundle.addJSON("replica-set-status.json", rsStatus)
+	}
+
+	involvedObjects := map[string]bool{mdb.Name: true}
+	for i := 0; i < mdb.Spec.Members; i++ {
+		podName := fmt.Sprintf("%s-%d", mdb.Name, i)
+		involvedObjects[podName] = true
+		r.collectPodDiagnostics(bundle, mdb, types.NamespacedName{Name: podName, Namespace: mdb.Namespace})
+	}
+
+	eventList := corev1.EventList{}
+	if err := r.client.List(context.TODO(), &eventList, k8sClient.InNamespace(mdb.Namespace)); err != nil {
+		bundle.addError("events.json", err)
+	} else {
+		var events []corev1.Event
+		for _, event := range eventList.Items {
+			if involvedObjects[event.InvolvedObject.Name] {
+				events = append(events, event)
+			}
+		}
+		bundle.addJSON("events.json", events)
+	}
+
+	archive, err := bundle.archive(r.now())
+	if err != nil {
+		return fmt.Errorf("error archiving diagnostics: %s", err)
+	}
+	diagnosticsSecret := secret.Builder().
+		SetName(mdb.Name + "-diagnostics").
+		SetNamespace(mdb.Namespace).
+		SetByteData(map[string][]byte{diagnosticsKey: archive}).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
+		Build()
+	if err := r.client.ApplySecret(diagnosticsSecret); err != nil {
+		return fmt.Errorf("error writing diagnostics: %s", err)
+	}
+
+	message := fmt.Sprintf("Collected the diagnostics in the Secret %s", diagnosticsSecret.Name)
+	r.log.Info(message)
+	if r.recorder != nil {
+		r.recorder.Event(&mdb, corev1.EventTypeNormal, diagnosticsCollectedEventReason, message)
+	}
+	return r.removeAnnotation(mdb.NamespacedName(), collectDiagnosticsAnnotationKey)
+}
+
+// collectPodDiagnostics adds the agent status published on the Pod of the member, the last lines of
+// the logs of its containers, and the output of the diagnostic commands run in its mongod container
+// to the bundle
+func (r *ReplicaSetReconciler) collectPodDiagnostics(bundle diagnosticsBundle, mdb mdbv1.MongoDB, nsName types.NamespacedName) {
+	dir := "pods/" + nsName.Name + "/"
+	pod := corev1.Pod{}
+	if err := r.client.Get(context.TODO(), nsName, &pod); err != nil {
+		bundle.addError(dir+"pod.json", err)
+		return
+	}
+	bundle.addJSON(dir+"pod.json", pod.Status)
+	if agentStatus, ok := pod.Annotations[agenthealth.MemberStatusAnnotationKey]; ok {
+		bundle[dir+"agent-status.json"] = []byte(agentStatus)
+	}
+	for _, container := range []string{agentName, mongodbName} {
+		path := dir + container + ".log"
+		logs, err := r.readPodLogs(nsName, container, diagnosticsLogLines)
+		if err != nil {
+			bundle.addError(path, err)
+			continue
+		}
+		bundle[path] = logs
+	}
+	for _, c := range diagnosticCommands(mdb) {
+		path := dir + c.file
+		result, err := r.execInPod(nsName, mongodbName, c.command)
+		if err != nil {
+			bundle.addError(path, fmt.Errorf("%s: %s", err, result.Stderr))
+			continue
+		}
+		bundle[path] = result.Stdout
+	}
+}
+
+// diagnosticCommand is a command run in the mongod container of each member, whose output is stored
+// in file
+type diagnosticCommand struct {
+	file    string
+	command []string
+}
+
+// diagnosticCommands returns the commands run in the mongod container of the members: a ping of the
+// member, which doesn't need to authenticate, and the disk usage of the data volume
+func diagnosticCommands(mdb mdbv1.MongoDB) []diagnosticCommand {
+	options := ""
+	if mdb.Spec.Security.TLS.Enabled {
+		// the mongod container doesn't mount the CA, the ping only checks the member responds
+		options = " --ssl --sslAllowInvalidCertificates"
+	}
+	ping := fmt.Sprintf(`shell=$(command -v mongo || command -v mongosh); $shell --host "$(hostname -f)" --port 27017 --quiet%s --eval 'JSON.stringify(db.adminCommand({ping: 1}))'`, options)
+	return []diagnosticCommand{
+		{file: "ping.txt", command: []string{"/bin/sh", "-c", ping}},
+		{file: "disk-usage.txt", command: []string{"df", "-k", dataPath(mdb)}},
+	}
+}
+
+// archive returns the files of the bundle as a gzipped tarball
+func (b diagnosticsBundle) archive(now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	var paths []string
+	for path := range b {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		content := b[path]
+		header := &tar.Header{Name: path, Mode: 0644, Size: int64(len(content)), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+package mongodb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	kubePod "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/pod"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// extractArchive returns the files of a gzipped tarball by path
+func extractArchive(t *testing.T, archive []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(tr)
+		assert.NoError(t, err)
+		files[header.Name] = string(content)
+	}
+	return files
+}
+
+func TestCollectDiagnostics(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	r.connectToLiveCluster = func(_ string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+	r.readPodLogs = func(nsName types.NamespacedName, container string, tailLines int64) ([]byte, error) {
+		assert.Equal(t, int64(diagnosticsLogLines), tailLines)
+		if container == mongodbName {
+			return nil, fmt.Errorf("container not found")
+		}
+		return []byte(fmt.Sprintf("logs of %s/%s", nsName.Name, container)), nil
+	}
+	r.execInPod = func(nsName types.NamespacedName, container string, command []string) (kubePod.ExecResult, error) {
+		assert.Equal(t, mongodbName, container)
+		if command[0] == "df" {
+			return kubePod.ExecResult{Stdout: []byte("disk usage of " + command[2])}, nil
+		}
+		return kubePod.ExecResult{Stderr: []byte("connect failed")}, fmt.Errorf("command terminated with exit code 1")
+	}
+
+	for i := 0; i < mdb.Spec.Members; i++ {
+		recreatePod(t, c, mdb, fmt.Sprintf("%s-%d", mdb.Name, i), time.Now())
+	}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Annotations = map[string]string{collectDiagnosticsAnnotationKey: trueAnnotation}
+	assert.NoError(t, c.Update(context.TODO(), &mdb))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	diagnosticsSecret := corev1.Secret{}
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: mdb.Name + "-diagnostics", Namespace: mdb.Namespace}, &diagnosticsSecret))
+	assert.Equal(t, mdb.Name, diagnosticsSecret.OwnerReferences[0].Name)
+	files := extractArchive(t, diagnosticsSecret.Data[diagnosticsKey])
+
+	assert.Contains(t, files, "mongodb.json")
+	assert.Contains(t, files, "events.json")
+	assert.Contains(t, files, "pods/my-rs-0/pod.json")
+	assert.Contains(t, files["pods/my-rs-0/agent-status.json"], `"isInGoalState":true`)
+	assert.Equal(t, "logs of my-rs-2/mongodb-agent", files["pods/my-rs-2/mongodb-agent.log"])
+	assert.Equal(t, "container not found", files["pods/my-rs-2/mongod.log.error"], "the other files are collected if one can't be")
+	assert.Contains(t, files["replica-set-status.json.error"], "connection refused")
+	assert.Equal(t, "disk usage of /data", files["pods/my-rs-1/disk-usage.txt"])
+	assert.Equal(t, "command terminated with exit code 1: connect failed", files["pods/my-rs-1/ping.txt.error"])
+
+	ac, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ac.Auth.Key)
+	assert.Contains(t, files["automation-config.json"], `"key": "<redacted>"`)
+	assert.NotContains(t, files["automation-config.json"], ac.Auth.Key)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.NotContains(t, mdb.Annotations, collectDiagnosticsAnnotationKey)
+}
+
+func TestDiagnosticCommands(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	commands := diagnosticCommands(mdb)
+	assert.Len(t, commands, 2)
+	assert.Equal(t, "ping.txt", commands[0].file)
+	assert.NotContains(t, commands[0].command[2], "--ssl")
+	assert.Equal(t, []string{"df", "-k", "/data"}, commands[1].command)
+
+	mdb.Spec.Security.TLS.Enabled = true
+	mdb.Spec.Storage.DataPath = "/var/lib/mongodb"
+	commands = diagnosticCommands(mdb)
+	assert.Contains(t, commands[0].command[2], "--ssl --sslAllowInvalidCertificates")
+	assert.Equal(t, []string{"df", "-k", "/var/lib/mongodb"}, commands[1].command)
+}
@@ -0,0 +1,84 @@
+package mongodb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	defaultUsageWarningThreshold   = 80
+	dataVolumeUsageHighEventReason = "DataVolumeUsageHigh"
+	dataVolumeUsageHighReason      = "UsageAboveThreshold"
+)
+
+var (
+	dataVolumeUsedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_data_volume_used_bytes",
+		Help: "Used bytes of the data volume of a member",
+	}, []string{"namespace", "name", "member"})
+
+	dataVolumeCapacityBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_data_volume_capacity_bytes",
+		Help: "Capacity in bytes of the data volume of a member",
+	}, []string{"namespace", "name", "member"})
+)
+
+func init() {
+	// the metrics are served by the manager along with the controller-runtime ones
+	metrics.Registry.MustRegister(dataVolumeUsedBytes, dataVolumeCapacityBytes)
+}
+
+// dataVolumeUsage returns the usage of the data volume reported by the agent of the member, if any
+func dataVolumeUsage(agentStatus agenthealth.MemberStatus) *mdbv1.VolumeUsage {
+	if agentStatus.DataVolume == nil || agentStatus.DataVolume.CapacityBytes == 0 {
+		return nil
+	}
+	return &mdbv1.VolumeUsage{
+		UsedBytes:     agentStatus.DataVolume.UsedBytes,
+		CapacityBytes: agentStatus.DataVolume.CapacityBytes,
+		UsedPercent:   int(agentStatus.DataVolume.UsedBytes * 100 / agentStatus.DataVolume.CapacityBytes),
+	}
+}
+
+// recordDataVolumeUsage exposes the usage of the data volume of the member as metrics
+func recordDataVolumeUsage(mdb mdbv1.MongoDB, member mdbv1.MemberStatus) {
+	if member.DataVolumeUsage == nil {
+		return
+	}
+	labels := prometheus.Labels{"namespace": mdb.Namespace, "name": mdb.Name, "member": member.Name}
+	dataVolumeUsedBytes.With(labels).Set(float64(member.DataVolumeUsage.UsedBytes))
+	dataVolumeCapacityBytes.With(labels).Set(float64(member.DataVolumeUsage.CapacityBytes))
+}
+
+func usageWarningThreshold(mdb mdbv1.MongoDB) int {
+	if mdb.Spec.Storage.UsageWarningThreshold > 0 {
+		return mdb.Spec.Storage.UsageWarningThreshold
+	}
+	return defaultUsageWarningThreshold
+}
+
+// dataVolumeUsageCondition returns the DataVolumeUsageBelowThreshold condition, which is
+// false if the usage of the data volume of any member is above the threshold.
+func dataVolumeUsageCondition(members []mdbv1.MemberStatus, threshold int) mdbv1.Condition {
+	var messages []string
+	for _, member := range members {
+		if member.DataVolumeUsage != nil && member.DataVolumeUsage.UsedPercent >= threshold {
+			messages = append(messages, fmt.Sprintf("%s uses %d%% of its data volume", member.Name, member.DataVolumeUsage.UsedPercent))
+		}
+	}
+	if len(messages) == 0 {
+		return mdbv1.Condition{Type: mdbv1.DataVolumeUsageBelowThreshold, Status: corev1.ConditionTrue}
+	}
+	return mdbv1.Condition{
+		Type:    mdbv1.DataVolumeUsageBelowThreshold,
+		Status:  corev1.ConditionFalse,
+		Reason:  dataVolumeUsageHighReason,
+		Message: fmt.Sprintf("%s, above the threshold of %d%%", strings.Join(messages, ", "), threshold),
+	}
+}
@@ -0,0 +1,63 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestDataVolumeUsageCondition(t *testing.T) {
+	members := []mdbv1.MemberStatus{
+		{Name: "my-rs-0", DataVolumeUsage: &mdbv1.VolumeUsage{UsedPercent: 50}},
+		{Name: "my-rs-1", DataVolumeUsage: &mdbv1.VolumeUsage{UsedPercent: 85}},
+		{Name: "my-rs-2"},
+	}
+
+	condition := dataVolumeUsageCondition(members, 80)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "my-rs-1 uses 85% of its data volume, above the threshold of 80%", condition.Message)
+
+	condition = dataVolumeUsageCondition(members, 90)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+}
+
+func TestDataVolumeUsage_IsReportedInStatusAndMetrics(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.UsageWarningThreshold = 75
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	usage := agenthealth.MemberStatus{DataVolume: &agenthealth.VolumeUsage{UsedBytes: 80 << 20, CapacityBytes: 100 << 20}}
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-0", mdb.Name),
+			Namespace:   mdb.Namespace,
+			Annotations: map[string]string{agenthealth.MemberStatusAnnotationKey: `{"lastGoalVersionAchieved":1,"isInGoalState":true,"dataVolume":{"usedBytes":83886080,"capacityBytes":104857600}}`},
+		},
+	}
+	assert.NoError(t, mgr.GetClient().Create(context.TODO(), &pod))
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, &mdbv1.VolumeUsage{UsedBytes: usage.DataVolume.UsedBytes, CapacityBytes: usage.DataVolume.CapacityBytes, UsedPercent: 80}, mdb.Status.Members[0].DataVolumeUsage)
+	assert.Nil(t, mdb.Status.Members[1].DataVolumeUsage)
+
+	condition := mdb.GetCondition(mdbv1.DataVolumeUsageBelowThreshold)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, dataVolumeUsageHighReason, condition.Reason)
+
+	assert.Equal(t, float64(80<<20), testutil.ToFloat64(dataVolumeUsedBytes.WithLabelValues(mdb.Namespace, mdb.Name, pod.Name)))
+	assert.Equal(t, float64(100<<20), testutil.ToFloat64(dataVolumeCapacityBytes.WithLabelValues(mdb.Namespace, mdb.Name, pod.Name)))
+}
@@ -0,0 +1,256 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+const (
+	driftDetectedEventReason = "DriftDetected"
+	driftDetectedReason      = "DriftDetected"
+	// driftRepairedReason is the reason of the InSync condition once the automation config has
+	// been published again to repair the drift it reports
+	driftRepairedReason = "DriftRepaired"
+)
+
+// liveClusterState is the state of the running replica set compared with the automation config
+type liveClusterState struct {
+	rsConfig livecluster.ReplicaSetConfig
+	users    []livecluster.User
+	fcv      string
+}
+
+// detectDrift compares the configuration of the running replica set, its users and the feature
+// compatibility version of its members with the automation config, and reports the differences,
+// made out-of-band, in the InSync condition of the resource. A new drift is repaired by the next
+// reconciliation when spec.repairDrift is set, see repairDrift. The replica set is only compared
+// once the deployment is ready, as it differs from the automation config while a change is applied.
+func (r *ReplicaSetReconciler) detectDrift(mdb mdbv1.MongoDB) error {
+	if mdb.DeletionTimestamp != nil || mdb.Spec.Paused {
+		return nil
+	}
+	if ready := mdb.GetCondition(mdbv1.Ready); ready == nil || ready.Status != corev1.ConditionTrue {
+		return nil
+	}
+
+	ac, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return fmt.Errorf("error reading automation config: %s", err)
+	}
+	live, err := r.readLiveClusterState(mdb)
+	if err != nil {
+		return err
+	}
+	condition := inSyncCondition(automationConfigDrift(ac, live))
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	previous := newMdb.DeepCopy()
+	previousCondition := previous.GetCondition(mdbv1.InSync)
+	// the condition of a drift already reported is kept, so that it is only repaired once
+	if condition.Status == corev1.ConditionTrue || previousCondition == nil || previousCondition.Status != corev1.ConditionFalse || previousCondition.Message != condition.Message {
+		newMdb.SetCondition(condition)
+	}
+	if !equality.Semantic.DeepEqual(previous.Status, newMdb.Status) {
+		if err := r.writeStatus(newMdb); err != nil {
+			return fmt.Errorf("error updating status: %s", err)
+		}
+	}
+
+	// the drift is only reported, and repaired, once until it changes
+	if condition.Status == corev1.ConditionTrue {
+		return nil
+	}
+	if previousCondition != nil && previousCondition.Status == corev1.ConditionFalse && previousCondition.Message == condition.Message {
+		return nil
+	}
+	message := condition.Message
+	if hasDriftToRepair(*newMdb) {
+		message += ", publishing the automation config again"
+	}
+	r.log.Warn(message)
+	if r.recorder != nil {
+		r.recorder.Event(newMdb, corev1.EventTypeWarning, driftDetectedEventReason, message)
+	}
+	return nil
+}
+
+// hasDriftToRepair returns true if the InSync condition reports a drift which hasn't been repaired
+// yet and spec.repairDrift is set
+func hasDriftToRepair(mdb mdbv1.MongoDB) bool {
+	if !mdb.Spec.RepairDrift || mdb.Spec.AutomationFreeze {
+		return false
+	}
+	condition := mdb.GetCondition(mdbv1.InSync)
+	return condition != nil && condition.Status == corev1.ConditionFalse && condition.Reason == driftDetectedReason
+}
+
+// repairDrift publishes the automation config again when the drift reported by detectDrift is to be
+// repaired, so that the agents revert it, and records it in the InSync condition
+func (r *ReplicaSetReconciler) repairDrift(mdb mdbv1.MongoDB) error {
+	if mdb.DeletionTimestamp != nil || !hasDriftToRepair(mdb) {
+		return nil
+	}
+	if err := r.repushAutomationConfig(mdb); err != nil {
+		return err
+	}
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if condition := newMdb.GetCondition(mdbv1.InSync); condition != nil && condition.Status == corev1.ConditionFalse {
+		newMdb.SetCondition(newCondition(mdbv1.InSync, corev1.ConditionFalse, driftRepairedReason, condition.Message))
+		if err := r.writeStatus(newMdb); err != nil {
+			return fmt.Errorf("error updating status: %s", err)
+		}
+	}
+	return nil
+}
+
+// readLiveClusterState connects to the running replica set as the agent, and reads its configuration,
+// its users and the feature compatibility version of its primary.
+func (r *ReplicaSetReconciler) readLiveClusterState(mdb mdbv1.MongoDB) (liveClusterState, error) {
+	reader, err := r.connectLiveCluster(mdb)
+	if err != nil {
+		return liveClusterState{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+	defer cancel()
+	defer r.disconnectLiveCluster(ctx, reader)
+
+	state := liveClusterState{}
+	if state.rsConfig, err = reader.ReplicaSetConfig(ctx); err != nil {
+		return liveClusterState{}, err
+	}
+	if state.users, err = reader.Users(ctx); err != nil {
+		return liveClusterState{}, err
+	}
+	if state.fcv, err = reader.FeatureCompatibilityVersion(ctx); err != nil {
+		return liveClusterState{}, err
+	}
+	return state, nil
+}
+
+// inSyncCondition returns the InSync condition, which is false if the running replica set has drifted
+// from the automation config
+func inSyncCondition(drifts []string) mdbv1.Condition {
+	if len(drifts) == 0 {
+		return mdbv1.Condition{Type: mdbv1.InSync, Status: corev1.ConditionTrue}
+	}
+	return newCondition(mdbv1.InSync, corev1.ConditionFalse, driftDetectedReason,
+		fmt.Sprintf("The running replica set has drifted from the automation config: %s", strings.Join(drifts, ", ")))
+}
+
+// automationConfigDrift returns the differences between the automation config and the running replica
+// set: the settings of the members, the users and their roles, and the feature compatibility version.
+// The users which aren't in the automation config are only reported if the agents manage all the users.
+func automationConfigDrift(ac automationconfig.AutomationConfig, live liveClusterState) []string {
+	var drifts []string
+
+	acMembers := map[string]automationconfig.ReplicaSetMember{}
+	for _, rs := range ac.ReplicaSets {
+		for _, m := range rs.Members {
+			acMembers[m.Host] = m
+		}
+	}
+	liveMembers := map[string]bool{}
+	for _, m := range live.rsConfig.Members {
+		name := processName(m.Host)
+		liveMembers[name] = true
+		expected, ok := acMembers[name]
+		if !ok {
+			drifts = append(drifts, fmt.Sprintf("member %s is not in the automation config", name))
+			continue
+		}
+		if int(m.Priority) != expected.Priority {
+			drifts = append(drifts, fmt.Sprintf("member %s has priority %v, expected %d", name, m.Priority, expected.Priority))
+		}
+		if m.Votes != expected.Votes {
+			drifts = append(drifts, fmt.Sprintf("member %s has %d votes, expected %d", name, m.Votes, expected.Votes))
+		}
+		if m.ArbiterOnly != expected.ArbiterOnly {
+			drifts = append(drifts, fmt.Sprintf("member %s has arbiterOnly %t, expected %t", name, m.ArbiterOnly, expected.ArbiterOnly))
+		}
+	}
+	for _, rs := range ac.ReplicaSets {
+		for _, m := range rs.Members {
+			if !liveMembers[m.Host] {
+				drifts = append(drifts, fmt.Sprintf("member %s is missing from the replica set configuration", m.Host))
+			}
+		}
+	}
+
+	if !ac.Auth.Disabled {
+		drifts = append(drifts, usersDrift(ac.Auth, live.users)...)
+	}
+
+	for _, p := range ac.Processes {
+		if p.FeatureCompatibilityVersion != "" && live.fcv != "" && p.FeatureCompatibilityVersion != live.fcv {
+			drifts = append(drifts, fmt.Sprintf("featureCompatibilityVersion is %s, expected %s", live.fcv, p.FeatureCompatibilityVersion))
+			break
+		}
+	}
+	return drifts
+}
+
+// usersDrift returns the users of the automation config which are missing or have other roles in the
+// running replica set, and the users which are not in the automation config if it is authoritative.
+// The agent user is configured through the autoUser field and is ignored.
+func usersDrift(auth automationconfig.Auth, liveUsers []livecluster.User) []string {
+	var drifts []string
+	var liveUserNames []string
+	liveRoles := map[string]string{}
+	for _, u := range liveUsers {
+		if u.Username == auth.AutoUser && u.Database == "admin" {
+			continue
+		}
+		roles := make([]string, len(u.Roles))
+		for i, role := range u.Roles {
+			roles[i] = fmt.Sprintf("%s@%s", role.Role, role.Database)
+		}
+		user := u.Username + "@" + u.Database
+		liveUserNames = append(liveUserNames, user)
+		liveRoles[user] = formatRoles(roles)
+	}
+
+	acUsers := map[string]bool{}
+	for _, u := range auth.Users {
+		user := u.Username + "@" + u.Database
+		acUsers[user] = true
+		roles := make([]string, len(u.Roles))
+		for i, role := range u.Roles {
+			roles[i] = fmt.Sprintf("%s@%s", role.Role, role.Database)
+		}
+		live, ok := liveRoles[user]
+		if !ok {
+			drifts = append(drifts, fmt.Sprintf("user %s is missing", user))
+			continue
+		}
+		if expected := formatRoles(roles); live != expected {
+			drifts = append(drifts, fmt.Sprintf("user %s has roles %s, expected %s", user, live, expected))
+		}
+	}
+	if auth.AuthoritativeSet {
+		for _, user := range liveUserNames {
+			if !acUsers[user] {
+				drifts = append(drifts, fmt.Sprintf("user %s is not in the automation config", user))
+			}
+		}
+	}
+	return drifts
+}
+
+func formatRoles(roles []string) string {
+	sort.Strings(roles)
+	return "[" + strings.Join(roles, " ") + "]"
+}
@@ -0,0 +1,176 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// liveReplicaSetConfig returns the configuration of the running replica set of the resource,
+// with a member of the given priority for each priority
+func liveReplicaSetConfig(mdb mdbv1.MongoDB, priorities ...float64) livecluster.ReplicaSetConfig {
+	rsConfig := livecluster.ReplicaSetConfig{Name: mdb.Name, ProtocolVersion: 1}
+	for i, priority := range priorities {
+		host := fmt.Sprintf("%s-%d.%s:27017", mdb.Name, i, getDomain(mdb.ServiceName(), mdb.Namespace, ""))
+		rsConfig.Members = append(rsConfig.Members, livecluster.ReplicaSetMember{Id: i, Host: host, Priority: priority, Votes: 1})
+	}
+	return rsConfig
+}
+
+func TestDetectDrift_IsReportedAndRepairedOnce(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.RepairDrift = true
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	live := mockLiveCluster{rsConfig: liveReplicaSetConfig(mdb, 1, 0, 1), fcv: "4.2"}
+	r.connectToLiveCluster = func(_ string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		return live, nil
+	}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	ac, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.detectDrift(mdb))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.InSync, corev1.ConditionFalse, driftDetectedReason)
+	assert.Equal(t, "The running replica set has drifted from the automation config: member my-rs-1 has priority 0, expected 1", mdb.GetCondition(mdbv1.InSync).Message)
+	currentAC, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, ac.Version, currentAC.Version, "the drift is only repaired by the reconciliation")
+	assert.True(t, hasWorkInProgress(mdb))
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.InSync, corev1.ConditionFalse, driftRepairedReason)
+	repushedAC, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, ac.Version+1, repushedAC.Version)
+
+	t.Run("The same drift is only repaired once", func(t *testing.T) {
+		assert.NoError(t, r.detectDrift(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assertCondition(t, mdb, mdbv1.InSync, corev1.ConditionFalse, driftRepairedReason)
+		assert.False(t, hasWorkInProgress(mdb))
+
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+		currentAC, err := getCurrentAutomationConfig(c, mdb)
+		assert.NoError(t, err)
+		assert.Equal(t, repushedAC.Version, currentAC.Version)
+	})
+
+	t.Run("The condition is true once the drift is reverted", func(t *testing.T) {
+		live.rsConfig = liveReplicaSetConfig(mdb, 1, 1, 1)
+		assert.NoError(t, r.detectDrift(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.InSync).Status)
+	})
+}
+
+func TestDetectDrift_IsOnlyReportedByDefault(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	r.connectToLiveCluster = func(_ string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		return mockLiveCluster{rsConfig: liveReplicaSetConfig(mdb, 1, 1, 1), fcv: "4.0"}, nil
+	}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	ac, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.detectDrift(mdb))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.InSync, corev1.ConditionFalse, driftDetectedReason)
+	currentAC, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, ac.Version, currentAC.Version)
+}
+
+func TestAutomationConfigDrift(t *testing.T) {
+	ac := automationconfig.AutomationConfig{
+		Processes: []automationconfig.Process{{Name: "my-rs-0", FeatureCompatibilityVersion: "4.2"}, {Name: "my-rs-1", FeatureCompatibilityVersion: "4.2"}},
+		ReplicaSets: []automationconfig.ReplicaSet{{
+			Id: "my-rs",
+			Members: []automationconfig.ReplicaSetMember{
+				{Id: 0, Host: "my-rs-0", Priority: 1, Votes: 1},
+				{Id: 1, Host: "my-rs-1", Priority: 1, Votes: 1},
+			},
+		}},
+		Auth: automationconfig.Auth{
+			AutoUser:         "mms-automation",
+			AuthoritativeSet: true,
+			Users: []automationconfig.MongoDBUser{
+				{Username: "app", Database: "admin", Roles: []automationconfig.Role{{Role: "readWrite", Database: "app"}, {Role: "read", Database: "reporting"}}},
+				{Username: "monitoring", Database: "admin", Roles: []automationconfig.Role{{Role: "clusterMonitor", Database: "admin"}}},
+			},
+		},
+	}
+
+	t.Run("A matching replica set has no drift", func(t *testing.T) {
+		live := liveClusterState{
+			rsConfig: livecluster.ReplicaSetConfig{Members: []livecluster.ReplicaSetMember{
+				{Id: 0, Host: "my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017", Priority: 1, Votes: 1},
+				{Id: 1, Host: "my-rs-1.my-rs-svc.my-ns.svc.cluster.local:27017", Priority: 1, Votes: 1},
+			}},
+			users: []livecluster.User{
+				{Username: "mms-automation", Database: "admin", Roles: []livecluster.Role{{Role: "root", Database: "admin"}}},
+				{Username: "app", Database: "admin", Roles: []livecluster.Role{{Role: "read", Database: "reporting"}, {Role: "readWrite", Database: "app"}}},
+				{Username: "monitoring", Database: "admin", Roles: []livecluster.Role{{Role: "clusterMonitor", Database: "admin"}}},
+			},
+			fcv: "4.2",
+		}
+		assert.Empty(t, automationConfigDrift(ac, live))
+	})
+
+	t.Run("The out-of-band changes are reported", func(t *testing.T) {
+		live := liveClusterState{
+			rsConfig: livecluster.ReplicaSetConfig{Members: []livecluster.ReplicaSetMember{
+				{Id: 0, Host: "my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017", Priority: 1, Votes: 0},
+				{Id: 2, Host: "other-0.other-svc.my-ns.svc.cluster.local:27017", Priority: 1, Votes: 1},
+			}},
+			users: []livecluster.User{
+				{Username: "app", Database: "admin", Roles: []livecluster.Role{{Role: "root", Database: "admin"}}},
+				{Username: "intruder", Database: "admin"},
+			},
+			fcv: "4.0",
+		}
+		assert.Equal(t, []string{
+			"member my-rs-0 has 0 votes, expected 1",
+			"member other-0 is not in the automation config",
+			"member my-rs-1 is missing from the replica set configuration",
+			"user app@admin has roles [root@admin], expected [read@reporting readWrite@app]",
+			"user monitoring@admin is missing",
+			"user intruder@admin is not in the automation config",
+			"featureCompatibilityVersion is 4.0, expected 4.2",
+		}, automationConfigDrift(ac, live))
+	})
+
+	t.Run("The other users are ignored if the automation config isn't authoritative", func(t *testing.T) {
+		auth := ac.Auth
+		auth.AuthoritativeSet = false
+		assert.Empty(t, usersDrift(auth, []livecluster.User{
+			{Username: "app", Database: "admin", Roles: []livecluster.Role{{Role: "read", Database: "reporting"}, {Role: "readWrite", Database: "app"}}},
+			{Username: "monitoring", Database: "admin", Roles: []livecluster.Role{{Role: "clusterMonitor", Database: "admin"}}},
+			{Username: "other", Database: "admin"},
+		}))
+	})
+}
@@ -0,0 +1,53 @@
+package mongodb
+
+import (
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// the reasons of the events emitted for the milestones of the lifecycle of the resource
+const (
+	readyEventReason               = "Ready"
+	tlsRolloutStartedEventReason   = "TLSRolloutStarted"
+	tlsRolloutCompletedEventReason = "TLSRolloutCompleted"
+	versionChangedEventReason      = "VersionChanged"
+)
+
+// recordMilestoneEvents emits an event for every milestone reached by the resource since the previous
+// status, so that they are shown by kubectl describe and can be alerted on. The steps of the changes,
+// such as the members being added or removed, emit their own events.
+func (r *ReplicaSetReconciler) recordMilestoneEvents(previous, mdb mdbv1.MongoDB) {
+	if r.recorder == nil {
+		return
+	}
+	if becameTrue(previous, mdb, mdbv1.Ready) {
+		r.recorder.Event(&mdb, corev1.EventTypeNormal, readyEventReason, "The deployment matches the resource")
+	}
+
+	tlsReady := mdb.GetCondition(mdbv1.TLSReady)
+	previousTLSReady := previous.GetCondition(mdbv1.TLSReady)
+	if tlsReady != nil && tlsReady.Reason == tlsRolloutInProgressReason && (previousTLSReady == nil || previousTLSReady.Reason != tlsRolloutInProgressReason) {
+		r.recorder.Event(&mdb, corev1.EventTypeNormal, tlsRolloutStartedEventReason, "Mounting the TLS certificates in the members")
+	}
+	if becameTrue(previous, mdb, mdbv1.TLSReady) {
+		r.recorder.Event(&mdb, corev1.EventTypeNormal, tlsRolloutCompletedEventReason, "TLS is enabled on all the members")
+	}
+
+	degraded := mdb.GetCondition(mdbv1.Degraded)
+	previousDegraded := previous.GetCondition(mdbv1.Degraded)
+	if degraded != nil && degraded.Reason == repeatedFailuresReason && (previousDegraded == nil || previousDegraded.Reason != repeatedFailuresReason) {
+		r.recorder.Event(&mdb, corev1.EventTypeWarning, reconciliationBackedOffEventReason, degraded.Message)
+	}
+
+	if previous.Status.Version != "" && mdb.Status.Version != previous.Status.Version {
+		r.recorder.Eventf(&mdb, corev1.EventTypeNormal, versionChangedEventReason, "All the members run version %s", mdb.Status.Version)
+	}
+}
+
+// becameTrue returns true if the condition of the resource is true, and wasn't in the previous resource
+func becameTrue(previous, mdb mdbv1.MongoDB, conditionType mdbv1.ConditionType) bool {
+	condition := mdb.GetCondition(conditionType)
+	previousCondition := previous.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue &&
+		(previousCondition == nil || previousCondition.Status != corev1.ConditionTrue)
+}
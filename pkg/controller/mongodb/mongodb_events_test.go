@@ -0,0 +1,97 @@
+package mongodb
+
+import (
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// recordedEvents returns the events recorded by the fake recorder so far
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestMilestoneEvents_ReadyIsRecordedOnce(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	recorder := record.NewFakeRecorder(100)
+	r.recorder = recorder
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Contains(t, recordedEvents(recorder), "Normal Ready The deployment matches the resource")
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.NotContains(t, recordedEvents(recorder), "Normal Ready The deployment matches the resource")
+}
+
+func TestRecordMilestoneEvents(t *testing.T) {
+	withStatus := func(version string, conditions ...mdbv1.Condition) mdbv1.MongoDB {
+		mdb := testutils.NewTestReplicaSetWithTLS()
+		mdb.Status.Version = version
+		mdb.Status.Conditions = conditions
+		return mdb
+	}
+	tlsRollingOut := newCondition(mdbv1.TLSReady, corev1.ConditionFalse, tlsRolloutInProgressReason, "")
+	tlsEnabled := newCondition(mdbv1.TLSReady, corev1.ConditionTrue, tlsEnabledReason, "")
+
+	tests := []struct {
+		name     string
+		previous mdbv1.MongoDB
+		mdb      mdbv1.MongoDB
+		events   []string
+	}{
+		{
+			name:     "TLS rollout started",
+			previous: withStatus("4.2.2"),
+			mdb:      withStatus("4.2.2", tlsRollingOut),
+			events:   []string{"Normal TLSRolloutStarted Mounting the TLS certificates in the members"},
+		},
+		{
+			name:     "TLS rollout completed",
+			previous: withStatus("4.2.2", tlsRollingOut),
+			mdb:      withStatus("4.2.2", tlsEnabled),
+			events:   []string{"Normal TLSRolloutCompleted TLS is enabled on all the members"},
+		},
+		{
+			name:     "Version changed",
+			previous: withStatus("4.0.6"),
+			mdb:      withStatus("4.2.2"),
+			events:   []string{"Normal VersionChanged All the members run version 4.2.2"},
+		},
+		{
+			name:     "Version of a new deployment",
+			previous: withStatus(""),
+			mdb:      withStatus("4.2.2"),
+		},
+		{
+			name:     "No change",
+			previous: withStatus("4.2.2", tlsEnabled),
+			mdb:      withStatus("4.2.2", tlsEnabled),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &ReplicaSetReconciler{recorder: recorder}
+			r.recordMilestoneEvents(tt.previous, tt.mdb)
+			assert.Equal(t, tt.events, recordedEvents(recorder))
+		})
+	}
+}
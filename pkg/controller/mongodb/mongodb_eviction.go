@@ -0,0 +1,102 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// safeToEvictAnnotationKey allows the cluster autoscaler to evict the Pods of the members when scaling
+// down a node, which it doesn't by default as they have emptyDir volumes. The evictions respect the
+// PodDisruptionBudget of the members.
+const safeToEvictAnnotationKey = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+// safeToEvictDeferredAnnotationKey is set on the resources whose members were deployed before they
+// were annotated with safeToEvictAnnotationKey, as annotating their Pod template restarts them. The
+// annotation is added to the members once it is removed.
+const safeToEvictDeferredAnnotationKey = "mongodb.com/v1.safeToEvictDeferred"
+
+// podEvicter evicts a Pod through the Eviction API, which respects the PodDisruptionBudget of the
+// Pod. An error for which errors.IsTooManyRequests is true is returned if the budget doesn't allow it.
+type podEvicter func(nsName types.NamespacedName) error
+
+// newPodEvicter returns a podEvicter sharing a clientset built once from the configuration
+func newPodEvicter(config *rest.Config) podEvicter {
+	if config == nil {
+		return func(types.NamespacedName) error {
+			return fmt.Errorf("no configuration to connect to the Kubernetes API")
+		}
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return func(types.NamespacedName) error {
+			return fmt.Errorf("error creating the Kubernetes clientset: %s", err)
+		}
+	}
+	return func(nsName types.NamespacedName) error {
+		return clientset.CoreV1().Pods(nsName.Namespace).Evict(&policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: nsName.Name, Namespace: nsName.Namespace},
+		})
+	}
+}
+
+// safeToEvictModification annotates the Pod template of the members with safeToEvictAnnotationKey,
+// unless the annotation is deferred for the members deployed before it was added, see
+// migrateSafeToEvictAnnotation
+func safeToEvictModification(mdb mdbv1.MongoDB) podtemplatespec.Modification {
+	if _, deferred := mdb.Annotations[safeToEvictDeferredAnnotationKey]; deferred {
+		return podtemplatespec.NOOP()
+	}
+	return podtemplatespec.WithAdditionalAnnotations(map[string]string{safeToEvictAnnotationKey: "true"})
+}
+
+// ensurePodDisruptionBudget creates or updates the PodDisruptionBudget of the members, which allows
+// one member at a time to be evicted, so that node drains and cluster autoscaler scale-downs keep
+// a majority of the members running and can make progress.
+func (r *ReplicaSetReconciler) ensurePodDisruptionBudget(mdb mdbv1.MongoDB) error {
+	desired := buildPodDisruptionBudget(mdb)
+	existing := policyv1beta1.PodDisruptionBudget{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, &existing)
+	if errors.IsNotFound(err) {
+		if err := r.client.Create(context.TODO(), &desired); err != nil {
+			return fmt.Errorf("error creating PodDisruptionBudget: %s", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting PodDisruptionBudget: %s", err)
+	}
+	if reflect.DeepEqual(existing.Spec, desired.Spec) {
+		return nil
+	}
+	existing.Spec = desired.Spec
+	if err := r.client.Update(context.TODO(), &existing); err != nil {
+		return fmt.Errorf("error updating PodDisruptionBudget: %s", err)
+	}
+	return nil
+}
+
+func buildPodDisruptionBudget(mdb mdbv1.MongoDB) policyv1beta1.PodDisruptionBudget {
+	maxUnavailable := intstr.FromInt(1)
+	return policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            mdb.Name + "-pdb",
+			Namespace:       mdb.Namespace,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": mdb.ServiceName()}},
+		},
+	}
+}
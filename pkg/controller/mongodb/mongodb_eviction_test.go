@@ -0,0 +1,46 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPodDisruptionBudget(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	pdb := policyv1beta1.PodDisruptionBudget{}
+	assert.NoError(t, mgrClient.Get(context.TODO(), types.NamespacedName{Name: "my-rs-pdb", Namespace: mdb.Namespace}, &pdb))
+	assert.Equal(t, intstr.FromInt(1), *pdb.Spec.MaxUnavailable)
+	assert.Equal(t, map[string]string{"app": "my-rs-svc"}, pdb.Spec.Selector.MatchLabels)
+	assert.Len(t, pdb.OwnerReferences, 1)
+
+	// changes to the budget are reverted
+	pdb.Spec.MaxUnavailable = nil
+	assert.NoError(t, mgrClient.Update(context.TODO(), &pdb))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.NoError(t, mgrClient.Get(context.TODO(), types.NamespacedName{Name: "my-rs-pdb", Namespace: mdb.Namespace}, &pdb))
+	assert.Equal(t, intstr.FromInt(1), *pdb.Spec.MaxUnavailable)
+
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, "true", sts.Spec.Template.Annotations[safeToEvictAnnotationKey])
+}
+
+func TestNewPodEvicter_WithoutConfiguration(t *testing.T) {
+	evict := newPodEvicter(nil)
+	assert.EqualError(t, evict(types.NamespacedName{Name: "my-rs-0", Namespace: "my-ns"}), "no configuration to connect to the Kubernetes API")
+}
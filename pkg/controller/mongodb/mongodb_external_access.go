@@ -0,0 +1,284 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/service"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	defaultHorizonName = "external"
+	externalPort       = 27017
+
+	// externalDNSHostnameAnnotationKey is the annotation of the Services external-dns publishes the
+	// hostname of, with the address of the Service
+	externalDNSHostnameAnnotationKey = "external-dns.alpha.kubernetes.io/hostname"
+	// podNameLabelKey is the label the StatefulSet controller sets to the name of each Pod
+	podNameLabelKey = "statefulset.kubernetes.io/pod-name"
+)
+
+// dnsEndpointGVK is the kind of the DNSEndpoints of external-dns, which is used through unstructured
+// objects so that the operator doesn't depend on its CRD being installed
+var dnsEndpointGVK = schema.GroupVersionKind{Group: "externaldns.k8s.io", Version: "v1alpha1", Kind: "DNSEndpoint"}
+
+func horizonName(mdb mdbv1.MongoDB) string {
+	if mdb.Spec.ExternalAccess.HorizonName != "" {
+		return mdb.Spec.ExternalAccess.HorizonName
+	}
+	return defaultHorizonName
+}
+
+func externalServiceType(mdb mdbv1.MongoDB) corev1.ServiceType {
+	if mdb.Spec.ExternalAccess.ServiceType != "" {
+		return mdb.Spec.ExternalAccess.ServiceType
+	}
+	return corev1.ServiceTypeLoadBalancer
+}
+
+func externalDNSSource(mdb mdbv1.MongoDB) mdbv1.ExternalDNSSource {
+	if mdb.Spec.ExternalAccess.ExternalDNS != "" {
+		return mdb.Spec.ExternalAccess.ExternalDNS
+	}
+	return mdbv1.ExternalDNSService
+}
+
+// externalHostnames returns the external hostnames of the members, or nil if spec.externalAccess isn't
+// set
+func externalHostnames(mdb mdbv1.MongoDB) []string {
+	if mdb.Spec.ExternalAccess == nil {
+		return nil
+	}
+	hostnames := make([]string, mdb.Spec.Members)
+	for i := range hostnames {
+		hostnames[i] = mdb.ExternalHostname(i)
+	}
+	return hostnames
+}
+
+// validateExternalAccess ensures the members can be reached through the horizon of spec.externalAccess,
+// which is selected by the SNI of the TLS connections
+func validateExternalAccess(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.ExternalAccess == nil {
+		return nil
+	}
+	if !mdb.Spec.Security.TLS.Enabled {
+		return fmt.Errorf("external access requires TLS")
+	}
+	if horizonName(mdb) == "__default" {
+		return fmt.Errorf("the horizon name __default is reserved")
+	}
+	return nil
+}
+
+// checkExternalHostnamesCertificate returns an error if the certificate of the members isn't valid
+// for all their external hostnames, which the clients connecting through the horizon verify
+func checkExternalHostnamesCertificate(mdb mdbv1.MongoDB, cert string) error {
+	hostnames := externalHostnames(mdb)
+	if len(hostnames) == 0 {
+		return nil
+	}
+	block, _ := pem.Decode([]byte(cert))
+	if block == nil {
+		return fmt.Errorf("the certificate isn't PEM encoded")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, hostname := range hostnames {
+		if err := certificate.VerifyHostname(hostname); err != nil {
+			missing = append(missing, hostname)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the certificate isn't valid for the external hostnames %s, add them to its subject alternative names", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// externalAccessModification advertises the external hostname of every member in the horizon of
+// spec.externalAccess
+func externalAccessModification(mdb mdbv1.MongoDB) automationconfig.Modification {
+	if mdb.Spec.ExternalAccess == nil {
+		return automationconfig.NOOP()
+	}
+	horizons := map[string]string{}
+	for i := 0; i < mdb.Spec.Members; i++ {
+		horizons[fmt.Sprintf("%s-%d", mdb.Name, i)] = fmt.Sprintf("%s:%d", mdb.ExternalHostname(i), externalPort)
+	}
+	return func(ac *automationconfig.AutomationConfig) {
+		for i := range ac.ReplicaSets {
+			for j, member := range ac.ReplicaSets[i].Members {
+				if hostname, ok := horizons[member.Host]; ok {
+					ac.ReplicaSets[i].Members[j].Horizons = map[string]string{horizonName(mdb): hostname}
+				}
+			}
+		}
+	}
+}
+
+// ensureExternalAccess applies the Service of every member if spec.externalAccess is set, and the
+// DNSEndpoint publishing their hostnames with the DNSEndpoint source. The Services of the removed
+// members are deleted, as are all the objects once spec.externalAccess is removed.
+func (r *ReplicaSetReconciler) ensureExternalAccess(mdb mdbv1.MongoDB) error {
+	members := 0
+	if mdb.Spec.ExternalAccess != nil {
+		members = mdb.Spec.Members
+	}
+	for i := 0; i < members; i++ {
+		if err := r.client.ApplyService(buildExternalService(mdb, i)); err != nil {
+			return wrapError(err, fmt.Sprintf("error applying Service %s", mdb.ExternalServiceName(i)))
+		}
+	}
+	// the Services are named after the index of their member, so the ones of the removed members
+	// follow the last member
+	for i := members; ; i++ {
+		svc := corev1.Service{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: mdb.ExternalServiceName(i), Namespace: mdb.Namespace}, &svc)
+		if errors.IsNotFound(err) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error getting Service %s: %s", mdb.ExternalServiceName(i), err)
+		}
+		if err := r.client.Delete(context.TODO(), &svc); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting Service %s: %s", svc.Name, err)
+		}
+		r.log.Infof("Deleted the external Service %s", svc.Name)
+	}
+	return r.ensureDNSEndpoint(mdb)
+}
+
+// buildExternalService returns the Service exposing the member with the index outside of the cluster,
+// annotated with its hostname for external-dns with the Service source
+func buildExternalService(mdb mdbv1.MongoDB, index int) corev1.Service {
+	annotations := map[string]string{}
+	for k, v := range mdb.Spec.ExternalAccess.Annotations {
+		annotations[k] = v
+	}
+	if externalDNSSource(mdb) == mdbv1.ExternalDNSService {
+		annotations[externalDNSHostnameAnnotationKey] = mdb.ExternalHostname(index)
+	}
+	return service.Builder().
+		SetName(mdb.ExternalServiceName(index)).
+		SetNamespace(mdb.Namespace).
+		SetLabels(map[string]string{"app": mdb.ServiceName()}).
+		SetAnnotations(annotations).
+		SetSelector(map[string]string{"app": mdb.ServiceName(), podNameLabelKey: fmt.Sprintf("%s-%d", mdb.Name, index)}).
+		SetServiceType(externalServiceType(mdb)).
+		SetPort(externalPort).
+		SetPortName(mongodbPortName).
+		SetPublishNotReadyAddresses(true).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
+		Build()
+}
+
+// ensureDNSEndpoint creates or updates the DNSEndpoint publishing the hostnames of the members with the
+// addresses of their Services with the DNSEndpoint source, and deletes it otherwise. The members whose
+// Service has no address yet are published once it has one. Nothing is done if the CRD of
+// external-dns isn't installed.
+func (r *ReplicaSetReconciler) ensureDNSEndpoint(mdb mdbv1.MongoDB) error {
+	enabled := mdb.Spec.ExternalAccess != nil && externalDNSSource(mdb) == mdbv1.ExternalDNSEndpoint
+	existing := unstructured.Unstructured{}
+	existing.SetGroupVersionKind(dnsEndpointGVK)
+	err := r.client.Get(context.TODO(), dnsEndpointNamespacedName(mdb), &existing)
+	if meta.IsNoMatchError(err) {
+		if enabled {
+			r.log.Warnf("The DNSEndpoint can't be created as the CRD of external-dns isn't installed")
+		}
+		return nil
+	}
+	found := err == nil
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting DNSEndpoint: %s", err)
+	}
+
+	if !enabled {
+		if !found || !metav1.IsControlledBy(&existing, &mdb) {
+			return nil
+		}
+		if err := r.client.Delete(context.TODO(), &existing); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting DNSEndpoint: %s", err)
+		}
+		return nil
+	}
+
+	services := make([]corev1.Service, mdb.Spec.Members)
+	for i := range services {
+		svc, err := r.client.GetService(types.NamespacedName{Name: mdb.ExternalServiceName(i), Namespace: mdb.Namespace})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error getting Service %s: %s", mdb.ExternalServiceName(i), err)
+		}
+		services[i] = svc
+	}
+	desired := buildDNSEndpoint(mdb, services)
+	if !found {
+		if err := r.client.Create(context.TODO(), &desired); err != nil {
+			return fmt.Errorf("error creating DNSEndpoint: %s", err)
+		}
+		return nil
+	}
+	if reflect.DeepEqual(existing.Object["spec"], desired.Object["spec"]) {
+		return nil
+	}
+	existing.Object["spec"] = desired.Object["spec"]
+	if err := r.client.Update(context.TODO(), &existing); err != nil {
+		return fmt.Errorf("error updating DNSEndpoint: %s", err)
+	}
+	return nil
+}
+
+func dnsEndpointNamespacedName(mdb mdbv1.MongoDB) types.NamespacedName {
+	return types.NamespacedName{Name: mdb.Name + "-external", Namespace: mdb.Namespace}
+}
+
+// buildDNSEndpoint returns the DNSEndpoint publishing the hostname of every member with the address of
+// its Service: an A record for the IP of a load balancer or a node, a CNAME record for the hostname
+// of a load balancer. It is owned by the resource, so that it is deleted with it.
+func buildDNSEndpoint(mdb mdbv1.MongoDB, services []corev1.Service) unstructured.Unstructured {
+	endpoint := unstructured.Unstructured{}
+	endpoint.SetGroupVersionKind(dnsEndpointGVK)
+	endpoint.SetName(dnsEndpointNamespacedName(mdb).Name)
+	endpoint.SetNamespace(mdb.Namespace)
+	endpoint.SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)})
+
+	endpoints := []interface{}{}
+	for i, svc := range services {
+		var ips, hostnames []interface{}
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				ips = append(ips, ingress.IP)
+			} else if ingress.Hostname != "" {
+				hostnames = append(hostnames, ingress.Hostname)
+			}
+		}
+		if len(ips) == 0 && svc.Spec.Type == corev1.ServiceTypeNodePort && len(svc.Spec.ExternalIPs) > 0 {
+			for _, ip := range svc.Spec.ExternalIPs {
+				ips = append(ips, ip)
+			}
+		}
+		switch {
+		case len(ips) > 0:
+			endpoints = append(endpoints, map[string]interface{}{"dnsName": mdb.ExternalHostname(i), "recordType": "A", "targets": ips})
+		case len(hostnames) > 0:
+			endpoints = append(endpoints, map[string]interface{}{"dnsName": mdb.ExternalHostname(i), "recordType": "CNAME", "targets": hostnames[:1]})
+		}
+	}
+	endpoint.Object["spec"] = map[string]interface{}{"endpoints": endpoints}
+	return endpoint
+}
@@ -0,0 +1,166 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newExternalAccessReplicaSet() mdbv1.MongoDB {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mdb.Spec.ExternalAccess = &mdbv1.ExternalAccess{Domain: "mongodb.example.com."}
+	return mdb
+}
+
+func getExternalService(t *testing.T, c client.Client, mdb mdbv1.MongoDB, index int) corev1.Service {
+	svc, err := c.GetService(types.NamespacedName{Name: mdb.ExternalServiceName(index), Namespace: mdb.Namespace})
+	assert.NoError(t, err)
+	return svc
+}
+
+// certificateFor returns a self-signed certificate valid for the hostnames, PEM encoded
+func certificateFor(t *testing.T, hostnames ...string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hostnames[0]},
+		DNSNames:     hostnames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
+}
+
+func TestValidateExternalAccess(t *testing.T) {
+	mdb := newExternalAccessReplicaSet()
+	assert.NoError(t, validateExternalAccess(mdb))
+
+	mdb.Spec.ExternalAccess.HorizonName = "__default"
+	assert.EqualError(t, validateExternalAccess(mdb), "the horizon name __default is reserved")
+
+	mdb = testutils.NewTestReplicaSet()
+	mdb.Spec.ExternalAccess = &mdbv1.ExternalAccess{Domain: "mongodb.example.com"}
+	assert.EqualError(t, validateExternalAccess(mdb), "external access requires TLS")
+}
+
+func TestCheckExternalHostnamesCertificate(t *testing.T) {
+	mdb := newExternalAccessReplicaSet()
+	assert.NoError(t, checkExternalHostnamesCertificate(mdb, certificateFor(t, "*.mongodb.example.com")))
+	assert.EqualError(t, checkExternalHostnamesCertificate(mdb, certificateFor(t, "my-rs-0.mongodb.example.com", "my-rs-1.mongodb.example.com")),
+		"the certificate isn't valid for the external hostnames my-rs-2.mongodb.example.com, add them to its subject alternative names")
+
+	mdb.Spec.ExternalAccess = nil
+	assert.NoError(t, checkExternalHostnamesCertificate(mdb, certificateFor(t, "my-rs-0.my-rs-svc.my-ns.svc.cluster.local")))
+}
+
+func TestExternalAccessModification(t *testing.T) {
+	mdb := newExternalAccessReplicaSet()
+	mdb.Spec.ExternalAccess.HorizonName = "public"
+	ac, err := buildAutomationConfig(mdb, automationconfig.MongoDbVersionConfig{}, automationconfig.AutomationConfig{}, externalAccessModification(mdb))
+	assert.NoError(t, err)
+
+	members := ac.ReplicaSets[0].Members
+	assert.Len(t, members, 3)
+	for i, hostname := range []string{"my-rs-0.mongodb.example.com:27017", "my-rs-1.mongodb.example.com:27017", "my-rs-2.mongodb.example.com:27017"} {
+		assert.Equal(t, map[string]string{"public": hostname}, members[i].Horizons)
+	}
+
+	mdb.Spec.ExternalAccess = nil
+	ac, err = buildAutomationConfig(mdb, automationconfig.MongoDbVersionConfig{}, automationconfig.AutomationConfig{}, externalAccessModification(mdb))
+	assert.NoError(t, err)
+	assert.Nil(t, ac.ReplicaSets[0].Members[0].Horizons)
+}
+
+func TestEnsureExternalAccess(t *testing.T) {
+	mdb := newExternalAccessReplicaSet()
+	mdb.Spec.ExternalAccess.Annotations = map[string]string{"service.beta.kubernetes.io/aws-load-balancer-type": "nlb"}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	assert.NoError(t, r.ensureExternalAccess(mdb))
+
+	for i := 0; i < mdb.Spec.Members; i++ {
+		svc := getExternalService(t, c, mdb, i)
+		assert.Equal(t, corev1.ServiceTypeLoadBalancer, svc.Spec.Type)
+		assert.Equal(t, mdb.ExternalHostname(i), svc.Annotations[externalDNSHostnameAnnotationKey])
+		assert.Equal(t, "nlb", svc.Annotations["service.beta.kubernetes.io/aws-load-balancer-type"])
+		assert.Equal(t, fmt.Sprintf("%s-%d", mdb.Name, i), svc.Spec.Selector[podNameLabelKey])
+		assert.Equal(t, int32(27017), svc.Spec.Ports[0].Port)
+	}
+
+	t.Run("The Services of the removed members are deleted", func(t *testing.T) {
+		mdb.Spec.Members = 1
+		assert.NoError(t, r.ensureExternalAccess(mdb))
+		getExternalService(t, c, mdb, 0)
+		_, err := c.GetService(types.NamespacedName{Name: mdb.ExternalServiceName(1), Namespace: mdb.Namespace})
+		assert.True(t, errors.IsNotFound(err))
+		_, err = c.GetService(types.NamespacedName{Name: mdb.ExternalServiceName(2), Namespace: mdb.Namespace})
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("The Services are deleted once disabled", func(t *testing.T) {
+		mdb.Spec.ExternalAccess = nil
+		assert.NoError(t, r.ensureExternalAccess(mdb))
+		_, err := c.GetService(types.NamespacedName{Name: mdb.ExternalServiceName(0), Namespace: mdb.Namespace})
+		assert.True(t, errors.IsNotFound(err))
+	})
+}
+
+func TestEnsureExternalAccess_DNSEndpoint(t *testing.T) {
+	mdb := newExternalAccessReplicaSet()
+	mdb.Spec.ExternalAccess.ExternalDNS = mdbv1.ExternalDNSEndpoint
+	mdb.Spec.ExternalAccess.ServiceType = corev1.ServiceTypeNodePort
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	assert.NoError(t, r.ensureExternalAccess(mdb))
+
+	svc := getExternalService(t, c, mdb, 0)
+	assert.Equal(t, corev1.ServiceTypeNodePort, svc.Spec.Type)
+	assert.NotContains(t, svc.Annotations, externalDNSHostnameAnnotationKey, "the hostnames are published from the DNSEndpoint")
+
+	endpoint := unstructured.Unstructured{}
+	endpoint.SetGroupVersionKind(dnsEndpointGVK)
+	assert.NoError(t, c.Get(context.TODO(), dnsEndpointNamespacedName(mdb), &endpoint))
+	endpoints, _, _ := unstructured.NestedSlice(endpoint.Object, "spec", "endpoints")
+	assert.Empty(t, endpoints, "the Services have no address yet")
+
+	t.Run("The addresses of the Services are published", func(t *testing.T) {
+		services := []corev1.Service{{}, {}, {}}
+		services[0].Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}
+		services[1].Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{Hostname: "lb-1.elb.amazonaws.com"}}
+		endpoints, _, _ := unstructured.NestedSlice(buildDNSEndpoint(mdb, services).Object, "spec", "endpoints")
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"dnsName": "my-rs-0.mongodb.example.com", "recordType": "A", "targets": []interface{}{"203.0.113.10"}},
+			map[string]interface{}{"dnsName": "my-rs-1.mongodb.example.com", "recordType": "CNAME", "targets": []interface{}{"lb-1.elb.amazonaws.com"}},
+		}, endpoints)
+	})
+
+	t.Run("The DNSEndpoint is deleted once disabled", func(t *testing.T) {
+		mdb.Spec.ExternalAccess.ExternalDNS = mdbv1.ExternalDNSNone
+		assert.NoError(t, r.ensureExternalAccess(mdb))
+		err := c.Get(context.TODO(), dnsEndpointNamespacedName(mdb), &endpoint)
+		assert.True(t, errors.IsNotFound(err))
+	})
+}
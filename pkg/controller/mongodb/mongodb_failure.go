@@ -0,0 +1,268 @@
+package mongodb
+
+import (
+	"fmt"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	reconciliationFailedEventReason       = "ReconciliationFailed"
+	referencedResourceNotFoundEventReason = "ReferencedResourceNotFound"
+
+	// the reasons of the ConfigurationValid condition
+	invalidSpecReason         = "InvalidSpec"
+	missingPrerequisiteReason = "MissingPrerequisite"
+	invalidCertificateReason  = "InvalidCertificate"
+
+	// the reason of the ReferencedResourcesFound condition is the kind of the missing resource
+	// followed by this suffix, e.g. SecretNotFound
+	notFoundReasonSuffix = "NotFound"
+
+	// transientErrorReason counts the reconciliations which failed with a transient error
+	transientErrorReason = "TransientError"
+)
+
+// transientErrorRequeueInterval is how soon a reconciliation which failed with a transient error is retried
+const transientErrorRequeueInterval = 2 * time.Second
+
+// terminalError is an error which reconciling the resource again can't resolve, only a change of
+// the resource or of one of the resources it depends on can.
+type terminalError struct {
+	reason string
+	err    error
+	// notFound is the resource referenced by the resource which doesn't exist, if any
+	notFound *referencedResource
+}
+
+// referencedResource is a resource the deployment depends on, referenced by a field of the resource
+type referencedResource struct {
+	kind         string
+	nsName       types.NamespacedName
+	referencedBy string
+}
+
+func (e terminalError) Error() string {
+	return e.err.Error()
+}
+
+// transientError is an error which is expected to resolve itself shortly, such as a write which
+// conflicted with another one. The resource is reconciled again soon, rather than with the backoff
+// of the other errors, and its phase is left unchanged.
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string {
+	return e.err.Error()
+}
+
+// isTransient returns true if the error is a transient error, or an error of the API which is
+// expected to resolve itself shortly: a conflicting write, an object created since it was read,
+// or a server too busy to answer.
+func isTransient(err error) bool {
+	if _, ok := err.(transientError); ok {
+		return true
+	}
+	return errors.IsConflict(err) || errors.IsAlreadyExists(err) || errors.IsTooManyRequests(err) ||
+		errors.IsServerTimeout(err) || errors.IsTimeout(err)
+}
+
+// wrapError returns the error prefixed with the message, which is still a transient error if the
+// error is
+func wrapError(err error, message string) error {
+	wrapped := fmt.Errorf("%s: %s", message, err)
+	if isTransient(err) {
+		return transientError{err: wrapped}
+	}
+	return wrapped
+}
+
+// invalidSpec returns a terminal error for a spec which can't be applied
+func invalidSpec(err error) error {
+	return terminalError{reason: invalidSpecReason, err: err}
+}
+
+// missingPrerequisite returns a terminal error for a resource the deployment depends on which
+// doesn't exist or is incomplete. The resource must be watched, so that the deployment is
+// reconciled again once it is fixed.
+func missingPrerequisite(format string, args ...interface{}) error {
+	return terminalError{reason: missingPrerequisiteReason, err: fmt.Errorf(format, args...)}
+}
+
+// referencedResourceNotFound returns a terminal error for a resource referenced by the given field of
+// the resource which doesn't exist. The resource must be watched, so that the deployment is reconciled
+// again once it is created. A cluster-scoped resource has no namespace.
+func referencedResourceNotFound(kind string, nsName types.NamespacedName, referencedBy string) error {
+	name := nsName.String()
+	if nsName.Namespace == "" {
+		name = nsName.Name
+	}
+	return terminalError{
+		reason:   missingPrerequisiteReason,
+		err:      fmt.Errorf(`%s "%s" referenced by %s not found`, kind, name, referencedBy),
+		notFound: &referencedResource{kind: kind, nsName: nsName, referencedBy: referencedBy},
+	}
+}
+
+// invalidCertificate returns a terminal error for a TLS certificate or key which can't be used
+func invalidCertificate(format string, args ...interface{}) error {
+	return terminalError{reason: invalidCertificateReason, err: fmt.Errorf(format, args...)}
+}
+
+// validateSpec returns a terminal error if the spec of the resource can't be applied
+func validateSpec(mdb mdbv1.MongoDB) error {
+	if err := validateStorage(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid storage configuration: %s", err))
+	}
+	if err := validateInitFrom(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.initFrom: %s", err))
+	}
+	if err := validateBootstrap(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.bootstrap: %s", err))
+	}
+	if err := validateMaintenanceWindow(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid maintenance window: %s", err))
+	}
+	if err := validateBackup(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.backup: %s", err))
+	}
+	if err := validateBackupHooks(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.backupHooks: %s", err))
+	}
+	if err := validateVersionChangeHooks(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.versionChangeHooks: %s", err))
+	}
+	if err := validateAdditionalMongodConfig(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.additionalMongodConfig: %s", err))
+	}
+	if err := validateStatefulSetConfiguration(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.statefulSet: %s", err))
+	}
+	if err := validateVault(mdb); err != nil {
+		return invalidSpec(err)
+	}
+	if err := validateExternalAccess(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.externalAccess: %s", err))
+	}
+	if err := validateMigration(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.migration: %s", err))
+	}
+	if err := validateStandby(mdb); err != nil {
+		return invalidSpec(fmt.Errorf("invalid spec.standby: %s", err))
+	}
+	return nil
+}
+
+// handleReconcileError returns the result of a reconciliation which failed with the error. A terminal
+// error sets the ConfigurationValid condition to false with its reason, the phase to Failed, emits a
+// Warning event, and the resource isn't requeued. A missing referenced resource also sets the
+// ReferencedResourcesFound condition to false, except for a missing Secret, which the resource waits
+// for, see waitForSecret. Any other error is retried, see requeueAfterError.
+func (r *ReplicaSetReconciler) handleReconcileError(mdb mdbv1.MongoDB, err error) (reconcile.Result, error) {
+	terminal, ok := err.(terminalError)
+	if !ok {
+		return reconcile.Result{}, err
+	}
+	if isWaitingForSecret(terminal) {
+		return r.waitForSecret(mdb, terminal)
+	}
+	countTerminalError(terminal)
+	if err := r.updateConfigurationValidCondition(mdb, &terminal); err != nil {
+		return reconcile.Result{}, err
+	}
+	// the resource is reconciled again once it, or the resources it depends on, are changed
+	return reconcile.Result{}, nil
+}
+
+// requeueAfterError returns the result of a reconciliation which ended with the error, once the
+// status has been updated. A transient error is retried soon without being returned, so that it isn't
+// logged by the controller as a failure, any other error is returned to be retried with the backoff
+// of the controller.
+func (r *ReplicaSetReconciler) requeueAfterError(res reconcile.Result, err error) (reconcile.Result, error) {
+	if err == nil || !isTransient(err) {
+		return res, err
+	}
+	r.log.Infof("%s, retrying in %s", err, transientErrorRequeueInterval)
+	return reconcile.Result{RequeueAfter: transientErrorRequeueInterval}, nil
+}
+
+// updateConfigurationValidCondition sets the ConfigurationValid and ReferencedResourcesFound conditions
+// of the resource for the terminal error, or to true if there is none.
+func (r *ReplicaSetReconciler) updateConfigurationValidCondition(mdb mdbv1.MongoDB, terminal *terminalError) error {
+	condition := mdbv1.Condition{Type: mdbv1.ConfigurationValid, Status: corev1.ConditionTrue}
+	if terminal != nil {
+		condition = mdbv1.Condition{
+			Type:    mdbv1.ConfigurationValid,
+			Status:  corev1.ConditionFalse,
+			Reason:  terminal.reason,
+			Message: terminal.Error(),
+		}
+	}
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	conditionChanged := isConditionChanged(newMdb.GetCondition(mdbv1.ConfigurationValid), condition)
+	referencesCondition := referencedResourcesFoundCondition(terminal)
+	previousReferencesCondition := newMdb.GetCondition(mdbv1.ReferencedResourcesFound)
+	var referencesChanged bool
+	if referencesCondition != nil {
+		referencesChanged = isConditionChanged(previousReferencesCondition, *referencesCondition)
+	} else {
+		// the missing resource reported by the condition has been found since
+		referencesChanged = previousReferencesCondition != nil && previousReferencesCondition.Status == corev1.ConditionFalse
+	}
+	stopsWaiting := terminal != nil && newMdb.GetCondition(mdbv1.WaitingForSecret) != nil
+	if !conditionChanged && !referencesChanged && !stopsWaiting && (terminal == nil || newMdb.Status.Phase == mdbv1.Failed) {
+		return nil
+	}
+	newMdb.SetCondition(condition)
+	if referencesCondition != nil {
+		newMdb.SetCondition(*referencesCondition)
+	} else if referencesChanged {
+		newMdb.RemoveCondition(mdbv1.ReferencedResourcesFound)
+	}
+	if terminal != nil {
+		// the resource can't be reconciled until it is fixed, it doesn't wait for a Secret anymore
+		newMdb.RemoveCondition(mdbv1.WaitingForSecret)
+		newMdb.Status.Phase = mdbv1.Failed
+	}
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+
+	if terminal != nil && conditionChanged && r.recorder != nil {
+		eventReason := reconciliationFailedEventReason
+		if terminal.notFound != nil {
+			eventReason = referencedResourceNotFoundEventReason
+		}
+		r.recorder.Event(newMdb, corev1.EventTypeWarning, eventReason, terminal.Error())
+	}
+	return nil
+}
+
+// referencedResourcesFoundCondition returns the ReferencedResourcesFound condition for the terminal error,
+// which names the missing resource, or nil if the terminal error doesn't tell whether the referenced
+// resources exist.
+func referencedResourcesFoundCondition(terminal *terminalError) *mdbv1.Condition {
+	if terminal == nil {
+		condition := mdbv1.Condition{Type: mdbv1.ReferencedResourcesFound, Status: corev1.ConditionTrue}
+		return &condition
+	}
+	if terminal.notFound == nil {
+		return nil
+	}
+	condition := newCondition(mdbv1.ReferencedResourcesFound, corev1.ConditionFalse, terminal.notFound.kind+notFoundReasonSuffix, terminal.Error())
+	return &condition
+}
+
+func isConditionChanged(previous *mdbv1.Condition, condition mdbv1.Condition) bool {
+	return previous == nil || previous.Status != condition.Status || previous.Reason != condition.Reason || previous.Message != condition.Message
+}
@@ -0,0 +1,149 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func assertConfigurationInvalid(t *testing.T, c client.Client, mdb mdbv1.MongoDB, reason string) {
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Failed, mdb.Status.Phase)
+	condition := mdb.GetCondition(mdbv1.ConfigurationValid)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, reason, condition.Reason)
+	}
+}
+
+func TestInvalidSpec_FailsWithoutRequeue(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.MaintenanceWindow = &mdbv1.MaintenanceWindow{Schedule: "0 2 * * 6", Duration: metav1.Duration{}}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assertConfigurationInvalid(t, c, mdb, invalidSpecReason)
+	_, err = c.GetStatefulSet(mdb.NamespacedName())
+	assert.Error(t, err, "nothing is created for an invalid spec")
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.MaintenanceWindow = nil
+	_ = c.Update(context.TODO(), &mdb)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Running, mdb.Status.Phase)
+	assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.ConfigurationValid).Status)
+}
+
+func TestMissingTLSSecret_FailsWithoutRequeue(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assertConfigurationInvalid(t, c, mdb, missingPrerequisiteReason)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.ReferencedResourcesFound, corev1.ConditionFalse, "ConfigMapNotFound")
+	assert.Equal(t, `ConfigMap "my-ns/caConfigMap" referenced by spec.security.tls.caConfigMapRef not found`, mdb.GetCondition(mdbv1.ReferencedResourcesFound).Message)
+
+	assert.NoError(t, createTLSSecretAndConfigMap(mgr.GetClient(), mdb))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.ConfigurationValid).Status)
+	assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.ReferencedResourcesFound).Status)
+}
+
+func TestHandleReconcileError_RetriesTransientErrors(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	transient := errors.New("connection refused")
+	_, err := r.handleReconcileError(mdb, transient)
+	assert.Equal(t, transient, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Nil(t, mdb.GetCondition(mdbv1.ConfigurationValid))
+}
+
+func TestIsTransient(t *testing.T) {
+	conflict := apiErrors.NewConflict(schema.GroupResource{Resource: "statefulsets"}, "my-rs", errors.New("the object has been modified"))
+	assert.True(t, isTransient(conflict))
+	assert.True(t, isTransient(wrapError(conflict, "error applying StatefulSet")), "a wrapped transient error is still transient")
+	assert.True(t, isTransient(apiErrors.NewTooManyRequests("slow down", 1)))
+	assert.False(t, isTransient(wrapError(errors.New("connection refused"), "error reading replica set status")))
+	assert.False(t, isTransient(invalidSpec(errors.New("invalid storage configuration"))))
+}
+
+func TestReconcile_ErrorsAreRetriedByKind(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	failing := &failingStatefulSetApplier{Client: r.client}
+	r.client = failing
+
+	failing.err = apiErrors.NewConflict(schema.GroupResource{Resource: "statefulsets"}, mdb.Name, errors.New("the object has been modified"))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err, "a transient error isn't returned to the controller")
+	assert.Equal(t, reconcile.Result{RequeueAfter: transientErrorRequeueInterval}, res, "a transient error is retried soon")
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Empty(t, mdb.Status.Phase, "a transient error doesn't change the phase")
+
+	failing.err = errors.New("connection refused")
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.Error(t, err, "other errors are retried with the backoff of the controller")
+	assert.Equal(t, reconcile.Result{}, res)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Pending, mdb.Status.Phase)
+
+	failing.err = nil
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Running, mdb.Status.Phase)
+}
+
+// failingStatefulSetApplier fails to apply the StatefulSets with err, if set
+type failingStatefulSetApplier struct {
+	client.Client
+	err error
+}
+
+func (c *failingStatefulSetApplier) ApplyStatefulSet(sts appsv1.StatefulSet) error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Client.ApplyStatefulSet(sts)
+}
+
+func TestInvalidTLSCertificate_FailsWithoutRequeue(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	assert.NoError(t, createTLSSecretAndConfigMapWith(mgr.GetClient(), mdb, "server.crt", "server_rotated.key"))
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assertConfigurationInvalid(t, c, mdb, invalidCertificateReason)
+}
@@ -0,0 +1,83 @@
+package mongodb
+
+import (
+	"fmt"
+	"reflect"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	rolloutAwaitingApprovalEventReason = "RolloutAwaitingApproval"
+
+	// approveRolloutAnnotationKey approves the update of the next member during a rollout with
+	// spec.gatedRollout when it is set to the member last updated. It is removed once used.
+	approveRolloutAnnotationKey = "mongodb.com/v1.approveRollout"
+)
+
+// startMemberUpdate returns true if the update of the member can start. With spec.gatedRollout,
+// the update of a member other than the one last updated waits for the approveRollout annotation
+// to be set to the member last updated, which is reported in status.rollout. The approval is used
+// up, and the member becomes the one last updated, once its update starts.
+func (r *ReplicaSetReconciler) startMemberUpdate(mdb mdbv1.MongoDB, member string) (bool, error) {
+	if !mdb.Spec.GatedRollout {
+		return true, nil
+	}
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return false, fmt.Errorf("error getting resource: %s", err)
+	}
+
+	status := newMdb.Status.Rollout
+	if status != nil && status.UpdatedMember != member && newMdb.Annotations[approveRolloutAnnotationKey] != status.UpdatedMember {
+		r.log.Infof("Waiting for approval to update member %s, member %s has been updated", member, status.UpdatedMember)
+		if status.AwaitingApproval {
+			return false, nil
+		}
+		if err := r.updateRolloutStatus(mdb, &mdbv1.RolloutStatus{UpdatedMember: status.UpdatedMember, AwaitingApproval: true}); err != nil {
+			return false, err
+		}
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, rolloutAwaitingApprovalEventReason, "Member %s has been updated, annotate the resource with %s=%s to update member %s", status.UpdatedMember, approveRolloutAnnotationKey, status.UpdatedMember, member)
+		}
+		return false, nil
+	}
+
+	if _, ok := newMdb.Annotations[approveRolloutAnnotationKey]; ok {
+		if err := r.removeAnnotation(mdb.NamespacedName(), approveRolloutAnnotationKey); err != nil {
+			return false, fmt.Errorf("error removing %s annotation: %s", approveRolloutAnnotationKey, err)
+		}
+	}
+	return true, r.updateRolloutStatus(mdb, &mdbv1.RolloutStatus{UpdatedMember: member})
+}
+
+// completeRollout clears status.rollout, and an approval which wasn't used, once there is no
+// member left to update
+func (r *ReplicaSetReconciler) completeRollout(mdb mdbv1.MongoDB) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if _, ok := newMdb.Annotations[approveRolloutAnnotationKey]; ok {
+		if err := r.removeAnnotation(mdb.NamespacedName(), approveRolloutAnnotationKey); err != nil {
+			return fmt.Errorf("error removing %s annotation: %s", approveRolloutAnnotationKey, err)
+		}
+	}
+	return r.updateRolloutStatus(mdb, nil)
+}
+
+func (r *ReplicaSetReconciler) updateRolloutStatus(mdb mdbv1.MongoDB, status *mdbv1.RolloutStatus) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if reflect.DeepEqual(newMdb.Status.Rollout, status) {
+		return nil
+	}
+	newMdb.Status.Rollout = status
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func approveRollout(t *testing.T, c client.Client, mdb mdbv1.MongoDB, member string) {
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Annotations[approveRolloutAnnotationKey] = member
+	assert.NoError(t, c.Update(context.TODO(), &mdb))
+}
+
+func isPodDeleted(c client.Client, mdb mdbv1.MongoDB, name string) bool {
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &corev1.Pod{})
+	return errors.IsNotFound(err)
+}
+
+func TestGatedRollout_WaitsForApprovalAfterEachMember(t *testing.T) {
+	restartedAt := time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC)
+	primary := 1
+	r, c, mdb := restartRequestedReplicaSet(t, &primary, restartedAt)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.GatedRollout = true
+	_ = c.Update(context.TODO(), &mdb)
+
+	reconcileRollout := func() {
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		assertRequeued(t, res)
+	}
+
+	// the first member doesn't need an approval
+	reconcileRollout()
+	assert.True(t, isPodDeleted(c, mdb, "my-rs-2"))
+	recreatePod(t, c, mdb, "my-rs-2", restartedAt.Add(time.Minute))
+
+	reconcileRollout()
+	reconcileRollout()
+	assert.False(t, isPodDeleted(c, mdb, "my-rs-0"), "the next member waits for an approval")
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, &mdbv1.RolloutStatus{UpdatedMember: "my-rs-2", AwaitingApproval: true}, mdb.Status.Rollout)
+
+	approveRollout(t, c, mdb, "my-rs-2")
+	reconcileRollout()
+	assert.True(t, isPodDeleted(c, mdb, "my-rs-0"))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.NotContains(t, mdb.Annotations, approveRolloutAnnotationKey, "the approval is used up")
+	assert.Equal(t, &mdbv1.RolloutStatus{UpdatedMember: "my-rs-0"}, mdb.Status.Rollout)
+	recreatePod(t, c, mdb, "my-rs-0", restartedAt.Add(time.Minute))
+
+	reconcileRollout()
+	assert.Equal(t, 1, primary, "the primary isn't stepped down before the approval")
+
+	approveRollout(t, c, mdb, "my-rs-0")
+	reconcileRollout()
+	assert.Equal(t, 2, primary)
+
+	// the former primary is restarted without another approval
+	reconcileRollout()
+	assert.True(t, isPodDeleted(c, mdb, "my-rs-1"))
+	recreatePod(t, c, mdb, "my-rs-1", restartedAt.Add(time.Minute))
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Nil(t, mdb.Status.Rollout)
+}
+
+func TestGatedRollout_IgnoresApprovalOfAnotherMember(t *testing.T) {
+	primary := 0
+	r, c, mdb := restartRequestedReplicaSet(t, &primary, time.Now())
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.GatedRollout = true
+	_ = c.Update(context.TODO(), &mdb)
+
+	_, _ = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	recreatePod(t, c, mdb, "my-rs-2", time.Now().Add(time.Minute))
+
+	approveRollout(t, c, mdb, "my-rs-1")
+	_, _ = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.False(t, isPodDeleted(c, mdb, "my-rs-1"))
+}
+
+func TestGatedRollout_VersionUpgrade(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Version = "4.0.6"
+	mdb.Spec.GatedRollout = true
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version, "4.2.7"))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	primary := 1
+	withHealthyReplicaSet(t, r, c, mdb, &primary)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Version = "4.2.7"
+	_ = c.Update(context.TODO(), &mdb)
+
+	for _, expected := range [][]string{
+		{"4.0.6", "4.0.6", "4.2.7"},
+		{"4.0.6", "4.0.6", "4.2.7"},
+	} {
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		ac, _ := getCurrentAutomationConfig(c, mdb)
+		assert.Equal(t, expected, processVersions(ac))
+	}
+
+	approveRollout(t, c, mdb, "my-rs-2")
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	ac, _ := getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, []string{"4.2.7", "4.0.6", "4.2.7"}, processVersions(ac))
+}
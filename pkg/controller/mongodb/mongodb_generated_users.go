@@ -0,0 +1,100 @@
+package mongodb
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scramcredentials"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/generate"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// generatedUserPasswordKey is the key of the Secrets holding the passwords generated by the
+	// operator for the users the sidecars and agents it deploys authenticate as
+	generatedUserPasswordKey = "password"
+
+	scramSha256Mechanism = "SCRAM-SHA-256"
+)
+
+// generatedUserModification returns a modification which adds the user with the roles to the
+// automation config, with the password generated in the Secret the first time. The salt of its
+// credentials in the current automation config is kept, so that they only change with the password.
+func (r ReplicaSetReconciler) generatedUserModification(mdb mdbv1.MongoDB, currentAC automationconfig.AutomationConfig, username string, roles []automationconfig.Role, passwordSecret types.NamespacedName) (automationconfig.Modification, error) {
+	password, err := r.ensureGeneratedPassword(mdb, passwordSecret)
+	if err != nil {
+		return automationconfig.NOOP(), err
+	}
+
+	var salt []byte
+	for _, u := range currentAC.Auth.Users {
+		if u.Username == username && u.Database == "admin" && u.ScramSha256Creds != nil {
+			salt, err = base64.StdEncoding.DecodeString(u.ScramSha256Creds.Salt)
+			if err != nil {
+				return automationconfig.NOOP(), fmt.Errorf("error decoding salt of user %s: %s", username, err)
+			}
+		}
+	}
+	if salt == nil {
+		generated, err := generate.RandomFixedLengthStringOfSize(sha256.Size - scramcredentials.RFC5802MandatedSaltSize)
+		if err != nil {
+			return automationconfig.NOOP(), fmt.Errorf("error generating salt: %s", err)
+		}
+		salt = []byte(generated)
+	}
+	creds, err := scramcredentials.ComputeScramSha256Creds(password, salt)
+	if err != nil {
+		return automationconfig.NOOP(), fmt.Errorf("error computing credentials of user %s: %s", username, err)
+	}
+
+	user := automationconfig.MongoDBUser{
+		Username:                   username,
+		Database:                   "admin",
+		Roles:                      roles,
+		Mechanisms:                 []string{scramSha256Mechanism},
+		AuthenticationRestrictions: []string{},
+		ScramSha256Creds:           &creds,
+	}
+	return func(ac *automationconfig.AutomationConfig) {
+		users := []automationconfig.MongoDBUser{user}
+		for _, u := range ac.Auth.Users {
+			if u.Username != user.Username || u.Database != user.Database {
+				users = append(users, u)
+			}
+		}
+		ac.Auth.Users = users
+	}, nil
+}
+
+// ensureGeneratedPassword returns the password stored in the Secret, which is generated in a Secret
+// owned by the resource if it doesn't exist yet
+func (r ReplicaSetReconciler) ensureGeneratedPassword(mdb mdbv1.MongoDB, nsName types.NamespacedName) (string, error) {
+	password, err := secret.ReadKey(r.client, generatedUserPasswordKey, nsName)
+	if err == nil {
+		return password, nil
+	}
+	if !errors.IsNotFound(err) {
+		return "", fmt.Errorf("error reading password of Secret %s: %s", nsName.Name, err)
+	}
+
+	password, err = generate.RandomFixedLengthStringOfSize(20)
+	if err != nil {
+		return "", fmt.Errorf("error generating password: %s", err)
+	}
+	s := secret.Builder().
+		SetName(nsName.Name).
+		SetNamespace(nsName.Namespace).
+		SetField(generatedUserPasswordKey, password).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
+		Build()
+	if err := r.client.CreateSecret(s); err != nil {
+		return "", fmt.Errorf("error creating Secret %s: %s", nsName.Name, err)
+	}
+	return password, nil
+}
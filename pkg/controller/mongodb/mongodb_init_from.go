@@ -0,0 +1,208 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/persistentvolumeclaim"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/versions"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	seededEventReason = "Seeded"
+
+	seedDataInitContainerName = "seed-data"
+	// seededMarkerFile is written to the data volume once it has been prepared to join the new replica set
+	seededMarkerFile = ".mongodb-seeded"
+
+	volumeSnapshotAPIGroup = "snapshot.storage.k8s.io"
+)
+
+// validateInitFrom ensures the data of a new deployment can be seeded from spec.initFrom
+func validateInitFrom(mdb mdbv1.MongoDB) error {
+	initFrom := mdb.Spec.InitFrom
+	if initFrom == nil {
+		return nil
+	}
+	if (initFrom.MongoDB == "") == (initFrom.VolumeSnapshot == "") {
+		return fmt.Errorf("exactly one of spec.initFrom.mongodb and spec.initFrom.volumeSnapshot must be set")
+	}
+	if initFrom.MongoDB == mdb.Name {
+		return fmt.Errorf("spec.initFrom.mongodb can't reference the resource itself")
+	}
+	if mdb.Spec.Storage.Ephemeral {
+		return fmt.Errorf("spec.initFrom can't be used with ephemeral storage")
+	}
+	return nil
+}
+
+// seedDataVolume creates the data volume claim of the first member of a new deployment from
+// spec.initFrom, before the StatefulSet is created, so that the StatefulSet uses it instead of
+// provisioning an empty volume. The other members perform an initial sync from the first one.
+// Nothing is done once the StatefulSet or the automation config exists.
+func (r *ReplicaSetReconciler) seedDataVolume(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.InitFrom == nil {
+		return nil
+	}
+	if _, err := r.client.GetStatefulSet(mdb.NamespacedName()); err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	if _, err := r.client.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}); err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting automation config: %s", err)
+	}
+
+	claimName := volumeClaimName(dataVolumeName, mdb.Name, 0)
+	existing := corev1.PersistentVolumeClaim{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: claimName, Namespace: mdb.Namespace}, &existing)
+	if err == nil {
+		if existing.Spec.DataSource == nil {
+			r.log.Warnf("The data volume claim %s already exists, the data of spec.initFrom is not used", claimName)
+		}
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting volume claim %s: %s", claimName, err)
+	}
+
+	dataSource, err := r.initFromDataSource(mdb)
+	if err != nil {
+		return err
+	}
+	pvc := corev1.PersistentVolumeClaim{}
+	persistentvolumeclaim.Apply(
+		volumeClaim(dataVolumeName, mdb.Spec.Storage.Data),
+		persistentvolumeclaim.WithName(claimName),
+		persistentvolumeclaim.WithDataSource(dataSource),
+	)(&pvc)
+	pvc.Namespace = mdb.Namespace
+	// the StatefulSet controller labels the claims it creates with the labels of the Pods
+	if pvc.Labels == nil {
+		pvc.Labels = map[string]string{}
+	}
+	pvc.Labels["app"] = mdb.ServiceName()
+
+	if err := r.client.Create(context.TODO(), &pvc); err != nil {
+		return fmt.Errorf("error creating volume claim %s: %s", claimName, err)
+	}
+	r.log.Infof("Created the data volume claim %s from %s %s", claimName, dataSource.Kind, dataSource.Name)
+	if r.recorder != nil {
+		r.recorder.Eventf(&mdb, corev1.EventTypeNormal, seededEventReason, "Provisioning the data volume of the first member from %s %s", dataSource.Kind, dataSource.Name)
+	}
+	return nil
+}
+
+// initFromDataSource returns the source of the data volume of the first member
+func (r *ReplicaSetReconciler) initFromDataSource(mdb mdbv1.MongoDB) (*corev1.TypedLocalObjectReference, error) {
+	if mdb.Spec.InitFrom.VolumeSnapshot != "" {
+		apiGroup := volumeSnapshotAPIGroup
+		return &corev1.TypedLocalObjectReference{APIGroup: &apiGroup, Kind: "VolumeSnapshot", Name: mdb.Spec.InitFrom.VolumeSnapshot}, nil
+	}
+
+	source := mdbv1.MongoDB{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: mdb.Spec.InitFrom.MongoDB, Namespace: mdb.Namespace}, &source); err != nil {
+		return nil, fmt.Errorf("error getting MongoDB resource %s to initialize from: %s", mdb.Spec.InitFrom.MongoDB, err)
+	}
+	if err := validateInitFromSource(mdb, source); err != nil {
+		return nil, invalidSpec(err)
+	}
+	sourceClaimName := volumeClaimName(dataVolumeName, source.Name, 0)
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: sourceClaimName, Namespace: mdb.Namespace}, &corev1.PersistentVolumeClaim{}); err != nil {
+		return nil, fmt.Errorf("error getting volume claim %s to clone: %s", sourceClaimName, err)
+	}
+	return &corev1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: sourceClaimName}, nil
+}
+
+// validateInitFromSource returns an error if the data volume of the source MongoDB resource can't be
+// used by the members of the new deployment.
+func validateInitFromSource(mdb, source mdbv1.MongoDB) error {
+	if source.Spec.Storage.Ephemeral {
+		return fmt.Errorf("MongoDB resource %s uses ephemeral storage and can't be cloned", source.Name)
+	}
+	// the data files of a running member are only consistent with their journal
+	if source.Spec.Storage.Journal != nil {
+		return fmt.Errorf("MongoDB resource %s stores its journal on a separate volume and can't be cloned", source.Name)
+	}
+	version, err := versions.Parse(mdb.Spec.Version)
+	if err != nil {
+		return err
+	}
+	sourceVersion, err := versions.Parse(source.Spec.Version)
+	if err != nil {
+		return err
+	}
+	if version.MajorMinor() != sourceVersion.MajorMinor() {
+		return fmt.Errorf("MongoDB resource %s runs MongoDB %s, the clone must run the same release series", source.Name, sourceVersion.MajorMinor())
+	}
+
+	size, err := storageRequests(mdb.Spec.Storage.Data)
+	if err != nil {
+		return err
+	}
+	sourceSize, err := storageRequests(source.Spec.Storage.Data)
+	if err != nil {
+		return err
+	}
+	sourceStorage := sourceSize[corev1.ResourceStorage]
+	if storage := size[corev1.ResourceStorage]; storage.Cmp(sourceStorage) < 0 {
+		return fmt.Errorf("the data volume must be at least as large as the one of MongoDB resource %s, %s", source.Name, sourceStorage.String())
+	}
+	return nil
+}
+
+// buildInitFromStatefulSetModification adds the init container preparing a seeded data volume to join
+// the new replica set. The replica set configuration and the oplog of the source are dropped from the
+// local database before the first start, and a marker file is written so that it is only done once.
+// Empty volumes are only marked.
+func buildInitFromStatefulSetModification(mdb mdbv1.MongoDB) statefulset.Modification {
+	if mdb.Spec.InitFrom == nil {
+		return statefulset.NOOP()
+	}
+	dataVolumeMount := statefulset.CreateVolumeMount(dataVolumeName, dataPath(mdb))
+	return statefulset.WithPodSpecTemplate(
+		podtemplatespec.WithInitContainer(seedDataInitContainerName, container.Apply(
+			container.WithName(seedDataInitContainerName),
+			container.WithImage(fmt.Sprintf("mongo:%s", mdb.Spec.Version)),
+			container.WithCommand([]string{"/bin/sh", "-c", seedDataCommand(dataPath(mdb))}),
+			container.WithVolumeMounts([]corev1.VolumeMount{dataVolumeMount}),
+		)),
+	)
+}
+
+// seedDataCommand returns the script removing the replica set configuration of the source from the
+// data files in the directory, by starting a standalone mongod on a local port.
+func seedDataCommand(dataPath string) string {
+	return fmt.Sprintf(`
+set -e
+if [ -f %[1]s/%[2]s ]; then exit 0; fi
+
+if [ -f %[1]s/WiredTiger ]; then
+  mongod --dbpath %[1]s --port 27099 --bind_ip 127.0.0.1 --fork --logpath /tmp/seed-data.log
+  shell=$(command -v mongo || command -v mongosh)
+  $shell --port 27099 --quiet --eval 'db.getSiblingDB("local").dropDatabase()'
+  mongod --dbpath %[1]s --shutdown
+fi
+
+touch %[1]s/%[2]s
+`, dataPath, seededMarkerFile)
+}
+
+// initialMembers returns the number of members a new replica set is created with. A replica set
+// seeded from spec.initFrom starts with the first member only, which holds the data, and the other
+// members are then added one at a time and perform an initial sync from it.
+func initialMembers(mdb mdbv1.MongoDB) int {
+	if mdb.Spec.InitFrom != nil {
+		return 1
+	}
+	return mdb.Spec.Members
+}
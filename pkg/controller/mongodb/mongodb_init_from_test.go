@@ -0,0 +1,129 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newClonedReplicaSet(initFrom mdbv1.InitFrom) mdbv1.MongoDB {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.InitFrom = &initFrom
+	return mdb
+}
+
+func TestInitFromMongoDB(t *testing.T) {
+	mdb := newClonedReplicaSet(mdbv1.InitFrom{MongoDB: "production"})
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	source := testutils.NewTestReplicaSet()
+	source.Name = "production"
+	assert.NoError(t, mgrClient.Create(context.TODO(), &source))
+	createDataVolumeClaims(t, mgrClient, source, "10G")
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	pvc := corev1.PersistentVolumeClaim{}
+	assert.NoError(t, mgrClient.Get(context.TODO(), types.NamespacedName{Name: "data-volume-my-rs-0", Namespace: mdb.Namespace}, &pvc))
+	assert.Equal(t, &corev1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "data-volume-production-0"}, pvc.Spec.DataSource)
+	assert.Equal(t, mdb.ServiceName(), pvc.Labels["app"])
+
+	// the replica set starts with the member holding the data only
+	ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+	assert.NoError(t, err)
+	assert.Len(t, ac.Processes, 1)
+
+	sts := appsv1.StatefulSet{}
+	assert.NoError(t, mgrClient.Get(context.TODO(), mdb.NamespacedName(), &sts))
+	assert.Equal(t, int32(1), *sts.Spec.Replicas)
+	assert.Len(t, sts.Spec.Template.Spec.InitContainers, 2)
+	assert.Equal(t, seedDataInitContainerName, sts.Spec.Template.Spec.InitContainers[1].Name)
+	assert.Equal(t, "mongo:4.2.2", sts.Spec.Template.Spec.InitContainers[1].Image)
+}
+
+func TestInitFromVolumeSnapshot(t *testing.T) {
+	mdb := newClonedReplicaSet(mdbv1.InitFrom{VolumeSnapshot: "production-snapshot"})
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	pvc := corev1.PersistentVolumeClaim{}
+	assert.NoError(t, mgrClient.Get(context.TODO(), types.NamespacedName{Name: "data-volume-my-rs-0", Namespace: mdb.Namespace}, &pvc))
+	assert.Equal(t, "VolumeSnapshot", pvc.Spec.DataSource.Kind)
+	assert.Equal(t, "production-snapshot", pvc.Spec.DataSource.Name)
+	assert.Equal(t, volumeSnapshotAPIGroup, *pvc.Spec.DataSource.APIGroup)
+
+	// the other members can't be created before the volume claim of the first one
+	assert.Error(t, mgrClient.Get(context.TODO(), types.NamespacedName{Name: "data-volume-my-rs-1", Namespace: mdb.Namespace}, &corev1.PersistentVolumeClaim{}))
+}
+
+func TestInitFrom_IsIgnoredOnceCreated(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	assert.NoError(t, mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb))
+	mdb.Spec.InitFrom = &mdbv1.InitFrom{VolumeSnapshot: "production-snapshot"}
+	assert.NoError(t, mgrClient.Update(context.TODO(), &mdb))
+
+	assert.NoError(t, r.seedDataVolume(mdb))
+	assert.Error(t, mgrClient.Get(context.TODO(), types.NamespacedName{Name: "data-volume-my-rs-0", Namespace: mdb.Namespace}, &corev1.PersistentVolumeClaim{}))
+}
+
+func TestValidateInitFrom(t *testing.T) {
+	assert.NoError(t, validateInitFrom(testutils.NewTestReplicaSet()))
+	assert.NoError(t, validateInitFrom(newClonedReplicaSet(mdbv1.InitFrom{MongoDB: "production"})))
+	assert.Error(t, validateInitFrom(newClonedReplicaSet(mdbv1.InitFrom{})))
+	assert.Error(t, validateInitFrom(newClonedReplicaSet(mdbv1.InitFrom{MongoDB: "production", VolumeSnapshot: "snapshot"})))
+	assert.Error(t, validateInitFrom(newClonedReplicaSet(mdbv1.InitFrom{MongoDB: "my-rs"})))
+
+	ephemeral := newClonedReplicaSet(mdbv1.InitFrom{VolumeSnapshot: "snapshot"})
+	ephemeral.Spec.Storage.Ephemeral = true
+	assert.Error(t, validateInitFrom(ephemeral))
+}
+
+func TestValidateInitFromSource(t *testing.T) {
+	mdb := newClonedReplicaSet(mdbv1.InitFrom{MongoDB: "production"})
+	source := testutils.NewTestReplicaSet()
+	source.Name = "production"
+	assert.NoError(t, validateInitFromSource(mdb, source))
+
+	source.Spec.Version = "4.0.6"
+	assert.Error(t, validateInitFromSource(mdb, source))
+
+	source = testutils.NewTestReplicaSet()
+	source.Spec.Storage.Data.Size = "100Gi"
+	mdb.Spec.Storage.Data.Size = "10Gi"
+	err := validateInitFromSource(mdb, source)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "100Gi")
+
+	source = testutils.NewTestReplicaSet()
+	source.Spec.Storage.Journal = &mdbv1.VolumeClaim{Size: "1Gi"}
+	mdb.Spec.Storage.Data.Size = ""
+	assert.Error(t, validateInitFromSource(mdb, source))
+}
+
+func TestSeedDataCommand(t *testing.T) {
+	command := seedDataCommand("/data")
+	assert.Contains(t, command, "if [ -f /data/.mongodb-seeded ]; then exit 0; fi")
+	assert.Contains(t, command, `db.getSiblingDB("local").dropDatabase()`)
+	assert.Contains(t, command, "mongod --dbpath /data --shutdown")
+}
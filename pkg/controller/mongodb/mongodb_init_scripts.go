@@ -0,0 +1,169 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	initScriptsEventReason       = "InitScripts"
+	initScriptsFailedEventReason = "InitScriptsFailed"
+
+	initScriptsPath = "/scripts"
+)
+
+// initScriptsStep runs the scripts of the ConfigMaps of spec.initScripts once the replica set is
+// healthy, one ConfigMap at a time with a Job, in order. The scripts of a ConfigMap are only run
+// once, and the ConfigMaps after one whose scripts failed aren't run, as they may depend on them.
+// It returns true once there are no scripts left to run.
+func (r *ReplicaSetReconciler) initScriptsStep(mdb mdbv1.MongoDB) (bool, error) {
+	if len(mdb.Spec.InitScripts) == 0 {
+		return true, nil
+	}
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return false, fmt.Errorf("error getting resource: %s", err)
+	}
+	statuses := map[string]mdbv1.InitScriptStatus{}
+	for _, status := range newMdb.Status.InitScripts {
+		statuses[status.ConfigMapName] = status
+	}
+
+	for _, script := range mdb.Spec.InitScripts {
+		switch statuses[script.ConfigMapName].Phase {
+		case mdbv1.InitScriptCompleted:
+			continue
+		case mdbv1.InitScriptFailed:
+			return true, nil
+		}
+
+		job := batchv1.Job{}
+		err := r.client.Get(context.TODO(), initScriptsJobNamespacedName(mdb, script), &job)
+		if errors.IsNotFound(err) {
+			if _, err := r.client.GetConfigMap(types.NamespacedName{Name: script.ConfigMapName, Namespace: mdb.Namespace}); err != nil {
+				return false, fmt.Errorf("error getting ConfigMap %s of spec.initScripts: %s", script.ConfigMapName, err)
+			}
+			job = buildInitScriptsJob(mdb, script)
+			if err := r.client.Create(context.TODO(), &job); err != nil {
+				return false, fmt.Errorf("error creating init scripts job: %s", err)
+			}
+			r.log.Infof("Running the scripts of ConfigMap %s", script.ConfigMapName)
+			r.recordInitScriptsEvent(mdb, corev1.EventTypeNormal, initScriptsEventReason, fmt.Sprintf("Running the scripts of ConfigMap %s with Job %s", script.ConfigMapName, job.Name))
+			return false, r.setInitScriptStatus(mdb, mdbv1.InitScriptStatus{ConfigMapName: script.ConfigMapName, Phase: mdbv1.InitScriptRunning})
+		}
+		if err != nil {
+			return false, fmt.Errorf("error getting init scripts job: %s", err)
+		}
+
+		if job.Status.Succeeded > 0 {
+			r.log.Infof("Ran the scripts of ConfigMap %s", script.ConfigMapName)
+			r.recordInitScriptsEvent(mdb, corev1.EventTypeNormal, initScriptsEventReason, fmt.Sprintf("Ran the scripts of ConfigMap %s", script.ConfigMapName))
+			if err := r.setInitScriptStatus(mdb, mdbv1.InitScriptStatus{ConfigMapName: script.ConfigMapName, Phase: mdbv1.InitScriptCompleted}); err != nil {
+				return false, err
+			}
+			continue
+		}
+		for _, condition := range job.Status.Conditions {
+			if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+				message := fmt.Sprintf("Job %s failed: %s", job.Name, condition.Message)
+				r.log.Warnf("Error running the scripts of ConfigMap %s: %s", script.ConfigMapName, message)
+				r.recordInitScriptsEvent(mdb, corev1.EventTypeWarning, initScriptsFailedEventReason, message)
+				return true, r.setInitScriptStatus(mdb, mdbv1.InitScriptStatus{ConfigMapName: script.ConfigMapName, Phase: mdbv1.InitScriptFailed, Message: message})
+			}
+		}
+		return false, r.setInitScriptStatus(mdb, mdbv1.InitScriptStatus{ConfigMapName: script.ConfigMapName, Phase: mdbv1.InitScriptRunning})
+	}
+	return true, nil
+}
+
+func initScriptsJobNamespacedName(mdb mdbv1.MongoDB, script mdbv1.InitScript) types.NamespacedName {
+	return types.NamespacedName{Name: fmt.Sprintf("%s-init-%s", mdb.Name, script.ConfigMapName), Namespace: mdb.Namespace}
+}
+
+// buildInitScriptsJob returns the Job running the scripts of the ConfigMap with the mongo shell, in the
+// order of their keys. The scripts may not be idempotent, so the Job isn't retried.
+func buildInitScriptsJob(mdb mdbv1.MongoDB, script mdbv1.InitScript) batchv1.Job {
+	scriptsVolume := statefulset.CreateVolumeFromConfigMap("scripts", script.ConfigMapName)
+	scriptsVolumeMount := statefulset.CreateVolumeMount(scriptsVolume.Name, initScriptsPath, statefulset.WithReadOnly(true))
+
+	uri, connectionOptions, connection := mongoToolConnection(mdb, "init-scripts")
+	command := fmt.Sprintf(`
+set -e
+shell=$(command -v mongo || command -v mongosh)
+for script in $(ls %[1]s | sort); do
+  echo "Running $script"
+  $shell "%[2]s"%[3]s --quiet %[1]s/$script
+done
+`, initScriptsPath, uri, connectionOptions)
+
+	backoffLimit := int32(0)
+	labels := map[string]string{"app": mdb.Name + "-init-scripts"}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		podtemplatespec.WithVolume(scriptsVolume),
+		podtemplatespec.WithContainer("init-scripts", container.Apply(
+			container.WithName("init-scripts"),
+			container.WithImage(fmt.Sprintf("mongo:%s", mdb.Spec.Version)),
+			container.WithCommand([]string{"/bin/sh", "-c", command}),
+			container.WithVolumeMounts([]corev1.VolumeMount{scriptsVolumeMount}),
+		)),
+		connection,
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            initScriptsJobNamespacedName(mdb, script).Name,
+			Namespace:       mdb.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}
+}
+
+// setInitScriptStatus sets the status of the scripts of a ConfigMap of spec.initScripts
+func (r *ReplicaSetReconciler) setInitScriptStatus(mdb mdbv1.MongoDB, status mdbv1.InitScriptStatus) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	found := false
+	for i, existing := range newMdb.Status.InitScripts {
+		if existing.ConfigMapName != status.ConfigMapName {
+			continue
+		}
+		if existing == status {
+			return nil
+		}
+		newMdb.Status.InitScripts[i] = status
+		found = true
+	}
+	if !found {
+		newMdb.Status.InitScripts = append(newMdb.Status.InitScripts, status)
+	}
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
+
+func (r *ReplicaSetReconciler) recordInitScriptsEvent(mdb mdbv1.MongoDB, eventType, reason, message string) {
+	if r.recorder != nil {
+		r.recorder.Event(&mdb, eventType, reason, message)
+	}
+}
@@ -0,0 +1,120 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newInitScriptsReplicaSet(configMapNames ...string) mdbv1.MongoDB {
+	mdb := testutils.NewTestReplicaSet()
+	for _, name := range configMapNames {
+		mdb.Spec.InitScripts = append(mdb.Spec.InitScripts, mdbv1.InitScript{ConfigMapName: name})
+	}
+	return mdb
+}
+
+func createInitScriptsConfigMap(t *testing.T, c client.Client, mdb mdbv1.MongoDB, name string) {
+	assert.NoError(t, c.CreateConfigMap(configmap.Builder().
+		SetName(name).
+		SetNamespace(mdb.Namespace).
+		SetField("01-indexes.js", `db.getSiblingDB("app").orders.createIndex({customerId: 1})`).
+		Build()))
+}
+
+func getInitScriptsStatus(t *testing.T, c client.Client, mdb mdbv1.MongoDB) []mdbv1.InitScriptStatus {
+	assert.NoError(t, c.Get(context.TODO(), mdb.NamespacedName(), &mdb))
+	return mdb.Status.InitScripts
+}
+
+func completeJob(t *testing.T, c client.Client, job batchv1.Job) {
+	job.Status.Succeeded = 1
+	assert.NoError(t, c.Update(context.TODO(), &job))
+}
+
+func TestInitScripts(t *testing.T) {
+	mdb := newInitScriptsReplicaSet("indexes", "reference-data")
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	createInitScriptsConfigMap(t, mgrClient, mdb, "indexes")
+	createInitScriptsConfigMap(t, mgrClient, mdb, "reference-data")
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assert.Equal(t, []mdbv1.InitScriptStatus{{ConfigMapName: "indexes", Phase: mdbv1.InitScriptRunning}}, getInitScriptsStatus(t, mgrClient, mdb))
+
+	job := batchv1.Job{}
+	assert.NoError(t, mgrClient.Get(context.TODO(), initScriptsJobNamespacedName(mdb, mdb.Spec.InitScripts[0]), &job))
+	assert.Equal(t, "my-rs-init-indexes", job.Name)
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+	assert.Equal(t, "indexes", job.Spec.Template.Spec.Volumes[0].ConfigMap.Name)
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Command[2], `$shell "mongodb://my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017,`)
+
+	// the scripts of the next ConfigMap are run once the previous ones completed
+	completeJob(t, mgrClient, job)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assert.Equal(t, []mdbv1.InitScriptStatus{
+		{ConfigMapName: "indexes", Phase: mdbv1.InitScriptCompleted},
+		{ConfigMapName: "reference-data", Phase: mdbv1.InitScriptRunning},
+	}, getInitScriptsStatus(t, mgrClient, mdb))
+
+	assert.NoError(t, mgrClient.Get(context.TODO(), initScriptsJobNamespacedName(mdb, mdb.Spec.InitScripts[1]), &job))
+	completeJob(t, mgrClient, job)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Equal(t, mdbv1.InitScriptCompleted, getInitScriptsStatus(t, mgrClient, mdb)[1].Phase)
+
+	// the scripts are only run once
+	assert.NoError(t, mgrClient.Delete(context.TODO(), &job))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Error(t, mgrClient.Get(context.TODO(), initScriptsJobNamespacedName(mdb, mdb.Spec.InitScripts[1]), &batchv1.Job{}))
+}
+
+func TestInitScripts_FailedScriptsStopTheNextOnes(t *testing.T) {
+	mdb := newInitScriptsReplicaSet("indexes", "reference-data")
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	createInitScriptsConfigMap(t, mgrClient, mdb, "indexes")
+	createInitScriptsConfigMap(t, mgrClient, mdb, "reference-data")
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	job := batchv1.Job{}
+	assert.NoError(t, mgrClient.Get(context.TODO(), initScriptsJobNamespacedName(mdb, mdb.Spec.InitScripts[0]), &job))
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}
+	assert.NoError(t, mgrClient.Update(context.TODO(), &job))
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Equal(t, []mdbv1.InitScriptStatus{{
+		ConfigMapName: "indexes",
+		Phase:         mdbv1.InitScriptFailed,
+		Message:       "Job my-rs-init-indexes failed: Job has reached the specified backoff limit",
+	}}, getInitScriptsStatus(t, mgrClient, mdb))
+	assert.Error(t, mgrClient.Get(context.TODO(), initScriptsJobNamespacedName(mdb, mdb.Spec.InitScripts[1]), &batchv1.Job{}))
+}
+
+func TestInitScripts_MissingConfigMap(t *testing.T) {
+	mdb := newInitScriptsReplicaSet("indexes")
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ConfigMap indexes")
+}
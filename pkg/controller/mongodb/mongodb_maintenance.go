@@ -0,0 +1,189 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/cron"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// validateMaintenanceWindow returns an error if the maintenance window can't be parsed
+func validateMaintenanceWindow(mdb mdbv1.MongoDB) error {
+	window := mdb.Spec.MaintenanceWindow
+	if window == nil {
+		return nil
+	}
+	if _, err := cron.Parse(window.Schedule); err != nil {
+		return fmt.Errorf("invalid maintenance window schedule: %s", err)
+	}
+	if window.Duration.Duration <= 0 {
+		return fmt.Errorf("the maintenance window duration must be positive, got %s", window.Duration.Duration)
+	}
+	return nil
+}
+
+// maintenanceWindowState returns true if the given time is within a maintenance window, or if
+// there is no maintenance window, and otherwise the start of the next window, if any.
+func maintenanceWindowState(window *mdbv1.MaintenanceWindow, now time.Time) (bool, time.Time) {
+	if window == nil {
+		return true, time.Time{}
+	}
+	schedule, err := cron.Parse(window.Schedule)
+	if err != nil {
+		// the window is validated before being used
+		return true, time.Time{}
+	}
+	start := schedule.Next(now.Add(-window.Duration.Duration))
+	if !start.IsZero() && !start.After(now) {
+		return true, time.Time{}
+	}
+	return false, start
+}
+
+// deferDisruptiveChanges returns the resource to reconcile without the disruptive changes which
+// must wait for the next maintenance window: a version change or a change of the resources which
+// hasn't started yet is reverted to the last configuration, and a rolling restart which hasn't
+// started yet is cancelled. The changes to the Pod template of the StatefulSet, which would restart the
+// members, are deferred by statefulSetModification. The pending changes are reported in
+// status.pendingMaintenance, and the start of the next window is returned if any change is pending.
+func (r *ReplicaSetReconciler) deferDisruptiveChanges(mdb mdbv1.MongoDB) (mdbv1.MongoDB, time.Time, error) {
+	inWindow, nextWindow := maintenanceWindowState(mdb.Spec.MaintenanceWindow, r.now())
+
+	var pending []string
+	if !inWindow {
+		isStarted, err := r.isVersionChangeStarted(mdb)
+		if err != nil {
+			return mdb, time.Time{}, err
+		}
+		if isChangingVersion(mdb) && !isStarted {
+			pending = append(pending, fmt.Sprintf("change of version from %s to %s", mdb.Annotations[lastVersionAnnotationKey], mdb.Spec.Version))
+			mdb.Spec.Version = mdb.Annotations[lastVersionAnnotationKey]
+		}
+
+		isResizeStarted, err := r.isResizeStarted(mdb)
+		if err != nil {
+			return mdb, time.Time{}, err
+		}
+		if isChangingResources(mdb) && !isResizeStarted {
+			resources, err := lastResources(mdb)
+			if err != nil {
+				return mdb, time.Time{}, err
+			}
+			pending = append(pending, "change of the resources of the containers")
+			mdb.Spec.Resources = resources
+		}
+
+		toRestart, err := r.membersToRestart(mdb)
+		if err != nil {
+			return mdb, time.Time{}, err
+		}
+		// a rolling restart which has started is completed
+		if len(toRestart) > 0 && len(toRestart) == mdb.Spec.Members {
+			pending = append(pending, fmt.Sprintf("rolling restart requested at %s", restartRequestedAt(mdb).UTC().Format(time.RFC3339)))
+			mdb.Spec.RestartedAt = nil
+			annotations := map[string]string{}
+			for key, val := range mdb.Annotations {
+				if key != dependentResourcesChangedAtAnnotationKey {
+					annotations[key] = val
+				}
+			}
+			mdb.Annotations = annotations
+		}
+
+		hasTemplateChange, err := r.hasPendingPodTemplateChange(mdb)
+		if err != nil {
+			return mdb, time.Time{}, err
+		}
+		if hasTemplateChange {
+			pending = append(pending, "rolling restart of the members to apply the changes to their Pods")
+		}
+	}
+
+	if err := r.updatePendingMaintenanceStatus(mdb, pending, nextWindow); err != nil {
+		return mdb, time.Time{}, err
+	}
+	if len(pending) == 0 {
+		return mdb, time.Time{}, nil
+	}
+	r.log.Infof("Deferring until the next maintenance window: %v", pending)
+	return mdb, nextWindow, nil
+}
+
+// isVersionChangeStarted returns true if any process of the current automation config runs
+// spec.version already, in which case the version change must be completed.
+func (r *ReplicaSetReconciler) isVersionChangeStarted(mdb mdbv1.MongoDB) (bool, error) {
+	ac, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return false, fmt.Errorf("error reading automation config: %s", err)
+	}
+	for _, p := range ac.Processes {
+		if p.Version == mdb.Spec.Version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hasPendingPodTemplateChange returns true if the Pod template of the existing StatefulSet
+// differs from the one described by the resource.
+func (r *ReplicaSetReconciler) hasPendingPodTemplateChange(mdb mdbv1.MongoDB) (bool, error) {
+	sts := appsv1.StatefulSet{}
+	if err := r.client.Get(context.TODO(), mdb.NamespacedName(), &sts); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	desired := sts.DeepCopy()
+	buildStatefulSetModificationFunction(mdb)(desired)
+	return !equality.Semantic.DeepEqual(sts.Spec.Template, desired.Spec.Template), nil
+}
+
+// statefulSetModification returns the modification of the StatefulSet described by the resource.
+// Outside of the maintenance window, the Pod template of an existing StatefulSet is kept as is.
+func (r *ReplicaSetReconciler) statefulSetModification(mdb mdbv1.MongoDB) statefulset.Modification {
+	modification := buildStatefulSetModificationFunction(mdb)
+	if inWindow, _ := maintenanceWindowState(mdb.Spec.MaintenanceWindow, r.now()); inWindow {
+		return modification
+	}
+	return func(sts *appsv1.StatefulSet) {
+		if sts.Name == "" {
+			modification(sts)
+			return
+		}
+		template := sts.Spec.Template.DeepCopy()
+		modification(sts)
+		sts.Spec.Template = *template
+	}
+}
+
+func (r *ReplicaSetReconciler) updatePendingMaintenanceStatus(mdb mdbv1.MongoDB, pending []string, nextWindow time.Time) error {
+	var status *mdbv1.PendingMaintenanceStatus
+	if len(pending) > 0 {
+		status = &mdbv1.PendingMaintenanceStatus{Changes: pending}
+		if !nextWindow.IsZero() {
+			status.NextWindow = &metav1.Time{Time: nextWindow}
+		}
+	}
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if reflect.DeepEqual(newMdb.Status.PendingMaintenance, status) {
+		return nil
+	}
+	newMdb.Status.PendingMaintenance = status
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
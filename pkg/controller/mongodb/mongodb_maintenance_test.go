@@ -0,0 +1,134 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	// saturdayWindow opens every Saturday at 2am for 4 hours
+	saturdayWindow = &mdbv1.MaintenanceWindow{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+	friday         = time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC)
+	saturday       = time.Date(2020, 6, 6, 2, 0, 0, 0, time.UTC)
+)
+
+func TestMaintenanceWindowState(t *testing.T) {
+	inWindow, next := maintenanceWindowState(nil, friday)
+	assert.True(t, inWindow)
+	assert.True(t, next.IsZero())
+
+	inWindow, next = maintenanceWindowState(saturdayWindow, friday)
+	assert.False(t, inWindow)
+	assert.Equal(t, saturday, next)
+
+	inWindow, _ = maintenanceWindowState(saturdayWindow, saturday)
+	assert.True(t, inWindow)
+	inWindow, _ = maintenanceWindowState(saturdayWindow, saturday.Add(4*time.Hour-time.Second))
+	assert.True(t, inWindow)
+
+	inWindow, next = maintenanceWindowState(saturdayWindow, saturday.Add(4*time.Hour))
+	assert.False(t, inWindow)
+	assert.Equal(t, saturday.Add(7*24*time.Hour), next)
+}
+
+func TestValidateMaintenanceWindow(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	assert.NoError(t, validateMaintenanceWindow(mdb))
+
+	mdb.Spec.MaintenanceWindow = saturdayWindow
+	assert.NoError(t, validateMaintenanceWindow(mdb))
+
+	mdb.Spec.MaintenanceWindow = &mdbv1.MaintenanceWindow{Schedule: "0 2 * *", Duration: metav1.Duration{Duration: time.Hour}}
+	assert.Error(t, validateMaintenanceWindow(mdb))
+
+	mdb.Spec.MaintenanceWindow = &mdbv1.MaintenanceWindow{Schedule: "0 2 * * 6"}
+	assert.Error(t, validateMaintenanceWindow(mdb))
+}
+
+func TestVersionChange_IsDeferredUntilMaintenanceWindow(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.MaintenanceWindow = saturdayWindow
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version, "4.2.3"))
+	r.now = func() time.Time { return friday }
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	primary := 0
+	withHealthyReplicaSet(t, r, mgrClient, mdb, &primary)
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Version = "4.2.3"
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, saturday.Sub(friday), res.RequeueAfter, "the resource is reconciled again when the window opens")
+
+	ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "4.2.2", p.Version)
+	}
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, appsv1.RollingUpdateStatefulSetStrategyType, sts.Spec.UpdateStrategy.Type)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Running, mdb.Status.Phase)
+	if assert.NotNil(t, mdb.Status.PendingMaintenance) {
+		assert.Equal(t, []string{"change of version from 4.2.2 to 4.2.3"}, mdb.Status.PendingMaintenance.Changes)
+		assert.Equal(t, saturday, mdb.Status.PendingMaintenance.NextWindow.UTC())
+	}
+
+	// the upgrade starts once the window opens
+	r.now = func() time.Time { return saturday.Add(30 * time.Minute) }
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+
+	sts, err = mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, appsv1.OnDeleteStatefulSetStrategyType, sts.Spec.UpdateStrategy.Type)
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Nil(t, mdb.Status.PendingMaintenance)
+
+	// an upgrade which has started is completed after the window closes
+	r.now = func() time.Time { return saturday.Add(5 * time.Hour) }
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Nil(t, mdb.Status.PendingMaintenance)
+}
+
+func TestStatefulSetModification_KeepsPodTemplateOutsideOfMaintenanceWindow(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.MaintenanceWindow = saturdayWindow
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	sts := appsv1.StatefulSet{}
+	r.now = func() time.Time { return friday }
+	r.statefulSetModification(mdb)(&sts)
+	assert.NotEmpty(t, sts.Spec.Template.Spec.Containers, "a new StatefulSet is created with its Pod template")
+	existingTemplate := sts.Spec.Template.DeepCopy()
+
+	mdb.Spec.Version = "4.2.3"
+	mdb.Spec.Members = 5
+	r.statefulSetModification(mdb)(&sts)
+	assert.Equal(t, *existingTemplate, sts.Spec.Template)
+	assert.Equal(t, int32(5), *sts.Spec.Replicas, "the changes other than the Pod template are applied")
+
+	r.now = func() time.Time { return saturday }
+	r.statefulSetModification(mdb)(&sts)
+	assert.NotEqual(t, *existingTemplate, sts.Spec.Template)
+}
@@ -0,0 +1,212 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// healthCheckInterval is the interval at which the state of the members of every replica set is read
+// and its drift detected, independently of the changes to the resources
+var healthCheckInterval = 30 * time.Second
+
+// SetHealthCheckInterval sets the interval at which the state of the members of every replica set is
+// read and its drift detected, zero disables it. It must be called before the controllers are added to
+// the Manager.
+func SetHealthCheckInterval(interval time.Duration) {
+	healthCheckInterval = interval
+}
+
+// memberStatePoller periodically reads the replica set state of the members of every running replica set,
+// records it in status.members of the resource, and detects the drift of the replica set from its
+// automation config. It only refreshes the status, the resources with work in progress, such as a
+// drift to repair, backups, a migration or the restores of a standby, are reconciled instead, so
+// that the Jobs and the status they own are only written by the reconciliations. It uses its own
+// reconciler, so that it doesn't share the state of the reconciliation in progress.
+type memberStatePoller struct {
+	r        *ReplicaSetReconciler
+	interval time.Duration
+	// reconcileRequests is the source of the reconciliations triggered by the poller
+	reconcileRequests chan<- event.GenericEvent
+}
+
+// Start polls the replica sets until the stop channel is closed, it implements manager.Runnable
+func (p memberStatePoller) Start(stop <-chan struct{}) error {
+	wait.Until(func() { p.pollAll(stop) }, p.interval, stop)
+	return nil
+}
+
+func (p memberStatePoller) pollAll(stop <-chan struct{}) {
+	mdbList, err := listSelectedResources(p.r.client, p.r.selector)
+	if err != nil {
+		zap.S().Warnf("Error listing MongoDB resources: %s", err)
+		return
+	}
+	for _, mdb := range mdbList.Items {
+		p.r.log = zap.S().With("namespace", mdb.Namespace, "name", mdb.Name)
+		if err := p.r.updateMemberStates(mdb); err != nil {
+			// the members can't be reached while the replica set is starting or is unhealthy
+			p.r.log.Debugf("Error reading the state of the members: %s", err)
+		}
+		if err := p.r.detectDrift(mdb); err != nil {
+			p.r.log.Debugf("Error detecting drift from the automation config: %s", err)
+		}
+
+		newMdb, err := p.r.getResource(mdb.NamespacedName())
+		if err != nil {
+			p.r.log.Debugf("Error getting resource: %s", err)
+			continue
+		}
+		if !hasWorkInProgress(*newMdb) {
+			continue
+		}
+		select {
+		case p.reconcileRequests <- event.GenericEvent{Meta: newMdb, Object: newMdb}:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// hasWorkInProgress returns true if the resource has to be reconciled periodically, to repair a
+// drift, to schedule and track its backups, or to track its migration or the restores of its standby
+func hasWorkInProgress(mdb mdbv1.MongoDB) bool {
+	if mdb.DeletionTimestamp != nil {
+		return false
+	}
+	if hasDriftToRepair(mdb) || mdb.Spec.Backup != nil {
+		return true
+	}
+	if mdb.Spec.Migration != nil && (mdb.Status.Migration == nil || (mdb.Status.Migration.Phase != mdbv1.MigrationCompleted && mdb.Status.Migration.Phase != mdbv1.MigrationFailed)) {
+		return true
+	}
+	return mdb.Spec.Standby != nil && (mdb.Status.Standby == nil || mdb.Status.Standby.Phase != mdbv1.StandbyPromoted)
+}
+
+// updateMemberStates reads the status of the live replica set, and updates the replica set state,
+// replication lag and last heartbeat of the members in status.members of the resource. The members
+// lagging for longer than spec.replicationLagThreshold allows are reported by the
+// ReplicationLagBelowThreshold condition, and degrade the resource.
+func (r *ReplicaSetReconciler) updateMemberStates(mdb mdbv1.MongoDB) error {
+	if mdb.DeletionTimestamp != nil || len(mdb.Status.Members) == 0 {
+		return nil
+	}
+	sts := appsv1.StatefulSet{}
+	if err := r.client.Get(context.TODO(), mdb.NamespacedName(), &sts); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	if sts.Status.ReadyReplicas == 0 {
+		recordPrimaryMembers(mdb, nil)
+		return nil
+	}
+
+	liveMembers, err := r.readReplicaSetStatus(mdb)
+	if err != nil {
+		return err
+	}
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	previous := newMdb.DeepCopy()
+	lagThreshold, lagFor := replicationLagThreshold(*newMdb)
+	now := r.now()
+	members := make([]mdbv1.MemberStatus, len(newMdb.Status.Members))
+	for i, member := range newMdb.Status.Members {
+		members[i] = withReplicaSetState(member, liveMembers)
+		members[i].LaggingSince = laggingSince(members[i], lagThreshold, now)
+		recordReplicationLag(*newMdb, members[i])
+	}
+	newMdb.Status.Members = members
+	recordPrimaryMembers(*newMdb, members)
+	newMdb.SetCondition(replicationLagCondition(members, lagThreshold, lagFor, now))
+	refreshDegradedCondition(newMdb)
+	if equality.Semantic.DeepEqual(previous.Status, newMdb.Status) {
+		return nil
+	}
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+
+	// the lag is only reported once the members start lagging
+	if condition := newMdb.GetCondition(mdbv1.ReplicationLagBelowThreshold); condition.Status == corev1.ConditionFalse {
+		if previousCondition := previous.GetCondition(mdbv1.ReplicationLagBelowThreshold); previousCondition == nil || previousCondition.Status != corev1.ConditionFalse {
+			r.log.Warn(condition.Message)
+			if r.recorder != nil {
+				r.recorder.Event(newMdb, corev1.EventTypeWarning, replicationLagHighEventReason, condition.Message)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *ReplicaSetReconciler) readReplicaSetStatus(mdb mdbv1.MongoDB) ([]livecluster.MemberStatus, error) {
+	reader, err := r.connectLiveCluster(mdb)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+	defer cancel()
+	defer r.disconnectLiveCluster(ctx, reader)
+
+	return reader.ReplicaSetStatus(ctx)
+}
+
+// withReplicaSetState returns the member with the replica set state, replication lag and last heartbeat
+// read from the status of the live replica set. They are cleared if the member isn't part of it.
+func withReplicaSetState(member mdbv1.MemberStatus, liveMembers []livecluster.MemberStatus) mdbv1.MemberStatus {
+	member.State, member.ReplicationLagSeconds, member.LastHeartbeat = "", nil, nil
+
+	var primaryOptime time.Time
+	for _, m := range liveMembers {
+		if m.StateStr == livecluster.PrimaryState {
+			primaryOptime = m.OptimeDate
+		}
+	}
+	for _, m := range liveMembers {
+		if processName(m.Name) != member.Name {
+			continue
+		}
+		member.State = m.StateStr
+		if m.StateStr == livecluster.SecondaryState && !primaryOptime.IsZero() {
+			lag := int64(primaryOptime.Sub(m.OptimeDate) / time.Second)
+			if lag < 0 {
+				lag = 0
+			}
+			member.ReplicationLagSeconds = &lag
+		}
+		if !m.Self && !m.LastHeartbeat.IsZero() {
+			lastHeartbeat := metav1.NewTime(m.LastHeartbeat)
+			member.LastHeartbeat = &lastHeartbeat
+		}
+	}
+	return member
+}
+
+// keepReplicaSetState copies the replica set state of the members recorded by the poller to the
+// members built from the agent status, which don't hold it.
+func keepReplicaSetState(previous, members []mdbv1.MemberStatus) {
+	for i := range members {
+		for _, p := range previous {
+			if p.Name == members[i].Name {
+				members[i].State, members[i].ReplicationLagSeconds, members[i].LastHeartbeat = p.State, p.ReplicationLagSeconds, p.LastHeartbeat
+				members[i].LaggingSince = p.LaggingSince
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestUpdateMemberStates(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	optime := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	heartbeat := time.Date(2020, 6, 1, 0, 0, 5, 0, time.UTC)
+	r.connectToLiveCluster = func(_ string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		return mockLiveCluster{members: []livecluster.MemberStatus{
+			{Name: "my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017", StateStr: "PRIMARY", OptimeDate: optime, Self: true},
+			{Name: "my-rs-1.my-rs-svc.my-ns.svc.cluster.local:27017", StateStr: "SECONDARY", OptimeDate: optime.Add(-12 * time.Second), LastHeartbeat: heartbeat},
+			{Name: "my-rs-2.my-rs-svc.my-ns.svc.cluster.local:27017", StateStr: "RECOVERING", LastHeartbeat: heartbeat},
+		}}, nil
+	}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.NoError(t, r.updateMemberStates(mdb))
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	members := mdb.Status.Members
+	if assert.Len(t, members, 3) {
+		assert.Equal(t, "PRIMARY", members[0].State)
+		assert.Nil(t, members[0].ReplicationLagSeconds)
+		assert.Nil(t, members[0].LastHeartbeat, "the primary doesn't heartbeat itself")
+
+		assert.Equal(t, "SECONDARY", members[1].State)
+		if assert.NotNil(t, members[1].ReplicationLagSeconds) {
+			assert.Equal(t, int64(12), *members[1].ReplicationLagSeconds)
+		}
+		if assert.NotNil(t, members[1].LastHeartbeat) {
+			assert.True(t, heartbeat.Equal(members[1].LastHeartbeat.Time))
+		}
+
+		assert.Equal(t, "RECOVERING", members[2].State)
+		assert.Nil(t, members[2].ReplicationLagSeconds)
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(primaryMembers.WithLabelValues(mdb.Namespace, mdb.Name)))
+
+	// the state is kept when the agent status of the members is updated
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, "SECONDARY", mdb.Status.Members[1].State)
+}
+
+func TestWithReplicaSetState_ClearsRemovedMembers(t *testing.T) {
+	lag := int64(3)
+	member := mdbv1.MemberStatus{Name: "my-rs-3", State: "SECONDARY", ReplicationLagSeconds: &lag}
+	member = withReplicaSetState(member, []livecluster.MemberStatus{{Name: "my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017", StateStr: "PRIMARY"}})
+	assert.Equal(t, "", member.State)
+	assert.Nil(t, member.ReplicationLagSeconds)
+}
+
+func TestMemberStatePoller_ReconcilesTheWorkInProgress(t *testing.T) {
+	migrating := testutils.NewTestReplicaSet()
+	migrating.Spec.Migration = &mdbv1.Migration{Direction: mdbv1.MigrationToAtlas}
+	mgr := client.NewManager(&migrating)
+	idle := testutils.NewTestReplicaSet()
+	idle.Name = "my-idle-rs"
+	assert.NoError(t, mgr.GetClient().Create(context.TODO(), &idle))
+
+	reconcileRequests := make(chan event.GenericEvent, 2)
+	p := memberStatePoller{r: newReconciler(mgr, testutils.MockManifestProvider(migrating.Spec.Version)), reconcileRequests: reconcileRequests}
+	p.pollAll(make(chan struct{}))
+	close(reconcileRequests)
+
+	var reconciled []string
+	for e := range reconcileRequests {
+		reconciled = append(reconciled, e.Meta.GetName())
+	}
+	assert.Equal(t, []string{migrating.Name}, reconciled)
+	err := mgr.GetClient().Get(context.TODO(), migrationJobNamespacedName(migrating), &batchv1.Job{})
+	assert.True(t, errors.IsNotFound(err), "the migration is only started by the reconciliation")
+}
+
+func TestHasWorkInProgress(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	assert.False(t, hasWorkInProgress(mdb))
+
+	mdb.Spec.Migration = &mdbv1.Migration{}
+	assert.True(t, hasWorkInProgress(mdb))
+	mdb.Status.Migration = &mdbv1.MigrationStatus{Phase: mdbv1.MigrationCompleted}
+	assert.False(t, hasWorkInProgress(mdb))
+
+	mdb.Spec.Standby = &mdbv1.Standby{}
+	assert.True(t, hasWorkInProgress(mdb))
+	mdb.Status.Standby = &mdbv1.StandbyStatus{Phase: mdbv1.StandbyPromoted}
+	assert.False(t, hasWorkInProgress(mdb))
+
+	mdb.Spec.Backup = &mdbv1.Backup{}
+	assert.True(t, hasWorkInProgress(mdb))
+}
@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// updateMemberStatus reads the agent health status published on the Pod of every member
+// and updates status.members of the resource with the progress towards the current
+// automation config version and the disk usage of the data volume. status.replicas and
+// status.labelSelector are updated for the scale subresource. The replica set state of the
+// members is kept, it is updated by the memberStatePoller.
+func (r ReplicaSetReconciler) updateMemberStatus(mdb mdbv1.MongoDB) error {
+	ac, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return fmt.Errorf("error reading automation config: %s", err)
+	}
+
+	members := make([]mdbv1.MemberStatus, mdb.Spec.Members)
+	for i := range members {
+		name := fmt.Sprintf("%s-%d", mdb.Name, i)
+		agentStatus, err := r.getAgentStatus(types.NamespacedName{Name: name, Namespace: mdb.Namespace})
+		if err != nil {
+			return err
+		}
+		members[i] = mdbv1.MemberStatus{
+			Name:                name,
+			GoalVersion:         ac.Version,
+			LastVersionAchieved: agentStatus.LastGoalVersionAchieved,
+			CurrentStep:         agentStatus.CurrentStep,
+			CurrentStepSince:    currentStepSince(agentStatus),
+			DataVolumeUsage:     dataVolumeUsage(agentStatus),
+		}
+		recordDataVolumeUsage(mdb, members[i])
+	}
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	keepReplicaSetState(newMdb.Status.Members, members)
+	previousCondition := newMdb.GetCondition(mdbv1.DataVolumeUsageBelowThreshold)
+	condition := dataVolumeUsageCondition(members, usageWarningThreshold(mdb))
+	conditionChanged := previousCondition == nil || previousCondition.Status != condition.Status || previousCondition.Message != condition.Message
+	selector := labels.SelectorFromSet(map[string]string{"app": mdb.ServiceName()}).String()
+	scaleChanged := newMdb.Status.Replicas != mdb.Spec.Members || newMdb.Status.LabelSelector != selector
+	if reflect.DeepEqual(newMdb.Status.Members, members) && !conditionChanged && !scaleChanged {
+		return nil
+	}
+	newMdb.Status.Members = members
+	newMdb.Status.Replicas = mdb.Spec.Members
+	newMdb.Status.LabelSelector = selector
+	newMdb.SetCondition(condition)
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+
+	if conditionChanged && condition.Status == corev1.ConditionFalse && r.recorder != nil {
+		r.recorder.Event(newMdb, corev1.EventTypeWarning, dataVolumeUsageHighEventReason, condition.Message)
+	}
+	return nil
+}
+
+// currentStepSince returns the time the plan of the agent last made progress, if it is in progress
+func currentStepSince(agentStatus agenthealth.MemberStatus) *metav1.Time {
+	if agentStatus.CurrentStep == "" || agentStatus.CurrentStepSince == nil {
+		return nil
+	}
+	since := metav1.NewTime(*agentStatus.CurrentStepSince)
+	return &since
+}
+
+// getAgentStatus returns the agent status published on the Pod with the given name. An empty
+// status is returned if the Pod doesn't exist yet or the agent hasn't published its status.
+func (r ReplicaSetReconciler) getAgentStatus(nsName types.NamespacedName) (agenthealth.MemberStatus, error) {
+	pod := corev1.Pod{}
+	if err := r.client.Get(context.TODO(), nsName, &pod); err != nil {
+		if errors.IsNotFound(err) {
+			return agenthealth.MemberStatus{}, nil
+		}
+		return agenthealth.MemberStatus{}, fmt.Errorf("error getting pod %s: %s", nsName, err)
+	}
+
+	status, _, err := agenthealth.MemberStatusFromAnnotations(pod.Annotations)
+	if err != nil {
+		return agenthealth.MemberStatus{}, fmt.Errorf("error reading agent status of pod %s: %s", nsName, err)
+	}
+	return status, nil
+}
@@ -0,0 +1,219 @@
+package mongodb
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// unknownPhase is the phase of a reconciliation which neither completed, failed, nor found a change in progress
+const unknownPhase = "Unknown"
+
+var (
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_operator_reconcile_duration_seconds",
+		Help:    "Duration of the reconciliations of MongoDB resources, by the phase they ended in",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"phase"})
+
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_operator_reconcile_errors_total",
+		Help: "Reconciliations of MongoDB resources which failed, by reason",
+	}, []string{"reason"})
+
+	readyMembers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_ready_members",
+		Help: "Number of members of the replica set which are ready",
+	}, []string{"namespace", "name"})
+
+	desiredMembers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_desired_members",
+		Help: "Number of members of the replica set in the spec of the resource",
+	}, []string{"namespace", "name"})
+
+	automationConfigVersion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_automation_config_version",
+		Help: "Version of the current automation config of the replica set",
+	}, []string{"namespace", "name"})
+
+	lastSuccessfulReconcile = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_last_successful_reconcile_timestamp_seconds",
+		Help: "Time of the last reconciliation which found the deployment to match the resource",
+	}, []string{"namespace", "name"})
+
+	lastSuccessfulBackup = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_backup_last_success_timestamp_seconds",
+		Help: "Time the last successful scheduled backup of the replica set completed at",
+	}, []string{"namespace", "name"})
+
+	lastBackupSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_backup_last_size_bytes",
+		Help: "Size of the last successful scheduled backup of the replica set",
+	}, []string{"namespace", "name"})
+
+	backupConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_backup_consecutive_failures",
+		Help: "Number of scheduled backups of the replica set which failed since the last successful one",
+	}, []string{"namespace", "name"})
+
+	lastSuccessfulBackupVerification = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_backup_last_verification_success_timestamp_seconds",
+		Help: "Time the last successful verification of the scheduled backups of the replica set completed at",
+	}, []string{"namespace", "name"})
+
+	primaryMembers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_primary_members",
+		Help: "Number of members of the replica set in the PRIMARY state, as last read by the operator",
+	}, []string{"namespace", "name"})
+
+	tlsCertificateExpiration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_tls_certificate_expiration_timestamp_seconds",
+		Help: "Time the TLS certificate of the members of the replica set expires at",
+	}, []string{"namespace", "name"})
+)
+
+// backupGauges are the metrics of the scheduled backups, only exposed for the resources with spec.backup
+var backupGauges = []*prometheus.GaugeVec{lastSuccessfulBackup, lastBackupSize, backupConsecutiveFailures, lastSuccessfulBackupVerification}
+
+func init() {
+	// the metrics are served by the manager along with the controller-runtime ones
+	metrics.Registry.MustRegister(reconcileDuration, reconcileErrors, readyMembers, desiredMembers, automationConfigVersion, lastSuccessfulReconcile)
+	metrics.Registry.MustRegister(lastSuccessfulBackup, lastBackupSize, backupConsecutiveFailures, lastSuccessfulBackupVerification)
+	metrics.Registry.MustRegister(primaryMembers, tlsCertificateExpiration)
+}
+
+// recordReconcileMetrics exposes the outcome of the reconciliation of the resource, and its
+// summary in the status, as metrics
+func (r *ReplicaSetReconciler) recordReconcileMetrics(mdb mdbv1.MongoDB, reconcileErr error) error {
+	ac, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return fmt.Errorf("error reading automation config: %s", err)
+	}
+
+	reconcileDuration.WithLabelValues(r.reconcilePhase(mdb, reconcileErr)).Observe(time.Since(r.reconcileStartedAt).Seconds())
+	if reconcileErr != nil {
+		reconcileErrors.WithLabelValues(reconcileErrorReason(reconcileErr)).Inc()
+	}
+
+	labels := prometheus.Labels{"namespace": mdb.Namespace, "name": mdb.Name}
+	readyMembers.With(labels).Set(float64(mdb.Status.ReadyMembers))
+	desiredMembers.With(labels).Set(float64(mdb.Status.DesiredMembers))
+	automationConfigVersion.With(labels).Set(float64(ac.Version))
+	if r.isReady {
+		lastSuccessfulReconcile.With(labels).Set(float64(r.now().Unix()))
+	}
+	recordBackupMetrics(mdb.NamespacedName(), mdb.Status.Backup)
+	recordCertificateExpiration(r.client, mdb)
+	return nil
+}
+
+// recordBackupMetrics exposes the status of the scheduled backups of the resource as metrics, so that
+// missed backups can be alerted on, or removes them when there are no scheduled backups
+func recordBackupMetrics(nsName types.NamespacedName, status *mdbv1.BackupStatus) {
+	labels := prometheus.Labels{"namespace": nsName.Namespace, "name": nsName.Name}
+	if status == nil {
+		for _, gauge := range backupGauges {
+			gauge.Delete(labels)
+		}
+		return
+	}
+	if status.LastSuccessfulTime != nil {
+		lastSuccessfulBackup.With(labels).Set(float64(status.LastSuccessfulTime.Unix()))
+	}
+	lastBackupSize.With(labels).Set(float64(status.LastSize))
+	backupConsecutiveFailures.With(labels).Set(float64(status.ConsecutiveFailures))
+	if verification := status.LastVerification; verification != nil && verification.LastSuccessfulTime != nil {
+		lastSuccessfulBackupVerification.With(labels).Set(float64(verification.LastSuccessfulTime.Unix()))
+	}
+}
+
+// recordPrimaryMembers exposes the number of members of the resource in the PRIMARY state, so that
+// a replica set without a primary can be alerted on
+func recordPrimaryMembers(mdb mdbv1.MongoDB, members []mdbv1.MemberStatus) {
+	primaries := 0
+	for _, member := range members {
+		if member.State == livecluster.PrimaryState {
+			primaries++
+		}
+	}
+	primaryMembers.With(prometheus.Labels{"namespace": mdb.Namespace, "name": mdb.Name}).Set(float64(primaries))
+}
+
+// recordCertificateExpiration exposes the time the TLS certificate of the members expires at, read
+// from the Secret of spec.security.tls, or removes it when TLS is disabled or the certificate can't be
+// read. The certificates read from Vault aren't exposed.
+func recordCertificateExpiration(getter secret.Getter, mdb mdbv1.MongoDB) {
+	labels := prometheus.Labels{"namespace": mdb.Namespace, "name": mdb.Name}
+	notAfter, ok := certificateNotAfter(getter, mdb)
+	if !ok {
+		tlsCertificateExpiration.Delete(labels)
+		return
+	}
+	tlsCertificateExpiration.With(labels).Set(float64(notAfter.Unix()))
+}
+
+func certificateNotAfter(getter secret.Getter, mdb mdbv1.MongoDB) (time.Time, bool) {
+	if !mdb.Spec.Security.TLS.Enabled || usesVaultTLS(mdb) {
+		return time.Time{}, false
+	}
+	cert, err := secret.ReadKey(getter, tlsSecretCertName, mdb.TLSSecretNamespacedName())
+	if err != nil {
+		return time.Time{}, false
+	}
+	block, _ := pem.Decode([]byte(cert))
+	if block == nil {
+		return time.Time{}, false
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return certificate.NotAfter, true
+}
+
+// reconcilePhase returns the phase the reconciliation of the resource ended in: Reconciled, the
+// change in progress, or the reason it failed
+func (r *ReplicaSetReconciler) reconcilePhase(mdb mdbv1.MongoDB, reconcileErr error) string {
+	switch failure := failureCondition(mdb); {
+	case mdb.Spec.Paused:
+		return pausedReason
+	case reconcileErr != nil:
+		return reconcileErrorReason(reconcileErr)
+	case failure != nil:
+		return failure.Reason
+	case r.progress != nil:
+		return r.progress.reason
+	case r.isReady:
+		return reconciledReason
+	}
+	return unknownPhase
+}
+
+// reconcileErrorReason returns the reason the reconciliation failed with the error, which is retried
+func reconcileErrorReason(reconcileErr error) string {
+	if isTransient(reconcileErr) {
+		return transientErrorReason
+	}
+	return reconciliationErrorReason
+}
+
+// countTerminalError counts the reconciliation which failed with the terminal error
+func countTerminalError(terminal terminalError) {
+	reconcileErrors.WithLabelValues(terminal.reason).Inc()
+}
+
+// deleteResourceMetrics removes the metrics of a resource which no longer exists
+func deleteResourceMetrics(nsName types.NamespacedName) {
+	labels := prometheus.Labels{"namespace": nsName.Namespace, "name": nsName.Name}
+	for _, gauge := range append([]*prometheus.GaugeVec{readyMembers, desiredMembers, automationConfigVersion, lastSuccessfulReconcile, primaryMembers, tlsCertificateExpiration}, backupGauges...) {
+		gauge.Delete(labels)
+	}
+}
@@ -0,0 +1,62 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileMetrics(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Name = "metrics-rs"
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.now = func() time.Time { return time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(readyMembers.WithLabelValues(mdb.Namespace, mdb.Name)))
+	assert.Equal(t, 3.0, testutil.ToFloat64(desiredMembers.WithLabelValues(mdb.Namespace, mdb.Name)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(automationConfigVersion.WithLabelValues(mdb.Namespace, mdb.Name)))
+	assert.Equal(t, float64(r.now().Unix()), testutil.ToFloat64(lastSuccessfulReconcile.WithLabelValues(mdb.Namespace, mdb.Name)))
+
+	invalidSpecErrors := testutil.ToFloat64(reconcileErrors.WithLabelValues(invalidSpecReason))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.MaintenanceWindow = &mdbv1.MaintenanceWindow{Schedule: "0 2 * * 6", Duration: metav1.Duration{}}
+	_ = c.Update(context.TODO(), &mdb)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, invalidSpecErrors+1, testutil.ToFloat64(reconcileErrors.WithLabelValues(invalidSpecReason)))
+
+	resources := testutil.CollectAndCount(readyMembers)
+	_ = c.Delete(context.TODO(), &mdb)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, resources-1, testutil.CollectAndCount(readyMembers), "the metrics of the deleted resource are removed")
+}
+
+func TestReconcilePhase(t *testing.T) {
+	r := &ReplicaSetReconciler{}
+	mdb := testutils.NewTestReplicaSet()
+	assert.Equal(t, unknownPhase, r.reconcilePhase(mdb, nil))
+
+	r.progress = &reconcileProgress{reason: scalingReason}
+	assert.Equal(t, scalingReason, r.reconcilePhase(mdb, nil))
+	assert.Equal(t, reconciliationErrorReason, r.reconcilePhase(mdb, assert.AnError))
+
+	r.progress, r.isReady = nil, true
+	assert.Equal(t, reconciledReason, r.reconcilePhase(mdb, nil))
+
+	mdb.Spec.Paused = true
+	assert.Equal(t, pausedReason, r.reconcilePhase(mdb, nil))
+}
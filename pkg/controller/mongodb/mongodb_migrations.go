@@ -0,0 +1,184 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// stateVersionAnnotationKey records how many of the migrations have been applied to the resource
+	stateVersionAnnotationKey = "mongodb.com/v1.stateVersion"
+
+	// legacyHasLeftReadyStateAnnotationKey is the former name of hasLeftReadyStateAnnotationKey
+	legacyHasLeftReadyStateAnnotationKey = "mongodb.com/v1.hasLeftReadyStateAnnotationKey"
+	// legacyAgentSecretName is the name of the Secret of the agent credentials shared by all the
+	// resources of a namespace, before it was named after each resource
+	legacyAgentSecretName = "agent-scram-credentials"
+)
+
+// migration changes the state of a resource deployed by an older release of the operator, such as its
+// annotations or the objects generated for it, to the conventions of the current release. It must
+// leave the resources already following them unchanged, as the new resources are migrated too.
+type migration struct {
+	description string
+	migrate     func(r *ReplicaSetReconciler, mdb *mdbv1.MongoDB) error
+}
+
+// migrations are applied in order, a resource is at state version n once the first n are applied.
+// They are never removed nor reordered, new migrations are appended.
+var migrations = []migration{
+	{description: "rename the hasLeftReadyState annotation", migrate: migrateHasLeftReadyStateAnnotation},
+	{description: "copy the agent credentials to the Secret of the resource", migrate: migrateAgentSecret},
+	{description: "defer the safe-to-evict annotation of the members", migrate: migrateSafeToEvictAnnotation},
+}
+
+// stateVersion returns how many of the migrations have been applied to the resource, none if it
+// isn't recorded
+func stateVersion(mdb mdbv1.MongoDB) int {
+	version, err := strconv.Atoi(mdb.Annotations[stateVersionAnnotationKey])
+	if err != nil || version < 0 {
+		return 0
+	}
+	return version
+}
+
+// migrate applies the migrations the resource hasn't had yet and returns it as migrated. The state
+// version and the annotations changed by the migrations are written with the resource update of the
+// reconciliation, once they're all applied.
+func (r *ReplicaSetReconciler) migrate(mdb mdbv1.MongoDB) (mdbv1.MongoDB, error) {
+	version := stateVersion(mdb)
+	if version >= len(migrations) {
+		// the resource may have been migrated by a later release of the operator
+		return mdb, nil
+	}
+
+	migrated := *mdb.DeepCopy()
+	if migrated.Annotations == nil {
+		migrated.Annotations = map[string]string{}
+	}
+	for i := version; i < len(migrations); i++ {
+		r.log.Debugf("Applying migration %d: %s", i+1, migrations[i].description)
+		if err := migrations[i].migrate(r, &migrated); err != nil {
+			return mdb, fmt.Errorf("error applying migration %d, %s: %s", i+1, migrations[i].description, err)
+		}
+	}
+	migrated.Annotations[stateVersionAnnotationKey] = strconv.Itoa(len(migrations))
+
+	// only the annotations changed by the migrations are written, the others may have been changed
+	// since the resource was read
+	current, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return mdb, fmt.Errorf("error getting resource: %s", err)
+	}
+	if current.Annotations == nil {
+		current.Annotations = map[string]string{}
+	}
+	for key := range mdb.Annotations {
+		if _, ok := migrated.Annotations[key]; !ok {
+			delete(current.Annotations, key)
+		}
+	}
+	for key, value := range migrated.Annotations {
+		if mdb.Annotations[key] != value {
+			current.Annotations[key] = value
+		}
+	}
+	if err := r.writeAnnotations(current); err != nil {
+		return mdb, fmt.Errorf("error writing the state version: %s", err)
+	}
+	if version > 0 {
+		r.log.Infof("Migrated the resource from state version %d to %d", version, len(migrations))
+	}
+	return migrated, nil
+}
+
+// migrateHasLeftReadyStateAnnotation renames the annotation recording that the StatefulSet has left
+// the ready state during a version change
+func migrateHasLeftReadyStateAnnotation(_ *ReplicaSetReconciler, mdb *mdbv1.MongoDB) error {
+	value, ok := mdb.Annotations[legacyHasLeftReadyStateAnnotationKey]
+	if !ok {
+		return nil
+	}
+	if _, ok := mdb.Annotations[hasLeftReadyStateAnnotationKey]; !ok {
+		mdb.Annotations[hasLeftReadyStateAnnotationKey] = value
+	}
+	delete(mdb.Annotations, legacyHasLeftReadyStateAnnotationKey)
+	return nil
+}
+
+// migrateAgentSecret copies the credentials of the agents from the Secret shared by the resources of
+// the namespace to the Secret of the resource, if its members use the shared one, so that the
+// replica set keeps its keyfile and the password of the agent when the members are restarted with
+// the Secret of the resource. The shared Secret is kept for the other resources of the namespace.
+func migrateAgentSecret(r *ReplicaSetReconciler, mdb *mdbv1.MongoDB) error {
+	sts := appsv1.StatefulSet{}
+	if err := r.client.Get(context.TODO(), mdb.NamespacedName(), &sts); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	if !mountsSecret(sts, legacyAgentSecretName) {
+		return nil
+	}
+
+	_, err := r.client.GetSecret(mdb.ScramCredentialsNamespacedName())
+	if err == nil {
+		// the credentials have already been copied
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting agent secret: %s", err)
+	}
+	legacy, err := r.client.GetSecret(types.NamespacedName{Name: legacyAgentSecretName, Namespace: mdb.Namespace})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting Secret %s: %s", legacyAgentSecretName, err)
+	}
+	if err := r.client.CreateSecret(secret.Builder().
+		SetName(mdb.ScramCredentialsNamespacedName().Name).
+		SetNamespace(mdb.Namespace).
+		SetByteData(legacy.Data).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(*mdb)}).
+		Build()); err != nil {
+		return fmt.Errorf("error creating Secret %s: %s", mdb.ScramCredentialsNamespacedName().Name, err)
+	}
+	r.log.Infof("Copied the agent credentials from Secret %s to Secret %s", legacyAgentSecretName, mdb.ScramCredentialsNamespacedName().Name)
+	return nil
+}
+
+// migrateSafeToEvictAnnotation defers the safe-to-evict annotation of the members whose Pod template
+// doesn't have it, as adding it would restart them on the upgrade of the operator
+func migrateSafeToEvictAnnotation(r *ReplicaSetReconciler, mdb *mdbv1.MongoDB) error {
+	sts := appsv1.StatefulSet{}
+	if err := r.client.Get(context.TODO(), mdb.NamespacedName(), &sts); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	if _, ok := sts.Spec.Template.Annotations[safeToEvictAnnotationKey]; !ok {
+		mdb.Annotations[safeToEvictDeferredAnnotationKey] = "true"
+	}
+	return nil
+}
+
+// mountsSecret returns true if the Pods of the StatefulSet mount the Secret as a volume
+func mountsSecret(sts appsv1.StatefulSet, name string) bool {
+	for _, volume := range sts.Spec.Template.Spec.Volumes {
+		if volume.Secret != nil && volume.Secret.SecretName == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMigrate_NewResource(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, "3", mdb.Annotations[stateVersionAnnotationKey])
+}
+
+func TestMigrate_HasLeftReadyStateAnnotation(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Annotations[legacyHasLeftReadyStateAnnotationKey] = trueAnnotation
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	migrated, err := r.migrate(mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, trueAnnotation, migrated.Annotations[hasLeftReadyStateAnnotationKey])
+	assert.NotContains(t, migrated.Annotations, legacyHasLeftReadyStateAnnotationKey)
+
+	_ = mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, migrated.Annotations, mdb.Annotations, "the migrated annotations are written")
+	assert.Equal(t, "3", mdb.Annotations[stateVersionAnnotationKey])
+}
+
+func TestMigrate_SkipsTheMigratedResources(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Annotations[stateVersionAnnotationKey] = "3"
+	mdb.Annotations[legacyHasLeftReadyStateAnnotationKey] = trueAnnotation
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	migrated, err := r.migrate(mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, mdb, migrated)
+}
+
+func TestMigrate_AgentSecret(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	_ = secret.CreateOrUpdate(c, secret.Builder().
+		SetName(legacyAgentSecretName).
+		SetNamespace(mdb.Namespace).
+		SetField(scram.AgentPasswordKey, "legacy-password").
+		SetField(scram.AgentKeyfileKey, "legacy-keyfile").
+		Build())
+	replicas := int32(mdb.Spec.Members)
+	_ = c.Create(context.TODO(), &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: mdb.Name, Namespace: mdb.Namespace},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{{
+						Name:         legacyAgentSecretName,
+						VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: legacyAgentSecretName}},
+					}},
+				},
+			},
+		},
+	})
+
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	agentSecret, err := c.GetSecret(mdb.ScramCredentialsNamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-password", string(agentSecret.Data[scram.AgentPasswordKey]))
+	assert.Equal(t, "legacy-keyfile", string(agentSecret.Data[scram.AgentKeyfileKey]))
+	assert.True(t, metav1.IsControlledBy(&agentSecret, &mdb))
+	currentAc, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-keyfile", currentAc.Auth.Key, "the replica set keeps its keyfile")
+
+	sts, err := c.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.True(t, mountsSecret(sts, mdb.ScramCredentialsNamespacedName().Name))
+	assert.False(t, mountsSecret(sts, legacyAgentSecretName))
+	_, err = c.GetSecret(types.NamespacedName{Name: legacyAgentSecretName, Namespace: mdb.Namespace})
+	assert.NoError(t, err, "the shared Secret is kept for the other resources")
+}
+
+func TestMigrate_AgentSecretOfAnotherResource(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	_ = secret.CreateOrUpdate(c, secret.Builder().
+		SetName(legacyAgentSecretName).
+		SetNamespace(mdb.Namespace).
+		SetField(scram.AgentPasswordKey, "legacy-password").
+		SetField(scram.AgentKeyfileKey, "legacy-keyfile").
+		Build())
+
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	agentSecret, err := c.GetSecret(mdb.ScramCredentialsNamespacedName())
+	assert.NoError(t, err)
+	assert.NotEqual(t, "legacy-keyfile", string(agentSecret.Data[scram.AgentKeyfileKey]), "a new resource gets its own credentials")
+}
+
+func TestMigrate_SafeToEvictAnnotation(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	replicas := int32(mdb.Spec.Members)
+	_ = c.Create(context.TODO(), &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: mdb.Name, Namespace: mdb.Namespace},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	})
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	migrated, err := r.migrate(mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", migrated.Annotations[safeToEvictDeferredAnnotationKey], "the members deployed before the annotation aren't restarted")
+	sts, err := buildStatefulSet(migrated)
+	assert.NoError(t, err)
+	assert.NotContains(t, sts.Spec.Template.Annotations, safeToEvictAnnotationKey)
+
+	delete(migrated.Annotations, safeToEvictDeferredAnnotationKey)
+	sts, err = buildStatefulSet(migrated)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", sts.Spec.Template.Annotations[safeToEvictAnnotationKey], "the annotation is added once the deferral is removed")
+
+	t.Run("The members already annotated aren't deferred", func(t *testing.T) {
+		mdb := testutils.NewTestReplicaSet()
+		mgr := client.NewManager(&mdb)
+		c := client.NewClient(mgr.GetClient())
+		_ = c.Create(context.TODO(), &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: mdb.Name, Namespace: mdb.Namespace},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{safeToEvictAnnotationKey: "true"}}},
+			},
+		})
+		r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+		migrated, err := r.migrate(mdb)
+		assert.NoError(t, err)
+		assert.NotContains(t, migrated.Annotations, safeToEvictDeferredAnnotationKey)
+	})
+}
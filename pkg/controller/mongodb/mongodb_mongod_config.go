@@ -0,0 +1,43 @@
+package mongodb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+)
+
+// additionalMongodConfig returns the options of spec.additionalMongodConfig, or nil if the resource
+// doesn't set any
+func additionalMongodConfig(mdb mdbv1.MongoDB) (map[string]interface{}, error) {
+	if mdb.Spec.AdditionalMongodConfig == nil || len(mdb.Spec.AdditionalMongodConfig.Raw) == 0 {
+		return nil, nil
+	}
+	options := map[string]interface{}{}
+	if err := json.Unmarshal(mdb.Spec.AdditionalMongodConfig.Raw, &options); err != nil {
+		return nil, fmt.Errorf("it must be an object: %s", err)
+	}
+	if len(options) == 0 {
+		return nil, nil
+	}
+	return options, nil
+}
+
+func validateAdditionalMongodConfig(mdb mdbv1.MongoDB) error {
+	_, err := additionalMongodConfig(mdb)
+	return err
+}
+
+// additionalMongodConfigModification sets spec.additionalMongodConfig as the additional arguments
+// of the processes, which the automation config builder translates to the options of spec.version
+func additionalMongodConfigModification(mdb mdbv1.MongoDB) automationconfig.Modification {
+	options, err := additionalMongodConfig(mdb)
+	if err != nil || options == nil {
+		// the spec is validated before the automation config is built
+		return automationconfig.NOOP()
+	}
+	return automationconfig.ForEachProcess(func(process *automationconfig.Process) {
+		process.Args26.Additional = options
+	})
+}
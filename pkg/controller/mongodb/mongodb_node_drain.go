@@ -0,0 +1,109 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const primarySteppedDownEventReason = "PrimarySteppedDown"
+
+// stepDownPrimaryOnCordonedNode steps down the primary when the node it runs on is cordoned, which is
+// the first step of a drain, so that a new primary is elected before its Pod is evicted instead of after.
+// The primary is only stepped down if a healthy member runs on a node which isn't cordoned, as it could
+// otherwise be elected again or the replica set could be left without a primary.
+func (r *ReplicaSetReconciler) stepDownPrimaryOnCordonedNode(mdb mdbv1.MongoDB) error {
+	currentAC, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return fmt.Errorf("error reading automation config: %s", err)
+	}
+	if len(currentAC.Processes) == 0 {
+		return nil
+	}
+
+	cordonedNodes := map[string]string{}
+	for _, p := range currentAC.Processes {
+		pod := corev1.Pod{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: p.Name, Namespace: mdb.Namespace}, &pod); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("error getting pod %s: %s", p.Name, err)
+		}
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		node := corev1.Node{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: pod.Spec.NodeName}, &node); err != nil {
+			return fmt.Errorf("error getting node %s: %s", pod.Spec.NodeName, err)
+		}
+		if node.Spec.Unschedulable {
+			cordonedNodes[p.Name] = node.Name
+		}
+	}
+	if len(cordonedNodes) == 0 {
+		return nil
+	}
+
+	members, err := r.getMembersHealth(mdb, currentAC)
+	if err != nil {
+		return err
+	}
+	primary, hasElectableMember := "", false
+	for name, m := range members {
+		if m.isPrimary {
+			primary = name
+		} else if _, isCordoned := cordonedNodes[name]; m.isHealthy && !isCordoned {
+			hasElectableMember = true
+		}
+	}
+	nodeName, isCordoned := cordonedNodes[primary]
+	if primary == "" || !isCordoned {
+		return nil
+	}
+	if !hasElectableMember {
+		r.log.Warnf("Primary %s runs on cordoned node %s, but no healthy member runs on another node to replace it", primary, nodeName)
+		return nil
+	}
+
+	if err := r.stepDownPrimary(mdb); err != nil {
+		return err
+	}
+	r.log.Infof("Stepped down primary %s as node %s is cordoned", primary, nodeName)
+	if r.recorder != nil {
+		r.recorder.Eventf(&mdb, corev1.EventTypeNormal, primarySteppedDownEventReason, "Stepped down primary %s as node %s is cordoned", primary, nodeName)
+	}
+	return nil
+}
+
+// resourcesWithMembersOnNode returns the requests to reconcile the MongoDB resources which have a
+// member running on the node
+func (r *ReplicaSetReconciler) resourcesWithMembersOnNode(node handler.MapObject) []reconcile.Request {
+	mdbList, err := listSelectedResources(r.client, r.selector)
+	if err != nil {
+		zap.S().Warnf("Error listing MongoDB resources: %s", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, mdb := range mdbList.Items {
+		for i := 0; i < mdb.Spec.Members; i++ {
+			pod := corev1.Pod{}
+			if err := r.client.Get(context.TODO(), types.NamespacedName{Name: fmt.Sprintf("%s-%d", mdb.Name, i), Namespace: mdb.Namespace}, &pod); err != nil {
+				continue
+			}
+			if pod.Spec.NodeName == node.Meta.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: mdb.NamespacedName()})
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,76 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// scheduleMembers runs every member on its own node, the ones on the cordoned nodes are cordoned
+func scheduleMembers(t *testing.T, c client.Client, mdb mdbv1.MongoDB, cordoned ...int) {
+	for i := 0; i < mdb.Spec.Members; i++ {
+		node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}}
+		for _, j := range cordoned {
+			if i == j {
+				node.Spec.Unschedulable = true
+			}
+		}
+		assert.NoError(t, c.Create(context.TODO(), &node))
+
+		pod := corev1.Pod{}
+		assert.NoError(t, c.GetAndUpdate(types.NamespacedName{Name: fmt.Sprintf("%s-%d", mdb.Name, i), Namespace: mdb.Namespace}, &pod, func() {
+			pod.Spec.NodeName = node.Name
+		}))
+	}
+}
+
+func newDrainTest(t *testing.T, primary *int, cordoned ...int) *ReplicaSetReconciler {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	withHealthyReplicaSet(t, r, mgrClient, mdb, primary)
+	scheduleMembers(t, mgrClient, mdb, cordoned...)
+	return r
+}
+
+func TestStepDownPrimaryOnCordonedNode(t *testing.T) {
+	primary := 0
+	r := newDrainTest(t, &primary, 0)
+
+	assert.NoError(t, r.stepDownPrimaryOnCordonedNode(testutils.NewTestReplicaSet()))
+	assert.Equal(t, 1, primary)
+
+	// the new primary doesn't run on the cordoned node
+	assert.NoError(t, r.stepDownPrimaryOnCordonedNode(testutils.NewTestReplicaSet()))
+	assert.Equal(t, 1, primary)
+}
+
+func TestStepDownPrimaryOnCordonedNode_SecondaryOnCordonedNode(t *testing.T) {
+	primary := 0
+	r := newDrainTest(t, &primary, 2)
+
+	assert.NoError(t, r.stepDownPrimaryOnCordonedNode(testutils.NewTestReplicaSet()))
+	assert.Equal(t, 0, primary)
+}
+
+func TestStepDownPrimaryOnCordonedNode_AllNodesCordoned(t *testing.T) {
+	primary := 0
+	r := newDrainTest(t, &primary, 0, 1, 2)
+
+	// there is no member to replace the primary
+	assert.NoError(t, r.stepDownPrimaryOnCordonedNode(testutils.NewTestReplicaSet()))
+	assert.Equal(t, 0, primary)
+}
@@ -0,0 +1,294 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	oplogArchiveContainerName  = "archive"
+	oplogUploadContainerName   = "upload"
+	oplogDownloadContainerName = "download-oplog"
+	// oplogPath is where the volume holding the slices of the oplog is mounted
+	oplogPath = "/oplog"
+	// oplogArchiveDir is the directory of the s3 target the slices of the oplog are archived in
+	oplogArchiveDir = "oplog"
+
+	defaultOplogArchiveIntervalSeconds = 60
+	minOplogArchiveIntervalSeconds     = 10
+	oplogUploadIntervalSeconds         = 10
+)
+
+// oplogRangeScript is evaluated by the mongo shell with $last set to the last archived entry of the
+// oplog, as <t>.<i>. It prints "start <entry>" when the archiving starts from the last entry, because
+// nothing is archived yet or the oplog rolled over since, and "dump <entry> <last t> <last i> <end t>
+// <end i>" when the entries after the last archived one must be archived up to the last entry. The
+// entries are named after their timestamp, with the seconds padded so that their names sort.
+const oplogRangeScript = `var oplog = db.getSiblingDB("local").oplog.rs;
+var first = oplog.find().sort({$natural: 1}).limit(1).next().ts;
+var end = oplog.find().sort({$natural: -1}).limit(1).next().ts;
+var name = function(ts) { return ("000000000" + ts.t).slice(-10) + "." + ts.i; };
+var from = last.split(".").map(Number);
+if (last === "" || first.t > from[0] || (first.t === from[0] && first.i > from[1])) {
+  print("start " + name(end));
+} else if (end.t !== from[0] || end.i !== from[1]) {
+  print("dump " + name(end) + " " + from[0] + " " + from[1] + " " + end.t + " " + end.i);
+}`
+
+// scheduledArchiveTimeRegexp matches the time in the name of the archives of the scheduled backups
+// and of the backups taken before a version change
+var scheduledArchiveTimeRegexp = regexp.MustCompile(`-(\d{8}[tT]\d{6}[zZ])\.archive\.gz$`)
+
+// validateBackupPointInTime ensures the oplog is archived to an s3 target by the mongodump or pbm
+// method
+func validateBackupPointInTime(backup mdbv1.Backup) error {
+	if backup.PointInTime == nil {
+		return nil
+	}
+	if backup.Target.S3 == nil || backup.Method == mdbv1.BackupMethodSnapshot {
+		return fmt.Errorf("pointInTime requires the mongodump or pbm method and an s3 target")
+	}
+	if interval := backup.PointInTime.IntervalSeconds; interval != 0 && interval < minOplogArchiveIntervalSeconds {
+		return fmt.Errorf("the interval of pointInTime must be at least %d seconds", minOplogArchiveIntervalSeconds)
+	}
+	return nil
+}
+
+// oplogArchiveURL is the s3:// URL of the directory of the target the oplog is archived in
+func oplogArchiveURL(target mdbv1.BackupS3Target) string {
+	return s3BackupObject(target, oplogArchiveDir) + "/"
+}
+
+func oplogArchiveDeploymentNamespacedName(mdb mdbv1.MongoDB) types.NamespacedName {
+	return types.NamespacedName{Name: mdb.Name + "-oplog-archive", Namespace: mdb.Namespace}
+}
+
+// ensureOplogArchive creates or updates the Deployment archiving the oplog when
+// spec.backup.pointInTime is set, or deletes it, the archived oplog is kept. With the pbm method, the
+// oplog is archived by the pbm-agents instead.
+func (r *ReplicaSetReconciler) ensureOplogArchive(mdb mdbv1.MongoDB) error {
+	nsName := oplogArchiveDeploymentNamespacedName(mdb)
+	existing := appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), nsName, &existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting oplog archive Deployment: %s", err)
+	}
+	found := err == nil
+
+	if mdb.Spec.Backup == nil || mdb.Spec.Backup.PointInTime == nil || usesPBM(mdb) {
+		if !found {
+			return nil
+		}
+		if err := r.client.Delete(context.TODO(), &existing); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting oplog archive Deployment: %s", err)
+		}
+		r.log.Infof("Stopped archiving the oplog, deleted the Deployment %s", nsName.Name)
+		return nil
+	}
+
+	desired := buildOplogArchiveDeployment(mdb)
+	if !found {
+		if err := r.client.Create(context.TODO(), &desired); err != nil {
+			return fmt.Errorf("error creating oplog archive Deployment: %s", err)
+		}
+		r.log.Infof("Archiving the oplog to %s with the Deployment %s", oplogArchiveURL(*mdb.Spec.Backup.Target.S3), nsName.Name)
+		return nil
+	}
+	if reflect.DeepEqual(existing.Spec, desired.Spec) {
+		return nil
+	}
+	existing.Spec = desired.Spec
+	if err := r.client.Update(context.TODO(), &existing); err != nil {
+		return fmt.Errorf("error updating oplog archive Deployment: %s", err)
+	}
+	return nil
+}
+
+// buildOplogArchiveDeployment returns the Deployment archiving the oplog to the s3 target of
+// spec.backup. Every interval, the archive container dumps the entries added to the oplog since the
+// last archived one as a gzipped slice named <first>-<last>.bson.gz after the timestamps of the
+// entries it follows and ends with, and the upload container uploads the slices. An init container
+// resumes the archiving from the last uploaded slice when the Pod is replaced. The slices are
+// encrypted after being gzipped when spec.backup.encryption is set.
+func buildOplogArchiveDeployment(mdb mdbv1.MongoDB) appsv1.Deployment {
+	target := *mdb.Spec.Backup.Target.S3
+	interval := mdb.Spec.Backup.PointInTime.IntervalSeconds
+	if interval == 0 {
+		interval = defaultOplogArchiveIntervalSeconds
+	}
+	volume := statefulset.CreateVolumeFromEmptyDir("oplog")
+	volumeMount := statefulset.CreateVolumeMount(volume.Name, oplogPath, statefulset.WithReadOnly(false))
+	pending, last, dumpCode := oplogPath+"/pending", oplogPath+"/last", oplogPath+"/dump-code"
+	endpoint, archiveURL := s3EndpointOption(target), oplogArchiveURL(target)
+
+	resumeCommand := fmt.Sprintf(`mkdir -p %s && aws%s s3 ls "%s" | awk '{print $4}' | sort | tail -n 1 | sed -n 's/^.*-\([0-9]*\.[0-9]*\)\.bson\.gz$/\1/p' > %s`,
+		pending, endpoint, archiveURL, last)
+
+	uri, connectionOptions, connection := mongoToolConnection(mdb, oplogArchiveContainerName)
+	compress, encryption := "gzip", podtemplatespec.NOOP()
+	if mdb.Spec.Backup.Encryption != nil {
+		compress = "gzip | " + backupCryptCommand + " -encrypt"
+		encryption = podtemplatespec.Apply(
+			withBackupCrypt(oplogArchiveContainerName),
+			podtemplatespec.WithContainer(oplogArchiveContainerName, encryptionKey(*mdb.Spec.Backup.Encryption, encryptionKeyEnv)),
+		)
+	}
+	query := `{\"ts\": {\"\$gt\": {\"\$timestamp\": {\"t\": $3, \"i\": $4}}, \"\$lte\": {\"\$timestamp\": {\"t\": $5, \"i\": $6}}}}`
+	archiveCommand := strings.Join([]string{
+		fmt.Sprintf(`last=$(cat %s); while true; do`, last),
+		fmt.Sprintf(`range=$(mongo "%s"%s --quiet --eval "var last = \"$last\"; $OPLOG_RANGE_SCRIPT");`, uri, connectionOptions),
+		`case "$range" in`,
+		fmt.Sprintf(`start\ *) last=${range#start }; echo "Archiving the oplog after $last"; echo "$last" > %s ;;`, last),
+		fmt.Sprintf(`dump\ *) set -- $range; slice="%s/$last-$2.bson.gz";`, pending),
+		fmt.Sprintf(`{ mongodump --uri "%s"%s --db local --collection oplog.rs --query "%s" --out -; echo $? > %s; } | %s > "$slice.tmp"`, uri, connectionOptions, query, dumpCode, compress),
+		fmt.Sprintf(`&& [ "$(cat %s)" = 0 ] && mv "$slice.tmp" "$slice" && last=$2 && echo "$last" > %s ;;`, dumpCode, last),
+		`esac;`,
+		fmt.Sprintf(`sleep %d; done`, interval),
+	}, " ")
+
+	uploadCommand := fmt.Sprintf(`while true; do for slice in %s/*.bson.gz; do [ -e "$slice" ] || continue; aws%s s3 cp%s "$slice" "%s$(basename "$slice")" && rm "$slice"; done; sleep %d; done`,
+		pending, endpoint, s3EncryptionOptions(target), archiveURL, oplogUploadIntervalSeconds)
+
+	mongoImage := fmt.Sprintf("mongo:%s", mdb.Spec.Version)
+	labels := map[string]string{"app": mdb.Name + "-oplog-archive"}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		podtemplatespec.WithVolume(volume),
+		podtemplatespec.WithInitContainer("resume", container.Apply(
+			container.WithName("resume"),
+			container.WithImage(awsCLIImage),
+			container.WithCommand([]string{"/bin/sh", "-c", resumeCommand}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+			s3Credentials(target),
+		)),
+		podtemplatespec.WithContainer(oplogArchiveContainerName, container.Apply(
+			container.WithName(oplogArchiveContainerName),
+			container.WithImage(mongoImage),
+			container.WithCommand([]string{"/bin/sh", "-c", archiveCommand}),
+			container.WithEnvs(corev1.EnvVar{Name: "OPLOG_RANGE_SCRIPT", Value: oplogRangeScript}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+		)),
+		podtemplatespec.WithContainer(oplogUploadContainerName, container.Apply(
+			container.WithName(oplogUploadContainerName),
+			container.WithImage(awsCLIImage),
+			container.WithCommand([]string{"/bin/sh", "-c", uploadCommand}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+			s3Credentials(target),
+		)),
+		encryption,
+		connection,
+	)(&template)
+
+	replicas := int32(1)
+	nsName := oplogArchiveDeploymentNamespacedName(mdb)
+	return appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            nsName.Name,
+			Namespace:       nsName.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			// a single Pod archives the oplog at any time
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Template: template,
+		},
+	}
+}
+
+// archiveTime returns the time the archive restored was taken at, from the status of the
+// MongoDBBackup or from the name of the archive of a scheduled backup. The archives taken by
+// mongodump aren't consistent, the oplog is replayed from the start of the backup.
+func archiveTime(restore mdbv1.MongoDBRestore, backup *mdbv1.MongoDBBackup) (time.Time, bool) {
+	if backup != nil {
+		if backup.Status.StartTime == nil {
+			return time.Time{}, false
+		}
+		return backup.Status.StartTime.Time, true
+	}
+	match := scheduledArchiveTimeRegexp.FindStringSubmatch(path.Base(restore.Spec.ArchiveURL))
+	if match == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(scheduledBackupTimestampFmt, strings.ToUpper(match[1]))
+	return t, err == nil
+}
+
+// oplogReplay is the archived oplog replayed by a restore, from the time the archive was taken at up
+// to the point in time of the restore
+type oplogReplay struct {
+	target     mdbv1.BackupS3Target
+	encryption *mdbv1.BackupEncryption
+	from       time.Time
+	until      time.Time
+}
+
+// oplogReplaySource returns the modification downloading the slices of the archived oplog covering
+// the replay to the volume of the restore container, and the command gathering them into the file
+// replayed, decrypting them if the oplog was archived encrypted. The download fails if the slices
+// don't cover the whole replay.
+func oplogReplaySource(replay oplogReplay) (string, podtemplatespec.Modification) {
+	volume := statefulset.CreateVolumeFromEmptyDir("oplog")
+	volumeMount := statefulset.CreateVolumeMount(volume.Name, oplogPath, statefulset.WithReadOnly(false))
+	endpoint, archiveURL := s3EndpointOption(replay.target), oplogArchiveURL(replay.target)
+	from, until := replay.from.Unix(), replay.until.Unix()
+	slices := oplogPath + "/slices"
+
+	selectSlices := fmt.Sprintf(`$3 >= %d && $1 <= %d { if ((n == 0 && $1 > %d) || (n > 0 && $1 "." $2 != last)) { gap = 1; exit } print; last = $3 "." $4; end = $3; n++ } END { if (gap || n == 0 || end < %d) exit 1 }`,
+		from, until, from, until)
+	downloadCommand := strings.Join([]string{
+		fmt.Sprintf(`aws%s s3 ls "%s" | awk '{print $4}' | sort | awk -F'[-.]' '%s' > %s`, endpoint, archiveURL, selectSlices, slices),
+		fmt.Sprintf(`|| { echo "The archived oplog doesn't cover the time from %s to %s"; exit 1; };`, replay.from.UTC().Format(time.RFC3339), replay.until.UTC().Format(time.RFC3339)),
+		fmt.Sprintf(`while read slice; do aws%s s3 cp "%s$slice" "%s/$slice" || exit 1; done < %s`, endpoint, archiveURL, oplogPath, slices),
+	}, " ")
+
+	prepare := fmt.Sprintf(`cat %[1]s/*.bson.gz | gunzip > %[1]s/oplog.bson && mkdir -p %[1]s/dump`, oplogPath)
+	encryption := podtemplatespec.NOOP()
+	if replay.encryption != nil {
+		// each slice is decrypted to a file first, so that a slice which can't be authenticated fails
+		// the restore before any of it is replayed
+		prepare = fmt.Sprintf(`for slice in %[1]s/*.bson.gz; do %[2]s > "$slice.dec" && gunzip < "$slice.dec" >> %[1]s/oplog.bson && rm "$slice.dec" || exit 1; done && mkdir -p %[1]s/dump`,
+			oplogPath, decryptCommand(`"$slice"`, oplogEncryptionKeyEnv))
+		encryption = podtemplatespec.Apply(
+			withBackupCrypt(restoreContainerName),
+			podtemplatespec.WithContainer(restoreContainerName, encryptionKey(*replay.encryption, oplogEncryptionKeyEnv)),
+		)
+	}
+	return prepare, podtemplatespec.Apply(
+		encryption,
+		podtemplatespec.WithVolume(volume),
+		podtemplatespec.WithVolumeMounts(restoreContainerName, volumeMount),
+		podtemplatespec.WithInitContainer(oplogDownloadContainerName, container.Apply(
+			container.WithName(oplogDownloadContainerName),
+			container.WithImage(awsCLIImage),
+			container.WithCommand([]string{"/bin/sh", "-c", downloadCommand}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+			s3Credentials(replay.target),
+		)),
+	)
+}
+
+// oplogReplayCommand returns the mongorestore command replaying the gathered oplog up to the end of
+// the second of the point in time
+func oplogReplayCommand(uri, connectionOptions string, replay oplogReplay) string {
+	return fmt.Sprintf(`mongorestore --uri "%s"%s --oplogReplay --oplogFile=%s/oplog.bson --oplogLimit=%d:0 %s/dump`,
+		uri, connectionOptions, oplogPath, replay.until.Unix()+1, oplogPath)
+}
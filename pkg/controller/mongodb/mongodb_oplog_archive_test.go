@@ -0,0 +1,91 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newPointInTimeReplicaSet() mdbv1.MongoDB {
+	mdb := newBackupReplicaSet()
+	mdb.Spec.Backup.Target = mdbv1.BackupTarget{S3: &mdbv1.BackupS3Target{
+		Bucket:                "backups",
+		Prefix:                "my-rs",
+		Endpoint:              "http://minio:9000",
+		CredentialsSecretName: "minio-credentials",
+	}}
+	mdb.Spec.Backup.PointInTime = &mdbv1.BackupPointInTime{IntervalSeconds: 30}
+	return mdb
+}
+
+func TestEnsureOplogArchive(t *testing.T) {
+	mdb := newPointInTimeReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	deployment := appsv1.Deployment{}
+	assert.NoError(t, c.Get(context.TODO(), oplogArchiveDeploymentNamespacedName(mdb), &deployment))
+	assert.Equal(t, int32(1), *deployment.Spec.Replicas)
+	assert.Equal(t, appsv1.RecreateDeploymentStrategyType, deployment.Spec.Strategy.Type)
+	podSpec := deployment.Spec.Template.Spec
+	resume := podSpec.InitContainers[0]
+	assert.Contains(t, resume.Command[2], `aws --endpoint-url "http://minio:9000" s3 ls "s3://backups/my-rs/oplog/"`)
+	assert.Equal(t, "minio-credentials", resume.EnvFrom[0].SecretRef.Name)
+
+	archive, upload := podSpec.Containers[0], podSpec.Containers[1]
+	assert.Equal(t, "mongo:4.2.2", archive.Image)
+	assert.Contains(t, archive.Command[2], "--db local --collection oplog.rs")
+	assert.Contains(t, archive.Command[2], "sleep 30; done")
+	assert.Equal(t, "AGENT_PASSWORD", archive.Env[0].Name)
+	assert.Equal(t, "OPLOG_RANGE_SCRIPT", archive.Env[1].Name)
+	assert.Equal(t, awsCLIImage, upload.Image)
+	assert.Contains(t, upload.Command[2], `"s3://backups/my-rs/oplog/$(basename "$slice")" && rm "$slice"`)
+
+	t.Run("The Deployment is deleted once pointInTime is removed", func(t *testing.T) {
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		mdb.Spec.Backup.PointInTime = nil
+		assert.NoError(t, c.Update(context.TODO(), &mdb))
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+		assert.Error(t, c.Get(context.TODO(), oplogArchiveDeploymentNamespacedName(mdb), &appsv1.Deployment{}))
+	})
+}
+
+func TestValidateBackup_PointInTime(t *testing.T) {
+	mdb := newPointInTimeReplicaSet()
+	assert.NoError(t, validateBackup(mdb))
+
+	mdb.Spec.Backup.PointInTime.IntervalSeconds = 5
+	assert.EqualError(t, validateBackup(mdb), "the interval of pointInTime must be at least 10 seconds")
+
+	mdb = newBackupReplicaSet()
+	mdb.Spec.Backup.PointInTime = &mdbv1.BackupPointInTime{}
+	assert.EqualError(t, validateBackup(mdb), "pointInTime requires the mongodump or pbm method and an s3 target")
+}
+
+func TestArchiveTime(t *testing.T) {
+	restore := newTestMongoDBRestore()
+	restore.Spec.Backup, restore.Spec.ArchiveURL = "", "s3://backups/my-rs/my-rs-20260103T030000Z.archive.gz"
+	archivedAt, ok := archiveTime(restore, nil)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, 1, 3, 3, 0, 0, 0, time.UTC), archivedAt)
+
+	restore.Spec.ArchiveURL = "s3://backups/my-rs/my-rs-before-4.2.7-20260103t040000z.archive.gz"
+	archivedAt, ok = archiveTime(restore, nil)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, 1, 3, 4, 0, 0, 0, time.UTC), archivedAt)
+
+	restore.Spec.ArchiveURL = "https://backups.example.com/my-rs.archive.gz"
+	_, ok = archiveTime(restore, nil)
+	assert.False(t, ok)
+}
@@ -0,0 +1,376 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/opsmanager"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	monitoringAgentName = "monitoring-agent"
+
+	// monitoringUserName is the user the monitoring agent authenticates as, its password is stored in
+	// the Secret returned by MonitoringUserSecretNamespacedName
+	monitoringUserName = "mms-monitoring-agent"
+
+	// the fields of the Secret of spec.opsManager.apiKeySecretRef
+	opsManagerPublicKeyKey  = "publicKey"
+	opsManagerPrivateKeyKey = "privateKey"
+	// the fields of the Secret holding the agent API key created by the operator, the project it was
+	// created in is stored with it so that a new key is created when the project changes
+	agentAPIKeyKey          = "agentApiKey"
+	agentAPIKeyProjectIDKey = "projectId"
+
+	monitoringRegisteredReason    = "Registered"
+	monitoringNotRegisteredReason = "RegistrationFailed"
+
+	// the authentication mechanisms of the hosts registered in Ops Manager
+	opsManagerScramSha256Mechanism = "SCRAM_SHA_256"
+	opsManagerNoAuthMechanism      = "NONE"
+)
+
+// monitoringUserRoles are the privileges the monitoring agent needs to monitor the members
+var monitoringUserRoles = []automationconfig.Role{{Role: "clusterMonitor", Database: "admin"}}
+
+// opsManagerClientFactory returns the client of the Public API of the Ops Manager at baseURL,
+// authenticated with the public and private keys of a programmatic API key
+type opsManagerClientFactory func(baseURL, publicKey, privateKey string) opsmanager.API
+
+func newOpsManagerClient(baseURL, publicKey, privateKey string) opsmanager.API {
+	return opsmanager.NewClient(baseURL, publicKey, privateKey, nil)
+}
+
+func monitoringAgentNamespacedName(mdb mdbv1.MongoDB) types.NamespacedName {
+	return types.NamespacedName{Name: mdb.Name + "-" + monitoringAgentName, Namespace: mdb.Namespace}
+}
+
+// opsManagerHostnames returns the hostnames of the members, as they are registered in Ops Manager
+func opsManagerHostnames(mdb mdbv1.MongoDB) []string {
+	domain := getDomain(mdb.ServiceName(), mdb.Namespace, "")
+	hostnames := make([]string, mdb.Spec.Members)
+	for i := range hostnames {
+		hostnames[i] = fmt.Sprintf("%s-%d.%s", mdb.Name, i, domain)
+	}
+	return hostnames
+}
+
+// getMonitoringUserModification returns a modification which adds the user of the monitoring agent to
+// the automation config if spec.opsManager is set and authentication is enabled
+func (r ReplicaSetReconciler) getMonitoringUserModification(mdb mdbv1.MongoDB, currentAC automationconfig.AutomationConfig) (automationconfig.Modification, error) {
+	if mdb.Spec.OpsManager == nil || !mdb.Spec.Security.Authentication.Enabled {
+		return automationconfig.NOOP(), nil
+	}
+	return r.generatedUserModification(mdb, currentAC, monitoringUserName, monitoringUserRoles, mdb.MonitoringUserSecretNamespacedName())
+}
+
+// ensureOpsManagerMonitoring registers the members with the monitoring of Ops Manager and deploys the
+// agent monitoring them if spec.opsManager is set, and deletes the agent otherwise. The hosts stay
+// registered in the project when spec.opsManager is removed, as the operator can't reach Ops Manager
+// anymore. The outcome is reported by the MonitoringRegistered condition.
+func (r *ReplicaSetReconciler) ensureOpsManagerMonitoring(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.OpsManager == nil {
+		if err := r.deleteMonitoringAgent(mdb); err != nil {
+			return err
+		}
+		return r.updateOpsManagerStatus(mdb, nil, nil)
+	}
+
+	status, err := r.registerWithOpsManager(mdb)
+	if err != nil {
+		condition := newCondition(mdbv1.MonitoringRegistered, corev1.ConditionFalse, monitoringNotRegisteredReason, err.Error())
+		if statusErr := r.updateOpsManagerStatus(mdb, mdb.Status.OpsManager, &condition); statusErr != nil {
+			r.log.Warnf("Error updating Ops Manager status: %s", statusErr)
+		}
+		return err
+	}
+	message := fmt.Sprintf("%d members are registered in project %s", len(status.Hosts), status.ProjectID)
+	condition := newCondition(mdbv1.MonitoringRegistered, corev1.ConditionTrue, monitoringRegisteredReason, message)
+	return r.updateOpsManagerStatus(mdb, status, &condition)
+}
+
+// registerWithOpsManager registers the members in the project of spec.opsManager, unregisters the
+// members removed by a scale down, and deploys the agent monitoring them. The registration is checked
+// on every reconciliation, so that the hosts removed from the project are registered again.
+func (r *ReplicaSetReconciler) registerWithOpsManager(mdb mdbv1.MongoDB) (*mdbv1.OpsManagerStatus, error) {
+	spec := *mdb.Spec.OpsManager
+	keyNsName := types.NamespacedName{Name: spec.APIKeySecretRef.Name, Namespace: mdb.Namespace}
+	publicKey, err := secret.ReadKey(r.client, opsManagerPublicKeyKey, keyNsName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the public key of Secret %s: %s", keyNsName.Name, err)
+	}
+	privateKey, err := secret.ReadKey(r.client, opsManagerPrivateKeyKey, keyNsName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the private key of Secret %s: %s", keyNsName.Name, err)
+	}
+	api := r.opsManagerClient(spec.BaseURL, publicKey, privateKey)
+
+	projectID := spec.ProjectID
+	if projectID == "" {
+		if projectID, err = api.ProjectID(spec.ProjectName, spec.OrgID); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.ensureAgentAPIKey(mdb, api, projectID); err != nil {
+		return nil, err
+	}
+	hostnames, err := r.registerHosts(mdb, api, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ensureMonitoringAgent(mdb, projectID); err != nil {
+		return nil, err
+	}
+	params := map[string]string{}
+	if mdb.Spec.Security.TLS.Enabled {
+		params["sslTrustedServerCertificates"] = mongoToolCAFile(mdb)
+	}
+	if err := api.ActivateMonitoring(projectID, monitoringAgentNamespacedName(mdb).Name, params); err != nil {
+		return nil, err
+	}
+	return &mdbv1.OpsManagerStatus{ProjectID: projectID, Hosts: hostnames}, nil
+}
+
+// ensureAgentAPIKey creates an agent API key in the project, stored in a Secret owned by the resource,
+// unless the Secret already holds one created in the same project
+func (r *ReplicaSetReconciler) ensureAgentAPIKey(mdb mdbv1.MongoDB, api opsmanager.API, projectID string) error {
+	nsName := mdb.OpsManagerAgentAPIKeySecretNamespacedName()
+	existing, err := r.client.GetSecret(nsName)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting Secret %s: %s", nsName.Name, err)
+	}
+	if err == nil && string(existing.Data[agentAPIKeyProjectIDKey]) == projectID && len(existing.Data[agentAPIKeyKey]) > 0 {
+		return nil
+	}
+
+	key, err := api.CreateAgentAPIKey(projectID, fmt.Sprintf("MongoDB %s/%s", mdb.Namespace, mdb.Name))
+	if err != nil {
+		return err
+	}
+	s := secret.Builder().
+		SetName(nsName.Name).
+		SetNamespace(nsName.Namespace).
+		SetField(agentAPIKeyKey, key).
+		SetField(agentAPIKeyProjectIDKey, projectID).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
+		Build()
+	if err := secret.CreateOrUpdate(r.client, s); err != nil {
+		return fmt.Errorf("error writing Secret %s: %s", nsName.Name, err)
+	}
+	r.log.Infof("Created an agent API key in Ops Manager project %s", projectID)
+	return nil
+}
+
+// registerHosts registers the members which aren't registered in the project yet, and unregisters the
+// hosts of the members removed. It returns the hostnames of the members.
+func (r *ReplicaSetReconciler) registerHosts(mdb mdbv1.MongoDB, api opsmanager.API, projectID string) ([]string, error) {
+	hostnames := opsManagerHostnames(mdb)
+	registered, err := api.Hosts(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	desired := map[string]bool{}
+	for _, hostname := range hostnames {
+		desired[hostname] = true
+	}
+	// the hosts of the resource are the ones of its members, whatever their ordinal
+	prefix, suffix := mdb.Name+"-", "."+getDomain(mdb.ServiceName(), mdb.Namespace, "")
+	found := map[string]bool{}
+	for _, host := range registered {
+		if desired[host.Hostname] {
+			found[host.Hostname] = true
+			continue
+		}
+		if strings.HasPrefix(host.Hostname, prefix) && strings.HasSuffix(host.Hostname, suffix) {
+			if err := api.RemoveHost(projectID, host.ID); err != nil {
+				return nil, err
+			}
+			r.log.Infof("Unregistered host %s from Ops Manager project %s", host.Hostname, projectID)
+		}
+	}
+
+	var password string
+	if mdb.Spec.Security.Authentication.Enabled {
+		if password, err = r.ensureGeneratedPassword(mdb, mdb.MonitoringUserSecretNamespacedName()); err != nil {
+			return nil, err
+		}
+	}
+	for _, hostname := range hostnames {
+		if found[hostname] {
+			continue
+		}
+		host := opsmanager.Host{
+			Hostname:          hostname,
+			Port:              27017,
+			AuthMechanismName: opsManagerNoAuthMechanism,
+			SSLEnabled:        mdb.Spec.Security.TLS.Enabled,
+		}
+		if mdb.Spec.Security.Authentication.Enabled {
+			host.Username = monitoringUserName
+			host.Password = password
+			host.AuthMechanismName = opsManagerScramSha256Mechanism
+		}
+		if err := api.AddHost(projectID, host); err != nil {
+			return nil, err
+		}
+		r.log.Infof("Registered host %s in Ops Manager project %s", hostname, projectID)
+	}
+	sort.Strings(hostnames)
+	return hostnames, nil
+}
+
+// ensureMonitoringAgent creates or updates the Deployment of the agent monitoring the members
+func (r *ReplicaSetReconciler) ensureMonitoringAgent(mdb mdbv1.MongoDB, projectID string) error {
+	existing := appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), monitoringAgentNamespacedName(mdb), &existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting monitoring agent Deployment: %s", err)
+	}
+
+	desired := buildMonitoringAgentDeployment(mdb, projectID)
+	if errors.IsNotFound(err) {
+		if err := r.client.Create(context.TODO(), &desired); err != nil {
+			return fmt.Errorf("error creating monitoring agent Deployment: %s", err)
+		}
+		return nil
+	}
+	if reflect.DeepEqual(existing.Spec, desired.Spec) {
+		return nil
+	}
+	existing.Spec = desired.Spec
+	if err := r.client.Update(context.TODO(), &existing); err != nil {
+		return fmt.Errorf("error updating monitoring agent Deployment: %s", err)
+	}
+	return nil
+}
+
+// deleteMonitoringAgent deletes the Deployment of the monitoring agent if it exists
+func (r *ReplicaSetReconciler) deleteMonitoringAgent(mdb mdbv1.MongoDB) error {
+	existing := appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), monitoringAgentNamespacedName(mdb), &existing)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting monitoring agent Deployment: %s", err)
+	}
+	if err := r.client.Delete(context.TODO(), &existing); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting monitoring agent Deployment: %s", err)
+	}
+	r.log.Infof("Stopped the monitoring of Ops Manager, deleted the Deployment %s", existing.Name)
+	return nil
+}
+
+// buildMonitoringAgentDeployment returns the Deployment of the MongoDB Agent of the project of
+// spec.opsManager, which monitors the members once monitoring is activated on it. Its hostname is
+// fixed, so that its monitoring settings in the project apply to the Pod replacing it. The CA
+// certificate of the members is mounted when TLS is enabled.
+func buildMonitoringAgentDeployment(mdb mdbv1.MongoDB, projectID string) appsv1.Deployment {
+	nsName := monitoringAgentNamespacedName(mdb)
+	baseURL := mdb.Spec.OpsManager.BaseURL
+	if baseURL == "" {
+		baseURL = opsmanager.DefaultBaseURL
+	}
+	resources := corev1.ResourceRequirements{}
+	if mdb.Spec.OpsManager.Resources != nil {
+		resources = *mdb.Spec.OpsManager.Resources
+	}
+	command := fmt.Sprintf(`exec agent/mongodb-agent -mmsBaseUrl=%s -mmsGroupId=%s -mmsApiKey="$AGENT_API_KEY" -noDaemonize`, baseURL, projectID)
+
+	labels := map[string]string{"app": nsName.Name}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		podtemplatespec.WithHostname(nsName.Name),
+		podtemplatespec.WithContainer(monitoringAgentName, container.Apply(
+			container.WithName(monitoringAgentName),
+			container.WithImage(os.Getenv(agentImageEnv)),
+			container.WithCommand([]string{"/bin/sh", "-c", command}),
+			container.WithResourceRequirements(resources),
+			container.WithEnvs(corev1.EnvVar{
+				Name: "AGENT_API_KEY",
+				ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: mdb.OpsManagerAgentAPIKeySecretNamespacedName().Name},
+					Key:                  agentAPIKeyKey,
+				}},
+			}),
+		)),
+		monitoringAgentCAModification(mdb),
+	)(&template)
+
+	replicas := int32(1)
+	return appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            nsName.Name,
+			Namespace:       nsName.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			// a single agent with the hostname monitors the members at any time
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Template: template,
+		},
+	}
+}
+
+// monitoringAgentCAModification provides the CA certificate of the members to the monitoring agent at
+// the path of mongoToolCAFile when TLS is enabled, written by the Vault Agent injector if the
+// certificates are read from Vault
+func monitoringAgentCAModification(mdb mdbv1.MongoDB) podtemplatespec.Modification {
+	if usesVaultTLS(mdb) {
+		return podtemplatespec.WithAdditionalAnnotations(vaultAgentAnnotations(mdb, mdb.Spec.Security.TLS.VaultSecretPath, false, map[string][]string{
+			tlsCACertName: {tlsCACertName},
+		}))
+	}
+	if !mdb.Spec.Security.TLS.Enabled {
+		return podtemplatespec.NOOP()
+	}
+	caVolume := statefulset.CreateVolumeFromConfigMap("tls-ca", mdb.TLSConfigMapNamespacedName().Name)
+	return podtemplatespec.Apply(
+		podtemplatespec.WithVolume(caVolume),
+		podtemplatespec.WithVolumeMounts(monitoringAgentName, statefulset.CreateVolumeMount(caVolume.Name, mongoToolCAPath, statefulset.WithReadOnly(true))),
+	)
+}
+
+// updateOpsManagerStatus sets the Ops Manager status and the MonitoringRegistered condition of the
+// resource, or removes them if the condition is nil
+func (r *ReplicaSetReconciler) updateOpsManagerStatus(mdb mdbv1.MongoDB, status *mdbv1.OpsManagerStatus, condition *mdbv1.Condition) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	previous := newMdb.GetCondition(mdbv1.MonitoringRegistered)
+	conditionChanged := (condition == nil && previous != nil) || (condition != nil && isConditionChanged(previous, *condition))
+	if !conditionChanged && reflect.DeepEqual(newMdb.Status.OpsManager, status) {
+		return nil
+	}
+	newMdb.Status.OpsManager = status
+	if condition == nil {
+		newMdb.RemoveCondition(mdbv1.MonitoringRegistered)
+	} else {
+		newMdb.SetCondition(*condition)
+	}
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
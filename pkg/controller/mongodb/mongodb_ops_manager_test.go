@@ -0,0 +1,215 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/opsmanager"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeOpsManager holds the projects by name, and their hosts and monitoring settings by project ID
+type fakeOpsManager struct {
+	projects   map[string]string
+	hosts      map[string][]opsmanager.Host
+	monitoring map[string]map[string]string
+	keys       int
+	err        error
+}
+
+func newFakeOpsManager() *fakeOpsManager {
+	return &fakeOpsManager{
+		projects:   map[string]string{},
+		hosts:      map[string][]opsmanager.Host{},
+		monitoring: map[string]map[string]string{},
+	}
+}
+
+func (f *fakeOpsManager) ProjectID(name, _ string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	if _, ok := f.projects[name]; !ok {
+		f.projects[name] = fmt.Sprintf("project-%d", len(f.projects)+1)
+	}
+	return f.projects[name], nil
+}
+
+func (f *fakeOpsManager) CreateAgentAPIKey(projectID, _ string) (string, error) {
+	f.keys++
+	return fmt.Sprintf("%s-key-%d", projectID, f.keys), nil
+}
+
+func (f *fakeOpsManager) Hosts(projectID string) ([]opsmanager.Host, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.hosts[projectID], nil
+}
+
+func (f *fakeOpsManager) AddHost(projectID string, host opsmanager.Host) error {
+	host.ID = host.Hostname
+	f.hosts[projectID] = append(f.hosts[projectID], host)
+	return nil
+}
+
+func (f *fakeOpsManager) RemoveHost(projectID, hostID string) error {
+	var hosts []opsmanager.Host
+	for _, h := range f.hosts[projectID] {
+		if h.ID != hostID {
+			hosts = append(hosts, h)
+		}
+	}
+	f.hosts[projectID] = hosts
+	return nil
+}
+
+func (f *fakeOpsManager) ActivateMonitoring(projectID, hostname string, params map[string]string) error {
+	f.monitoring[projectID+"/"+hostname] = params
+	return nil
+}
+
+func newOpsManagerReplicaSet() mdbv1.MongoDB {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.OpsManager = &mdbv1.OpsManagerMonitoring{
+		ProjectName:     "my-project",
+		OrgID:           "my-org",
+		APIKeySecretRef: mdbv1.LocalObjectReference{Name: "ops-manager-key"},
+	}
+	return mdb
+}
+
+func newOpsManagerReconciler(t *testing.T, mdb mdbv1.MongoDB, fake *fakeOpsManager) (*ReplicaSetReconciler, client.Client) {
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.opsManagerClient = func(baseURL, publicKey, privateKey string) opsmanager.API {
+		assert.Equal(t, "public", publicKey)
+		assert.Equal(t, "private", privateKey)
+		return fake
+	}
+	apiKey := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops-manager-key", Namespace: mdb.Namespace},
+		Data:       map[string][]byte{"publicKey": []byte("public"), "privateKey": []byte("private")},
+	}
+	assert.NoError(t, c.Create(context.TODO(), &apiKey))
+	return r, c
+}
+
+func TestReconcile_OpsManagerMonitoring(t *testing.T) {
+	mdb := newOpsManagerReplicaSet()
+	fake := newFakeOpsManager()
+	r, c := newOpsManagerReconciler(t, mdb, fake)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	hosts := fake.hosts["project-1"]
+	if assert.Len(t, hosts, 3) {
+		assert.Equal(t, "my-rs-0.my-rs-svc.my-ns.svc.cluster.local", hosts[0].Hostname)
+		assert.Equal(t, 27017, hosts[0].Port)
+		assert.Equal(t, monitoringUserName, hosts[0].Username)
+		assert.Equal(t, "SCRAM_SHA_256", hosts[0].AuthMechanismName)
+		password, err := c.GetSecret(mdb.MonitoringUserSecretNamespacedName())
+		assert.NoError(t, err)
+		assert.Equal(t, string(password.Data[generatedUserPasswordKey]), hosts[0].Password)
+	}
+	assert.Contains(t, fake.monitoring, "project-1/my-rs-monitoring-agent")
+
+	keySecret, err := c.GetSecret(mdb.OpsManagerAgentAPIKeySecretNamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, "project-1-key-1", string(keySecret.Data[agentAPIKeyKey]))
+	assert.Equal(t, "project-1", string(keySecret.Data[agentAPIKeyProjectIDKey]))
+
+	deployment := appsv1.Deployment{}
+	assert.NoError(t, c.Get(context.TODO(), monitoringAgentNamespacedName(mdb), &deployment))
+	podSpec := deployment.Spec.Template.Spec
+	assert.Equal(t, "my-rs-monitoring-agent", podSpec.Hostname)
+	assert.Contains(t, podSpec.Containers[0].Command[2], "-mmsBaseUrl=https://cloud.mongodb.com -mmsGroupId=project-1")
+	assert.Equal(t, mdb.OpsManagerAgentAPIKeySecretNamespacedName().Name, podSpec.Containers[0].Env[0].ValueFrom.SecretKeyRef.Name)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.MonitoringRegistered, corev1.ConditionTrue, monitoringRegisteredReason)
+	assert.Equal(t, "project-1", mdb.Status.OpsManager.ProjectID)
+	assert.Len(t, mdb.Status.OpsManager.Hosts, 3)
+
+	ac, err := r.buildAutomationConfigFromSpec(mdb, automationconfig.AutomationConfig{})
+	assert.NoError(t, err)
+	var monitoringUser bool
+	for _, u := range ac.Auth.Users {
+		if u.Username == monitoringUserName {
+			monitoringUser = true
+			assert.Equal(t, "clusterMonitor", u.Roles[0].Role)
+		}
+	}
+	assert.True(t, monitoringUser, "the monitoring agent authenticates as a user of its own")
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Len(t, fake.hosts["project-1"], 3, "the hosts are registered once")
+	assert.Equal(t, 1, fake.keys, "the agent API key is created once")
+}
+
+func TestReconcile_OpsManagerMonitoring_ScaleDown(t *testing.T) {
+	mdb := newOpsManagerReplicaSet()
+	fake := newFakeOpsManager()
+	r, c := newOpsManagerReconciler(t, mdb, fake)
+
+	assert.NoError(t, r.ensureOpsManagerMonitoring(mdb))
+	fake.hosts["project-1"] = append(fake.hosts["project-1"], opsmanager.Host{ID: "other", Hostname: "other-0.other-svc.my-ns.svc.cluster.local"})
+
+	mdb.Spec.Members = 2
+	assert.NoError(t, r.ensureOpsManagerMonitoring(mdb))
+	var hostnames []string
+	for _, h := range fake.hosts["project-1"] {
+		hostnames = append(hostnames, h.Hostname)
+	}
+	assert.Equal(t, []string{
+		"my-rs-0.my-rs-svc.my-ns.svc.cluster.local",
+		"my-rs-1.my-rs-svc.my-ns.svc.cluster.local",
+		"other-0.other-svc.my-ns.svc.cluster.local",
+	}, hostnames, "only the hosts of the removed members are unregistered")
+
+	mdb.Spec.OpsManager = nil
+	assert.NoError(t, r.ensureOpsManagerMonitoring(mdb))
+	assert.Error(t, c.Get(context.TODO(), monitoringAgentNamespacedName(mdb), &appsv1.Deployment{}), "the monitoring agent is deleted")
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Nil(t, newMdb.Status.OpsManager)
+	assert.Nil(t, newMdb.GetCondition(mdbv1.MonitoringRegistered))
+}
+
+func TestReconcile_OpsManagerMonitoring_Failure(t *testing.T) {
+	mdb := newOpsManagerReplicaSet()
+	fake := newFakeOpsManager()
+	fake.err = opsmanager.Error{Status: 401}
+	r, c := newOpsManagerReconciler(t, mdb, fake)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Running, mdb.Status.Phase, "the monitoring doesn't block the reconciliation")
+	assertCondition(t, mdb, mdbv1.MonitoringRegistered, corev1.ConditionFalse, monitoringNotRegisteredReason)
+	assert.Equal(t, "status 401", mdb.GetCondition(mdbv1.MonitoringRegistered).Message)
+}
+
+func TestBuildMonitoringAgentDeployment_TLS(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mdb.Spec.OpsManager = &mdbv1.OpsManagerMonitoring{BaseURL: "https://ops-manager.example.com", ProjectID: "5e1"}
+	deployment := buildMonitoringAgentDeployment(mdb, "5e1")
+	podSpec := deployment.Spec.Template.Spec
+	assert.Contains(t, podSpec.Containers[0].Command[2], "-mmsBaseUrl=https://ops-manager.example.com -mmsGroupId=5e1")
+	assert.Equal(t, "tls-ca", podSpec.Volumes[0].Name)
+	assert.Equal(t, mongoToolCAPath, podSpec.Containers[0].VolumeMounts[0].MountPath)
+	assert.Equal(t, types.NamespacedName{Name: "my-rs-monitoring-agent", Namespace: mdb.Namespace}, monitoringAgentNamespacedName(mdb))
+}
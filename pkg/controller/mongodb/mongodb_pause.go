@@ -0,0 +1,40 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// updatePausedStatus updates the status of a paused resource without changing the deployment.
+// The members status describes the members of the current StatefulSet, as spec.members may
+// have been changed since the resource was paused.
+func (r ReplicaSetReconciler) updatePausedStatus(mdb mdbv1.MongoDB) error {
+	sts := appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), mdb.NamespacedName(), &sts)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	if err == nil {
+		mdb.Spec.Members = int(*sts.Spec.Replicas)
+		if err := r.updateMemberStatus(mdb); err != nil {
+			return err
+		}
+	}
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if newMdb.Status.Phase == mdbv1.Paused {
+		return nil
+	}
+	newMdb.Status.Phase = mdbv1.Paused
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPaused_PreventsChangesToTheDeployment(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Paused = true
+	mdb.Spec.Members = 5
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, res.RequeueAfter)
+
+	ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ac.Version)
+	assert.Len(t, ac.Processes, 3)
+
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), *sts.Spec.Replicas)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Paused, mdb.Status.Phase)
+	assert.Len(t, mdb.Status.Members, 3, "the status describes the current deployment")
+	assert.Equal(t, 3, mdb.Status.Replicas)
+
+	mdb.Spec.Paused = false
+	mdb.Spec.Members = 3
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Running, mdb.Status.Phase)
+}
@@ -0,0 +1,226 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// selectedNodeAnnotationKey is set by the scheduler on the PersistentVolumeClaims using a
+	// StorageClass with the WaitForFirstConsumer binding mode, once their Pod has been scheduled.
+	selectedNodeAnnotationKey = "volume.kubernetes.io/selected-node"
+
+	// volumeNodeAffinityConflictMessage is reported by the scheduler when a Pod can't be scheduled
+	// on any node satisfying the node affinity of its bound volumes, e.g. because the zone or the
+	// node a local volume is bound to has no capacity left or doesn't exist anymore.
+	volumeNodeAffinityConflictMessage = "volume node affinity conflict"
+
+	waitingForFirstConsumerReason    = "WaitingForFirstConsumer"
+	provisioningReason               = "Provisioning"
+	unschedulableReason              = "Unschedulable"
+	volumeNodeAffinityConflictReason = "VolumeNodeAffinityConflict"
+	provisioningFailedReason         = "ProvisioningFailed"
+	creationFailedReason             = "CreationFailed"
+
+	// failedCreateEventReason is the reason of the events of the StatefulSet when it can't create a Pod or its volumes
+	failedCreateEventReason             = "FailedCreate"
+	volumeProvisioningFailedEventReason = "VolumeProvisioningFailed"
+)
+
+// updatePendingVolumesStatus updates status.pendingVolumes of the resource with the volumes of
+// the members which are not bound yet, or which prevent their member from being scheduled.
+// Volumes using a StorageClass with the WaitForFirstConsumer binding mode are only bound once the
+// Pod of their member is scheduled, and are then bound to its zone or node. A member replaced
+// later on can only be scheduled where its volumes are, which is reported as a conflict if that
+// isn't possible anymore.
+// The VolumesProvisioned condition is set to false, and a Warning event is emitted, when volumes
+// can't be created, e.g. because of a quota, or can't be provisioned, e.g. because their
+// StorageClass doesn't exist.
+func (r ReplicaSetReconciler) updatePendingVolumesStatus(mdb mdbv1.MongoDB, sts appsv1.StatefulSet) error {
+	var pendingVolumes []mdbv1.PendingVolumeStatus
+	var missingVolumes []string
+	for i := 0; i < mdb.Spec.Members; i++ {
+		pod, err := r.getPod(types.NamespacedName{Name: fmt.Sprintf("%s-%d", sts.Name, i), Namespace: sts.Namespace})
+		if err != nil {
+			return err
+		}
+		for _, template := range sts.Spec.VolumeClaimTemplates {
+			nsName := types.NamespacedName{Name: volumeClaimName(template.Name, sts.Name, i), Namespace: sts.Namespace}
+			pvc := corev1.PersistentVolumeClaim{}
+			if err := r.client.Get(context.TODO(), nsName, &pvc); err != nil {
+				if !errors.IsNotFound(err) {
+					return fmt.Errorf("error getting PersistentVolumeClaim %s: %s", nsName, err)
+				}
+				// the volumes are created by the StatefulSet before the Pod
+				if pod == nil {
+					missingVolumes = append(missingVolumes, nsName.Name)
+				}
+				continue
+			}
+			if status := pendingVolumeStatus(pvc, pod); status != nil {
+				pendingVolumes = append(pendingVolumes, *status)
+			}
+		}
+	}
+
+	if len(pendingVolumes) > 0 || len(missingVolumes) > 0 {
+		events, err := r.latestWarningEvents(sts.Namespace)
+		if err != nil {
+			return err
+		}
+		pendingVolumes = append(provisioningFailures(pendingVolumes, events), creationFailures(missingVolumes, sts.Name, events)...)
+	}
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	previousCondition := newMdb.GetCondition(mdbv1.VolumesProvisioned)
+	condition := volumesProvisionedCondition(pendingVolumes)
+	if reflect.DeepEqual(newMdb.Status.PendingVolumes, pendingVolumes) && previousCondition != nil &&
+		previousCondition.Status == condition.Status && previousCondition.Message == condition.Message {
+		return nil
+	}
+	newMdb.Status.PendingVolumes = pendingVolumes
+	newMdb.SetCondition(condition)
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+
+	if condition.Status == corev1.ConditionFalse && r.recorder != nil {
+		r.recorder.Event(newMdb, corev1.EventTypeWarning, volumeProvisioningFailedEventReason, condition.Message)
+	}
+	return nil
+}
+
+// latestWarningEvents returns the most recent Warning event of every object in the namespace, by kind and name
+func (r ReplicaSetReconciler) latestWarningEvents(namespace string) (map[string]corev1.Event, error) {
+	eventList := corev1.EventList{}
+	if err := r.client.List(context.TODO(), &eventList, k8sClient.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("error listing events: %s", err)
+	}
+	events := map[string]corev1.Event{}
+	for _, event := range eventList.Items {
+		if event.Type != corev1.EventTypeWarning {
+			continue
+		}
+		key := eventKey(event.InvolvedObject.Kind, event.InvolvedObject.Name)
+		if latest, ok := events[key]; ok && event.LastTimestamp.Before(&latest.LastTimestamp) {
+			continue
+		}
+		events[key] = event
+	}
+	return events, nil
+}
+
+func eventKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+// provisioningFailures reports the pending volumes whose provisioning failed, according to
+// their latest Warning event, with the ProvisioningFailed reason.
+func provisioningFailures(pendingVolumes []mdbv1.PendingVolumeStatus, events map[string]corev1.Event) []mdbv1.PendingVolumeStatus {
+	for i, volume := range pendingVolumes {
+		if volume.Reason != waitingForFirstConsumerReason && volume.Reason != provisioningReason {
+			continue
+		}
+		if event, ok := events[eventKey("PersistentVolumeClaim", volume.Name)]; ok && event.Reason == provisioningFailedReason {
+			pendingVolumes[i].Reason = provisioningFailedReason
+			pendingVolumes[i].Message = event.Message
+		}
+	}
+	return pendingVolumes
+}
+
+// creationFailures returns the missing volumes which the StatefulSet failed to create, according
+// to its latest Warning event, with the CreationFailed reason.
+func creationFailures(missingVolumes []string, stsName string, events map[string]corev1.Event) []mdbv1.PendingVolumeStatus {
+	event, ok := events[eventKey("StatefulSet", stsName)]
+	if !ok || event.Reason != failedCreateEventReason {
+		return nil
+	}
+	var failures []mdbv1.PendingVolumeStatus
+	for _, name := range missingVolumes {
+		if strings.Contains(event.Message, name) {
+			failures = append(failures, mdbv1.PendingVolumeStatus{Name: name, Reason: creationFailedReason, Message: event.Message})
+		}
+	}
+	return failures
+}
+
+// volumesProvisionedCondition returns the VolumesProvisioned condition, which is false
+// if any volume couldn't be created or provisioned.
+func volumesProvisionedCondition(pendingVolumes []mdbv1.PendingVolumeStatus) mdbv1.Condition {
+	var messages []string
+	reason := ""
+	for _, volume := range pendingVolumes {
+		if volume.Reason != provisioningFailedReason && volume.Reason != creationFailedReason {
+			continue
+		}
+		reason = volume.Reason
+		messages = append(messages, fmt.Sprintf("%s: %s", volume.Name, volume.Message))
+	}
+	if len(messages) == 0 {
+		return mdbv1.Condition{Type: mdbv1.VolumesProvisioned, Status: corev1.ConditionTrue}
+	}
+	return mdbv1.Condition{
+		Type:    mdbv1.VolumesProvisioned,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: strings.Join(messages, "; "),
+	}
+}
+
+// getPod returns the Pod with the given name, or nil if it doesn't exist
+func (r ReplicaSetReconciler) getPod(nsName types.NamespacedName) (*corev1.Pod, error) {
+	pod := corev1.Pod{}
+	if err := r.client.Get(context.TODO(), nsName, &pod); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting pod %s: %s", nsName, err)
+	}
+	return &pod, nil
+}
+
+// pendingVolumeStatus returns the status of the PersistentVolumeClaim used by the given Pod,
+// or nil if it is bound and doesn't prevent the Pod from being scheduled.
+func pendingVolumeStatus(pvc corev1.PersistentVolumeClaim, pod *corev1.Pod) *mdbv1.PendingVolumeStatus {
+	unschedulable := unschedulableCondition(pod)
+	if pvc.Status.Phase != corev1.ClaimPending {
+		if unschedulable != nil && strings.Contains(unschedulable.Message, volumeNodeAffinityConflictMessage) {
+			return &mdbv1.PendingVolumeStatus{Name: pvc.Name, Reason: volumeNodeAffinityConflictReason, Message: unschedulable.Message}
+		}
+		return nil
+	}
+
+	if unschedulable != nil {
+		return &mdbv1.PendingVolumeStatus{Name: pvc.Name, Reason: unschedulableReason, Message: unschedulable.Message}
+	}
+	if _, ok := pvc.Annotations[selectedNodeAnnotationKey]; !ok {
+		return &mdbv1.PendingVolumeStatus{Name: pvc.Name, Reason: waitingForFirstConsumerReason, Message: "waiting for the Pod of the member to be scheduled"}
+	}
+	return &mdbv1.PendingVolumeStatus{Name: pvc.Name, Reason: provisioningReason, Message: fmt.Sprintf("waiting for the volume to be provisioned on node %s", pvc.Annotations[selectedNodeAnnotationKey])}
+}
+
+// unschedulableCondition returns the PodScheduled condition of the Pod if the Pod can't be scheduled
+func unschedulableCondition(pod *corev1.Pod) *corev1.PodCondition {
+	if pod == nil {
+		return nil
+	}
+	for i, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func unschedulablePod(message string) *corev1.Pod {
+	return &corev1.Pod{
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{
+				Type:    corev1.PodScheduled,
+				Status:  corev1.ConditionFalse,
+				Reason:  corev1.PodReasonUnschedulable,
+				Message: message,
+			}},
+		},
+	}
+}
+
+func TestPendingVolumeStatus(t *testing.T) {
+	pending := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data-volume-mdb-0"},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+	}
+	bound := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data-volume-mdb-0"},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+	provisioning := *pending.DeepCopy()
+	provisioning.Annotations = map[string]string{selectedNodeAnnotationKey: "node-1"}
+
+	t.Run("Bound volumes are not pending", func(t *testing.T) {
+		assert.Nil(t, pendingVolumeStatus(bound, &corev1.Pod{}))
+		assert.Nil(t, pendingVolumeStatus(bound, unschedulablePod("0/3 nodes are available: 3 Insufficient cpu.")))
+	})
+
+	t.Run("Volume waiting for the Pod to be scheduled", func(t *testing.T) {
+		status := pendingVolumeStatus(pending, nil)
+		assert.Equal(t, waitingForFirstConsumerReason, status.Reason)
+	})
+
+	t.Run("Volume being provisioned", func(t *testing.T) {
+		status := pendingVolumeStatus(provisioning, &corev1.Pod{})
+		assert.Equal(t, provisioningReason, status.Reason)
+		assert.Contains(t, status.Message, "node-1")
+	})
+
+	t.Run("Pod can't be scheduled", func(t *testing.T) {
+		status := pendingVolumeStatus(pending, unschedulablePod("0/3 nodes are available: 3 node(s) didn't find available persistent volumes to bind."))
+		assert.Equal(t, mdbv1.PendingVolumeStatus{
+			Name:    "data-volume-mdb-0",
+			Reason:  unschedulableReason,
+			Message: "0/3 nodes are available: 3 node(s) didn't find available persistent volumes to bind.",
+		}, *status)
+	})
+
+	t.Run("Bound volume in another zone", func(t *testing.T) {
+		status := pendingVolumeStatus(bound, unschedulablePod("0/3 nodes are available: 3 node(s) had volume node affinity conflict."))
+		assert.Equal(t, volumeNodeAffinityConflictReason, status.Reason)
+	})
+}
+
+func TestPendingVolumes_AreReportedInStatus(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	pvc := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: volumeClaimName(dataVolumeName, mdb.Name, 1), Namespace: mdb.Namespace},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+	}
+	assert.NoError(t, mgrClient.Create(context.TODO(), &pvc))
+
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	_ = mgrClient.Get(context.TODO(), types.NamespacedName{Name: mdb.Name, Namespace: mdb.Namespace}, &mdb)
+	assert.Len(t, mdb.Status.PendingVolumes, 1)
+	assert.Equal(t, pvc.Name, mdb.Status.PendingVolumes[0].Name)
+	assert.Equal(t, waitingForFirstConsumerReason, mdb.Status.PendingVolumes[0].Reason)
+}
+
+func TestVolumesProvisionedCondition(t *testing.T) {
+	t.Run("Provisioning failures are reported", func(t *testing.T) {
+		pendingVolumes := []mdbv1.PendingVolumeStatus{
+			{Name: "data-volume-mdb-0", Reason: waitingForFirstConsumerReason},
+			{Name: "data-volume-mdb-1", Reason: provisioningReason},
+		}
+		events := map[string]corev1.Event{
+			eventKey("PersistentVolumeClaim", "data-volume-mdb-1"): {
+				Reason:  provisioningFailedReason,
+				Message: `storageclass.storage.k8s.io "fast" not found`,
+			},
+		}
+		pendingVolumes = provisioningFailures(pendingVolumes, events)
+		assert.Equal(t, waitingForFirstConsumerReason, pendingVolumes[0].Reason)
+		assert.Equal(t, provisioningFailedReason, pendingVolumes[1].Reason)
+
+		condition := volumesProvisionedCondition(pendingVolumes)
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, provisioningFailedReason, condition.Reason)
+		assert.Equal(t, `data-volume-mdb-1: storageclass.storage.k8s.io "fast" not found`, condition.Message)
+	})
+
+	t.Run("Creation failures are reported", func(t *testing.T) {
+		message := `create Claim data-volume-mdb-2 for Pod mdb-2 in StatefulSet mdb failed error: persistentvolumeclaims "data-volume-mdb-2" is forbidden: exceeded quota: storage`
+		events := map[string]corev1.Event{
+			eventKey("StatefulSet", "mdb"): {Reason: failedCreateEventReason, Message: message},
+		}
+		failures := creationFailures([]string{"data-volume-mdb-2"}, "mdb", events)
+		assert.Equal(t, []mdbv1.PendingVolumeStatus{{Name: "data-volume-mdb-2", Reason: creationFailedReason, Message: message}}, failures)
+
+		condition := volumesProvisionedCondition(failures)
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, creationFailedReason, condition.Reason)
+	})
+
+	t.Run("Volumes waiting to be bound are not failures", func(t *testing.T) {
+		condition := volumesProvisionedCondition([]mdbv1.PendingVolumeStatus{{Name: "data-volume-mdb-0", Reason: waitingForFirstConsumerReason}})
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	})
+}
@@ -0,0 +1,119 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// agentStatusPort is the port the agent serves its status on, see agentCommand
+	agentStatusPort     = 5000
+	agentStatusPortName = "agent-status"
+	metricsPortName     = "metrics"
+)
+
+// podMonitorGVK is the kind of the PodMonitors of the Prometheus Operator, which is used through
+// unstructured objects so that the operator doesn't depend on its CRDs being installed
+var podMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PodMonitor"}
+
+func isPodMonitorEnabled(mdb mdbv1.MongoDB) bool {
+	return mdb.Spec.Prometheus != nil && mdb.Spec.Prometheus.PodMonitor != nil
+}
+
+// ensurePodMonitor creates or updates the PodMonitor of the members if spec.prometheus.podMonitor is set,
+// and deletes it otherwise. Nothing is done if the CRDs of the Prometheus Operator aren't installed.
+func (r *ReplicaSetReconciler) ensurePodMonitor(mdb mdbv1.MongoDB) error {
+	desired := buildPodMonitor(mdb)
+	existing := unstructured.Unstructured{}
+	existing.SetGroupVersionKind(podMonitorGVK)
+	err := r.client.Get(context.TODO(), mdb.NamespacedName(), &existing)
+	if meta.IsNoMatchError(err) {
+		if isPodMonitorEnabled(mdb) {
+			r.log.Warnf("The PodMonitor can't be created as the Prometheus Operator isn't installed")
+		}
+		return nil
+	}
+	if errors.IsNotFound(err) {
+		if !isPodMonitorEnabled(mdb) {
+			return nil
+		}
+		if err := r.client.Create(context.TODO(), &desired); err != nil {
+			return fmt.Errorf("error creating PodMonitor: %s", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting PodMonitor: %s", err)
+	}
+
+	if !isPodMonitorEnabled(mdb) {
+		if !metav1.IsControlledBy(&existing, &mdb) {
+			return nil
+		}
+		if err := r.client.Delete(context.TODO(), &existing); err != nil {
+			return fmt.Errorf("error deleting PodMonitor: %s", err)
+		}
+		return nil
+	}
+	if reflect.DeepEqual(existing.Object["spec"], desired.Object["spec"]) && reflect.DeepEqual(existing.GetLabels(), desired.GetLabels()) {
+		return nil
+	}
+	existing.Object["spec"] = desired.Object["spec"]
+	existing.SetLabels(desired.GetLabels())
+	if err := r.client.Update(context.TODO(), &existing); err != nil {
+		return fmt.Errorf("error updating PodMonitor: %s", err)
+	}
+	return nil
+}
+
+// buildPodMonitor returns the PodMonitor scraping the exporter and the status endpoint of the agent of
+// every member. It is owned by the resource, so that it is deleted with it.
+func buildPodMonitor(mdb mdbv1.MongoDB) unstructured.Unstructured {
+	podMonitor := unstructured.Unstructured{}
+	podMonitor.SetGroupVersionKind(podMonitorGVK)
+	podMonitor.SetName(mdb.Name)
+	podMonitor.SetNamespace(mdb.Namespace)
+	podMonitor.SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)})
+	if !isPodMonitorEnabled(mdb) {
+		return podMonitor
+	}
+	if len(mdb.Spec.Prometheus.PodMonitor.Labels) > 0 {
+		podMonitor.SetLabels(mdb.Spec.Prometheus.PodMonitor.Labels)
+	}
+
+	var endpoints []interface{}
+	for _, port := range []string{metricsPortName, agentStatusPortName} {
+		endpoint := map[string]interface{}{"port": port}
+		if interval := mdb.Spec.Prometheus.PodMonitor.Interval; interval != "" {
+			endpoint["interval"] = interval
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	podMonitor.Object["spec"] = map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{"app": mdb.ServiceName()},
+		},
+		"podMetricsEndpoints": endpoints,
+	}
+	return podMonitor
+}
+
+// buildAgentStatusPortModification names the status port of the agent if spec.prometheus.podMonitor
+// is set, so that it can be scraped by the PodMonitor
+func buildAgentStatusPortModification(mdb mdbv1.MongoDB) podtemplatespec.Modification {
+	if !isPodMonitorEnabled(mdb) {
+		return podtemplatespec.NOOP()
+	}
+	return podtemplatespec.WithContainer(agentName, container.WithPorts([]corev1.ContainerPort{{Name: agentStatusPortName, ContainerPort: agentStatusPort}}))
+}
@@ -0,0 +1,120 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// noPrometheusOperatorClient is a client of a cluster without the CRDs of the Prometheus Operator
+type noPrometheusOperatorClient struct {
+	client.Client
+}
+
+func (c noPrometheusOperatorClient) Get(ctx context.Context, key k8sClient.ObjectKey, obj runtime.Object) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return &meta.NoKindMatchError{GroupKind: u.GroupVersionKind().GroupKind()}
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func getPodMonitor(c client.Client, mdb mdbv1.MongoDB) (unstructured.Unstructured, error) {
+	podMonitor := unstructured.Unstructured{}
+	podMonitor.SetGroupVersionKind(podMonitorGVK)
+	err := c.Get(context.TODO(), mdb.NamespacedName(), &podMonitor)
+	return podMonitor, err
+}
+
+func TestPodMonitor_IsCreatedForTheExporterAndTheAgent(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{PodMonitor: &mdbv1.PodMonitor{Interval: "30s", Labels: map[string]string{"release": "prometheus"}}}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	podMonitor, err := getPodMonitor(mgr.Client, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"release": "prometheus"}, podMonitor.GetLabels())
+	assert.Equal(t, mdb.Name, podMonitor.GetOwnerReferences()[0].Name)
+
+	selector, _, _ := unstructured.NestedStringMap(podMonitor.Object, "spec", "selector", "matchLabels")
+	assert.Equal(t, map[string]string{"app": mdb.ServiceName()}, selector)
+	endpoints, _, _ := unstructured.NestedSlice(podMonitor.Object, "spec", "podMetricsEndpoints")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"port": metricsPortName, "interval": "30s"},
+		map[string]interface{}{"port": agentStatusPortName, "interval": "30s"},
+	}, endpoints)
+
+	t.Run("The status port of the agent is named", func(t *testing.T) {
+		sts, err := mgr.Client.GetStatefulSet(mdb.NamespacedName())
+		assert.NoError(t, err)
+		assert.Equal(t, []corev1.ContainerPort{{Name: agentStatusPortName, ContainerPort: agentStatusPort}}, sts.Spec.Template.Spec.Containers[0].Ports)
+	})
+
+	t.Run("The PodMonitor is deleted once disabled", func(t *testing.T) {
+		mdb.Spec.Prometheus.PodMonitor = nil
+		err := r.ensurePodMonitor(mdb)
+		assert.NoError(t, err)
+
+		_, err = getPodMonitor(mgr.Client, mdb)
+		assert.True(t, errors.IsNotFound(err))
+	})
+}
+
+func TestPodMonitor_IsUpdated(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{PodMonitor: &mdbv1.PodMonitor{}}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	assert.NoError(t, r.ensurePodMonitor(mdb))
+
+	mdb.Spec.Prometheus.PodMonitor.Interval = "1m"
+	assert.NoError(t, r.ensurePodMonitor(mdb))
+
+	podMonitor, err := getPodMonitor(mgr.Client, mdb)
+	assert.NoError(t, err)
+	endpoints, _, _ := unstructured.NestedSlice(podMonitor.Object, "spec", "podMetricsEndpoints")
+	assert.Equal(t, "1m", endpoints[0].(map[string]interface{})["interval"])
+}
+
+func TestPodMonitor_IsSkippedWithoutThePrometheusOperator(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{PodMonitor: &mdbv1.PodMonitor{}}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.client = noPrometheusOperatorClient{Client: r.client}
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_, err = getPodMonitor(mgr.Client, mdb)
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestPodMonitor_IsNotCreatedByDefault(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_, err = getPodMonitor(mgr.Client, mdb)
+	assert.True(t, errors.IsNotFound(err))
+
+	sts, err := mgr.Client.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Empty(t, sts.Spec.Template.Spec.Containers[0].Ports)
+}
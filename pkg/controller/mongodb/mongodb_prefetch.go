@@ -0,0 +1,231 @@
+package mongodb
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	kubernetesClient "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// prefetchingClient serves the objects read ahead of the steps of a reconciliation which need them,
+// so that the Secrets and ConfigMaps referenced by the resource, which aren't cached until they're
+// labelled and are otherwise read from the API one after the other, are read concurrently. An object
+// written through the client is read from the cluster again.
+type prefetchingClient struct {
+	kubernetesClient.Client
+
+	mu      sync.Mutex
+	objects map[prefetchKey]prefetchedObject
+}
+
+// prefetchKey identifies an object by its type and namespaced name
+type prefetchKey struct {
+	objType reflect.Type
+	nsName  types.NamespacedName
+}
+
+// prefetchedObject is an object read ahead, or the NotFound error it couldn't be read with
+type prefetchedObject struct {
+	obj runtime.Object
+	err error
+}
+
+// prefetchRequest is an object to read ahead, into obj
+type prefetchRequest struct {
+	nsName types.NamespacedName
+	obj    runtime.Object
+}
+
+func newPrefetchingClient(c kubernetesClient.Client) *prefetchingClient {
+	return &prefetchingClient{Client: c, objects: map[prefetchKey]prefetchedObject{}}
+}
+
+// prefetch reads the objects concurrently, an object which can't be read for another reason than not
+// existing is read again by the step which needs it, which reports the error
+func (c *prefetchingClient) prefetch(requests ...prefetchRequest) {
+	var wg sync.WaitGroup
+	for _, request := range requests {
+		if request.nsName.Name == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(request prefetchRequest) {
+			defer wg.Done()
+			err := c.Client.Get(context.TODO(), request.nsName, request.obj)
+			if err != nil && !errors.IsNotFound(err) {
+				return
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.objects[prefetchKey{objType: reflect.TypeOf(request.obj), nsName: request.nsName}] = prefetchedObject{obj: request.obj, err: err}
+		}(request)
+	}
+	wg.Wait()
+}
+
+// prefetched copies the object read ahead into obj, it returns false if it wasn't read ahead
+func (c *prefetchingClient) prefetched(key k8sClient.ObjectKey, obj runtime.Object) (bool, error) {
+	c.mu.Lock()
+	prefetched, ok := c.objects[prefetchKey{objType: reflect.TypeOf(obj), nsName: key}]
+	c.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if prefetched.err != nil {
+		return true, prefetched.err
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(prefetched.obj.DeepCopyObject()).Elem())
+	return true, nil
+}
+
+func (c *prefetchingClient) Get(ctx context.Context, key k8sClient.ObjectKey, obj runtime.Object) error {
+	if ok, err := c.prefetched(key, obj); ok {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func (c *prefetchingClient) GetSecret(objectKey k8sClient.ObjectKey) (corev1.Secret, error) {
+	s := corev1.Secret{}
+	if ok, err := c.prefetched(objectKey, &s); ok {
+		return s, err
+	}
+	return c.Client.GetSecret(objectKey)
+}
+
+func (c *prefetchingClient) GetConfigMap(objectKey k8sClient.ObjectKey) (corev1.ConfigMap, error) {
+	cm := corev1.ConfigMap{}
+	if ok, err := c.prefetched(objectKey, &cm); ok {
+		return cm, err
+	}
+	return c.Client.GetConfigMap(objectKey)
+}
+
+func (c *prefetchingClient) Create(ctx context.Context, obj runtime.Object, opts ...k8sClient.CreateOption) error {
+	c.forget(obj)
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *prefetchingClient) Update(ctx context.Context, obj runtime.Object, opts ...k8sClient.UpdateOption) error {
+	c.forget(obj)
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *prefetchingClient) Patch(ctx context.Context, obj runtime.Object, patch k8sClient.Patch, opts ...k8sClient.PatchOption) error {
+	c.forget(obj)
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *prefetchingClient) Delete(ctx context.Context, obj runtime.Object, opts ...k8sClient.DeleteOption) error {
+	c.forget(obj)
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *prefetchingClient) MergePatch(original, obj runtime.Object) error {
+	c.forget(obj)
+	return c.Client.MergePatch(original, obj)
+}
+
+func (c *prefetchingClient) StrategicMergePatch(original, obj runtime.Object) error {
+	c.forget(obj)
+	return c.Client.StrategicMergePatch(original, obj)
+}
+
+func (c *prefetchingClient) Apply(obj kubernetesClient.Object) error {
+	c.forget(obj)
+	return c.Client.Apply(obj)
+}
+
+func (c *prefetchingClient) GetAndUpdate(nsName types.NamespacedName, obj runtime.Object, updateFunc func()) error {
+	c.forgetKey(reflect.TypeOf(obj), nsName)
+	return c.Client.GetAndUpdate(nsName, obj, updateFunc)
+}
+
+func (c *prefetchingClient) UpdateSecret(secret corev1.Secret) error {
+	c.forget(&secret)
+	return c.Client.UpdateSecret(secret)
+}
+
+func (c *prefetchingClient) CreateSecret(secret corev1.Secret) error {
+	c.forget(&secret)
+	return c.Client.CreateSecret(secret)
+}
+
+func (c *prefetchingClient) ApplySecret(secret corev1.Secret) error {
+	c.forget(&secret)
+	return c.Client.ApplySecret(secret)
+}
+
+func (c *prefetchingClient) DeleteSecret(key k8sClient.ObjectKey) error {
+	c.forgetKey(reflect.TypeOf(&corev1.Secret{}), key)
+	return c.Client.DeleteSecret(key)
+}
+
+func (c *prefetchingClient) UpdateConfigMap(cm corev1.ConfigMap) error {
+	c.forget(&cm)
+	return c.Client.UpdateConfigMap(cm)
+}
+
+func (c *prefetchingClient) CreateConfigMap(cm corev1.ConfigMap) error {
+	c.forget(&cm)
+	return c.Client.CreateConfigMap(cm)
+}
+
+func (c *prefetchingClient) DeleteConfigMap(key k8sClient.ObjectKey) error {
+	c.forgetKey(reflect.TypeOf(&corev1.ConfigMap{}), key)
+	return c.Client.DeleteConfigMap(key)
+}
+
+// forget drops the object read ahead, once it is written
+func (c *prefetchingClient) forget(obj runtime.Object) {
+	nsName, err := k8sClient.ObjectKeyFromObject(obj)
+	if err != nil {
+		return
+	}
+	c.forgetKey(reflect.TypeOf(obj), nsName)
+}
+
+func (c *prefetchingClient) forgetKey(objType reflect.Type, nsName types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.objects, prefetchKey{objType: objType, nsName: nsName})
+}
+
+// prefetchReferences reads the objects the reconciliation of the resource reads first concurrently:
+// the TLS Secret and CA ConfigMap, the password Secrets of the users, the dependent resources and the
+// automation config
+func (r *ReplicaSetReconciler) prefetchReferences(mdb mdbv1.MongoDB) {
+	if r.prefetching == nil {
+		return
+	}
+	requests := []prefetchRequest{
+		{nsName: types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}, obj: &corev1.ConfigMap{}},
+	}
+	if mdb.Spec.Security.TLS.Enabled && !usesVaultTLS(mdb) {
+		requests = append(requests,
+			prefetchRequest{nsName: mdb.TLSSecretNamespacedName(), obj: &corev1.Secret{}},
+			prefetchRequest{nsName: mdb.TLSConfigMapNamespacedName(), obj: &corev1.ConfigMap{}},
+		)
+	}
+	for _, user := range mdb.Spec.Users {
+		if user.PasswordVaultRef == nil {
+			requests = append(requests, prefetchRequest{nsName: types.NamespacedName{Name: user.PasswordSecretRef.Name, Namespace: mdb.Namespace}, obj: &corev1.Secret{}})
+		}
+	}
+	for _, dependent := range mdb.Spec.DependentResources {
+		nsName := types.NamespacedName{Name: dependent.Name, Namespace: mdb.Namespace}
+		if dependent.Kind == mdbv1.DependentSecret {
+			requests = append(requests, prefetchRequest{nsName: nsName, obj: &corev1.Secret{}})
+		} else {
+			requests = append(requests, prefetchRequest{nsName: nsName, obj: &corev1.ConfigMap{}})
+		}
+	}
+	r.prefetching.prefetch(requests...)
+}
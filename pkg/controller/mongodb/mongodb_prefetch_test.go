@@ -0,0 +1,80 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// secretReadCounter counts the Secrets read from the client it wraps
+type secretReadCounter struct {
+	client.Client
+	reads int
+}
+
+func (c *secretReadCounter) Get(ctx context.Context, key k8sClient.ObjectKey, obj runtime.Object) error {
+	if _, ok := obj.(*corev1.Secret); ok {
+		c.reads++
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func (c *secretReadCounter) GetSecret(objectKey k8sClient.ObjectKey) (corev1.Secret, error) {
+	s := corev1.Secret{}
+	return s, c.Get(context.TODO(), objectKey, &s)
+}
+
+func TestPrefetchingClient(t *testing.T) {
+	secretName := types.NamespacedName{Name: "my-secret", Namespace: "my-ns"}
+	secret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName.Name, Namespace: secretName.Namespace}, StringData: map[string]string{"password": "pwd"}}
+	reads := &secretReadCounter{Client: client.NewClient(client.NewManager(&secret).GetClient())}
+	c := newPrefetchingClient(reads)
+
+	missingName := types.NamespacedName{Name: "missing", Namespace: "my-ns"}
+	c.prefetch(
+		prefetchRequest{nsName: secretName, obj: &corev1.Secret{}},
+		prefetchRequest{nsName: missingName, obj: &corev1.ConfigMap{}},
+	)
+	assert.Equal(t, 1, reads.reads)
+
+	s, err := c.GetSecret(secretName)
+	assert.NoError(t, err)
+	assert.Equal(t, "pwd", s.StringData["password"])
+	s.StringData["password"] = "changed"
+	s, _ = c.GetSecret(secretName)
+	assert.Equal(t, "pwd", s.StringData["password"], "a copy of the prefetched object is served")
+	assert.Equal(t, 1, reads.reads, "the prefetched objects aren't read again")
+
+	_, err = c.GetConfigMap(missingName)
+	assert.True(t, errors.IsNotFound(err), "the objects which don't exist are prefetched too")
+
+	s.StringData["password"] = "changed"
+	assert.NoError(t, c.UpdateSecret(s))
+	s, err = c.GetSecret(secretName)
+	assert.NoError(t, err)
+	assert.Equal(t, "changed", s.StringData["password"])
+	assert.Equal(t, 2, reads.reads, "the written objects are read again")
+}
+
+func TestReconcile_PrefetchedObjectsAreOnlyServedToTheReconciliation(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	reads := &secretReadCounter{Client: r.client}
+	r.client = reads
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Same(t, reads, r.client, "the client is restored once the reconciliation is done")
+	assert.Nil(t, r.prefetching)
+}
@@ -0,0 +1,104 @@
+package mongodb
+
+import (
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	exporterName         = "mongodb-exporter"
+	defaultExporterImage = "percona/mongodb_exporter:0.40.0"
+	defaultExporterPort  = 9216
+
+	// metricsUserName is the user mongodb_exporter authenticates as, its password is stored
+	// in the Secret returned by MetricsUserSecretNamespacedName
+	metricsUserName = "mongodb-exporter"
+)
+
+// metricsUserRoles are the least privileges which allow mongodb_exporter to collect all its metrics
+var metricsUserRoles = []automationconfig.Role{
+	{Role: "clusterMonitor", Database: "admin"},
+	{Role: "read", Database: "local"},
+}
+
+func exporterImage(mdb mdbv1.MongoDB) string {
+	if mdb.Spec.Prometheus.Image != "" {
+		return mdb.Spec.Prometheus.Image
+	}
+	return defaultExporterImage
+}
+
+func exporterPort(mdb mdbv1.MongoDB) int {
+	if mdb.Spec.Prometheus.Port != 0 {
+		return mdb.Spec.Prometheus.Port
+	}
+	return defaultExporterPort
+}
+
+// getMetricsUserModification returns a modification which adds the user of mongodb_exporter to the
+// automation config if spec.prometheus is set and authentication is enabled
+func (r ReplicaSetReconciler) getMetricsUserModification(mdb mdbv1.MongoDB, currentAC automationconfig.AutomationConfig) (automationconfig.Modification, error) {
+	if mdb.Spec.Prometheus == nil || !mdb.Spec.Security.Authentication.Enabled {
+		return automationconfig.NOOP(), nil
+	}
+	return r.generatedUserModification(mdb, currentAC, metricsUserName, metricsUserRoles, mdb.MetricsUserSecretNamespacedName())
+}
+
+// buildPrometheusPodSpecModification adds the mongodb_exporter container to the members if
+// spec.prometheus is set. The exporter connects to the mongod of its member, with TLS if it is
+// enabled, and as the metrics user if authentication is enabled.
+func buildPrometheusPodSpecModification(mdb mdbv1.MongoDB) podtemplatespec.Modification {
+	if mdb.Spec.Prometheus == nil {
+		return podtemplatespec.NOOP()
+	}
+
+	port := exporterPort(mdb)
+	// the variables are expanded by Kubernetes in the variables defined after them
+	envs := []corev1.EnvVar{
+		{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+	}
+	credentials := ""
+	if mdb.Spec.Security.Authentication.Enabled {
+		envs = append(envs,
+			corev1.EnvVar{Name: "MONGODB_USER", Value: metricsUserName},
+			corev1.EnvVar{Name: "MONGODB_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: mdb.MetricsUserSecretNamespacedName().Name},
+				Key:                  generatedUserPasswordKey,
+			}}},
+		)
+		credentials = "$(MONGODB_USER):$(MONGODB_PASSWORD)@"
+	}
+	options := "connect=direct"
+	var volumeMounts []corev1.VolumeMount
+	if mdb.Spec.Security.TLS.Enabled {
+		options += "&tls=true&tlsCAFile=" + tlsCAMountPath + tlsCACertName
+		volumeMounts = append(volumeMounts, statefulset.CreateVolumeMount("tls-ca", tlsCAMountPath, statefulset.WithReadOnly(true)))
+	}
+	envs = append(envs, corev1.EnvVar{
+		Name:  "MONGODB_URI",
+		Value: fmt.Sprintf("mongodb://%s$(POD_NAME).%s:27017/?%s", credentials, getDomain(mdb.ServiceName(), mdb.Namespace, ""), options),
+	})
+
+	resources := corev1.ResourceRequirements{}
+	if mdb.Spec.Prometheus.Resources != nil {
+		resources = *mdb.Spec.Prometheus.Resources
+	}
+
+	return podtemplatespec.Apply(
+		podtemplatespec.WithContainer(exporterName, container.Apply(
+			container.WithName(exporterName),
+			container.WithImage(exporterImage(mdb)),
+			container.WithCommand([]string{"/mongodb_exporter", fmt.Sprintf("--web.listen-address=:%d", port), "--collect-all"}),
+			container.WithEnvs(envs...),
+			container.WithPorts([]corev1.ContainerPort{{Name: metricsPortName, ContainerPort: int32(port)}}),
+			container.WithResourceRequirements(resources),
+			container.WithVolumeMounts(volumeMounts),
+		)),
+	)
+}
@@ -0,0 +1,245 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/cron"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	defaultCertificateExpiryThreshold = 14 * 24 * time.Hour
+	// backupMissedGracePeriod is how long a scheduled backup can take before it is missed
+	backupMissedGracePeriod = time.Hour
+	// scheduleIntervalRuns is the number of runs of a schedule the longest interval between them is
+	// looked for in
+	scheduleIntervalRuns = 64
+)
+
+// prometheusRuleGVK is the kind of the PrometheusRules of the Prometheus Operator, which is used
+// through unstructured objects like the PodMonitors
+var prometheusRuleGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PrometheusRule"}
+
+// scheduleReference is the time the runs of the backup schedule are computed from, so that the
+// PrometheusRule doesn't change with the time it is built at
+var scheduleReference = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func isPrometheusRuleEnabled(mdb mdbv1.MongoDB) bool {
+	return mdb.Spec.Prometheus != nil && mdb.Spec.Prometheus.PrometheusRule != nil
+}
+
+// ensurePrometheusRule creates or updates the PrometheusRule of the resource if
+// spec.prometheus.prometheusRule is set, and deletes it otherwise. Nothing is done if the CRDs of the
+// Prometheus Operator aren't installed.
+func (r *ReplicaSetReconciler) ensurePrometheusRule(mdb mdbv1.MongoDB) error {
+	desired := buildPrometheusRule(mdb)
+	existing := unstructured.Unstructured{}
+	existing.SetGroupVersionKind(prometheusRuleGVK)
+	err := r.client.Get(context.TODO(), mdb.NamespacedName(), &existing)
+	if meta.IsNoMatchError(err) {
+		if isPrometheusRuleEnabled(mdb) {
+			r.log.Warnf("The PrometheusRule can't be created as the Prometheus Operator isn't installed")
+		}
+		return nil
+	}
+	if errors.IsNotFound(err) {
+		if !isPrometheusRuleEnabled(mdb) {
+			return nil
+		}
+		if err := r.client.Create(context.TODO(), &desired); err != nil {
+			return fmt.Errorf("error creating PrometheusRule: %s", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting PrometheusRule: %s", err)
+	}
+
+	if !isPrometheusRuleEnabled(mdb) {
+		if !metav1.IsControlledBy(&existing, &mdb) {
+			return nil
+		}
+		if err := r.client.Delete(context.TODO(), &existing); err != nil {
+			return fmt.Errorf("error deleting PrometheusRule: %s", err)
+		}
+		return nil
+	}
+	if reflect.DeepEqual(existing.Object["spec"], desired.Object["spec"]) && reflect.DeepEqual(existing.GetLabels(), desired.GetLabels()) {
+		return nil
+	}
+	existing.Object["spec"] = desired.Object["spec"]
+	existing.SetLabels(desired.GetLabels())
+	if err := r.client.Update(context.TODO(), &existing); err != nil {
+		return fmt.Errorf("error updating PrometheusRule: %s", err)
+	}
+	return nil
+}
+
+// alertingRule is an alert of the PrometheusRule
+type alertingRule struct {
+	alert       string
+	expr        string
+	forDuration time.Duration
+	severity    string
+	summary     string
+	description string
+}
+
+func (a alertingRule) toUnstructured() map[string]interface{} {
+	rule := map[string]interface{}{
+		"alert":       a.alert,
+		"expr":        a.expr,
+		"labels":      map[string]interface{}{"severity": a.severity},
+		"annotations": map[string]interface{}{"summary": a.summary, "description": a.description},
+	}
+	if a.forDuration > 0 {
+		rule["for"] = promDuration(a.forDuration)
+	}
+	return rule
+}
+
+// buildPrometheusRule returns the PrometheusRule with the alerts of the resource. It is owned by the
+// resource, so that it is deleted with it.
+func buildPrometheusRule(mdb mdbv1.MongoDB) unstructured.Unstructured {
+	rule := unstructured.Unstructured{}
+	rule.SetGroupVersionKind(prometheusRuleGVK)
+	rule.SetName(mdb.Name)
+	rule.SetNamespace(mdb.Namespace)
+	rule.SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)})
+	if !isPrometheusRuleEnabled(mdb) {
+		return rule
+	}
+	if len(mdb.Spec.Prometheus.PrometheusRule.Labels) > 0 {
+		rule.SetLabels(mdb.Spec.Prometheus.PrometheusRule.Labels)
+	}
+
+	var rules []interface{}
+	for _, alert := range buildAlertingRules(mdb) {
+		rules = append(rules, alert.toUnstructured())
+	}
+	rule.Object["spec"] = map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name":  fmt.Sprintf("mongodb.%s.%s", mdb.Namespace, mdb.Name),
+				"rules": rules,
+			},
+		},
+	}
+	return rule
+}
+
+// buildAlertingRules returns the alerts of the resource, on the metrics of the operator, and on the
+// metrics of the exporter scraped by the PodMonitor if spec.prometheus.podMonitor is set
+func buildAlertingRules(mdb mdbv1.MongoDB) []alertingRule {
+	selector := fmt.Sprintf(`namespace="%s",name="%s"`, mdb.Namespace, mdb.Name)
+	resource := fmt.Sprintf("%s/%s", mdb.Namespace, mdb.Name)
+	lag, lagFor := replicationLagThreshold(mdb)
+
+	alerts := []alertingRule{
+		{
+			alert:       "MongoDBNoPrimary",
+			expr:        fmt.Sprintf("mongodb_primary_members{%s} == 0", selector),
+			forDuration: time.Minute,
+			severity:    "critical",
+			summary:     fmt.Sprintf("The replica set %s has no primary", resource),
+			description: "No member of the replica set is in the PRIMARY state, the writes are failing.",
+		},
+		{
+			alert:       "MongoDBMemberDown",
+			expr:        fmt.Sprintf("mongodb_ready_members{%s} < mongodb_desired_members{%s}", selector, selector),
+			forDuration: 5 * time.Minute,
+			severity:    "warning",
+			summary:     fmt.Sprintf("Members of the replica set %s are not ready", resource),
+			description: "{{ $value }} members of the replica set are ready, fewer than its members.",
+		},
+		{
+			alert:       "MongoDBReplicationLagHigh",
+			expr:        fmt.Sprintf("mongodb_replication_lag_seconds{%s} > %d", selector, int64(lag.Seconds())),
+			forDuration: lagFor,
+			severity:    "warning",
+			summary:     fmt.Sprintf("The member {{ $labels.member }} of %s is lagging", resource),
+			description: fmt.Sprintf("The member is {{ $value }} seconds behind the primary, more than %s.", lag),
+		},
+	}
+	if isPodMonitorEnabled(mdb) {
+		alerts = append(alerts, alertingRule{
+			alert:       "MongoDBMemberUnreachable",
+			expr:        fmt.Sprintf(`mongodb_up{namespace="%s",pod=~"%s-[0-9]+"} == 0`, mdb.Namespace, mdb.Name),
+			forDuration: time.Minute,
+			severity:    "critical",
+			summary:     fmt.Sprintf("The member {{ $labels.pod }} of %s is unreachable", resource),
+			description: "The exporter of the member can't connect to its mongod.",
+		})
+	}
+	if mdb.Spec.Security.TLS.Enabled && !usesVaultTLS(mdb) {
+		threshold := certificateExpiryThreshold(mdb)
+		alerts = append(alerts, alertingRule{
+			alert:       "MongoDBCertificateExpiring",
+			expr:        fmt.Sprintf("mongodb_tls_certificate_expiration_timestamp_seconds{%s} - time() < %d", selector, int64(threshold.Seconds())),
+			severity:    "warning",
+			summary:     fmt.Sprintf("The TLS certificate of %s is expiring", resource),
+			description: fmt.Sprintf("The certificate of the members expires in less than %s, renew it in the Secret %s.", threshold, mdb.Spec.Security.TLS.CertificateKeySecret.Name),
+		})
+	}
+	if mdb.Spec.Backup != nil {
+		if maxAge, ok := backupMaxAge(mdb.Spec.Backup.Schedule); ok {
+			alerts = append(alerts, alertingRule{
+				alert:       "MongoDBBackupMissed",
+				expr:        fmt.Sprintf("time() - mongodb_backup_last_success_timestamp_seconds{%s} > %d", selector, int64(maxAge.Seconds())),
+				severity:    "warning",
+				summary:     fmt.Sprintf("A scheduled backup of %s was missed", resource),
+				description: fmt.Sprintf("The last successful backup is older than %s, see status.backup of the resource.", maxAge),
+			})
+		}
+	}
+	return alerts
+}
+
+func certificateExpiryThreshold(mdb mdbv1.MongoDB) time.Duration {
+	if threshold := mdb.Spec.Prometheus.PrometheusRule.CertificateExpiryThreshold; threshold != nil {
+		return threshold.Duration
+	}
+	return defaultCertificateExpiryThreshold
+}
+
+// backupMaxAge returns how old the last successful backup of the schedule can be before a backup is
+// missed: the longest interval between two of its runs, and the time the backup can take. It returns
+// false if the schedule is invalid or runs too rarely.
+func backupMaxAge(expression string) (time.Duration, bool) {
+	schedule, err := cron.Parse(expression)
+	if err != nil {
+		return 0, false
+	}
+	var longest time.Duration
+	previous := schedule.Next(scheduleReference)
+	for i := 0; i < scheduleIntervalRuns && !previous.IsZero(); i++ {
+		next := schedule.Next(previous)
+		if next.IsZero() {
+			break
+		}
+		if interval := next.Sub(previous); interval > longest {
+			longest = interval
+		}
+		previous = next
+	}
+	if longest == 0 {
+		return 0, false
+	}
+	return longest + backupMissedGracePeriod, true
+}
+
+// promDuration formats the duration as a duration of Prometheus, which doesn't accept fractions
+func promDuration(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", int64(d/time.Minute))
+	}
+	return fmt.Sprintf("%ds", int64(d/time.Second))
+}
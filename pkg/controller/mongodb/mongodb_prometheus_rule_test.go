@@ -0,0 +1,117 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func getPrometheusRule(c client.Client, mdb mdbv1.MongoDB) (unstructured.Unstructured, error) {
+	rule := unstructured.Unstructured{}
+	rule.SetGroupVersionKind(prometheusRuleGVK)
+	err := c.Get(context.TODO(), mdb.NamespacedName(), &rule)
+	return rule, err
+}
+
+// alertExpressions returns the expressions of the alerts of the PrometheusRule by alert
+func alertExpressions(t *testing.T, rule unstructured.Unstructured) map[string]string {
+	groups, _, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+	if !assert.Len(t, groups, 1) {
+		return nil
+	}
+	rules, _, _ := unstructured.NestedSlice(groups[0].(map[string]interface{}), "rules")
+	expressions := map[string]string{}
+	for _, r := range rules {
+		alert := r.(map[string]interface{})
+		expressions[alert["alert"].(string)] = alert["expr"].(string)
+	}
+	return expressions
+}
+
+func TestPrometheusRule_IsCreatedWithTheAlerts(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{PrometheusRule: &mdbv1.PrometheusRule{Labels: map[string]string{"release": "prometheus"}}}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	rule, err := getPrometheusRule(mgr.Client, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"release": "prometheus"}, rule.GetLabels())
+	assert.Equal(t, mdb.Name, rule.GetOwnerReferences()[0].Name)
+	assert.Equal(t, map[string]string{
+		"MongoDBNoPrimary":          `mongodb_primary_members{namespace="my-ns",name="my-rs"} == 0`,
+		"MongoDBMemberDown":         `mongodb_ready_members{namespace="my-ns",name="my-rs"} < mongodb_desired_members{namespace="my-ns",name="my-rs"}`,
+		"MongoDBReplicationLagHigh": `mongodb_replication_lag_seconds{namespace="my-ns",name="my-rs"} > 60`,
+	}, alertExpressions(t, rule))
+
+	groups, _, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+	lagAlert := groups[0].(map[string]interface{})["rules"].([]interface{})[2].(map[string]interface{})
+	assert.Equal(t, "5m", lagAlert["for"])
+	assert.Equal(t, map[string]interface{}{"severity": "warning"}, lagAlert["labels"])
+
+	t.Run("The PrometheusRule is deleted once disabled", func(t *testing.T) {
+		mdb.Spec.Prometheus.PrometheusRule = nil
+		assert.NoError(t, r.ensurePrometheusRule(mdb))
+		_, err := getPrometheusRule(mgr.Client, mdb)
+		assert.True(t, errors.IsNotFound(err))
+	})
+}
+
+func TestBuildAlertingRules_OptionalAlerts(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{
+		PodMonitor:     &mdbv1.PodMonitor{},
+		PrometheusRule: &mdbv1.PrometheusRule{CertificateExpiryThreshold: &metav1.Duration{Duration: 72 * time.Hour}},
+	}
+	mdb.Spec.Backup = &mdbv1.Backup{Schedule: "0 3 * * 1-5"}
+	mdb.Spec.ReplicationLagThreshold = &mdbv1.ReplicationLagThreshold{Lag: &metav1.Duration{Duration: 30 * time.Second}}
+
+	expressions := alertExpressions(t, buildPrometheusRule(mdb))
+	assert.Equal(t, `mongodb_replication_lag_seconds{namespace="my-ns",name="my-rs"} > 30`, expressions["MongoDBReplicationLagHigh"])
+	assert.Equal(t, `mongodb_up{namespace="my-ns",pod=~"my-rs-[0-9]+"} == 0`, expressions["MongoDBMemberUnreachable"])
+	assert.Equal(t, `mongodb_tls_certificate_expiration_timestamp_seconds{namespace="my-ns",name="my-rs"} - time() < 259200`, expressions["MongoDBCertificateExpiring"])
+	assert.Equal(t, `time() - mongodb_backup_last_success_timestamp_seconds{namespace="my-ns",name="my-rs"} > 262800`, expressions["MongoDBBackupMissed"],
+		"the backups aren't missed over the weekend")
+}
+
+func TestBackupMaxAge(t *testing.T) {
+	maxAge, ok := backupMaxAge("0 3 * * *")
+	assert.True(t, ok)
+	assert.Equal(t, 25*time.Hour, maxAge)
+
+	maxAge, ok = backupMaxAge("*/15 * * * *")
+	assert.True(t, ok)
+	assert.Equal(t, 75*time.Minute, maxAge)
+
+	_, ok = backupMaxAge("0 0 31 2 *")
+	assert.False(t, ok)
+	_, ok = backupMaxAge("invalid")
+	assert.False(t, ok)
+}
+
+func TestRecordCertificateExpiration(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mgr := client.NewManager(&mdb)
+	assert.NoError(t, createTLSSecretAndConfigMap(mgr.Client, mdb))
+
+	recordCertificateExpiration(mgr.Client, mdb)
+	expiration := time.Date(2030, time.July, 20, 8, 10, 43, 0, time.UTC)
+	assert.Equal(t, float64(expiration.Unix()), testutil.ToFloat64(tlsCertificateExpiration.WithLabelValues(mdb.Namespace, mdb.Name)))
+
+	collected := testutil.CollectAndCount(tlsCertificateExpiration)
+	mdb.Spec.Security.TLS.Enabled = false
+	recordCertificateExpiration(mgr.Client, mdb)
+	assert.Equal(t, collected-1, testutil.CollectAndCount(tlsCertificateExpiration))
+}
@@ -0,0 +1,163 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func getExporterContainer(t *testing.T, c client.Client, mdb mdbv1.MongoDB) corev1.Container {
+	sts := appsv1.StatefulSet{}
+	err := c.Get(context.TODO(), mdb.NamespacedName(), &sts)
+	assert.NoError(t, err)
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		if c.Name == exporterName {
+			return c
+		}
+	}
+	t.Fatalf("container %s not found", exporterName)
+	return corev1.Container{}
+}
+
+func getEnv(envs []corev1.EnvVar, name string) *corev1.EnvVar {
+	for i := range envs {
+		if envs[i].Name == name {
+			return &envs[i]
+		}
+	}
+	return nil
+}
+
+func TestPrometheus_ExporterIsNotDeployedByDefault(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	sts := appsv1.StatefulSet{}
+	err = mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &sts)
+	assert.NoError(t, err)
+	assert.Len(t, sts.Spec.Template.Spec.Containers, 2)
+
+	ac, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
+	assert.NoError(t, err)
+	for _, u := range ac.Auth.Users {
+		assert.NotEqual(t, metricsUserName, u.Username)
+	}
+}
+
+func TestPrometheus_ExporterIsDeployedWithTheMetricsUser(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{Port: 9500}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	t.Run("The exporter container is added to the members", func(t *testing.T) {
+		exporter := getExporterContainer(t, mgr.Client, mdb)
+		assert.Equal(t, defaultExporterImage, exporter.Image)
+		assert.Equal(t, []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9500}}, exporter.Ports)
+		assert.Contains(t, exporter.Command, "--web.listen-address=:9500")
+
+		password := getEnv(exporter.Env, "MONGODB_PASSWORD")
+		if assert.NotNil(t, password) {
+			assert.Equal(t, mdb.MetricsUserSecretNamespacedName().Name, password.ValueFrom.SecretKeyRef.Name)
+		}
+		uri := getEnv(exporter.Env, "MONGODB_URI")
+		if assert.NotNil(t, uri) {
+			assert.Equal(t, "mongodb://$(MONGODB_USER):$(MONGODB_PASSWORD)@$(POD_NAME).my-rs-svc.my-ns.svc.cluster.local:27017/?connect=direct", uri.Value)
+		}
+	})
+
+	t.Run("The metrics user is added to the automation config", func(t *testing.T) {
+		ac, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
+		assert.NoError(t, err)
+		assert.Len(t, ac.Auth.Users, 1)
+		user := ac.Auth.Users[0]
+		assert.Equal(t, metricsUserName, user.Username)
+		assert.Equal(t, "admin", user.Database)
+		assert.Equal(t, metricsUserRoles, user.Roles)
+		assert.Equal(t, []string{scramSha256Mechanism}, user.Mechanisms)
+		assert.NotNil(t, user.ScramSha256Creds)
+	})
+
+	t.Run("The credentials don't change in the following reconciliations", func(t *testing.T) {
+		before, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
+		assert.NoError(t, err)
+
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+
+		after, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
+		assert.NoError(t, err)
+		assert.Equal(t, before.Version, after.Version)
+		assert.Equal(t, before.Auth.Users, after.Auth.Users)
+	})
+}
+
+func TestPrometheus_ExporterConnectsWithoutCredentialsIfAuthenticationIsDisabled(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	exporter := getExporterContainer(t, mgr.Client, mdb)
+	assert.Nil(t, getEnv(exporter.Env, "MONGODB_PASSWORD"))
+	assert.Equal(t, []corev1.ContainerPort{{Name: "metrics", ContainerPort: defaultExporterPort}}, exporter.Ports)
+
+	_, err = mgr.Client.GetSecret(mdb.MetricsUserSecretNamespacedName())
+	assert.Error(t, err)
+}
+
+func TestPrometheus_ExporterUsesTheCAOfTheDeployment(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{}
+	mgr := client.NewManager(&mdb)
+	err := createTLSSecretAndConfigMap(mgr.GetClient(), mdb)
+	assert.NoError(t, err)
+
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	exporter := getExporterContainer(t, mgr.Client, mdb)
+	assert.Contains(t, exporter.VolumeMounts, corev1.VolumeMount{Name: "tls-ca", ReadOnly: true, MountPath: tlsCAMountPath})
+	uri := getEnv(exporter.Env, "MONGODB_URI")
+	if assert.NotNil(t, uri) {
+		assert.Contains(t, uri.Value, "&tls=true&tlsCAFile="+tlsCAMountPath+tlsCACertName)
+	}
+}
+
+func TestPrometheus_MetricsUserReplacesAnExistingOne(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.Prometheus = &mdbv1.Prometheus{}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	modification, err := r.getMetricsUserModification(mdb, automationconfig.AutomationConfig{})
+	assert.NoError(t, err)
+
+	ac := automationconfig.AutomationConfig{}
+	ac.Auth.Users = []automationconfig.MongoDBUser{
+		{Username: "app", Database: "admin"},
+		{Username: metricsUserName, Database: "admin"},
+	}
+	modification(&ac)
+	assert.Len(t, ac.Auth.Users, 2)
+	assert.Equal(t, metricsUserName, ac.Auth.Users[0].Username)
+	assert.Equal(t, metricsUserRoles, ac.Auth.Users[0].Roles)
+	assert.Equal(t, "app", ac.Auth.Users[1].Username)
+}
@@ -0,0 +1,325 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	liveClusterReadTimeout = 30 * time.Second
+
+	// rebuiltFromLiveClusterAnnotationKey marks the automation config ConfigMap written from the
+	// live replica set, whose settings are kept by the next automation config published. The
+	// marker is cleared by publishing it.
+	rebuiltFromLiveClusterAnnotationKey = "mongodb.com/v1.rebuiltFromLiveCluster"
+)
+
+// rebuildAutomationConfig regenerates the automation config from the MongoDB resource and the
+// configuration of the running replica set. This is used to recover when the automation config
+// was deleted or corrupted. The replica set members settings and the users are read from the
+// replica set, and the version continues from the last version the agents reached goal state for,
+// so the agents don't ignore the rebuilt automation config.
+func (r *ReplicaSetReconciler) rebuildAutomationConfig(mdb mdbv1.MongoDB) error {
+	rsConfig, users, err := r.readLiveCluster(mdb)
+	if err != nil {
+		return err
+	}
+
+	lastVersionAchieved, err := r.lastVersionAchieved(mdb)
+	if err != nil {
+		return err
+	}
+
+	version, err := r.writeLiveClusterAutomationConfig(mdb, rsConfig, users, int(lastVersionAchieved))
+	if err != nil {
+		return err
+	}
+	r.log.Infof("Rebuilt the automation config with version %d from the live replica set", version)
+
+	return r.removeAnnotation(mdb.NamespacedName(), rebuildAutomationConfigAnnotationKey)
+}
+
+// writeLiveClusterAutomationConfig writes the automation config described by the MongoDB resource with
+// the members settings and the users of the running replica set. The previous version only carries the
+// version, so that the automation config gets the version following it. The version of the written
+// automation config is returned.
+func (r *ReplicaSetReconciler) writeLiveClusterAutomationConfig(mdb mdbv1.MongoDB, rsConfig livecluster.ReplicaSetConfig, users []livecluster.User, previousVersion int) (int, error) {
+	if rsConfig.Name != mdb.Name {
+		return 0, fmt.Errorf("the live replica set is named %s, expected %s", rsConfig.Name, mdb.Name)
+	}
+
+	previousAC := automationconfig.AutomationConfig{Version: previousVersion}
+	ac, err := r.buildAutomationConfigFromSpec(mdb, previousAC, liveClusterModification(rsConfig, users))
+	if err != nil {
+		return 0, err
+	}
+
+	cm, err := automationConfigConfigMap(mdb, ac)
+	if err != nil {
+		return 0, err
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[rebuiltFromLiveClusterAnnotationKey] = trueAnnotation
+	if err := configmap.CreateOrUpdate(r.client, cm); err != nil {
+		return 0, fmt.Errorf("error writing automation config: %s", err)
+	}
+	return ac.Version, nil
+}
+
+// readLiveCluster connects to the running replica set as the agent, and reads its configuration and users.
+func (r *ReplicaSetReconciler) readLiveCluster(mdb mdbv1.MongoDB) (livecluster.ReplicaSetConfig, []livecluster.User, error) {
+	credential, err := r.agentCredential(mdb)
+	if err != nil {
+		return livecluster.ReplicaSetConfig{}, nil, err
+	}
+	return r.readLiveClusterAs(mdb, credential)
+}
+
+// readLiveClusterAs connects to the running replica set with the given credential, and reads its
+// configuration and users.
+func (r *ReplicaSetReconciler) readLiveClusterAs(mdb mdbv1.MongoDB, credential *livecluster.Credential) (livecluster.ReplicaSetConfig, []livecluster.User, error) {
+	reader, err := r.connectLiveClusterAs(mdb, credential)
+	if err != nil {
+		return livecluster.ReplicaSetConfig{}, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+	defer cancel()
+	defer r.disconnectLiveCluster(ctx, reader)
+
+	rsConfig, err := reader.ReplicaSetConfig(ctx)
+	if err != nil {
+		return livecluster.ReplicaSetConfig{}, nil, err
+	}
+	users, err := reader.Users(ctx)
+	if err != nil {
+		return livecluster.ReplicaSetConfig{}, nil, err
+	}
+	return rsConfig, users, nil
+}
+
+// connectLiveCluster connects to the running replica set as the agent, using TLS if it is enabled.
+func (r *ReplicaSetReconciler) connectLiveCluster(mdb mdbv1.MongoDB) (livecluster.Reader, error) {
+	credential, err := r.agentCredential(mdb)
+	if err != nil {
+		return nil, err
+	}
+	return r.connectLiveClusterAs(mdb, credential)
+}
+
+// agentCredential returns the credential of the agent, or nil if authentication is disabled
+func (r *ReplicaSetReconciler) agentCredential(mdb mdbv1.MongoDB) (*livecluster.Credential, error) {
+	if !mdb.Spec.Security.Authentication.Enabled {
+		return nil, nil
+	}
+	password, err := secret.ReadKey(r.client, scram.AgentPasswordKey, mdb.ScramCredentialsNamespacedName())
+	if err != nil {
+		return nil, fmt.Errorf("error reading agent password: %s", err)
+	}
+	return &livecluster.Credential{Username: scram.AgentName, Password: password}, nil
+}
+
+// connectLiveClusterAs connects to the running replica set with the given credential, using TLS if it is enabled.
+func (r *ReplicaSetReconciler) connectLiveClusterAs(mdb mdbv1.MongoDB, credential *livecluster.Credential) (livecluster.Reader, error) {
+	tlsConfig, err := r.liveClusterTLSConfig(mdb)
+	if err != nil {
+		return nil, err
+	}
+	return r.connectToLiveCluster(mdb.MongoURI(), credential, tlsConfig)
+}
+
+// connectLiveClusterMember connects directly to the member running in the given Pod as the agent, rather
+// than to the replica set, using TLS if it is enabled.
+func (r *ReplicaSetReconciler) connectLiveClusterMember(mdb mdbv1.MongoDB, podName string) (livecluster.Reader, error) {
+	credential, err := r.agentCredential(mdb)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := r.liveClusterTLSConfig(mdb)
+	if err != nil {
+		return nil, err
+	}
+	uri := fmt.Sprintf("mongodb://%s.%s:27017/?connect=direct", podName, getDomain(mdb.ServiceName(), mdb.Namespace, ""))
+	return r.connectToLiveCluster(uri, credential, tlsConfig)
+}
+
+// liveClusterTLSConfig returns the TLS configuration trusting the CA of the replica set, or nil if TLS
+// is disabled
+func (r *ReplicaSetReconciler) liveClusterTLSConfig(mdb mdbv1.MongoDB) (*tls.Config, error) {
+	if !mdb.Spec.Security.TLS.Enabled {
+		return nil, nil
+	}
+	var ca string
+	var err error
+	source := fmt.Sprintf("ConfigMap %s", mdb.TLSConfigMapNamespacedName())
+	if usesVaultTLS(mdb) {
+		source = fmt.Sprintf("Vault secret %s", mdb.Spec.Security.TLS.VaultSecretPath)
+		_, _, ca, err = r.readVaultTLSCertificates(mdb)
+	} else {
+		ca, err = configmap.ReadKey(r.client, tlsCACertName, mdb.TLSConfigMapNamespacedName())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA certificate: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(ca)) {
+		return nil, fmt.Errorf("invalid CA certificate in %s", source)
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+func (r *ReplicaSetReconciler) disconnectLiveCluster(ctx context.Context, reader livecluster.Reader) {
+	if err := reader.Disconnect(ctx); err != nil {
+		r.log.Warnf("Error disconnecting from the live replica set: %s", err)
+	}
+}
+
+// lastVersionAchieved returns the highest automation config version any agent reached goal state for.
+func (r *ReplicaSetReconciler) lastVersionAchieved(mdb mdbv1.MongoDB) (int64, error) {
+	var version int64
+	for i := 0; i < mdb.Spec.Members; i++ {
+		agentStatus, err := r.getAgentStatus(types.NamespacedName{Name: fmt.Sprintf("%s-%d", mdb.Name, i), Namespace: mdb.Namespace})
+		if err != nil {
+			return 0, err
+		}
+		if agentStatus.LastGoalVersionAchieved > version {
+			version = agentStatus.LastGoalVersionAchieved
+		}
+	}
+	return version, nil
+}
+
+// removeAnnotation removes the annotation with the given key from the MongoDB resource
+func (r ReplicaSetReconciler) removeAnnotation(nsName types.NamespacedName, key string) error {
+	mdb, err := r.getResource(nsName)
+	if err != nil {
+		return err
+	}
+	if _, ok := mdb.Annotations[key]; !ok {
+		return nil
+	}
+	delete(mdb.Annotations, key)
+	return r.writeAnnotations(mdb)
+}
+
+// liveClusterModification applies the replica set members settings and the users
+// read from the running replica set to the automation config.
+func liveClusterModification(rsConfig livecluster.ReplicaSetConfig, users []livecluster.User) automationconfig.Modification {
+	return func(ac *automationconfig.AutomationConfig) {
+		liveMembers := map[string]livecluster.ReplicaSetMember{}
+		for _, m := range rsConfig.Members {
+			liveMembers[processName(m.Host)] = m
+		}
+		for i := range ac.ReplicaSets {
+			for j, member := range ac.ReplicaSets[i].Members {
+				live, ok := liveMembers[member.Host]
+				if !ok {
+					continue
+				}
+				ac.ReplicaSets[i].Members[j].Id = live.Id
+				ac.ReplicaSets[i].Members[j].Priority = int(live.Priority)
+				ac.ReplicaSets[i].Members[j].Votes = live.Votes
+			}
+		}
+
+		if ac.Auth.Disabled {
+			return
+		}
+		acUsers := []automationconfig.MongoDBUser{}
+		for _, u := range users {
+			// the agent user is configured through the autoUser field
+			if u.Username == ac.Auth.AutoUser && u.Database == "admin" {
+				continue
+			}
+			roles := make([]automationconfig.Role, len(u.Roles))
+			for i, role := range u.Roles {
+				roles[i] = automationconfig.Role{Role: role.Role, Database: role.Database}
+			}
+			acUsers = append(acUsers, automationconfig.MongoDBUser{
+				Username:                   u.Username,
+				Database:                   u.Database,
+				Roles:                      roles,
+				Mechanisms:                 u.Mechanisms,
+				AuthenticationRestrictions: []string{},
+				ScramSha1Creds:             u.ScramSha1Creds,
+				ScramSha256Creds:           u.ScramSha256Creds,
+			})
+		}
+		ac.Auth.Users = acUsers
+	}
+}
+
+// preserveMemberIds keeps the ids of the members of the current automation config, which can't be
+// changed without removing the members from the replica set, such as the ones rebuilt from the live
+// replica set.
+func preserveMemberIds(currentAC automationconfig.AutomationConfig) automationconfig.Modification {
+	return forEachCurrentMember(currentAC, func(member *automationconfig.ReplicaSetMember, current automationconfig.ReplicaSetMember) {
+		member.Id = current.Id
+	})
+}
+
+// preserveRecoveredSettings keeps the settings of the automation config rebuilt from the live
+// replica set which are not configured through the MongoDB resource. It is only applied by the
+// reconciliation publishing the rebuilt automation config, so that the resource is authoritative
+// again for the following ones.
+func preserveRecoveredSettings(rebuiltAC automationconfig.AutomationConfig) automationconfig.Modification {
+	return automationconfig.Merge(
+		forEachCurrentMember(rebuiltAC, func(member *automationconfig.ReplicaSetMember, rebuilt automationconfig.ReplicaSetMember) {
+			member.Priority = rebuilt.Priority
+			member.Votes = rebuilt.Votes
+		}),
+		func(ac *automationconfig.AutomationConfig) {
+			if !ac.Auth.Disabled && len(ac.Auth.Users) == 0 && len(rebuiltAC.Auth.Users) > 0 {
+				ac.Auth.Users = rebuiltAC.Auth.Users
+			}
+		},
+	)
+}
+
+// forEachCurrentMember calls f with the members which are in the current automation config,
+// and their settings in it
+func forEachCurrentMember(currentAC automationconfig.AutomationConfig, f func(member *automationconfig.ReplicaSetMember, current automationconfig.ReplicaSetMember)) automationconfig.Modification {
+	return func(ac *automationconfig.AutomationConfig) {
+		currentMembers := map[string]automationconfig.ReplicaSetMember{}
+		for _, rs := range currentAC.ReplicaSets {
+			for _, m := range rs.Members {
+				currentMembers[m.Host] = m
+			}
+		}
+		for i := range ac.ReplicaSets {
+			for j, member := range ac.ReplicaSets[i].Members {
+				if current, ok := currentMembers[member.Host]; ok {
+					f(&ac.ReplicaSets[i].Members[j], current)
+				}
+			}
+		}
+	}
+}
+
+// isRebuiltFromLiveCluster returns true if the automation config ConfigMap was written from the
+// live replica set and not published since
+func isRebuiltFromLiveCluster(cm corev1.ConfigMap) bool {
+	return cm.Annotations[rebuiltFromLiveClusterAnnotationKey] == trueAnnotation
+}
+
+// processName returns the name of the process from a host of the form "<process>.<service>...:<port>"
+func processName(host string) string {
+	if idx := strings.IndexAny(host, ".:"); idx != -1 {
+		return host[:idx]
+	}
+	return host
+}
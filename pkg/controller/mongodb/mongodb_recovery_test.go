@@ -0,0 +1,181 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scramcredentials"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type mockLiveCluster struct {
+	rsConfig livecluster.ReplicaSetConfig
+	members  []livecluster.MemberStatus
+	users    []livecluster.User
+	fcv      string
+	// stepDowns counts the calls to StepDown, if set
+	stepDowns *int
+	// fsyncCalls records the calls to FsyncLock and FsyncUnlock, if set
+	fsyncCalls *[]string
+}
+
+func (m mockLiveCluster) ReplicaSetConfig(_ context.Context) (livecluster.ReplicaSetConfig, error) {
+	return m.rsConfig, nil
+}
+
+func (m mockLiveCluster) ReplicaSetStatus(_ context.Context) ([]livecluster.MemberStatus, error) {
+	return m.members, nil
+}
+
+func (m mockLiveCluster) StepDown(_ context.Context) error {
+	if m.stepDowns != nil {
+		*m.stepDowns++
+	}
+	return nil
+}
+
+func (m mockLiveCluster) FsyncLock(_ context.Context) error {
+	if m.fsyncCalls != nil {
+		*m.fsyncCalls = append(*m.fsyncCalls, "lock")
+	}
+	return nil
+}
+
+func (m mockLiveCluster) FsyncUnlock(_ context.Context) error {
+	if m.fsyncCalls != nil {
+		*m.fsyncCalls = append(*m.fsyncCalls, "unlock")
+	}
+	return nil
+}
+
+func (m mockLiveCluster) Users(_ context.Context) ([]livecluster.User, error) {
+	return m.users, nil
+}
+
+func (m mockLiveCluster) FeatureCompatibilityVersion(_ context.Context) (string, error) {
+	return m.fcv, nil
+}
+
+func (m mockLiveCluster) Disconnect(_ context.Context) error {
+	return nil
+}
+
+func TestRebuildAutomationConfig_FromLiveCluster(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	var usedCredential *livecluster.Credential
+	r.connectToLiveCluster = func(_ string, credential *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		usedCredential = credential
+		return mockLiveCluster{
+			rsConfig: livecluster.ReplicaSetConfig{
+				Name:            mdb.Name,
+				ProtocolVersion: 1,
+				Members: []livecluster.ReplicaSetMember{
+					{Id: 0, Host: "my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017", Priority: 1, Votes: 1},
+					{Id: 1, Host: "my-rs-1.my-rs-svc.my-ns.svc.cluster.local:27017", Priority: 1, Votes: 1},
+					{Id: 5, Host: "my-rs-2.my-rs-svc.my-ns.svc.cluster.local:27017", Priority: 0, Votes: 0},
+				},
+			},
+			users: []livecluster.User{
+				{Username: scram.AgentName, Database: "admin", Mechanisms: []string{"SCRAM-SHA-256"}},
+				{
+					Username:         "app-user",
+					Database:         "admin",
+					Roles:            []livecluster.Role{{Role: "readWrite", Database: "app"}},
+					Mechanisms:       []string{"SCRAM-SHA-256"},
+					ScramSha256Creds: &scramcredentials.ScramCreds{IterationCount: 15000, Salt: "salt", StoredKey: "stored", ServerKey: "server"},
+				},
+			},
+		}, nil
+	}
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	// the agents have reached a version higher than the one of the automation config which gets lost
+	for i := 0; i < mdb.Spec.Members; i++ {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("%s-%d", mdb.Name, i),
+				Namespace:   mdb.Namespace,
+				Annotations: map[string]string{agenthealth.MemberStatusAnnotationKey: `{"lastGoalVersionAchieved":7,"isInGoalState":true}`},
+			},
+		}
+		assert.NoError(t, mgrClient.Create(context.TODO(), &pod))
+	}
+	assert.NoError(t, mgrClient.DeleteConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}))
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Annotations[rebuildAutomationConfigAnnotationKey] = trueAnnotation
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	assert.NotNil(t, usedCredential)
+	assert.Equal(t, scram.AgentName, usedCredential.Username)
+
+	ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, ac.Version)
+	assert.Equal(t, automationconfig.ReplicaSetMember{Id: 5, Host: "my-rs-2", Priority: 0, Votes: 0}, ac.ReplicaSets[0].Members[2])
+	assert.Len(t, ac.Auth.Users, 1)
+	assert.Equal(t, "app-user", ac.Auth.Users[0].Username)
+	assert.Equal(t, "stored", ac.Auth.Users[0].ScramSha256Creds.StoredKey)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.NotContains(t, mdb.Annotations, rebuildAutomationConfigAnnotationKey)
+
+	t.Run("The rebuilt automation config is published", func(t *testing.T) {
+		cm, err := mgrClient.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace})
+		assert.NoError(t, err)
+		assert.NotContains(t, cm.Annotations, rebuiltFromLiveClusterAnnotationKey)
+	})
+
+	t.Run("The resource is authoritative for the following reconciliations", func(t *testing.T) {
+		res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+
+		ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+		assert.NoError(t, err)
+		assert.Equal(t, 9, ac.Version)
+		// the id of a member can't be changed without removing it from the replica set
+		assert.Equal(t, automationconfig.ReplicaSetMember{Id: 5, Host: "my-rs-2", Priority: 1, Votes: 1}, ac.ReplicaSets[0].Members[2])
+		// the resource has no users
+		assert.Empty(t, ac.Auth.Users)
+
+		res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+		ac, err = getCurrentAutomationConfig(mgrClient, mdb)
+		assert.NoError(t, err)
+		assert.Equal(t, 9, ac.Version)
+	})
+}
+
+func TestRebuildAutomationConfig_FailsOnDifferentReplicaSet(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Annotations[rebuildAutomationConfigAnnotationKey] = trueAnnotation
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.connectToLiveCluster = func(_ string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		return mockLiveCluster{rsConfig: livecluster.ReplicaSetConfig{Name: "other-rs"}}, nil
+	}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	kubernetesClient "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// referencedByAnnotationKey is set on a Secret or ConfigMap to the comma-separated names of the
+// MongoDB resources of its namespace to reconcile when it changes, for the objects they use which
+// aren't referenced by their spec
+const referencedByAnnotationKey = "mongodb.com/v1.referencedBy"
+
+// referencedSecrets returns the names of the Secrets read by the reconciliation of the resource: the
+// TLS certificate and the passwords of the users, unless they are read from Vault, the API key of
+// Ops Manager and the Secrets of spec.dependentResources
+func referencedSecrets(mdb mdbv1.MongoDB) []string {
+	var names []string
+	if mdb.Spec.Security.TLS.Enabled && !usesVaultTLS(mdb) {
+		names = append(names, mdb.TLSSecretNamespacedName().Name)
+	}
+	for _, user := range mdb.Spec.Users {
+		if user.PasswordVaultRef == nil {
+			names = append(names, user.PasswordSecretRef.Name)
+		}
+	}
+	if mdb.Spec.OpsManager != nil {
+		names = append(names, mdb.Spec.OpsManager.APIKeySecretRef.Name)
+	}
+	return append(names, dependentResourceNames(mdb, mdbv1.DependentSecret)...)
+}
+
+// referencedConfigMaps returns the names of the ConfigMaps read by the reconciliation of the
+// resource: the TLS CA, unless it is read from Vault, and the ConfigMaps of spec.dependentResources
+func referencedConfigMaps(mdb mdbv1.MongoDB) []string {
+	var names []string
+	if mdb.Spec.Security.TLS.Enabled && !usesVaultTLS(mdb) {
+		names = append(names, mdb.TLSConfigMapNamespacedName().Name)
+	}
+	return append(names, dependentResourceNames(mdb, mdbv1.DependentConfigMap)...)
+}
+
+// dependentResourceNames returns the names of the objects of spec.dependentResources of the given kind
+func dependentResourceNames(mdb mdbv1.MongoDB, kind mdbv1.DependentResourceKind) []string {
+	var names []string
+	for _, dependent := range mdb.Spec.DependentResources {
+		if dependent.Kind == kind {
+			names = append(names, dependent.Name)
+		}
+	}
+	return names
+}
+
+// resourcesReferencing returns the function mapping a Secret or a ConfigMap to the requests to
+// reconcile the MongoDB resources of its namespace which reference it, according to the given
+// function, or which are listed in its referencedBy annotation. The references are read from the
+// resources on every change, so that they don't need to be reconciled first.
+func (r *ReplicaSetReconciler) resourcesReferencing(referenced func(mdbv1.MongoDB) []string) handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		namespace := obj.Meta.GetNamespace()
+		names := map[string]bool{}
+		for _, name := range strings.Split(obj.Meta.GetAnnotations()[referencedByAnnotationKey], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names[name] = true
+			}
+		}
+
+		mdbList, err := listSelectedResources(r.client, r.selector, client.InNamespace(namespace))
+		if err != nil {
+			zap.S().Warnf("Error listing MongoDB resources: %s", err)
+		}
+		for _, mdb := range mdbList.Items {
+			for _, name := range referenced(mdb) {
+				if name == obj.Meta.GetName() {
+					names[mdb.Name] = true
+				}
+			}
+		}
+
+		var requests []reconcile.Request
+		for name := range names {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
+		}
+		return requests
+	}
+}
+
+// labelReferences labels the Secrets and ConfigMaps referenced by the resource, so that the operator
+// caches and watches them. The references which don't exist yet are labelled by a later
+// reconciliation, once they do.
+func (r *ReplicaSetReconciler) labelReferences(mdb mdbv1.MongoDB) error {
+	for _, name := range referencedSecrets(mdb) {
+		if err := r.setWatchedLabel(types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &corev1.Secret{}); err != nil {
+			return fmt.Errorf("error labelling Secret %s: %s", name, err)
+		}
+	}
+	for _, name := range referencedConfigMaps(mdb) {
+		if err := r.setWatchedLabel(types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &corev1.ConfigMap{}); err != nil {
+			return fmt.Errorf("error labelling ConfigMap %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (r *ReplicaSetReconciler) setWatchedLabel(nsName types.NamespacedName, obj interface {
+	runtime.Object
+	metav1.Object
+}) error {
+	if nsName.Name == "" {
+		return nil
+	}
+	if err := r.client.Get(context.TODO(), nsName, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if obj.GetLabels()[kubernetesClient.WatchedLabelKey] == trueAnnotation {
+		return nil
+	}
+	original := obj.DeepCopyObject()
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[kubernetesClient.WatchedLabelKey] = trueAnnotation
+	obj.SetLabels(labels)
+	// only the label is written, the Secret or ConfigMap may be changed by its owner meanwhile
+	return r.client.MergePatch(original, obj)
+}
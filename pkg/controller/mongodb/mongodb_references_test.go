@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// mongoDBListClient lists the given MongoDB resources, which the mocked client doesn't
+type mongoDBListClient struct {
+	client.Client
+	resources []mdbv1.MongoDB
+}
+
+func (c mongoDBListClient) List(ctx context.Context, list runtime.Object, opts ...k8sClient.ListOption) error {
+	if mdbList, ok := list.(*mdbv1.MongoDBList); ok {
+		mdbList.Items = c.resources
+		return nil
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestResourcesReferencing(t *testing.T) {
+	withTLS := testutils.NewTestReplicaSetWithTLS()
+	withUsers := testutils.NewScramReplicaSet()
+	withUsers.Name = "my-users-rs"
+	withUsers.Spec.Users = []mdbv1.MongoDBUser{{Name: "app", PasswordSecretRef: mdbv1.SecretKeyReference{Name: "app-password"}}}
+	mgr := client.NewManager(&withTLS)
+	r := newReconciler(mgr, testutils.MockManifestProvider(withTLS.Spec.Version))
+	r.client = mongoDBListClient{Client: r.client, resources: []mdbv1.MongoDB{withTLS, withUsers}}
+
+	requestsFor := func(referenced func(mdbv1.MongoDB) []string, meta metav1.ObjectMeta) []reconcile.Request {
+		meta.Namespace = "my-ns"
+		return r.resourcesReferencing(referenced)(handler.MapObject{Meta: &meta})
+	}
+
+	assert.Equal(t, []reconcile.Request{{NamespacedName: withTLS.NamespacedName()}},
+		requestsFor(referencedSecrets, metav1.ObjectMeta{Name: withTLS.Spec.Security.TLS.CertificateKeySecret.Name}))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: withTLS.NamespacedName()}},
+		requestsFor(referencedConfigMaps, metav1.ObjectMeta{Name: withTLS.Spec.Security.TLS.CaConfigMap.Name}))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: withUsers.NamespacedName()}},
+		requestsFor(referencedSecrets, metav1.ObjectMeta{Name: "app-password"}))
+	assert.Empty(t, requestsFor(referencedSecrets, metav1.ObjectMeta{Name: "unrelated"}))
+
+	t.Run("The resources of the referencedBy annotation are reconciled", func(t *testing.T) {
+		meta := metav1.ObjectMeta{Name: "ldap-bind", Annotations: map[string]string{referencedByAnnotationKey: "my-rs, my-users-rs"}}
+		assert.ElementsMatch(t, []reconcile.Request{{NamespacedName: withTLS.NamespacedName()}, {NamespacedName: withUsers.NamespacedName()}},
+			requestsFor(referencedSecrets, meta))
+		assert.Len(t, requestsFor(referencedConfigMaps, metav1.ObjectMeta{Name: "my-rs-settings", Annotations: map[string]string{referencedByAnnotationKey: "my-rs"}}), 1)
+	})
+
+	assert.Nil(t, referencedConfigMaps(withUsers))
+}
+
+func TestLabelReferences(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.Users = []mdbv1.MongoDBUser{{Name: "app", PasswordSecretRef: mdbv1.SecretKeyReference{Name: "app-password"}}}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	password := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-password", Namespace: mdb.Namespace, Labels: map[string]string{"team": "payments"}}}
+	assert.NoError(t, c.Create(context.TODO(), &password))
+
+	assert.NoError(t, r.labelReferences(mdb))
+	_ = c.Get(context.TODO(), types.NamespacedName{Name: "app-password", Namespace: mdb.Namespace}, &password)
+	assert.Equal(t, map[string]string{"team": "payments", client.WatchedLabelKey: "true"}, password.Labels)
+
+	mdb.Spec.Users = append(mdb.Spec.Users, mdbv1.MongoDBUser{Name: "reporting", PasswordSecretRef: mdbv1.SecretKeyReference{Name: "reporting-password"}})
+	assert.NoError(t, r.labelReferences(mdb), "the references which don't exist yet are labelled later")
+}
@@ -0,0 +1,238 @@
+package mongodb
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	kubernetesClient "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/diff"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/vault"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// renderPlaceholder is the password of the users the resources are rendered with
+const renderPlaceholder = "placeholder"
+
+// Render returns the objects the operator creates for the MongoDB resource once it is deployed: the
+// StatefulSet, the Service, the Secrets it generates and the automation config ConfigMap, so that they
+// can be reviewed before the resource is applied. The Secrets, ConfigMaps and Vault secrets referenced by
+// the resource don't need to exist, placeholders are used in their place. The values of the generated Secrets and
+// the sensitive fields of the automation config are redacted.
+func Render(mdb mdbv1.MongoDB) ([]runtime.Object, error) {
+	if problems := validateAdmission(mdb, nil); len(problems) > 0 {
+		return nil, fmt.Errorf("invalid MongoDB resource: %s", strings.Join(problems, "; "))
+	}
+	mdb = *mdb.DeepCopy()
+	if mdb.Spec.Security.TLS.Enabled {
+		// TLS is enabled in the automation config once the certificates are mounted by the members
+		if mdb.Annotations == nil {
+			mdb.Annotations = map[string]string{}
+		}
+		mdb.Annotations[tlsRolledOutAnnotationKey] = trueAnnotation
+	}
+
+	mgr := kubernetesClient.NewManager(&mdb)
+	vaultPlaceholders, err := createRenderPlaceholders(mgr.Client, mdb)
+	if err != nil {
+		return nil, err
+	}
+	r := newReconciler(mgr, readRenderVersionManifest)
+	r.vault = vaultPlaceholders
+	ac, err := r.buildAutomationConfigFromSpec(mdb, automationconfig.AutomationConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("error building automation config: %s", err)
+	}
+
+	sts, err := buildStatefulSet(mdb)
+	if err != nil {
+		return nil, err
+	}
+	sts.TypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"}
+	svc := buildService(mdb)
+	svc.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Service"}
+	objects := []runtime.Object{&sts, &svc}
+
+	for _, nsName := range []types.NamespacedName{mdb.ScramCredentialsNamespacedName(), mdb.TLSOperatorSecretNamespacedName(), mdb.MetricsUserSecretNamespacedName()} {
+		generated, err := mgr.Client.GetSecret(nsName)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		skeleton := redactedSecret(generated)
+		objects = append(objects, &skeleton)
+	}
+
+	cm, err := redactedAutomationConfigConfigMap(mdb, ac)
+	if err != nil {
+		return nil, err
+	}
+	return append(objects, &cm), nil
+}
+
+// renderVaultSecrets are the placeholders of the Vault secrets referenced by the resource, by path
+type renderVaultSecrets map[string]map[string]string
+
+func (s renderVaultSecrets) Read(_ vault.Login, path string) (map[string]string, error) {
+	return s[path], nil
+}
+
+func (s renderVaultSecrets) set(path, key, value string) {
+	if s[path] == nil {
+		s[path] = map[string]string{}
+	}
+	s[path][key] = value
+}
+
+// createRenderPlaceholders creates the Secrets and ConfigMaps referenced by the resource, with a
+// self-signed certificate for TLS, and returns the placeholders of the Vault secrets it references
+func createRenderPlaceholders(c kubernetesClient.Client, mdb mdbv1.MongoDB) (renderVaultSecrets, error) {
+	vaultSecrets := renderVaultSecrets{}
+	for _, user := range mdb.Spec.Users {
+		if user.PasswordVaultRef != nil {
+			vaultSecrets.set(user.PasswordVaultRef.Path, userPasswordKey(user.PasswordVaultRef.Key), renderPlaceholder)
+			continue
+		}
+		// the users may share a Secret, with a key each
+		if err := secret.CreateOrPatch(c, secret.Builder().
+			SetName(user.PasswordSecretRef.Name).
+			SetNamespace(mdb.Namespace).
+			SetField(userPasswordKey(user.PasswordSecretRef.Key), renderPlaceholder).
+			Build()); err != nil {
+			return nil, err
+		}
+	}
+	if !mdb.Spec.Security.TLS.Enabled {
+		return vaultSecrets, nil
+	}
+
+	cert, key, err := placeholderCertificate(mdb.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error generating placeholder certificate: %s", err)
+	}
+	if usesVaultTLS(mdb) {
+		path := mdb.Spec.Security.TLS.VaultSecretPath
+		vaultSecrets.set(path, tlsSecretCertName, cert)
+		vaultSecrets.set(path, tlsSecretKeyName, key)
+		vaultSecrets.set(path, tlsCACertName, cert)
+		return vaultSecrets, nil
+	}
+	if err := secret.CreateOrUpdate(c, secret.Builder().
+		SetName(mdb.TLSSecretNamespacedName().Name).
+		SetNamespace(mdb.Namespace).
+		SetField(tlsSecretCertName, cert).
+		SetField(tlsSecretKeyName, key).
+		Build()); err != nil {
+		return nil, err
+	}
+	return vaultSecrets, configmap.CreateOrUpdate(c, configmap.Builder().
+		SetName(mdb.TLSConfigMapNamespacedName().Name).
+		SetNamespace(mdb.Namespace).
+		SetField(tlsCACertName, cert).
+		Build())
+}
+
+// placeholderCertificate returns a self-signed certificate and its key, PEM encoded
+func placeholderCertificate(commonName string) (string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM), nil
+}
+
+// readRenderVersionManifest reads the version manifest bundled with the operator, the builds of the
+// versions missing from it are generated anyway
+func readRenderVersionManifest() (automationconfig.VersionManifest, error) {
+	manifest, err := readVersionManifestFromDisk()
+	if os.IsNotExist(err) {
+		return automationconfig.VersionManifest{}, nil
+	}
+	return manifest, err
+}
+
+// redactedSecret returns the Secret with the values of its fields redacted
+func redactedSecret(s corev1.Secret) corev1.Secret {
+	skeleton := corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            s.Name,
+			Namespace:       s.Namespace,
+			Labels:          s.Labels,
+			Annotations:     s.Annotations,
+			OwnerReferences: s.OwnerReferences,
+		},
+		Type:       s.Type,
+		StringData: map[string]string{},
+	}
+	for key := range s.Data {
+		skeleton.StringData[key] = diff.Redacted
+	}
+	for key := range s.StringData {
+		skeleton.StringData[key] = diff.Redacted
+	}
+	return skeleton
+}
+
+// redactedAutomationConfigConfigMap returns the ConfigMap storing the automation config, with its
+// sensitive fields redacted. It is never compressed, so that it can be read.
+func redactedAutomationConfigConfigMap(mdb mdbv1.MongoDB, ac automationconfig.AutomationConfig) (corev1.ConfigMap, error) {
+	cm, err := automationConfigConfigMap(mdb, ac)
+	if err != nil {
+		return corev1.ConfigMap{}, err
+	}
+	redacted, err := automationconfig.Redacted(ac)
+	if err != nil {
+		return corev1.ConfigMap{}, fmt.Errorf("error redacting automation config: %s", err)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(redacted); err != nil {
+		return corev1.ConfigMap{}, err
+	}
+	cm.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}
+	cm.Data = map[string]string{AutomationConfigKey: buf.String()}
+	cm.BinaryData = nil
+	return cm, nil
+}
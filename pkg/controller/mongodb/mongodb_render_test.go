@@ -0,0 +1,71 @@
+package mongodb
+
+import (
+	"encoding/json"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/diff"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRender(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mdb.Spec.Security.Authentication = mdbv1.Authentication{Enabled: true, Modes: []mdbv1.AuthMode{"SCRAM"}}
+	mdb.Spec.Users = []mdbv1.MongoDBUser{{
+		Name:              "alice",
+		DB:                "admin",
+		PasswordSecretRef: mdbv1.SecretKeyReference{Name: "alice-password"},
+		Roles:             []mdbv1.Role{{DB: "admin", Name: "readWrite"}},
+	}}
+
+	objects, err := Render(mdb)
+	assert.NoError(t, err)
+	assert.Len(t, objects, 5)
+
+	sts := objects[0].(*appsv1.StatefulSet)
+	assert.Equal(t, "StatefulSet", sts.Kind)
+	assert.Equal(t, mdb.Name, sts.Name)
+	assert.Equal(t, int32(3), *sts.Spec.Replicas)
+	svc := objects[1].(*corev1.Service)
+	assert.Equal(t, mdb.ServiceName(), svc.Name)
+
+	agentSecret := objects[2].(*corev1.Secret)
+	assert.Equal(t, mdb.ScramCredentialsNamespacedName().Name, agentSecret.Name)
+	assert.Empty(t, agentSecret.Data)
+	assert.Len(t, agentSecret.StringData, 2)
+	for _, value := range agentSecret.StringData {
+		assert.Equal(t, diff.Redacted, value)
+	}
+	tlsSecret := objects[3].(*corev1.Secret)
+	assert.Equal(t, mdb.TLSOperatorSecretNamespacedName().Name, tlsSecret.Name)
+	assert.Empty(t, tlsSecret.Data, "the private key isn't printed")
+
+	cm := objects[4].(*corev1.ConfigMap)
+	assert.Equal(t, mdb.ConfigMapName(), cm.Name)
+	ac := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(cm.Data[AutomationConfigKey]), &ac))
+	auth := ac["auth"].(map[string]interface{})
+	assert.Equal(t, diff.Redacted, auth["autoPwd"])
+	assert.Equal(t, diff.Redacted, auth["key"])
+	assert.Len(t, ac["processes"], 3)
+	assert.Contains(t, cm.Data[AutomationConfigKey], `"tls"`, "the automation config is rendered with TLS enabled")
+	assert.NotContains(t, mdb.Annotations, tlsRolledOutAnnotationKey, "the resource isn't changed")
+}
+
+func TestRender_WithoutAuthentication(t *testing.T) {
+	objects, err := Render(testutils.NewTestReplicaSet())
+	assert.NoError(t, err)
+	assert.Len(t, objects, 3, "no Secret is generated")
+	assert.IsType(t, &corev1.ConfigMap{}, objects[2])
+}
+
+func TestRender_InvalidResource(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Version = "latest"
+	_, err := Render(mdb)
+	assert.Error(t, err)
+}
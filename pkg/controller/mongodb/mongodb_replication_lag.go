@@ -0,0 +1,95 @@
+package mongodb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	defaultReplicationLagThreshold = 60 * time.Second
+	defaultReplicationLagFor       = 5 * time.Minute
+	replicationLagHighEventReason  = "ReplicationLagHigh"
+	replicationLagHighReason       = "LagAboveThreshold"
+)
+
+var replicationLagSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "mongodb_replication_lag_seconds",
+	Help: "Replication lag in seconds of a secondary behind the primary",
+}, []string{"namespace", "name", "member"})
+
+func init() {
+	metrics.Registry.MustRegister(replicationLagSeconds)
+}
+
+// replicationLagThreshold returns the lag above which a secondary is lagging, and how long it has to
+// be lagging before the resource is degraded
+func replicationLagThreshold(mdb mdbv1.MongoDB) (time.Duration, time.Duration) {
+	lag, lagFor := defaultReplicationLagThreshold, defaultReplicationLagFor
+	if threshold := mdb.Spec.ReplicationLagThreshold; threshold != nil {
+		if threshold.Lag != nil {
+			lag = threshold.Lag.Duration
+		}
+		if threshold.For != nil {
+			lagFor = threshold.For.Duration
+		}
+	}
+	return lag, lagFor
+}
+
+// laggingSince returns when the replication lag of the member went above the threshold, which is now
+// if it just did, or nil if the member isn't lagging
+func laggingSince(member mdbv1.MemberStatus, threshold time.Duration, now time.Time) *metav1.Time {
+	if member.ReplicationLagSeconds == nil || time.Duration(*member.ReplicationLagSeconds)*time.Second <= threshold {
+		return nil
+	}
+	if member.LaggingSince != nil {
+		return member.LaggingSince
+	}
+	since := metav1.NewTime(now)
+	return &since
+}
+
+// recordReplicationLag exposes the replication lag of the member as a metric, which is removed while
+// the member isn't a secondary
+func recordReplicationLag(mdb mdbv1.MongoDB, member mdbv1.MemberStatus) {
+	labels := prometheus.Labels{"namespace": mdb.Namespace, "name": mdb.Name, "member": member.Name}
+	if member.ReplicationLagSeconds == nil {
+		replicationLagSeconds.Delete(labels)
+		return
+	}
+	replicationLagSeconds.With(labels).Set(float64(*member.ReplicationLagSeconds))
+}
+
+// replicationLagCondition returns the ReplicationLagBelowThreshold condition, which is false if any
+// member has been lagging for longer than lagFor.
+func replicationLagCondition(members []mdbv1.MemberStatus, threshold, lagFor time.Duration, now time.Time) mdbv1.Condition {
+	var messages []string
+	for _, member := range members {
+		if member.LaggingSince != nil && now.Sub(member.LaggingSince.Time) >= lagFor {
+			messages = append(messages, fmt.Sprintf("%s has been more than %s behind the primary since %s", member.Name, threshold, member.LaggingSince.UTC().Format(time.RFC3339)))
+		}
+	}
+	if len(messages) == 0 {
+		return mdbv1.Condition{Type: mdbv1.ReplicationLagBelowThreshold, Status: corev1.ConditionTrue}
+	}
+	return newCondition(mdbv1.ReplicationLagBelowThreshold, corev1.ConditionFalse, replicationLagHighReason, strings.Join(messages, ", "))
+}
+
+// refreshDegradedCondition updates the Degraded condition from the conditions set outside of the
+// reconciliation, unless it was set by the reconciliation for an error or a failure
+func refreshDegradedCondition(mdb *mdbv1.MongoDB) {
+	if mdb.Spec.Paused || failureCondition(*mdb) != nil {
+		return
+	}
+	if degraded := mdb.GetCondition(mdbv1.Degraded); degraded != nil && degraded.Reason == reconciliationErrorReason {
+		return
+	}
+	mdb.SetCondition(degradedCondition(*mdb))
+}
@@ -0,0 +1,89 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// replicaSetStatusWithLag returns the status of the members of the replica set, with the
+// secondaries lagging behind the primary by the given lag
+func replicaSetStatusWithLag(lag time.Duration) []livecluster.MemberStatus {
+	optime := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	return []livecluster.MemberStatus{
+		{Name: "my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017", StateStr: "PRIMARY", OptimeDate: optime, Self: true},
+		{Name: "my-rs-1.my-rs-svc.my-ns.svc.cluster.local:27017", StateStr: "SECONDARY", OptimeDate: optime.Add(-lag)},
+		{Name: "my-rs-2.my-rs-svc.my-ns.svc.cluster.local:27017", StateStr: "SECONDARY", OptimeDate: optime},
+	}
+}
+
+func TestUpdateMemberStates_ReportsSustainedReplicationLag(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.ReplicationLagThreshold = &mdbv1.ReplicationLagThreshold{
+		Lag: &metav1.Duration{Duration: 10 * time.Second},
+		For: &metav1.Duration{Duration: time.Minute},
+	}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	live := &mockLiveCluster{members: replicaSetStatusWithLag(30 * time.Second)}
+	r.connectToLiveCluster = func(_ string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		return *live, nil
+	}
+	laggingSince := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return laggingSince }
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.NoError(t, r.updateMemberStates(mdb))
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	if assert.NotNil(t, mdb.Status.Members[1].LaggingSince) {
+		assert.True(t, laggingSince.Equal(mdb.Status.Members[1].LaggingSince.Time))
+	}
+	assert.Nil(t, mdb.Status.Members[2].LaggingSince)
+	assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.ReplicationLagBelowThreshold).Status, "a short lag is ignored")
+	assert.Equal(t, float64(30), testutil.ToFloat64(replicationLagSeconds.WithLabelValues(mdb.Namespace, mdb.Name, "my-rs-1")))
+
+	t.Run("A sustained lag degrades the resource", func(t *testing.T) {
+		r.now = func() time.Time { return laggingSince.Add(2 * time.Minute) }
+		assert.NoError(t, r.updateMemberStates(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assertCondition(t, mdb, mdbv1.ReplicationLagBelowThreshold, corev1.ConditionFalse, replicationLagHighReason)
+		assert.Equal(t, "my-rs-1 has been more than 10s behind the primary since 2026-01-01T12:00:00Z", mdb.GetCondition(mdbv1.ReplicationLagBelowThreshold).Message)
+		assertCondition(t, mdb, mdbv1.Degraded, corev1.ConditionTrue, replicationLagHighReason)
+	})
+
+	t.Run("The resource is healthy once the secondary caught up", func(t *testing.T) {
+		live.members = replicaSetStatusWithLag(0)
+		assert.NoError(t, r.updateMemberStates(mdb))
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Nil(t, mdb.Status.Members[1].LaggingSince)
+		assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.ReplicationLagBelowThreshold).Status)
+		assertCondition(t, mdb, mdbv1.Degraded, corev1.ConditionFalse, healthyReason)
+	})
+}
+
+func TestReplicationLagThreshold(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	lag, lagFor := replicationLagThreshold(mdb)
+	assert.Equal(t, defaultReplicationLagThreshold, lag)
+	assert.Equal(t, defaultReplicationLagFor, lagFor)
+
+	mdb.Spec.ReplicationLagThreshold = &mdbv1.ReplicationLagThreshold{Lag: &metav1.Duration{Duration: 5 * time.Minute}}
+	lag, lagFor = replicationLagThreshold(mdb)
+	assert.Equal(t, 5*time.Minute, lag)
+	assert.Equal(t, defaultReplicationLagFor, lagFor)
+}
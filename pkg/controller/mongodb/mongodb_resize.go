@@ -0,0 +1,137 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/resourcerequirements"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	resizeEventReason = "Resize"
+
+	// lastResourcesAnnotationKey holds spec.resources as it was last configured, which is used to
+	// detect a change of the resources of the containers
+	lastResourcesAnnotationKey = "mongodb.com/v1.lastResources"
+)
+
+// mongodResources returns the resources of the mongod container of the members
+func mongodResources(mdb mdbv1.MongoDB) corev1.ResourceRequirements {
+	if mdb.Spec.Resources == nil || mdb.Spec.Resources.MongoD == nil {
+		return resourcerequirements.Defaults()
+	}
+	return *mdb.Spec.Resources.MongoD
+}
+
+// agentResources returns the resources of the agent container of the members
+func agentResources(mdb mdbv1.MongoDB) corev1.ResourceRequirements {
+	if mdb.Spec.Resources == nil || mdb.Spec.Resources.Agent == nil {
+		return resourcerequirements.Defaults()
+	}
+	return *mdb.Spec.Resources.Agent
+}
+
+// resourcesAnnotation returns the value of the lastResources annotation for spec.resources
+func resourcesAnnotation(mdb mdbv1.MongoDB) string {
+	if mdb.Spec.Resources == nil {
+		return ""
+	}
+	// a struct of resource requirements can always be marshalled
+	bytes, _ := json.Marshal(mdb.Spec.Resources)
+	return string(bytes)
+}
+
+// isChangingResources returns true if spec.resources has changed since it was last configured
+func isChangingResources(mdb mdbv1.MongoDB) bool {
+	lastResources, ok := mdb.Annotations[lastResourcesAnnotationKey]
+	return ok && lastResources != resourcesAnnotation(mdb)
+}
+
+// resizeStep applies a change of spec.resources to the members one at a time. The StatefulSet uses
+// the OnDelete update strategy while the resources are changing, like during a version change, and
+// the Pods which don't run its latest revision are evicted in the same order as for a rolling restart:
+// the secondaries first, and the primary last, once stepped down. It returns true once all the
+// members run with the new resources.
+func (r *ReplicaSetReconciler) resizeStep(mdb mdbv1.MongoDB) (bool, error) {
+	if !isChangingResources(mdb) {
+		return true, nil
+	}
+	sts, err := r.client.GetStatefulSet(mdb.NamespacedName())
+	if err != nil {
+		return false, fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	// the revisions are only known once the StatefulSet controller has observed the change
+	if sts.Status.ObservedGeneration < sts.Generation {
+		return false, nil
+	}
+	pending, err := r.membersToResize(mdb, sts)
+	if err != nil {
+		return false, err
+	}
+	if len(pending) == 0 {
+		return true, nil
+	}
+	return false, r.restartMembers(mdb, pending, resizeEventReason)
+}
+
+// membersToResize returns the names of the members, by ordinal, whose Pod doesn't run the latest
+// revision of the StatefulSet, or doesn't exist as it is being recreated.
+func (r *ReplicaSetReconciler) membersToResize(mdb mdbv1.MongoDB, sts appsv1.StatefulSet) ([]string, error) {
+	var pending []string
+	for i := 0; i < mdb.Spec.Members; i++ {
+		name := fmt.Sprintf("%s-%d", mdb.Name, i)
+		pod := corev1.Pod{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &pod); err != nil {
+			if errors.IsNotFound(err) {
+				pending = append(pending, name)
+				continue
+			}
+			return nil, fmt.Errorf("error getting pod %s: %s", name, err)
+		}
+		if pod.Labels[appsv1.StatefulSetRevisionLabel] != sts.Status.UpdateRevision {
+			pending = append(pending, name)
+		}
+	}
+	return pending, nil
+}
+
+// isResizeStarted returns true if the Pod template of the StatefulSet has the resources of
+// spec.resources already, in which case the change of the resources must be completed.
+func (r *ReplicaSetReconciler) isResizeStarted(mdb mdbv1.MongoDB) (bool, error) {
+	sts, err := r.client.GetStatefulSet(mdb.NamespacedName())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		if c.Name == mongodbName && !equality.Semantic.DeepEqual(c.Resources, mongodResources(mdb)) {
+			return false, nil
+		}
+		if c.Name == agentName && !equality.Semantic.DeepEqual(c.Resources, agentResources(mdb)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lastResources returns spec.resources as it was last configured
+func lastResources(mdb mdbv1.MongoDB) (*mdbv1.Resources, error) {
+	lastResources := mdb.Annotations[lastResourcesAnnotationKey]
+	if lastResources == "" {
+		return nil, nil
+	}
+	resources := &mdbv1.Resources{}
+	if err := json.Unmarshal([]byte(lastResources), resources); err != nil {
+		return nil, fmt.Errorf("error reading %s annotation: %s", lastResourcesAnnotationKey, err)
+	}
+	return resources, nil
+}
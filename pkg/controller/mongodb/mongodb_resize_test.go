@@ -0,0 +1,160 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/resourcerequirements"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func largerMongodResources() *mdbv1.Resources {
+	return &mdbv1.Resources{
+		MongoD: &corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2"),
+				corev1.ResourceMemory: resource.MustParse("4G"),
+			},
+		},
+	}
+}
+
+// setRevision labels the Pods of the members with the revision of the StatefulSet they run
+func setRevision(t *testing.T, c client.Client, mdb mdbv1.MongoDB, name, revision string) {
+	pod := corev1.Pod{}
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &pod))
+	pod.Labels = map[string]string{appsv1.StatefulSetRevisionLabel: revision}
+	assert.NoError(t, c.Update(context.TODO(), &pod))
+}
+
+// resizeRequestedReplicaSet reconciles a healthy replica set whose member with the given index is
+// the primary, then changes the resources of the mongod container, which results in a new revision
+// of the StatefulSet.
+func resizeRequestedReplicaSet(t *testing.T, primary *int) (*ReplicaSetReconciler, client.Client, mdbv1.MongoDB) {
+	r, c, mdb := restartRequestedReplicaSet(t, primary, time.Now())
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.RestartedAt = nil
+	mdb.Spec.Resources = largerMongodResources()
+	_ = c.Update(context.TODO(), &mdb)
+
+	for i := 0; i < mdb.Spec.Members; i++ {
+		setRevision(t, c, mdb, fmt.Sprintf("%s-%d", mdb.Name, i), "revision-1")
+	}
+	sts := appsv1.StatefulSet{}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &sts)
+	sts.Status.UpdateRevision = "revision-2"
+	_ = c.Update(context.TODO(), &sts)
+	return r, c, mdb
+}
+
+func TestStatefulSet_UsesSpecResources(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	sts, _ := buildStatefulSet(mdb)
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		assert.Equal(t, resourcerequirements.Defaults(), c.Resources)
+	}
+
+	mdb.Spec.Resources = largerMongodResources()
+	sts, _ = buildStatefulSet(mdb)
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		if c.Name == mongodbName {
+			assert.Equal(t, *mdb.Spec.Resources.MongoD, c.Resources)
+		} else {
+			assert.Equal(t, resourcerequirements.Defaults(), c.Resources)
+		}
+	}
+}
+
+func TestResize_RestartsSecondariesFirstAndPrimaryLast(t *testing.T) {
+	primary := 1
+	r, c, mdb := resizeRequestedReplicaSet(t, &primary)
+
+	for _, restarted := range []string{"my-rs-2", "my-rs-0", "", "my-rs-1"} {
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		assertRequeued(t, res)
+
+		sts := appsv1.StatefulSet{}
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &sts)
+		assert.Equal(t, appsv1.OnDeleteStatefulSetStrategyType, sts.Spec.UpdateStrategy.Type, "the StatefulSet doesn't restart the members itself")
+
+		if restarted == "" {
+			assert.Equal(t, 2, primary, "the primary is stepped down before being restarted")
+			continue
+		}
+		for i := 0; i < mdb.Spec.Members; i++ {
+			name := fmt.Sprintf("%s-%d", mdb.Name, i)
+			err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &corev1.Pod{})
+			if name == restarted {
+				assert.True(t, errors.IsNotFound(err), "pod %s is evicted", name)
+			} else {
+				assert.NoError(t, err)
+			}
+		}
+		recreatePod(t, c, mdb, restarted, time.Now())
+		setRevision(t, c, mdb, restarted, "revision-2")
+	}
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	sts := appsv1.StatefulSet{}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &sts)
+	assert.Equal(t, appsv1.RollingUpdateStatefulSetStrategyType, sts.Spec.UpdateStrategy.Type)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.False(t, isChangingResources(mdb))
+}
+
+func TestResize_IsDeferredUntilMaintenanceWindow(t *testing.T) {
+	primary := 0
+	r, c, mdb := resizeRequestedReplicaSet(t, &primary)
+	r.now = func() time.Time { return friday }
+	mdb.Spec.MaintenanceWindow = saturdayWindow
+	_ = c.Update(context.TODO(), &mdb)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, saturday.Sub(friday), res.RequeueAfter)
+	for i := 0; i < mdb.Spec.Members; i++ {
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: fmt.Sprintf("%s-%d", mdb.Name, i), Namespace: mdb.Namespace}, &corev1.Pod{}))
+	}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.True(t, isChangingResources(mdb), "the resources are only recorded once applied")
+	if assert.NotNil(t, mdb.Status.PendingMaintenance) {
+		assert.Equal(t, []string{"change of the resources of the containers"}, mdb.Status.PendingMaintenance.Changes)
+	}
+
+	r.now = func() time.Time { return saturday }
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assert.True(t, errors.IsNotFound(c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-2", Namespace: mdb.Namespace}, &corev1.Pod{})))
+}
+
+func TestIsChangingResources(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	assert.False(t, isChangingResources(mdb), "the resources of a new deployment aren't changing")
+
+	mdb.Annotations = map[string]string{lastResourcesAnnotationKey: ""}
+	assert.False(t, isChangingResources(mdb))
+
+	mdb.Spec.Resources = largerMongodResources()
+	assert.True(t, isChangingResources(mdb))
+
+	mdb.Annotations[lastResourcesAnnotationKey] = resourcesAnnotation(mdb)
+	assert.False(t, isChangingResources(mdb))
+	resources, err := lastResources(mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, mdb.Spec.Resources.MongoD.Limits.Cpu().String(), resources.MongoD.Limits.Cpu().String())
+}
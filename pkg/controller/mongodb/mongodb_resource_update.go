@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"context"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// resourceUpdate holds the changes made to the status and the annotations of the resource by the
+// current reconciliation. They are written together once it's done, rather than one at a time as
+// each step completes, which made the writes conflict with each other and reconcile the resource again.
+type resourceUpdate struct {
+	// original is the resource as first read by the reconciliation
+	original *mdbv1.MongoDB
+	// changed is the resource with the changes of the reconciliation
+	changed *mdbv1.MongoDB
+}
+
+// getResource returns the resource with the changes already made to it by the current
+// reconciliation, or as read from the cluster outside of a reconciliation. The changes made to the
+// returned resource are written with writeStatus and writeAnnotations.
+func (r ReplicaSetReconciler) getResource(nsName types.NamespacedName) (*mdbv1.MongoDB, error) {
+	if r.update != nil && r.update.changed != nil && r.update.changed.NamespacedName() == nsName {
+		return r.update.changed, nil
+	}
+	mdb := &mdbv1.MongoDB{}
+	if err := r.client.Get(context.TODO(), nsName, mdb); err != nil {
+		return nil, err
+	}
+	if r.update != nil && r.update.changed == nil && nsName == r.nsName {
+		r.update.original = mdb
+		r.update.changed = mdb.DeepCopy()
+		return r.update.changed, nil
+	}
+	return mdb, nil
+}
+
+// isPending returns true if the changes made to the resource are written at the end of the
+// current reconciliation
+func (r ReplicaSetReconciler) isPending(mdb *mdbv1.MongoDB) bool {
+	return r.update != nil && r.update.changed == mdb
+}
+
+// writeStatus writes the status of the resource returned by getResource, unless it's written at
+// the end of the current reconciliation
+func (r ReplicaSetReconciler) writeStatus(mdb *mdbv1.MongoDB) error {
+	if r.isPending(mdb) {
+		return nil
+	}
+	return r.client.Status().Update(context.TODO(), mdb)
+}
+
+// writeAnnotations writes the annotations of the resource returned by getResource, unless they're
+// written at the end of the current reconciliation
+func (r ReplicaSetReconciler) writeAnnotations(mdb *mdbv1.MongoDB) error {
+	if r.isPending(mdb) {
+		return nil
+	}
+	return r.client.Update(context.TODO(), mdb)
+}
+
+// writeResourceUpdate writes the changes made to the resource by the current reconciliation: the
+// annotations and the status are each written with a single merge patch, if they changed. The
+// patches don't carry the resource version, so they don't conflict with the writes made since the
+// resource was read.
+func (r ReplicaSetReconciler) writeResourceUpdate() error {
+	if r.update == nil || r.update.changed == nil {
+		return nil
+	}
+	original, changed := r.update.original, r.update.changed
+
+	if !equality.Semantic.DeepEqual(original.Annotations, changed.Annotations) {
+		patched := original.DeepCopy()
+		patched.Annotations = changed.Annotations
+		if err := r.client.Patch(context.TODO(), patched, k8sClient.MergeFrom(original)); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return wrapError(err, "error patching annotations")
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(original.Status, changed.Status) {
+		patched := original.DeepCopy()
+		patched.Status = changed.Status
+		if err := r.client.Status().Patch(context.TODO(), patched, k8sClient.MergeFrom(original)); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return wrapError(err, "error patching status")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcile_WritesStatusAndAnnotationsOnce(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	writes := &resourceWriteCounter{Client: r.client}
+	r.client = writes
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Equal(t, 1, writes.patches, "the annotations are written with a single patch")
+	assert.Zero(t, writes.statusUpdates)
+	assert.Equal(t, 1, writes.statusPatches, "the status is written with a single patch")
+
+	_ = mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Running, mdb.Status.Phase)
+	assert.Equal(t, mdb.Spec.Version, mdb.Annotations[lastVersionAnnotationKey])
+	assert.Equal(t, "false", mdb.Annotations[hasLeftReadyStateAnnotationKey])
+}
+
+func TestResourceUpdate(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	assert.NoError(t, r.setAnnotations(mdb.NamespacedName(), map[string]string{"first": "1"}))
+	_ = mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, "1", mdb.Annotations["first"], "the changes are written right away outside of a reconciliation")
+
+	r.nsName = mdb.NamespacedName()
+	r.update = &resourceUpdate{}
+	assert.NoError(t, r.setAnnotations(mdb.NamespacedName(), map[string]string{"second": "2"}))
+	assert.NoError(t, r.removeAnnotation(mdb.NamespacedName(), "first"))
+	assert.NoError(t, r.updatePendingMaintenanceStatus(mdb, []string{"spec.version"}, time.Time{}))
+	changed, err := r.getResource(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"second": "2"}, changed.Annotations, "the changes are seen by the reconciliation")
+
+	_ = mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, map[string]string{"first": "1"}, mdb.Annotations, "the changes are only written once the reconciliation is done")
+	assert.Nil(t, mdb.Status.PendingMaintenance)
+
+	other := mdb.DeepCopy()
+	other.Annotations = map[string]string{"first": "1", "other": "3"}
+	assert.NoError(t, mgr.GetClient().Update(context.TODO(), other))
+
+	assert.NoError(t, r.writeResourceUpdate())
+	mdb = mdbv1.MongoDB{}
+	_ = mgr.GetClient().Get(context.TODO(), r.nsName, &mdb)
+	assert.Equal(t, map[string]string{"second": "2", "other": "3"}, mdb.Annotations, "the changes made since the resource was read are kept")
+	assert.Equal(t, &mdbv1.PendingMaintenanceStatus{Changes: []string{"spec.version"}}, mdb.Status.PendingMaintenance)
+}
+
+// resourceWriteCounter counts the writes of the MongoDB resources made with the client it wraps
+type resourceWriteCounter struct {
+	client.Client
+	patches, statusUpdates, statusPatches int
+}
+
+func (c *resourceWriteCounter) Patch(ctx context.Context, obj runtime.Object, patch k8sClient.Patch, opts ...k8sClient.PatchOption) error {
+	if _, ok := obj.(*mdbv1.MongoDB); ok {
+		c.patches++
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *resourceWriteCounter) Status() k8sClient.StatusWriter {
+	return resourceStatusWriteCounter{c}
+}
+
+// resourceStatusWriteCounter counts the writes of the status of the MongoDB resources
+type resourceStatusWriteCounter struct {
+	c *resourceWriteCounter
+}
+
+func (s resourceStatusWriteCounter) Update(ctx context.Context, obj runtime.Object, opts ...k8sClient.UpdateOption) error {
+	s.c.statusUpdates++
+	return s.c.Client.Status().Update(ctx, obj, opts...)
+}
+
+func (s resourceStatusWriteCounter) Patch(ctx context.Context, obj runtime.Object, patch k8sClient.Patch, opts ...k8sClient.PatchOption) error {
+	s.c.statusPatches++
+	return s.c.Client.Status().Patch(ctx, obj, patch, opts...)
+}
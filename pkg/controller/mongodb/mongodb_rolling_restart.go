@@ -0,0 +1,114 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const rollingRestartEventReason = "RollingRestart"
+
+// rollingRestartStep restarts the members whose Pod was created before spec.restartedAt, or
+// before the last change of spec.dependentResources, one at a time, by evicting their Pod. The next member is only restarted once all the members are
+// healthy again and the PodDisruptionBudget allows it. The secondaries are restarted first,
+// starting with the highest ordinal, and the primary is stepped down and restarted last. It
+// returns true once all the members have been restarted.
+func (r *ReplicaSetReconciler) rollingRestartStep(mdb mdbv1.MongoDB) (bool, error) {
+	pending, err := r.membersToRestart(mdb)
+	if err != nil {
+		return false, err
+	}
+	if len(pending) == 0 {
+		return true, nil
+	}
+	return false, r.restartMembers(mdb, pending, rollingRestartEventReason)
+}
+
+// restartMembers restarts the next of the pending members, given by ordinal, once all the members
+// are healthy and the update of the member is approved with spec.gatedRollout: the secondaries first,
+// starting with the highest ordinal, and then the primary, which is stepped down before. Events are
+// recorded with the given reason.
+func (r *ReplicaSetReconciler) restartMembers(mdb mdbv1.MongoDB, pending []string, eventReason string) error {
+	currentAC, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return fmt.Errorf("error reading automation config: %s", err)
+	}
+	members, err := r.getMembersHealth(mdb, currentAC)
+	if err != nil {
+		return err
+	}
+	for _, p := range currentAC.Processes {
+		if !members[p.Name].isHealthy {
+			r.log.Infof("Waiting for member %s to be healthy to restart the next member", p.Name)
+			return nil
+		}
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		if members[pending[i]].isPrimary {
+			continue
+		}
+		if isStarted, err := r.startMemberUpdate(mdb, pending[i]); err != nil || !isStarted {
+			return err
+		}
+		// the Pod is evicted rather than deleted so that it isn't restarted while another member
+		// is disrupted, e.g. by a node drain
+		err := r.evictPod(types.NamespacedName{Name: pending[i], Namespace: mdb.Namespace})
+		if errors.IsTooManyRequests(err) {
+			r.log.Infof("The PodDisruptionBudget doesn't allow member %s to be restarted yet", pending[i])
+			return nil
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error evicting pod %s: %s", pending[i], err)
+		}
+		r.log.Infof("Restarting member %s", pending[i])
+		r.recordRestartEvent(mdb, eventReason, "Restarting member %s", pending[i])
+		return nil
+	}
+
+	// only the primary is left
+	if isStarted, err := r.startMemberUpdate(mdb, pending[0]); err != nil || !isStarted {
+		return err
+	}
+	if err := r.stepDownPrimary(mdb); err != nil {
+		return err
+	}
+	r.log.Infof("Stepped down primary %s so that it is restarted last", pending[0])
+	r.recordRestartEvent(mdb, eventReason, "Stepped down primary %s so that it is restarted last", pending[0])
+	return nil
+}
+
+// membersToRestart returns the names of the members, by ordinal, whose Pod was created before
+// the restart was requested, or doesn't exist as it is being recreated.
+func (r *ReplicaSetReconciler) membersToRestart(mdb mdbv1.MongoDB) ([]string, error) {
+	requestedAt := restartRequestedAt(mdb)
+	if requestedAt == nil {
+		return nil, nil
+	}
+	var pending []string
+	for i := 0; i < mdb.Spec.Members; i++ {
+		name := fmt.Sprintf("%s-%d", mdb.Name, i)
+		pod := corev1.Pod{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &pod); err != nil {
+			if errors.IsNotFound(err) {
+				pending = append(pending, name)
+				continue
+			}
+			return nil, fmt.Errorf("error getting pod %s: %s", name, err)
+		}
+		if pod.CreationTimestamp.Before(requestedAt) {
+			pending = append(pending, name)
+		}
+	}
+	return pending, nil
+}
+
+func (r *ReplicaSetReconciler) recordRestartEvent(mdb mdbv1.MongoDB, reason, messageFmt string, args ...interface{}) {
+	if r.recorder != nil {
+		r.recorder.Eventf(&mdb, corev1.EventTypeNormal, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,136 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// restartRequestedReplicaSet reconciles a healthy replica set whose member with the given index is
+// the primary, then requests a rolling restart at the given time.
+func restartRequestedReplicaSet(t *testing.T, primary *int, restartedAt time.Time) (*ReplicaSetReconciler, client.Client, mdbv1.MongoDB) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	withHealthyReplicaSet(t, r, mgrClient, mdb, primary)
+	r.evictPod = func(nsName types.NamespacedName) error {
+		return mgrClient.Delete(context.TODO(), &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: nsName.Name, Namespace: nsName.Namespace}})
+	}
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.RestartedAt = &metav1.Time{Time: restartedAt}
+	_ = mgrClient.Update(context.TODO(), &mdb)
+	return r, mgrClient, mdb
+}
+
+// recreatePod simulates the StatefulSet recreating the deleted Pod of a member
+func recreatePod(t *testing.T, c client.Client, mdb mdbv1.MongoDB, name string, created time.Time) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         mdb.Namespace,
+			CreationTimestamp: metav1.Time{Time: created},
+			Annotations:       map[string]string{agenthealth.MemberStatusAnnotationKey: `{"lastGoalVersionAchieved":1000,"isInGoalState":true}`},
+		},
+	}
+	assert.NoError(t, c.Create(context.TODO(), &pod))
+}
+
+func TestRollingRestart_RestartsSecondariesFirstAndPrimaryLast(t *testing.T) {
+	restartedAt := time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC)
+	primary := 1
+	r, c, mdb := restartRequestedReplicaSet(t, &primary, restartedAt)
+
+	for _, restarted := range []string{"my-rs-2", "my-rs-0", "", "my-rs-1"} {
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		assertRequeued(t, res)
+
+		if restarted == "" {
+			assert.Equal(t, 2, primary, "the primary is stepped down before being restarted")
+			continue
+		}
+		for i := 0; i < mdb.Spec.Members; i++ {
+			name := fmt.Sprintf("%s-%d", mdb.Name, i)
+			err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &corev1.Pod{})
+			if name == restarted {
+				assert.True(t, errors.IsNotFound(err), "pod %s is deleted", name)
+			} else {
+				assert.NoError(t, err)
+			}
+		}
+		recreatePod(t, c, mdb, restarted, restartedAt.Add(time.Minute))
+	}
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+}
+
+func TestRollingRestart_WaitsForMembersToBeHealthy(t *testing.T) {
+	primary := 0
+	r, c, mdb := restartRequestedReplicaSet(t, &primary, time.Now())
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+
+	// my-rs-2 hasn't been recreated yet
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-1", Namespace: mdb.Namespace}, &corev1.Pod{}))
+}
+
+func TestRollingRestart_WaitsForPodDisruptionBudget(t *testing.T) {
+	primary := 0
+	r, c, mdb := restartRequestedReplicaSet(t, &primary, time.Now())
+	// another member is being evicted by a node drain
+	r.evictPod = func(nsName types.NamespacedName) error {
+		return errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)
+	}
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-2", Namespace: mdb.Namespace}, &corev1.Pod{}))
+}
+
+func TestRollingRestart_IsDeferredUntilMaintenanceWindow(t *testing.T) {
+	primary := 0
+	r, c, mdb := restartRequestedReplicaSet(t, &primary, friday)
+	r.now = func() time.Time { return friday }
+	mdb.Spec.MaintenanceWindow = saturdayWindow
+	_ = c.Update(context.TODO(), &mdb)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, saturday.Sub(friday), res.RequeueAfter)
+	for i := 0; i < mdb.Spec.Members; i++ {
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: fmt.Sprintf("%s-%d", mdb.Name, i), Namespace: mdb.Namespace}, &corev1.Pod{}))
+	}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	if assert.NotNil(t, mdb.Status.PendingMaintenance) {
+		assert.Equal(t, []string{"rolling restart requested at 2020-06-05T12:00:00Z"}, mdb.Status.PendingMaintenance.Changes)
+	}
+
+	r.now = func() time.Time { return saturday }
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	err = c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-2", Namespace: mdb.Namespace}, &corev1.Pod{})
+	assert.True(t, errors.IsNotFound(err))
+}
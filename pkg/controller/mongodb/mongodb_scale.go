@@ -0,0 +1,161 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	scalingDownEventReason = "ScalingDown"
+	scalingUpEventReason   = "ScalingUp"
+
+	// maxReplicationLag is the replication lag of the remaining members below which
+	// they are considered caught up with the primary
+	maxReplicationLag = 10 * time.Second
+)
+
+// scaleStep returns the number of members of the automation config and the number of replicas
+// of the StatefulSet for this reconciliation, when spec.members differs from the members of the
+// current automation config.
+//
+// When spec.members is decreased, the members are removed from the replica set one at a time,
+// starting with the highest ordinal. The StatefulSet is only shrunk once the remaining members have
+// applied the new replica set configuration and have caught up with the primary, and the next member
+// is removed after that. The primary is stepped down before being removed.
+//
+// When spec.members is increased, the members are added one at a time, the next one only once the
+// previous one has completed its initial sync, so that the primary doesn't serve several initial
+// syncs at once.
+func (r *ReplicaSetReconciler) scaleStep(mdb mdbv1.MongoDB) (int, int, error) {
+	currentAC, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading automation config: %s", err)
+	}
+	sts := appsv1.StatefulSet{}
+	if err := r.client.Get(context.TODO(), mdb.NamespacedName(), &sts); err != nil {
+		if errors.IsNotFound(err) && len(currentAC.Processes) == 0 {
+			return initialMembers(mdb), initialMembers(mdb), nil
+		}
+		if errors.IsNotFound(err) {
+			return mdb.Spec.Members, mdb.Spec.Members, nil
+		}
+		return 0, 0, fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+
+	acMembers := len(currentAC.Processes)
+	replicas := int(*sts.Spec.Replicas)
+	if acMembers == 0 {
+		return initialMembers(mdb), initialMembers(mdb), nil
+	}
+	// the members of a new replica set have no data to sync and are all added at once,
+	// and the automation config can't be changed while the automation is frozen
+	if mdb.Spec.AutomationFreeze || (mdb.Spec.Members == acMembers && mdb.Spec.Members >= replicas) {
+		return mdb.Spec.Members, mdb.Spec.Members, nil
+	}
+
+	members, err := r.getMembersHealth(mdb, currentAC)
+	if err != nil {
+		return 0, 0, err
+	}
+	if reason := replicaSetNotSettledReason(currentAC, members); reason != "" {
+		r.log.Infof("Waiting to continue scaling: %s", reason)
+		return acMembers, replicas, nil
+	}
+
+	if mdb.Spec.Members > acMembers {
+		added := fmt.Sprintf("%s-%d", mdb.Name, acMembers)
+		r.log.Infof("Adding member %s to the replica set", added)
+		r.recordScalingEvent(mdb, scalingUpEventReason, "Adding member %s to the replica set", added)
+		if replicas < acMembers+1 {
+			replicas = acMembers + 1
+		}
+		return acMembers + 1, replicas, nil
+	}
+
+	if replicas > acMembers {
+		r.log.Infof("Removing the Pods of the members removed from the replica set, %d replicas remaining", acMembers)
+		return acMembers, acMembers, nil
+	}
+	removed := fmt.Sprintf("%s-%d", mdb.Name, acMembers-1)
+	if members[removed].isPrimary {
+		// the primary can't remove itself from the replica set
+		if err := r.stepDownPrimary(mdb); err != nil {
+			return 0, 0, err
+		}
+		r.log.Infof("Stepped down primary %s before removing it from the replica set", removed)
+		return acMembers, replicas, nil
+	}
+	r.log.Infof("Removing member %s from the replica set", removed)
+	r.recordScalingEvent(mdb, scalingDownEventReason, "Removing member %s from the replica set", removed)
+	return acMembers - 1, replicas, nil
+}
+
+// replicaSetNotSettledReason returns why the live replica set doesn't match the automation config yet,
+// or an empty string if all its members are healthy, which a member in initial sync isn't, the members
+// removed from the automation config are not part of the replica set anymore, and all the members have
+// caught up with the primary.
+func replicaSetNotSettledReason(ac automationconfig.AutomationConfig, members map[string]memberHealth) string {
+	processes := map[string]bool{}
+	for _, p := range ac.Processes {
+		processes[p.Name] = true
+		if !members[p.Name].isHealthy {
+			return fmt.Sprintf("member %s is not healthy", p.Name)
+		}
+	}
+
+	var primaryOptime time.Time
+	for name, m := range members {
+		if !processes[name] {
+			return fmt.Sprintf("member %s hasn't been removed from the replica set yet", name)
+		}
+		if m.isPrimary {
+			primaryOptime = m.optime
+		}
+	}
+	if primaryOptime.IsZero() {
+		return "the replica set has no primary"
+	}
+	for name, m := range members {
+		if lag := primaryOptime.Sub(m.optime); lag > maxReplicationLag {
+			return fmt.Sprintf("member %s is %s behind the primary", name, lag)
+		}
+	}
+	return ""
+}
+
+// withMembers removes the processes and the replica set members from the automation config
+// whose ordinal is greater than or equal to the given number of members.
+func withMembers(members int) automationconfig.Modification {
+	return func(ac *automationconfig.AutomationConfig) {
+		if len(ac.Processes) <= members {
+			return
+		}
+		kept := map[string]bool{}
+		for _, p := range ac.Processes[:members] {
+			kept[p.Name] = true
+		}
+		ac.Processes = ac.Processes[:members]
+		for i := range ac.ReplicaSets {
+			var rsMembers []automationconfig.ReplicaSetMember
+			for _, m := range ac.ReplicaSets[i].Members {
+				if kept[m.Host] {
+					rsMembers = append(rsMembers, m)
+				}
+			}
+			ac.ReplicaSets[i].Members = rsMembers
+		}
+	}
+}
+
+func (r *ReplicaSetReconciler) recordScalingEvent(mdb mdbv1.MongoDB, reason, messageFmt string, args ...interface{}) {
+	if r.recorder != nil {
+		r.recorder.Eventf(&mdb, corev1.EventTypeNormal, reason, messageFmt, args...)
+	}
+}
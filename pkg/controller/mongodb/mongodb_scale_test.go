@@ -0,0 +1,178 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestScaleDown_RemovesOneMemberAtATime(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Members = 5
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	primary := 4
+	withHealthyReplicaSet(t, r, mgrClient, mdb, &primary)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Members = 3
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	expectedSteps := []struct {
+		acMembers int
+		replicas  int
+	}{
+		// the primary is stepped down first
+		{acMembers: 5, replicas: 5},
+		{acMembers: 4, replicas: 5},
+		{acMembers: 4, replicas: 4},
+		{acMembers: 3, replicas: 4},
+	}
+	for i, expected := range expectedSteps {
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		assertRequeued(t, res, "step %d", i)
+
+		ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+		assert.NoError(t, err)
+		assert.Len(t, ac.Processes, expected.acMembers, "step %d", i)
+		assert.Len(t, ac.ReplicaSets[0].Members, expected.acMembers, "step %d", i)
+
+		sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+		assert.NoError(t, err)
+		assert.Equal(t, int32(expected.replicas), *sts.Spec.Replicas, "step %d", i)
+
+		current := mdbv1.MongoDB{}
+		assert.NoError(t, mgrClient.Get(context.TODO(), mdb.NamespacedName(), &current))
+		assert.Equal(t, expected.replicas, current.Status.Replicas, "step %d", i)
+	}
+
+	testutils.MakeStatefulSetReady(mgrClient, mdb)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), *sts.Spec.Replicas)
+}
+
+// syncingReplicaSet is a mockReplicaSet whose given members are in initial sync
+type syncingReplicaSet struct {
+	mockReplicaSet
+	syncing map[string]bool
+}
+
+func (m syncingReplicaSet) ReplicaSetStatus(ctx context.Context) ([]livecluster.MemberStatus, error) {
+	members, err := m.mockReplicaSet.ReplicaSetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range members {
+		if m.syncing[processName(members[i].Name)] {
+			members[i].StateStr = "STARTUP2"
+		}
+	}
+	return members, nil
+}
+
+func TestScaleUp_AddsOneMemberAtATime(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Members = 5
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	primary := 0
+	withHealthyReplicaSet(t, r, mgrClient, mdb, &primary)
+	syncing := map[string]bool{}
+	r.connectToLiveCluster = func(_ string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		return syncingReplicaSet{mockReplicaSet: mockReplicaSet{client: mgrClient, mdb: mdb, primary: &primary}, syncing: syncing}, nil
+	}
+
+	assertMembers := func(acMembers, replicas int) {
+		ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+		assert.NoError(t, err)
+		assert.Len(t, ac.Processes, acMembers)
+		assert.Len(t, ac.ReplicaSets[0].Members, acMembers)
+
+		sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+		assert.NoError(t, err)
+		assert.Equal(t, int32(replicas), *sts.Spec.Replicas)
+	}
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assertMembers(4, 4)
+
+	// the next member isn't added while the previous one is in initial sync
+	syncing["my-rs-3"] = true
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assertMembers(4, 4)
+
+	delete(syncing, "my-rs-3")
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertMembers(5, 5)
+
+	testutils.MakeStatefulSetReady(mgrClient, mdb)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, 5, mdb.Status.Replicas)
+	assert.Equal(t, "app=my-rs-svc", mdb.Status.LabelSelector)
+}
+
+func TestReplicaSetNotSettledReason(t *testing.T) {
+	ac := automationconfig.AutomationConfig{Processes: []automationconfig.Process{{Name: "my-rs-0"}, {Name: "my-rs-1"}}}
+	now := time.Now()
+
+	t.Run("Settled", func(t *testing.T) {
+		members := map[string]memberHealth{
+			"my-rs-0": {isHealthy: true, isPrimary: true, optime: now},
+			"my-rs-1": {isHealthy: true, optime: now.Add(-time.Second)},
+		}
+		assert.Equal(t, "", replicaSetNotSettledReason(ac, members))
+	})
+	t.Run("Removed member is still in the replica set", func(t *testing.T) {
+		members := map[string]memberHealth{
+			"my-rs-0": {isHealthy: true, isPrimary: true, optime: now},
+			"my-rs-1": {isHealthy: true, optime: now},
+			"my-rs-2": {isHealthy: true, optime: now},
+		}
+		assert.Contains(t, replicaSetNotSettledReason(ac, members), "my-rs-2")
+	})
+	t.Run("Member is lagging", func(t *testing.T) {
+		members := map[string]memberHealth{
+			"my-rs-0": {isHealthy: true, isPrimary: true, optime: now},
+			"my-rs-1": {isHealthy: true, optime: now.Add(-time.Minute)},
+		}
+		assert.Contains(t, replicaSetNotSettledReason(ac, members), "behind the primary")
+	})
+	t.Run("Member is unhealthy", func(t *testing.T) {
+		members := map[string]memberHealth{
+			"my-rs-0": {isHealthy: true, isPrimary: true, optime: now},
+		}
+		assert.Contains(t, replicaSetNotSettledReason(ac, members), "not healthy")
+	})
+}
@@ -0,0 +1,76 @@
+package mongodb
+
+import (
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// waitingForSecretReason is the reason of the WaitingForSecret and Progressing conditions, and of the
+	// event emitted, while a referenced Secret doesn't exist
+	waitingForSecretReason = "WaitingForSecret"
+	// secretsFoundEventReason is the reason of the event emitted once the Secrets waited for exist
+	secretsFoundEventReason = "SecretsFound"
+)
+
+// isWaitingForSecret returns true if the terminal error is a referenced Secret which doesn't exist. The
+// Secret may be created later by another controller, such as the External Secrets Operator, so the
+// resource waits for it rather than failing.
+func isWaitingForSecret(terminal terminalError) bool {
+	return terminal.notFound != nil && terminal.notFound.kind == "Secret"
+}
+
+// waitForSecret sets the resource to the Pending phase with the WaitingForSecret condition, emits an
+// event the first time it waits for the Secret, and requeues it. A Secret created by another controller
+// doesn't have the label of the Secrets cached by the operator, so its creation can't be watched, and
+// the resource is requeued until it exists instead.
+func (r *ReplicaSetReconciler) waitForSecret(mdb mdbv1.MongoDB, terminal terminalError) (reconcile.Result, error) {
+	missing := terminal.notFound
+	message := fmt.Sprintf(`Waiting for Secret "%s" referenced by %s to be created`, missing.nsName, missing.referencedBy)
+	condition := newCondition(mdbv1.WaitingForSecret, corev1.ConditionTrue, missing.kind+notFoundReasonSuffix, message)
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error getting resource: %s", err)
+	}
+	conditionChanged := isConditionChanged(newMdb.GetCondition(mdbv1.WaitingForSecret), condition)
+	if conditionChanged || newMdb.Status.Phase != mdbv1.Pending {
+		newMdb.SetCondition(condition)
+		newMdb.SetCondition(*referencedResourcesFoundCondition(&terminal))
+		newMdb.Status.Phase = mdbv1.Pending
+		if err := r.writeStatus(newMdb); err != nil {
+			return reconcile.Result{}, fmt.Errorf("error updating status: %s", err)
+		}
+	}
+	if conditionChanged && r.recorder != nil {
+		r.recorder.Event(newMdb, corev1.EventTypeNormal, waitingForSecretReason, message)
+	}
+	return r.requeueInProgress(waitingForSecretReason, "%s", message)
+}
+
+// stopWaitingForSecrets removes the WaitingForSecret condition of the resource once the Secrets it
+// references exist, and emits an event
+func (r *ReplicaSetReconciler) stopWaitingForSecrets(mdb mdbv1.MongoDB) error {
+	if mdb.GetCondition(mdbv1.WaitingForSecret) == nil {
+		return nil
+	}
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if newMdb.GetCondition(mdbv1.WaitingForSecret) == nil {
+		return nil
+	}
+	newMdb.RemoveCondition(mdbv1.WaitingForSecret)
+	newMdb.SetCondition(*referencedResourcesFoundCondition(nil))
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	if r.recorder != nil {
+		r.recorder.Event(newMdb, corev1.EventTypeNormal, secretsFoundEventReason, "The Secrets referenced by the resource exist")
+	}
+	return nil
+}
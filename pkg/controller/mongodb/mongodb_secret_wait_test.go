@@ -0,0 +1,95 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newReplicaSetWithUserPasswordSecret() mdbv1.MongoDB {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Users = []mdbv1.MongoDBUser{{
+		Name:              "app-user",
+		DB:                "admin",
+		PasswordSecretRef: mdbv1.SecretKeyReference{Name: "app-user-password"},
+		Roles:             []mdbv1.Role{{Name: "readWrite", DB: "app"}},
+	}}
+	return mdb
+}
+
+func TestMissingUserPasswordSecret_WaitsForTheSecret(t *testing.T) {
+	mdb := newReplicaSetWithUserPasswordSecret()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	recorder := record.NewFakeRecorder(20)
+	r.recorder = recorder
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, requeueInterval, res.RequeueAfter, "the creation of a Secret which isn't labelled isn't watched")
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Pending, mdb.Status.Phase)
+	assertCondition(t, mdb, mdbv1.WaitingForSecret, corev1.ConditionTrue, "SecretNotFound")
+	assert.Equal(t, `Waiting for Secret "my-ns/app-user-password" referenced by spec.users[0].passwordSecretRef to be created`, mdb.GetCondition(mdbv1.WaitingForSecret).Message)
+	assertCondition(t, mdb, mdbv1.ReferencedResourcesFound, corev1.ConditionFalse, "SecretNotFound")
+	assertCondition(t, mdb, mdbv1.Progressing, corev1.ConditionTrue, waitingForSecretReason)
+	assert.Nil(t, mdb.GetCondition(mdbv1.ConfigurationValid), "the resource isn't failed")
+	assert.Contains(t, recordedEvents(recorder), `Normal WaitingForSecret Waiting for Secret "my-ns/app-user-password" referenced by spec.users[0].passwordSecretRef to be created`)
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.True(t, res.RequeueAfter > requeueInterval, "the requeues are backed off")
+	assert.Empty(t, recordedEvents(recorder), "the event is emitted once")
+
+	passwordSecret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-user-password", Namespace: mdb.Namespace}, Data: map[string][]byte{"password": []byte("s3cr3t")}}
+	assert.NoError(t, c.Create(context.TODO(), &passwordSecret))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Nil(t, mdb.GetCondition(mdbv1.WaitingForSecret))
+	assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.ReferencedResourcesFound).Status)
+	assert.Contains(t, recordedEvents(recorder), "Normal SecretsFound The Secrets referenced by the resource exist")
+}
+
+func TestMissingUserPasswordSecret_CreatedWithoutThePassword(t *testing.T) {
+	mdb := newReplicaSetWithUserPasswordSecret()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	passwordSecret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-user-password", Namespace: mdb.Namespace}, Data: map[string][]byte{"other": []byte("secret")}}
+	assert.NoError(t, c.Create(context.TODO(), &passwordSecret))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assertConfigurationInvalid(t, c, mdb, missingPrerequisiteReason)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Nil(t, mdb.GetCondition(mdbv1.WaitingForSecret), "the Secret exists, it is watched once labelled")
+}
+
+func TestMissingTLSSecret_WaitsForTheSecret(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	assert.NoError(t, createTLSSecretAndConfigMap(c, mdb))
+	assert.NoError(t, c.Delete(context.TODO(), &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: mdb.TLSSecretNamespacedName().Name, Namespace: mdb.Namespace}}))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.NotZero(t, res.RequeueAfter)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.WaitingForSecret, corev1.ConditionTrue, "SecretNotFound")
+	assert.Contains(t, mdb.GetCondition(mdbv1.WaitingForSecret).Message, "spec.security.tls.certificateKeySecretRef")
+}
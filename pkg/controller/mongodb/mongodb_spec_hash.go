@@ -0,0 +1,38 @@
+package mongodb
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// specHashAnnotationKey holds the hash of the StatefulSet or the automation config ConfigMap the
+// operator last wrote, so that they aren't written again when nothing changed
+const specHashAnnotationKey = "mongodb.com/v1.specHash"
+
+// specHash returns the hash of the object the operator is about to write
+func specHash(obj interface{}) (string, error) {
+	bytes, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(bytes)), nil
+}
+
+// setSpecHash annotates the desired object with its hash, and returns whether the existing object
+// was written with the same one, in which case it doesn't need to be written again
+func setSpecHash(desired, existing metav1.Object) (bool, error) {
+	hash, err := specHash(desired)
+	if err != nil {
+		return false, fmt.Errorf("error hashing %s: %s", desired.GetName(), err)
+	}
+	annotations := desired.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[specHashAnnotationKey] = hash
+	desired.SetAnnotations(annotations)
+	return existing.GetName() != "" && existing.GetAnnotations()[specHashAnnotationKey] == hash, nil
+}
@@ -0,0 +1,75 @@
+package mongodb
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestSetSpecHash(t *testing.T) {
+	desired := corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "my-rs-config"}, Data: map[string]string{"cluster-config.json": "{}"}}
+	isUnchanged, err := setSpecHash(&desired, &corev1.ConfigMap{})
+	assert.NoError(t, err)
+	assert.False(t, isUnchanged, "an object which doesn't exist is written")
+	assert.NotEmpty(t, desired.Annotations[specHashAnnotationKey])
+
+	existing := desired
+	desired = corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "my-rs-config"}, Data: map[string]string{"cluster-config.json": "{}"}}
+	isUnchanged, _ = setSpecHash(&desired, &existing)
+	assert.True(t, isUnchanged)
+
+	desired = corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "my-rs-config"}, Data: map[string]string{"cluster-config.json": `{"version":2}`}}
+	isUnchanged, _ = setSpecHash(&desired, &existing)
+	assert.False(t, isUnchanged)
+}
+
+func TestReconcile_UnchangedResourcesAreNotWritten(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	writes := &automationConfigWriteCounter{statefulSetApplier: statefulSetApplier{Client: r.client}, name: mdb.ConfigMapName()}
+	r.client = writes
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Empty(t, writes.applied, "the StatefulSet isn't applied again when nothing changed")
+	assert.Zero(t, writes.automationConfigWrites, "the automation config isn't published again when nothing changed")
+
+	assert.NoError(t, c.DeleteStatefulSet(mdb.NamespacedName()))
+	assert.NoError(t, c.DeleteConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}))
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Len(t, writes.applied, 1, "a deleted StatefulSet is applied again")
+	assert.Equal(t, 1, writes.automationConfigWrites)
+}
+
+// automationConfigWriteCounter counts the writes of the automation config ConfigMap, and records
+// the applied StatefulSets
+type automationConfigWriteCounter struct {
+	statefulSetApplier
+	name                   string
+	automationConfigWrites int
+}
+
+func (c *automationConfigWriteCounter) UpdateConfigMap(cm corev1.ConfigMap) error {
+	if cm.Name == c.name {
+		c.automationConfigWrites++
+	}
+	return c.Client.UpdateConfigMap(cm)
+}
+
+func (c *automationConfigWriteCounter) CreateConfigMap(cm corev1.ConfigMap) error {
+	if cm.Name == c.name {
+		c.automationConfigWrites++
+	}
+	return c.Client.CreateConfigMap(cm)
+}
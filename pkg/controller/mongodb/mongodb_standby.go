@@ -0,0 +1,338 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	standbyRestoredEventReason      = "StandbyRestored"
+	standbyRestoreFailedEventReason = "StandbyRestoreFailed"
+	standbyPromotedEventReason      = "StandbyPromoted"
+
+	standbyContainerName = "restore"
+	// standbyPath is where the volume holding the archive and the slices of the oplog downloaded is
+	// mounted
+	standbyPath = "/standby"
+
+	defaultStandbyIntervalSeconds = 300
+	minStandbyIntervalSeconds     = 30
+)
+
+// validateStandby ensures spec.standby reads a valid s3 target, and not the backups of the resource
+// itself
+func validateStandby(mdb mdbv1.MongoDB) error {
+	standby := mdb.Spec.Standby
+	if standby == nil {
+		return nil
+	}
+	if err := validateS3BackupTarget(standby.Source); err != nil {
+		return fmt.Errorf("invalid source: %s", err)
+	}
+	if standby.IntervalSeconds != 0 && standby.IntervalSeconds < minStandbyIntervalSeconds {
+		return fmt.Errorf("the interval must be at least %d seconds", minStandbyIntervalSeconds)
+	}
+	if backup := mdb.Spec.Backup; backup != nil && backup.Target.S3 != nil && standby.SourceName == mdb.Name &&
+		backup.Target.S3.Bucket == standby.Source.Bucket && backup.Target.S3.Prefix == standby.Source.Prefix {
+		return fmt.Errorf("the source can't be the backups of the resource itself")
+	}
+	return nil
+}
+
+func standbyInterval(mdb mdbv1.MongoDB) time.Duration {
+	if mdb.Spec.Standby.IntervalSeconds != 0 {
+		return time.Duration(mdb.Spec.Standby.IntervalSeconds) * time.Second
+	}
+	return defaultStandbyIntervalSeconds * time.Second
+}
+
+func standbyJobNamespacedName(mdb mdbv1.MongoDB) types.NamespacedName {
+	return types.NamespacedName{Name: mdb.Name + "-standby", Namespace: mdb.Namespace}
+}
+
+// updateStandby keeps the replica set restored from the latest backup, and archived oplog, of the
+// source of spec.standby. Once the replica set is running, a Job restores what the source wrote to the
+// target since the last restore, every interval, and the outcome is recorded in status.standby. The
+// Job is deleted once it completes, so that the next one starts from the status. Once
+// spec.standby.promote is set, and the running restore is done, the restores stop for good. The
+// status is cleared when spec.standby is removed.
+func (r *ReplicaSetReconciler) updateStandby(mdb mdbv1.MongoDB) error {
+	if mdb.DeletionTimestamp != nil {
+		return nil
+	}
+	if mdb.Spec.Standby == nil {
+		return r.removeStandby(mdb)
+	}
+	status := mdbv1.StandbyStatus{}
+	if mdb.Status.Standby != nil {
+		status = *mdb.Status.Standby
+	}
+	if status.Phase == mdbv1.StandbyPromoted {
+		return nil
+	}
+
+	job := batchv1.Job{}
+	err := r.client.Get(context.TODO(), standbyJobNamespacedName(mdb), &job)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting the Job of the standby: %s", err)
+	}
+	if err == nil {
+		if _, failed := jobFailure(job); job.Status.Succeeded == 0 && !failed {
+			// a promotion waits for the running restore, rather than leaving it half done
+			status.Phase, status.Job = mdbv1.StandbyRestoring, job.Name
+			return r.setStandbyStatus(mdb, &status)
+		}
+		if status, err = r.completeStandbyJob(mdb, job, status); err != nil {
+			return err
+		}
+	}
+
+	if mdb.Spec.Standby.Promote {
+		now := metav1.NewTime(r.now())
+		status.Phase, status.PromotedAt = mdbv1.StandbyPromoted, &now
+		if err := r.setStandbyStatus(mdb, &status); err != nil {
+			return err
+		}
+		r.log.Infof("Promoted the standby of %s, restored to %s", mdb.Spec.Standby.SourceName, standbyRestoredTo(status))
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, standbyPromotedEventReason, "Promoted the standby of %s, restored to %s, the restores stopped", mdb.Spec.Standby.SourceName, standbyRestoredTo(status))
+		}
+		return nil
+	}
+
+	if mdb.Status.Phase != mdbv1.Running {
+		// the replica set is restored once it's running
+		return nil
+	}
+	if status.LastCheckTime != nil && r.now().Before(status.LastCheckTime.Add(standbyInterval(mdb))) {
+		return nil
+	}
+	job = buildStandbyJob(mdb, status)
+	if err := r.client.Create(context.TODO(), &job); err != nil {
+		return fmt.Errorf("error creating the Job of the standby: %s", err)
+	}
+	r.log.Debugf("Restoring the latest backup and oplog of %s with Job %s", mdb.Spec.Standby.SourceName, job.Name)
+	status.Phase, status.Job = mdbv1.StandbyRestoring, job.Name
+	return r.setStandbyStatus(mdb, &status)
+}
+
+// completeStandbyJob records the outcome of the completed or failed Job of the standby, deletes it, and
+// returns the updated status
+func (r *ReplicaSetReconciler) completeStandbyJob(mdb mdbv1.MongoDB, job batchv1.Job, status mdbv1.StandbyStatus) (mdbv1.StandbyStatus, error) {
+	message, failed := jobFailure(job)
+	previous := status
+	now := metav1.NewTime(r.now())
+	status.Job, status.LastCheckTime = "", &now
+	if failed {
+		if terminationMessage, err := jobTerminationMessage(r.client, job); err == nil && terminationMessage != "" {
+			message = terminationMessage
+		}
+		status.Phase, status.Message = mdbv1.StandbyFailed, message
+	} else {
+		terminationMessage, err := jobTerminationMessage(r.client, job)
+		if err != nil {
+			return status, err
+		}
+		archive, entry, ok := parseStandbyResult(terminationMessage)
+		if !ok {
+			return status, fmt.Errorf("the Job %s of the standby didn't report what it restored", job.Name)
+		}
+		status.Phase, status.Archive, status.OplogEntry, status.Message = mdbv1.StandbySynced, archive, entry, ""
+		if restoredTo, ok := standbyRestoredAt(archive, entry); ok {
+			status.RestoredTo = &metav1.Time{Time: restoredTo}
+		}
+	}
+	if err := r.deleteStandbyJob(mdb); err != nil {
+		return status, err
+	}
+	if err := r.setStandbyStatus(mdb, &status); err != nil {
+		return status, err
+	}
+
+	switch {
+	case failed && previous.Phase != mdbv1.StandbyFailed:
+		r.log.Warnf("Error restoring the standby of %s: %s", mdb.Spec.Standby.SourceName, message)
+		if r.recorder != nil {
+			r.recorder.Event(&mdb, corev1.EventTypeWarning, standbyRestoreFailedEventReason, status.Message)
+		}
+	case !failed && status.Archive != previous.Archive:
+		r.log.Infof("Restored the backup %s of %s", status.Archive, mdb.Spec.Standby.SourceName)
+		if r.recorder != nil {
+			r.recorder.Eventf(&mdb, corev1.EventTypeNormal, standbyRestoredEventReason, "Restored the backup %s of %s, restored to %s", status.Archive, mdb.Spec.Standby.SourceName, standbyRestoredTo(status))
+		}
+	}
+	return status, nil
+}
+
+// parseStandbyResult parses the termination message of the Job of the standby, "<archive> <entry>"
+// with the entry "-" when no entry of the oplog was replayed since the archive was restored
+func parseStandbyResult(message string) (string, string, bool) {
+	fields := strings.Fields(message)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	if fields[1] == "-" {
+		return fields[0], "", true
+	}
+	return fields[0], fields[1], true
+}
+
+// standbyRestoredAt returns the time of the last entry of the oplog replayed, or the time the
+// archive was taken at
+func standbyRestoredAt(archive, entry string) (time.Time, bool) {
+	if entry != "" {
+		seconds, err := strconv.ParseInt(strings.SplitN(entry, ".", 2)[0], 10, 64)
+		return time.Unix(seconds, 0).UTC(), err == nil
+	}
+	match := scheduledArchiveTimeRegexp.FindStringSubmatch(archive)
+	if match == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(scheduledBackupTimestampFmt, strings.ToUpper(match[1]))
+	return t, err == nil
+}
+
+func standbyRestoredTo(status mdbv1.StandbyStatus) string {
+	if status.RestoredTo == nil {
+		return "nothing"
+	}
+	return status.RestoredTo.UTC().Format(time.RFC3339)
+}
+
+func (r *ReplicaSetReconciler) deleteStandbyJob(mdb mdbv1.MongoDB) error {
+	job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: standbyJobNamespacedName(mdb).Name, Namespace: mdb.Namespace}}
+	if err := r.client.Delete(context.TODO(), &job, k8sClient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting the Job of the standby: %s", err)
+	}
+	return nil
+}
+
+// removeStandby deletes the Job of the standby, and clears its status
+func (r *ReplicaSetReconciler) removeStandby(mdb mdbv1.MongoDB) error {
+	if mdb.Status.Standby == nil {
+		return nil
+	}
+	if err := r.deleteStandbyJob(mdb); err != nil {
+		return err
+	}
+	return r.setStandbyStatus(mdb, nil)
+}
+
+// buildStandbyJob returns the Job restoring what the source of spec.standby wrote to the target since
+// the restore recorded in the status. The download init container downloads the latest scheduled
+// backup of the source when it isn't the one last restored, and with spec.standby.pointInTime the
+// slices of the archived oplog following the backup, or the last entry replayed. The restore
+// container restores the backup, dropping the collections of the standby but leaving its users, and
+// replays the slices, then reports "<archive> <entry>" as its termination message. A gap in the
+// archived oplog stops the replay until the next backup is restored.
+func buildStandbyJob(mdb mdbv1.MongoDB, status mdbv1.StandbyStatus) batchv1.Job {
+	standby := mdb.Spec.Standby
+	volume := statefulset.CreateVolumeFromEmptyDir("standby")
+	volumeMount := statefulset.CreateVolumeMount(volume.Name, standbyPath, statefulset.WithReadOnly(false))
+	endpoint, dir := s3EndpointOption(standby.Source), s3BackupObject(standby.Source, "")+"/"
+	archive, slices, result := standbyPath+"/archive.gz", standbyPath+"/slices", standbyPath+"/result"
+
+	download := []string{
+		fmt.Sprintf(`fail() { echo "$1"; echo "$1" > %s; exit 1; };`, corev1.TerminationMessagePathDefault),
+		fmt.Sprintf(`latest=$(aws%s s3 ls "%s" | awk '{print $4}' | grep -E '%s' | sort | tail -n 1);`, endpoint, dir, scheduledArchivePattern(standby.SourceName)),
+		fmt.Sprintf(`[ -n "$latest" ] || fail "There is no scheduled backup of %s in %s";`, standby.SourceName, dir),
+		`entry="$LAST_ENTRY";`,
+		fmt.Sprintf(`if [ "$latest" != "$LAST_ARCHIVE" ]; then aws%s s3 cp "%s$latest" %s > /dev/null || fail "Downloading $latest failed"; entry=""; fi;`, endpoint, dir, archive),
+		fmt.Sprintf(`touch %s;`, slices),
+	}
+	if standby.PointInTime {
+		// the first slice must follow the last entry replayed, or cover the time the backup was
+		// taken at, and each slice must follow the previous one
+		selectSlices := `$3 > t || ($3 == t && $4 > i) { if ((n == 0 && exact && $1 "." $2 != from) || (n == 0 && !exact && $1 > t) || (n > 0 && $1 "." $2 != last)) { gap = 1; exit } print; last = $3 "." $4; n++ } END { if (gap) exit 1 }`
+		oplogURL := oplogArchiveURL(standby.Source)
+		download = append(download,
+			`from="$entry"; exact=1;`,
+			`if [ -z "$from" ]; then exact=0; from="$(date -u -d "$(echo "$latest" | sed -E 's/^.*-([0-9]{4})([0-9]{2})([0-9]{2})T([0-9]{2})([0-9]{2})([0-9]{2})Z\.archive\.gz$/\1-\2-\3 \4:\5:\6/')" +%s).0"; fi;`,
+			fmt.Sprintf(`aws%s s3 ls "%s" | awk '{print $4}' | sort | awk -F'[-.]' -v t="${from%%.*}" -v i="${from#*.}" -v from="$from" -v exact=$exact '%s' > %s`, endpoint, oplogURL, selectSlices, slices),
+			fmt.Sprintf(`|| { echo "The archived oplog has a gap after $from, it is replayed again from the next backup"; : > %s; };`, slices),
+			fmt.Sprintf(`while read slice; do aws%s s3 cp "%s$slice" "%s/$slice" > /dev/null || fail "Downloading $slice failed"; entry=$(echo "$slice" | awk -F'[-.]' '{print $3 "." $4}'); done < %s;`, endpoint, oplogURL, standbyPath, slices),
+		)
+	}
+	download = append(download, fmt.Sprintf(`echo "$latest ${entry:--}" > %s`, result))
+
+	uri, connectionOptions, connection := mongoToolConnection(mdb, standbyContainerName)
+	// the users of the standby are its own, the admin database of the source isn't restored
+	excluded := ` --nsExclude "admin.*" --nsExclude "config.*"`
+	restore := strings.Join([]string{
+		fmt.Sprintf(`{ [ ! -f %[1]s ] || mongorestore --uri "%[2]s"%[3]s --archive=%[1]s --gzip --drop%[4]s; }`, archive, uri, connectionOptions, excluded),
+		fmt.Sprintf(`&& { [ ! -s %[1]s ] || { cat %[2]s/*.bson.gz | gunzip > %[2]s/oplog.bson && mkdir -p %[2]s/dump && mongorestore --uri "%[3]s"%[4]s --oplogReplay --oplogFile=%[2]s/oplog.bson%[5]s %[2]s/dump; }; }`,
+			slices, standbyPath, uri, connectionOptions, excluded),
+		fmt.Sprintf(`&& cp %s %s`, result, corev1.TerminationMessagePathDefault),
+	}, " ")
+
+	labels := map[string]string{"app": standbyJobNamespacedName(mdb).Name}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		podtemplatespec.WithVolume(volume),
+		podtemplatespec.WithInitContainer("download", container.Apply(
+			container.WithName("download"),
+			container.WithImage(awsCLIImage),
+			container.WithCommand([]string{"/bin/sh", "-c", strings.Join(download, " ")}),
+			container.WithEnvs(
+				corev1.EnvVar{Name: "LAST_ARCHIVE", Value: status.Archive},
+				corev1.EnvVar{Name: "LAST_ENTRY", Value: status.OplogEntry},
+			),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+			s3Credentials(standby.Source),
+		)),
+		podtemplatespec.WithContainer(standbyContainerName, container.Apply(
+			container.WithName(standbyContainerName),
+			container.WithImage(fmt.Sprintf("mongo:%s", mdb.Spec.Version)),
+			container.WithCommand([]string{"/bin/sh", "-c", restore}),
+			container.WithVolumeMounts([]corev1.VolumeMount{volumeMount}),
+		)),
+		connection,
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	// a failed restore is retried after the interval rather than by the Job, from the status
+	backoffLimit := int32(0)
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            standbyJobNamespacedName(mdb).Name,
+			Namespace:       mdb.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}
+}
+
+func (r *ReplicaSetReconciler) setStandbyStatus(mdb mdbv1.MongoDB, status *mdbv1.StandbyStatus) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if reflect.DeepEqual(newMdb.Status.Standby, status) {
+		return nil
+	}
+	newMdb.Status.Standby = status
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
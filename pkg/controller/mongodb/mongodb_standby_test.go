@@ -0,0 +1,144 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func newStandbyReplicaSet() mdbv1.MongoDB {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Standby = &mdbv1.Standby{
+		Source:      mdbv1.BackupS3Target{Bucket: "backups", Prefix: "prod"},
+		SourceName:  "prod-rs",
+		PointInTime: true,
+	}
+	mdb.Status.Phase = mdbv1.Running
+	return mdb
+}
+
+func TestValidateStandby(t *testing.T) {
+	mdb := newStandbyReplicaSet()
+	assert.NoError(t, validateStandby(mdb))
+
+	mdb.Spec.Standby.IntervalSeconds = 10
+	assert.EqualError(t, validateStandby(mdb), "the interval must be at least 30 seconds")
+
+	mdb.Spec.Standby.IntervalSeconds = 0
+	mdb.Spec.Standby.SourceName = mdb.Name
+	mdb.Spec.Backup = &mdbv1.Backup{Target: mdbv1.BackupTarget{S3: &mdbv1.BackupS3Target{Bucket: "backups", Prefix: "prod"}}}
+	assert.EqualError(t, validateStandby(mdb), "the source can't be the backups of the resource itself")
+
+	mdb.Spec.Standby.Source.Bucket = ""
+	assert.EqualError(t, validateStandby(mdb), "invalid source: the bucket of the target must be set")
+}
+
+func TestBuildStandbyJob(t *testing.T) {
+	mdb := newStandbyReplicaSet()
+	job := buildStandbyJob(mdb, mdbv1.StandbyStatus{Archive: "prod-rs-20260304T100000Z.archive.gz", OplogEntry: "1772619000.3"})
+	assert.Equal(t, "my-rs-standby", job.Name)
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+
+	download := job.Spec.Template.Spec.InitContainers[0]
+	assert.Equal(t, awsCLIImage, download.Image)
+	assert.Contains(t, download.Env, corev1.EnvVar{Name: "LAST_ARCHIVE", Value: "prod-rs-20260304T100000Z.archive.gz"})
+	assert.Contains(t, download.Env, corev1.EnvVar{Name: "LAST_ENTRY", Value: "1772619000.3"})
+	assert.Contains(t, download.Command[2], `grep -E '^prod-rs-[0-9]{8}T[0-9]{6}Z\.archive\.gz$'`)
+	assert.Contains(t, download.Command[2], `s3 ls "s3://backups/prod/oplog/"`)
+
+	restore := job.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "mongo:"+mdb.Spec.Version, restore.Image)
+	assert.Contains(t, restore.Command[2], `--archive=/standby/archive.gz --gzip --drop --nsExclude "admin.*" --nsExclude "config.*"`)
+	assert.Contains(t, restore.Command[2], "--oplogReplay --oplogFile=/standby/oplog.bson")
+
+	t.Run("The oplog is only downloaded with pointInTime", func(t *testing.T) {
+		mdb.Spec.Standby.PointInTime = false
+		job := buildStandbyJob(mdb, mdbv1.StandbyStatus{})
+		assert.NotContains(t, job.Spec.Template.Spec.InitContainers[0].Command[2], "/oplog/")
+	})
+}
+
+func TestStandbyRestoredAt(t *testing.T) {
+	restoredAt, ok := standbyRestoredAt("prod-rs-20260304T100000Z.archive.gz", "")
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC), restoredAt)
+
+	restoredAt, ok = standbyRestoredAt("prod-rs-20260304T100000Z.archive.gz", "1772619000.3")
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, 3, 4, 10, 10, 0, 0, time.UTC), restoredAt)
+
+	archive, entry, ok := parseStandbyResult("prod-rs-20260304T100000Z.archive.gz -\n")
+	assert.True(t, ok)
+	assert.Equal(t, "prod-rs-20260304T100000Z.archive.gz", archive)
+	assert.Equal(t, "", entry)
+	_, _, ok = parseStandbyResult("")
+	assert.False(t, ok)
+}
+
+func TestUpdateStandby(t *testing.T) {
+	mdb := newStandbyReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	assert.NoError(t, r.updateStandby(mdb))
+	job := batchv1.Job{}
+	assert.NoError(t, c.Get(context.TODO(), standbyJobNamespacedName(mdb), &job))
+	newMdb, _ := r.getResource(mdb.NamespacedName())
+	assert.Equal(t, &mdbv1.StandbyStatus{Phase: mdbv1.StandbyRestoring, Job: job.Name}, newMdb.Status.Standby)
+
+	t.Run("A failed restore is retried after the interval", func(t *testing.T) {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+		assert.NoError(t, c.Update(context.TODO(), &job))
+		assert.NoError(t, r.updateStandby(*newMdb))
+		assert.Error(t, c.Get(context.TODO(), standbyJobNamespacedName(mdb), &batchv1.Job{}), "the Job is deleted")
+		newMdb, _ = r.getResource(mdb.NamespacedName())
+		assert.Equal(t, mdbv1.StandbyFailed, newMdb.Status.Standby.Phase)
+		assert.Equal(t, "Job my-rs-standby failed: BackoffLimitExceeded", newMdb.Status.Standby.Message)
+
+		now = now.Add(time.Minute)
+		assert.NoError(t, r.updateStandby(*newMdb))
+		assert.Error(t, c.Get(context.TODO(), standbyJobNamespacedName(mdb), &batchv1.Job{}))
+
+		now = now.Add(5 * time.Minute)
+		assert.NoError(t, r.updateStandby(*newMdb))
+		assert.NoError(t, c.Get(context.TODO(), standbyJobNamespacedName(mdb), &job))
+	})
+
+	t.Run("The promotion waits for the running restore", func(t *testing.T) {
+		newMdb, _ = r.getResource(mdb.NamespacedName())
+		newMdb.Spec.Standby.Promote = true
+		assert.NoError(t, r.updateStandby(*newMdb))
+		newMdb, _ = r.getResource(mdb.NamespacedName())
+		assert.Equal(t, mdbv1.StandbyRestoring, newMdb.Status.Standby.Phase)
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+		assert.NoError(t, c.Update(context.TODO(), &job))
+		newMdb.Spec.Standby.Promote = true
+		assert.NoError(t, r.updateStandby(*newMdb))
+		newMdb, _ = r.getResource(mdb.NamespacedName())
+		assert.Equal(t, mdbv1.StandbyPromoted, newMdb.Status.Standby.Phase)
+		assert.Equal(t, now, newMdb.Status.Standby.PromotedAt.Time)
+
+		now = now.Add(time.Hour)
+		newMdb.Spec.Standby.Promote = true
+		assert.NoError(t, r.updateStandby(*newMdb))
+		assert.Error(t, c.Get(context.TODO(), standbyJobNamespacedName(mdb), &batchv1.Job{}), "a promoted standby isn't restored")
+	})
+
+	t.Run("The status is cleared with spec.standby", func(t *testing.T) {
+		newMdb.Spec.Standby = nil
+		assert.NoError(t, r.updateStandby(*newMdb))
+		newMdb, _ = r.getResource(mdb.NamespacedName())
+		assert.Nil(t, newMdb.Status.Standby)
+	})
+}
@@ -0,0 +1,52 @@
+package mongodb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// operatorManagedStatefulSetFields are the fields of the spec of the StatefulSet which can't be
+// overridden: the operator scales the members and rolls them out itself, and the selector and the
+// service name can't be changed once the StatefulSet is created
+var operatorManagedStatefulSetFields = []string{"replicas", "selector", "serviceName", "updateStrategy"}
+
+// statefulSetSpecOverride returns the JSON of the override of the spec of the StatefulSet, or nil if
+// the resource doesn't override it
+func statefulSetSpecOverride(mdb mdbv1.MongoDB) []byte {
+	if mdb.Spec.StatefulSetConfiguration == nil {
+		return nil
+	}
+	return mdb.Spec.StatefulSetConfiguration.Spec.Raw
+}
+
+// buildStatefulSetOverrideModification merges spec.statefulSet.spec into the StatefulSet, it must be
+// applied after all the other modifications
+func buildStatefulSetOverrideModification(mdb mdbv1.MongoDB) statefulset.Modification {
+	override := statefulSetSpecOverride(mdb)
+	if override == nil {
+		return statefulset.NOOP()
+	}
+	return statefulset.WithSpecOverride(override)
+}
+
+func validateStatefulSetConfiguration(mdb mdbv1.MongoDB) error {
+	override := statefulSetSpecOverride(mdb)
+	if override == nil {
+		return nil
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(override, &fields); err != nil {
+		return fmt.Errorf("spec must be an object: %s", err)
+	}
+	for _, field := range operatorManagedStatefulSetFields {
+		if _, ok := fields[field]; ok {
+			return fmt.Errorf("spec.%s is managed by the operator and can't be overridden", field)
+		}
+	}
+	_, err := statefulset.MergeSpec(appsv1.StatefulSet{}, override)
+	return err
+}
@@ -0,0 +1,76 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func withStatefulSetOverride(mdb mdbv1.MongoDB, spec string) mdbv1.MongoDB {
+	mdb.Spec.StatefulSetConfiguration = &mdbv1.StatefulSetConfiguration{Spec: runtime.RawExtension{Raw: []byte(spec)}}
+	return mdb
+}
+
+func TestBuildStatefulSet_Override(t *testing.T) {
+	mdb := withStatefulSetOverride(testutils.NewTestReplicaSet(), `{
+		"template": {
+			"spec": {
+				"priorityClassName": "mongodb",
+				"containers": [{"name": "mongod", "terminationMessagePath": "/dev/mongod-log"}, {"name": "sidecar", "image": "sidecar:1"}]
+			}
+		}
+	}`)
+	sts, err := buildStatefulSet(mdb)
+	assert.NoError(t, err)
+
+	podSpec := sts.Spec.Template.Spec
+	assert.Equal(t, "mongodb", podSpec.PriorityClassName)
+	assert.Len(t, podSpec.Containers, 3)
+	for _, c := range podSpec.Containers {
+		switch c.Name {
+		case mongodbName:
+			assert.Equal(t, "/dev/mongod-log", c.TerminationMessagePath)
+			assert.NotEmpty(t, c.Image, "the containers built by the operator are merged with the override")
+		case "sidecar":
+			assert.Equal(t, "sidecar:1", c.Image)
+		default:
+			assert.Equal(t, agentName, c.Name)
+		}
+	}
+	assert.Equal(t, int32(mdb.Spec.Members), *sts.Spec.Replicas)
+}
+
+func TestValidateStatefulSetConfiguration(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	assert.NoError(t, validateStatefulSetConfiguration(mdb))
+	assert.NoError(t, validateStatefulSetConfiguration(withStatefulSetOverride(mdb, `{"template": {"spec": {"priorityClassName": "mongodb"}}}`)))
+
+	err := validateStatefulSetConfiguration(withStatefulSetOverride(mdb, `{"replicas": 5}`))
+	assert.EqualError(t, err, "spec.replicas is managed by the operator and can't be overridden")
+	assert.Error(t, validateStatefulSetConfiguration(withStatefulSetOverride(mdb, `{"updateStrategy": {"type": "OnDelete"}}`)))
+	assert.Error(t, validateStatefulSetConfiguration(withStatefulSetOverride(mdb, `["template"]`)))
+	assert.Error(t, validateStatefulSetConfiguration(withStatefulSetOverride(mdb, `{"template": {"spec": {"priorityClass": "mongodb"}}}`)))
+}
+
+func TestReconcile_InvalidStatefulSetOverride(t *testing.T) {
+	mdb := withStatefulSetOverride(testutils.NewTestReplicaSet(), `{"serviceName": "other"}`)
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, res)
+
+	_ = mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Failed, mdb.Status.Phase)
+	assert.Contains(t, mdb.Status.Message, "invalid spec.statefulSet")
+	sts := appsv1.StatefulSet{}
+	assert.Error(t, mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &sts), "the StatefulSet isn't created")
+}
@@ -0,0 +1,106 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// updateReconcileStatus updates the status of the resource with the outcome of the reconciliation,
+// so that the common operational questions are answered by the resource itself.
+func (r *ReplicaSetReconciler) updateReconcileStatus(nsName types.NamespacedName, reconcileErr error) error {
+	mdb, err := r.getResource(nsName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			deleteResourceMetrics(nsName)
+			return nil
+		}
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	if mdb.DeletionTimestamp != nil {
+		deleteResourceMetrics(nsName)
+		return nil
+	}
+
+	previous := mdb.DeepCopy()
+	if err := r.setStandardConditions(mdb, reconcileErr); err != nil {
+		return err
+	}
+	if err := r.setStatusSummary(mdb, reconcileErr); err != nil {
+		return err
+	}
+	if err := r.recordReconcileMetrics(*mdb, reconcileErr); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(previous.Status, mdb.Status) {
+		return nil
+	}
+	if err := r.writeStatus(mdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	r.recordMilestoneEvents(*previous, *mdb)
+	return nil
+}
+
+// setStatusSummary sets the message, the number of ready and desired members, the MongoDB version
+// run by all the members, the connection string and the generation reconciled in the status of the
+// resource.
+func (r *ReplicaSetReconciler) setStatusSummary(mdb *mdbv1.MongoDB, reconcileErr error) error {
+	mdb.Status.Message = r.statusMessage(*mdb, reconcileErr)
+	if reconcileErr != nil && !isTransient(reconcileErr) && !mdb.Spec.Paused {
+		// the deployment may not match the resource until the reconciliation succeeds
+		mdb.Status.Phase = mdbv1.Pending
+	}
+	mdb.Status.DesiredMembers = mdb.Spec.Members
+	mdb.Status.MongoURI = mdb.MongoURI()
+	if r.observedGeneration != 0 {
+		mdb.Status.ObservedGeneration = r.observedGeneration
+	}
+
+	sts := appsv1.StatefulSet{}
+	if err := r.client.Get(context.TODO(), mdb.NamespacedName(), &sts); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("error getting StatefulSet: %s", err)
+		}
+	}
+	mdb.Status.ReadyMembers = int(sts.Status.ReadyReplicas)
+	mdb.Status.MembersReady = fmt.Sprintf("%d/%d", mdb.Status.ReadyMembers, mdb.Status.DesiredMembers)
+
+	ac, err := getCurrentAutomationConfig(r.client, *mdb)
+	if err != nil {
+		return fmt.Errorf("error reading automation config: %s", err)
+	}
+	// the version is only updated once all the members run the same one
+	version := ""
+	for i, p := range ac.Processes {
+		if i > 0 && p.Version != version {
+			return nil
+		}
+		version = p.Version
+	}
+	mdb.Status.Version = version
+	return nil
+}
+
+// statusMessage returns the message of the status, which describes the change in progress, or why
+// the resource can't be reconciled
+func (r *ReplicaSetReconciler) statusMessage(mdb mdbv1.MongoDB, reconcileErr error) string {
+	switch failure := failureCondition(mdb); {
+	case mdb.Spec.Paused:
+		return "Reconciliation is paused"
+	case reconcileErr != nil && isBackedOff(r.consecutiveFailures):
+		return "Error reconciling the resource, " + r.backedOffMessage(reconcileErr)
+	case reconcileErr != nil:
+		return fmt.Sprintf("Error reconciling the resource: %s", reconcileErr)
+	case failure != nil:
+		return failure.Message
+	case r.progress != nil:
+		return r.progress.message
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestStatusSummary_FollowsTheReconciliation(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Generation = 2
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, "", mdb.Status.Message)
+	assert.Equal(t, "4.2.2", mdb.Status.Version)
+	assert.Equal(t, 3, mdb.Status.ReadyMembers)
+	assert.Equal(t, 3, mdb.Status.DesiredMembers)
+	assert.Equal(t, "3/3", mdb.Status.MembersReady)
+	assert.Equal(t, mdb.MongoURI(), mdb.Status.MongoURI)
+	assert.Equal(t, int64(2), mdb.Status.ObservedGeneration)
+
+	sts, _ := c.GetStatefulSet(mdb.NamespacedName())
+	sts.Status.ReadyReplicas = 2
+	_ = c.Update(context.TODO(), &sts)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, r.progress.message, mdb.Status.Message)
+	assert.Equal(t, 2, mdb.Status.ReadyMembers)
+	assert.Equal(t, "2/3", mdb.Status.MembersReady)
+
+	mdb.Spec.MaintenanceWindow = &mdbv1.MaintenanceWindow{Schedule: "0 2 * * 6", Duration: metav1.Duration{}}
+	_ = c.Update(context.TODO(), &mdb)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Contains(t, mdb.Status.Message, "invalid maintenance window")
+}
+
+func TestStatusSummary_KeepsTheVersionDuringVersionChange(t *testing.T) {
+	r, c, mdb := versionChangeRequestedReplicaSet(t, "4.2.7")
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, "4.0.6", mdb.Status.Version, "the last version run by all the members is kept")
+}
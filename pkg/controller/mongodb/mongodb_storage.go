@@ -0,0 +1,200 @@
+package mongodb
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/persistentvolumeclaim"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/resourcerequirements"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	journalVolumeName = "journal-volume"
+	logsVolumeName    = "logs-volume"
+	defaultLogsPath   = "/var/log/mongodb"
+	mongodLogFileName = "mongodb.log"
+	agentLogFileName  = "automation-agent.log"
+)
+
+// reservedPaths are the mount points used by the operator, which can't be used as the data or logs directory
+var reservedPaths = []string{"/healthstatus", "/hooks", automationConfigMountPath, automationconfig.DefaultAgentLogPath}
+
+// validateStorage ensures the storage configuration can be used to build the StatefulSet
+func validateStorage(mdb mdbv1.MongoDB) error {
+	if _, err := storageRequests(mdb.Spec.Storage.Data); err != nil {
+		return fmt.Errorf("invalid size of the data volume: %s", err)
+	}
+	if mdb.Spec.Storage.Journal != nil {
+		if _, err := storageRequests(*mdb.Spec.Storage.Journal); err != nil {
+			return fmt.Errorf("invalid size of the journal volume: %s", err)
+		}
+	}
+	if mdb.Spec.Storage.Logs != nil {
+		if _, err := storageRequests(*mdb.Spec.Storage.Logs); err != nil {
+			return fmt.Errorf("invalid size of the logs volume: %s", err)
+		}
+	}
+	if err := validatePath(mdb.Spec.Storage.DataPath); err != nil {
+		return fmt.Errorf("invalid data path: %s", err)
+	}
+	if err := validatePath(mdb.Spec.Storage.LogsPath); err != nil {
+		return fmt.Errorf("invalid logs path: %s", err)
+	}
+	if dataPath(mdb) == logsPath(mdb) {
+		return fmt.Errorf("the data and logs paths must be different")
+	}
+	return nil
+}
+
+func validatePath(p string) error {
+	if p == "" {
+		return nil
+	}
+	if !path.IsAbs(p) || path.Clean(p) != p || p == "/" {
+		return fmt.Errorf("%s must be a clean absolute path", p)
+	}
+	for _, reserved := range reservedPaths {
+		if p == reserved || strings.HasPrefix(p, reserved+"/") || strings.HasPrefix(reserved, p+"/") {
+			return fmt.Errorf("%s conflicts with %s, which is used by the operator", p, reserved)
+		}
+	}
+	return nil
+}
+
+// dataPath returns the directory storing the data files of mongod, where the data volume is mounted
+func dataPath(mdb mdbv1.MongoDB) string {
+	if mdb.Spec.Storage.DataPath != "" {
+		return mdb.Spec.Storage.DataPath
+	}
+	return automationconfig.DefaultMongoDBDataDir
+}
+
+// logsPath returns the directory mongod and the agent write their logs to when a
+// logs volume or a logs path is configured.
+func logsPath(mdb mdbv1.MongoDB) string {
+	if mdb.Spec.Storage.LogsPath != "" {
+		return mdb.Spec.Storage.LogsPath
+	}
+	return defaultLogsPath
+}
+
+func hasCustomLogsPath(mdb mdbv1.MongoDB) bool {
+	return mdb.Spec.Storage.Logs != nil || mdb.Spec.Storage.LogsPath != ""
+}
+
+// buildJournalStatefulSetModification adds the journal volume to the StatefulSet if it is configured.
+// The volume is mounted at the journal directory inside the dbPath, which is where mongod
+// writes its journal, so no change to the mongod storage configuration is required.
+func buildJournalStatefulSetModification(mdb mdbv1.MongoDB) statefulset.Modification {
+	if mdb.Spec.Storage.Journal == nil {
+		return statefulset.NOOP()
+	}
+	journalVolumeMount := statefulset.CreateVolumeMount(journalVolumeName, path.Join(dataPath(mdb), "journal"))
+	return statefulset.Apply(
+		storageVolume(mdb, journalVolumeName, *mdb.Spec.Storage.Journal),
+		statefulset.WithPodSpecTemplate(
+			podtemplatespec.Apply(
+				podtemplatespec.WithVolumeMounts(agentName, journalVolumeMount),
+				podtemplatespec.WithVolumeMounts(mongodbName, journalVolumeMount),
+			),
+		),
+	)
+}
+
+// buildLogsStatefulSetModification adds the logs volume to the StatefulSet if it is configured,
+// and makes the agent write its logs to the logs path.
+func buildLogsStatefulSetModification(mdb mdbv1.MongoDB) statefulset.Modification {
+	if !hasCustomLogsPath(mdb) {
+		return statefulset.NOOP()
+	}
+	agentLogFile := statefulset.WithPodSpecTemplate(
+		podtemplatespec.WithContainer(agentName, container.WithCommand([]string{"/bin/sh", "-c", agentCommand(mdb, path.Join(logsPath(mdb), agentLogFileName))})),
+	)
+	if mdb.Spec.Storage.Logs == nil {
+		return agentLogFile
+	}
+	logsVolumeMount := statefulset.CreateVolumeMount(logsVolumeName, logsPath(mdb))
+	return statefulset.Apply(
+		storageVolume(mdb, logsVolumeName, *mdb.Spec.Storage.Logs),
+		statefulset.WithPodSpecTemplate(
+			podtemplatespec.Apply(
+				podtemplatespec.WithVolumeMounts(agentName, logsVolumeMount),
+				podtemplatespec.WithVolumeMounts(mongodbName, logsVolumeMount),
+			),
+		),
+		agentLogFile,
+	)
+}
+
+// buildStorageAutomationConfigModification configures the data directory of the mongod processes,
+// and makes them write their logs to the logs path if it is configured.
+func buildStorageAutomationConfigModification(mdb mdbv1.MongoDB) automationconfig.Modification {
+	return automationconfig.ForEachProcess(func(process *automationconfig.Process) {
+		process.Args26.Storage.DBPath = dataPath(mdb)
+		if hasCustomLogsPath(mdb) {
+			process.SystemLog.Path = path.Join(logsPath(mdb), mongodLogFileName)
+		}
+	})
+}
+
+// storageVolume adds the volume with the given name to the StatefulSet. A PersistentVolumeClaim
+// template is used, unless ephemeral storage is configured, in which case an emptyDir volume
+// limited to the size of the claim is used.
+func storageVolume(mdb mdbv1.MongoDB, name string, claim mdbv1.VolumeClaim) statefulset.Modification {
+	if !mdb.Spec.Storage.Ephemeral {
+		return statefulset.WithVolumeClaim(name, volumeClaim(name, claim))
+	}
+	emptyDir := &corev1.EmptyDirVolumeSource{}
+	if claim.Size != "" {
+		// the size has been validated before building the StatefulSet
+		size := resource.MustParse(claim.Size)
+		emptyDir.SizeLimit = &size
+	}
+	return statefulset.WithPodSpecTemplate(
+		podtemplatespec.WithVolume(corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{EmptyDir: emptyDir},
+		}),
+	)
+}
+
+// volumeClaim returns the modification configuring the PersistentVolumeClaim template
+// with the given name, the defaults are used for the settings which are not specified.
+func volumeClaim(name string, claim mdbv1.VolumeClaim) persistentvolumeclaim.Modification {
+	// the size has been validated before building the StatefulSet
+	requests, _ := storageRequests(claim)
+
+	storageClassName := persistentvolumeclaim.NOOP()
+	if claim.StorageClassName != nil {
+		storageClassName = persistentvolumeclaim.WithStorageClassName(*claim.StorageClassName)
+	}
+
+	return persistentvolumeclaim.Apply(
+		persistentvolumeclaim.WithName(name),
+		persistentvolumeclaim.WithAccessModes(accessModes(claim)...),
+		persistentvolumeclaim.WithResourceRequests(requests),
+		persistentvolumeclaim.WithLabelSelector(claim.Selector),
+		persistentvolumeclaim.WithLabels(claim.Labels),
+		persistentvolumeclaim.WithAnnotations(claim.Annotations),
+		storageClassName,
+	)
+}
+
+func storageRequests(claim mdbv1.VolumeClaim) (corev1.ResourceList, error) {
+	if claim.Size == "" {
+		return resourcerequirements.BuildDefaultStorageRequirements(), nil
+	}
+	size, err := resource.ParseQuantity(claim.Size)
+	if err != nil {
+		return nil, err
+	}
+	return corev1.ResourceList{corev1.ResourceStorage: size}, nil
+}
@@ -0,0 +1,161 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	stuckPlanEventReason = "AgentPlanStuck"
+
+	defaultStuckPlanTimeout = 15 * time.Minute
+
+	// automationConfigRepushedAnnotationKey is set on the Pod of a member whose plan is stuck once
+	// the automation config has been published again, and removed once the member is in goal state
+	automationConfigRepushedAnnotationKey = "mongodb.com/v1.automationConfigRepushedAt"
+	// agentRestartRequestedAnnotationKey is set on the Pod of a member to request its agent to be
+	// restarted, which the agent container does whenever the value changes
+	agentRestartRequestedAnnotationKey = "mongodb.com/v1.agentRestartRequestedAt"
+
+	// podInfoMountPath is where the annotations of the Pod are mounted in the agent container
+	podInfoMountPath       = "/var/run/pod-info"
+	podAnnotationsFileName = "annotations"
+)
+
+// stuckPlanTimeout returns how long the plan of an agent can make no progress before it is
+// considered stuck, 0 if stuck plans must not be recovered.
+func stuckPlanTimeout(mdb mdbv1.MongoDB) time.Duration {
+	if mdb.Spec.StuckPlanTimeout == nil {
+		return defaultStuckPlanTimeout
+	}
+	return mdb.Spec.StuckPlanTimeout.Duration
+}
+
+// recoverStuckPlans detects the members whose agent plan hasn't made progress for longer than
+// spec.stuckPlanTimeout and tries to recover them, reporting every action with a Warning event.
+// The automation config is published again first, so that the agent computes a new plan. If the
+// plan is still stuck after another timeout, the agent is restarted. The members which still
+// don't make progress are left for manual intervention. Nothing is done while automation is frozen.
+func (r *ReplicaSetReconciler) recoverStuckPlans(mdb mdbv1.MongoDB) error {
+	timeout := stuckPlanTimeout(mdb)
+	if timeout <= 0 || mdb.Spec.AutomationFreeze {
+		return nil
+	}
+
+	now := r.now()
+	isRepushed := false
+	for i := 0; i < mdb.Spec.Members; i++ {
+		nsName := types.NamespacedName{Name: fmt.Sprintf("%s-%d", mdb.Name, i), Namespace: mdb.Namespace}
+		pod := corev1.Pod{}
+		if err := r.client.Get(context.TODO(), nsName, &pod); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("error getting pod %s: %s", nsName.Name, err)
+		}
+		status, err := r.getAgentStatus(nsName)
+		if err != nil {
+			return err
+		}
+
+		repushedAt := annotationTime(pod, automationConfigRepushedAnnotationKey)
+		if status.IsInGoalState || status.CurrentStep == "" {
+			if !repushedAt.IsZero() {
+				if err := r.setPodAnnotation(nsName, automationConfigRepushedAnnotationKey, ""); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if status.CurrentStepSince == nil || now.Sub(*status.CurrentStepSince) < timeout {
+			continue
+		}
+
+		stuckFor := now.Sub(*status.CurrentStepSince).Round(time.Minute)
+		restartRequestedAt := annotationTime(pod, agentRestartRequestedAnnotationKey)
+		switch {
+		case repushedAt.IsZero():
+			if !isRepushed {
+				if err := r.repushAutomationConfig(mdb); err != nil {
+					return err
+				}
+				isRepushed = true
+			}
+			if err := r.setPodAnnotation(nsName, automationConfigRepushedAnnotationKey, now.UTC().Format(time.RFC3339)); err != nil {
+				return err
+			}
+			r.recordStuckPlanEvent(mdb, "The plan of member %s has been stuck at step %s for %s, publishing the automation config again", nsName.Name, status.CurrentStep, stuckFor)
+		case restartRequestedAt.Before(repushedAt) && now.Sub(repushedAt) >= timeout:
+			if err := r.setPodAnnotation(nsName, agentRestartRequestedAnnotationKey, now.UTC().Format(time.RFC3339)); err != nil {
+				return err
+			}
+			r.recordStuckPlanEvent(mdb, "The plan of member %s has been stuck at step %s for %s, restarting its agent", nsName.Name, status.CurrentStep, stuckFor)
+		case !restartRequestedAt.Before(repushedAt) && now.Sub(restartRequestedAt) >= timeout:
+			r.log.Warnf("The plan of member %s has been stuck at step %s for %s even after restarting its agent, manual intervention is required", nsName.Name, status.CurrentStep, stuckFor)
+		}
+	}
+	return nil
+}
+
+// repushAutomationConfig publishes the current automation config again with a new version, so that
+// the agents compute a new plan
+func (r *ReplicaSetReconciler) repushAutomationConfig(mdb mdbv1.MongoDB) error {
+	ac, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return fmt.Errorf("error reading automation config: %s", err)
+	}
+	ac.Version++
+	cm, err := automationConfigConfigMap(mdb, ac)
+	if err != nil {
+		return err
+	}
+	if err := configmap.CreateOrUpdate(r.client, cm); err != nil {
+		return fmt.Errorf("error writing automation config: %s", err)
+	}
+	r.log.Infof("Published the automation config again with version %d", ac.Version)
+	return nil
+}
+
+// setPodAnnotation sets the annotation of the Pod, or removes it if the value is empty
+func (r *ReplicaSetReconciler) setPodAnnotation(nsName types.NamespacedName, key, value string) error {
+	pod := corev1.Pod{}
+	if err := r.client.Get(context.TODO(), nsName, &pod); err != nil {
+		return fmt.Errorf("error getting pod %s: %s", nsName.Name, err)
+	}
+	original := pod.DeepCopy()
+	if value == "" {
+		delete(pod.Annotations, key)
+	} else {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[key] = value
+	}
+	if err := r.client.MergePatch(original, &pod); err != nil {
+		return fmt.Errorf("error updating pod %s: %s", nsName.Name, err)
+	}
+	return nil
+}
+
+// annotationTime returns the time of the annotation of the Pod, or the zero time if it isn't set
+func annotationTime(pod corev1.Pod, key string) time.Time {
+	t, err := time.Parse(time.RFC3339, pod.Annotations[key])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func (r *ReplicaSetReconciler) recordStuckPlanEvent(mdb mdbv1.MongoDB, messageFmt string, args ...interface{}) {
+	r.log.Warnf(messageFmt, args...)
+	if r.recorder != nil {
+		r.recorder.Eventf(&mdb, corev1.EventTypeWarning, stuckPlanEventReason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,127 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var stuckSince = time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC)
+
+// newStuckPlanTest reconciles a replica set whose member my-rs-1 is stuck at a step since stuckSince,
+// and my-rs-2 since 14 minutes later
+func newStuckPlanTest(t *testing.T, mdb mdbv1.MongoDB) (*ReplicaSetReconciler, client.Client) {
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	statuses := []string{
+		`{"lastGoalVersionAchieved":1,"isInGoalState":true}`,
+		`{"lastGoalVersionAchieved":1,"isInGoalState":false,"currentStep":"Start/StartFresh","currentStepSince":"2020-06-05T12:00:00Z"}`,
+		`{"lastGoalVersionAchieved":1,"isInGoalState":false,"currentStep":"Start/StartFresh","currentStepSince":"2020-06-05T12:14:00Z"}`,
+	}
+	for i, status := range statuses {
+		pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%d", mdb.Name, i),
+			Namespace:   mdb.Namespace,
+			Annotations: map[string]string{agenthealth.MemberStatusAnnotationKey: status},
+		}}
+		assert.NoError(t, c.Create(context.TODO(), &pod))
+	}
+	return r, c
+}
+
+func getPodAnnotations(t *testing.T, c client.Client, name string) map[string]string {
+	pod := corev1.Pod{}
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: "my-ns"}, &pod))
+	return pod.Annotations
+}
+
+func TestRecoverStuckPlans_RepublishesAutomationConfigThenRestartsAgent(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	r, c := newStuckPlanTest(t, mdb)
+	ac, _ := getCurrentAutomationConfig(c, mdb)
+	version := ac.Version
+
+	at := func(d time.Duration) {
+		r.now = func() time.Time { return stuckSince.Add(d) }
+		assert.NoError(t, r.recoverStuckPlans(mdb))
+	}
+
+	at(10 * time.Minute)
+	ac, _ = getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, version, ac.Version)
+	assert.NotContains(t, getPodAnnotations(t, c, "my-rs-1"), automationConfigRepushedAnnotationKey)
+
+	at(16 * time.Minute)
+	ac, _ = getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, version+1, ac.Version, "the automation config is published again")
+	assert.Equal(t, "2020-06-05T12:16:00Z", getPodAnnotations(t, c, "my-rs-1")[automationConfigRepushedAnnotationKey])
+	assert.NotContains(t, getPodAnnotations(t, c, "my-rs-2"), automationConfigRepushedAnnotationKey, "my-rs-2 made progress recently")
+
+	at(20 * time.Minute)
+	ac, _ = getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, version+1, ac.Version)
+	assert.NotContains(t, getPodAnnotations(t, c, "my-rs-1"), agentRestartRequestedAnnotationKey)
+
+	at(32 * time.Minute)
+	assert.Equal(t, "2020-06-05T12:32:00Z", getPodAnnotations(t, c, "my-rs-1")[agentRestartRequestedAnnotationKey], "the agent is restarted")
+	assert.Equal(t, "2020-06-05T12:32:00Z", getPodAnnotations(t, c, "my-rs-2")[automationConfigRepushedAnnotationKey])
+	ac, _ = getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, version+2, ac.Version, "the automation config is published again for my-rs-2")
+
+	at(50 * time.Minute)
+	assert.Equal(t, "2020-06-05T12:32:00Z", getPodAnnotations(t, c, "my-rs-1")[agentRestartRequestedAnnotationKey], "the agent is restarted once")
+
+	pod := corev1.Pod{}
+	_ = c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-1", Namespace: mdb.Namespace}, &pod)
+	pod.Annotations[agenthealth.MemberStatusAnnotationKey] = `{"lastGoalVersionAchieved":3,"isInGoalState":true}`
+	_ = c.Update(context.TODO(), &pod)
+	at(51 * time.Minute)
+	annotations := getPodAnnotations(t, c, "my-rs-1")
+	assert.NotContains(t, annotations, automationConfigRepushedAnnotationKey, "the recovery is reset once in goal state")
+	assert.Contains(t, annotations, agentRestartRequestedAnnotationKey, "the agent isn't restarted again")
+}
+
+func TestRecoverStuckPlans_CanBeDisabled(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.StuckPlanTimeout = &metav1.Duration{}
+	r, c := newStuckPlanTest(t, mdb)
+	ac, _ := getCurrentAutomationConfig(c, mdb)
+
+	r.now = func() time.Time { return stuckSince.Add(time.Hour) }
+	assert.NoError(t, r.recoverStuckPlans(mdb))
+
+	newAC, _ := getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, ac.Version, newAC.Version)
+	assert.NotContains(t, getPodAnnotations(t, c, "my-rs-1"), automationConfigRepushedAnnotationKey)
+}
+
+func TestStatefulSet_ExposesPodAnnotationsToAgent(t *testing.T) {
+	sts, err := buildStatefulSet(testutils.NewTestReplicaSet())
+	assert.NoError(t, err)
+
+	assert.Contains(t, sts.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: "pod-info",
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{{Path: podAnnotationsFileName, FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.annotations"}}},
+			},
+		},
+	})
+	agentContainer := sts.Spec.Template.Spec.Containers[0]
+	assert.Contains(t, agentContainer.Command[len(agentContainer.Command)-1], agentRestartRequestedAnnotationKey)
+}
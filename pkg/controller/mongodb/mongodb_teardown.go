@@ -0,0 +1,215 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/contains"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// teardownFinalizer prevents the resource from being removed until the replica set has
+// been shut down and the deletion policy applied
+const teardownFinalizer = "mongodb.com/v1.teardown"
+
+// ensureFinalizer adds the teardown finalizer to the resource
+func (r ReplicaSetReconciler) ensureFinalizer(mdb mdbv1.MongoDB) error {
+	if contains.String(mdb.Finalizers, teardownFinalizer) {
+		return nil
+	}
+	newMdb := mdbv1.MongoDB{}
+	return r.client.GetAndUpdate(mdb.NamespacedName(), &newMdb, func() {
+		if !contains.String(newMdb.Finalizers, teardownFinalizer) {
+			newMdb.Finalizers = append(newMdb.Finalizers, teardownFinalizer)
+		}
+	})
+}
+
+// teardown shuts the replica set down when the resource is deleted, by scaling the StatefulSet
+// to zero so that the members stop cleanly, applies the deletion policy and removes the finalizer.
+// It returns true once the resource can be removed.
+func (r ReplicaSetReconciler) teardown(mdb mdbv1.MongoDB) (bool, error) {
+	if !contains.String(mdb.Finalizers, teardownFinalizer) {
+		return true, nil
+	}
+
+	sts := appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), mdb.NamespacedName(), &sts)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	if err == nil {
+		if sts.Spec.Replicas == nil || *sts.Spec.Replicas != 0 {
+			r.log.Info("Shutting the replica set down")
+			if err := statefulset.GetAndUpdate(r.client, mdb.NamespacedName(), func(sts *appsv1.StatefulSet) {
+				replicas := int32(0)
+				sts.Spec.Replicas = &replicas
+			}); err != nil {
+				return false, fmt.Errorf("error scaling the StatefulSet down: %s", err)
+			}
+			return false, nil
+		}
+		if sts.Status.Replicas != 0 {
+			r.log.Infof("Waiting for %d members to shut down", sts.Status.Replicas)
+			return false, nil
+		}
+	}
+
+	if mdb.Spec.DeletionPolicy == mdbv1.DeleteResources {
+		if err := r.deleteDeploymentResources(mdb); err != nil {
+			return false, err
+		}
+	} else if err := r.orphanGeneratedObjects(mdb); err != nil {
+		return false, err
+	}
+
+	newMdb := mdbv1.MongoDB{}
+	if err := r.client.GetAndUpdate(mdb.NamespacedName(), &newMdb, func() {
+		var finalizers []string
+		for _, f := range newMdb.Finalizers {
+			if f != teardownFinalizer {
+				finalizers = append(finalizers, f)
+			}
+		}
+		newMdb.Finalizers = finalizers
+	}); err != nil {
+		return false, fmt.Errorf("error removing finalizer: %s", err)
+	}
+	r.log.Info("The replica set has been shut down")
+	return true, nil
+}
+
+// deleteDeploymentResources deletes the PersistentVolumeClaims of the members and the objects
+// generated for the resource. The StatefulSet is garbage collected with the resource.
+func (r ReplicaSetReconciler) deleteDeploymentResources(mdb mdbv1.MongoDB) error {
+	pvcs, err := r.memberVolumeClaims(mdb)
+	if err != nil {
+		return err
+	}
+	for _, pvc := range pvcs {
+		if err := r.deleteVolumeClaim(types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	objs, err := r.generatedObjects(mdb)
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		if err := r.client.Delete(context.TODO(), o.obj); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting %s: %s", o.nsName, err)
+		}
+		r.log.Infof("Deleted %s", o.nsName)
+	}
+	return nil
+}
+
+// memberVolumeClaims returns the PersistentVolumeClaims created from the volume claim templates of
+// the StatefulSet, including the ones of the members removed on scale-down which may have been
+// retained. They are labeled with the selector of the StatefulSet.
+func (r ReplicaSetReconciler) memberVolumeClaims(mdb mdbv1.MongoDB) ([]corev1.PersistentVolumeClaim, error) {
+	sts, err := buildStatefulSet(mdb)
+	if err != nil {
+		return nil, err
+	}
+	pvcList := corev1.PersistentVolumeClaimList{}
+	if err := r.client.List(context.TODO(), &pvcList, k8sClient.InNamespace(mdb.Namespace), k8sClient.MatchingLabels(sts.Spec.Selector.MatchLabels)); err != nil {
+		return nil, fmt.Errorf("error listing PersistentVolumeClaims: %s", err)
+	}
+	var pvcs []corev1.PersistentVolumeClaim
+	for _, pvc := range pvcList.Items {
+		for _, template := range sts.Spec.VolumeClaimTemplates {
+			if strings.HasPrefix(pvc.Name, fmt.Sprintf("%s-%s-", template.Name, sts.Name)) {
+				pvcs = append(pvcs, pvc)
+				break
+			}
+		}
+	}
+	return pvcs, nil
+}
+
+type generatedObject struct {
+	nsName types.NamespacedName
+	obj    runtime.Object
+}
+
+// generatedObjects returns the Secrets, the Services and the ConfigMaps owned by the resource,
+// such as the generated credentials, the connection strings and the automation config, which are
+// kept with the volumes by the Retain deletion policy
+func (r ReplicaSetReconciler) generatedObjects(mdb mdbv1.MongoDB) ([]generatedObject, error) {
+	secrets := corev1.SecretList{}
+	services := corev1.ServiceList{}
+	configMaps := corev1.ConfigMapList{}
+	var objs []generatedObject
+	for _, list := range []runtime.Object{&secrets, &services, &configMaps} {
+		if err := r.client.List(context.TODO(), list, k8sClient.InNamespace(mdb.Namespace)); err != nil {
+			return nil, fmt.Errorf("error listing the objects owned by the resource: %s", err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range items {
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				return nil, err
+			}
+			if isOwnedBy(accessor, mdb) {
+				objs = append(objs, generatedObject{
+					nsName: types.NamespacedName{Name: accessor.GetName(), Namespace: accessor.GetNamespace()},
+					obj:    obj,
+				})
+			}
+		}
+	}
+	return objs, nil
+}
+
+// isOwnedBy returns true if the resource is one of the owners of the object
+func isOwnedBy(obj metav1.Object, mdb mdbv1.MongoDB) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == mdb.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// orphanGeneratedObjects removes the owner reference to the resource from the generated objects,
+// so that they aren't garbage collected with it. They're owned again by a resource recreated with
+// the same name.
+func (r ReplicaSetReconciler) orphanGeneratedObjects(mdb mdbv1.MongoDB) error {
+	objs, err := r.generatedObjects(mdb)
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		accessor, err := meta.Accessor(o.obj)
+		if err != nil {
+			return err
+		}
+		var ownerReferences []metav1.OwnerReference
+		for _, ref := range accessor.GetOwnerReferences() {
+			if ref.UID != mdb.UID {
+				ownerReferences = append(ownerReferences, ref)
+			}
+		}
+		accessor.SetOwnerReferences(ownerReferences)
+		if err := r.client.Update(context.TODO(), o.obj); err != nil {
+			return fmt.Errorf("error removing the owner of %s: %s", o.nsName, err)
+		}
+		r.log.Infof("Removed the owner of %s", o.nsName)
+	}
+	return nil
+}
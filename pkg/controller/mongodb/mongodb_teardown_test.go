@@ -0,0 +1,130 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// deleteReplicaSet reconciles the resource with volumes and the objects, then deletes it and
+// reconciles until the replica set has been shut down
+func deleteReplicaSet(t *testing.T, policy mdbv1.DeletionPolicy, objs ...runtime.Object) (mdbv1.MongoDB, client.Client) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.DeletionPolicy = policy
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	createDataVolumeClaims(t, mgrClient, mdb, "10G")
+	for _, obj := range objs {
+		assert.NoError(t, mgrClient.Create(context.TODO(), obj))
+	}
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Contains(t, mdb.Finalizers, teardownFinalizer)
+	mdb.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	// the StatefulSet is scaled down first
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), *sts.Spec.Replicas)
+
+	// the resource is kept until the members have shut down
+	sts.Status.Replicas = 1
+	_ = mgrClient.Update(context.TODO(), &sts)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Contains(t, mdb.Finalizers, teardownFinalizer)
+
+	sts.Status.Replicas = 0
+	_ = mgrClient.Update(context.TODO(), &sts)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.NotContains(t, mdb.Finalizers, teardownFinalizer)
+	return mdb, mgrClient
+}
+
+func TestTeardown(t *testing.T) {
+	t.Run("Resources are retained by default", func(t *testing.T) {
+		mdb, c := deleteReplicaSet(t, "")
+		for i := 0; i < 3; i++ {
+			_, err := getDataVolumeClaim(c, mdb, i)
+			assert.NoError(t, err)
+		}
+		svc := corev1.Service{}
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: mdb.ServiceName(), Namespace: mdb.Namespace}, &svc))
+		assert.Empty(t, svc.OwnerReferences, "the Service isn't garbage collected with the resource")
+		cm := corev1.ConfigMap{}
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}, &cm))
+		assert.Empty(t, cm.OwnerReferences)
+	})
+
+	t.Run("Resources are deleted with the Delete policy", func(t *testing.T) {
+		mdb, c := deleteReplicaSet(t, mdbv1.DeleteResources)
+		for i := 0; i < 3; i++ {
+			_, err := getDataVolumeClaim(c, mdb, i)
+			assert.True(t, errors.IsNotFound(err))
+		}
+		err := c.Get(context.TODO(), types.NamespacedName{Name: mdb.ServiceName(), Namespace: mdb.Namespace}, &corev1.Service{})
+		assert.True(t, errors.IsNotFound(err))
+		err = c.Get(context.TODO(), types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}, &corev1.ConfigMap{})
+		assert.True(t, errors.IsNotFound(err))
+		err = c.Get(context.TODO(), mdb.ScramCredentialsNamespacedName(), &corev1.Secret{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+}
+
+func TestTeardown_GeneratedObjects(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	owned := metav1.ObjectMeta{Name: "my-rs-admin-connection-string", Namespace: mdb.Namespace, OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)}}
+	notOwned := metav1.ObjectMeta{Name: "my-secret", Namespace: mdb.Namespace}
+	// the volume of a member removed on scale-down, after a gap in the ordinals
+	retainedVolume := metav1.ObjectMeta{Name: volumeClaimName(dataVolumeName, mdb.Name, 5), Namespace: mdb.Namespace, Labels: map[string]string{"app": mdb.ServiceName()}}
+	otherVolume := metav1.ObjectMeta{Name: "data-volume-other-0", Namespace: mdb.Namespace, Labels: map[string]string{"app": mdb.ServiceName()}}
+	objs := func() []runtime.Object {
+		return []runtime.Object{
+			&corev1.Secret{ObjectMeta: owned},
+			&corev1.Secret{ObjectMeta: notOwned},
+			&corev1.PersistentVolumeClaim{ObjectMeta: retainedVolume},
+			&corev1.PersistentVolumeClaim{ObjectMeta: otherVolume},
+		}
+	}
+
+	t.Run("The objects owned by the resource are orphaned with the Retain policy", func(t *testing.T) {
+		_, c := deleteReplicaSet(t, mdbv1.RetainResources, objs()...)
+		s := corev1.Secret{}
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: owned.Name, Namespace: owned.Namespace}, &s))
+		assert.Empty(t, s.OwnerReferences)
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: retainedVolume.Name, Namespace: retainedVolume.Namespace}, &corev1.PersistentVolumeClaim{}))
+	})
+
+	t.Run("Only the objects and the volumes of the resource are deleted with the Delete policy", func(t *testing.T) {
+		_, c := deleteReplicaSet(t, mdbv1.DeleteResources, objs()...)
+		err := c.Get(context.TODO(), types.NamespacedName{Name: owned.Name, Namespace: owned.Namespace}, &corev1.Secret{})
+		assert.True(t, errors.IsNotFound(err))
+		err = c.Get(context.TODO(), types.NamespacedName{Name: retainedVolume.Name, Namespace: retainedVolume.Namespace}, &corev1.PersistentVolumeClaim{})
+		assert.True(t, errors.IsNotFound(err))
+
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: notOwned.Name, Namespace: notOwned.Namespace}, &corev1.Secret{}))
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: otherVolume.Name, Namespace: otherVolume.Namespace}, &corev1.PersistentVolumeClaim{}))
+	})
+}
@@ -2,6 +2,8 @@ package mongodb
 
 import (
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -29,70 +31,83 @@ const (
 )
 
 // validateTLSConfig will check that the configured ConfigMap and Secret exist and that they have the correct fields.
-func (r *ReplicaSetReconciler) validateTLSConfig(mdb mdbv1.MongoDB) (bool, error) {
+// They are watched, so that the resource is reconciled again when they are created or fixed.
+func (r *ReplicaSetReconciler) validateTLSConfig(mdb mdbv1.MongoDB) error {
 	if !mdb.Spec.Security.TLS.Enabled {
-		return true, nil
+		return nil
 	}
 
 	r.log.Info("Ensuring TLS is correctly configured")
+	if usesVaultTLS(mdb) {
+		return r.checkVaultTLSPrerequisites(mdb)
+	}
+	return r.checkTLSPrerequisites(mdb)
+}
 
+// checkTLSPrerequisites returns a terminal error if the configured ConfigMap or Secret doesn't exist,
+// doesn't have the correct fields, or if they don't hold valid certificates, also for the external
+// hostnames of the members.
+func (r *ReplicaSetReconciler) checkTLSPrerequisites(mdb mdbv1.MongoDB) error {
 	// Ensure CA ConfigMap exists
 	caData, err := configmap.ReadData(r.client, mdb.TLSConfigMapNamespacedName())
 	if err != nil {
 		if errors.IsNotFound(err) {
-			r.log.Warnf(`CA ConfigMap "%s" not found`, mdb.TLSConfigMapNamespacedName())
-			return false, nil
+			return referencedResourceNotFound("ConfigMap", mdb.TLSConfigMapNamespacedName(), "spec.security.tls.caConfigMapRef")
 		}
 
-		return false, err
+		return err
 	}
 
 	// Ensure ConfigMap has a "ca.crt" field
 	if cert, ok := caData[tlsCACertName]; !ok || cert == "" {
-		r.log.Warnf(`ConfigMap "%s" should have a CA certificate in field "%s"`, mdb.TLSConfigMapNamespacedName(), tlsCACertName)
-		return false, nil
+		return missingPrerequisite(`ConfigMap "%s" should have a CA certificate in field "%s"`, mdb.TLSConfigMapNamespacedName(), tlsCACertName)
 	}
 
 	// Ensure Secret exists
 	secretData, err := secret.ReadStringData(r.client, mdb.TLSSecretNamespacedName())
 	if err != nil {
 		if errors.IsNotFound(err) {
-			r.log.Warnf(`Secret "%s" not found`, mdb.TLSSecretNamespacedName())
-			return false, nil
+			return referencedResourceNotFound("Secret", mdb.TLSSecretNamespacedName(), "spec.security.tls.certificateKeySecretRef")
 		}
 
-		return false, err
+		return err
 	}
 
 	// Ensure Secret has "tls.crt" and "tls.key" fields
 	if key, ok := secretData[tlsSecretKeyName]; !ok || key == "" {
-		r.log.Warnf(`Secret "%s" should have a key in field "%s"`, mdb.TLSSecretNamespacedName(), tlsSecretKeyName)
-		return false, nil
+		return missingPrerequisite(`Secret "%s" should have a key in field "%s"`, mdb.TLSSecretNamespacedName(), tlsSecretKeyName)
 	}
 	if cert, ok := secretData[tlsSecretCertName]; !ok || cert == "" {
-		r.log.Warnf(`Secret "%s" should have a certificate in field "%s"`, mdb.TLSSecretNamespacedName(), tlsSecretKeyName)
-		return false, nil
+		return missingPrerequisite(`Secret "%s" should have a certificate in field "%s"`, mdb.TLSSecretNamespacedName(), tlsSecretCertName)
 	}
 
-	// Watch certificate-key secret to handle rotations
-	r.secretWatcher.Watch(mdb.TLSSecretNamespacedName(), mdb.NamespacedName())
+	// Ensure the certificates can be used by the members
+	if _, err := tls.X509KeyPair([]byte(secretData[tlsSecretCertName]), []byte(secretData[tlsSecretKeyName])); err != nil {
+		return invalidCertificate(`Secret "%s" doesn't hold a valid certificate and key: %s`, mdb.TLSSecretNamespacedName(), err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(caData[tlsCACertName])) {
+		return invalidCertificate(`ConfigMap "%s" doesn't hold a valid CA certificate in field "%s"`, mdb.TLSConfigMapNamespacedName(), tlsCACertName)
+	}
+	if err := checkExternalHostnamesCertificate(mdb, secretData[tlsSecretCertName]); err != nil {
+		return invalidCertificate(`Secret "%s" doesn't hold a valid certificate: %s`, mdb.TLSSecretNamespacedName(), err)
+	}
 
-	return true, nil
+	return nil
 }
 
 // getTLSConfigModification creates a modification function which enables TLS in the automation config.
 // It will also ensure that the combined cert-key secret is created.
-func getTLSConfigModification(getUpdateCreator secret.GetUpdateCreator, mdb mdbv1.MongoDB) (automationconfig.Modification, error) {
+func getTLSConfigModification(getApplier secret.GetApplier, mdb mdbv1.MongoDB) (automationconfig.Modification, error) {
 	if !mdb.Spec.Security.TLS.Enabled {
 		return automationconfig.NOOP(), nil
 	}
 
-	cert, key, err := getCertAndKey(getUpdateCreator, mdb)
+	cert, key, err := getCertAndKey(getApplier, mdb)
 	if err != nil {
 		return automationconfig.NOOP(), err
 	}
 
-	err = ensureTLSSecret(getUpdateCreator, mdb, cert, key)
+	err = ensureTLSSecret(getApplier, mdb, cert, key)
 	if err != nil {
 		return automationconfig.NOOP(), err
 	}
@@ -100,11 +115,9 @@ func getTLSConfigModification(getUpdateCreator secret.GetUpdateCreator, mdb mdbv
 	// The config is only updated after the certs and keys have been rolled out to all pods.
 	// The agent needs these to be in place before the config is updated.
 	// Once the config is updated, the agents will gradually enable TLS in accordance with: https://docs.mongodb.com/manual/tutorial/upgrade-cluster-to-ssl/
-	if hasRolledOutTLS(mdb) {
-		return tlsConfigModification(mdb, cert, key), nil
-	}
-
-	return automationconfig.NOOP(), nil
+	caCertificatePath := tlsCAMountPath + tlsCACertName
+	certificateKeyPath := tlsOperatorSecretMountPath + tlsOperatorSecretFileName(cert, key)
+	return automationconfig.If(hasRolledOutTLS(mdb), tlsConfigModification(mdb, caCertificatePath, certificateKeyPath)), nil
 }
 
 // getCertAndKey will fetch the certificate and key from the user-provided Secret.
@@ -122,9 +135,9 @@ func getCertAndKey(getter secret.Getter, mdb mdbv1.MongoDB) (string, string, err
 	return cert, key, nil
 }
 
-// ensureTLSSecret will create or update the operator-managed Secret containing
+// ensureTLSSecret will apply the operator-managed Secret containing
 // the concatenated certificate and key from the user-provided Secret.
-func ensureTLSSecret(getUpdateCreator secret.GetUpdateCreator, mdb mdbv1.MongoDB, cert, key string) error {
+func ensureTLSSecret(applier secret.Applier, mdb mdbv1.MongoDB, cert, key string) error {
 	// Calculate file name from certificate and key
 	fileName := tlsOperatorSecretFileName(cert, key)
 
@@ -135,7 +148,7 @@ func ensureTLSSecret(getUpdateCreator secret.GetUpdateCreator, mdb mdbv1.MongoDB
 		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
 		Build()
 
-	return secret.CreateOrUpdate(getUpdateCreator, operatorSecret)
+	return applier.ApplySecret(operatorSecret)
 }
 
 // tlsOperatorSecretFileName calculates the file name to use for the mounted
@@ -149,30 +162,29 @@ func tlsOperatorSecretFileName(cert, key string) string {
 	return fmt.Sprintf("%x.pem", hash)
 }
 
-// tlsConfigModification will enable TLS in the automation config.
-func tlsConfigModification(mdb mdbv1.MongoDB, cert, key string) automationconfig.Modification {
-	caCertificatePath := tlsCAMountPath + tlsCACertName
-	certificateKeyPath := tlsOperatorSecretMountPath + tlsOperatorSecretFileName(cert, key)
-
+// tlsConfigModification will enable TLS in the automation config, with the CA certificate and the
+// combined certificate and key at the given paths of the containers.
+func tlsConfigModification(mdb mdbv1.MongoDB, caCertificatePath, certificateKeyPath string) automationconfig.Modification {
 	mode := automationconfig.TLSModeRequired
 	if mdb.Spec.Security.TLS.Optional {
 		// TLSModePreferred requires server-server connections to use TLS but makes it optional for clients.
 		mode = automationconfig.TLSModePreferred
 	}
 
-	return func(config *automationconfig.AutomationConfig) {
-		// Configure CA certificate for agent
-		config.TLS.CAFilePath = caCertificatePath
-
-		for i := range config.Processes {
-			config.Processes[i].Args26.Net.TLS = automationconfig.MongoDBTLS{
+	return automationconfig.Merge(
+		func(config *automationconfig.AutomationConfig) {
+			// Configure CA certificate for agent
+			config.TLS.CAFilePath = caCertificatePath
+		},
+		automationconfig.ForEachProcess(func(process *automationconfig.Process) {
+			process.Args26.Net.TLS = &automationconfig.MongoDBTLS{
 				Mode:                               mode,
 				CAFile:                             caCertificatePath,
 				PEMKeyFile:                         certificateKeyPath,
 				AllowConnectionsWithoutCertificate: true,
 			}
-		}
-	}
+		}),
+	)
 }
 
 // hasRolledOutTLS determines if the TLS key and certs have been mounted to all pods.
@@ -192,23 +204,33 @@ func (r *ReplicaSetReconciler) completeTLSRollout(mdb mdbv1.MongoDB) error {
 
 	r.log.Debug("Completing TLS rollout")
 
-	mdb.Annotations[tlsRolledOutAnnotationKey] = trueAnnotation
+	annotations := map[string]string{}
+	for key, val := range mdb.Annotations {
+		annotations[key] = val
+	}
+	annotations[tlsRolledOutAnnotationKey] = trueAnnotation
+	mdb.Annotations = annotations
 	if err := r.ensureAutomationConfig(mdb); err != nil {
 		return fmt.Errorf("error updating automation config after TLS rollout: %+v", err)
 	}
 
-	if err := r.setAnnotations(mdb.NamespacedName(), mdb.Annotations); err != nil {
+	// only the TLS annotation is set, the others may have been changed since the resource was read
+	if err := r.setAnnotations(mdb.NamespacedName(), map[string]string{tlsRolledOutAnnotationKey: trueAnnotation}); err != nil {
 		return fmt.Errorf("error setting TLS annotation: %+v", err)
 	}
 
 	return nil
 }
 
-// buildTLSPodSpecModification will add the TLS init container and volumes to the pod template if TLS is enabled.
+// buildTLSPodSpecModification will add the TLS init container and volumes to the pod template if TLS is enabled,
+// or the annotations of the Vault Agent injector if the certificates are read from Vault.
 func buildTLSPodSpecModification(mdb mdbv1.MongoDB) podtemplatespec.Modification {
 	if !mdb.Spec.Security.TLS.Enabled {
 		return podtemplatespec.NOOP()
 	}
+	if usesVaultTLS(mdb) {
+		return buildVaultTLSPodSpecModification(mdb)
+	}
 
 	// Configure a volume which mounts the CA certificate from a ConfigMap
 	// The certificate is used by both mongod and the agent
@@ -2,6 +2,8 @@ package mongodb
 
 import (
 	"context"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
@@ -12,6 +14,7 @@ import (
 	mdbClient "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
 	"github.com/stretchr/testify/assert"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -20,22 +23,22 @@ import (
 )
 
 func TestStatefulSet_IsCorrectlyConfiguredWithTLS(t *testing.T) {
-	mdb := newTestReplicaSetWithTLS()
+	mdb := testutils.NewTestReplicaSetWithTLS()
 	mgr := client.NewManager(&mdb)
 
 	err := createTLSSecretAndConfigMap(mgr.GetClient(), mdb)
 	assert.NoError(t, err)
 
-	r := newReconciler(mgr, mockManifestProvider(mdb.Spec.Version))
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
 	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	sts := appsv1.StatefulSet{}
 	err = mgr.GetClient().Get(context.TODO(), types.NamespacedName{Name: mdb.Name, Namespace: mdb.Namespace}, &sts)
 	assert.NoError(t, err)
 
 	// Assert that all TLS volumes have been added.
-	assert.Len(t, sts.Spec.Template.Spec.Volumes, 5)
+	assert.Len(t, sts.Spec.Template.Spec.Volumes, 6)
 	assert.Contains(t, sts.Spec.Template.Spec.Volumes, corev1.Volume{
 		Name: "tls-ca",
 		VolumeSource: corev1.VolumeSource{
@@ -83,7 +86,7 @@ func TestAutomationConfig_IsCorrectlyConfiguredWithTLS(t *testing.T) {
 		err := createTLSSecretAndConfigMap(client, mdb)
 		assert.NoError(t, err)
 
-		manifest, err := mockManifestProvider(mdb.Spec.Version)()
+		manifest, err := testutils.MockManifestProvider(mdb.Spec.Version)()
 		assert.NoError(t, err)
 		versionConfig := manifest.BuildsForVersion(mdb.Spec.Version)
 
@@ -97,7 +100,7 @@ func TestAutomationConfig_IsCorrectlyConfiguredWithTLS(t *testing.T) {
 	}
 
 	t.Run("With TLS disabled", func(t *testing.T) {
-		mdb := newTestReplicaSet()
+		mdb := testutils.NewTestReplicaSet()
 		ac := createAC(mdb)
 
 		assert.Equal(t, automationconfig.TLS{
@@ -106,14 +109,14 @@ func TestAutomationConfig_IsCorrectlyConfiguredWithTLS(t *testing.T) {
 		}, ac.TLS)
 
 		for _, process := range ac.Processes {
-			assert.Equal(t, automationconfig.MongoDBTLS{
+			assert.Equal(t, &automationconfig.MongoDBTLS{
 				Mode: automationconfig.TLSModeDisabled,
 			}, process.Args26.Net.TLS)
 		}
 	})
 
 	t.Run("With TLS enabled, during rollout", func(t *testing.T) {
-		mdb := newTestReplicaSetWithTLS()
+		mdb := testutils.NewTestReplicaSetWithTLS()
 		ac := createAC(mdb)
 
 		assert.Equal(t, automationconfig.TLS{
@@ -122,14 +125,14 @@ func TestAutomationConfig_IsCorrectlyConfiguredWithTLS(t *testing.T) {
 		}, ac.TLS)
 
 		for _, process := range ac.Processes {
-			assert.Equal(t, automationconfig.MongoDBTLS{
+			assert.Equal(t, &automationconfig.MongoDBTLS{
 				Mode: automationconfig.TLSModeDisabled,
 			}, process.Args26.Net.TLS)
 		}
 	})
 
 	t.Run("With TLS enabled and required, rollout completed", func(t *testing.T) {
-		mdb := newTestReplicaSetWithTLS()
+		mdb := testutils.NewTestReplicaSetWithTLS()
 		mdb.Annotations[tlsRolledOutAnnotationKey] = "true"
 		ac := createAC(mdb)
 
@@ -139,9 +142,9 @@ func TestAutomationConfig_IsCorrectlyConfiguredWithTLS(t *testing.T) {
 		}, ac.TLS)
 
 		for _, process := range ac.Processes {
-			operatorSecretFileName := tlsOperatorSecretFileName("CERT", "KEY")
+			operatorSecretFileName := tlsOperatorSecretFileName(testCertificate(t, "server.crt"), testCertificate(t, "server.key"))
 
-			assert.Equal(t, automationconfig.MongoDBTLS{
+			assert.Equal(t, &automationconfig.MongoDBTLS{
 				Mode:                               automationconfig.TLSModeRequired,
 				PEMKeyFile:                         tlsOperatorSecretMountPath + operatorSecretFileName,
 				CAFile:                             tlsCAMountPath + tlsCACertName,
@@ -151,7 +154,7 @@ func TestAutomationConfig_IsCorrectlyConfiguredWithTLS(t *testing.T) {
 	})
 
 	t.Run("With TLS enabled and optional, rollout completed", func(t *testing.T) {
-		mdb := newTestReplicaSetWithTLS()
+		mdb := testutils.NewTestReplicaSetWithTLS()
 		mdb.Annotations[tlsRolledOutAnnotationKey] = "true"
 		mdb.Spec.Security.TLS.Optional = true
 		ac := createAC(mdb)
@@ -162,9 +165,9 @@ func TestAutomationConfig_IsCorrectlyConfiguredWithTLS(t *testing.T) {
 		}, ac.TLS)
 
 		for _, process := range ac.Processes {
-			operatorSecretFileName := tlsOperatorSecretFileName("CERT", "KEY")
+			operatorSecretFileName := tlsOperatorSecretFileName(testCertificate(t, "server.crt"), testCertificate(t, "server.key"))
 
-			assert.Equal(t, automationconfig.MongoDBTLS{
+			assert.Equal(t, &automationconfig.MongoDBTLS{
 				Mode:                               automationconfig.TLSModePreferred,
 				PEMKeyFile:                         tlsOperatorSecretMountPath + operatorSecretFileName,
 				CAFile:                             tlsCAMountPath + tlsCACertName,
@@ -172,11 +175,30 @@ func TestAutomationConfig_IsCorrectlyConfiguredWithTLS(t *testing.T) {
 			}, process.Args26.Net.TLS)
 		}
 	})
+
+	t.Run("With TLS enabled on MongoDB 4.0, rollout completed", func(t *testing.T) {
+		mdb := testutils.NewTestReplicaSetWithTLS()
+		mdb.Annotations[tlsRolledOutAnnotationKey] = "true"
+		mdb.Spec.Version = "4.0.6"
+		ac := createAC(mdb)
+
+		for _, process := range ac.Processes {
+			operatorSecretFileName := tlsOperatorSecretFileName(testCertificate(t, "server.crt"), testCertificate(t, "server.key"))
+
+			assert.Nil(t, process.Args26.Net.TLS)
+			assert.Equal(t, &automationconfig.MongoDBSSL{
+				Mode:                               automationconfig.SSLModeRequired,
+				PEMKeyFile:                         tlsOperatorSecretMountPath + operatorSecretFileName,
+				CAFile:                             tlsCAMountPath + tlsCACertName,
+				AllowConnectionsWithoutCertificate: true,
+			}, process.Args26.Net.SSL)
+		}
+	})
 }
 
 func TestTLSOperatorSecret(t *testing.T) {
 	t.Run("Secret is created if it doesn't exist", func(t *testing.T) {
-		mdb := newTestReplicaSetWithTLS()
+		mdb := testutils.NewTestReplicaSetWithTLS()
 		client := mdbClient.NewClient(client.NewManager(&mdb).GetClient())
 		err := createTLSSecretAndConfigMap(client, mdb)
 		assert.NoError(t, err)
@@ -186,13 +208,13 @@ func TestTLSOperatorSecret(t *testing.T) {
 
 		// Operator-managed secret should have been created and contain the
 		// concatenated certificate and key.
-		certificateKey, err := secret.ReadKey(client, tlsOperatorSecretFileName("CERT", "KEY"), mdb.TLSOperatorSecretNamespacedName())
+		certificateKey, err := secret.ReadKey(client, tlsOperatorSecretFileName(testCertificate(t, "server.crt"), testCertificate(t, "server.key")), mdb.TLSOperatorSecretNamespacedName())
 		assert.NoError(t, err)
-		assert.Equal(t, "CERTKEY", certificateKey)
+		assert.Equal(t, testCertificate(t, "server.crt")+testCertificate(t, "server.key"), certificateKey)
 	})
 
 	t.Run("Secret is updated if it already exists", func(t *testing.T) {
-		mdb := newTestReplicaSetWithTLS()
+		mdb := testutils.NewTestReplicaSetWithTLS()
 		client := mdbClient.NewClient(client.NewManager(&mdb).GetClient())
 		err := createTLSSecretAndConfigMap(client, mdb)
 		assert.NoError(t, err)
@@ -211,18 +233,45 @@ func TestTLSOperatorSecret(t *testing.T) {
 
 		// Operator-managed secret should have been updated with the concatenated
 		// certificate and key.
-		certificateKey, err := secret.ReadKey(client, tlsOperatorSecretFileName("CERT", "KEY"), mdb.TLSOperatorSecretNamespacedName())
+		certificateKey, err := secret.ReadKey(client, tlsOperatorSecretFileName(testCertificate(t, "server.crt"), testCertificate(t, "server.key")), mdb.TLSOperatorSecretNamespacedName())
 		assert.NoError(t, err)
-		assert.Equal(t, "CERTKEY", certificateKey)
+		assert.Equal(t, testCertificate(t, "server.crt")+testCertificate(t, "server.key"), certificateKey)
 	})
 }
 
+// readTestCertificate reads a certificate or a key of the e2e tests from testdata/tls
+func readTestCertificate(name string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "testdata", "tls", name))
+	return string(data), err
+}
+
+func testCertificate(t *testing.T, name string) string {
+	data, err := readTestCertificate(name)
+	assert.NoError(t, err)
+	return data
+}
+
 func createTLSSecretAndConfigMap(c k8sClient.Client, mdb mdbv1.MongoDB) error {
+	return createTLSSecretAndConfigMapWith(c, mdb, "server.crt", "server.key")
+}
+
+// createTLSSecretAndConfigMapWith creates the Secret with the certificate and key from the given files
+// of testdata/tls, and the ConfigMap with the CA certificate.
+func createTLSSecretAndConfigMapWith(c k8sClient.Client, mdb mdbv1.MongoDB, certFile, keyFile string) error {
+	data := map[string]string{}
+	for _, name := range []string{certFile, keyFile, "ca.crt"} {
+		content, err := readTestCertificate(name)
+		if err != nil {
+			return err
+		}
+		data[name] = content
+	}
+
 	s := secret.Builder().
 		SetName(mdb.Spec.Security.TLS.CertificateKeySecret.Name).
 		SetNamespace(mdb.Namespace).
-		SetField("tls.crt", "CERT").
-		SetField("tls.key", "KEY").
+		SetField("tls.crt", data[certFile]).
+		SetField("tls.key", data[keyFile]).
 		Build()
 
 	err := c.Create(context.TODO(), &s)
@@ -233,7 +282,7 @@ func createTLSSecretAndConfigMap(c k8sClient.Client, mdb mdbv1.MongoDB) error {
 	configMap := configmap.Builder().
 		SetName(mdb.Spec.Security.TLS.CaConfigMap.Name).
 		SetNamespace(mdb.Namespace).
-		SetField("ca.crt", "CERT").
+		SetField("ca.crt", data["ca.crt"]).
 		Build()
 
 	err = c.Create(context.TODO(), &configMap)
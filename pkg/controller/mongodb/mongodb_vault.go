@@ -0,0 +1,182 @@
+package mongodb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/vault"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// the annotations of the Vault Agent injector, which writes the secrets of Vault in the containers
+	// of the Pods
+	vaultInjectAnnotationKey          = "vault.hashicorp.com/agent-inject"
+	vaultRoleAnnotationKey            = "vault.hashicorp.com/role"
+	vaultPrePopulateOnlyAnnotationKey = "vault.hashicorp.com/agent-pre-populate-only"
+	vaultSecretAnnotationPrefix       = "vault.hashicorp.com/agent-inject-secret-"
+	vaultTemplateAnnotationPrefix     = "vault.hashicorp.com/agent-inject-template-"
+
+	// vaultSecretsPath is where the Vault Agent injector writes the secrets in the containers
+	vaultSecretsPath = "/vault/secrets/"
+	// vaultCertificateKeyFileName is the file holding the certificate and the key of the members, which
+	// mongod expects in a single PEM file
+	vaultCertificateKeyFileName = "mongodb.pem"
+)
+
+// vaultReader reads the secrets stored in Vault, it is nil if the operator isn't configured with the
+// address of Vault
+var vaultReader vault.Reader
+
+// SetVaultReader configures the operator to read the secrets the MongoDB resources reference in Vault
+// with the reader. It must be called before the controllers are added to the Manager.
+func SetVaultReader(reader vault.Reader) {
+	vaultReader = reader
+}
+
+// usesVaultTLS returns true if the certificates of the members are read from Vault
+func usesVaultTLS(mdb mdbv1.MongoDB) bool {
+	return mdb.Spec.Security.TLS.Enabled && mdb.Spec.Security.TLS.VaultSecretPath != ""
+}
+
+// validateVault returns an error if the resource references Vault secrets without the Vault role
+func validateVault(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.Security.Vault != nil && mdb.Spec.Security.Vault.Role != "" {
+		return nil
+	}
+	if mdb.Spec.Security.TLS.VaultSecretPath != "" {
+		return fmt.Errorf("spec.security.vault.role is required by spec.security.tls.vaultSecretPath")
+	}
+	for i, user := range mdb.Spec.Users {
+		if user.PasswordVaultRef != nil {
+			return fmt.Errorf("spec.security.vault.role is required by spec.users[%d].passwordVaultRef", i)
+		}
+	}
+	return nil
+}
+
+// readVaultSecret reads the Vault secret at path with the role of the resource. The errors reading
+// it aren't terminal, as the secrets of Vault aren't watched, so that reading it is retried.
+func (r *ReplicaSetReconciler) readVaultSecret(mdb mdbv1.MongoDB, path string) (map[string]string, error) {
+	if r.vault == nil {
+		return nil, missingPrerequisite("the operator isn't configured with the address of Vault, VAULT_ADDR must be set to read secret %s", path)
+	}
+	if err := validateVault(mdb); err != nil {
+		return nil, invalidSpec(err)
+	}
+	return r.vault.Read(vaultLogin(mdb), path)
+}
+
+// vaultLogin returns what the operator logs in to Vault as to read the secrets of the resource: its
+// role, with a token of the service account of its members, so that the operator can't read more
+// than the members, and the role can only be used by the resources of the namespaces it is bound to
+func vaultLogin(mdb mdbv1.MongoDB) vault.Login {
+	return vault.Login{
+		Role:           mdb.Spec.Security.Vault.Role,
+		ServiceAccount: types.NamespacedName{Name: operatorServiceAccountName, Namespace: mdb.Namespace},
+	}
+}
+
+// readVaultTLSCertificates returns the certificate, the key and the CA certificate of the members from
+// the Vault secret of spec.security.tls.vaultSecretPath
+func (r *ReplicaSetReconciler) readVaultTLSCertificates(mdb mdbv1.MongoDB) (string, string, string, error) {
+	path := mdb.Spec.Security.TLS.VaultSecretPath
+	data, err := r.readVaultSecret(mdb, path)
+	if err != nil {
+		return "", "", "", err
+	}
+	for _, key := range []string{tlsSecretCertName, tlsSecretKeyName, tlsCACertName} {
+		if data[key] == "" {
+			return "", "", "", fmt.Errorf(`Vault secret %s should have field "%s"`, path, key)
+		}
+	}
+	return data[tlsSecretCertName], data[tlsSecretKeyName], data[tlsCACertName], nil
+}
+
+// checkVaultTLSPrerequisites returns an error if the Vault secret of the certificates doesn't exist,
+// doesn't have the correct fields, or if they don't hold valid certificates
+func (r *ReplicaSetReconciler) checkVaultTLSPrerequisites(mdb mdbv1.MongoDB) error {
+	cert, key, ca, err := r.readVaultTLSCertificates(mdb)
+	if err != nil {
+		return err
+	}
+	path := mdb.Spec.Security.TLS.VaultSecretPath
+	if _, err := tls.X509KeyPair([]byte(cert), []byte(key)); err != nil {
+		return fmt.Errorf("Vault secret %s doesn't hold a valid certificate and key: %s", path, err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(ca)) {
+		return fmt.Errorf(`Vault secret %s doesn't hold a valid CA certificate in field "%s"`, path, tlsCACertName)
+	}
+	if err := checkExternalHostnamesCertificate(mdb, cert); err != nil {
+		return fmt.Errorf("Vault secret %s doesn't hold a valid certificate: %s", path, err)
+	}
+	return nil
+}
+
+// getVaultTLSConfigModification returns the modification enabling TLS in the automation config with the
+// certificates written by the Vault Agent injector, once they are rolled out to the members
+func (r *ReplicaSetReconciler) getVaultTLSConfigModification(mdb mdbv1.MongoDB) (automationconfig.Modification, error) {
+	if _, _, _, err := r.readVaultTLSCertificates(mdb); err != nil {
+		return automationconfig.NOOP(), err
+	}
+	return automationconfig.If(hasRolledOutTLS(mdb), tlsConfigModification(mdb, vaultSecretsPath+tlsCACertName, vaultSecretsPath+vaultCertificateKeyFileName)), nil
+}
+
+// vaultAgentAnnotations returns the annotations of the Vault Agent injector writing the files in the
+// containers of the Pod, from the templates reading the fields of the Vault secret at path. The Vault
+// Agent logs in with the role of the resource and the token of the service account of the Pod, in the
+// namespace of the resource, which the role must be bound to. The
+// injector only runs an init container, and no sidecar keeping the files up to date, if
+// prePopulateOnly is true, so that the Pods of the Jobs can complete.
+func vaultAgentAnnotations(mdb mdbv1.MongoDB, path string, prePopulateOnly bool, files map[string][]string) map[string]string {
+	annotations := map[string]string{
+		vaultInjectAnnotationKey: trueAnnotation,
+		vaultRoleAnnotationKey:   mdb.Spec.Security.Vault.Role,
+	}
+	if prePopulateOnly {
+		annotations[vaultPrePopulateOnlyAnnotationKey] = trueAnnotation
+	}
+	for name, fields := range files {
+		template := fmt.Sprintf(`{{- with secret "%s" -}}`, vault.DataPath(path))
+		for _, field := range fields {
+			template += fmt.Sprintf(`{{ index .Data.data "%s" }}`, field)
+		}
+		annotations[vaultSecretAnnotationPrefix+name] = vault.DataPath(path)
+		annotations[vaultTemplateAnnotationPrefix+name] = template + "{{- end }}"
+	}
+	return annotations
+}
+
+// buildVaultTLSPodSpecModification has the Vault Agent injector write the certificate and key of the
+// members, and the CA certificate, in their containers
+func buildVaultTLSPodSpecModification(mdb mdbv1.MongoDB) podtemplatespec.Modification {
+	return podtemplatespec.WithAdditionalAnnotations(vaultAgentAnnotations(mdb, mdb.Spec.Security.TLS.VaultSecretPath, false, map[string][]string{
+		vaultCertificateKeyFileName: {tlsSecretCertName, tlsSecretKeyName},
+		tlsCACertName:               {tlsCACertName},
+	}))
+}
+
+// readUserPassword returns the password of the user, from its Secret or its Vault secret
+func (r *ReplicaSetReconciler) readUserPassword(mdb mdbv1.MongoDB, user mdbv1.MongoDBUser) (string, error) {
+	if user.PasswordVaultRef == nil {
+		return secret.ReadKey(r.client, userPasswordKey(user.PasswordSecretRef.Key), types.NamespacedName{Name: user.PasswordSecretRef.Name, Namespace: mdb.Namespace})
+	}
+	data, err := r.readVaultSecret(mdb, user.PasswordVaultRef.Path)
+	if err != nil {
+		return "", err
+	}
+	return data[userPasswordKey(user.PasswordVaultRef.Key)], nil
+}
+
+// userPasswordKey returns the key of the Secret or Vault secret holding the password of a user
+func userPasswordKey(key string) string {
+	if key == "" {
+		return defaultUserPasswordKey
+	}
+	return key
+}
@@ -0,0 +1,170 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeVaultReader holds the Vault secrets by login and path
+type fakeVaultReader map[vault.Login]map[string]map[string]string
+
+// myRSVaultLogin is the login of the members of my-rs
+var myRSVaultLogin = vault.Login{Role: "my-rs", ServiceAccount: types.NamespacedName{Namespace: "my-ns", Name: "mongodb-kubernetes-operator"}}
+
+func (f fakeVaultReader) Read(login vault.Login, path string) (map[string]string, error) {
+	data, ok := f[login][path]
+	if !ok {
+		return nil, vault.NotFoundError{Path: path}
+	}
+	return data, nil
+}
+
+func newVaultTLSReplicaSet() mdbv1.MongoDB {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mdb.Spec.Security.TLS.CertificateKeySecret.Name = ""
+	mdb.Spec.Security.TLS.CaConfigMap.Name = ""
+	mdb.Spec.Security.TLS.VaultSecretPath = "secret/mongodb/my-rs/tls"
+	mdb.Spec.Security.Vault = &mdbv1.Vault{Role: "my-rs"}
+	return mdb
+}
+
+func newVaultTLSReader(t *testing.T) fakeVaultReader {
+	return fakeVaultReader{myRSVaultLogin: {"secret/mongodb/my-rs/tls": {
+		"tls.crt": testCertificate(t, "server.crt"),
+		"tls.key": testCertificate(t, "server.key"),
+		"ca.crt":  testCertificate(t, "ca.crt"),
+	}}}
+}
+
+func TestReconcile_VaultTLS(t *testing.T) {
+	mdb := newVaultTLSReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.vault = newVaultTLSReader(t)
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	sts := appsv1.StatefulSet{}
+	assert.NoError(t, mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &sts))
+	annotations := sts.Spec.Template.Annotations
+	assert.Equal(t, "true", annotations[safeToEvictAnnotationKey], "the other annotations are kept")
+	assert.Equal(t, "true", annotations[vaultInjectAnnotationKey])
+	assert.Equal(t, "my-rs", annotations[vaultRoleAnnotationKey])
+	assert.Equal(t, "secret/data/mongodb/my-rs/tls", annotations[vaultSecretAnnotationPrefix+"mongodb.pem"])
+	assert.Equal(t, `{{- with secret "secret/data/mongodb/my-rs/tls" -}}{{ index .Data.data "tls.crt" }}{{ index .Data.data "tls.key" }}{{- end }}`, annotations[vaultTemplateAnnotationPrefix+"mongodb.pem"])
+	assert.Equal(t, `{{- with secret "secret/data/mongodb/my-rs/tls" -}}{{ index .Data.data "ca.crt" }}{{- end }}`, annotations[vaultTemplateAnnotationPrefix+"ca.crt"])
+	assert.NotContains(t, annotations, vaultPrePopulateOnlyAnnotationKey, "the certificates are kept up to date by the sidecar")
+	for _, v := range sts.Spec.Template.Spec.Volumes {
+		assert.NotContains(t, []string{"tls-ca", "tls-secret"}, v.Name, "the certificates aren't mounted from Kubernetes")
+	}
+	_, err = client.NewClient(mgr.GetClient()).GetSecret(mdb.TLSOperatorSecretNamespacedName())
+	assert.Error(t, err, "the certificates aren't copied to a Secret")
+
+	mdb.Annotations[tlsRolledOutAnnotationKey] = trueAnnotation
+	ac, err := r.buildAutomationConfigFromSpec(mdb, automationconfig.AutomationConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, "/vault/secrets/ca.crt", ac.TLS.CAFilePath)
+	for _, process := range ac.Processes {
+		assert.Equal(t, "/vault/secrets/mongodb.pem", process.Args26.Net.TLS.PEMKeyFile)
+		assert.Equal(t, "/vault/secrets/ca.crt", process.Args26.Net.TLS.CAFile)
+	}
+}
+
+func TestReconcile_VaultTLS_InvalidCertificates(t *testing.T) {
+	mdb := newVaultTLSReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	reader := newVaultTLSReader(t)
+	r.vault = reader
+
+	delete(reader[myRSVaultLogin]["secret/mongodb/my-rs/tls"], "ca.crt")
+	assert.EqualError(t, r.validateTLSConfig(mdb), `Vault secret secret/mongodb/my-rs/tls should have field "ca.crt"`)
+	reader[myRSVaultLogin]["secret/mongodb/my-rs/tls"]["ca.crt"] = "not a certificate"
+	assert.EqualError(t, r.validateTLSConfig(mdb), `Vault secret secret/mongodb/my-rs/tls doesn't hold a valid CA certificate in field "ca.crt"`)
+
+	mdb.Spec.Security.Vault.Role = "other-rs"
+	assert.True(t, vault.IsNotFound(r.validateTLSConfig(mdb)))
+	_, ok := r.validateTLSConfig(mdb).(terminalError)
+	assert.False(t, ok, "reading the Vault secrets is retried, as they aren't watched")
+
+	r.vault = nil
+	err := r.validateTLSConfig(mdb)
+	assert.EqualError(t, err, "the operator isn't configured with the address of Vault, VAULT_ADDR must be set to read secret secret/mongodb/my-rs/tls")
+	_, ok = err.(terminalError)
+	assert.True(t, ok)
+}
+
+func TestMongoToolConnection_VaultTLS(t *testing.T) {
+	mdb := newVaultTLSReplicaSet()
+	_, options, modification := mongoToolConnection(mdb, "restore")
+	assert.Contains(t, options, "--sslCAFile /vault/secrets/ca.crt")
+
+	podTemplate := corev1.PodTemplateSpec{}
+	modification(&podTemplate)
+	assert.Empty(t, podTemplate.Spec.Volumes)
+	assert.Equal(t, "true", podTemplate.Annotations[vaultPrePopulateOnlyAnnotationKey], "the Jobs complete without the sidecar")
+	assert.Contains(t, podTemplate.Annotations, vaultTemplateAnnotationPrefix+"ca.crt")
+	assert.NotContains(t, podTemplate.Annotations, vaultTemplateAnnotationPrefix+"mongodb.pem", "only the CA certificate is written")
+}
+
+func TestReconcile_VaultUserPasswords(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Spec.Security.Vault = &mdbv1.Vault{Role: "my-rs"}
+	mdb.Spec.Users = []mdbv1.MongoDBUser{{
+		Name:             "app",
+		DB:               "admin",
+		PasswordVaultRef: &mdbv1.VaultSecretKeyReference{Path: "secret/mongodb/my-rs/app", Key: "pwd"},
+	}}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	reader := fakeVaultReader{myRSVaultLogin: {"secret/mongodb/my-rs/app": {"password": "s3cr3t"}}}
+	r.vault = reader
+
+	assert.EqualError(t, r.checkUserPasswordSecrets(mdb), `Vault secret secret/mongodb/my-rs/app should have the password of user app in field "pwd"`)
+	assert.Empty(t, referencedSecrets(mdb), "the Vault secrets aren't watched")
+
+	reader[myRSVaultLogin]["secret/mongodb/my-rs/app"]["pwd"] = "s3cr3t"
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	s, err := c.GetSecret(types.NamespacedName{Name: "my-rs-admin-app", Namespace: mdb.Namespace})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", string(s.Data["password"]))
+}
+
+func TestRender_Vault(t *testing.T) {
+	mdb := newVaultTLSReplicaSet()
+	mdb.Spec.Security.Authentication.Enabled = true
+	mdb.Spec.Users = []mdbv1.MongoDBUser{{Name: "app", PasswordVaultRef: &mdbv1.VaultSecretKeyReference{Path: "secret/mongodb/my-rs/app"}}}
+	objects, err := Render(mdb)
+	assert.NoError(t, err, "the Vault secrets don't need to exist")
+	for _, obj := range objects {
+		if s, ok := obj.(*corev1.Secret); ok {
+			assert.NotEqual(t, mdb.TLSOperatorSecretNamespacedName().Name, s.Name)
+		}
+	}
+}
+
+func TestReadVaultSecret_LogsInAsTheMembersOfTheNamespace(t *testing.T) {
+	mdb := newVaultTLSReplicaSet()
+	mdb.Namespace = "other-ns"
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.vault = newVaultTLSReader(t)
+
+	assert.Equal(t, vault.Login{Role: "my-rs", ServiceAccount: types.NamespacedName{Namespace: "other-ns", Name: "mongodb-kubernetes-operator"}}, vaultLogin(mdb))
+	_, err := r.readVaultSecret(mdb, "secret/mongodb/my-rs/tls")
+	assert.True(t, vault.IsNotFound(err), "the role of my-ns can't be used from another namespace")
+}
@@ -0,0 +1,155 @@
+package mongodb
+
+import (
+	"fmt"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	versionChangeBlockedEventReason = "VersionChangeBlocked"
+
+	// the reasons of the VersionChangeAllowed condition, one for each pre-flight check
+	versionNotInManifestReason  = "VersionNotInManifest"
+	incompatibleFCVReason       = "IncompatibleFeatureCompatibilityVersion"
+	insufficientDiskSpaceReason = "InsufficientDiskSpace"
+	membersUnhealthyReason      = "MembersUnhealthy"
+)
+
+// versionChangeBlocker is a pre-flight check of a version change which failed
+type versionChangeBlocker struct {
+	reason  string
+	message string
+	// isTransient is true if the check can pass without a change of the resource,
+	// in which case the version change starts as soon as it does
+	isTransient bool
+}
+
+// validateVersionChange runs the pre-flight checks and the pre-change hooks of a change of
+// spec.version before anything is changed for it. If a check fails, the VersionChangeAllowed
+// condition is set to false with the reason of the check and a Warning event is emitted. The phase is
+// set to Failed unless the check can pass without a change of the resource. It returns the failed
+// check, if any.
+func (r ReplicaSetReconciler) validateVersionChange(mdb mdbv1.MongoDB) (*versionChangeBlocker, error) {
+	blocker, err := r.versionChangePreflight(mdb)
+	if err != nil {
+		return nil, err
+	}
+	return blocker, r.updateVersionChangeAllowedCondition(mdb, blocker)
+}
+
+// updateVersionChangeAllowedCondition sets the VersionChangeAllowed condition from the failed check of
+// the version change, if any, and the phase to Failed if the check can't pass without a change of the
+// resource. A Warning event is emitted when a check starts failing.
+func (r ReplicaSetReconciler) updateVersionChangeAllowedCondition(mdb mdbv1.MongoDB, blocker *versionChangeBlocker) error {
+	condition := mdbv1.Condition{Type: mdbv1.VersionChangeAllowed, Status: corev1.ConditionTrue}
+	if blocker != nil {
+		condition = mdbv1.Condition{
+			Type:    mdbv1.VersionChangeAllowed,
+			Status:  corev1.ConditionFalse,
+			Reason:  blocker.reason,
+			Message: blocker.message,
+		}
+	}
+	isFailed := blocker != nil && !blocker.isTransient
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	previousCondition := newMdb.GetCondition(mdbv1.VersionChangeAllowed)
+	conditionChanged := previousCondition == nil || previousCondition.Status != condition.Status ||
+		previousCondition.Reason != condition.Reason || previousCondition.Message != condition.Message
+	if !conditionChanged && (!isFailed || newMdb.Status.Phase == mdbv1.Failed) {
+		return nil
+	}
+	newMdb.SetCondition(condition)
+	if isFailed {
+		newMdb.Status.Phase = mdbv1.Failed
+	}
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+
+	if blocker != nil && conditionChanged && r.recorder != nil {
+		r.recorder.Event(newMdb, corev1.EventTypeWarning, versionChangeBlockedEventReason, blocker.message)
+	}
+	return nil
+}
+
+// versionChangePreflight checks that a change of spec.version can start: the new version must be
+// in the version manifest, support the current featureCompatibilityVersion, and all the members must
+// have enough free space on their data volume and be healthy. The pre-change hooks are then run.
+// Nothing is checked once the version change has started, as it must then be completed, but a failed
+// post-change hook blocks it until the resource is changed.
+func (r ReplicaSetReconciler) versionChangePreflight(mdb mdbv1.MongoDB) (*versionChangeBlocker, error) {
+	if !isChangingVersion(mdb) {
+		return nil, nil
+	}
+	isStarted, err := r.isVersionChangeStarted(mdb)
+	if err != nil {
+		return nil, err
+	}
+	if isStarted {
+		return failedPostVersionChangeHook(mdb), nil
+	}
+
+	manifest, err := r.manifestProvider()
+	if err != nil {
+		return nil, fmt.Errorf("error reading version manifest: %s", err)
+	}
+	if len(manifest.BuildsForVersion(mdb.Spec.Version).Builds) == 0 {
+		return &versionChangeBlocker{
+			reason:  versionNotInManifestReason,
+			message: fmt.Sprintf("version %s isn't in the version manifest, use a custom version manifest which contains it", mdb.Spec.Version),
+		}, nil
+	}
+
+	currentAC, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return nil, fmt.Errorf("error reading automation config: %s", err)
+	}
+	for _, fcvBlocker := range []func(mdbv1.MongoDB, automationconfig.AutomationConfig) (string, error){versionDowngradeBlocker, versionUpgradeBlocker} {
+		message, err := fcvBlocker(mdb, currentAC)
+		if err != nil {
+			return nil, err
+		}
+		if message != "" {
+			return &versionChangeBlocker{reason: incompatibleFCVReason, message: message}, nil
+		}
+	}
+
+	if condition := dataVolumeUsageCondition(mdb.Status.Members, usageWarningThreshold(mdb)); condition.Status == corev1.ConditionFalse {
+		return &versionChangeBlocker{
+			reason:      insufficientDiskSpaceReason,
+			message:     fmt.Sprintf("%s, free some space or expand the volumes first", condition.Message),
+			isTransient: true,
+		}, nil
+	}
+
+	members, err := r.getMembersHealth(mdb, currentAC)
+	if err != nil {
+		return &versionChangeBlocker{
+			reason:      membersUnhealthyReason,
+			message:     fmt.Sprintf("the state of the members can't be read: %s", err),
+			isTransient: true,
+		}, nil
+	}
+	var unhealthy []string
+	for _, p := range currentAC.Processes {
+		if !members[p.Name].isHealthy {
+			unhealthy = append(unhealthy, p.Name)
+		}
+	}
+	if len(unhealthy) > 0 {
+		return &versionChangeBlocker{
+			reason:      membersUnhealthyReason,
+			message:     fmt.Sprintf("the members %s aren't healthy", strings.Join(unhealthy, ", ")),
+			isTransient: true,
+		}, nil
+	}
+	return runVersionChangeHooks(mdb, r.preVersionChangeHooks(mdb))
+}
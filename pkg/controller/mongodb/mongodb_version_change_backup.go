@@ -0,0 +1,207 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	versionChangeBackupCompletedEventReason = "VersionChangeBackupCompleted"
+
+	// the reasons of the VersionChangeAllowed condition while the backup is taken, and once it failed
+	versionChangeBackupRunningReason = "BackupBeforeVersionChange"
+	versionChangeBackupFailedReason  = "BackupBeforeVersionChangeFailed"
+)
+
+// backupBeforeVersionChange is the first pre-change hook, it takes a backup with the method and the
+// target of spec.backup before the version change starts, when spec.backup.beforeVersionChange is
+// set, and records it in status.versionChangeBackup. It returns a transient blocker until the backup
+// succeeds, and a blocker which isn't transient if it failed, in which case the backup is taken again
+// once the resource is changed.
+func (r *ReplicaSetReconciler) backupBeforeVersionChange(mdb mdbv1.MongoDB, change versionChange) (*versionChangeBlocker, error) {
+	if mdb.Spec.Backup == nil || !mdb.Spec.Backup.BeforeVersionChange {
+		return nil, nil
+	}
+	fromVersion, toVersion := change.fromVersion, change.toVersion
+	status := mdb.Status.VersionChangeBackup
+	if status == nil || status.FromVersion != fromVersion || status.ToVersion != toVersion ||
+		(status.Phase == mdbv1.BackupFailed && status.Generation != mdb.Generation) {
+		return r.startVersionChangeBackup(mdb, change)
+	}
+
+	switch status.Phase {
+	case mdbv1.BackupSucceeded:
+		return nil, nil
+	case mdbv1.BackupFailed:
+		return &versionChangeBlocker{
+			reason:  versionChangeBackupFailedReason,
+			message: fmt.Sprintf("the backup before the version change failed: %s, change the resource to take it again", status.Message),
+		}, nil
+	}
+
+	newStatus := *status
+	var ready bool
+	var failure string
+	var err error
+	if mdb.Spec.Backup.Method == mdbv1.BackupMethodSnapshot {
+		ready, failure, err = r.volumeSnapshotsReadiness(mdb, status.Snapshots)
+	} else {
+		ready, failure, err = r.versionChangeBackupJobState(mdb, status.Job)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if failure == "" && !ready {
+		return versionChangeBackupRunning(newStatus), nil
+	}
+
+	now := metav1.NewTime(r.now())
+	newStatus.CompletionTime = &now
+	if failure != "" {
+		newStatus.Phase, newStatus.Message = mdbv1.BackupFailed, failure
+		if err := r.setVersionChangeBackupStatus(mdb, &newStatus); err != nil {
+			return nil, err
+		}
+		return r.backupBeforeVersionChange(mdbWithVersionChangeBackup(mdb, newStatus), change)
+	}
+	newStatus.Phase = mdbv1.BackupSucceeded
+	if err := r.setVersionChangeBackupStatus(mdb, &newStatus); err != nil {
+		return nil, err
+	}
+	message := fmt.Sprintf("Took a backup of version %s before changing the version to %s", fromVersion, toVersion)
+	r.log.Info(message)
+	if r.recorder != nil {
+		r.recorder.Event(&mdb, corev1.EventTypeNormal, versionChangeBackupCompletedEventReason, message)
+	}
+	return nil, nil
+}
+
+// startVersionChangeBackup starts the backup of the version change, replacing the one of a previous
+// version change
+func (r *ReplicaSetReconciler) startVersionChangeBackup(mdb mdbv1.MongoDB, change versionChange) (*versionChangeBlocker, error) {
+	if previous := mdb.Status.VersionChangeBackup; previous != nil && previous.Job != "" {
+		job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: previous.Job, Namespace: mdb.Namespace}}
+		if err := r.client.Delete(context.TODO(), &job, k8sClient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("error deleting the backup Job of the previous version change: %s", err)
+		}
+	}
+
+	now := metav1.NewTime(r.now())
+	name := versionChangeBackupName(mdb, change.toVersion, now)
+	status := mdbv1.VersionChangeBackupStatus{
+		FromVersion: change.fromVersion,
+		ToVersion:   change.toVersion,
+		Phase:       mdbv1.BackupRunning,
+		StartTime:   &now,
+		Generation:  mdb.Generation,
+	}
+	if mdb.Spec.Backup.Method == mdbv1.BackupMethodSnapshot {
+		snapshots, err := r.takeVolumeSnapshots(mdb, name)
+		if err != nil {
+			status.Phase, status.Message, status.CompletionTime = mdbv1.BackupFailed, err.Error(), &now
+		}
+		status.Snapshots = snapshots
+	} else {
+		archiveName := name + ".archive.gz"
+		job := buildVersionChangeBackupJob(mdb, name, archiveName)
+		if err := r.client.Create(context.TODO(), &job); err != nil {
+			return nil, fmt.Errorf("error creating the backup Job of the version change: %s", err)
+		}
+		status.Job, status.Location = job.Name, backupLocation(mdb.Spec.Backup.Target, archiveName)
+		if usesPBM(mdb) {
+			// the backups of PBM are named by PBM, in the storage of the target
+			status.Location = s3BackupObject(*mdb.Spec.Backup.Target.S3, "")
+		}
+	}
+	if err := r.setVersionChangeBackupStatus(mdb, &status); err != nil {
+		return nil, err
+	}
+	if status.Phase == mdbv1.BackupFailed {
+		return r.backupBeforeVersionChange(mdbWithVersionChangeBackup(mdb, status), change)
+	}
+	r.log.Infof("Taking a backup of version %s before changing the version to %s", change.fromVersion, change.toVersion)
+	return versionChangeBackupRunning(status), nil
+}
+
+// versionChangeBackupJobState returns true once the backup Job succeeded, or why it failed
+func (r *ReplicaSetReconciler) versionChangeBackupJobState(mdb mdbv1.MongoDB, jobName string) (bool, string, error) {
+	job := batchv1.Job{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: jobName, Namespace: mdb.Namespace}, &job); err != nil {
+		if errors.IsNotFound(err) {
+			return false, fmt.Sprintf("the Job %s was deleted", jobName), nil
+		}
+		return false, "", fmt.Errorf("error getting backup Job: %s", err)
+	}
+	if job.Status.Succeeded > 0 {
+		return true, "", nil
+	}
+	message, _ := jobFailure(job)
+	return false, message, nil
+}
+
+func versionChangeBackupRunning(status mdbv1.VersionChangeBackupStatus) *versionChangeBlocker {
+	backup := "the Job " + status.Job
+	if len(status.Snapshots) > 0 {
+		backup = "the VolumeSnapshots " + strings.Join(status.Snapshots, ", ")
+	}
+	return &versionChangeBlocker{
+		reason:      versionChangeBackupRunningReason,
+		message:     fmt.Sprintf("taking a backup of version %s with %s first", status.FromVersion, backup),
+		isTransient: true,
+	}
+}
+
+func mdbWithVersionChangeBackup(mdb mdbv1.MongoDB, status mdbv1.VersionChangeBackupStatus) mdbv1.MongoDB {
+	mdb.Status.VersionChangeBackup = &status
+	return mdb
+}
+
+func (r *ReplicaSetReconciler) setVersionChangeBackupStatus(mdb mdbv1.MongoDB, status *mdbv1.VersionChangeBackupStatus) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	newMdb.Status.VersionChangeBackup = status
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
+
+// versionChangeBackupName is the name of the backup taken before changing the version to the given
+// one, the Job, the archive and the VolumeSnapshots of the backup are named after it
+func versionChangeBackupName(mdb mdbv1.MongoDB, toVersion string, startTime metav1.Time) string {
+	return strings.ToLower(fmt.Sprintf("%s-before-%s-%s", mdb.Name, toVersion, startTime.UTC().Format(scheduledBackupTimestampFmt)))
+}
+
+// buildVersionChangeBackupJob returns the Job taking the backup of the version change with mongodump,
+// or with PBM, owned by the resource
+func buildVersionChangeBackupJob(mdb mdbv1.MongoDB, name, archiveName string) batchv1.Job {
+	labels := map[string]string{"app": mdb.Name + "-version-change-backup"}
+	template := backupPodTemplate(mdb, mdb.Spec.Backup.Target, mdb.Spec.Backup.Encryption, archiveName, "", labels)
+	if usesPBM(mdb) {
+		template = pbmBackupPodTemplate(mdb, labels)
+	}
+	backoffLimit := int32(backupBackoffLimit)
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       mdb.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}
+}
@@ -0,0 +1,142 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// versionChangeBackupReplicaSet is a versionChangeRequestedReplicaSet which takes a backup with the
+// given method and target before changing its version
+func versionChangeBackupReplicaSet(t *testing.T, method mdbv1.BackupMethod, target mdbv1.BackupTarget) (*ReplicaSetReconciler, client.Client, mdbv1.MongoDB) {
+	r, c, mdb := versionChangeRequestedReplicaSet(t, "4.2.7")
+	r.now = func() time.Time { return time.Date(2026, 1, 3, 3, 0, 0, 0, time.UTC) }
+	mdb.Spec.Backup = &mdbv1.Backup{Schedule: "0 3 * * *", Method: method, Target: target, BeforeVersionChange: true}
+	_ = c.Update(context.TODO(), &mdb)
+	return r, c, mdb
+}
+
+func assertVersionChangeAllowedReason(t *testing.T, c client.Client, mdb mdbv1.MongoDB, reason string) {
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	condition := mdb.GetCondition(mdbv1.VersionChangeAllowed)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, reason, condition.Reason)
+	}
+}
+
+func TestVersionChange_TakesABackupFirst(t *testing.T) {
+	r, c, mdb := versionChangeBackupReplicaSet(t, mdbv1.BackupMethodMongodump, newBackupReplicaSet().Spec.Backup.Target)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assertVersionNotChanged(t, c, mdb)
+	assertVersionChangeAllowedReason(t, c, mdb, versionChangeBackupRunningReason)
+
+	job := batchv1.Job{}
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-before-4.2.7-20260103t030000z", Namespace: mdb.Namespace}, &job))
+	assert.Equal(t, mdb.Name, job.OwnerReferences[0].Name)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	backup := mdb.Status.VersionChangeBackup
+	if assert.NotNil(t, backup) {
+		assert.Equal(t, "4.0.6", backup.FromVersion)
+		assert.Equal(t, "4.2.7", backup.ToVersion)
+		assert.Equal(t, mdbv1.BackupRunning, backup.Phase)
+		assert.Equal(t, job.Name, backup.Job)
+		assert.Equal(t, "backups:/my-rs/my-rs-before-4.2.7-20260103t030000z.archive.gz", backup.Location)
+	}
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res, "the version change waits for the Job")
+	assertVersionNotChanged(t, c, mdb)
+
+	job.Status.Succeeded = 1
+	_ = c.Update(context.TODO(), &job)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	ac, _ := getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, []string{"4.0.6", "4.0.6", "4.2.7"}, processVersions(ac))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.BackupSucceeded, mdb.Status.VersionChangeBackup.Phase)
+	assert.NotNil(t, mdb.Status.VersionChangeBackup.CompletionTime)
+	assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.VersionChangeAllowed).Status)
+}
+
+func TestVersionChange_IsRefusedWhenTheBackupFails(t *testing.T) {
+	r, c, mdb := versionChangeBackupReplicaSet(t, mdbv1.BackupMethodMongodump, newBackupReplicaSet().Spec.Backup.Target)
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	job := batchv1.Job{}
+	_ = c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-before-4.2.7-20260103t030000z", Namespace: mdb.Namespace}, &job)
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}
+	_ = c.Update(context.TODO(), &job)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertVersionNotChanged(t, c, mdb)
+	assertVersionChangeAllowedReason(t, c, mdb, versionChangeBackupFailedReason)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Failed, mdb.Status.Phase)
+	assert.Equal(t, mdbv1.BackupFailed, mdb.Status.VersionChangeBackup.Phase)
+	assert.Equal(t, "Job my-rs-before-4.2.7-20260103t030000z failed: Job has reached the specified backoff limit", mdb.Status.VersionChangeBackup.Message)
+
+	t.Run("The backup is taken again once the resource is changed", func(t *testing.T) {
+		r.now = func() time.Time { return time.Date(2026, 1, 3, 4, 0, 0, 0, time.UTC) }
+		mdb.Generation++
+		_ = c.Update(context.TODO(), &mdb)
+		_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		assertVersionNotChanged(t, c, mdb)
+		assertVersionChangeAllowedReason(t, c, mdb, versionChangeBackupRunningReason)
+		assert.Error(t, c.Get(context.TODO(), types.NamespacedName{Name: job.Name, Namespace: mdb.Namespace}, &batchv1.Job{}), "the failed Job is deleted")
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-before-4.2.7-20260103t040000z", Namespace: mdb.Namespace}, &batchv1.Job{}))
+	})
+}
+
+func TestVersionChange_TakesVolumeSnapshotsFirst(t *testing.T) {
+	r, c, mdb := versionChangeBackupReplicaSet(t, mdbv1.BackupMethodSnapshot, newSnapshotBackupReplicaSet().Spec.Backup.Target)
+	mdb.Status.Members = []mdbv1.MemberStatus{{Name: "my-rs-1", State: livecluster.SecondaryState}}
+	_ = c.Status().Update(context.TODO(), &mdb)
+	var fsyncCalls []string
+	connectToReplicaSet := r.connectToLiveCluster
+	r.connectToLiveCluster = func(uri string, credential *livecluster.Credential, tlsConfig *tls.Config) (livecluster.Reader, error) {
+		if strings.HasSuffix(uri, "connect=direct") {
+			return mockLiveCluster{fsyncCalls: &fsyncCalls}, nil
+		}
+		return connectToReplicaSet(uri, credential, tlsConfig)
+	}
+	r.client = snapshotControllerClient{Client: r.client, status: map[string]interface{}{"creationTime": "2026-01-03T03:00:05Z"}}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertVersionNotChanged(t, c, mdb)
+	assertVersionChangeAllowedReason(t, c, mdb, versionChangeBackupRunningReason)
+	assert.Equal(t, []string{"lock", "unlock"}, fsyncCalls)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, []string{"my-rs-before-4.2.7-20260103t030000z-data-volume"}, mdb.Status.VersionChangeBackup.Snapshots)
+
+	snapshot, err := getVolumeSnapshot(c, mdb, "my-rs-before-4.2.7-20260103t030000z-data-volume")
+	assert.NoError(t, err)
+	_ = unstructured.SetNestedField(snapshot.Object, true, "status", "readyToUse")
+	_ = c.Update(context.TODO(), &snapshot)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	ac, _ := getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, []string{"4.0.6", "4.0.6", "4.2.7"}, processVersions(ac))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.BackupSucceeded, mdb.Status.VersionChangeBackup.Phase)
+}
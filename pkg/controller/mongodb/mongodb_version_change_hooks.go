@@ -0,0 +1,354 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	versionChangeHookSucceededEventReason = "VersionChangeHookSucceeded"
+
+	// the reasons of the VersionChangeAllowed condition while a hook of spec.versionChangeHooks
+	// runs, and once it failed
+	versionChangeHookRunningReason = "VersionChangeHookRunning"
+	versionChangeHookFailedReason  = "VersionChangeHookFailed"
+
+	versionChangeHookContainerName = "hook"
+
+	// the environment variables set by the operator in the container of the hooks of
+	// spec.versionChangeHooks, they are their contract with the operator
+	versionChangeStageEnv  = "VERSION_CHANGE_STAGE"
+	versionChangeFromEnv   = "VERSION_CHANGE_FROM"
+	versionChangeToEnv     = "VERSION_CHANGE_TO"
+	mongodbURIEnv          = "MONGODB_URI"
+	mongodbUsernameEnv     = "MONGODB_USERNAME"
+	mongodbCAFileEnv       = "MONGODB_CA_FILE"
+	mongodbShellOptionsEnv = "MONGODB_SHELL_OPTIONS"
+)
+
+// versionChange is a change of spec.version
+type versionChange struct {
+	fromVersion string
+	toVersion   string
+}
+
+// currentVersionChange returns the change from the version the replica set last ran to spec.version
+func currentVersionChange(mdb mdbv1.MongoDB) versionChange {
+	return versionChange{fromVersion: mdb.Annotations[lastVersionAnnotationKey], toVersion: mdb.Spec.Version}
+}
+
+// versionChangeHook is a step run in the sequence of a change of spec.version. The pre-change hooks
+// are run once the pre-flight checks passed, before any member is changed, and the post-change hooks
+// once all the members run the new version, before the version change is complete. The hooks of a
+// stage are run one after the other, a hook only runs once the ones before it succeeded.
+type versionChangeHook interface {
+	// run starts the hook for the version change, or checks the progress of the one already
+	// started. It returns nil once the hook succeeded, a transient blocker while it runs, and a
+	// blocker which isn't transient once it failed, until the resource is changed.
+	run(mdb mdbv1.MongoDB, change versionChange) (*versionChangeBlocker, error)
+}
+
+// versionChangeHookFunc adapts a function to the versionChangeHook interface
+type versionChangeHookFunc func(mdb mdbv1.MongoDB, change versionChange) (*versionChangeBlocker, error)
+
+func (f versionChangeHookFunc) run(mdb mdbv1.MongoDB, change versionChange) (*versionChangeBlocker, error) {
+	return f(mdb, change)
+}
+
+// preVersionChangeHooks returns the hooks run before any member is changed: the backup of
+// spec.backup.beforeVersionChange, then the hooks of spec.versionChangeHooks.pre
+func (r *ReplicaSetReconciler) preVersionChangeHooks(mdb mdbv1.MongoDB) []versionChangeHook {
+	hooks := []versionChangeHook{versionChangeHookFunc(r.backupBeforeVersionChange)}
+	if mdb.Spec.VersionChangeHooks != nil {
+		for _, hook := range mdb.Spec.VersionChangeHooks.Pre {
+			hooks = append(hooks, jobVersionChangeHook{r: r, stage: mdbv1.VersionChangeHookPre, hook: hook})
+		}
+	}
+	return hooks
+}
+
+// postVersionChangeHooks returns the hooks run once all the members run the new version: the hooks
+// of spec.versionChangeHooks.post
+func (r *ReplicaSetReconciler) postVersionChangeHooks(mdb mdbv1.MongoDB) []versionChangeHook {
+	var hooks []versionChangeHook
+	if mdb.Spec.VersionChangeHooks != nil {
+		for _, hook := range mdb.Spec.VersionChangeHooks.Post {
+			hooks = append(hooks, jobVersionChangeHook{r: r, stage: mdbv1.VersionChangeHookPost, hook: hook})
+		}
+	}
+	return hooks
+}
+
+// runVersionChangeHooks runs the hooks in order, it returns the blocker of the first one which
+// hasn't succeeded yet
+func runVersionChangeHooks(mdb mdbv1.MongoDB, hooks []versionChangeHook) (*versionChangeBlocker, error) {
+	change := currentVersionChange(mdb)
+	for _, hook := range hooks {
+		blocker, err := hook.run(mdb, change)
+		if err != nil || blocker != nil {
+			return blocker, err
+		}
+	}
+	return nil, nil
+}
+
+// postVersionChangeStep runs the post-change hooks once all the members run the new version. A
+// failed hook sets the VersionChangeAllowed condition to false and the phase to Failed, it is run
+// again once the resource is changed.
+func (r *ReplicaSetReconciler) postVersionChangeStep(mdb mdbv1.MongoDB) (*versionChangeBlocker, error) {
+	if !isChangingVersion(mdb) {
+		return nil, nil
+	}
+	blocker, err := runVersionChangeHooks(mdb, r.postVersionChangeHooks(mdb))
+	if err != nil || blocker == nil || blocker.isTransient {
+		return blocker, err
+	}
+	return blocker, r.updateVersionChangeAllowedCondition(mdb, blocker)
+}
+
+// failedPostVersionChangeHook returns the blocker of the post-change hook of the current version
+// change which failed, until the resource is changed
+func failedPostVersionChangeHook(mdb mdbv1.MongoDB) *versionChangeBlocker {
+	change := currentVersionChange(mdb)
+	for _, status := range mdb.Status.VersionChangeHooks {
+		if status.Stage == mdbv1.VersionChangeHookPost && status.Phase == mdbv1.VersionChangeHookFailed &&
+			status.FromVersion == change.fromVersion && status.ToVersion == change.toVersion && status.Generation == mdb.Generation {
+			return versionChangeHookFailed(status)
+		}
+	}
+	return nil
+}
+
+// jobVersionChangeHook is a hook of spec.versionChangeHooks, run with a Job owned by the resource
+type jobVersionChangeHook struct {
+	r     *ReplicaSetReconciler
+	stage mdbv1.VersionChangeHookStage
+	hook  mdbv1.VersionChangeHook
+}
+
+func (h jobVersionChangeHook) run(mdb mdbv1.MongoDB, change versionChange) (*versionChangeBlocker, error) {
+	newMdb, err := h.r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return nil, fmt.Errorf("error getting resource: %s", err)
+	}
+	status := findVersionChangeHookStatus(newMdb.Status.VersionChangeHooks, h.stage, h.hook.Name)
+	if status == nil || status.FromVersion != change.fromVersion || status.ToVersion != change.toVersion ||
+		(status.Phase == mdbv1.VersionChangeHookFailed && status.Generation != mdb.Generation) {
+		return h.start(mdb, change, status)
+	}
+
+	switch status.Phase {
+	case mdbv1.VersionChangeHookSucceeded:
+		return nil, nil
+	case mdbv1.VersionChangeHookFailed:
+		return versionChangeHookFailed(*status), nil
+	}
+
+	newStatus := *status
+	job := batchv1.Job{}
+	err = h.r.client.Get(context.TODO(), types.NamespacedName{Name: status.Job, Namespace: mdb.Namespace}, &job)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("error getting the Job of the version change hook %s: %s", h.hook.Name, err)
+	}
+	switch message, failed := jobFailure(job); {
+	case errors.IsNotFound(err):
+		newStatus.Phase, newStatus.Message = mdbv1.VersionChangeHookFailed, fmt.Sprintf("the Job %s was deleted", status.Job)
+	case failed:
+		newStatus.Phase, newStatus.Message = mdbv1.VersionChangeHookFailed, message
+	case job.Status.Succeeded > 0:
+		newStatus.Phase = mdbv1.VersionChangeHookSucceeded
+	default:
+		return versionChangeHookRunning(newStatus), nil
+	}
+	if err := h.r.setVersionChangeHookStatus(mdb, newStatus); err != nil {
+		return nil, err
+	}
+	if newStatus.Phase == mdbv1.VersionChangeHookFailed {
+		h.r.log.Warnf("The %s version change hook %s failed: %s", strings.ToLower(string(h.stage)), h.hook.Name, newStatus.Message)
+		return versionChangeHookFailed(newStatus), nil
+	}
+	message := fmt.Sprintf("The %s version change hook %s succeeded", strings.ToLower(string(h.stage)), h.hook.Name)
+	h.r.log.Info(message)
+	if h.r.recorder != nil {
+		h.r.recorder.Event(&mdb, corev1.EventTypeNormal, versionChangeHookSucceededEventReason, message)
+	}
+	return nil, nil
+}
+
+// start runs the hook for the version change with a new Job, replacing the one of a previous run
+func (h jobVersionChangeHook) start(mdb mdbv1.MongoDB, change versionChange, previous *mdbv1.VersionChangeHookStatus) (*versionChangeBlocker, error) {
+	if previous != nil && previous.Job != "" {
+		job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: previous.Job, Namespace: mdb.Namespace}}
+		if err := h.r.client.Delete(context.TODO(), &job, k8sClient.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("error deleting the previous Job of the version change hook %s: %s", h.hook.Name, err)
+		}
+	}
+
+	job := buildVersionChangeHookJob(mdb, h.stage, h.hook, change)
+	if err := h.r.client.Create(context.TODO(), &job); err != nil && !errors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("error creating the Job of the version change hook %s: %s", h.hook.Name, err)
+	}
+	status := mdbv1.VersionChangeHookStatus{
+		Name:        h.hook.Name,
+		Stage:       h.stage,
+		FromVersion: change.fromVersion,
+		ToVersion:   change.toVersion,
+		Phase:       mdbv1.VersionChangeHookRunning,
+		Job:         job.Name,
+		Generation:  mdb.Generation,
+	}
+	if err := h.r.setVersionChangeHookStatus(mdb, status); err != nil {
+		return nil, err
+	}
+	h.r.log.Infof("Running the %s version change hook %s with the Job %s", strings.ToLower(string(h.stage)), h.hook.Name, job.Name)
+	return versionChangeHookRunning(status), nil
+}
+
+func versionChangeHookRunning(status mdbv1.VersionChangeHookStatus) *versionChangeBlocker {
+	return &versionChangeBlocker{
+		reason:      versionChangeHookRunningReason,
+		message:     fmt.Sprintf("running the %s version change hook %s with the Job %s", strings.ToLower(string(status.Stage)), status.Name, status.Job),
+		isTransient: true,
+	}
+}
+
+func versionChangeHookFailed(status mdbv1.VersionChangeHookStatus) *versionChangeBlocker {
+	return &versionChangeBlocker{
+		reason:  versionChangeHookFailedReason,
+		message: fmt.Sprintf("the %s version change hook %s failed: %s, change the resource to run it again", strings.ToLower(string(status.Stage)), status.Name, status.Message),
+	}
+}
+
+func findVersionChangeHookStatus(statuses []mdbv1.VersionChangeHookStatus, stage mdbv1.VersionChangeHookStage, name string) *mdbv1.VersionChangeHookStatus {
+	for i := range statuses {
+		if statuses[i].Stage == stage && statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// setVersionChangeHookStatus sets the status of a hook of spec.versionChangeHooks, the statuses of
+// the hooks run for a previous version change are removed
+func (r *ReplicaSetReconciler) setVersionChangeHookStatus(mdb mdbv1.MongoDB, status mdbv1.VersionChangeHookStatus) error {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return fmt.Errorf("error getting resource: %s", err)
+	}
+	var statuses []mdbv1.VersionChangeHookStatus
+	for _, existing := range newMdb.Status.VersionChangeHooks {
+		isSameChange := existing.FromVersion == status.FromVersion && existing.ToVersion == status.ToVersion
+		if isSameChange && (existing.Stage != status.Stage || existing.Name != status.Name) {
+			statuses = append(statuses, existing)
+		}
+	}
+	newMdb.Status.VersionChangeHooks = append(statuses, status)
+	if err := r.writeStatus(newMdb); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
+
+// versionChangeHookJobName is the name of the Job running the hook for the generation of the
+// resource, so that a hook run again once the resource is changed doesn't wait for the previous Job
+// to be deleted
+func versionChangeHookJobName(mdb mdbv1.MongoDB, stage mdbv1.VersionChangeHookStage, hook mdbv1.VersionChangeHook) string {
+	return strings.ToLower(fmt.Sprintf("%s-%s-%s-%d", mdb.Name, stage, hook.Name, mdb.Generation))
+}
+
+// buildVersionChangeHookJob returns the Job running the hook, owned by the resource. The container
+// of the hook is given the version change and how to connect to the replica set as the agent in its
+// environment variables.
+func buildVersionChangeHookJob(mdb mdbv1.MongoDB, stage mdbv1.VersionChangeHookStage, hook mdbv1.VersionChangeHook, change versionChange) batchv1.Job {
+	image := hook.Image
+	if image == "" {
+		// the mongo shell of the version the replica set runs
+		version := change.fromVersion
+		if stage == mdbv1.VersionChangeHookPost {
+			version = change.toVersion
+		}
+		image = fmt.Sprintf("mongo:%s", version)
+	}
+
+	uri, options, connection := mongoToolConnection(mdb, versionChangeHookContainerName)
+	envs := []corev1.EnvVar{
+		{Name: versionChangeStageEnv, Value: string(stage)},
+		{Name: versionChangeFromEnv, Value: change.fromVersion},
+		{Name: versionChangeToEnv, Value: change.toVersion},
+		{Name: mongodbURIEnv, Value: uri},
+		{Name: mongodbShellOptionsEnv, Value: strings.TrimSpace(options)},
+	}
+	if mdb.Spec.Security.Authentication.Enabled {
+		envs = append(envs, corev1.EnvVar{Name: mongodbUsernameEnv, Value: scram.AgentName})
+	}
+	if mdb.Spec.Security.TLS.Enabled {
+		envs = append(envs, corev1.EnvVar{Name: mongodbCAFileEnv, Value: mongoToolCAFile(mdb)})
+	}
+
+	labels := map[string]string{"app": mdb.Name + "-version-change-hooks"}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		podtemplatespec.WithContainer(versionChangeHookContainerName, container.Apply(
+			container.WithName(versionChangeHookContainerName),
+			container.WithImage(image),
+			container.WithCommand(hook.Command),
+			container.WithArgs(hook.Args),
+			// the variables set by the operator can't be overridden
+			container.WithEnvs(hook.Env...),
+			container.WithEnvs(envs...),
+		)),
+		connection,
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	backoffLimit := hook.BackoffLimit
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            versionChangeHookJobName(mdb, stage, hook),
+			Namespace:       mdb.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{getOwnerReference(mdb)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: hook.ActiveDeadlineSeconds,
+			Template:              template,
+		},
+	}
+}
+
+func validateVersionChangeHooks(mdb mdbv1.MongoDB) error {
+	if mdb.Spec.VersionChangeHooks == nil {
+		return nil
+	}
+	for stage, hooks := range [][]mdbv1.VersionChangeHook{mdb.Spec.VersionChangeHooks.Pre, mdb.Spec.VersionChangeHooks.Post} {
+		field := [...]string{"pre", "post"}[stage]
+		names := map[string]bool{}
+		for _, hook := range hooks {
+			if hook.Name == "" {
+				return fmt.Errorf("the hooks of %s must have a name", field)
+			}
+			if names[hook.Name] {
+				return fmt.Errorf("the hooks of %s have the same name %s", field, hook.Name)
+			}
+			names[hook.Name] = true
+			if hook.Image == "" && len(hook.Command) == 0 {
+				return fmt.Errorf("the command of the hook %s of %s is required when its image isn't set", hook.Name, field)
+			}
+		}
+	}
+	return nil
+}
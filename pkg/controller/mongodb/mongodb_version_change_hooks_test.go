@@ -0,0 +1,183 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newVersionChangeHook(name string) mdbv1.VersionChangeHook {
+	return mdbv1.VersionChangeHook{Name: name, Command: []string{"/bin/sh", "-c", `mongo "$MONGODB_URI" $MONGODB_SHELL_OPTIONS check.js`}}
+}
+
+func getVersionChangeHookJob(t *testing.T, c client.Client, mdb mdbv1.MongoDB, name string) batchv1.Job {
+	job := batchv1.Job{}
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: mdb.Namespace}, &job))
+	return job
+}
+
+func failJob(t *testing.T, c client.Client, job batchv1.Job, message string) {
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: message}}
+	assert.NoError(t, c.Update(context.TODO(), &job))
+}
+
+func containerEnv(c corev1.Container) map[string]string {
+	env := map[string]string{}
+	for _, e := range c.Env {
+		env[e.Name] = e.Value
+	}
+	return env
+}
+
+func TestVersionChange_RunsThePreHooksFirst(t *testing.T) {
+	r, c, mdb := versionChangeRequestedReplicaSet(t, "4.2.7")
+	mdb.Spec.VersionChangeHooks = &mdbv1.VersionChangeHooks{Pre: []mdbv1.VersionChangeHook{newVersionChangeHook("check"), newVersionChangeHook("indexes")}}
+	_ = c.Update(context.TODO(), &mdb)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assertVersionNotChanged(t, c, mdb)
+	assertVersionChangeAllowedReason(t, c, mdb, versionChangeHookRunningReason)
+
+	job := getVersionChangeHookJob(t, c, mdb, "my-rs-pre-check-0")
+	assert.Equal(t, mdb.Name, job.OwnerReferences[0].Name)
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit, "the hooks may not be idempotent")
+	hookContainer := job.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "mongo:4.0.6", hookContainer.Image, "the pre-change hooks use the shell of the version the replica set runs")
+	env := containerEnv(hookContainer)
+	assert.Equal(t, "Pre", env[versionChangeStageEnv])
+	assert.Equal(t, "4.0.6", env[versionChangeFromEnv])
+	assert.Equal(t, "4.2.7", env[versionChangeToEnv])
+	assert.Equal(t, "mongodb://my-rs-0.my-rs-svc.my-ns.svc.cluster.local:27017,my-rs-1.my-rs-svc.my-ns.svc.cluster.local:27017,my-rs-2.my-rs-svc.my-ns.svc.cluster.local:27017/?replicaSet=my-rs", env[mongodbURIEnv])
+	assert.Error(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-pre-indexes-0", Namespace: mdb.Namespace}, &batchv1.Job{}), "the hooks run one after the other")
+
+	completeJob(t, c, job)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assertVersionNotChanged(t, c, mdb)
+	completeJob(t, c, getVersionChangeHookJob(t, c, mdb, "my-rs-pre-indexes-0"))
+
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	ac, _ := getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, []string{"4.0.6", "4.0.6", "4.2.7"}, processVersions(ac))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	if assert.Len(t, mdb.Status.VersionChangeHooks, 2) {
+		for _, status := range mdb.Status.VersionChangeHooks {
+			assert.Equal(t, mdbv1.VersionChangeHookSucceeded, status.Phase)
+			assert.Equal(t, mdbv1.VersionChangeHookPre, status.Stage)
+		}
+	}
+	assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.VersionChangeAllowed).Status)
+}
+
+func TestVersionChange_IsRefusedWhenAPreHookFails(t *testing.T) {
+	r, c, mdb := versionChangeRequestedReplicaSet(t, "4.2.7")
+	mdb.Spec.VersionChangeHooks = &mdbv1.VersionChangeHooks{Pre: []mdbv1.VersionChangeHook{newVersionChangeHook("check")}}
+	_ = c.Update(context.TODO(), &mdb)
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	failJob(t, c, getVersionChangeHookJob(t, c, mdb, "my-rs-pre-check-0"), "Job has reached the specified backoff limit")
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assertVersionNotChanged(t, c, mdb)
+	assertVersionChangeAllowedReason(t, c, mdb, versionChangeHookFailedReason)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Failed, mdb.Status.Phase)
+	assert.Equal(t, "Job my-rs-pre-check-0 failed: Job has reached the specified backoff limit", mdb.Status.VersionChangeHooks[0].Message)
+
+	t.Run("The hook is run again once the resource is changed", func(t *testing.T) {
+		mdb.Generation++
+		_ = c.Update(context.TODO(), &mdb)
+		_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		assertVersionNotChanged(t, c, mdb)
+		assertVersionChangeAllowedReason(t, c, mdb, versionChangeHookRunningReason)
+		assert.Error(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-pre-check-0", Namespace: mdb.Namespace}, &batchv1.Job{}), "the failed Job is deleted")
+		getVersionChangeHookJob(t, c, mdb, "my-rs-pre-check-1")
+	})
+}
+
+func TestPostVersionChangeStep(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Annotations = map[string]string{lastVersionAnnotationKey: "4.0.6"}
+	mdb.Spec.Version = "4.2.7"
+	mdb.Spec.VersionChangeHooks = &mdbv1.VersionChangeHooks{Post: []mdbv1.VersionChangeHook{{Name: "fcv", Image: "my-hook:1"}}}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider("4.0.6", "4.2.7"))
+
+	blocker, err := r.postVersionChangeStep(mdb)
+	assert.NoError(t, err)
+	if assert.NotNil(t, blocker) {
+		assert.True(t, blocker.isTransient)
+		assert.Equal(t, versionChangeHookRunningReason, blocker.reason)
+	}
+	job := getVersionChangeHookJob(t, c, mdb, "my-rs-post-fcv-0")
+	assert.Equal(t, "my-hook:1", job.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, "Post", containerEnv(job.Spec.Template.Spec.Containers[0])[versionChangeStageEnv])
+
+	failJob(t, c, job, "Job was active longer than specified deadline")
+	blocker, err = r.postVersionChangeStep(mdb)
+	assert.NoError(t, err)
+	if assert.NotNil(t, blocker) {
+		assert.False(t, blocker.isTransient)
+	}
+	assertVersionChangeAllowedReason(t, c, mdb, versionChangeHookFailedReason)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Failed, mdb.Status.Phase)
+	assert.NotNil(t, failedPostVersionChangeHook(mdb), "the version change is blocked until the resource is changed")
+	mdb.Generation++
+	assert.Nil(t, failedPostVersionChangeHook(mdb))
+
+	mdb.Annotations[lastVersionAnnotationKey] = mdb.Spec.Version
+	blocker, err = r.postVersionChangeStep(mdb)
+	assert.NoError(t, err)
+	assert.Nil(t, blocker, "the hooks are only run for a version change")
+}
+
+func TestBuildVersionChangeHookJob_Connection(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mdb.Spec.Security.Authentication.Enabled = true
+	hook := newVersionChangeHook("check")
+	hook.Env = []corev1.EnvVar{{Name: "DATABASE", Value: "app"}, {Name: versionChangeToEnv, Value: "overridden"}}
+	job := buildVersionChangeHookJob(mdb, mdbv1.VersionChangeHookPre, hook, versionChange{fromVersion: "4.0.6", toVersion: "4.2.7"})
+
+	hookContainer := job.Spec.Template.Spec.Containers[0]
+	env := containerEnv(hookContainer)
+	assert.Equal(t, "app", env["DATABASE"])
+	assert.Equal(t, "4.2.7", env[versionChangeToEnv], "the variables set by the operator can't be overridden")
+	assert.Equal(t, "mms-automation", env[mongodbUsernameEnv])
+	assert.Equal(t, "/tls/ca.crt", env[mongodbCAFileEnv])
+	assert.Contains(t, env[mongodbShellOptionsEnv], "--sslCAFile /tls/ca.crt")
+	assert.Contains(t, env, "AGENT_PASSWORD")
+	assert.Equal(t, hook.Command, hookContainer.Command)
+}
+
+func TestValidateVersionChangeHooks(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	assert.NoError(t, validateVersionChangeHooks(mdb))
+
+	mdb.Spec.VersionChangeHooks = &mdbv1.VersionChangeHooks{
+		Pre:  []mdbv1.VersionChangeHook{newVersionChangeHook("check")},
+		Post: []mdbv1.VersionChangeHook{newVersionChangeHook("check"), {Name: "custom", Image: "my-hook:1"}},
+	}
+	assert.NoError(t, validateVersionChangeHooks(mdb), "the hooks of each stage have their own names")
+
+	mdb.Spec.VersionChangeHooks.Post = append(mdb.Spec.VersionChangeHooks.Post, newVersionChangeHook("check"))
+	assert.EqualError(t, validateVersionChangeHooks(mdb), "the hooks of post have the same name check")
+
+	mdb.Spec.VersionChangeHooks.Post = []mdbv1.VersionChangeHook{{Name: "shell"}}
+	assert.EqualError(t, validateVersionChangeHooks(mdb), "the command of the hook shell of post is required when its image isn't set")
+}
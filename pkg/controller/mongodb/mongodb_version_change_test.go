@@ -0,0 +1,137 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// versionChangeRequestedReplicaSet reconciles a healthy replica set running 4.0.6, with a manifest
+// containing the given versions, then changes its version to 4.2.7
+func versionChangeRequestedReplicaSet(t *testing.T, manifestVersions ...string) (*ReplicaSetReconciler, client.Client, mdbv1.MongoDB) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Version = "4.0.6"
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(append([]string{mdb.Spec.Version}, manifestVersions...)...))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	primary := 0
+	withHealthyReplicaSet(t, r, c, mdb, &primary)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Version = "4.2.7"
+	_ = c.Update(context.TODO(), &mdb)
+	return r, c, mdb
+}
+
+func assertVersionNotChanged(t *testing.T, c client.Client, mdb mdbv1.MongoDB) {
+	ac, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4.0.6", "4.0.6", "4.0.6"}, processVersions(ac))
+}
+
+func TestVersionChange_IsRefusedForVersionNotInManifest(t *testing.T) {
+	r, c, mdb := versionChangeRequestedReplicaSet(t)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assertVersionNotChanged(t, c, mdb)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Failed, mdb.Status.Phase)
+	condition := mdb.GetCondition(mdbv1.VersionChangeAllowed)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, versionNotInManifestReason, condition.Reason)
+	}
+}
+
+func TestVersionChange_WaitsForHealthyMembers(t *testing.T) {
+	r, c, mdb := versionChangeRequestedReplicaSet(t, "4.2.7")
+	pod := corev1.Pod{}
+	_ = c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-1", Namespace: mdb.Namespace}, &pod)
+	pod.Annotations[agenthealth.MemberStatusAnnotationKey] = `{"lastGoalVersionAchieved":0,"isInGoalState":false}`
+	_ = c.Update(context.TODO(), &pod)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assertVersionNotChanged(t, c, mdb)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.NotEqual(t, mdbv1.Failed, mdb.Status.Phase, "the version change starts once the members are healthy")
+	condition := mdb.GetCondition(mdbv1.VersionChangeAllowed)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, membersUnhealthyReason, condition.Reason)
+		assert.Contains(t, condition.Message, "my-rs-1")
+	}
+
+	pod.Annotations[agenthealth.MemberStatusAnnotationKey] = `{"lastGoalVersionAchieved":1000,"isInGoalState":true}`
+	_ = c.Update(context.TODO(), &pod)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	ac, _ := getCurrentAutomationConfig(c, mdb)
+	assert.Equal(t, []string{"4.0.6", "4.0.6", "4.2.7"}, processVersions(ac))
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.VersionChangeAllowed).Status)
+}
+
+func TestVersionChange_WaitsForDiskSpace(t *testing.T) {
+	r, c, mdb := versionChangeRequestedReplicaSet(t, "4.2.7")
+	mdb.Status.Members = []mdbv1.MemberStatus{{Name: "my-rs-2", DataVolumeUsage: &mdbv1.VolumeUsage{UsedPercent: 95}}}
+	_ = c.Status().Update(context.TODO(), &mdb)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assertRequeued(t, res)
+	assertVersionNotChanged(t, c, mdb)
+
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	condition := mdb.GetCondition(mdbv1.VersionChangeAllowed)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, insufficientDiskSpaceReason, condition.Reason)
+		assert.Contains(t, condition.Message, "my-rs-2 uses 95% of its data volume")
+	}
+}
+
+func TestVersionUpgradeBlocker(t *testing.T) {
+	acWithFCV := func(fcv string) automationconfig.AutomationConfig {
+		return automationconfig.AutomationConfig{Processes: []automationconfig.Process{{Name: "my-rs-0", FeatureCompatibilityVersion: fcv}}}
+	}
+	mdbWithVersions := func(lastVersion, version string) mdbv1.MongoDB {
+		mdb := testutils.NewTestReplicaSet()
+		mdb.Annotations[lastVersionAnnotationKey] = lastVersion
+		mdb.Spec.Version = version
+		return mdb
+	}
+
+	tests := []struct {
+		name      string
+		mdb       mdbv1.MongoDB
+		fcv       string
+		isBlocked bool
+	}{
+		{name: "Downgrade", mdb: mdbWithVersions("4.2.2", "4.0.6"), fcv: "4.0"},
+		{name: "Patch upgrade", mdb: mdbWithVersions("4.2.2", "4.2.7"), fcv: "4.2"},
+		{name: "Upgrade", mdb: mdbWithVersions("4.0.6", "4.2.7"), fcv: "4.0"},
+		{name: "Upgrade with previous FCV", mdb: mdbWithVersions("4.2.7", "4.4.0"), fcv: "4.0", isBlocked: true},
+		{name: "Upgrade by two release series", mdb: mdbWithVersions("4.0.6", "4.4.0"), fcv: "4.0", isBlocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := versionUpgradeBlocker(tt.mdb, acWithFCV(tt.fcv))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.isBlocked, message != "")
+		})
+	}
+}
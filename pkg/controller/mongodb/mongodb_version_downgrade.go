@@ -0,0 +1,39 @@
+package mongodb
+
+import (
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/versions"
+)
+
+// versionDowngradeBlocker returns why spec.version can't be used with the featureCompatibilityVersion
+// of the current automation config and how to proceed, or an empty string if it can. Only downgrades
+// from the last configured version can be blocked.
+func versionDowngradeBlocker(mdb mdbv1.MongoDB, currentAC automationconfig.AutomationConfig) (string, error) {
+	lastVersion, ok := mdb.Annotations[lastVersionAnnotationKey]
+	if !ok || lastVersion == "" || len(currentAC.Processes) == 0 {
+		return "", nil
+	}
+	target, err := versions.Parse(mdb.Spec.Version)
+	if err != nil {
+		return "", err
+	}
+	previous, err := versions.Parse(lastVersion)
+	if err != nil {
+		return "", err
+	}
+	fcv := currentAC.Processes[0].FeatureCompatibilityVersion
+	if !target.LessThan(previous) || fcv == "" || automationconfig.SupportsFeatureCompatibilityVersion(target, fcv) {
+		return "", nil
+	}
+
+	if !automationconfig.SupportsFeatureCompatibilityVersion(previous, target.MajorMinor()) {
+		return fmt.Sprintf("MongoDB %s can't be downgraded to %s directly. Downgrade one release series at a time, "+
+			"setting spec.featureCompatibilityVersion to the release series you are downgrading to first", previous, target), nil
+	}
+	return fmt.Sprintf("the featureCompatibilityVersion is %s, which MongoDB %s doesn't support. Set spec.version back to \"%s\" "+
+		"and spec.featureCompatibilityVersion to \"%s\", wait for the resource to be Running, then set spec.version to \"%s\"",
+		fcv, target, lastVersion, target.MajorMinor(), mdb.Spec.Version), nil
+}
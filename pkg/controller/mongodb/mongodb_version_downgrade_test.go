@@ -0,0 +1,103 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestVersionDowngrade_IsBlockedByFCV(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version, "4.0.6"))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Version = "4.0.6"
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Failed, mdb.Status.Phase)
+	condition := mdb.GetCondition(mdbv1.VersionChangeAllowed)
+	assert.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, incompatibleFCVReason, condition.Reason)
+	assert.Contains(t, condition.Message, `spec.featureCompatibilityVersion to "4.0"`)
+
+	ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "4.2.2", p.Version, "the members are not downgraded")
+	}
+}
+
+func TestVersionDowngrade_IsAllowedOnceFCVIsLowered(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.FeatureCompatibilityVersion = "4.0"
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version, "4.0.6"))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	primary := 0
+	withHealthyReplicaSet(t, r, mgrClient, mdb, &primary)
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Version = "4.0.6"
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, corev1.ConditionTrue, mdb.GetCondition(mdbv1.VersionChangeAllowed).Status)
+	ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "4.0.6", p.Version)
+	}
+}
+
+func TestVersionDowngradeBlocker(t *testing.T) {
+	acWithFCV := func(fcv string) automationconfig.AutomationConfig {
+		return automationconfig.AutomationConfig{Processes: []automationconfig.Process{{Name: "my-rs-0", FeatureCompatibilityVersion: fcv}}}
+	}
+	mdbWithVersions := func(lastVersion, version string) mdbv1.MongoDB {
+		mdb := testutils.NewTestReplicaSet()
+		mdb.Annotations[lastVersionAnnotationKey] = lastVersion
+		mdb.Spec.Version = version
+		return mdb
+	}
+
+	tests := []struct {
+		name      string
+		mdb       mdbv1.MongoDB
+		fcv       string
+		isBlocked bool
+	}{
+		{name: "Upgrade", mdb: mdbWithVersions("4.0.6", "4.2.2"), fcv: "4.0"},
+		{name: "Patch downgrade", mdb: mdbWithVersions("4.2.2", "4.2.1"), fcv: "4.2"},
+		{name: "Downgrade with lowered FCV", mdb: mdbWithVersions("4.2.2", "4.0.6"), fcv: "4.0"},
+		{name: "Downgrade with current FCV", mdb: mdbWithVersions("4.2.2", "4.0.6"), fcv: "4.2", isBlocked: true},
+		{name: "Downgrade by two release series", mdb: mdbWithVersions("4.4.0", "4.0.6"), fcv: "4.2", isBlocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := versionDowngradeBlocker(tt.mdb, acWithFCV(tt.fcv))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.isBlocked, message != "")
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/versions"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const versionUpgradeEventReason = "VersionUpgrade"
+
+// memberHealth is the state of a member during a version upgrade
+type memberHealth struct {
+	// isHealthy is true if the member is a reachable primary or secondary, and its
+	// agent reached goal state for the current automation config
+	isHealthy bool
+	isPrimary bool
+	// optime is the time of the last operation applied by the member
+	optime time.Time
+}
+
+// versionUpgradeStep is the next step of a version upgrade
+type versionUpgradeStep struct {
+	// upgradedProcesses are the processes running, or starting to run, the new version
+	upgradedProcesses map[string]bool
+	// upgrading is the process which starts running the new version with this step, if any
+	upgrading string
+	// stepDown is the primary to step down before it is upgraded, if any
+	stepDown string
+	// isComplete is true once all the members run the new version and are healthy,
+	// at which point the featureCompatibilityVersion is updated
+	isComplete bool
+}
+
+// isUpgradingVersion returns true if spec.version has been changed to a later version
+// than the one last configured
+func isUpgradingVersion(mdb mdbv1.MongoDB) bool {
+	if !isChangingVersion(mdb) {
+		return false
+	}
+	target, err := versions.Parse(mdb.Spec.Version)
+	if err != nil {
+		return false
+	}
+	previous, err := versions.Parse(mdb.Annotations[lastVersionAnnotationKey])
+	if err != nil {
+		return false
+	}
+	return target.Compare(previous) > 0
+}
+
+// versionUpgradeBlocker returns why the upgrade to spec.version can't start with the
+// featureCompatibilityVersion of the current automation config and how to proceed, or an empty
+// string if it can. The new version must support the current featureCompatibilityVersion, which
+// requires upgrading one release series at a time.
+func versionUpgradeBlocker(mdb mdbv1.MongoDB, currentAC automationconfig.AutomationConfig) (string, error) {
+	if !isUpgradingVersion(mdb) || len(currentAC.Processes) == 0 {
+		return "", nil
+	}
+	lastVersion := mdb.Annotations[lastVersionAnnotationKey]
+	target, err := versions.Parse(mdb.Spec.Version)
+	if err != nil {
+		return "", err
+	}
+	previous, err := versions.Parse(lastVersion)
+	if err != nil {
+		return "", err
+	}
+	fcv := currentAC.Processes[0].FeatureCompatibilityVersion
+	if fcv == "" || automationconfig.SupportsFeatureCompatibilityVersion(target, fcv) {
+		return "", nil
+	}
+
+	if !automationconfig.SupportsFeatureCompatibilityVersion(target, previous.MajorMinor()) {
+		return fmt.Sprintf("MongoDB %s can't be upgraded to %s directly. Upgrade one release series at a time", previous, target), nil
+	}
+	return fmt.Sprintf("the featureCompatibilityVersion is %s, which MongoDB %s doesn't support. Set spec.version back to \"%s\" "+
+		"and spec.featureCompatibilityVersion to \"%s\", wait for the resource to be Running, then set spec.version to \"%s\"",
+		fcv, target, lastVersion, previous.MajorMinor(), mdb.Spec.Version), nil
+}
+
+// isVersionUpgradeComplete returns true if all the processes of the current automation config run
+// the version and the featureCompatibilityVersion of the resource, and all the members are healthy.
+func (r *ReplicaSetReconciler) isVersionUpgradeComplete(mdb mdbv1.MongoDB) (bool, error) {
+	ac, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return false, fmt.Errorf("error reading automation config: %s", err)
+	}
+	for _, p := range ac.Processes {
+		if p.Version != mdb.Spec.Version || p.FeatureCompatibilityVersion != mdb.GetFCV() {
+			return false, nil
+		}
+	}
+	members, err := r.getMembersHealth(mdb, ac)
+	if err != nil {
+		return false, err
+	}
+	return nextVersionUpgradeStep(ac.Processes, mdb.Spec.Version, members).isComplete, nil
+}
+
+// versionUpgradeModification upgrades the members one at a time when spec.version is increased.
+// The secondaries are upgraded first, the next one only once all members are healthy again, and
+// its upgrade is approved with spec.gatedRollout.
+// The primary is then stepped down and upgraded last, as a secondary. The featureCompatibilityVersion
+// is only updated once all the members run the new version. The processes not upgraded yet keep
+// running their current version.
+func (r *ReplicaSetReconciler) versionUpgradeModification(mdb mdbv1.MongoDB, currentAC automationconfig.AutomationConfig) (automationconfig.Modification, error) {
+	if !isUpgradingVersion(mdb) || len(currentAC.Processes) == 0 {
+		return automationconfig.NOOP(), nil
+	}
+
+	members, err := r.getMembersHealth(mdb, currentAC)
+	if err != nil {
+		return nil, err
+	}
+	step := nextVersionUpgradeStep(currentAC.Processes, mdb.Spec.Version, members)
+	if next := step.upgrading + step.stepDown; next != "" {
+		isStarted, err := r.startMemberUpdate(mdb, next)
+		if err != nil {
+			return nil, err
+		}
+		if !isStarted {
+			delete(step.upgradedProcesses, step.upgrading)
+			step.upgrading, step.stepDown = "", ""
+			return versionUpgradeStepModification(currentAC, step), nil
+		}
+	}
+
+	switch {
+	case step.upgrading != "":
+		r.log.Infof("Upgrading member %s to version %s", step.upgrading, mdb.Spec.Version)
+		r.recordVersionUpgradeEvent(mdb, "Upgrading member %s to version %s", step.upgrading, mdb.Spec.Version)
+	case step.stepDown != "":
+		if err := r.stepDownPrimary(mdb); err != nil {
+			return nil, err
+		}
+		r.log.Infof("Stepped down primary %s so that it is upgraded last", step.stepDown)
+		r.recordVersionUpgradeEvent(mdb, "Stepped down primary %s so that it is upgraded last", step.stepDown)
+	case step.isComplete && currentAC.Processes[0].FeatureCompatibilityVersion != mdb.GetFCV():
+		r.log.Infof("All members run version %s, setting featureCompatibilityVersion to %s", mdb.Spec.Version, mdb.GetFCV())
+		r.recordVersionUpgradeEvent(mdb, "All members run version %s, setting featureCompatibilityVersion to %s", mdb.Spec.Version, mdb.GetFCV())
+	case !step.isComplete:
+		r.log.Info("Waiting for all members to be healthy to continue the version upgrade")
+	}
+	return versionUpgradeStepModification(currentAC, step), nil
+}
+
+// nextVersionUpgradeStep returns the next step of the upgrade of the given processes to the version.
+// Nothing is upgraded while any member is unhealthy. The secondaries are upgraded starting with the
+// highest ordinal, like the Pods of a StatefulSet are updated.
+func nextVersionUpgradeStep(processes []automationconfig.Process, version string, members map[string]memberHealth) versionUpgradeStep {
+	step := versionUpgradeStep{upgradedProcesses: map[string]bool{}}
+	allHealthy := true
+	var pending []string
+	for _, p := range processes {
+		if !members[p.Name].isHealthy {
+			allHealthy = false
+		}
+		if p.Version == version {
+			step.upgradedProcesses[p.Name] = true
+			continue
+		}
+		pending = append(pending, p.Name)
+	}
+	if !allHealthy {
+		return step
+	}
+	if len(pending) == 0 {
+		step.isComplete = true
+		return step
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		if !members[pending[i]].isPrimary {
+			step.upgrading = pending[i]
+			step.upgradedProcesses[pending[i]] = true
+			return step
+		}
+	}
+	// only the primary is left
+	step.stepDown = pending[0]
+	return step
+}
+
+// versionUpgradeStepModification keeps the processes which are not upgraded on their current
+// version, and all of them on their current featureCompatibilityVersion until the upgrade is complete.
+func versionUpgradeStepModification(currentAC automationconfig.AutomationConfig, step versionUpgradeStep) automationconfig.Modification {
+	return func(ac *automationconfig.AutomationConfig) {
+		currentProcesses := map[string]automationconfig.Process{}
+		for _, p := range currentAC.Processes {
+			currentProcesses[p.Name] = p
+		}
+		previousFCV := currentAC.Processes[0].FeatureCompatibilityVersion
+
+		keptVersions := map[string]bool{}
+		for i, p := range ac.Processes {
+			if !step.isComplete {
+				ac.Processes[i].FeatureCompatibilityVersion = previousFCV
+			}
+			// members added during the upgrade start with the new version
+			current, ok := currentProcesses[p.Name]
+			if !ok || step.upgradedProcesses[p.Name] {
+				continue
+			}
+			ac.Processes[i].Version = current.Version
+			keptVersions[current.Version] = true
+		}
+
+		// the builds of the versions still in use must remain available to the agents
+		for _, v := range currentAC.Versions {
+			if keptVersions[v.Name] && !hasVersion(ac.Versions, v.Name) {
+				ac.Versions = append(ac.Versions, v)
+			}
+		}
+	}
+}
+
+func hasVersion(versionConfigs []automationconfig.MongoDbVersionConfig, name string) bool {
+	for _, v := range versionConfigs {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getMembersHealth returns the health of the members of the live replica set, by process name,
+// from its status and the agent status of their Pods.
+func (r *ReplicaSetReconciler) getMembersHealth(mdb mdbv1.MongoDB, currentAC automationconfig.AutomationConfig) (map[string]memberHealth, error) {
+	reader, err := r.connectLiveCluster(mdb)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+	defer cancel()
+	defer r.disconnectLiveCluster(ctx, reader)
+
+	liveMembers, err := reader.ReplicaSetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members := map[string]memberHealth{}
+	for _, m := range liveMembers {
+		name := processName(m.Name)
+		agentStatus, err := r.getAgentStatus(types.NamespacedName{Name: name, Namespace: mdb.Namespace})
+		if err != nil {
+			return nil, err
+		}
+		members[name] = memberHealth{
+			isHealthy: m.IsHealthy() && agentStatus.LastGoalVersionAchieved >= int64(currentAC.Version),
+			isPrimary: m.StateStr == livecluster.PrimaryState,
+			optime:    m.OptimeDate,
+		}
+	}
+	return members, nil
+}
+
+func (r *ReplicaSetReconciler) stepDownPrimary(mdb mdbv1.MongoDB) error {
+	reader, err := r.connectLiveCluster(mdb)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), liveClusterReadTimeout)
+	defer cancel()
+	defer r.disconnectLiveCluster(ctx, reader)
+
+	if err := reader.StepDown(ctx); err != nil {
+		return fmt.Errorf("error stepping down the primary: %s", err)
+	}
+	return nil
+}
+
+func (r *ReplicaSetReconciler) recordVersionUpgradeEvent(mdb mdbv1.MongoDB, messageFmt string, args ...interface{}) {
+	if r.recorder != nil {
+		r.recorder.Eventf(&mdb, corev1.EventTypeNormal, versionUpgradeEventReason, messageFmt, args...)
+	}
+}
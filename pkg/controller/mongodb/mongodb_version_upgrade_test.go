@@ -0,0 +1,190 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// mockReplicaSet is a live replica set whose members are the processes of the current
+// automation config, they are all healthy and the primary steps down to the next member.
+type mockReplicaSet struct {
+	mockLiveCluster
+	client  client.Client
+	mdb     mdbv1.MongoDB
+	primary *int
+}
+
+func (m mockReplicaSet) ReplicaSetStatus(_ context.Context) ([]livecluster.MemberStatus, error) {
+	ac, err := getCurrentAutomationConfig(m.client, m.mdb)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]livecluster.MemberStatus, len(ac.Processes))
+	for i, p := range ac.Processes {
+		members[i] = livecluster.MemberStatus{
+			Name:       fmt.Sprintf("%s.%s.%s.svc.cluster.local:27017", p.Name, m.mdb.ServiceName(), m.mdb.Namespace),
+			Health:     1,
+			StateStr:   livecluster.SecondaryState,
+			OptimeDate: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		}
+	}
+	if *m.primary < len(members) {
+		members[*m.primary].StateStr = livecluster.PrimaryState
+	}
+	return members, nil
+}
+
+func (m mockReplicaSet) StepDown(_ context.Context) error {
+	*m.primary = (*m.primary + 1) % m.mdb.Spec.Members
+	return nil
+}
+
+// withHealthyReplicaSet makes the reconciler connect to a healthy live replica set whose
+// primary is the member with the given index, and makes the agents of all members reach
+// goal state.
+func withHealthyReplicaSet(t *testing.T, r *ReplicaSetReconciler, c client.Client, mdb mdbv1.MongoDB, primary *int) {
+	r.connectToLiveCluster = func(_ string, _ *livecluster.Credential, _ *tls.Config) (livecluster.Reader, error) {
+		return mockReplicaSet{client: c, mdb: mdb, primary: primary}, nil
+	}
+	for i := 0; i < mdb.Spec.Members; i++ {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("%s-%d", mdb.Name, i),
+				Namespace:   mdb.Namespace,
+				Annotations: map[string]string{agenthealth.MemberStatusAnnotationKey: `{"lastGoalVersionAchieved":1000,"isInGoalState":true}`},
+			},
+		}
+		assert.NoError(t, c.Create(context.TODO(), &pod))
+	}
+}
+
+func processVersions(ac automationconfig.AutomationConfig) []string {
+	processVersions := make([]string, len(ac.Processes))
+	for i, p := range ac.Processes {
+		processVersions[i] = p.Version
+	}
+	return processVersions
+}
+
+func TestVersionUpgrade_UpgradesPrimaryLastAndFCVAtTheEnd(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Version = "4.0.6"
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version, "4.2.7"))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	primary := 1
+	withHealthyReplicaSet(t, r, mgrClient, mdb, &primary)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Version = "4.2.7"
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	// the Pods are replaced while the members are upgraded
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	sts.Status.UpdatedReplicas = 0
+	_ = mgrClient.Update(context.TODO(), &sts)
+
+	expectedSteps := []struct {
+		versions []string
+		fcv      string
+		primary  int
+	}{
+		{versions: []string{"4.0.6", "4.0.6", "4.2.7"}, fcv: "4.0", primary: 1},
+		{versions: []string{"4.2.7", "4.0.6", "4.2.7"}, fcv: "4.0", primary: 1},
+		// the primary is stepped down, and upgraded as a secondary
+		{versions: []string{"4.2.7", "4.0.6", "4.2.7"}, fcv: "4.0", primary: 2},
+		{versions: []string{"4.2.7", "4.2.7", "4.2.7"}, fcv: "4.0", primary: 2},
+		{versions: []string{"4.2.7", "4.2.7", "4.2.7"}, fcv: "4.2", primary: 2},
+	}
+	for i, expected := range expectedSteps {
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		assertRequeued(t, res, "step %d", i)
+
+		ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.versions, processVersions(ac), "step %d", i)
+		for _, p := range ac.Processes {
+			assert.Equal(t, expected.fcv, p.FeatureCompatibilityVersion, "step %d", i)
+		}
+		assert.Equal(t, expected.primary, primary, "step %d", i)
+	}
+
+	testutils.MakeStatefulSetReady(mgrClient, mdb)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, "4.2.7", mdb.Annotations[lastVersionAnnotationKey])
+}
+
+func TestNextVersionUpgradeStep(t *testing.T) {
+	processes := []automationconfig.Process{
+		{Name: "my-rs-0", Version: "4.0.6"},
+		{Name: "my-rs-1", Version: "4.0.6"},
+		{Name: "my-rs-2", Version: "4.2.7"},
+	}
+	healthy := map[string]memberHealth{
+		"my-rs-0": {isHealthy: true, isPrimary: true},
+		"my-rs-1": {isHealthy: true},
+		"my-rs-2": {isHealthy: true},
+	}
+
+	t.Run("Next secondary is upgraded", func(t *testing.T) {
+		step := nextVersionUpgradeStep(processes, "4.2.7", healthy)
+		assert.Equal(t, "my-rs-1", step.upgrading)
+		assert.Equal(t, map[string]bool{"my-rs-1": true, "my-rs-2": true}, step.upgradedProcesses)
+		assert.False(t, step.isComplete)
+	})
+
+	t.Run("Nothing is upgraded while a member is unhealthy", func(t *testing.T) {
+		members := map[string]memberHealth{
+			"my-rs-0": {isHealthy: true, isPrimary: true},
+			"my-rs-1": {isHealthy: true},
+			"my-rs-2": {isHealthy: false},
+		}
+		step := nextVersionUpgradeStep(processes, "4.2.7", members)
+		assert.Equal(t, "", step.upgrading)
+		assert.Equal(t, "", step.stepDown)
+		assert.Equal(t, map[string]bool{"my-rs-2": true}, step.upgradedProcesses)
+	})
+
+	t.Run("Primary is stepped down when it is the last member to upgrade", func(t *testing.T) {
+		processes := []automationconfig.Process{
+			{Name: "my-rs-0", Version: "4.0.6"},
+			{Name: "my-rs-1", Version: "4.2.7"},
+			{Name: "my-rs-2", Version: "4.2.7"},
+		}
+		step := nextVersionUpgradeStep(processes, "4.2.7", healthy)
+		assert.Equal(t, "my-rs-0", step.stepDown)
+		assert.Equal(t, "", step.upgrading)
+		assert.False(t, step.upgradedProcesses["my-rs-0"])
+	})
+
+	t.Run("Upgrade is complete when all members are upgraded and healthy", func(t *testing.T) {
+		processes := []automationconfig.Process{
+			{Name: "my-rs-0", Version: "4.2.7"},
+			{Name: "my-rs-1", Version: "4.2.7"},
+			{Name: "my-rs-2", Version: "4.2.7"},
+		}
+		assert.True(t, nextVersionUpgradeStep(processes, "4.2.7", healthy).isComplete)
+	})
+}
@@ -0,0 +1,176 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// volumeExpansion is a volume claim template whose size has been increased
+type volumeExpansion struct {
+	claimName string
+	size      resource.Quantity
+}
+
+// updateVolumeClaimTemplates applies the changes of the volume claim templates to the volumes
+// of the members. The volume claim templates of a StatefulSet can't be changed, so the
+// PersistentVolumeClaims of the members are updated first, and the StatefulSet is then deleted
+// without deleting its Pods, to be recreated with the new templates.
+func (r *ReplicaSetReconciler) updateVolumeClaimTemplates(mdb mdbv1.MongoDB) error {
+	currentSts := appsv1.StatefulSet{}
+	if err := r.client.Get(context.TODO(), mdb.NamespacedName(), &currentSts); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting StatefulSet: %s", err)
+	}
+	desiredSts := statefulset.New(buildStatefulSetModificationFunction(mdb))
+
+	isExpanded, err := r.expandVolumes(currentSts, desiredSts)
+	if err != nil {
+		return err
+	}
+	isMetadataUpdated, err := r.updateVolumeClaimMetadata(currentSts, desiredSts)
+	if err != nil {
+		return err
+	}
+	if !isExpanded && !isMetadataUpdated {
+		return nil
+	}
+
+	// the Pods are kept running and adopted by the StatefulSet once it has been recreated
+	if err := r.client.Delete(context.TODO(), &currentSts, k8sClient.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil {
+		return fmt.Errorf("error deleting StatefulSet to update its volume claim templates: %s", err)
+	}
+	return nil
+}
+
+// expandVolumes resizes the volumes of the members when the size of a volume claim template
+// has been increased, and returns true if any was. Kubernetes rejects the resize if the
+// StorageClass of a volume doesn't allow volume expansion, in which case the StatefulSet is
+// left unchanged.
+func (r *ReplicaSetReconciler) expandVolumes(currentSts, desiredSts appsv1.StatefulSet) (bool, error) {
+	expansions, err := volumeExpansions(currentSts, desiredSts)
+	if err != nil {
+		return false, err
+	}
+
+	for _, expansion := range expansions {
+		for i := 0; i < int(*currentSts.Spec.Replicas); i++ {
+			nsName := types.NamespacedName{Name: volumeClaimName(expansion.claimName, currentSts.Name, i), Namespace: currentSts.Namespace}
+			if err := r.resizeVolumeClaim(nsName, expansion.size); err != nil {
+				return false, err
+			}
+		}
+		r.log.Infof("Expanding volume %s to %s", expansion.claimName, expansion.size.String())
+	}
+	return len(expansions) > 0, nil
+}
+
+// volumeExpansions returns the volume claim templates of the current StatefulSet whose
+// size is increased in the desired StatefulSet. Volumes can't be shrunk.
+func volumeExpansions(current, desired appsv1.StatefulSet) ([]volumeExpansion, error) {
+	desiredSizes := map[string]resource.Quantity{}
+	for _, pvc := range desired.Spec.VolumeClaimTemplates {
+		desiredSizes[pvc.Name] = pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	}
+
+	var expansions []volumeExpansion
+	for _, pvc := range current.Spec.VolumeClaimTemplates {
+		desiredSize, ok := desiredSizes[pvc.Name]
+		if !ok {
+			continue
+		}
+		currentSize := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		switch desiredSize.Cmp(currentSize) {
+		case -1:
+			return nil, invalidSpec(fmt.Errorf("volume %s can't be shrunk from %s to %s", pvc.Name, currentSize.String(), desiredSize.String()))
+		case 1:
+			expansions = append(expansions, volumeExpansion{claimName: pvc.Name, size: desiredSize})
+		}
+	}
+	return expansions, nil
+}
+
+// resizeVolumeClaim requests the given size for the PersistentVolumeClaim. Members whose
+// PersistentVolumeClaim doesn't exist yet get it created from the new template.
+func (r *ReplicaSetReconciler) resizeVolumeClaim(nsName types.NamespacedName, size resource.Quantity) error {
+	pvc := corev1.PersistentVolumeClaim{}
+	if err := r.client.Get(context.TODO(), nsName, &pvc); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting PersistentVolumeClaim %s: %s", nsName, err)
+	}
+	currentSize := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if currentSize.Cmp(size) >= 0 {
+		return nil
+	}
+	if pvc.Spec.Resources.Requests == nil {
+		pvc.Spec.Resources.Requests = corev1.ResourceList{}
+	}
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+	if err := r.client.Update(context.TODO(), &pvc); err != nil {
+		return fmt.Errorf("error resizing PersistentVolumeClaim %s: %s", nsName, err)
+	}
+	return nil
+}
+
+// updateVolumeExpansionStatus updates status.volumeExpansions of the resource with the volumes
+// of the members whose capacity is lower than the requested size. It returns true if any
+// volume is still being expanded.
+func (r ReplicaSetReconciler) updateVolumeExpansionStatus(mdb mdbv1.MongoDB, sts appsv1.StatefulSet) (bool, error) {
+	var expansions []mdbv1.VolumeExpansionStatus
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		for i := 0; i < mdb.Spec.Members; i++ {
+			nsName := types.NamespacedName{Name: volumeClaimName(template.Name, sts.Name, i), Namespace: sts.Namespace}
+			pvc := corev1.PersistentVolumeClaim{}
+			if err := r.client.Get(context.TODO(), nsName, &pvc); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				return false, fmt.Errorf("error getting PersistentVolumeClaim %s: %s", nsName, err)
+			}
+			requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+			capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]
+			// volumes without a capacity are not bound yet, rather than being expanded
+			if !ok || capacity.Cmp(requested) >= 0 {
+				continue
+			}
+			expansions = append(expansions, mdbv1.VolumeExpansionStatus{
+				Name:          pvc.Name,
+				RequestedSize: requested.String(),
+				Capacity:      capacity.String(),
+			})
+		}
+	}
+
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
+		return false, fmt.Errorf("error getting resource: %s", err)
+	}
+	if reflect.DeepEqual(newMdb.Status.VolumeExpansions, expansions) {
+		return len(expansions) > 0, nil
+	}
+	newMdb.Status.VolumeExpansions = expansions
+	if err := r.writeStatus(newMdb); err != nil {
+		return false, fmt.Errorf("error updating status: %s", err)
+	}
+	return len(expansions) > 0, nil
+}
+
+// volumeClaimName returns the name of the PersistentVolumeClaim created by the StatefulSet
+// for the member with the given index
+func volumeClaimName(claimName, stsName string, index int) string {
+	return fmt.Sprintf("%s-%s-%d", claimName, stsName, index)
+}
@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func createDataVolumeClaims(t *testing.T, c client.Client, mdb mdbv1.MongoDB, size string) {
+	for i := 0; i < mdb.Spec.Members; i++ {
+		pvc := corev1.PersistentVolumeClaim{
+			// the StatefulSet labels the claims with its selector
+			ObjectMeta: metav1.ObjectMeta{Name: volumeClaimName(dataVolumeName, mdb.Name, i), Namespace: mdb.Namespace, Labels: map[string]string{"app": mdb.ServiceName()}},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+				},
+			},
+			Status: corev1.PersistentVolumeClaimStatus{
+				Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		}
+		assert.NoError(t, c.Create(context.TODO(), &pvc))
+	}
+}
+
+func TestVolumeExpansion(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.Data.Size = "10Gi"
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	createDataVolumeClaims(t, mgrClient, mdb, "10Gi")
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Storage.Data.Size = "20Gi"
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.True(t, res.RequeueAfter > 0, "reconciliation is requeued while volumes are expanded")
+
+	for i := 0; i < mdb.Spec.Members; i++ {
+		pvc := corev1.PersistentVolumeClaim{}
+		err := mgrClient.Get(context.TODO(), types.NamespacedName{Name: volumeClaimName(dataVolumeName, mdb.Name, i), Namespace: mdb.Namespace}, &pvc)
+		assert.NoError(t, err)
+		assert.Equal(t, resource.MustParse("20Gi"), pvc.Spec.Resources.Requests[corev1.ResourceStorage])
+	}
+
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, resource.MustParse("20Gi"), sts.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage])
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Len(t, mdb.Status.VolumeExpansions, 3)
+	assert.Equal(t, mdbv1.VolumeExpansionStatus{
+		Name:          fmt.Sprintf("%s-%s-0", dataVolumeName, mdb.Name),
+		RequestedSize: "20Gi",
+		Capacity:      "10Gi",
+	}, mdb.Status.VolumeExpansions[0])
+}
+
+func TestVolumeExpansion_VolumesCantBeShrunk(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.Data.Size = "10Gi"
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Storage.Data.Size = "5Gi"
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, resource.MustParse("10Gi"), sts.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage])
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Equal(t, mdbv1.Failed, mdb.Status.Phase)
+	assert.Equal(t, invalidSpecReason, mdb.GetCondition(mdbv1.ConfigurationValid).Reason)
+}
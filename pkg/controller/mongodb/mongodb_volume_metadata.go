@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// updateVolumeClaimMetadata applies the labels and annotations of the volume claim templates of the
+// desired StatefulSet to the existing PersistentVolumeClaims of the members, and returns true if
+// they changed. The labels and annotations removed from a template are removed from the
+// PersistentVolumeClaims, the ones added by other tools are kept.
+func (r *ReplicaSetReconciler) updateVolumeClaimMetadata(currentSts, desiredSts appsv1.StatefulSet) (bool, error) {
+	desiredTemplates := map[string]corev1.PersistentVolumeClaim{}
+	for _, template := range desiredSts.Spec.VolumeClaimTemplates {
+		desiredTemplates[template.Name] = template
+	}
+
+	isUpdated := false
+	for _, current := range currentSts.Spec.VolumeClaimTemplates {
+		desired, ok := desiredTemplates[current.Name]
+		if !ok {
+			continue
+		}
+		if stringMapsEqual(current.Labels, desired.Labels) && stringMapsEqual(current.Annotations, desired.Annotations) {
+			continue
+		}
+		for i := 0; i < int(*currentSts.Spec.Replicas); i++ {
+			nsName := types.NamespacedName{Name: volumeClaimName(current.Name, currentSts.Name, i), Namespace: currentSts.Namespace}
+			if err := r.updateVolumeClaimLabelsAndAnnotations(nsName, current, desired); err != nil {
+				return false, err
+			}
+		}
+		r.log.Infof("Updating the labels and annotations of volume %s", current.Name)
+		isUpdated = true
+	}
+	return isUpdated, nil
+}
+
+// updateVolumeClaimLabelsAndAnnotations applies the changes between the current and the desired
+// template to the labels and annotations of the PersistentVolumeClaim. Members whose
+// PersistentVolumeClaim doesn't exist yet get it created from the new template.
+func (r *ReplicaSetReconciler) updateVolumeClaimLabelsAndAnnotations(nsName types.NamespacedName, current, desired corev1.PersistentVolumeClaim) error {
+	pvc := corev1.PersistentVolumeClaim{}
+	if err := r.client.Get(context.TODO(), nsName, &pvc); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting PersistentVolumeClaim %s: %s", nsName, err)
+	}
+	labels := mergeStringMaps(pvc.Labels, current.Labels, desired.Labels)
+	annotations := mergeStringMaps(pvc.Annotations, current.Annotations, desired.Annotations)
+	if stringMapsEqual(pvc.Labels, labels) && stringMapsEqual(pvc.Annotations, annotations) {
+		return nil
+	}
+	original := pvc.DeepCopy()
+	pvc.Labels = labels
+	pvc.Annotations = annotations
+	if err := r.client.MergePatch(original, &pvc); err != nil {
+		return fmt.Errorf("error updating labels and annotations of PersistentVolumeClaim %s: %s", nsName, err)
+	}
+	return nil
+}
+
+// mergeStringMaps returns the existing entries without the ones of previous which are not in
+// desired, with the entries of desired on top.
+func mergeStringMaps(existing, previous, desired map[string]string) map[string]string {
+	merged := map[string]string{}
+	for key, val := range existing {
+		if _, wasManaged := previous[key]; wasManaged {
+			if _, isDesired := desired[key]; !isDesired {
+				continue
+			}
+		}
+		merged[key] = val
+	}
+	for key, val := range desired {
+		merged[key] = val
+	}
+	return merged
+}
+
+// stringMapsEqual returns true if both maps have the same entries, nil and empty maps are equal
+func stringMapsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, val := range a {
+		if otherVal, ok := b[key]; !ok || otherVal != val {
+			return false
+		}
+	}
+	return true
+}
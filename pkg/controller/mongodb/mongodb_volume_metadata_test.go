@@ -0,0 +1,74 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestVolumeClaimMetadata(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.Data.Labels = map[string]string{"backup": "daily"}
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"backup": "daily"}, sts.Spec.VolumeClaimTemplates[0].Labels)
+
+	createDataVolumeClaims(t, mgrClient, mdb, "10G")
+	pvcName := types.NamespacedName{Name: volumeClaimName(dataVolumeName, mdb.Name, 0), Namespace: mdb.Namespace}
+	pvc := corev1.PersistentVolumeClaim{}
+	_ = mgrClient.Get(context.TODO(), pvcName, &pvc)
+	pvc.Labels = map[string]string{"backup": "daily", "other": "tool"}
+	_ = mgrClient.Update(context.TODO(), &pvc)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Storage.Data.Labels = map[string]string{"cost-center": "db"}
+	mdb.Spec.Storage.Data.Annotations = map[string]string{"owner": "team"}
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	t.Run("Existing PersistentVolumeClaims are updated", func(t *testing.T) {
+		for i := 0; i < mdb.Spec.Members; i++ {
+			pvc := corev1.PersistentVolumeClaim{}
+			err := mgrClient.Get(context.TODO(), types.NamespacedName{Name: volumeClaimName(dataVolumeName, mdb.Name, i), Namespace: mdb.Namespace}, &pvc)
+			assert.NoError(t, err)
+			assert.Equal(t, "db", pvc.Labels["cost-center"])
+			assert.NotContains(t, pvc.Labels, "backup", "labels removed from the template are removed")
+			assert.Equal(t, map[string]string{"owner": "team"}, pvc.Annotations)
+		}
+	})
+
+	t.Run("Labels added by other tools are kept", func(t *testing.T) {
+		pvc := corev1.PersistentVolumeClaim{}
+		_ = mgrClient.Get(context.TODO(), pvcName, &pvc)
+		assert.Equal(t, map[string]string{"cost-center": "db", "other": "tool"}, pvc.Labels)
+	})
+
+	t.Run("StatefulSet is recreated with the new template", func(t *testing.T) {
+		sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"cost-center": "db"}, sts.Spec.VolumeClaimTemplates[0].Labels)
+		assert.Equal(t, map[string]string{"owner": "team"}, sts.Spec.VolumeClaimTemplates[0].Annotations)
+	})
+}
+
+func TestMergeStringMaps(t *testing.T) {
+	existing := map[string]string{"a": "1", "b": "2", "c": "3"}
+	previous := map[string]string{"a": "1", "b": "2"}
+	desired := map[string]string{"a": "10", "d": "4"}
+	assert.Equal(t, map[string]string{"a": "10", "c": "3", "d": "4"}, mergeStringMaps(existing, previous, desired))
+	assert.Equal(t, map[string]string{}, mergeStringMaps(nil, nil, nil))
+}
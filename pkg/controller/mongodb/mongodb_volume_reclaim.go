@@ -0,0 +1,94 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// orphanedVolumeLabelKey labels the PersistentVolumeClaims of the members removed on scale-down
+// when the LabelVolumes reclaim policy is used, e.g. to be selected by a cleanup job.
+const orphanedVolumeLabelKey = "mongodb.com/v1.orphaned"
+
+// reclaimVolumes applies the reclaim policy to the PersistentVolumeClaims of the members
+// removed on scale-down. It must be called once the StatefulSet is ready, so that the Pods
+// of the removed members don't use the volumes anymore.
+func (r ReplicaSetReconciler) reclaimVolumes(mdb mdbv1.MongoDB, sts appsv1.StatefulSet) error {
+	policy := mdb.Spec.Storage.ReclaimPolicy
+	if policy == "" || policy == mdbv1.RetainVolumes {
+		return nil
+	}
+
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		if policy == mdbv1.LabelVolumes {
+			// volumes of members added back on scale-up are in use again
+			for i := 0; i < mdb.Spec.Members; i++ {
+				nsName := types.NamespacedName{Name: volumeClaimName(template.Name, sts.Name, i), Namespace: sts.Namespace}
+				if err := r.setOrphanedLabel(nsName, false); err != nil && !errors.IsNotFound(err) {
+					return err
+				}
+			}
+		}
+
+		// the ordinals of a StatefulSet are contiguous, so the volumes of the removed
+		// members are the ones following the last member until one doesn't exist.
+		for i := mdb.Spec.Members; ; i++ {
+			nsName := types.NamespacedName{Name: volumeClaimName(template.Name, sts.Name, i), Namespace: sts.Namespace}
+			var err error
+			if policy == mdbv1.DeleteVolumes {
+				err = r.deleteVolumeClaim(nsName)
+			} else {
+				err = r.setOrphanedLabel(nsName, true)
+			}
+			if errors.IsNotFound(err) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r ReplicaSetReconciler) deleteVolumeClaim(nsName types.NamespacedName) error {
+	pvc := corev1.PersistentVolumeClaim{}
+	if err := r.client.Get(context.TODO(), nsName, &pvc); err != nil {
+		return err
+	}
+	if err := r.client.Delete(context.TODO(), &pvc); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting PersistentVolumeClaim %s: %s", nsName, err)
+	}
+	r.log.Infof("Deleted PersistentVolumeClaim %s", nsName)
+	return nil
+}
+
+// setOrphanedLabel adds or removes the orphaned label of the PersistentVolumeClaim. The
+// NotFound error is returned as is if the PersistentVolumeClaim doesn't exist.
+func (r ReplicaSetReconciler) setOrphanedLabel(nsName types.NamespacedName, orphaned bool) error {
+	pvc := corev1.PersistentVolumeClaim{}
+	if err := r.client.Get(context.TODO(), nsName, &pvc); err != nil {
+		return err
+	}
+	_, isLabeled := pvc.Labels[orphanedVolumeLabelKey]
+	if isLabeled == orphaned {
+		return nil
+	}
+	if orphaned {
+		if pvc.Labels == nil {
+			pvc.Labels = map[string]string{}
+		}
+		pvc.Labels[orphanedVolumeLabelKey] = trueAnnotation
+	} else {
+		delete(pvc.Labels, orphanedVolumeLabelKey)
+	}
+	if err := r.client.Update(context.TODO(), &pvc); err != nil {
+		return fmt.Errorf("error updating labels of PersistentVolumeClaim %s: %s", nsName, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// scaleDown reconciles the resource with 3 members and volumes, then scales it down to one member
+func scaleDown(t *testing.T, policy mdbv1.VolumeReclaimPolicy) (mdbv1.MongoDB, client.Client) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.ReclaimPolicy = policy
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	createDataVolumeClaims(t, mgrClient, mdb, "10G")
+
+	primary := 0
+	withHealthyReplicaSet(t, r, mgrClient, mdb, &primary)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.Members = 1
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	// the members are removed one at a time
+	for i := 0; i < 10; i++ {
+		res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		testutils.MakeStatefulSetReady(mgrClient, mdb)
+		if res == (reconcile.Result{}) {
+			break
+		}
+	}
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	return mdb, mgrClient
+}
+
+func getDataVolumeClaim(c client.Client, mdb mdbv1.MongoDB, index int) (corev1.PersistentVolumeClaim, error) {
+	pvc := corev1.PersistentVolumeClaim{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: volumeClaimName(dataVolumeName, mdb.Name, index), Namespace: mdb.Namespace}, &pvc)
+	return pvc, err
+}
+
+func TestReclaimVolumes(t *testing.T) {
+	t.Run("Volumes are retained by default", func(t *testing.T) {
+		mdb, c := scaleDown(t, "")
+		for i := 0; i < 3; i++ {
+			pvc, err := getDataVolumeClaim(c, mdb, i)
+			assert.NoError(t, err)
+			assert.NotContains(t, pvc.Labels, orphanedVolumeLabelKey)
+		}
+	})
+
+	t.Run("Volumes of removed members are deleted", func(t *testing.T) {
+		mdb, c := scaleDown(t, mdbv1.DeleteVolumes)
+		_, err := getDataVolumeClaim(c, mdb, 0)
+		assert.NoError(t, err)
+		for i := 1; i < 3; i++ {
+			_, err := getDataVolumeClaim(c, mdb, i)
+			assert.True(t, errors.IsNotFound(err))
+		}
+	})
+
+	t.Run("Volumes of removed members are labeled", func(t *testing.T) {
+		mdb, c := scaleDown(t, mdbv1.LabelVolumes)
+		pvc, err := getDataVolumeClaim(c, mdb, 0)
+		assert.NoError(t, err)
+		assert.NotContains(t, pvc.Labels, orphanedVolumeLabelKey)
+		for i := 1; i < 3; i++ {
+			pvc, err := getDataVolumeClaim(c, mdb, i)
+			assert.NoError(t, err)
+			assert.Equal(t, "true", pvc.Labels[orphanedVolumeLabelKey])
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const memberVolumeRecoveredEventReason = "MemberVolumeRecovered"
+
+// recoverLostVolumes replaces the volumes of a member which can't be used anymore, because their
+// PersistentVolume was deleted, or because they are bound to a node which doesn't exist anymore,
+// e.g. a node with local storage which died, or, if spec.storage.unschedulableVolumeTimeout is set, to
+// nodes which have all been removed or not ready for longer. The PersistentVolumeClaim and the Pod of
+// the member are deleted, so that the StatefulSet recreates them with a new, empty volume, and the member
+// resyncs its data from the other members.
+// Only one member is recovered at a time, and only while a majority of the other members is ready
+// so that the data can be resynced.
+func (r ReplicaSetReconciler) recoverLostVolumes(mdb mdbv1.MongoDB, sts appsv1.StatefulSet) error {
+	for i := 0; i < mdb.Spec.Members; i++ {
+		podName := types.NamespacedName{Name: fmt.Sprintf("%s-%d", sts.Name, i), Namespace: sts.Namespace}
+		pod, err := r.getPod(podName)
+		if err != nil {
+			return err
+		}
+		for _, template := range sts.Spec.VolumeClaimTemplates {
+			nsName := types.NamespacedName{Name: volumeClaimName(template.Name, sts.Name, i), Namespace: sts.Namespace}
+			pvc := corev1.PersistentVolumeClaim{}
+			if err := r.client.Get(context.TODO(), nsName, &pvc); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				return fmt.Errorf("error getting PersistentVolumeClaim %s: %s", nsName, err)
+			}
+
+			reason, err := r.lostVolumeReason(mdb, pvc, pod)
+			if err != nil {
+				return err
+			}
+			if reason == "" {
+				continue
+			}
+
+			canRecover, err := r.canRecoverMember(mdb, sts, i)
+			if err != nil {
+				return err
+			}
+			if !canRecover {
+				r.log.Warnf("The volume %s of member %s is lost because %s, but it can't be recovered until a majority of the other members is ready", nsName.Name, podName.Name, reason)
+				return nil
+			}
+			return r.recoverMember(mdb, pvc, pod, reason)
+		}
+	}
+	return nil
+}
+
+// lostVolumeReason returns why the PersistentVolumeClaim can't be used anymore by the Pod,
+// or an empty string if it can.
+func (r ReplicaSetReconciler) lostVolumeReason(mdb mdbv1.MongoDB, pvc corev1.PersistentVolumeClaim, pod *corev1.Pod) (string, error) {
+	if pvc.Status.Phase == corev1.ClaimLost {
+		return "its PersistentVolume doesn't exist anymore", nil
+	}
+
+	unschedulable := unschedulableCondition(pod)
+	if unschedulable == nil || !strings.Contains(unschedulable.Message, volumeNodeAffinityConflictMessage) {
+		return "", nil
+	}
+	if nodeName, ok := pvc.Annotations[selectedNodeAnnotationKey]; ok {
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: nodeName}, &corev1.Node{})
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("the node %s it is bound to doesn't exist anymore", nodeName), nil
+		}
+		if errors.IsForbidden(err) {
+			// reading nodes requires cluster wide permissions, which are optional
+			r.log.Debugf("Not allowed to check if node %s exists: %s", nodeName, err)
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("error getting node %s: %s", nodeName, err)
+		}
+	}
+	return r.unschedulableVolumeReason(mdb, pvc, *unschedulable)
+}
+
+// unschedulableVolumeReason returns why the PersistentVolumeClaim can't be used anymore if the Pod
+// couldn't be scheduled because of the node affinity of its PersistentVolume for longer than
+// spec.storage.unschedulableVolumeTimeout, and none of the nodes the volume can be attached to
+// exists and is ready, e.g. because the zone of the volume has no node left. Recreating the volume
+// lets the Pod be scheduled in another node or zone, instead of waiting forever. The Pod is waited
+// for while one of these nodes is ready, even if it is cordoned or tainted, as the node is then only
+// under maintenance or missing capacity, and its volume must be kept.
+func (r ReplicaSetReconciler) unschedulableVolumeReason(mdb mdbv1.MongoDB, pvc corev1.PersistentVolumeClaim, unschedulable corev1.PodCondition) (string, error) {
+	timeout := unschedulableVolumeTimeout(mdb)
+	if timeout == 0 || time.Since(unschedulable.LastTransitionTime.Time) < timeout || pvc.Spec.VolumeName == "" {
+		return "", nil
+	}
+
+	pv := corev1.PersistentVolume{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: pvc.Spec.VolumeName}, &pv); err != nil {
+		if errors.IsForbidden(err) {
+			r.log.Debugf("Not allowed to read PersistentVolume %s: %s", pvc.Spec.VolumeName, err)
+			return "", nil
+		}
+		return "", fmt.Errorf("error getting PersistentVolume %s: %s", pvc.Spec.VolumeName, err)
+	}
+	nodes := corev1.NodeList{}
+	if err := r.client.List(context.TODO(), &nodes); err != nil {
+		if errors.IsForbidden(err) {
+			r.log.Debugf("Not allowed to list nodes: %s", err)
+			return "", nil
+		}
+		return "", fmt.Errorf("error listing nodes: %s", err)
+	}
+	for _, node := range nodes.Items {
+		attachable, err := volumeCanBeAttached(pv, node)
+		if err != nil {
+			return "", err
+		}
+		if attachable && isNodeReady(node) {
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("no node its PersistentVolume %s can be attached to has been ready for %s", pv.Name, timeout), nil
+}
+
+// unschedulableVolumeTimeout returns how long the Pod of a member can't be scheduled because of
+// its volumes before they are recreated, 0 if they must not be, which is the default as the data of
+// the member is deleted.
+func unschedulableVolumeTimeout(mdb mdbv1.MongoDB) time.Duration {
+	if mdb.Spec.Storage.UnschedulableVolumeTimeout == nil {
+		return 0
+	}
+	return mdb.Spec.Storage.UnschedulableVolumeTimeout.Duration
+}
+
+// volumeCanBeAttached returns true if the node satisfies the node affinity of the PersistentVolume,
+// e.g. the node of a local volume or the zone of a zonal disk.
+func volumeCanBeAttached(pv corev1.PersistentVolume, node corev1.Node) (bool, error) {
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return true, nil
+	}
+	// the terms are ORed, the requirements of a term are ANDed
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		matches, err := nodeMatchesTerm(node, term)
+		if err != nil {
+			return false, fmt.Errorf("invalid node affinity of PersistentVolume %s: %s", pv.Name, err)
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+var nodeSelectorOperators = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+func nodeMatchesTerm(node corev1.Node, term corev1.NodeSelectorTerm) (bool, error) {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false, nil
+	}
+	selector := labels.NewSelector()
+	for _, expression := range term.MatchExpressions {
+		requirement, err := labels.NewRequirement(expression.Key, nodeSelectorOperators[expression.Operator], expression.Values)
+		if err != nil {
+			return false, err
+		}
+		selector = selector.Add(*requirement)
+	}
+	if !selector.Matches(labels.Set(node.Labels)) {
+		return false, nil
+	}
+	// metadata.name is the only field nodes can be selected with
+	for _, field := range term.MatchFields {
+		if field.Key != "metadata.name" {
+			return false, fmt.Errorf("unsupported field %s", field.Key)
+		}
+		named := false
+		for _, value := range field.Values {
+			named = named || value == node.Name
+		}
+		switch field.Operator {
+		case corev1.NodeSelectorOpIn:
+			if !named {
+				return false, nil
+			}
+		case corev1.NodeSelectorOpNotIn:
+			if named {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("unsupported operator %s for field %s", field.Operator, field.Key)
+		}
+	}
+	return true, nil
+}
+
+func isNodeReady(node corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// canRecoverMember returns true if a majority of the members other than the one with
+// the given index are ready.
+func (r ReplicaSetReconciler) canRecoverMember(mdb mdbv1.MongoDB, sts appsv1.StatefulSet, index int) (bool, error) {
+	readyMembers := 0
+	for i := 0; i < mdb.Spec.Members; i++ {
+		if i == index {
+			continue
+		}
+		pod, err := r.getPod(types.NamespacedName{Name: fmt.Sprintf("%s-%d", sts.Name, i), Namespace: sts.Namespace})
+		if err != nil {
+			return false, err
+		}
+		if pod != nil && isPodReady(*pod) {
+			readyMembers++
+		}
+	}
+	return readyMembers > mdb.Spec.Members/2, nil
+}
+
+func isPodReady(pod corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// recoverMember deletes the PersistentVolumeClaim and the Pod of the member, the StatefulSet then
+// recreates both. The PersistentVolumeClaim is only removed once the Pod is deleted.
+func (r ReplicaSetReconciler) recoverMember(mdb mdbv1.MongoDB, pvc corev1.PersistentVolumeClaim, pod *corev1.Pod, reason string) error {
+	r.log.Infof("Recreating the volume %s because %s", pvc.Name, reason)
+	if err := r.client.Delete(context.TODO(), &pvc); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting PersistentVolumeClaim %s: %s", pvc.Name, err)
+	}
+	if pod != nil {
+		if err := r.client.Delete(context.TODO(), pod); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting pod %s: %s", pod.Name, err)
+		}
+	}
+	if r.recorder != nil {
+		r.recorder.Eventf(&mdb, corev1.EventTypeWarning, memberVolumeRecoveredEventReason,
+			"Recreated the volume %s because %s, the member will resync its data", pvc.Name, reason)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func createMemberPods(t *testing.T, c client.Client, mdb mdbv1.MongoDB, ready bool) {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	for i := 0; i < mdb.Spec.Members; i++ {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", mdb.Name, i), Namespace: mdb.Namespace},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		}
+		assert.NoError(t, c.Create(context.TODO(), &pod))
+	}
+}
+
+func setVolumeClaimPhase(t *testing.T, c client.Client, nsName types.NamespacedName, phase corev1.PersistentVolumeClaimPhase) {
+	pvc := corev1.PersistentVolumeClaim{}
+	assert.NoError(t, c.Get(context.TODO(), nsName, &pvc))
+	pvc.Status.Phase = phase
+	assert.NoError(t, c.Update(context.TODO(), &pvc))
+}
+
+func TestRecoverLostVolumes(t *testing.T) {
+	setup := func(t *testing.T, readyPods bool) (mdbv1.MongoDB, client.Client, ReplicaSetReconciler) {
+		mdb := testutils.NewTestReplicaSet()
+		mgr := client.NewManager(&mdb)
+		mgrClient := client.NewClient(mgr.GetClient())
+		r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+		createDataVolumeClaims(t, mgrClient, mdb, "10G")
+		createMemberPods(t, mgrClient, mdb, readyPods)
+		return mdb, mgrClient, *r
+	}
+	lostVolume := func(mdb mdbv1.MongoDB) types.NamespacedName {
+		return types.NamespacedName{Name: volumeClaimName(dataVolumeName, mdb.Name, 1), Namespace: mdb.Namespace}
+	}
+
+	t.Run("The lost volume and the Pod of the member are deleted", func(t *testing.T) {
+		mdb, c, r := setup(t, true)
+		setVolumeClaimPhase(t, c, lostVolume(mdb), corev1.ClaimLost)
+
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+
+		err = c.Get(context.TODO(), lostVolume(mdb), &corev1.PersistentVolumeClaim{})
+		assert.True(t, errors.IsNotFound(err))
+		err = c.Get(context.TODO(), types.NamespacedName{Name: mdb.Name + "-1", Namespace: mdb.Namespace}, &corev1.Pod{})
+		assert.True(t, errors.IsNotFound(err))
+
+		for _, i := range []int{0, 2} {
+			err := c.Get(context.TODO(), types.NamespacedName{Name: volumeClaimName(dataVolumeName, mdb.Name, i), Namespace: mdb.Namespace}, &corev1.PersistentVolumeClaim{})
+			assert.NoError(t, err, "the volumes of the other members are kept")
+		}
+	})
+
+	t.Run("The volume is not recovered without a majority of ready members", func(t *testing.T) {
+		mdb, c, r := setup(t, false)
+		setVolumeClaimPhase(t, c, lostVolume(mdb), corev1.ClaimLost)
+
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+
+		assert.NoError(t, c.Get(context.TODO(), lostVolume(mdb), &corev1.PersistentVolumeClaim{}))
+	})
+
+	t.Run("Volumes bound to a node which doesn't exist anymore are recovered", func(t *testing.T) {
+		mdb, c, r := setup(t, true)
+		pvc := corev1.PersistentVolumeClaim{}
+		assert.NoError(t, c.Get(context.TODO(), lostVolume(mdb), &pvc))
+		pvc.Annotations = map[string]string{selectedNodeAnnotationKey: "dead-node"}
+		assert.NoError(t, c.Update(context.TODO(), &pvc))
+		pod := unschedulablePod("0/3 nodes are available: 3 node(s) had volume node affinity conflict.")
+
+		reason, err := r.lostVolumeReason(mdb, pvc, pod)
+		assert.NoError(t, err)
+		assert.Contains(t, reason, "dead-node")
+
+		assert.NoError(t, c.Create(context.TODO(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "dead-node"}}))
+		reason, err = r.lostVolumeReason(mdb, pvc, pod)
+		assert.NoError(t, err)
+		assert.Empty(t, reason, "volumes bound to existing nodes are not recovered")
+	})
+}
+
+func TestRecoverUnschedulableVolumes(t *testing.T) {
+	const zoneLabelKey = "topology.kubernetes.io/zone"
+	node := func(name, zone string, ready, cordoned bool) *corev1.Node {
+		status := corev1.ConditionTrue
+		if !ready {
+			status = corev1.ConditionFalse
+		}
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{zoneLabelKey: zone}},
+			Spec:       corev1.NodeSpec{Unschedulable: cordoned},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}}},
+		}
+	}
+	withTimeout := func(timeout time.Duration) mdbv1.MongoDB {
+		mdb := testutils.NewTestReplicaSet()
+		mdb.Spec.Storage.UnschedulableVolumeTimeout = &metav1.Duration{Duration: timeout}
+		return mdb
+	}
+	// the member 1 is stuck on a volume bound to zone-a, whose only node is not ready
+	setup := func(t *testing.T, mdb mdbv1.MongoDB, stuckFor time.Duration) (client.Client, ReplicaSetReconciler, types.NamespacedName) {
+		mgr := client.NewManager(&mdb)
+		c := client.NewClient(mgr.GetClient())
+		r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+		res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		testutils.AssertReconciliationSuccessful(t, res, err)
+		createDataVolumeClaims(t, c, mdb, "10G")
+		createMemberPods(t, c, mdb, true)
+
+		pvcName := types.NamespacedName{Name: volumeClaimName(dataVolumeName, mdb.Name, 1), Namespace: mdb.Namespace}
+		pvc := corev1.PersistentVolumeClaim{}
+		assert.NoError(t, c.Get(context.TODO(), pvcName, &pvc))
+		pvc.Annotations = map[string]string{selectedNodeAnnotationKey: "node-a"}
+		pvc.Spec.VolumeName = "pv-1"
+		pvc.Status.Phase = corev1.ClaimBound
+		assert.NoError(t, c.Update(context.TODO(), &pvc))
+		pv := corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+			Spec: corev1.PersistentVolumeSpec{
+				NodeAffinity: &corev1.VolumeNodeAffinity{Required: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchExpressions: []corev1.NodeSelectorRequirement{{Key: zoneLabelKey, Operator: corev1.NodeSelectorOpIn, Values: []string{"zone-a"}}},
+					}},
+				}},
+			},
+		}
+		assert.NoError(t, c.Create(context.TODO(), &pv))
+		assert.NoError(t, c.Create(context.TODO(), node("node-a", "zone-a", false, false)))
+		assert.NoError(t, c.Create(context.TODO(), node("node-b", "zone-b", true, false)))
+
+		pod := corev1.Pod{}
+		assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: mdb.Name + "-1", Namespace: mdb.Namespace}, &pod))
+		pod.Status.Conditions = []corev1.PodCondition{{
+			Type:               corev1.PodScheduled,
+			Status:             corev1.ConditionFalse,
+			Reason:             corev1.PodReasonUnschedulable,
+			Message:            "0/2 nodes are available: 1 node(s) had volume node affinity conflict, 1 node(s) were not ready.",
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-stuckFor)),
+		}}
+		assert.NoError(t, c.Update(context.TODO(), &pod))
+		return c, *r, pvcName
+	}
+
+	t.Run("The volume is recreated once the member is stuck for longer than the timeout", func(t *testing.T) {
+		mdb := withTimeout(15 * time.Minute)
+		c, r, pvcName := setup(t, mdb, 20*time.Minute)
+
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+
+		_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+		assert.Equal(t, []mdbv1.PendingVolumeStatus{{
+			Name:    pvcName.Name,
+			Reason:  volumeNodeAffinityConflictReason,
+			Message: "0/2 nodes are available: 1 node(s) had volume node affinity conflict, 1 node(s) were not ready.",
+		}}, mdb.Status.PendingVolumes)
+		err = c.Get(context.TODO(), pvcName, &corev1.PersistentVolumeClaim{})
+		assert.True(t, errors.IsNotFound(err))
+		err = c.Get(context.TODO(), types.NamespacedName{Name: mdb.Name + "-1", Namespace: mdb.Namespace}, &corev1.Pod{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("The volume is kept before the timeout", func(t *testing.T) {
+		mdb := withTimeout(15 * time.Minute)
+		c, r, pvcName := setup(t, mdb, time.Minute)
+
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		assert.NoError(t, c.Get(context.TODO(), pvcName, &corev1.PersistentVolumeClaim{}))
+	})
+
+	t.Run("The volume is kept while a node of its zone is ready, even if it is cordoned", func(t *testing.T) {
+		mdb := withTimeout(15 * time.Minute)
+		c, r, pvcName := setup(t, mdb, 20*time.Minute)
+		assert.NoError(t, c.Create(context.TODO(), node("node-c", "zone-a", true, true)))
+
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+		assert.NoError(t, c.Get(context.TODO(), pvcName, &corev1.PersistentVolumeClaim{}))
+	})
+
+	t.Run("The recreation is disabled by default", func(t *testing.T) {
+		for _, mdb := range []mdbv1.MongoDB{testutils.NewTestReplicaSet(), withTimeout(0)} {
+			c, r, pvcName := setup(t, mdb, 20*time.Minute)
+
+			_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+			assert.NoError(t, err)
+			assert.NoError(t, c.Get(context.TODO(), pvcName, &corev1.PersistentVolumeClaim{}))
+		}
+	})
+}
+
+func TestIsNodeReady(t *testing.T) {
+	assert.True(t, isNodeReady(corev1.Node{Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}}}))
+	assert.True(t, isNodeReady(corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}, Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}}}), "a cordoned node is still available")
+	assert.False(t, isNodeReady(corev1.Node{Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown}}}}))
+	assert.False(t, isNodeReady(corev1.Node{}))
+}
+
+func TestVolumeCanBeAttached(t *testing.T) {
+	pv := func(terms ...corev1.NodeSelectorTerm) corev1.PersistentVolume {
+		return corev1.PersistentVolume{Spec: corev1.PersistentVolumeSpec{
+			NodeAffinity: &corev1.VolumeNodeAffinity{Required: &corev1.NodeSelector{NodeSelectorTerms: terms}},
+		}}
+	}
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{"topology.kubernetes.io/zone": "zone-a"}}}
+	inZone := func(zone string) corev1.NodeSelectorTerm {
+		return corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{zone}}}}
+	}
+	named := func(name string) corev1.NodeSelectorTerm {
+		return corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{name}}}}
+	}
+
+	tests := []struct {
+		name     string
+		pv       corev1.PersistentVolume
+		expected bool
+	}{
+		{name: "Volumes without node affinity can be attached anywhere", pv: corev1.PersistentVolume{}, expected: true},
+		{name: "The zone matches", pv: pv(inZone("zone-a")), expected: true},
+		{name: "The zone doesn't match", pv: pv(inZone("zone-b")), expected: false},
+		{name: "One of the terms matches", pv: pv(inZone("zone-b"), named("node-a")), expected: true},
+		{name: "The node name doesn't match", pv: pv(named("node-b")), expected: false},
+		{name: "Empty terms match no node", pv: pv(corev1.NodeSelectorTerm{}), expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attachable, err := volumeCanBeAttached(tt.pv, node)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, attachable)
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+)
+
+const (
+	// validatingWebhookPath is the path the API server sends the MongoDB resources to be validated
+	// to, it must match the ValidatingWebhookConfiguration
+	validatingWebhookPath = "/validate-mongodb-com-v1-mongodb"
+	// mutatingWebhookPath is the path the API server sends the MongoDB resources to be defaulted
+	// to, it must match the MutatingWebhookConfiguration
+	mutatingWebhookPath = "/mutate-mongodb-com-v1-mongodb"
+	// conversionWebhookPath is the path the API server sends the MongoDB resources to be converted
+	// between the API versions to, it must match the conversion of the CustomResourceDefinition
+	conversionWebhookPath = "/convert"
+)
+
+// defaultUserDatabase is the database of the users of spec.users which don't set one
+const defaultUserDatabase = "admin"
+
+var (
+	// versionRegexp matches the semantic versions, optionally with a pre-release suffix such as "-ent"
+	versionRegexp = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?$`)
+	// featureCompatibilityVersionRegexp matches the release series, such as "4.2"
+	featureCompatibilityVersionRegexp = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)$`)
+)
+
+// AddWebhooks serves the webhook setting the defaults of the MongoDB resources when they are
+// created or updated, and the one validating them, so that the specs which can't be applied are
+// refused by the API server, rather than failing the reconciliation. It also serves the webhook
+// converting the resources between their API versions, see the v1beta1 package.
+func AddWebhooks(mgr manager.Manager) {
+	mgr.GetWebhookServer().Register(mutatingWebhookPath, &webhook.Admission{Handler: &mongoDBDefaulter{}})
+	mgr.GetWebhookServer().Register(validatingWebhookPath, &webhook.Admission{Handler: &mongoDBValidator{}})
+	mgr.GetWebhookServer().Register(conversionWebhookPath, &conversion.Webhook{})
+}
+
+// mongoDBDefaulter sets the defaults of the MongoDB resources sent by the API server, see applyDefaults
+type mongoDBDefaulter struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.DecoderInjector = &mongoDBDefaulter{}
+
+func (d *mongoDBDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+func (d *mongoDBDefaulter) Handle(_ context.Context, req admission.Request) admission.Response {
+	mdb := mdbv1.MongoDB{}
+	if err := d.decoder.Decode(req, &mdb); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if mdb.DeletionTimestamp != nil {
+		return admission.Allowed("")
+	}
+	applyDefaults(&mdb)
+	defaulted, err := json.Marshal(mdb)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, defaulted)
+}
+
+// mongoDBValidator validates the MongoDB resources sent by the API server
+type mongoDBValidator struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.DecoderInjector = &mongoDBValidator{}
+
+func (v *mongoDBValidator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
+
+func (v *mongoDBValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	mdb := mdbv1.MongoDB{}
+	if err := v.decoder.Decode(req, &mdb); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *mdbv1.MongoDB
+	if req.Operation == admissionv1beta1.Update {
+		old = &mdbv1.MongoDB{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	if problems := validateAdmission(mdb, old); len(problems) > 0 {
+		return admission.Denied(strings.Join(problems, "; "))
+	}
+	return admission.Allowed("")
+}
+
+// validateAdmission returns the problems of the spec of the resource, which is being created if old
+// is nil. The updates which don't change the spec other than by setting its defaults, such as the
+// ones of the metadata made by the operator, are always allowed, as are the ones of a resource
+// being deleted.
+func validateAdmission(mdb mdbv1.MongoDB, old *mdbv1.MongoDB) []string {
+	if old != nil && (mdb.DeletionTimestamp != nil || equality.Semantic.DeepEqual(withDefaults(*old).Spec, withDefaults(mdb).Spec)) {
+		return nil
+	}
+
+	var problems []string
+	if err := validateSpec(mdb); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if !versionRegexp.MatchString(mdb.Spec.Version) {
+		problems = append(problems, fmt.Sprintf(`spec.version "%s" must be a semantic version, such as 4.2.6`, mdb.Spec.Version))
+	}
+	if fcv := mdb.Spec.FeatureCompatibilityVersion; fcv != "" && !featureCompatibilityVersionRegexp.MatchString(fcv) {
+		problems = append(problems, fmt.Sprintf(`spec.featureCompatibilityVersion "%s" must be a release series, such as 4.2`, fcv))
+	}
+	problems = append(problems, validateTLSReferences(mdb)...)
+	problems = append(problems, validateUsers(mdb)...)
+	if old != nil {
+		problems = append(problems, validateImmutableFields(withDefaults(*old), withDefaults(mdb))...)
+	}
+	return problems
+}
+
+// validateTLSReferences returns the references to the certificates which aren't set while TLS is
+// enabled, unless they are read from Vault. The referenced objects may not exist yet, e.g. when
+// they're issued by cert-manager.
+func validateTLSReferences(mdb mdbv1.MongoDB) []string {
+	tls := mdb.Spec.Security.TLS
+	if !tls.Enabled || tls.VaultSecretPath != "" {
+		return nil
+	}
+	var problems []string
+	if tls.CertificateKeySecret.Name == "" {
+		problems = append(problems, "spec.security.tls.certificateKeySecretRef.name is required when TLS is enabled without spec.security.tls.vaultSecretPath")
+	}
+	if tls.CaConfigMap.Name == "" {
+		problems = append(problems, "spec.security.tls.caConfigMapRef.name is required when TLS is enabled without spec.security.tls.vaultSecretPath")
+	}
+	return problems
+}
+
+// validateUsers returns the problems of the users of spec.users: their names, the references to
+// their passwords and their roles must be set, and each user must be declared once per database
+func validateUsers(mdb mdbv1.MongoDB) []string {
+	var problems []string
+	declared := map[string]bool{}
+	for i, user := range mdb.Spec.Users {
+		if user.Name == "" {
+			problems = append(problems, fmt.Sprintf("spec.users[%d].name is required", i))
+		}
+		switch {
+		case user.PasswordVaultRef != nil && user.PasswordSecretRef.Name != "":
+			problems = append(problems, fmt.Sprintf("spec.users[%d]: only one of passwordSecretRef and passwordVaultRef can be set", i))
+		case user.PasswordVaultRef != nil && user.PasswordVaultRef.Path == "":
+			problems = append(problems, fmt.Sprintf("spec.users[%d].passwordVaultRef.path is required", i))
+		case user.PasswordVaultRef == nil && user.PasswordSecretRef.Name == "":
+			problems = append(problems, fmt.Sprintf("spec.users[%d].passwordSecretRef.name is required", i))
+		}
+		db := user.DB
+		if db == "" {
+			db = defaultUserDatabase
+		}
+		if key := db + "." + user.Name; user.Name != "" && declared[key] {
+			problems = append(problems, fmt.Sprintf("spec.users[%d]: user %s is declared more than once in database %s", i, user.Name, db))
+		} else {
+			declared[key] = true
+		}
+		for j, role := range user.Roles {
+			if role.Name == "" {
+				problems = append(problems, fmt.Sprintf("spec.users[%d].roles[%d].name is required", i, j))
+			}
+			if role.DB == "" {
+				problems = append(problems, fmt.Sprintf("spec.users[%d].roles[%d].db is required", i, j))
+			}
+		}
+	}
+	return problems
+}
+
+// validateImmutableFields returns the fields changed by the update which can't be changed once the
+// resource has been created, both having their defaults set: the type, the data path, whether the storage is ephemeral, and the
+// settings of the volumes other than their labels, their annotations and the increase of their size.
+func validateImmutableFields(old, mdb mdbv1.MongoDB) []string {
+	var problems []string
+	if old.Spec.Type != mdb.Spec.Type {
+		problems = append(problems, "spec.type can't be changed")
+	}
+	if dataPath(old) != dataPath(mdb) {
+		problems = append(problems, "spec.storage.dataPath can't be changed")
+	}
+	if old.Spec.Storage.Ephemeral != mdb.Spec.Storage.Ephemeral {
+		problems = append(problems, "spec.storage.ephemeral can't be changed")
+	}
+	problems = append(problems, validateVolumeClaimChange("spec.storage.data", &old.Spec.Storage.Data, &mdb.Spec.Storage.Data)...)
+	problems = append(problems, validateVolumeClaimChange("spec.storage.journal", old.Spec.Storage.Journal, mdb.Spec.Storage.Journal)...)
+	problems = append(problems, validateVolumeClaimChange("spec.storage.logs", old.Spec.Storage.Logs, mdb.Spec.Storage.Logs)...)
+	return problems
+}
+
+// validateVolumeClaimChange returns the changes of the settings of the volume at the given field
+// which can't be applied to the existing volumes, if it's configured both before and after the update
+func validateVolumeClaimChange(field string, old, claim *mdbv1.VolumeClaim) []string {
+	if old == nil || claim == nil {
+		return nil
+	}
+	var problems []string
+	if !reflect.DeepEqual(old.StorageClassName, claim.StorageClassName) {
+		problems = append(problems, fmt.Sprintf("%s.storageClassName can't be changed", field))
+	}
+	if !reflect.DeepEqual(accessModes(*old), accessModes(*claim)) {
+		problems = append(problems, fmt.Sprintf("%s.accessModes can't be changed", field))
+	}
+	if !reflect.DeepEqual(old.Selector, claim.Selector) {
+		problems = append(problems, fmt.Sprintf("%s.selector can't be changed", field))
+	}
+	oldRequests, oldErr := storageRequests(*old)
+	requests, err := storageRequests(*claim)
+	// an invalid size is reported by validateSpec
+	if oldErr == nil && err == nil {
+		oldSize, size := oldRequests[corev1.ResourceStorage], requests[corev1.ResourceStorage]
+		if size.Cmp(oldSize) < 0 {
+			problems = append(problems, fmt.Sprintf("%s.size can't be decreased from %s to %s", field, oldSize.String(), size.String()))
+		}
+	}
+	return problems
+}
+
+func withDefaults(mdb mdbv1.MongoDB) mdbv1.MongoDB {
+	defaulted := mdb.DeepCopy()
+	applyDefaults(defaulted)
+	return *defaulted
+}
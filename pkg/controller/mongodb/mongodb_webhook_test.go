@@ -0,0 +1,302 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/apis"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1beta1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apix "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+)
+
+func TestValidateAdmission_Create(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	assert.Empty(t, validateAdmission(mdb, nil))
+
+	mdb.Spec.Version = "4.2.6-ent"
+	assert.Empty(t, validateAdmission(mdb, nil))
+
+	for _, version := range []string{"", "4.2", "v4.2.6", "4.02.6", "latest"} {
+		mdb.Spec.Version = version
+		assert.Len(t, validateAdmission(mdb, nil), 1, "version %s is refused", version)
+	}
+
+	mdb = testutils.NewTestReplicaSet()
+	mdb.Spec.FeatureCompatibilityVersion = "4.2.6"
+	assert.Equal(t, []string{`spec.featureCompatibilityVersion "4.2.6" must be a release series, such as 4.2`}, validateAdmission(mdb, nil))
+
+	mdb = testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.Data.Size = "big"
+	assert.Len(t, validateAdmission(mdb, nil), 1, "the problems found by the reconciliation are refused")
+}
+
+func TestValidateAdmission_TLS(t *testing.T) {
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	assert.Empty(t, validateAdmission(mdb, nil))
+
+	mdb.Spec.Security.TLS.CaConfigMap.Name = ""
+	mdb.Spec.Security.TLS.CertificateKeySecret.Name = ""
+	assert.Equal(t, []string{
+		"spec.security.tls.certificateKeySecretRef.name is required when TLS is enabled without spec.security.tls.vaultSecretPath",
+		"spec.security.tls.caConfigMapRef.name is required when TLS is enabled without spec.security.tls.vaultSecretPath",
+	}, validateAdmission(mdb, nil))
+
+	mdb.Spec.Security.TLS.VaultSecretPath = "secret/mongodb/my-rs/tls"
+	assert.Equal(t, []string{"spec.security.vault.role is required by spec.security.tls.vaultSecretPath"}, validateAdmission(mdb, nil))
+	mdb.Spec.Security.Vault = &mdbv1.Vault{Role: "my-rs"}
+	assert.Empty(t, validateAdmission(mdb, nil), "the certificates are read from Vault")
+}
+
+func TestValidateAdmission_Users(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Users = []mdbv1.MongoDBUser{
+		{Name: "alice", PasswordSecretRef: mdbv1.SecretKeyReference{Name: "alice-password"}, Roles: []mdbv1.Role{{Name: "readWrite", DB: "app"}}},
+		{Name: "alice", DB: "app", PasswordSecretRef: mdbv1.SecretKeyReference{Name: "alice-password"}},
+	}
+	assert.Empty(t, validateAdmission(mdb, nil))
+
+	mdb.Spec.Users = append(mdb.Spec.Users,
+		mdbv1.MongoDBUser{Name: "alice", DB: "admin", PasswordSecretRef: mdbv1.SecretKeyReference{Name: "alice-password"}},
+		mdbv1.MongoDBUser{Roles: []mdbv1.Role{{Name: "read"}}},
+	)
+	assert.Equal(t, []string{
+		"spec.users[2]: user alice is declared more than once in database admin",
+		"spec.users[3].name is required",
+		"spec.users[3].passwordSecretRef.name is required",
+		"spec.users[3].roles[0].db is required",
+	}, validateAdmission(mdb, nil))
+
+	mdb.Spec.Security.Vault = &mdbv1.Vault{Role: "my-rs"}
+	mdb.Spec.Users = []mdbv1.MongoDBUser{
+		{Name: "alice", PasswordVaultRef: &mdbv1.VaultSecretKeyReference{Path: "secret/mongodb/alice"}},
+		{Name: "bob", PasswordVaultRef: &mdbv1.VaultSecretKeyReference{Path: "secret/mongodb/bob"}, PasswordSecretRef: mdbv1.SecretKeyReference{Name: "bob-password"}},
+	}
+	assert.Equal(t, []string{"spec.users[1]: only one of passwordSecretRef and passwordVaultRef can be set"}, validateAdmission(mdb, nil))
+}
+
+func TestValidateAdmission_Update(t *testing.T) {
+	old := testutils.NewTestReplicaSet()
+	old.Spec.Storage.Data.Size = "20Gi"
+	old.Spec.Storage.Logs = &mdbv1.VolumeClaim{Size: "1Gi"}
+
+	mdb := *old.DeepCopy()
+	mdb.Spec.Members = 5
+	mdb.Spec.Storage.Data.Size = "30Gi"
+	assert.Empty(t, validateAdmission(mdb, &old), "the volumes can be expanded")
+
+	mdb.Spec.Storage.Logs = nil
+	mdb.Spec.Storage.Journal = &mdbv1.VolumeClaim{Size: "1Gi"}
+	assert.Empty(t, validateAdmission(mdb, &old), "the dedicated volumes can be added and removed")
+
+	storageClass := "fast"
+	mdb = *old.DeepCopy()
+	mdb.Spec.Type = "Sharded"
+	mdb.Spec.Storage.DataPath = "/data/db"
+	mdb.Spec.Storage.Ephemeral = true
+	mdb.Spec.Storage.Data.Size = "10Gi"
+	mdb.Spec.Storage.Data.StorageClassName = &storageClass
+	mdb.Spec.Storage.Logs.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+	assert.Equal(t, []string{
+		"spec.type can't be changed",
+		"spec.storage.dataPath can't be changed",
+		"spec.storage.ephemeral can't be changed",
+		"spec.storage.data.storageClassName can't be changed",
+		"spec.storage.data.size can't be decreased from 20Gi to 10Gi",
+		"spec.storage.logs.accessModes can't be changed",
+	}, validateAdmission(mdb, &old))
+}
+
+func TestValidateAdmission_UnchangedSpec(t *testing.T) {
+	old := testutils.NewTestReplicaSet()
+	old.Spec.Version = "latest"
+
+	mdb := *old.DeepCopy()
+	mdb.Annotations[lastVersionAnnotationKey] = "4.2.2"
+	assert.Empty(t, validateAdmission(mdb, &old), "the metadata of an invalid resource can be changed")
+
+	mdb.Spec.Members = 5
+	assert.NotEmpty(t, validateAdmission(mdb, &old))
+
+	now := metav1.Now()
+	mdb.DeletionTimestamp = &now
+	assert.Empty(t, validateAdmission(mdb, &old), "the resource being deleted can be changed")
+}
+
+func TestMongoDBValidator_Handle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, mdbv1.SchemeBuilder.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	assert.NoError(t, err)
+	validator := &mongoDBValidator{}
+	assert.NoError(t, validator.InjectDecoder(decoder))
+
+	old := testutils.NewTestReplicaSet()
+	old.Spec.Storage.Data.Size = "20Gi"
+	mdb := *old.DeepCopy()
+	mdb.Spec.Storage.Data.Size = "10Gi"
+
+	res := validator.Handle(context.TODO(), admissionRequest(t, admissionv1beta1.Create, mdb, nil))
+	assert.True(t, res.Allowed)
+
+	res = validator.Handle(context.TODO(), admissionRequest(t, admissionv1beta1.Update, mdb, &old))
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "spec.storage.data.size can't be decreased from 20Gi to 10Gi", string(res.Result.Reason))
+
+	res = validator.Handle(context.TODO(), admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: admissionv1beta1.Create,
+		Object:    runtime.RawExtension{Raw: []byte("{")},
+	}})
+	assert.False(t, res.Allowed)
+	assert.Equal(t, int32(400), res.Result.Code)
+}
+
+func admissionRequest(t *testing.T, operation admissionv1beta1.Operation, mdb mdbv1.MongoDB, old *mdbv1.MongoDB) admission.Request {
+	mdb.APIVersion, mdb.Kind = mdbv1.SchemeGroupVersion.String(), "MongoDB"
+	raw, err := json.Marshal(mdb)
+	assert.NoError(t, err)
+	req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: operation,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+	if old != nil {
+		old.APIVersion, old.Kind = mdb.APIVersion, mdb.Kind
+		req.OldObject.Raw, err = json.Marshal(old)
+		assert.NoError(t, err)
+	}
+	return req
+}
+
+func TestValidateAdmission_Defaults(t *testing.T) {
+	old := testutils.NewTestReplicaSet()
+	old.Spec.Version = "latest"
+	mdb := withDefaults(old)
+	assert.Empty(t, validateAdmission(mdb, &old), "the defaults can be set on an invalid resource")
+
+	old.Spec.Version = "4.2.2"
+	mdb = withDefaults(old)
+	mdb.Spec.Members = 5
+	assert.Empty(t, validateAdmission(mdb, &old), "the defaults of the volumes don't change them")
+}
+
+func TestMongoDBDefaulter_Handle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, mdbv1.SchemeBuilder.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	assert.NoError(t, err)
+	defaulter := &mongoDBDefaulter{}
+	assert.NoError(t, defaulter.InjectDecoder(decoder))
+
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Members = 0
+	res := defaulter.Handle(context.TODO(), admissionRequest(t, admissionv1beta1.Create, mdb, nil))
+	assert.True(t, res.Allowed)
+	patched := map[string]interface{}{}
+	for _, patch := range res.Patches {
+		patched[patch.Path] = patch.Value
+	}
+	assert.Equal(t, float64(3), patched["/spec/members"])
+	assert.Equal(t, "/data", patched["/spec/storage/dataPath"])
+
+	now := metav1.Now()
+	mdb.DeletionTimestamp = &now
+	res = defaulter.Handle(context.TODO(), admissionRequest(t, admissionv1beta1.Update, mdb, &mdb))
+	assert.True(t, res.Allowed)
+	assert.Empty(t, res.Patches, "the resources being deleted aren't changed")
+}
+
+func TestConversionWebhook(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, apis.AddToScheme(scheme))
+	hook := &conversion.Webhook{}
+	assert.NoError(t, hook.InjectScheme(scheme))
+
+	mdb := testutils.NewTestReplicaSet()
+	mdb.APIVersion, mdb.Kind = mdbv1.SchemeGroupVersion.String(), "MongoDB"
+	mdb.Spec.Storage.Data.Size = "20Gi"
+	v1beta1mdb := convertReview(t, hook, mdb, v1beta1.SchemeGroupVersion.String())
+	assert.Equal(t, "4.2.2", v1beta1mdb["spec"].(map[string]interface{})["version"])
+	assert.NotContains(t, v1beta1mdb["spec"], "storage")
+
+	converted := convertReview(t, hook, v1beta1mdb, mdbv1.SchemeGroupVersion.String())
+	raw, err := json.Marshal(converted)
+	assert.NoError(t, err)
+	v1mdb := mdbv1.MongoDB{}
+	assert.NoError(t, json.Unmarshal(raw, &v1mdb))
+	assert.Equal(t, mdb.Spec, v1mdb.Spec, "the resource is converted back to v1 with the fields v1beta1 doesn't have")
+	assert.Empty(t, v1mdb.Annotations)
+}
+
+// convertReview sends the object to the conversion webhook, and returns the converted object
+func convertReview(t *testing.T, hook *conversion.Webhook, obj interface{}, apiVersion string) map[string]interface{} {
+	raw, err := json.Marshal(obj)
+	assert.NoError(t, err)
+	review := apix.ConversionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: apix.SchemeGroupVersion.String(), Kind: "ConversionReview"},
+		Request: &apix.ConversionRequest{
+			UID:               "uid",
+			DesiredAPIVersion: apiVersion,
+			Objects:           []runtime.RawExtension{{Raw: raw}},
+		},
+	}
+	body, err := json.Marshal(review)
+	assert.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	hook.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, conversionWebhookPath, bytes.NewReader(body)))
+
+	res := apix.ConversionReview{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	assert.Equal(t, metav1.StatusSuccess, res.Response.Result.Status, res.Response.Result.Message)
+	assert.Len(t, res.Response.ConvertedObjects, 1)
+	converted := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(res.Response.ConvertedObjects[0].Raw, &converted))
+	assert.Equal(t, apiVersion, converted["apiVersion"])
+	return converted
+}
+
+// crdSchemaProperty returns the schema of the property at the path of the v1 MongoDB resource in the
+// generated CustomResourceDefinition
+func crdSchemaProperty(t *testing.T, path ...string) map[string]interface{} {
+	data, err := ioutil.ReadFile("../../../deploy/crds/mongodb.com_mongodb_crd.yaml")
+	assert.NoError(t, err)
+	crd := map[string]interface{}{}
+	assert.NoError(t, yaml.Unmarshal(data, &crd))
+
+	versions := crd["spec"].(map[string]interface{})["versions"].([]interface{})
+	v1 := versions[0].(map[string]interface{})
+	assert.Equal(t, "v1", v1["name"])
+	schema := v1["schema"].(map[string]interface{})["openAPIV3Schema"].(map[string]interface{})
+	for _, property := range path {
+		schema = schema["properties"].(map[string]interface{})[property].(map[string]interface{})
+	}
+	return schema
+}
+
+func TestCustomResourceDefinition_ValidatesLikeTheWebhook(t *testing.T) {
+	assert.Equal(t, versionRegexp.String(), crdSchemaProperty(t, "spec", "version")["pattern"])
+	assert.Equal(t, featureCompatibilityVersionRegexp.String(), crdSchemaProperty(t, "spec", "featureCompatibilityVersion")["pattern"])
+	assert.EqualValues(t, 0, crdSchemaProperty(t, "spec", "members")["minimum"], "0 members is defaulted")
+
+	var messages []string
+	for _, rule := range crdSchemaProperty(t, "spec", "security", "tls")["x-kubernetes-validations"].([]interface{}) {
+		messages = append(messages, rule.(map[string]interface{})["message"].(string))
+	}
+	mdb := testutils.NewTestReplicaSetWithTLS()
+	mdb.Spec.Security.TLS.CaConfigMap.Name = ""
+	mdb.Spec.Security.TLS.CertificateKeySecret.Name = ""
+	assert.Equal(t, validateTLSReferences(mdb), messages, "the API server refuses the same TLS configurations")
+}
@@ -0,0 +1,270 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	kubernetesClient "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	backupStartedEventReason = "BackupStarted"
+
+	// operationPendingRequeueInterval is how often a pending backup or restore checks whether it can start
+	operationPendingRequeueInterval = 10 * time.Second
+	// operationFailedReason is the reason of the Complete condition of a backup or a restore which failed
+	operationFailedReason = "Failed"
+)
+
+// AddBackupController creates the controller taking the backups of the MongoDBBackup resources and
+// adds it to the Manager.
+func AddBackupController(mgr manager.Manager) error {
+	r := newBackupReconciler(mgr)
+	c, err := controller.New("mongodbbackup-controller", mgr, controller.Options{Reconciler: newDrainingReconciler(r)})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(&source.Kind{Type: &mdbv1.MongoDBBackup{}}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &mdbv1.MongoDBBackup{},
+	})
+}
+
+func newBackupReconciler(mgr manager.Manager) *BackupReconciler {
+	return &BackupReconciler{
+		client:   kubernetesClient.NewClient(mgr.GetClient()),
+		log:      zap.S(),
+		recorder: mgr.GetEventRecorderFor("mongodbbackup-controller"),
+		now:      time.Now,
+		selector: resourceSelector,
+	}
+}
+
+// BackupReconciler takes the backup of a MongoDBBackup once, with a Job running mongodump against a
+// secondary of the MongoDB resource, and reports its progress in the status of the MongoDBBackup
+type BackupReconciler struct {
+	client   kubernetesClient.Client
+	log      *zap.SugaredLogger
+	recorder record.EventRecorder
+	// now returns the current time, to record when the backup started and completed
+	now func() time.Time
+	// selector selects the MongoDB resources managed by the operator, the backups of the others are
+	// left to their operator
+	selector labels.Selector
+}
+
+func (r *BackupReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	r.log = zap.S().With("namespace", request.Namespace, "mongodbbackup", request.Name)
+	backup := mdbv1.MongoDBBackup{}
+	if err := r.client.Get(context.TODO(), request.NamespacedName, &backup); err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if selected, err := isSelected(r.client, r.selector, backup.MongoDBNamespacedName()); err != nil || !selected {
+		return reconcile.Result{}, err
+	}
+	if backup.IsFinished() {
+		return reconcile.Result{}, nil
+	}
+	if err := validateMongoDBBackup(backup); err != nil {
+		return reconcile.Result{}, r.fail(backup, fmt.Sprintf("Invalid spec: %s", err))
+	}
+
+	job := batchv1.Job{}
+	err := r.client.Get(context.TODO(), backupJobNamespacedName(backup), &job)
+	if errors.IsNotFound(err) {
+		return r.startBackup(backup)
+	}
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error getting backup Job: %s", err)
+	}
+
+	if job.Status.Succeeded > 0 {
+		size, err := jobArchiveSize(r.client, job)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		backup.Status.Phase, backup.Status.Message, backup.Status.Size = mdbv1.BackupSucceeded, "", size
+		backup.Status.CompletionTime = job.Status.CompletionTime
+		backup.SetCondition(newCondition(mdbv1.Complete, corev1.ConditionTrue, string(mdbv1.BackupSucceeded), fmt.Sprintf("Stored the backup in %s", backup.Status.Location)))
+		r.log.Infof("Stored the backup in %s", backup.Status.Location)
+		if r.recorder != nil {
+			r.recorder.Eventf(&backup, corev1.EventTypeNormal, backupCompletedEventReason, "Stored the backup in %s", backup.Status.Location)
+		}
+		return reconcile.Result{}, r.updateStatus(backup)
+	}
+	if message, failed := jobFailure(job); failed {
+		return reconcile.Result{}, r.fail(backup, message)
+	}
+	return reconcile.Result{}, nil
+}
+
+// startBackup creates the backup Job once the MongoDB resource is running
+func (r *BackupReconciler) startBackup(backup mdbv1.MongoDBBackup) (reconcile.Result, error) {
+	mdb := mdbv1.MongoDB{}
+	if err := r.client.Get(context.TODO(), backup.MongoDBNamespacedName(), &mdb); err != nil {
+		if errors.IsNotFound(err) {
+			return r.pending(backup, fmt.Sprintf("The MongoDB resource %s doesn't exist", backup.Spec.MongoDB))
+		}
+		return reconcile.Result{}, fmt.Errorf("error getting MongoDB resource: %s", err)
+	}
+	if mdb.Status.Phase != mdbv1.Running {
+		return r.pending(backup, fmt.Sprintf("Waiting for the MongoDB resource %s to be running", mdb.Name))
+	}
+
+	job := buildBackupJob(backup, mdb)
+	if err := r.client.Create(context.TODO(), &job); err != nil && !errors.IsAlreadyExists(err) {
+		return reconcile.Result{}, fmt.Errorf("error creating backup Job: %s", err)
+	}
+	now := metav1.NewTime(r.now())
+	backup.Status.Phase, backup.Status.Message = mdbv1.BackupRunning, ""
+	backup.Status.Job = job.Name
+	backup.Status.Location = backupLocation(backup.Spec.Target, mongoDBBackupArchiveName(backup))
+	backup.Status.StartTime = &now
+	backup.SetCondition(newCondition(mdbv1.Complete, corev1.ConditionFalse, string(mdbv1.BackupRunning), fmt.Sprintf("Job %s is taking the backup", job.Name)))
+	r.log.Infof("Backing up %s with the Job %s", mdb.Name, job.Name)
+	if r.recorder != nil {
+		r.recorder.Eventf(&backup, corev1.EventTypeNormal, backupStartedEventReason, "Backing up %s with the Job %s", mdb.Name, job.Name)
+	}
+	return reconcile.Result{}, r.updateStatus(backup)
+}
+
+// pending records why the backup can't start yet, and checks again later
+func (r *BackupReconciler) pending(backup mdbv1.MongoDBBackup, message string) (reconcile.Result, error) {
+	if backup.Status.Phase != mdbv1.BackupPending || backup.Status.Message != message {
+		r.log.Info(message)
+		backup.Status.Phase, backup.Status.Message = mdbv1.BackupPending, message
+		backup.SetCondition(newCondition(mdbv1.Complete, corev1.ConditionFalse, string(mdbv1.BackupPending), message))
+		if err := r.updateStatus(backup); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return reconcile.Result{RequeueAfter: operationPendingRequeueInterval}, nil
+}
+
+// fail marks the backup as failed, it isn't retried
+func (r *BackupReconciler) fail(backup mdbv1.MongoDBBackup, message string) error {
+	now := metav1.NewTime(r.now())
+	backup.Status.Phase, backup.Status.Message = mdbv1.BackupFailed, message
+	backup.Status.CompletionTime = &now
+	backup.SetCondition(newCondition(mdbv1.Complete, corev1.ConditionFalse, operationFailedReason, message))
+	r.log.Warnf("Backup failed: %s", message)
+	if r.recorder != nil {
+		r.recorder.Event(&backup, corev1.EventTypeWarning, backupFailedEventReason, message)
+	}
+	return r.updateStatus(backup)
+}
+
+func (r *BackupReconciler) updateStatus(backup mdbv1.MongoDBBackup) error {
+	if err := r.client.Status().Update(context.TODO(), &backup); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
+
+// validateMongoDBBackup ensures the backup refers to a MongoDB resource and has a valid target
+func validateMongoDBBackup(backup mdbv1.MongoDBBackup) error {
+	if backup.Spec.MongoDB == "" {
+		return fmt.Errorf("the MongoDB resource must be set")
+	}
+	if err := validateBackupMethod(backup.Spec.Method); err != nil {
+		return err
+	}
+	if backup.Spec.Target.VolumeSnapshot != nil {
+		return fmt.Errorf("a volumeSnapshot target is only supported by the snapshot method of spec.backup")
+	}
+	if err := validateBackupEncryption(backup.Spec.Encryption); err != nil {
+		return err
+	}
+	return validateBackupTarget(backup.Spec.Target)
+}
+
+func backupJobNamespacedName(backup mdbv1.MongoDBBackup) types.NamespacedName {
+	return types.NamespacedName{Name: backup.Name + "-backup", Namespace: backup.Namespace}
+}
+
+// mongoDBBackupArchiveName is the name of the archive of a MongoDBBackup in its target
+func mongoDBBackupArchiveName(backup mdbv1.MongoDBBackup) string {
+	return backup.Name + ".archive.gz"
+}
+
+// buildBackupJob returns the Job taking the backup of the MongoDBBackup, owned by it
+func buildBackupJob(backup mdbv1.MongoDBBackup, mdb mdbv1.MongoDB) batchv1.Job {
+	labels := map[string]string{"app": backup.Name + "-backup"}
+	backoffLimit := int32(backupBackoffLimit)
+	nsName := backupJobNamespacedName(backup)
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            nsName.Name,
+			Namespace:       nsName.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{operationOwnerReference(&backup, "MongoDBBackup")},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     backupPodTemplate(mdb, backup.Spec.Target, backup.Spec.Encryption, mongoDBBackupArchiveName(backup), "", labels),
+		},
+	}
+}
+
+// operationOwnerReference returns the reference making a MongoDBBackup or a MongoDBRestore the
+// controller of its Job
+func operationOwnerReference(owner metav1.Object, kind string) metav1.OwnerReference {
+	return *metav1.NewControllerRef(owner, mdbv1.SchemeGroupVersion.WithKind(kind))
+}
+
+// jobFailure returns the reason the Job failed, and false if it hasn't failed
+func jobFailure(job batchv1.Job) (string, bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return fmt.Sprintf("Job %s failed: %s", job.Name, condition.Message), true
+		}
+	}
+	return "", false
+}
+
+// jobArchiveSize returns the size of the archive written by a successful backup Job, which the
+// container writing it reports as its termination message, or 0 if it isn't reported, for instance
+// because the Pods of the Job were deleted
+func jobArchiveSize(c k8sClient.Reader, job batchv1.Job) (int64, error) {
+	pods := corev1.PodList{}
+	if err := c.List(context.TODO(), &pods, k8sClient.InNamespace(job.Namespace), k8sClient.MatchingLabels{"job-name": job.Name}); err != nil {
+		return 0, fmt.Errorf("error listing the Pods of the Job %s: %s", job.Name, err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if terminated := status.State.Terminated; terminated != nil {
+				if size, err := strconv.ParseInt(strings.TrimSpace(terminated.Message), 10, 64); err == nil {
+					return size, nil
+				}
+			}
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,132 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newTestMongoDBBackup() mdbv1.MongoDBBackup {
+	return mdbv1.MongoDBBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "before-migration", Namespace: "my-ns"},
+		Spec: mdbv1.MongoDBBackupSpec{
+			MongoDB: "my-rs",
+			Target: mdbv1.BackupTarget{
+				PersistentVolumeClaim: &mdbv1.BackupVolumeTarget{ClaimName: "backups", Path: "my-rs"},
+			},
+		},
+	}
+}
+
+func assertOperationCondition(t *testing.T, condition *mdbv1.Condition, status corev1.ConditionStatus, reason string) {
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, status, condition.Status)
+		assert.Equal(t, reason, condition.Reason)
+	}
+}
+
+func TestBackupReconciler_TakesTheBackupOnceTheReplicaSetIsRunning(t *testing.T) {
+	backup := newTestMongoDBBackup()
+	mgr := client.NewManager(&backup)
+	c := client.NewClient(mgr.GetClient())
+	r := newBackupReconciler(mgr)
+	startedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return startedAt }
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: backup.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, operationPendingRequeueInterval, res.RequeueAfter)
+	_ = c.Get(context.TODO(), backup.NamespacedName(), &backup)
+	assert.Equal(t, mdbv1.BackupPending, backup.Status.Phase)
+	assert.Equal(t, "The MongoDB resource my-rs doesn't exist", backup.Status.Message)
+	assertOperationCondition(t, backup.GetCondition(mdbv1.Complete), corev1.ConditionFalse, "Pending")
+
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Status.Phase = mdbv1.Running
+	assert.NoError(t, c.Create(context.TODO(), &mdb))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: backup.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Zero(t, res.RequeueAfter)
+
+	_ = c.Get(context.TODO(), backup.NamespacedName(), &backup)
+	assert.Equal(t, mdbv1.BackupRunning, backup.Status.Phase)
+	assert.Equal(t, "before-migration-backup", backup.Status.Job)
+	assert.Equal(t, "backups:/my-rs/before-migration.archive.gz", backup.Status.Location)
+	assert.True(t, startedAt.Equal(backup.Status.StartTime.Time))
+
+	job := batchv1.Job{}
+	assert.NoError(t, c.Get(context.TODO(), backupJobNamespacedName(backup), &job))
+	assert.Equal(t, "MongoDBBackup", job.OwnerReferences[0].Kind)
+	assert.Equal(t, backup.Name, job.OwnerReferences[0].Name)
+	command := job.Spec.Template.Spec.Containers[0].Command[2]
+	assert.Contains(t, command, "--readPreference=secondaryPreferred")
+	assert.Contains(t, command, `--archive="/backup/my-rs/before-migration.archive.gz"`)
+
+	t.Run("The backup succeeds with its Job", func(t *testing.T) {
+		completedAt := metav1.NewTime(startedAt.Add(5 * time.Minute))
+		job.Status = batchv1.JobStatus{Succeeded: 1, CompletionTime: &completedAt}
+		assert.NoError(t, c.Update(context.TODO(), &job))
+		r.client = jobPodsClient{Client: r.client, pods: []corev1.Pod{succeededJobPod(job.Name, "52428800")}}
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: backup.NamespacedName()})
+		assert.NoError(t, err)
+		_ = c.Get(context.TODO(), backup.NamespacedName(), &backup)
+		assert.Equal(t, mdbv1.BackupSucceeded, backup.Status.Phase)
+		assert.True(t, completedAt.Equal(backup.Status.CompletionTime))
+		assert.Equal(t, int64(52428800), backup.Status.Size)
+		assertOperationCondition(t, backup.GetCondition(mdbv1.Complete), corev1.ConditionTrue, "Succeeded")
+	})
+
+	t.Run("A finished backup isn't taken again", func(t *testing.T) {
+		assert.NoError(t, c.Delete(context.TODO(), &job))
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: backup.NamespacedName()})
+		assert.NoError(t, err)
+		assert.Error(t, c.Get(context.TODO(), backupJobNamespacedName(backup), &job))
+	})
+}
+
+func TestBackupReconciler_ReportsTheFailureOfTheJob(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Status.Phase = mdbv1.Running
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	backup := newTestMongoDBBackup()
+	assert.NoError(t, c.Create(context.TODO(), &backup))
+	r := newBackupReconciler(mgr)
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: backup.NamespacedName()})
+	assert.NoError(t, err)
+
+	job := batchv1.Job{}
+	assert.NoError(t, c.Get(context.TODO(), backupJobNamespacedName(backup), &job))
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}
+	assert.NoError(t, c.Update(context.TODO(), &job))
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: backup.NamespacedName()})
+	assert.NoError(t, err)
+
+	_ = c.Get(context.TODO(), backup.NamespacedName(), &backup)
+	assert.Equal(t, mdbv1.BackupFailed, backup.Status.Phase)
+	assert.Equal(t, "Job before-migration-backup failed: Job has reached the specified backoff limit", backup.Status.Message)
+	assertOperationCondition(t, backup.GetCondition(mdbv1.Complete), corev1.ConditionFalse, operationFailedReason)
+}
+
+func TestBackupReconciler_FailsAnInvalidBackup(t *testing.T) {
+	backup := newTestMongoDBBackup()
+	backup.Spec.Target.S3 = &mdbv1.BackupS3Target{Bucket: "backups"}
+	mgr := client.NewManager(&backup)
+	c := client.NewClient(mgr.GetClient())
+	r := newBackupReconciler(mgr)
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: backup.NamespacedName()})
+	assert.NoError(t, err)
+
+	_ = c.Get(context.TODO(), backup.NamespacedName(), &backup)
+	assert.Equal(t, mdbv1.BackupFailed, backup.Status.Phase)
+	assert.Equal(t, "Invalid spec: only one target can be set", backup.Status.Message)
+}
@@ -0,0 +1,491 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	kubernetesClient "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	restoreStartedEventReason   = "RestoreStarted"
+	restoreCompletedEventReason = "RestoreCompleted"
+	restoreFailedEventReason    = "RestoreFailed"
+	cloneCreatedEventReason     = "CloneCreated"
+
+	restoreContainerName = "restore"
+	// clonedByAnnotationKey is set on the MongoDB resources created by a clone restore, to the name
+	// of the restore
+	clonedByAnnotationKey = "mongodb.com/v1.clonedBy"
+)
+
+// AddRestoreController creates the controller restoring the archives of the MongoDBRestore resources
+// and adds it to the Manager.
+func AddRestoreController(mgr manager.Manager) error {
+	r := newRestoreReconciler(mgr)
+	c, err := controller.New("mongodbrestore-controller", mgr, controller.Options{Reconciler: newDrainingReconciler(r)})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(&source.Kind{Type: &mdbv1.MongoDBRestore{}}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &mdbv1.MongoDBRestore{},
+	})
+}
+
+func newRestoreReconciler(mgr manager.Manager) *RestoreReconciler {
+	return &RestoreReconciler{
+		client:   kubernetesClient.NewClient(mgr.GetClient()),
+		log:      zap.S(),
+		recorder: mgr.GetEventRecorderFor("mongodbrestore-controller"),
+		now:      time.Now,
+		selector: resourceSelector,
+	}
+}
+
+// RestoreReconciler restores the archive of a MongoDBRestore once, with a Job running mongorestore
+// against the MongoDB resource, and reports its progress in the status of the MongoDBRestore
+type RestoreReconciler struct {
+	client   kubernetesClient.Client
+	log      *zap.SugaredLogger
+	recorder record.EventRecorder
+	// now returns the current time, to record when the restore started and completed
+	now func() time.Time
+	// selector selects the MongoDB resources managed by the operator, the restores of the others are
+	// left to their operator
+	selector labels.Selector
+}
+
+func (r *RestoreReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	r.log = zap.S().With("namespace", request.Namespace, "mongodbrestore", request.Name)
+	restore := mdbv1.MongoDBRestore{}
+	if err := r.client.Get(context.TODO(), request.NamespacedName, &restore); err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if selected, err := isSelected(r.client, r.selector, restore.MongoDBNamespacedName()); err != nil || !selected {
+		return reconcile.Result{}, err
+	}
+	if restore.IsFinished() {
+		return reconcile.Result{}, nil
+	}
+	if err := validateMongoDBRestore(restore); err != nil {
+		return reconcile.Result{}, r.fail(restore, fmt.Sprintf("Invalid spec: %s", err))
+	}
+
+	job := batchv1.Job{}
+	err := r.client.Get(context.TODO(), restoreJobNamespacedName(restore), &job)
+	if errors.IsNotFound(err) {
+		return r.startRestore(restore)
+	}
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error getting restore Job: %s", err)
+	}
+
+	if job.Status.Succeeded > 0 {
+		restore.Status.Phase, restore.Status.Message = mdbv1.RestoreSucceeded, ""
+		restore.Status.CompletionTime = job.Status.CompletionTime
+		message := fmt.Sprintf("Restored %s into %s", restoreSourceName(restore), restore.Spec.MongoDB)
+		restore.SetCondition(newCondition(mdbv1.Complete, corev1.ConditionTrue, string(mdbv1.RestoreSucceeded), message))
+		r.log.Info(message)
+		if r.recorder != nil {
+			r.recorder.Event(&restore, corev1.EventTypeNormal, restoreCompletedEventReason, message)
+		}
+		return reconcile.Result{}, r.updateStatus(restore)
+	}
+	if message, failed := jobFailure(job); failed {
+		return reconcile.Result{}, r.fail(restore, message)
+	}
+	return reconcile.Result{}, nil
+}
+
+// startRestore creates the restore Job once the MongoDB resource is running and the backup to restore,
+// if any, succeeded
+func (r *RestoreReconciler) startRestore(restore mdbv1.MongoDBRestore) (reconcile.Result, error) {
+	if restore.Spec.Clone != nil {
+		if proceed, res, err := r.ensureClone(restore); !proceed {
+			return res, err
+		}
+	}
+
+	mdb := mdbv1.MongoDB{}
+	if err := r.client.Get(context.TODO(), restore.MongoDBNamespacedName(), &mdb); err != nil {
+		if errors.IsNotFound(err) {
+			return r.pending(restore, fmt.Sprintf("The MongoDB resource %s doesn't exist", restore.Spec.MongoDB))
+		}
+		return reconcile.Result{}, fmt.Errorf("error getting MongoDB resource: %s", err)
+	}
+	if mdb.Status.Phase != mdbv1.Running {
+		return r.pending(restore, fmt.Sprintf("Waiting for the MongoDB resource %s to be running", mdb.Name))
+	}
+
+	var backup *mdbv1.MongoDBBackup
+	if restore.Spec.Backup != "" {
+		backup = &mdbv1.MongoDBBackup{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: restore.Spec.Backup, Namespace: restore.Namespace}, backup); err != nil {
+			if errors.IsNotFound(err) {
+				return r.pending(restore, fmt.Sprintf("The MongoDBBackup %s doesn't exist", restore.Spec.Backup))
+			}
+			return reconcile.Result{}, fmt.Errorf("error getting MongoDBBackup: %s", err)
+		}
+		switch backup.Status.Phase {
+		case mdbv1.BackupSucceeded:
+		case mdbv1.BackupFailed:
+			return reconcile.Result{}, r.fail(restore, fmt.Sprintf("The MongoDBBackup %s failed", backup.Name))
+		default:
+			return r.pending(restore, fmt.Sprintf("Waiting for the MongoDBBackup %s to succeed", backup.Name))
+		}
+	}
+
+	var replay *oplogReplay
+	if restore.Spec.PointInTime != nil {
+		var message string
+		var err error
+		replay, message, err = r.getOplogReplay(restore, mdb, backup)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if message != "" {
+			return reconcile.Result{}, r.fail(restore, message)
+		}
+	}
+
+	job := buildRestoreJob(restore, mdb, backup, replay)
+	if err := r.client.Create(context.TODO(), &job); err != nil && !errors.IsAlreadyExists(err) {
+		return reconcile.Result{}, fmt.Errorf("error creating restore Job: %s", err)
+	}
+	now := metav1.NewTime(r.now())
+	restore.Status.Phase, restore.Status.Message = mdbv1.RestoreRunning, ""
+	restore.Status.Job = job.Name
+	restore.Status.StartTime = &now
+	restore.SetCondition(newCondition(mdbv1.Complete, corev1.ConditionFalse, string(mdbv1.RestoreRunning), fmt.Sprintf("Job %s is restoring %s", job.Name, restoreSourceName(restore))))
+	r.log.Infof("Restoring %s into %s with the Job %s", restoreSourceName(restore), mdb.Name, job.Name)
+	if r.recorder != nil {
+		r.recorder.Eventf(&restore, corev1.EventTypeNormal, restoreStartedEventReason, "Restoring %s into %s with the Job %s", restoreSourceName(restore), mdb.Name, job.Name)
+	}
+	return reconcile.Result{}, r.updateStatus(restore)
+}
+
+// getOplogReplay returns the archived oplog replayed by a point in time restore, or why it can't be
+// replayed
+func (r *RestoreReconciler) getOplogReplay(restore mdbv1.MongoDBRestore, mdb mdbv1.MongoDB, backup *mdbv1.MongoDBBackup) (*oplogReplay, string, error) {
+	source := mdb
+	name := restore.Spec.PointInTime.MongoDB
+	if name == "" && restore.Spec.Clone != nil {
+		name = cloneSourceName(restore, backup)
+	}
+	if name != "" && name != mdb.Name {
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: restore.Namespace}, &source); err != nil {
+			if errors.IsNotFound(err) {
+				return nil, fmt.Sprintf("The MongoDB resource %s doesn't exist", name), nil
+			}
+			return nil, "", fmt.Errorf("error getting MongoDB resource: %s", err)
+		}
+	}
+	if usesPBM(source) {
+		return nil, fmt.Sprintf("The oplog of the MongoDB resource %s is archived by PBM, restore it with \"pbm restore --time\" in a pbm-agent container", source.Name), nil
+	}
+	if source.Spec.Backup == nil || source.Spec.Backup.PointInTime == nil || source.Spec.Backup.Target.S3 == nil {
+		return nil, fmt.Sprintf("The oplog of the MongoDB resource %s isn't archived, spec.backup.pointInTime must be set", source.Name), nil
+	}
+	from, ok := archiveTime(restore, backup)
+	if !ok {
+		return nil, "The time the archive was taken at isn't known, only the oplog of a MongoDBBackup or of a scheduled backup can be replayed", nil
+	}
+	until := restore.Spec.PointInTime.Time.Time
+	if from.After(until) {
+		return nil, fmt.Sprintf("The archive was taken at %s, after the point in time", from.UTC().Format(time.RFC3339)), nil
+	}
+	encryption := restore.Spec.Encryption
+	if encryption == nil {
+		encryption = source.Spec.Backup.Encryption
+	}
+	return &oplogReplay{target: *source.Spec.Backup.Target.S3, encryption: encryption, from: from, until: until}, "", nil
+}
+
+// ensureClone creates the MongoDB resource of a clone restore from the spec of its source, unless it
+// was already created by the restore. It returns false when the restore can't proceed yet, or fails
+// because a resource with the same name already exists.
+func (r *RestoreReconciler) ensureClone(restore mdbv1.MongoDBRestore) (bool, reconcile.Result, error) {
+	existing := mdbv1.MongoDB{}
+	err := r.client.Get(context.TODO(), restore.MongoDBNamespacedName(), &existing)
+	if err == nil {
+		if existing.Annotations[clonedByAnnotationKey] != restore.Name {
+			return false, reconcile.Result{}, r.fail(restore, fmt.Sprintf("The MongoDB resource %s already exists, a clone restore creates a new one", existing.Name))
+		}
+		return true, reconcile.Result{}, nil
+	}
+	if !errors.IsNotFound(err) {
+		return false, reconcile.Result{}, fmt.Errorf("error getting MongoDB resource: %s", err)
+	}
+
+	var backup *mdbv1.MongoDBBackup
+	if restore.Spec.Clone.Source == "" {
+		backup = &mdbv1.MongoDBBackup{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: restore.Spec.Backup, Namespace: restore.Namespace}, backup); err != nil {
+			if errors.IsNotFound(err) {
+				res, err := r.pending(restore, fmt.Sprintf("The MongoDBBackup %s doesn't exist", restore.Spec.Backup))
+				return false, res, err
+			}
+			return false, reconcile.Result{}, fmt.Errorf("error getting MongoDBBackup: %s", err)
+		}
+	}
+	source := mdbv1.MongoDB{}
+	sourceName := cloneSourceName(restore, backup)
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: sourceName, Namespace: restore.Namespace}, &source); err != nil {
+		if errors.IsNotFound(err) {
+			return false, reconcile.Result{}, r.fail(restore, fmt.Sprintf("The MongoDB resource %s to clone doesn't exist", sourceName))
+		}
+		return false, reconcile.Result{}, fmt.Errorf("error getting MongoDB resource: %s", err)
+	}
+
+	clone := buildClone(restore, source)
+	if err := r.client.Create(context.TODO(), &clone); err != nil {
+		return false, reconcile.Result{}, fmt.Errorf("error creating MongoDB resource: %s", err)
+	}
+	r.log.Infof("Created the MongoDB resource %s from the spec of %s", clone.Name, source.Name)
+	if r.recorder != nil {
+		r.recorder.Eventf(&restore, corev1.EventTypeNormal, cloneCreatedEventReason, "Created the MongoDB resource %s from the spec of %s", clone.Name, source.Name)
+	}
+	return true, reconcile.Result{}, nil
+}
+
+// cloneSourceName returns the name of the MongoDB resource whose spec is copied by a clone restore
+func cloneSourceName(restore mdbv1.MongoDBRestore, backup *mdbv1.MongoDBBackup) string {
+	if restore.Spec.Clone.Source != "" || backup == nil {
+		return restore.Spec.Clone.Source
+	}
+	return backup.Spec.MongoDB
+}
+
+// buildClone returns the MongoDB resource created by a clone restore. It isn't owned by the restore,
+// and doesn't take backups nor load data on creation, as the archive is restored into it.
+func buildClone(restore mdbv1.MongoDBRestore, source mdbv1.MongoDB) mdbv1.MongoDB {
+	spec := *source.Spec.DeepCopy()
+	spec.Backup, spec.Bootstrap, spec.InitFrom, spec.Adopt, spec.RestartedAt = nil, nil, nil, nil, nil
+	if restore.Spec.Clone.Members != 0 {
+		spec.Members = restore.Spec.Clone.Members
+	}
+	return mdbv1.MongoDB{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        restore.Spec.MongoDB,
+			Namespace:   restore.Namespace,
+			Annotations: map[string]string{clonedByAnnotationKey: restore.Name},
+		},
+		Spec: spec,
+	}
+}
+
+// pending records why the restore can't start yet, and checks again later
+func (r *RestoreReconciler) pending(restore mdbv1.MongoDBRestore, message string) (reconcile.Result, error) {
+	if restore.Status.Phase != mdbv1.RestorePending || restore.Status.Message != message {
+		r.log.Info(message)
+		restore.Status.Phase, restore.Status.Message = mdbv1.RestorePending, message
+		restore.SetCondition(newCondition(mdbv1.Complete, corev1.ConditionFalse, string(mdbv1.RestorePending), message))
+		if err := r.updateStatus(restore); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return reconcile.Result{RequeueAfter: operationPendingRequeueInterval}, nil
+}
+
+// fail marks the restore as failed, it isn't retried
+func (r *RestoreReconciler) fail(restore mdbv1.MongoDBRestore, message string) error {
+	now := metav1.NewTime(r.now())
+	restore.Status.Phase, restore.Status.Message = mdbv1.RestoreFailed, message
+	restore.Status.CompletionTime = &now
+	restore.SetCondition(newCondition(mdbv1.Complete, corev1.ConditionFalse, operationFailedReason, message))
+	r.log.Warnf("Restore failed: %s", message)
+	if r.recorder != nil {
+		r.recorder.Event(&restore, corev1.EventTypeWarning, restoreFailedEventReason, message)
+	}
+	return r.updateStatus(restore)
+}
+
+func (r *RestoreReconciler) updateStatus(restore mdbv1.MongoDBRestore) error {
+	if err := r.client.Status().Update(context.TODO(), &restore); err != nil {
+		return fmt.Errorf("error updating status: %s", err)
+	}
+	return nil
+}
+
+// validateMongoDBRestore ensures the restore refers to a MongoDB resource and to exactly one archive
+func validateMongoDBRestore(restore mdbv1.MongoDBRestore) error {
+	if restore.Spec.MongoDB == "" {
+		return fmt.Errorf("the MongoDB resource must be set")
+	}
+	if (restore.Spec.Backup == "") == (restore.Spec.ArchiveURL == "") {
+		return fmt.Errorf("exactly one of backup and archiveURL must be set")
+	}
+	if clone := restore.Spec.Clone; clone != nil {
+		if clone.Source == "" && restore.Spec.Backup == "" {
+			return fmt.Errorf("the source of clone must be set to restore an archiveURL")
+		}
+		if clone.Members < 0 {
+			return fmt.Errorf("the members of clone can't be negative")
+		}
+	}
+	if restore.Spec.PointInTime != nil && restore.Spec.PointInTime.Time.IsZero() {
+		return fmt.Errorf("the time of pointInTime must be set")
+	}
+	if err := validateBackupEncryption(restore.Spec.Encryption); err != nil {
+		return err
+	}
+	if restore.Spec.ArchiveURL != "" {
+		return validateArchiveURL(restore.Spec.ArchiveURL)
+	}
+	return nil
+}
+
+// restoreSourceName describes the archive restored, and the point in time restored at if any, for the
+// status and the events
+func restoreSourceName(restore mdbv1.MongoDBRestore) string {
+	name := restore.Spec.ArchiveURL
+	if restore.Spec.Backup != "" {
+		name = fmt.Sprintf("the MongoDBBackup %s", restore.Spec.Backup)
+	}
+	if restore.Spec.PointInTime != nil {
+		name += fmt.Sprintf(" at %s", restore.Spec.PointInTime.Time.UTC().Format(time.RFC3339))
+	}
+	return name
+}
+
+func restoreJobNamespacedName(restore mdbv1.MongoDBRestore) types.NamespacedName {
+	return types.NamespacedName{Name: restore.Name + "-restore", Namespace: restore.Namespace}
+}
+
+// buildRestoreJob returns the Job restoring the archive of the MongoDBRestore with mongorestore, owned
+// by it. The archive of a backup stored in a PersistentVolumeClaim is read from the volume, and other
+// archives are downloaded by an init container. An encrypted archive is decrypted as it is restored.
+// The oplog replayed by a point in time restore, if any,
+// is downloaded by another init container and replayed once the archive is restored. The agent user
+// is used when authentication is enabled.
+func buildRestoreJob(restore mdbv1.MongoDBRestore, mdb mdbv1.MongoDB, backup *mdbv1.MongoDBBackup, replay *oplogReplay) batchv1.Job {
+	archivePath, source := restoreArchiveSource(restore, backup)
+	archiveEncryption := restoreArchiveEncryption(restore, backup)
+	uri, connectionOptions, connection := mongoToolConnection(mdb, restoreContainerName)
+	archiveOption := "--archive=" + archivePath
+	if archiveEncryption != nil {
+		archiveOption = "--archive"
+	}
+	command := fmt.Sprintf(`mongorestore --uri "%s"%s %s --gzip`, uri, connectionOptions, archiveOption)
+	if restore.Spec.Drop {
+		command += " --drop"
+	}
+	encryption := podtemplatespec.NOOP()
+	if archiveEncryption != nil {
+		// mongorestore reads the archive decrypted to stdin, the restore fails if it can't be
+		// authenticated entirely
+		command = fmt.Sprintf(`{ %s; echo $? > /tmp/decrypt-code; } | %s && [ "$(cat /tmp/decrypt-code)" = 0 ]`,
+			decryptCommand(archivePath, encryptionKeyEnv), command)
+		encryption = podtemplatespec.Apply(
+			withBackupCrypt(restoreContainerName),
+			podtemplatespec.WithContainer(restoreContainerName, encryptionKey(*archiveEncryption, encryptionKeyEnv)),
+		)
+	}
+	oplog := podtemplatespec.NOOP()
+	if replay != nil {
+		var prepare string
+		prepare, oplog = oplogReplaySource(*replay)
+		command = fmt.Sprintf("%s && %s && exec %s", prepare, command, oplogReplayCommand(uri, connectionOptions, *replay))
+	} else if archiveEncryption == nil {
+		command = "exec " + command
+	}
+
+	labels := map[string]string{"app": restore.Name + "-restore"}
+	template := corev1.PodTemplateSpec{}
+	podtemplatespec.Apply(
+		podtemplatespec.WithPodLabels(labels),
+		podtemplatespec.WithContainer(restoreContainerName, container.Apply(
+			container.WithName(restoreContainerName),
+			container.WithImage(fmt.Sprintf("mongo:%s", mdb.Spec.Version)),
+			container.WithCommand([]string{"/bin/sh", "-c", command}),
+		)),
+		source,
+		encryption,
+		oplog,
+		connection,
+	)(&template)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	backoffLimit := int32(bootstrapBackoffLimit)
+	nsName := restoreJobNamespacedName(restore)
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            nsName.Name,
+			Namespace:       nsName.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{operationOwnerReference(&restore, "MongoDBRestore")},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}
+}
+
+// restoreArchiveEncryption returns the encryption of the archive restored, if any
+func restoreArchiveEncryption(restore mdbv1.MongoDBRestore, backup *mdbv1.MongoDBBackup) *mdbv1.BackupEncryption {
+	if restore.Spec.Encryption != nil || backup == nil {
+		return restore.Spec.Encryption
+	}
+	return backup.Spec.Encryption
+}
+
+// restoreArchiveSource returns the path the restore container reads the archive from, and the
+// modification making it available there
+func restoreArchiveSource(restore mdbv1.MongoDBRestore, backup *mdbv1.MongoDBBackup) (string, podtemplatespec.Modification) {
+	if backup != nil && backup.Spec.Target.PersistentVolumeClaim != nil {
+		target := backup.Spec.Target.PersistentVolumeClaim
+		volume := statefulset.CreateVolumeFromPersistentVolumeClaim("backup", target.ClaimName)
+		volumeMount := statefulset.CreateVolumeMount(volume.Name, backupMountPath, statefulset.WithReadOnly(true))
+		return path.Join(backupMountPath, target.Path, mongoDBBackupArchiveName(*backup)), podtemplatespec.Apply(
+			podtemplatespec.WithVolume(volume),
+			podtemplatespec.WithVolumeMounts(restoreContainerName, volumeMount),
+		)
+	}
+
+	archiveVolume := statefulset.CreateVolumeFromEmptyDir("archive")
+	archiveVolumeMount := statefulset.CreateVolumeMount(archiveVolume.Name, "/archive", statefulset.WithReadOnly(false))
+	download := downloadArchiveContainer(mdbv1.Bootstrap{ArchiveURL: restore.Spec.ArchiveURL, CredentialsSecretName: restore.Spec.CredentialsSecretName}, archiveVolumeMount)
+	if backup != nil {
+		target := *backup.Spec.Target.S3
+		download = container.Apply(
+			container.WithName("download"),
+			container.WithImage(awsCLIImage),
+			container.WithCommand([]string{"/bin/sh", "-c", fmt.Sprintf(`exec aws%s s3 cp "%s" %s`,
+				s3EndpointOption(target), s3BackupObject(target, mongoDBBackupArchiveName(*backup)), bootstrapArchivePath)}),
+			container.WithVolumeMounts([]corev1.VolumeMount{archiveVolumeMount}),
+			s3Credentials(target),
+		)
+	}
+	return bootstrapArchivePath, podtemplatespec.Apply(
+		podtemplatespec.WithVolume(archiveVolume),
+		podtemplatespec.WithVolumeMounts(restoreContainerName, archiveVolumeMount),
+		podtemplatespec.WithInitContainer("download", download),
+	)
+}
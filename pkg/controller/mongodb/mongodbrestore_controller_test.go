@@ -0,0 +1,258 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newTestMongoDBRestore() mdbv1.MongoDBRestore {
+	return mdbv1.MongoDBRestore{
+		ObjectMeta: metav1.ObjectMeta{Name: "rollback", Namespace: "my-ns"},
+		Spec: mdbv1.MongoDBRestoreSpec{
+			MongoDB: "my-rs",
+			Backup:  "before-migration",
+			Drop:    true,
+		},
+	}
+}
+
+func TestRestoreReconciler_RestoresTheBackupOnceItSucceeded(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Status.Phase = mdbv1.Running
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	backup := newTestMongoDBBackup()
+	backup.Status.Phase = mdbv1.BackupRunning
+	assert.NoError(t, c.Create(context.TODO(), &backup))
+	restore := newTestMongoDBRestore()
+	assert.NoError(t, c.Create(context.TODO(), &restore))
+	r := newRestoreReconciler(mgr)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, operationPendingRequeueInterval, res.RequeueAfter)
+	_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+	assert.Equal(t, mdbv1.RestorePending, restore.Status.Phase)
+	assert.Equal(t, "Waiting for the MongoDBBackup before-migration to succeed", restore.Status.Message)
+
+	backup.Status.Phase = mdbv1.BackupSucceeded
+	assert.NoError(t, c.Status().Update(context.TODO(), &backup))
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+	assert.NoError(t, err)
+	_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+	assert.Equal(t, mdbv1.RestoreRunning, restore.Status.Phase)
+	assert.Equal(t, "rollback-restore", restore.Status.Job)
+
+	job := batchv1.Job{}
+	assert.NoError(t, c.Get(context.TODO(), restoreJobNamespacedName(restore), &job))
+	assert.Equal(t, "MongoDBRestore", job.OwnerReferences[0].Kind)
+	podSpec := job.Spec.Template.Spec
+	assert.Empty(t, podSpec.InitContainers, "the archive is read from the volume of the backup")
+	assert.Equal(t, "backups", podSpec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	restoreContainer := podSpec.Containers[0]
+	assert.True(t, restoreContainer.VolumeMounts[0].ReadOnly)
+	assert.Contains(t, restoreContainer.Command[2], "exec mongorestore --uri")
+	assert.Contains(t, restoreContainer.Command[2], "--archive=/backup/my-rs/before-migration.archive.gz --gzip --drop")
+	assert.Equal(t, "AGENT_PASSWORD", restoreContainer.Env[0].Name)
+
+	t.Run("The restore succeeds with its Job", func(t *testing.T) {
+		job.Status.Succeeded = 1
+		assert.NoError(t, c.Update(context.TODO(), &job))
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+		assert.NoError(t, err)
+		_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+		assert.Equal(t, mdbv1.RestoreSucceeded, restore.Status.Phase)
+		assertOperationCondition(t, restore.GetCondition(mdbv1.Complete), corev1.ConditionTrue, "Succeeded")
+		assert.Equal(t, "Restored the MongoDBBackup before-migration into my-rs", restore.GetCondition(mdbv1.Complete).Message)
+	})
+}
+
+func TestRestoreReconciler_FailsWhenTheBackupFailed(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Status.Phase = mdbv1.Running
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	backup := newTestMongoDBBackup()
+	backup.Status.Phase = mdbv1.BackupFailed
+	assert.NoError(t, c.Create(context.TODO(), &backup))
+	restore := newTestMongoDBRestore()
+	assert.NoError(t, c.Create(context.TODO(), &restore))
+	r := newRestoreReconciler(mgr)
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+	assert.NoError(t, err)
+	_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+	assert.Equal(t, mdbv1.RestoreFailed, restore.Status.Phase)
+	assert.Equal(t, "The MongoDBBackup before-migration failed", restore.Status.Message)
+	assertOperationCondition(t, restore.GetCondition(mdbv1.Complete), corev1.ConditionFalse, operationFailedReason)
+}
+
+func TestBuildRestoreJob_DownloadsTheArchive(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+
+	t.Run("From a backup stored in S3", func(t *testing.T) {
+		backup := newTestMongoDBBackup()
+		backup.Spec.Target = mdbv1.BackupTarget{S3: &mdbv1.BackupS3Target{Bucket: "backups", Prefix: "my-rs", Endpoint: "http://minio:9000", CredentialsSecretName: "minio-credentials"}}
+		podSpec := buildRestoreJob(newTestMongoDBRestore(), mdb, &backup, nil).Spec.Template.Spec
+		download := podSpec.InitContainers[0]
+		assert.Equal(t, awsCLIImage, download.Image)
+		assert.Equal(t, `exec aws --endpoint-url "http://minio:9000" s3 cp "s3://backups/my-rs/before-migration.archive.gz" /archive/archive.gz`, download.Command[2])
+		assert.Equal(t, "minio-credentials", download.EnvFrom[0].SecretRef.Name)
+		assert.Contains(t, podSpec.Containers[0].Command[2], "--archive=/archive/archive.gz --gzip")
+	})
+
+	t.Run("From a URL", func(t *testing.T) {
+		restore := newTestMongoDBRestore()
+		restore.Spec.Backup, restore.Spec.ArchiveURL = "", "https://backups.example.com/my-rs.archive.gz"
+		podSpec := buildRestoreJob(restore, mdb, nil, nil).Spec.Template.Spec
+		assert.Equal(t, curlImage, podSpec.InitContainers[0].Image)
+		assert.Contains(t, podSpec.InitContainers[0].Command[2], "https://backups.example.com/my-rs.archive.gz")
+	})
+}
+
+func TestValidateMongoDBRestore(t *testing.T) {
+	restore := newTestMongoDBRestore()
+	assert.NoError(t, validateMongoDBRestore(restore))
+
+	restore.Spec.ArchiveURL = "s3://backups/my-rs.archive.gz"
+	assert.EqualError(t, validateMongoDBRestore(restore), "exactly one of backup and archiveURL must be set")
+
+	restore.Spec.Backup = ""
+	assert.NoError(t, validateMongoDBRestore(restore))
+
+	restore.Spec.ArchiveURL = "ftp://backups/my-rs.archive.gz"
+	assert.Error(t, validateMongoDBRestore(restore))
+
+	restore = newTestMongoDBRestore()
+	restore.Spec.PointInTime = &mdbv1.RestorePointInTime{}
+	assert.EqualError(t, validateMongoDBRestore(restore), "the time of pointInTime must be set")
+
+	restore = newTestMongoDBRestore()
+	restore.Spec.Backup, restore.Spec.ArchiveURL = "", "s3://backups/my-rs.archive.gz"
+	restore.Spec.Clone = &mdbv1.RestoreClone{}
+	assert.EqualError(t, validateMongoDBRestore(restore), "the source of clone must be set to restore an archiveURL")
+	restore.Spec.Clone.Source = "my-rs"
+	assert.NoError(t, validateMongoDBRestore(restore))
+}
+
+func TestRestoreReconciler_ReplaysTheOplogUpToThePointInTime(t *testing.T) {
+	mdb := newPointInTimeReplicaSet()
+	mdb.Status.Phase = mdbv1.Running
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	backup := newTestMongoDBBackup()
+	backup.Status.Phase = mdbv1.BackupSucceeded
+	backupStart := metav1.NewTime(time.Date(2026, 1, 3, 3, 0, 0, 0, time.UTC))
+	backup.Status.StartTime = &backupStart
+	assert.NoError(t, c.Create(context.TODO(), &backup))
+	restore := newTestMongoDBRestore()
+	restore.Spec.PointInTime = &mdbv1.RestorePointInTime{Time: metav1.NewTime(time.Date(2026, 1, 3, 10, 15, 0, 0, time.UTC))}
+	assert.NoError(t, c.Create(context.TODO(), &restore))
+	r := newRestoreReconciler(mgr)
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+	assert.NoError(t, err)
+	_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+	assert.Equal(t, mdbv1.RestoreRunning, restore.Status.Phase)
+	assert.Equal(t, "Job rollback-restore is restoring the MongoDBBackup before-migration at 2026-01-03T10:15:00Z", restore.GetCondition(mdbv1.Complete).Message)
+
+	job := batchv1.Job{}
+	assert.NoError(t, c.Get(context.TODO(), restoreJobNamespacedName(restore), &job))
+	podSpec := job.Spec.Template.Spec
+	download := podSpec.InitContainers[0]
+	assert.Equal(t, oplogDownloadContainerName, download.Name)
+	assert.Contains(t, download.Command[2], `aws --endpoint-url "http://minio:9000" s3 ls "s3://backups/my-rs/oplog/"`)
+	assert.Contains(t, download.Command[2], "$3 >= 1767409200 && $1 <= 1767435300")
+	assert.Equal(t, "minio-credentials", download.EnvFrom[0].SecretRef.Name)
+	command := podSpec.Containers[0].Command[2]
+	assert.Contains(t, command, "cat /oplog/*.bson.gz | gunzip > /oplog/oplog.bson")
+	assert.Contains(t, command, "--archive=/backup/my-rs/before-migration.archive.gz --gzip --drop && exec mongorestore")
+	assert.Contains(t, command, "--oplogReplay --oplogFile=/oplog/oplog.bson --oplogLimit=1767435301:0 /oplog/dump")
+
+	t.Run("The restore fails when the oplog isn't archived", func(t *testing.T) {
+		restore := newTestMongoDBRestore()
+		restore.Name = "without-oplog"
+		restore.Spec.PointInTime = &mdbv1.RestorePointInTime{Time: metav1.NewTime(time.Date(2026, 1, 3, 10, 15, 0, 0, time.UTC)), MongoDB: "other-rs"}
+		other := newBackupReplicaSet()
+		other.Name = "other-rs"
+		assert.NoError(t, c.Create(context.TODO(), &other))
+		assert.NoError(t, c.Create(context.TODO(), &restore))
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+		assert.NoError(t, err)
+		_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+		assert.Equal(t, mdbv1.RestoreFailed, restore.Status.Phase)
+		assert.Equal(t, "The oplog of the MongoDB resource other-rs isn't archived, spec.backup.pointInTime must be set", restore.Status.Message)
+	})
+
+	t.Run("The restore fails when the archive was taken after the point in time", func(t *testing.T) {
+		restore := newTestMongoDBRestore()
+		restore.Name = "too-early"
+		restore.Spec.PointInTime = &mdbv1.RestorePointInTime{Time: metav1.NewTime(time.Date(2026, 1, 3, 2, 0, 0, 0, time.UTC))}
+		assert.NoError(t, c.Create(context.TODO(), &restore))
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+		assert.NoError(t, err)
+		_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+		assert.Equal(t, mdbv1.RestoreFailed, restore.Status.Phase)
+		assert.Equal(t, "The archive was taken at 2026-01-03T03:00:00Z, after the point in time", restore.Status.Message)
+	})
+}
+
+func TestRestoreReconciler_RestoresIntoAClone(t *testing.T) {
+	mdb := newPointInTimeReplicaSet()
+	mdb.Status.Phase = mdbv1.Running
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	backup := newTestMongoDBBackup()
+	backup.Status.Phase = mdbv1.BackupSucceeded
+	assert.NoError(t, c.Create(context.TODO(), &backup))
+	restore := newTestMongoDBRestore()
+	restore.Spec.MongoDB = "my-rs-clone"
+	restore.Spec.Clone = &mdbv1.RestoreClone{Members: 1}
+	assert.NoError(t, c.Create(context.TODO(), &restore))
+	r := newRestoreReconciler(mgr)
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+	assert.NoError(t, err)
+	clone := mdbv1.MongoDB{}
+	assert.NoError(t, c.Get(context.TODO(), restore.MongoDBNamespacedName(), &clone))
+	assert.Equal(t, "rollback", clone.Annotations[clonedByAnnotationKey])
+	assert.Empty(t, clone.OwnerReferences, "the clone is kept when the restore is deleted")
+	assert.Equal(t, 1, clone.Spec.Members)
+	assert.Equal(t, mdb.Spec.Version, clone.Spec.Version)
+	assert.Nil(t, clone.Spec.Backup, "the clone doesn't take backups to the target of its source")
+	_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+	assert.Equal(t, mdbv1.RestorePending, restore.Status.Phase)
+	assert.Equal(t, "Waiting for the MongoDB resource my-rs-clone to be running", restore.Status.Message)
+
+	clone.Status.Phase = mdbv1.Running
+	assert.NoError(t, c.Status().Update(context.TODO(), &clone))
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+	assert.NoError(t, err)
+	_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+	assert.Equal(t, mdbv1.RestoreRunning, restore.Status.Phase)
+	job := batchv1.Job{}
+	assert.NoError(t, c.Get(context.TODO(), restoreJobNamespacedName(restore), &job))
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Command[2], "mongodb://my-rs-clone-0.my-rs-clone-svc.my-ns.svc.cluster.local:27017/?replicaSet=my-rs-clone")
+
+	t.Run("The restore fails when the resource already exists", func(t *testing.T) {
+		restore := newTestMongoDBRestore()
+		restore.Name = "clone-over-source"
+		restore.Spec.Clone = &mdbv1.RestoreClone{}
+		assert.NoError(t, c.Create(context.TODO(), &restore))
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: restore.NamespacedName()})
+		assert.NoError(t, err)
+		_ = c.Get(context.TODO(), restore.NamespacedName(), &restore)
+		assert.Equal(t, mdbv1.RestoreFailed, restore.Status.Phase)
+		assert.Equal(t, "The MongoDB resource my-rs already exists, a clone restore creates a new one", restore.Status.Message)
+	})
+}
@@ -0,0 +1,28 @@
+package mongodb
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// maxConcurrentReconciles is how many MongoDB resources are reconciled at the same time, a resource is
+// never reconciled by two workers at once
+var maxConcurrentReconciles = 1
+
+// SetMaxConcurrentReconciles sets how many MongoDB resources are reconciled at the same time. It must
+// be called before the controllers are added to the Manager.
+func SetMaxConcurrentReconciles(n int) {
+	maxConcurrentReconciles = n
+}
+
+// reconcilerPerRequest reconciles each request with its own copy of the ReplicaSetReconciler, which
+// holds the state of the current reconciliation, so that the workers of the controller don't share it
+type reconcilerPerRequest struct {
+	r *ReplicaSetReconciler
+}
+
+var _ reconcile.Reconciler = reconcilerPerRequest{}
+
+func (p reconcilerPerRequest) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	r := *p.r
+	return r.Reconcile(request)
+}
@@ -0,0 +1,28 @@
+package mongodb
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcilerPerRequest(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Generation = 3
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	log := r.log
+
+	res, err := reconcilerPerRequest{r: r}.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_, err = c.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+
+	assert.Zero(t, r.observedGeneration, "the state of the reconciliation is held by a copy of the reconciler")
+	assert.False(t, r.isReady)
+	assert.Same(t, log, r.log)
+}
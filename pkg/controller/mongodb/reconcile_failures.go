@@ -0,0 +1,72 @@
+package mongodb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// reconciliationBackedOffEventReason is emitted once a resource failed too many consecutive times
+	reconciliationBackedOffEventReason = "ReconciliationBackedOff"
+	// repeatedFailuresReason is the reason of the Degraded condition of a resource backed off
+	repeatedFailuresReason = "RepeatedFailures"
+)
+
+// reconcileFailureThreshold is how many consecutive reconciliations of a resource can fail before it is
+// backed off, 0 disables it
+var reconcileFailureThreshold = 10
+
+// reconcileFailureBackoff is how long a resource backed off waits before being reconciled again
+var reconcileFailureBackoff = 15 * time.Minute
+
+// SetReconcileFailureThreshold sets how many consecutive reconciliations of a resource can fail before
+// it is only retried every reconcile failure backoff, 0 disables it
+func SetReconcileFailureThreshold(n int) {
+	reconcileFailureThreshold = n
+}
+
+// SetReconcileFailureBackoff sets how long a resource which failed too many consecutive times waits
+// before being reconciled again
+func SetReconcileFailureBackoff(d time.Duration) {
+	reconcileFailureBackoff = d
+}
+
+// reconcileFailures counts the consecutive failed reconciliations of every resource, so that a resource
+// which keeps failing, such as one whose deployment is broken, is only retried every
+// reconcileFailureBackoff instead of being retried with the backoff of the controller, and doesn't keep
+// the workers from reconciling the other resources. A change of the resource is still reconciled
+// straight away, the count is reset once a reconciliation succeeds.
+type reconcileFailures struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+func newReconcileFailures() *reconcileFailures {
+	return &reconcileFailures{failures: map[types.NamespacedName]int{}}
+}
+
+// record records the outcome of a reconciliation of the resource, and returns how many consecutive
+// reconciliations of the resource have failed
+func (f *reconcileFailures) record(nsName types.NamespacedName, err error) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.failures, nsName)
+		return 0
+	}
+	f.failures[nsName]++
+	return f.failures[nsName]
+}
+
+// isBackedOff returns true if the resource failed enough consecutive times to be backed off
+func isBackedOff(consecutiveFailures int) bool {
+	return reconcileFailureThreshold > 0 && consecutiveFailures >= reconcileFailureThreshold
+}
+
+// backedOffMessage describes the error of a resource backed off, and when it is retried
+func (r *ReplicaSetReconciler) backedOffMessage(reconcileErr error) string {
+	return fmt.Sprintf("reconciliation failed %d consecutive times, retrying in %s: %s", r.consecutiveFailures, reconcileFailureBackoff, reconcileErr)
+}
@@ -0,0 +1,88 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileFailures(t *testing.T) {
+	failures := newReconcileFailures()
+	rs := types.NamespacedName{Name: "my-rs", Namespace: "my-ns"}
+	other := types.NamespacedName{Name: "other-rs", Namespace: "my-ns"}
+
+	assert.Equal(t, 1, failures.record(rs, assert.AnError))
+	assert.Equal(t, 2, failures.record(rs, assert.AnError))
+	assert.Equal(t, 1, failures.record(other, assert.AnError), "each resource has its own count")
+	assert.Equal(t, 0, failures.record(rs, nil))
+	assert.Equal(t, 1, failures.record(rs, assert.AnError), "the count is reset once a reconciliation succeeds")
+}
+
+func TestIsBackedOff(t *testing.T) {
+	defer SetReconcileFailureThreshold(reconcileFailureThreshold)
+
+	SetReconcileFailureThreshold(3)
+	assert.False(t, isBackedOff(2))
+	assert.True(t, isBackedOff(3))
+
+	SetReconcileFailureThreshold(0)
+	assert.False(t, isBackedOff(100), "the backoff is disabled")
+}
+
+func TestReconcile_BacksOffAfterRepeatedFailures(t *testing.T) {
+	defer SetReconcileFailureThreshold(reconcileFailureThreshold)
+	SetReconcileFailureThreshold(3)
+
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	manifestErr := errors.New("manifest unavailable")
+	r := newReconciler(mgr, func() (automationconfig.VersionManifest, error) {
+		if manifestErr != nil {
+			return automationconfig.VersionManifest{}, manifestErr
+		}
+		return testutils.MockManifestProvider(mdb.Spec.Version)()
+	})
+	recorder := record.NewFakeRecorder(20)
+	r.recorder = recorder
+
+	for i := 0; i < 2; i++ {
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.Error(t, err, "the error is retried with the backoff of the controller")
+	}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.Degraded, corev1.ConditionTrue, reconciliationErrorReason)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: 15 * time.Minute}, res)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.Degraded, corev1.ConditionTrue, repeatedFailuresReason)
+	assert.Contains(t, mdb.GetCondition(mdbv1.Degraded).Message, "failed 3 consecutive times")
+	assert.Contains(t, mdb.Status.Message, "manifest unavailable")
+	assert.Contains(t, strings.Join(recordedEvents(recorder), "\n"), "Warning "+reconciliationBackedOffEventReason)
+
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, res.RequeueAfter)
+	assert.NotContains(t, strings.Join(recordedEvents(recorder), "\n"), reconciliationBackedOffEventReason, "the event is only emitted once")
+
+	manifestErr = nil
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assertCondition(t, mdb, mdbv1.Degraded, corev1.ConditionFalse, healthyReason)
+	assert.Equal(t, 1, r.reconcileFailures.record(mdb.NamespacedName(), assert.AnError), "the count is reset")
+}
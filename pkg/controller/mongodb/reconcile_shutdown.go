@@ -0,0 +1,85 @@
+package mongodb
+
+import (
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// operatorShutdown tracks the reconciliations of all the controllers, so that the operator waits for
+// the ones in progress before it exits
+var operatorShutdown = &reconcileShutdown{}
+
+// Shutdown stops the controllers from starting new reconciliations, and waits up to the timeout for
+// the ones in progress to finish and write the status of their resource, so that stopping the
+// operator doesn't leave a replica set half reconfigured. It must be called before the Manager is
+// stopped, as the reconciliations in progress still use its client. It returns false if some
+// reconciliations were still in progress after the timeout.
+func Shutdown(timeout time.Duration) bool {
+	return operatorShutdown.wait(timeout)
+}
+
+// reconcileShutdown counts the reconciliations in progress, and refuses to start new ones once the
+// operator is shutting down
+type reconcileShutdown struct {
+	mu       sync.Mutex
+	stopping bool
+	inFlight sync.WaitGroup
+}
+
+// begin records the start of a reconciliation, it returns false if the operator is shutting down
+func (s *reconcileShutdown) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return false
+	}
+	s.inFlight.Add(1)
+	return true
+}
+
+// end records the end of a reconciliation started with begin
+func (s *reconcileShutdown) end() {
+	s.inFlight.Done()
+}
+
+// wait refuses the new reconciliations, and waits up to the timeout for the ones in progress to finish
+func (s *reconcileShutdown) wait(timeout time.Duration) bool {
+	s.mu.Lock()
+	s.stopping = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// drainingReconciler tracks the reconciliations of a controller for the shutdown of the operator, and
+// skips the ones requested once it is shutting down
+type drainingReconciler struct {
+	reconcile.Reconciler
+	shutdown *reconcileShutdown
+}
+
+func newDrainingReconciler(r reconcile.Reconciler) drainingReconciler {
+	return drainingReconciler{Reconciler: r, shutdown: operatorShutdown}
+}
+
+func (d drainingReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	if !d.shutdown.begin() {
+		// all the resources are reconciled by the operator once it is started again, or by the
+		// replica elected leader in its place
+		return reconcile.Result{}, nil
+	}
+	defer d.shutdown.end()
+	return d.Reconciler.Reconcile(request)
+}
@@ -0,0 +1,73 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// blockingReconciler counts its reconciliations, which return once released
+type blockingReconciler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b blockingReconciler) Reconcile(reconcile.Request) (reconcile.Result, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return reconcile.Result{RequeueAfter: time.Minute}, nil
+}
+
+func TestDrainingReconciler_WaitsForTheReconciliationsInProgress(t *testing.T) {
+	blocking := blockingReconciler{started: make(chan struct{}, 2), release: make(chan struct{})}
+	d := drainingReconciler{Reconciler: blocking, shutdown: &reconcileShutdown{}}
+	results := make(chan reconcile.Result)
+	go func() {
+		res, _ := d.Reconcile(reconcile.Request{})
+		results <- res
+	}()
+	<-blocking.started
+
+	stopped := make(chan bool)
+	go func() { stopped <- d.shutdown.wait(time.Minute) }()
+	// the shutdown has started once the new reconciliations are refused
+	for !isStopping(d.shutdown) {
+		time.Sleep(time.Millisecond)
+	}
+	res, err := d.Reconcile(reconcile.Request{})
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, res, "the new reconciliations are skipped")
+	assert.Len(t, blocking.started, 0)
+
+	select {
+	case <-stopped:
+		t.Fatal("the shutdown must wait for the reconciliation in progress")
+	default:
+	}
+	close(blocking.release)
+	assert.Equal(t, reconcile.Result{RequeueAfter: time.Minute}, <-results)
+	assert.True(t, <-stopped)
+}
+
+func TestDrainingReconciler_ShutdownTimeout(t *testing.T) {
+	blocking := blockingReconciler{started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(blocking.release)
+	d := drainingReconciler{Reconciler: blocking, shutdown: &reconcileShutdown{}}
+	go func() { _, _ = d.Reconcile(reconcile.Request{}) }()
+	<-blocking.started
+
+	assert.False(t, d.shutdown.wait(10*time.Millisecond))
+}
+
+func TestDrainingReconciler_NoReconciliationInProgress(t *testing.T) {
+	shutdown := &reconcileShutdown{}
+	assert.True(t, shutdown.wait(time.Second))
+}
+
+func isStopping(s *reconcileShutdown) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
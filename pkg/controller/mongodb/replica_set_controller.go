@@ -2,17 +2,16 @@ package mongodb
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/mongodb/mongodb-kubernetes-operator/pkg/controller/watch"
-
-	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/persistentvolumeclaim"
-
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/probes"
 
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
@@ -24,21 +23,27 @@ import (
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
 	kubernetesClient "github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
-	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/resourcerequirements"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/service"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/statefulset"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/livecluster"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/tracing"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/vault"
 	"go.uber.org/zap"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
@@ -47,6 +52,7 @@ const (
 	agentImageEnv                = "AGENT_IMAGE"
 	versionUpgradeHookImageEnv   = "VERSION_UPGRADE_HOOK_IMAGE"
 	agentHealthStatusFilePathEnv = "AGENT_STATUS_FILEPATH"
+	dataPathEnv                  = "DATA_PATH"
 
 	AutomationConfigKey            = "automation-config"
 	agentName                      = "mongodb-agent"
@@ -54,8 +60,9 @@ const (
 	versionUpgradeHookName         = "mongod-posthook"
 	dataVolumeName                 = "data-volume"
 	versionManifestFilePath        = "/usr/local/version_manifest.json"
-	readinessProbePath             = "/var/lib/mongodb-mms-automation/probes/readinessprobe"
-	clusterFilePath                = "/var/lib/automation/config/automation-config"
+	versionUpgradeHookPath         = "/hooks/version-upgrade"
+	automationConfigMountPath      = "/var/lib/automation/config"
+	clusterFilePath                = "/tmp/automation-config"
 	operatorServiceAccountName     = "mongodb-kubernetes-operator"
 	agentHealthStatusFilePathValue = "/var/log/mongodb-mms-automation/healthstatus/agent-health-status.json"
 
@@ -63,16 +70,45 @@ const (
 	// configured
 	lastVersionAnnotationKey = "mongodb.com/v1.lastVersion"
 	// tlsRolledOutAnnotationKey indicates if TLS has been fully rolled out
-	tlsRolledOutAnnotationKey      = "mongodb.com/v1.tlsRolledOut"
-	hasLeftReadyStateAnnotationKey = "mongodb.com/v1.hasLeftReadyStateAnnotationKey"
+	tlsRolledOutAnnotationKey = "mongodb.com/v1.tlsRolledOut"
+	// hasLeftReadyStateAnnotationKey indicates if the StatefulSet has left the ready state during a
+	// version change
+	hasLeftReadyStateAnnotationKey = "mongodb.com/v1.hasLeftReadyState"
+	// rebuildAutomationConfigAnnotationKey requests the automation config to be rebuilt from
+	// the live replica set, it is removed once the automation config has been rebuilt
+	rebuildAutomationConfigAnnotationKey = "mongodb.com/v1.rebuildAutomationConfig"
 
 	trueAnnotation = "true"
+
+	// automationConfigChangedReason is the reason of the event emitted every time
+	// the automation config is updated
+	automationConfigChangedReason = "AutomationConfigChanged"
+	// maxEventMessageLength is the length above which event messages are truncated
+	maxEventMessageLength = 1024
+	// AutomationConfigCompressedKey is used instead of AutomationConfigKey when the automation
+	// config is too large to be stored uncompressed in the ConfigMap
+	AutomationConfigCompressedKey = "automation-config.gz"
+	// automationConfigCompressionThreshold is the size in bytes above which the automation
+	// config is stored compressed, leaving room for the rest of the ConfigMap below 1MiB
+	automationConfigCompressionThreshold = 512 * 1024
 )
 
 // Add creates a new MongoDB Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr, readVersionManifestFromDisk))
+	manifestProvider, err := newVersionManifestProvider(apiConfigMapGetter{reader: mgr.GetAPIReader()})
+	if err != nil {
+		return err
+	}
+	// the member state poller triggers the reconciliation of the resources with work in progress
+	reconcileRequests := make(chan event.GenericEvent)
+	if err := add(mgr, newReconciler(mgr, manifestProvider), reconcileRequests); err != nil {
+		return err
+	}
+	if healthCheckInterval == 0 {
+		return nil
+	}
+	return mgr.Add(memberStatePoller{r: newReconciler(mgr, manifestProvider), interval: healthCheckInterval, reconcileRequests: reconcileRequests})
 }
 
 // ManifestProvider is a function which returns the VersionManifest which
@@ -81,33 +117,81 @@ type ManifestProvider func() (automationconfig.VersionManifest, error)
 
 func newReconciler(mgr manager.Manager, manifestProvider ManifestProvider) *ReplicaSetReconciler {
 	mgrClient := mgr.GetClient()
-	secretWatcher := watch.New()
 
 	return &ReplicaSetReconciler{
 		client:           kubernetesClient.NewClient(mgrClient),
 		scheme:           mgr.GetScheme(),
 		manifestProvider: manifestProvider,
 		log:              zap.S(),
-		secretWatcher:    &secretWatcher,
+		recorder:         mgr.GetEventRecorderFor("replicaset-controller"),
+
+		connectToLiveCluster: livecluster.Connect,
+		now:                  time.Now,
+		evictPod:             newPodEvicter(mgr.GetConfig()),
+		readPodLogs:          newPodLogReader(mgr.GetConfig()),
+		execInPod:            newPodExecutor(mgr.GetConfig()),
+		tracer:               tracing.Global(),
+		selector:             resourceSelector,
+		requeueBackoff:       newRequeueBackoff(),
+		reconcileFailures:    newReconcileFailures(),
+		vault:                vaultReader,
+		opsManagerClient:     newOpsManagerClient,
 	}
 }
 
 // add sets up a controller for the Reconciler on the manager. It will
 // also configure the necessary watches.
-func add(mgr manager.Manager, r *ReplicaSetReconciler) error {
+func add(mgr manager.Manager, r *ReplicaSetReconciler, reconcileRequests <-chan event.GenericEvent) error {
 	// Create a new controller
-	c, err := controller.New("replicaset-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("replicaset-controller", mgr, controller.Options{
+		Reconciler:              newDrainingReconciler(reconcilerPerRequest{r: r}),
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	})
 	if err != nil {
 		return err
 	}
 
 	// Watch for changes to primary resource MongoDB
-	err = c.Watch(&source.Kind{Type: &mdbv1.MongoDB{}}, &handler.EnqueueRequestForObject{}, predicates.OnlyOnSpecChange())
+	err = c.Watch(&source.Kind{Type: &mdbv1.MongoDB{}}, &handler.EnqueueRequestForObject{},
+		predicates.OnlyOnSpecChange(rebuildAutomationConfigAnnotationKey, collectDiagnosticsAnnotationKey, approveRolloutAnnotationKey, backupFreezeAnnotationKey, safeToEvictDeferredAnnotationKey),
+		predicates.OnlyMatchingLabels(r.selector))
+	if err != nil {
+		return err
+	}
+
+	// the resources are reconciled as soon as the Secrets and ConfigMaps they reference change, such
+	// as when the TLS certificate is renewed or a password is updated
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: r.resourcesReferencing(referencedSecrets),
+	}, predicates.OnlyOnDataChange(referencedByAnnotationKey))
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: r.resourcesReferencing(referencedConfigMaps),
+	}, predicates.OnlyOnDataChange(referencedByAnnotationKey))
+	if err != nil {
+		return err
+	}
+
+	// the primary is stepped down when its node is cordoned before being drained
+	err = c.Watch(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.resourcesWithMembersOnNode),
+	}, predicates.OnlyOnNodeCordoned())
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Channel{Source: reconcileRequests}, &handler.EnqueueRequestForObject{})
 	if err != nil {
 		return err
 	}
 
-	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, r.secretWatcher)
+	// the custom roles of the resources are updated as soon as the ClusterMongoDBRoles they reference change
+	err = c.Watch(&source.Kind{Type: &mdbv1.ClusterMongoDBRole{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.resourcesReferencingClusterRole),
+	}, predicate.GenerationChangedPredicate{})
 	if err != nil {
 		return err
 	}
@@ -126,7 +210,57 @@ type ReplicaSetReconciler struct {
 	scheme           *runtime.Scheme
 	manifestProvider func() (automationconfig.VersionManifest, error)
 	log              *zap.SugaredLogger
-	secretWatcher    *watch.ResourceWatcher
+	recorder         record.EventRecorder
+	// connectToLiveCluster is used to read the configuration of the running
+	// replica set when the automation config is rebuilt
+	connectToLiveCluster livecluster.Connector
+	// now returns the current time, to check the maintenance window
+	now func() time.Time
+	// evictPod evicts the Pods of the members restarted by the operator
+	evictPod podEvicter
+	// readPodLogs reads the logs of the containers of the members for the diagnostics bundle
+	readPodLogs podLogReader
+	// execInPod runs the diagnostic commands in the containers of the members for the diagnostics bundle
+	execInPod podExecutor
+	// tracer records the reconciliations and their steps as spans
+	tracer *tracing.Tracer
+	// selector selects the MongoDB resources reconciled by the operator
+	selector labels.Selector
+	// requeueBackoff spaces out the requeues of the resources waiting for the same change, it is
+	// shared by the reconciliations
+	requeueBackoff *requeueBackoff
+	// reconcileFailures counts the consecutive failed reconciliations of the resources, it is shared by
+	// the reconciliations
+	reconcileFailures *reconcileFailures
+	// vault reads the secrets stored in Vault, it is nil if the operator isn't configured with Vault
+	vault vault.Reader
+	// opsManagerClient returns the client of the Public API of Ops Manager
+	opsManagerClient opsManagerClientFactory
+
+	// nsName is the resource of the current reconciliation
+	nsName types.NamespacedName
+
+	// progress is the change in progress found by the current reconciliation, if any
+	progress *reconcileProgress
+	// isReady is true if the current reconciliation found the deployment to match the resource
+	isReady bool
+	// reconcileStartedAt is the time the current reconciliation started at
+	reconcileStartedAt time.Time
+	// observedGeneration is the generation of the resource read by the current reconciliation
+	observedGeneration int64
+	// consecutiveFailures is how many consecutive reconciliations of the resource have failed, including
+	// the current one
+	consecutiveFailures int
+	// backupFreezeExpiresAt is when the writes locked for the backupFreeze annotation are unlocked, if
+	// the current reconciliation found them locked
+	backupFreezeExpiresAt time.Time
+	// span is the span of the current reconciliation, the parent of the spans of its steps
+	span *tracing.Span
+	// update holds the changes to the status and the annotations of the resource made by the
+	// current reconciliation, which are written once it's done
+	update *resourceUpdate
+	// prefetching serves the objects read ahead by the current reconciliation
+	prefetching *prefetchingClient
 }
 
 // Reconcile reads that state of the cluster for a MongoDB object and makes changes based on the state read
@@ -135,9 +269,68 @@ type ReplicaSetReconciler struct {
 // The Controller will requeue the Request to be processed again if the returned error is non-nil or
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
 func (r *ReplicaSetReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
-	r.log = zap.S().With("ReplicaSet", request.NamespacedName)
+	r.log = zap.S().With("namespace", request.Namespace, "name", request.Name)
+	if selected, err := isSelected(r.client, r.selector, request.NamespacedName); err != nil || !selected {
+		// the resource is managed by another operator, whose selector matches its labels
+		return reconcile.Result{}, err
+	}
 	r.log.Info("Reconciling MongoDB")
+	r.nsName = request.NamespacedName
+	r.progress, r.isReady, r.reconcileStartedAt, r.observedGeneration = nil, false, time.Now(), 0
+	r.backupFreezeExpiresAt = time.Time{}
+	r.update = &resourceUpdate{}
+	defer func() { r.update = nil }()
+	// the objects read ahead by the reconciliation are only served to it
+	client := r.client
+	r.prefetching = newPrefetchingClient(client)
+	r.client = r.prefetching
+	defer func() { r.client, r.prefetching = client, nil }()
+	r.span = r.tracer.StartSpan(nil, "Reconcile")
+	r.span.SetAttribute("namespace", request.Namespace)
+	r.span.SetAttribute("name", request.Name)
+
+	res, err := r.reconcileReplicaSet(request)
+	if err == nil && res.RequeueAfter == 0 {
+		r.requeueBackoff.reset(request.NamespacedName)
+	}
+	r.consecutiveFailures = r.reconcileFailures.record(request.NamespacedName, err)
+	if !r.backupFreezeExpiresAt.IsZero() && err == nil {
+		// the writes are unlocked once the freeze expires, whatever the outcome of the reconciliation
+		expiresIn := r.backupFreezeExpiresAt.Sub(r.now()) + time.Second
+		if res.RequeueAfter == 0 || expiresIn < res.RequeueAfter {
+			res.RequeueAfter = expiresIn
+		}
+	}
+	if statusErr := r.updateReconcileStatus(request.NamespacedName, err); statusErr != nil {
+		// the status is informational only, the reconciliation is retried anyway if it failed
+		r.log.Warnf("Error updating the status: %s", statusErr)
+	}
+	if updateErr := r.writeResourceUpdate(); updateErr != nil {
+		r.log.Warnf("Error updating the resource: %s", updateErr)
+		if err == nil {
+			// the annotations track the changes applied to the deployment, they must be written
+			err = updateErr
+		}
+	}
+	r.span.Finish(err)
+	if err != nil && isBackedOff(r.consecutiveFailures) {
+		r.log.Warnf("%s, reconciliation failed %d consecutive times, retrying in %s", err, r.consecutiveFailures, reconcileFailureBackoff)
+		return reconcile.Result{RequeueAfter: reconcileFailureBackoff}, nil
+	}
+	return r.requeueAfterError(res, err)
+}
+
+// traceStep runs a step of the reconciliation in a child span of the reconciliation
+func (r *ReplicaSetReconciler) traceStep(name string, step func() error) error {
+	span := r.tracer.StartSpan(r.span, name)
+	err := step()
+	span.Finish(err)
+	return err
+}
 
+// reconcileReplicaSet makes the deployment match the MongoDB resource, the changes in progress are
+// recorded for the conditions of the resource
+func (r *ReplicaSetReconciler) reconcileReplicaSet(request reconcile.Request) (reconcile.Result, error) {
 	// TODO: generalize preparation for resource
 	// Fetch the MongoDB instance
 	mdb := mdbv1.MongoDB{}
@@ -153,28 +346,182 @@ func (r *ReplicaSetReconciler) Reconcile(request reconcile.Request) (reconcile.R
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
+	r.observedGeneration = mdb.Generation
 
-	if err := r.ensureAutomationConfig(mdb); err != nil {
-		r.log.Warnf("error creating automation config config map: %s", err)
+	if mdb.DeletionTimestamp != nil {
+		isComplete, err := r.teardown(mdb)
+		if err != nil {
+			r.log.Warnf("Error shutting the replica set down: %s", err)
+			return reconcile.Result{}, err
+		}
+		if !isComplete {
+			return reconcile.Result{RequeueAfter: r.requeueBackoff.next(request.NamespacedName, "teardown")}, nil
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if mdb.Annotations[collectDiagnosticsAnnotationKey] == trueAnnotation {
+		r.log.Info("Collecting diagnostics")
+		if err := r.collectDiagnostics(mdb); err != nil {
+			r.log.Warnf("Error collecting diagnostics: %s", err)
+			return reconcile.Result{}, err
+		}
+	}
+
+	if err := r.reconcileBackupFreeze(mdb); err != nil {
+		r.log.Warnf("Error reconciling the %s annotation: %s", backupFreezeAnnotationKey, err)
+		return reconcile.Result{}, err
+	}
+
+	if err := r.ensureFinalizer(mdb); err != nil {
+		r.log.Warnf("Error adding finalizer: %s", err)
+		return reconcile.Result{}, err
+	}
+
+	if mdb.Spec.Paused {
+		r.log.Info("Reconciliation is paused, only updating the status")
+		if err := r.updatePausedStatus(mdb); err != nil {
+			r.log.Warnf("Error updating the status of the paused resource: %s", err)
+			return reconcile.Result{}, err
+		}
+		// the status keeps being refreshed while paused
+		return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+	}
+
+	// the resources deployed by older releases of the operator are migrated to the current conventions
+	mdb, err = r.migrate(mdb)
+	if err != nil {
+		r.log.Warnf("Error migrating the resource: %s", err)
+		return reconcile.Result{}, err
+	}
+
+	if err := validateSpec(mdb); err != nil {
+		r.log.Warnf("Invalid spec: %s", err)
+		return r.handleReconcileError(mdb, err)
+	}
+
+	r.prefetchReferences(mdb)
+
+	if err := r.labelReferences(mdb); err != nil {
+		r.log.Warnf("Error labelling the Secrets and ConfigMaps referenced by the resource: %s", err)
+		return reconcile.Result{}, err
+	}
+
+	if err := r.traceStep("ValidateTLSConfig", func() error { return r.validateTLSConfig(mdb) }); err != nil {
+		r.log.Warnf("Error validating TLS config: %s", err)
+		return r.handleReconcileError(mdb, err)
+	}
+
+	if err := r.checkUserPasswordSecrets(mdb); err != nil {
+		r.log.Warnf("Error checking the password Secrets of the users: %s", err)
+		return r.handleReconcileError(mdb, err)
+	}
+
+	if err := r.checkClusterRoles(mdb); err != nil {
+		r.log.Warnf("Error checking the ClusterMongoDBRoles referenced by the resource: %s", err)
+		return r.handleReconcileError(mdb, err)
+	}
+
+	mdb, err = r.trackDependentResources(mdb)
+	if err != nil {
+		r.log.Warnf("Error checking the dependent resources: %s", err)
+		return r.handleReconcileError(mdb, err)
+	}
+
+	if err := r.stopWaitingForSecrets(mdb); err != nil {
+		r.log.Warnf("Error updating the WaitingForSecret condition: %s", err)
+		return reconcile.Result{}, err
+	}
+
+	versionChangeBlocker, err := r.validateVersionChange(mdb)
+	if err != nil {
+		r.log.Warnf("Error validating the version change: %s", err)
+		return reconcile.Result{}, err
+	}
+	if versionChangeBlocker != nil {
+		if versionChangeBlocker.isTransient {
+			return r.requeueInProgress(versionChangeBlocker.reason, "Waiting to change the version to %s: %s", mdb.Spec.Version, versionChangeBlocker.message)
+		}
+		r.log.Warnf("The version can't be changed to %s: %s", mdb.Spec.Version, versionChangeBlocker.message)
+		// the resource is reconciled again once the spec is changed
+		return reconcile.Result{}, nil
+	}
+
+	if err := r.stepDownPrimaryOnCordonedNode(mdb); err != nil {
+		// the primary is only stepped down to shorten the failover during a drain
+		r.log.Warnf("Error stepping down the primary on a cordoned node: %s", err)
+	}
+
+	if err := r.adoptReplicaSet(mdb); err != nil {
+		r.log.Warnf("Error adopting the replica set: %s", err)
+		return reconcile.Result{}, err
+	}
+
+	if err := r.seedDataVolume(mdb); err != nil {
+		r.log.Warnf("Error seeding the data volume: %s", err)
+		return r.handleReconcileError(mdb, err)
+	}
+
+	if err := r.initBootstrapStatus(mdb); err != nil {
+		r.log.Warnf("Error updating bootstrap status: %s", err)
 		return reconcile.Result{}, err
 	}
 
-	r.log.Debug("Ensuring the service exists")
-	if err := r.ensureService(mdb); err != nil {
-		r.log.Warnf("Error ensuring the service exists: %s", err)
+	// the disruptive changes wait for the next maintenance window
+	mdb, nextMaintenanceWindow, err := r.deferDisruptiveChanges(mdb)
+	if err != nil {
+		r.log.Warnf("Error deferring disruptive changes: %s", err)
 		return reconcile.Result{}, err
 	}
 
-	isTLSValid, err := r.validateTLSConfig(mdb)
+	appliedMdb := mdb
+
+	// the members are added and removed one at a time, the resource is reconciled
+	// with the number of members of the current step until spec.members is reached
+	specMembers := mdb.Spec.Members
+	acMembers, replicas, err := r.scaleStep(mdb)
 	if err != nil {
+		r.log.Warnf("Error scaling: %s", err)
+		return reconcile.Result{}, err
+	}
+	mdb.Spec.Members = replicas
+
+	if mdb.Annotations[rebuildAutomationConfigAnnotationKey] == trueAnnotation {
+		r.log.Info("Rebuilding the automation config from the live replica set")
+		if err := r.rebuildAutomationConfig(mdb); err != nil {
+			r.log.Warnf("Error rebuilding the automation config: %s", err)
+			return reconcile.Result{}, err
+		}
+	}
+
+	if err := r.traceStep("EnsureAutomationConfig", func() error { return r.ensureAutomationConfig(mdb, withMembers(acMembers)) }); err != nil {
+		r.log.Warnf("error creating automation config config map: %s", err)
+		return reconcile.Result{}, err
+	}
+
+	if err := r.recordAppliedChange(appliedMdb); err != nil {
+		// the change history is informational only
+		r.log.Warnf("Error recording the applied change: %s", err)
+	}
+
+	if err := r.ensureDependentObjects(mdb); err != nil {
 		return reconcile.Result{}, err
 	}
-	if !isTLSValid {
-		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+
+	r.log.Debug("Registering the members with Ops Manager")
+	if err := r.ensureOpsManagerMonitoring(mdb); err != nil {
+		// the monitoring of Ops Manager is retried by the next reconciliation
+		r.log.Warnf("Error registering the members with Ops Manager: %s", err)
+	}
+
+	r.log.Debug("Updating volume claim templates")
+	if err := r.updateVolumeClaimTemplates(mdb); err != nil {
+		r.log.Warnf("Error updating volume claim templates: %s", err)
+		return r.handleReconcileError(mdb, err)
 	}
 
 	r.log.Debug("Creating/Updating StatefulSet")
-	if err := r.createOrUpdateStatefulSet(mdb); err != nil {
+	if err := r.traceStep("CreateOrUpdateStatefulSet", func() error { return r.createOrUpdateStatefulSet(mdb) }); err != nil {
 		r.log.Warnf("Error creating/updating StatefulSet: %+v", err)
 		return reconcile.Result{}, err
 	}
@@ -185,16 +532,112 @@ func (r *ReplicaSetReconciler) Reconcile(request reconcile.Request) (reconcile.R
 		return reconcile.Result{}, err
 	}
 
+	r.log.Debug("Updating members status")
+	if err := r.updateMemberStatus(mdb); err != nil {
+		// the members status is informational only and must not block the reconciliation
+		r.log.Warnf("Error updating members status: %s", err)
+	}
+
+	r.log.Debug("Recovering stuck agent plans")
+	if err := r.recoverStuckPlans(mdb); err != nil {
+		r.log.Warnf("Error recovering stuck agent plans: %s", err)
+	}
+
+	r.log.Debug("Updating volume expansion status")
+	isExpandingVolumes, err := r.updateVolumeExpansionStatus(mdb, currentSts)
+	if err != nil {
+		r.log.Warnf("Error updating volume expansion status: %s", err)
+	}
+
+	r.log.Debug("Updating pending volumes status")
+	if err := r.updatePendingVolumesStatus(mdb, currentSts); err != nil {
+		r.log.Warnf("Error updating pending volumes status: %s", err)
+	}
+
+	r.log.Debug("Recovering lost volumes")
+	if err := r.recoverLostVolumes(mdb, currentSts); err != nil {
+		r.log.Warnf("Error recovering lost volumes: %s", err)
+		return reconcile.Result{}, err
+	}
+
+	isResized, err := r.resizeStep(mdb)
+	if err != nil {
+		r.log.Warnf("Error resizing the members: %s", err)
+		return reconcile.Result{}, err
+	}
+	if !isResized {
+		return r.requeueInProgress(resizingReason, "Resizing of the members is in progress")
+	}
+
 	r.log.Debugf("Ensuring StatefulSet is ready, with type: %s", getUpdateStrategyType(mdb))
-	ready, err := r.isStatefulSetReady(mdb, &currentSts)
+	var ready bool
+	err = r.traceStep("WaitForAgents", func() (err error) {
+		ready, err = r.isStatefulSetReady(mdb, &currentSts)
+		return err
+	})
 	if err != nil {
 		r.log.Warnf("error checking StatefulSet status: %+v", err)
 		return reconcile.Result{}, err
 	}
 
 	if !ready {
-		r.log.Infof("StatefulSet %s/%s is not yet ready, retrying in 10 seconds", mdb.Namespace, mdb.Name)
-		return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+		return r.requeueInProgress(statefulSetNotReadyReason, "StatefulSet %s/%s is not yet ready", mdb.Namespace, mdb.Name)
+	}
+
+	if isUpgradingVersion(mdb) {
+		isComplete, err := r.isVersionUpgradeComplete(mdb)
+		if err != nil {
+			r.log.Warnf("Error checking the version upgrade: %s", err)
+			return reconcile.Result{}, err
+		}
+		if !isComplete {
+			return r.requeueInProgress(upgradingVersionReason, "Version upgrade to %s is in progress", mdb.Spec.Version)
+		}
+	}
+
+	isRestarted, err := r.rollingRestartStep(mdb)
+	if err != nil {
+		r.log.Warnf("Error restarting the members: %s", err)
+		return reconcile.Result{}, err
+	}
+	if !isRestarted {
+		return r.requeueInProgress(restartingReason, "Rolling restart is in progress")
+	}
+
+	if acMembers != specMembers || replicas != specMembers {
+		return r.requeueInProgress(scalingReason, "Scaling to %d members is in progress", specMembers)
+	}
+
+	isBootstrapped, err := r.bootstrapStep(mdb)
+	if err != nil {
+		r.log.Warnf("Error restoring spec.bootstrap: %s", err)
+		return reconcile.Result{}, err
+	}
+	if !isBootstrapped {
+		return r.requeueInProgress(bootstrappingReason, "Restore of spec.bootstrap is in progress")
+	}
+
+	isInitialized, err := r.initScriptsStep(mdb)
+	if err != nil {
+		r.log.Warnf("Error running spec.initScripts: %s", err)
+		return reconcile.Result{}, err
+	}
+	if !isInitialized {
+		return r.requeueInProgress(runningInitScriptsReason, "Init scripts are running")
+	}
+
+	versionChangeBlocker, err = r.postVersionChangeStep(mdb)
+	if err != nil {
+		r.log.Warnf("Error running the post version change hooks: %s", err)
+		return reconcile.Result{}, err
+	}
+	if versionChangeBlocker != nil {
+		if versionChangeBlocker.isTransient {
+			return r.requeueInProgress(versionChangeBlocker.reason, "Completing the version change to %s: %s", mdb.Spec.Version, versionChangeBlocker.message)
+		}
+		r.log.Warnf("The version change to %s can't be completed: %s", mdb.Spec.Version, versionChangeBlocker.message)
+		// the resource is reconciled again once the spec is changed
+		return reconcile.Result{}, nil
 	}
 
 	r.log.Debug("Resetting StatefulSet UpdateStrategy")
@@ -203,10 +646,17 @@ func (r *ReplicaSetReconciler) Reconcile(request reconcile.Request) (reconcile.R
 		return reconcile.Result{}, err
 	}
 
+	r.log.Debug("Reclaiming volumes of removed members")
+	if err := r.reclaimVolumes(mdb, currentSts); err != nil {
+		r.log.Warnf("Error reclaiming volumes: %s", err)
+		return reconcile.Result{}, err
+	}
+
 	r.log.Debug("Setting MongoDB Annotations")
 
 	annotations := map[string]string{
 		lastVersionAnnotationKey:       mdb.Spec.Version,
+		lastResourcesAnnotationKey:     resourcesAnnotation(mdb),
 		hasLeftReadyStateAnnotationKey: "false",
 	}
 	if err := r.setAnnotations(mdb.NamespacedName(), annotations); err != nil {
@@ -214,17 +664,58 @@ func (r *ReplicaSetReconciler) Reconcile(request reconcile.Request) (reconcile.R
 		return reconcile.Result{}, err
 	}
 
+	if err := r.completeRollout(mdb); err != nil {
+		r.log.Warnf("Error completing rollout: %+v", err)
+		return reconcile.Result{}, err
+	}
+
 	if err := r.completeTLSRollout(mdb); err != nil {
 		r.log.Warnf("Error completing TLS rollout: %+v", err)
 		return reconcile.Result{}, err
 	}
 
+	if err := r.updateConfigurationValidCondition(mdb, nil); err != nil {
+		r.log.Warnf("Error updating the ConfigurationValid condition: %+v", err)
+		return reconcile.Result{}, err
+	}
+
 	r.log.Debug("Updating MongoDB Status")
 	newStatus, err := r.updateAndReturnStatusSuccess(&mdb)
 	if err != nil {
 		r.log.Warnf("Error updating the status of the MongoDB resource: %+v", err)
 		return reconcile.Result{}, err
 	}
+	r.isReady = true
+
+	// the drift is repaired, and the backups, the migration and the restores of the standby are
+	// updated, once the replica set is running. The member state poller triggers a reconciliation
+	// while they are in progress.
+	mdb.Status = newStatus
+	if err := r.repairDrift(mdb); err != nil {
+		r.log.Warnf("Error repairing the drift from the automation config: %s", err)
+		return reconcile.Result{}, err
+	}
+	if err := r.updateBackupStatus(mdb); err != nil {
+		r.log.Warnf("Error updating the backup status: %s", err)
+		return reconcile.Result{}, err
+	}
+	if err := r.updateMigration(mdb); err != nil {
+		r.log.Warnf("Error updating the migration: %s", err)
+		return reconcile.Result{}, err
+	}
+	if err := r.updateStandby(mdb); err != nil {
+		r.log.Warnf("Error updating the standby: %s", err)
+		return reconcile.Result{}, err
+	}
+
+	if isExpandingVolumes {
+		return r.requeueInProgress(expandingVolumesReason, "Volumes are being expanded")
+	}
+
+	if !nextMaintenanceWindow.IsZero() {
+		r.log.Infof("Disruptive changes are pending until the next maintenance window at %s", nextMaintenanceWindow)
+		return reconcile.Result{RequeueAfter: nextMaintenanceWindow.Sub(r.now())}, nil
+	}
 
 	r.log.Infow("Successfully finished reconciliation", "MongoDB.Spec:", mdb.Spec, "MongoDB.Status", newStatus)
 	return reconcile.Result{}, nil
@@ -233,10 +724,10 @@ func (r *ReplicaSetReconciler) Reconcile(request reconcile.Request) (reconcile.R
 // resetStatefulSetUpdateStrategy ensures the stateful set is configured back to using RollingUpdateStatefulSetStrategyType
 // and does not keep using OnDelete
 func (r *ReplicaSetReconciler) resetStatefulSetUpdateStrategy(mdb mdbv1.MongoDB) error {
-	if !isChangingVersion(mdb) {
+	if !isChangingVersion(mdb) && !isChangingResources(mdb) {
 		return nil
 	}
-	// if we changed the version, we need to reset the UpdatePolicy back to OnUpdate
+	// if we changed the version or the resources, we need to reset the UpdatePolicy back to OnUpdate
 	return statefulset.GetAndUpdate(r.client, mdb.NamespacedName(), func(sts *appsv1.StatefulSet) {
 		sts.Spec.UpdateStrategy.Type = appsv1.RollingUpdateStatefulSetStrategyType
 	})
@@ -245,7 +736,7 @@ func (r *ReplicaSetReconciler) resetStatefulSetUpdateStrategy(mdb mdbv1.MongoDB)
 // isStatefulSetReady checks to see if the stateful set corresponding to the given MongoDB resource
 // is currently ready.
 func (r *ReplicaSetReconciler) isStatefulSetReady(mdb mdbv1.MongoDB, existingStatefulSet *appsv1.StatefulSet) (bool, error) {
-	stsFunc := buildStatefulSetModificationFunction(mdb)
+	stsFunc := r.statefulSetModification(mdb)
 	stsCopy := existingStatefulSet.DeepCopyObject()
 	stsFunc(existingStatefulSet)
 
@@ -277,33 +768,100 @@ func (r *ReplicaSetReconciler) isStatefulSetReady(mdb mdbv1.MongoDB, existingSta
 	hasPerformedUpgrade := mdb.Annotations[hasLeftReadyStateAnnotationKey] == trueAnnotation
 	r.log.Infow("StatefulSet Readiness", "isReady", isReady, "hasPerformedUpgrade", hasPerformedUpgrade, "areEqual", areEqual)
 
-	if existingStatefulSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+	// the Pods are restarted by the operator when only the resources are changing, after which the
+	// StatefulSet is ready again
+	if existingStatefulSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType && isChangingVersion(mdb) {
 		return areEqual && isReady && hasPerformedUpgrade, nil
 	}
 
 	return areEqual && isReady, nil
 }
 
+// dependentObject is an object of the resource which doesn't depend on the other ones
+type dependentObject struct {
+	description string
+	ensure      func(mdb mdbv1.MongoDB) error
+	// optional is true for an object which doesn't fail the reconciliation if it can't be ensured
+	optional bool
+}
+
+// ensureDependentObjects ensures the objects of the resource which don't depend on each other
+// concurrently: the Service, the PodDisruptionBudget, the automation config token Secret, the connection
+// string Secrets of the users, the backup objects and the PodMonitor. They are all ensured even if one of them fails, the error of the
+// first one which failed is returned.
+func (r *ReplicaSetReconciler) ensureDependentObjects(mdb mdbv1.MongoDB) error {
+	objects := []dependentObject{
+		{description: "the Service exists", ensure: r.ensureService},
+		{description: "the PodDisruptionBudget exists", ensure: r.ensurePodDisruptionBudget},
+		{description: "the automation config token Secret is up to date", ensure: r.ensureAutomationConfigToken},
+		{description: "the external Services of the members are up to date", ensure: r.ensureExternalAccess},
+		{description: "the connection string Secrets of the users are up to date", ensure: r.ensureConnectionStringSecrets},
+		{description: "the backup CronJob is up to date", ensure: r.ensureBackupCronJob},
+		{description: "the oplog archive Deployment is up to date", ensure: r.ensureOplogArchive},
+		{description: "the configuration of PBM is applied", ensure: r.ensurePBMConfig},
+		{description: "the backup verification CronJob is up to date", ensure: r.ensureBackupVerificationCronJob},
+		// the PodMonitor only configures the monitoring of the members
+		{description: "the PodMonitor is up to date", ensure: r.ensurePodMonitor, optional: true},
+		{description: "the PrometheusRule is up to date", ensure: r.ensurePrometheusRule, optional: true},
+	}
+	errs := make([]error, len(objects))
+	var wg sync.WaitGroup
+	for i := range objects {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.log.Debugf("Ensuring %s", objects[i].description)
+			errs[i] = objects[i].ensure(mdb)
+		}(i)
+	}
+	wg.Wait()
+
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		r.log.Warnf("Error ensuring %s: %s", objects[i].description, err)
+		if !objects[i].optional && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 func (r *ReplicaSetReconciler) ensureService(mdb mdbv1.MongoDB) error {
-	svc := buildService(mdb)
-	err := r.client.Create(context.TODO(), &svc)
-	if err != nil && errors.IsAlreadyExists(err) {
-		r.log.Infof("The service already exists... moving forward: %s", err)
-		return nil
+	if err := r.client.ApplyService(buildService(mdb)); err != nil {
+		return wrapError(err, "error applying Service")
 	}
-	return err
+	return nil
 }
 
+// createOrUpdateStatefulSet applies the StatefulSet built from the resource, so that the fields
+// set by other controllers, such as the annotations added by an injector, are left untouched
 func (r *ReplicaSetReconciler) createOrUpdateStatefulSet(mdb mdbv1.MongoDB) error {
-	set := appsv1.StatefulSet{}
-	err := r.client.Get(context.TODO(), mdb.NamespacedName(), &set)
+	existing := appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), mdb.NamespacedName(), &existing)
 	err = k8sClient.IgnoreNotFound(err)
 	if err != nil {
 		return fmt.Errorf("error getting StatefulSet: %s", err)
 	}
-	buildStatefulSetModificationFunction(mdb)(&set)
-	if err = statefulset.CreateOrUpdate(r.client, set); err != nil {
-		return fmt.Errorf("error creating/updating StatefulSet: %s", err)
+	// only the Pod template of the existing StatefulSet is kept, outside of the maintenance window
+	set := appsv1.StatefulSet{}
+	if inWindow, _ := maintenanceWindowState(mdb.Spec.MaintenanceWindow, r.now()); !inWindow && existing.Name != "" {
+		set.Name = existing.Name
+		set.Spec.Template = existing.Spec.Template
+	}
+	r.statefulSetModification(mdb)(&set)
+	isUnchanged, err := setSpecHash(&set, &existing)
+	if err != nil {
+		return err
+	}
+	if isUnchanged {
+		r.log.Debug("The StatefulSet hasn't changed, not applying it")
+		return nil
+	}
+	if err = r.client.ApplyStatefulSet(set); err != nil {
+		return wrapError(err, "error applying StatefulSet")
 	}
 	return nil
 }
@@ -311,37 +869,72 @@ func (r *ReplicaSetReconciler) createOrUpdateStatefulSet(mdb mdbv1.MongoDB) erro
 // setAnnotations updates the monogdb resource annotations by applying the provided annotations
 // on top of the existing ones
 func (r ReplicaSetReconciler) setAnnotations(nsName types.NamespacedName, annotations map[string]string) error {
-	mdb := mdbv1.MongoDB{}
-	return r.client.GetAndUpdate(nsName, &mdb, func() {
-		if mdb.Annotations == nil {
-			mdb.Annotations = map[string]string{}
-		}
-		for key, val := range annotations {
-			mdb.Annotations[key] = val
-		}
-	})
+	mdb, err := r.getResource(nsName)
+	if err != nil {
+		return err
+	}
+	if mdb.Annotations == nil {
+		mdb.Annotations = map[string]string{}
+	}
+	for key, val := range annotations {
+		mdb.Annotations[key] = val
+	}
+	return r.writeAnnotations(mdb)
 }
 
 // updateAndReturnStatusSuccess should be called after a successful reconciliation
 // the resource's status is updated to reflect to the state, and any other cleanup
 // operators should be performed here
 func (r ReplicaSetReconciler) updateAndReturnStatusSuccess(mdb *mdbv1.MongoDB) (mdbv1.MongoDBStatus, error) {
-	newMdb := &mdbv1.MongoDB{}
-	if err := r.client.Get(context.TODO(), mdb.NamespacedName(), newMdb); err != nil {
+	newMdb, err := r.getResource(mdb.NamespacedName())
+	if err != nil {
 		return mdbv1.MongoDBStatus{}, fmt.Errorf("error getting resource: %+v", err)
 	}
 	newMdb.UpdateSuccess()
-	if err := r.client.Status().Update(context.TODO(), newMdb); err != nil {
+	if err := r.writeStatus(newMdb); err != nil {
 		return mdbv1.MongoDBStatus{}, fmt.Errorf("error updating status: %+v", err)
 	}
 	return newMdb.Status, nil
 }
 
-func (r ReplicaSetReconciler) ensureAutomationConfig(mdb mdbv1.MongoDB) error {
-	cm, err := r.buildAutomationConfigConfigMap(mdb)
+// ensureAutomationConfig publishes the automation config described by the MongoDB resource,
+// the additional modifications are applied last.
+func (r ReplicaSetReconciler) ensureAutomationConfig(mdb mdbv1.MongoDB, modifications ...automationconfig.Modification) error {
+	if mdb.Spec.AutomationFreeze {
+		_, err := r.client.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace})
+		if err == nil {
+			r.log.Infof("Automation is frozen, not publishing a new automation config")
+			return nil
+		}
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		// the initial automation config is always published, as there are
+		// no agents running which could be interfering with manual changes.
+	}
+
+	existing, err := r.client.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error getting automation config ConfigMap: %s", err)
+	}
+	rebuilt := isRebuiltFromLiveCluster(existing)
+	if rebuilt {
+		r.log.Info("Publishing the automation config rebuilt from the live replica set")
+	}
+	cm, err := r.buildAutomationConfigConfigMap(mdb, rebuilt, modifications...)
+	if err != nil {
+		return err
+	}
+	isUnchanged, err := setSpecHash(&cm, &existing)
 	if err != nil {
 		return err
 	}
+	// the automation config written before it was owned by the resource is published again to set its owner,
+	// and the one rebuilt from the live replica set to clear its marker
+	if isUnchanged && metav1.IsControlledBy(&existing, &mdb) && !rebuilt {
+		r.log.Debug("The automation config hasn't changed, not publishing it")
+		return nil
+	}
 	return configmap.CreateOrUpdate(r.client, cm)
 }
 
@@ -372,17 +965,59 @@ func buildAutomationConfig(mdb mdbv1.MongoDB, mdbVersionConfig automationconfig.
 // The agent will not uses any of these values but requires them to be set.
 // TODO: Remove this once the agent doesn't require any config: https://jira.mongodb.org/browse/CLOUDP-66024.
 func dummyToolsVersionConfig() automationconfig.ToolsVersion {
+	urls := map[string]string{}
+	for _, d := range supportedUbuntuDistros {
+		urls[d.name] = "https://dummy"
+	}
 	return automationconfig.ToolsVersion{
 		Version: "100.0.2",
 		URLs: map[string]map[string]string{
-			// The OS must be correctly set. Our Docker image uses Ubuntu 16.04.
-			"linux": {
-				"ubuntu1604": "https://dummy",
-			},
+			// The OS must be correctly set. Older MongoDB images use Ubuntu 16.04 and 18.04,
+			// MongoDB 5.0 and later images use Ubuntu 20.04 and 22.04.
+			"linux": urls,
 		},
 	}
 }
 
+type ubuntuDistro struct {
+	name      string
+	osVersion string
+}
+
+// supportedUbuntuDistros are the distributions the official MongoDB Docker images are based on.
+var supportedUbuntuDistros = []ubuntuDistro{
+	{name: "ubuntu1604", osVersion: "16.04"},
+	{name: "ubuntu1804", osVersion: "18.04"},
+	{name: "ubuntu2004", osVersion: "20.04"},
+	{name: "ubuntu2204", osVersion: "22.04"},
+}
+
+// buildsForVersion returns the builds for the given version from the version manifest.
+// The agent never downloads these builds as mongod is already present in the image, but
+// the version needs to be listed in the automation config. Newer MongoDB versions might not be
+// present in the version manifest bundled with the operator, in which case dummy builds
+// are generated for every supported distribution.
+func buildsForVersion(manifest automationconfig.VersionManifest, version string) automationconfig.MongoDbVersionConfig {
+	versionConfig := manifest.BuildsForVersion(version)
+	if len(versionConfig.Builds) > 0 {
+		return versionConfig
+	}
+
+	for _, d := range supportedUbuntuDistros {
+		versionConfig.Builds = append(versionConfig.Builds, automationconfig.BuildConfig{
+			Platform:     "linux",
+			Url:          "https://dummy",
+			GitVersion:   "dummy",
+			Architecture: "amd64",
+			Flavor:       "ubuntu",
+			MinOsVersion: d.osVersion,
+			MaxOsVersion: d.osVersion,
+			Modules:      []string{},
+		})
+	}
+	return versionConfig
+}
+
 func readVersionManifestFromDisk() (automationconfig.VersionManifest, error) {
 	bytes, err := ioutil.ReadFile(versionManifestFilePath)
 	if err != nil {
@@ -413,65 +1048,213 @@ func buildService(mdb mdbv1.MongoDB) corev1.Service {
 		SetServiceType(corev1.ServiceTypeClusterIP).
 		SetClusterIP("None").
 		SetPort(27017).
+		SetPortName(mongodbPortName).
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)}).
 		Build()
 }
 
 func getCurrentAutomationConfig(getUpdater configmap.GetUpdater, mdb mdbv1.MongoDB) (automationconfig.AutomationConfig, error) {
-	currentCm, err := getUpdater.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace})
+	nsName := types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}
+	currentCm, err := getUpdater.GetConfigMap(nsName)
 	if err != nil {
+		if errors.IsNotFound(err) {
+			parsedAutomationConfigs.delete(nsName)
+		}
 		// If the AC was not found we don't surface it as an error
 		return automationconfig.AutomationConfig{}, k8sClient.IgnoreNotFound(err)
 	}
+	if cached, ok := parsedAutomationConfigs.get(nsName, currentCm.ResourceVersion); ok {
+		return cached, nil
+	}
+
+	acBytes, err := automationConfigBytes(currentCm)
+	if err != nil {
+		return automationconfig.AutomationConfig{}, err
+	}
 
 	currentAc := automationconfig.AutomationConfig{}
-	if err := json.Unmarshal([]byte(currentCm.Data[AutomationConfigKey]), &currentAc); err != nil {
+	if err := json.Unmarshal(acBytes, &currentAc); err != nil {
 		return automationconfig.AutomationConfig{}, err
 	}
+	parsedAutomationConfigs.set(nsName, currentCm.ResourceVersion, currentAc)
 	return currentAc, nil
 }
 
-func (r ReplicaSetReconciler) buildAutomationConfigConfigMap(mdb mdbv1.MongoDB) (corev1.ConfigMap, error) {
+// buildAutomationConfigConfigMap builds the ConfigMap of the automation config following the current one.
+// The settings of the current one which aren't configured through the MongoDB resource are kept if it
+// was rebuilt from the live replica set, only the ids of the members otherwise.
+func (r ReplicaSetReconciler) buildAutomationConfigConfigMap(mdb mdbv1.MongoDB, rebuilt bool, modifications ...automationconfig.Modification) (corev1.ConfigMap, error) {
+	currentAC, err := getCurrentAutomationConfig(r.client, mdb)
+	if err != nil {
+		return corev1.ConfigMap{}, err
+	}
+
+	versionUpgrade, err := r.versionUpgradeModification(mdb, currentAC)
+	if err != nil {
+		return corev1.ConfigMap{}, fmt.Errorf("error planning the version upgrade: %s", err)
+	}
+
+	ac, err := r.buildAutomationConfigFromSpec(mdb, currentAC,
+		preserveMemberIds(currentAC),
+		automationconfig.If(rebuilt, preserveRecoveredSettings(currentAC)),
+		versionUpgrade,
+		automationconfig.Merge(modifications...),
+	)
+	if err != nil {
+		return corev1.ConfigMap{}, err
+	}
+	if ac.Version != currentAC.Version {
+		r.reportAutomationConfigChanges(mdb, currentAC, ac)
+	}
+
+	return automationConfigConfigMap(mdb, ac)
+}
 
+// buildAutomationConfigFromSpec builds the automation config described by the MongoDB resource,
+// the additional modifications are applied after the authentication and TLS ones.
+func (r ReplicaSetReconciler) buildAutomationConfigFromSpec(mdb mdbv1.MongoDB, previousAC automationconfig.AutomationConfig, modifications ...automationconfig.Modification) (automationconfig.AutomationConfig, error) {
 	manifest, err := r.manifestProvider()
 	if err != nil {
-		return corev1.ConfigMap{}, fmt.Errorf("error reading version manifest from disk: %+v", err)
+		return automationconfig.AutomationConfig{}, fmt.Errorf("error reading version manifest: %+v", err)
 	}
 
 	authModification, err := getAuthConfigModification(r.client, mdb)
 	if err != nil {
-		return corev1.ConfigMap{}, err
+		return automationconfig.AutomationConfig{}, err
 	}
 
-	tlsModification, err := getTLSConfigModification(r.client, mdb)
+	var tlsModification automationconfig.Modification
+	if usesVaultTLS(mdb) {
+		tlsModification, err = r.getVaultTLSConfigModification(mdb)
+	} else {
+		tlsModification, err = getTLSConfigModification(r.client, mdb)
+	}
 	if err != nil {
-		return corev1.ConfigMap{}, err
+		return automationconfig.AutomationConfig{}, err
 	}
 
-	currentAC, err := getCurrentAutomationConfig(r.client, mdb)
+	clusterRolesModification, err := r.getClusterRolesModification(mdb)
 	if err != nil {
-		return corev1.ConfigMap{}, err
+		return automationconfig.AutomationConfig{}, err
 	}
 
-	ac, err := buildAutomationConfig(mdb, manifest.BuildsForVersion(mdb.Spec.Version), currentAC, authModification, tlsModification)
+	// the metrics, monitoring and PBM users are added to the users of the automation config once they are all set
+	metricsUserModification, err := r.getMetricsUserModification(mdb, previousAC)
 	if err != nil {
-		return corev1.ConfigMap{}, err
+		return automationconfig.AutomationConfig{}, err
+	}
+
+	monitoringUserModification, err := r.getMonitoringUserModification(mdb, previousAC)
+	if err != nil {
+		return automationconfig.AutomationConfig{}, err
 	}
+
+	pbmUserModification, err := r.getPBMUserModification(mdb, previousAC)
+	if err != nil {
+		return automationconfig.AutomationConfig{}, err
+	}
+
+	return buildAutomationConfig(mdb, buildsForVersion(manifest, mdb.Spec.Version), previousAC,
+		authModification,
+		tlsModification,
+		buildStorageAutomationConfigModification(mdb),
+		additionalMongodConfigModification(mdb),
+		automationconfig.Merge(modifications...),
+		externalAccessModification(mdb),
+		clusterRolesModification,
+		metricsUserModification,
+		monitoringUserModification,
+		pbmUserModification,
+	)
+}
+
+// automationConfigConfigMap returns the ConfigMap storing the given automation config
+func automationConfigConfigMap(mdb mdbv1.MongoDB, ac automationconfig.AutomationConfig) (corev1.ConfigMap, error) {
 	acBytes, err := json.Marshal(ac)
 	if err != nil {
 		return corev1.ConfigMap{}, err
 	}
 
-	return configmap.Builder().
+	builder := configmap.Builder().
 		SetName(mdb.ConfigMapName()).
 		SetNamespace(mdb.Namespace).
-		SetField(AutomationConfigKey, string(acBytes)).
-		Build(), nil
+		SetOwnerReferences([]metav1.OwnerReference{getOwnerReference(mdb)})
+
+	// ConfigMaps are limited to 1MiB, large automation configs are stored compressed
+	// and decompressed by the agent container before being read by the agent.
+	if len(acBytes) <= automationConfigCompressionThreshold {
+		return builder.SetField(AutomationConfigKey, string(acBytes)).Build(), nil
+	}
+	compressed, err := compress(acBytes)
+	if err != nil {
+		return corev1.ConfigMap{}, fmt.Errorf("error compressing automation config: %s", err)
+	}
+	return builder.SetBinaryField(AutomationConfigCompressedKey, compressed).Build(), nil
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// automationConfigBytes returns the automation config of the ConfigMap, decompressed if required
+func automationConfigBytes(cm corev1.ConfigMap) ([]byte, error) {
+	if compressed, ok := cm.BinaryData[AutomationConfigCompressedKey]; ok {
+		acBytes, err := decompress(compressed)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing automation config: %s", err)
+		}
+		return acBytes, nil
+	}
+	return []byte(cm.Data[AutomationConfigKey]), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// reportAutomationConfigChanges logs the redacted differences between the current and the new
+// automation config and attaches them to the resource as an event, so it is possible to know why
+// the agents are performing changes without decoding the whole automation config.
+func (r ReplicaSetReconciler) reportAutomationConfigChanges(mdb mdbv1.MongoDB, previous, current automationconfig.AutomationConfig) {
+	changes, err := automationconfig.Diff(previous, current)
+	if err != nil {
+		r.log.Warnf("Could not compute automation config changes: %s", err)
+		return
+	}
+
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		lines[i] = c.String()
+	}
+	r.log.Infow("Automation config changed", "previousVersion", previous.Version, "version", current.Version, "changes", lines)
+
+	if r.recorder == nil {
+		return
+	}
+	message := fmt.Sprintf("Automation config updated to version %d: %s", current.Version, strings.Join(lines, "; "))
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength-3] + "..."
+	}
+	r.recorder.Event(&mdb, corev1.EventTypeNormal, automationConfigChangedReason, message)
 }
 
 // getUpdateStrategyType returns the type of RollingUpgradeStrategy that the StatefulSet
 // should be configured with
 func getUpdateStrategyType(mdb mdbv1.MongoDB) appsv1.StatefulSetUpdateStrategyType {
-	if !isChangingVersion(mdb) {
+	if !isChangingVersion(mdb) && !isChangingResources(mdb) {
 		return appsv1.RollingUpdateStatefulSetStrategyType
 	}
 	return appsv1.OnDeleteStatefulSetStrategyType
@@ -492,23 +1275,15 @@ func isChangingVersion(mdb mdbv1.MongoDB) bool {
 	return false
 }
 
-func mongodbAgentContainer(volumeMounts []corev1.VolumeMount) container.Modification {
+func mongodbAgentContainer(mdb mdbv1.MongoDB, volumeMounts []corev1.VolumeMount) container.Modification {
 	return container.Apply(
 		container.WithName(agentName),
 		container.WithImage(os.Getenv(agentImageEnv)),
 		container.WithImagePullPolicy(corev1.PullAlways),
 		container.WithReadinessProbe(defaultReadiness()),
-		container.WithResourceRequirements(resourcerequirements.Defaults()),
+		container.WithResourceRequirements(agentResources(mdb)),
 		container.WithVolumeMounts(volumeMounts),
-		container.WithCommand([]string{
-			"agent/mongodb-agent",
-			"-cluster=" + clusterFilePath,
-			"-skipMongoStart",
-			"-noDaemonize",
-			"-healthCheckFilePath=" + agentHealthStatusFilePathValue,
-			"-serveStatusPort=5000",
-		},
-		),
+		container.WithCommand([]string{"/bin/sh", "-c", agentCommand(mdb, "")}),
 		container.WithEnvs(
 			corev1.EnvVar{
 				Name:  agentHealthStatusFilePathEnv,
@@ -518,36 +1293,87 @@ func mongodbAgentContainer(volumeMounts []corev1.VolumeMount) container.Modifica
 	)
 }
 
+// agentCommand returns the script starting the agent. The automation config is copied
+// every few seconds to the path the agent reads it from, see syncAutomationConfigFunction.
+// The agent is stopped, and restarted by the kubelet, when the operator requests it with an
+// annotation on the Pod. The agent writes its logs to logFile if it is not empty.
+func agentCommand(mdb mdbv1.MongoDB, logFile string) string {
+	logFileArg := ""
+	if logFile != "" {
+		logFileArg = " -logFile=" + logFile
+	}
+	return fmt.Sprintf(`
+%[1]s
+
+agent_restart_requested() {
+  grep "^%[2]s=" %[3]s 2>/dev/null
+}
+
+sync_automation_config
+restart_requested=$(agent_restart_requested)
+while true; do
+  sleep 3
+  sync_automation_config
+  if [ "$(agent_restart_requested)" != "$restart_requested" ]; then kill 1; fi
+done &
+
+exec agent/mongodb-agent -cluster=%[4]s -skipMongoStart -noDaemonize -healthCheckFilePath=%[5]s -serveStatusPort=5000%[6]s
+`, syncAutomationConfigFunction(mdb), agentRestartRequestedAnnotationKey, podInfoMountPath+"/"+podAnnotationsFileName,
+		clusterFilePath, agentHealthStatusFilePathValue, logFileArg)
+}
+
+// syncAutomationConfigFunction returns the sync_automation_config function of the agent script.
+// The automation config is copied from the mounted ConfigMap, decompressing it if required. With
+// the Endpoint delivery it is polled from the operator by the version upgrade hook, started in the
+// background, which restarts the container if it stops, and the function waits for the first one.
+func syncAutomationConfigFunction(mdb mdbv1.MongoDB) string {
+	if usesAutomationConfigEndpoint(mdb) {
+		return fmt.Sprintf(`(%[1]s -poll-automation-config; kill 1) &
+
+sync_automation_config() {
+  while [ ! -f %[2]s ]; do sleep 1; done
+}`, versionUpgradeHookPath, clusterFilePath)
+	}
+	return fmt.Sprintf(`sync_automation_config() {
+  if [ -f %[1]s/%[2]s ]; then
+    gunzip -c %[1]s/%[2]s > %[3]s.tmp
+  else
+    cp %[1]s/%[4]s %[3]s.tmp
+  fi
+  cmp -s %[3]s.tmp %[3]s || mv %[3]s.tmp %[3]s
+}`, automationConfigMountPath, AutomationConfigCompressedKey, clusterFilePath, AutomationConfigKey)
+}
+
 func versionUpgradeHookInit(volumeMount []corev1.VolumeMount) container.Modification {
 	return container.Apply(
 		container.WithName(versionUpgradeHookName),
-		container.WithCommand([]string{"cp", "version-upgrade-hook", "/hooks/version-upgrade"}),
+		container.WithCommand([]string{"cp", "version-upgrade-hook", versionUpgradeHookPath}),
 		container.WithImage(os.Getenv(versionUpgradeHookImageEnv)),
 		container.WithImagePullPolicy(corev1.PullAlways),
 		container.WithVolumeMounts(volumeMount),
 	)
 }
 
-func mongodbContainer(version string, volumeMounts []corev1.VolumeMount) container.Modification {
+func mongodbContainer(version, dataPath string, resources corev1.ResourceRequirements, volumeMounts []corev1.VolumeMount) container.Modification {
 	mongoDbCommand := []string{
 		"/bin/sh",
 		"-c",
 		`
 # run post-start hook to handle version changes
-/hooks/version-upgrade
+` + versionUpgradeHookPath + `
 
 # wait for config to be created by the agent
-while [ ! -f /data/automation-mongod.conf ]; do sleep 3 ; done ; sleep 2 ;
+while [ ! -f ` + dataPath + `/automation-mongod.conf ]; do sleep 3 ; done ; sleep 2 ;
 
 # start mongod with this configuration
-exec mongod -f /data/automation-mongod.conf ;
+exec mongod -f ` + dataPath + `/automation-mongod.conf ;
 `,
 	}
 
 	return container.Apply(
 		container.WithName(mongodbName),
 		container.WithImage(fmt.Sprintf("mongo:%s", version)),
-		container.WithResourceRequirements(resourcerequirements.Defaults()),
+		container.WithResourceRequirements(resources),
 		container.WithCommand(mongoDbCommand),
 		container.WithEnvs(
 			corev1.EnvVar{
@@ -571,14 +1397,31 @@ func buildStatefulSetModificationFunction(mdb mdbv1.MongoDB) statefulset.Modific
 	agentHealthStatusVolumeMount := statefulset.CreateVolumeMount(healthStatusVolume.Name, "/var/log/mongodb-mms-automation/healthstatus")
 	mongodHealthStatusVolumeMount := statefulset.CreateVolumeMount(healthStatusVolume.Name, "/healthstatus")
 
-	// hooks volume is only required on the mongod pod.
+	// hooks volume is required on the mongod pod to run the version upgrade hook, and
+	// on the agent pod to report the agent health status from the readiness probe.
 	hooksVolume := statefulset.CreateVolumeFromEmptyDir("hooks")
 	hooksVolumeMount := statefulset.CreateVolumeMount(hooksVolume.Name, "/hooks", statefulset.WithReadOnly(false))
+	agentHooksVolumeMount := statefulset.CreateVolumeMount(hooksVolume.Name, "/hooks", statefulset.WithReadOnly(true))
 
 	automationConfigVolume := statefulset.CreateVolumeFromConfigMap("automation-config", mdb.ConfigMapName())
-	automationConfigVolumeMount := statefulset.CreateVolumeMount(automationConfigVolume.Name, "/var/lib/automation/config", statefulset.WithReadOnly(true))
+	automationConfigVolumeMount := statefulset.CreateVolumeMount(automationConfigVolume.Name, automationConfigMountPath, statefulset.WithReadOnly(true))
+
+	dataVolume := statefulset.CreateVolumeMount(dataVolumeName, dataPath(mdb))
+	agentVolumeMounts := []corev1.VolumeMount{agentHealthStatusVolumeMount, automationConfigVolumeMount, dataVolume, agentHooksVolumeMount}
+	automationConfigVolumeModification := podtemplatespec.WithVolume(automationConfigVolume)
+	if usesAutomationConfigEndpoint(mdb) {
+		// the agents poll the automation config from the operator instead
+		agentVolumeMounts = []corev1.VolumeMount{agentHealthStatusVolumeMount, dataVolume, agentHooksVolumeMount}
+		automationConfigVolumeModification = podtemplatespec.NOOP()
+	}
 
-	dataVolume := statefulset.CreateVolumeMount(dataVolumeName, "/data")
+	// the annotations of the Pod are exposed to the agent container, so that the operator can
+	// request the agent to be restarted
+	podInfoVolume := statefulset.CreateVolumeFromDownwardAPI("pod-info", corev1.DownwardAPIVolumeFile{
+		Path:     podAnnotationsFileName,
+		FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.annotations"},
+	})
+	podInfoVolumeMount := statefulset.CreateVolumeMount(podInfoVolume.Name, podInfoMountPath, statefulset.WithReadOnly(true))
 
 	return statefulset.Apply(
 		statefulset.WithName(mdb.Name),
@@ -589,21 +1432,35 @@ func buildStatefulSetModificationFunction(mdb mdbv1.MongoDB) statefulset.Modific
 		statefulset.WithOwnerReference([]metav1.OwnerReference{getOwnerReference(mdb)}),
 		statefulset.WithReplicas(mdb.Spec.Members),
 		statefulset.WithUpdateStrategyType(getUpdateStrategyType(mdb)),
-		statefulset.WithVolumeClaim(dataVolumeName, defaultPvc()),
+		storageVolume(mdb, dataVolumeName, mdb.Spec.Storage.Data),
 		statefulset.WithPodSpecTemplate(
 			podtemplatespec.Apply(
 				podtemplatespec.WithPodLabels(labels),
+				safeToEvictModification(mdb),
 				podtemplatespec.WithVolume(healthStatusVolume),
 				podtemplatespec.WithVolume(hooksVolume),
-				podtemplatespec.WithVolume(automationConfigVolume),
+				automationConfigVolumeModification,
+				podtemplatespec.WithVolume(podInfoVolume),
 				podtemplatespec.WithServiceAccount(operatorServiceAccountName),
-				podtemplatespec.WithContainer(agentName, mongodbAgentContainer([]corev1.VolumeMount{agentHealthStatusVolumeMount, automationConfigVolumeMount, dataVolume})),
-				podtemplatespec.WithContainer(mongodbName, mongodbContainer(mdb.Spec.Version, []corev1.VolumeMount{mongodHealthStatusVolumeMount, dataVolume, hooksVolumeMount})),
+				podtemplatespec.WithContainer(agentName, mongodbAgentContainer(mdb, append(agentVolumeMounts, podInfoVolumeMount))),
+				podtemplatespec.WithContainer(mongodbName, mongodbContainer(mdb.Spec.Version, dataPath(mdb), mongodResources(mdb), []corev1.VolumeMount{mongodHealthStatusVolumeMount, dataVolume, hooksVolumeMount})),
 				podtemplatespec.WithInitContainer(versionUpgradeHookName, versionUpgradeHookInit([]corev1.VolumeMount{hooksVolumeMount})),
+				// the version upgrade hook reports the disk usage of the data volume from the agent container
+				podtemplatespec.WithContainer(agentName, container.WithEnvs(corev1.EnvVar{Name: dataPathEnv, Value: dataPath(mdb)})),
 				buildTLSPodSpecModification(mdb),
 				buildScramPodSpecModification(mdb),
+				buildPrometheusPodSpecModification(mdb),
+				buildPBMPodSpecModification(mdb),
+				buildAgentStatusPortModification(mdb),
+				buildBackupHooksPodSpecModification(mdb),
+				buildAutomationConfigEndpointPodSpecModification(mdb),
 			),
 		),
+		buildJournalStatefulSetModification(mdb),
+		buildLogsStatefulSetModification(mdb),
+		buildInitFromStatefulSetModification(mdb),
+		// the override is merged into the StatefulSet built by the operator
+		buildStatefulSetOverrideModification(mdb),
 	)
 }
 
@@ -611,7 +1468,8 @@ func getOwnerReference(mdb mdbv1.MongoDB) metav1.OwnerReference {
 	return *metav1.NewControllerRef(&mdb, schema.GroupVersionKind{
 		Group:   mdbv1.SchemeGroupVersion.Group,
 		Version: mdbv1.SchemeGroupVersion.Version,
-		Kind:    mdb.Kind,
+		// the kind isn't set on the resources read with the typed client
+		Kind: "MongoDB",
 	})
 }
 
@@ -624,16 +1482,11 @@ func getDomain(service, namespace, clusterName string) string {
 
 func defaultReadiness() probes.Modification {
 	return probes.Apply(
-		probes.WithExecCommand([]string{readinessProbePath}),
+		// the version upgrade hook publishes the agent health status of the member on its Pod
+		// before checking whether the member is ready, the outcome of the publication never
+		// affects readiness.
+		probes.WithExecCommand([]string{"/bin/sh", "-c", fmt.Sprintf("%s -report-health; exec %s -readiness", versionUpgradeHookPath, versionUpgradeHookPath)}),
 		probes.WithFailureThreshold(240),
 		probes.WithInitialDelaySeconds(5),
 	)
 }
-
-func defaultPvc() persistentvolumeclaim.Modification {
-	return persistentvolumeclaim.Apply(
-		persistentvolumeclaim.WithName(dataVolumeName),
-		persistentvolumeclaim.WithAccessModes(corev1.ReadWriteOnce),
-		persistentvolumeclaim.WithResourceRequests(resourcerequirements.BuildDefaultStorageRequirements()),
-	)
-}
@@ -2,14 +2,16 @@ package mongodb
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"reflect"
 	"testing"
 	"time"
 
-	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
-
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scram"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
 
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/probes"
@@ -19,10 +21,15 @@ import (
 	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/resourcerequirements"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/tracing"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -31,96 +38,15 @@ func init() {
 	os.Setenv("AGENT_IMAGE", "agent-image")
 }
 
-func newTestReplicaSet() mdbv1.MongoDB {
-	return mdbv1.MongoDB{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        "my-rs",
-			Namespace:   "my-ns",
-			Annotations: map[string]string{},
-		},
-		Spec: mdbv1.MongoDBSpec{
-			Members: 3,
-			Version: "4.2.2",
-		},
-	}
-}
-
-func newScramReplicaSet() mdbv1.MongoDB {
-	return mdbv1.MongoDB{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        "my-rs",
-			Namespace:   "my-ns",
-			Annotations: map[string]string{},
-		},
-		Spec: mdbv1.MongoDBSpec{
-			Members: 3,
-			Version: "4.2.2",
-			Security: mdbv1.Security{
-				Authentication: mdbv1.Authentication{
-					Enabled: true,
-					Modes:   []mdbv1.AuthMode{"SCRAM"},
-				},
-			},
-		},
-	}
-}
-
-func newTestReplicaSetWithTLS() mdbv1.MongoDB {
-	return mdbv1.MongoDB{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        "my-rs",
-			Namespace:   "my-ns",
-			Annotations: map[string]string{},
-		},
-		Spec: mdbv1.MongoDBSpec{
-			Members: 3,
-			Version: "4.2.2",
-			Security: mdbv1.Security{
-				TLS: mdbv1.TLS{
-					Enabled: true,
-					CaConfigMap: mdbv1.LocalObjectReference{
-						Name: "caConfigMap",
-					},
-					CertificateKeySecret: mdbv1.LocalObjectReference{
-						Name: "certificateKeySecret",
-					},
-				},
-			},
-		},
-	}
-}
-
-func mockManifestProvider(version string) func() (automationconfig.VersionManifest, error) {
-	return func() (automationconfig.VersionManifest, error) {
-		return automationconfig.VersionManifest{
-			Updated: 0,
-			Versions: []automationconfig.MongoDbVersionConfig{
-				{
-					Name: version,
-					Builds: []automationconfig.BuildConfig{{
-						Platform:     "platform",
-						Url:          "url",
-						GitVersion:   "gitVersion",
-						Architecture: "arch",
-						Flavor:       "flavor",
-						MinOsVersion: "0",
-						MaxOsVersion: "10",
-						Modules:      []string{},
-					}},
-				}},
-		}, nil
-	}
-}
-
 func TestKubernetesResources_AreCreated(t *testing.T) {
 	// TODO: Create builder/yaml fixture of some type to construct MDB objects for unit tests
-	mdb := newTestReplicaSet()
+	mdb := testutils.NewTestReplicaSet()
 
 	mgr := client.NewManager(&mdb)
-	r := newReconciler(mgr, mockManifestProvider(mdb.Spec.Version))
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
 
 	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	cm := corev1.ConfigMap{}
 	err = mgr.GetClient().Get(context.TODO(), types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace}, &cm)
@@ -132,11 +58,11 @@ func TestKubernetesResources_AreCreated(t *testing.T) {
 }
 
 func TestStatefulSet_IsCorrectlyConfigured(t *testing.T) {
-	mdb := newTestReplicaSet()
+	mdb := testutils.NewTestReplicaSet()
 	mgr := client.NewManager(&mdb)
-	r := newReconciler(mgr, mockManifestProvider(mdb.Spec.Version))
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
 	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	sts := appsv1.StatefulSet{}
 	err = mgr.GetClient().Get(context.TODO(), types.NamespacedName{Name: mdb.Name, Namespace: mdb.Namespace}, &sts)
@@ -157,13 +83,160 @@ func TestStatefulSet_IsCorrectlyConfigured(t *testing.T) {
 	assert.Equal(t, resourcerequirements.Defaults(), agentContainer.Resources)
 }
 
+func TestVersionMissingFromManifest_UsesDummyBuilds(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Version = "6.0.5"
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider("4.2.2"))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	ac, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
+	assert.NoError(t, err)
+
+	assert.Len(t, ac.Versions, 1)
+	assert.Equal(t, "6.0.5", ac.Versions[0].Name)
+	assert.Len(t, ac.Versions[0].Builds, len(supportedUbuntuDistros))
+	for _, p := range ac.Processes {
+		assert.Equal(t, "6.0.5", p.Version)
+		assert.Equal(t, "6.0", p.FeatureCompatibilityVersion)
+	}
+	assert.Contains(t, ac.ToolsVersion.URLs["linux"], "ubuntu2204")
+}
+
+func TestAdditionalMongodConfig_IsTranslatedForTheVersion(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Version = "7.0.2"
+	mdb.Spec.AdditionalMongodConfig = &runtime.RawExtension{Raw: []byte(`{"storage":{"journal":{"enabled":true}},"setParameter":{"cursorTimeoutMillis":600000}}`)}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	ac, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, map[string]interface{}{"setParameter": map[string]interface{}{"cursorTimeoutMillis": 600000.0}}, p.Args26.Additional, "journaling is always enabled on 7.0")
+		assert.Equal(t, "/data", p.Args26.Storage.DBPath)
+	}
+
+	t.Run("Invalid options are rejected", func(t *testing.T) {
+		mdb.Spec.AdditionalMongodConfig = &runtime.RawExtension{Raw: []byte(`["not", "an", "object"]`)}
+		assert.EqualError(t, validateSpec(mdb), "invalid spec.additionalMongodConfig: it must be an object: json: cannot unmarshal array into Go value of type map[string]interface {}")
+	})
+}
+
+func TestMembersStatus_IsUpdatedFromAgentStatus(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+
+	agentStatuses := []string{
+		`{"lastGoalVersionAchieved":1,"isInGoalState":true}`,
+		`{"lastGoalVersionAchieved":0,"isInGoalState":false,"currentStep":"Start/StartFresh","currentStepSince":"2020-06-01T10:00:00Z"}`,
+	}
+	for i, agentStatus := range agentStatuses {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("%s-%d", mdb.Name, i),
+				Namespace:   mdb.Namespace,
+				Annotations: map[string]string{agenthealth.MemberStatusAnnotationKey: agentStatus},
+			},
+		}
+		assert.NoError(t, mgr.GetClient().Create(context.TODO(), &pod))
+	}
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	err = mgr.GetClient().Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.NoError(t, err)
+
+	// the status is written with a merge patch, so the times are read back in the local time zone
+	stepSince := metav1.NewTime(time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC).Local())
+	assert.Equal(t, []mdbv1.MemberStatus{
+		{Name: "my-rs-0", GoalVersion: 1, LastVersionAchieved: 1},
+		{Name: "my-rs-1", GoalVersion: 1, LastVersionAchieved: 0, CurrentStep: "Start/StartFresh", CurrentStepSince: &stepSince},
+		{Name: "my-rs-2", GoalVersion: 1, LastVersionAchieved: 0},
+	}, mdb.Status.Members)
+}
+
+func TestAutomationFreeze_PreventsAutomationConfigUpdates(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.AutomationFreeze = true
+	mdb.Spec.Members = 5
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+
+	ac, err := getCurrentAutomationConfig(mgrClient, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ac.Version)
+	assert.Len(t, ac.Processes, 3)
+
+	sts, err := mgrClient.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), *sts.Spec.Replicas, "Kubernetes resources are still reconciled")
+
+	primary := 0
+	withHealthyReplicaSet(t, r, mgrClient, mdb, &primary)
+	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	mdb.Spec.AutomationFreeze = false
+	_ = mgrClient.Update(context.TODO(), &mdb)
+
+	// the members are added one at a time
+	for i := 4; i <= 5; i++ {
+		_, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+		assert.NoError(t, err)
+
+		ac, err = getCurrentAutomationConfig(mgrClient, mdb)
+		assert.NoError(t, err)
+		assert.Equal(t, i-2, ac.Version)
+		assert.Len(t, ac.Processes, i)
+	}
+}
+
+func TestCompressedAutomationConfig_IsRead(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	mgrClient := client.NewClient(mgr.GetClient())
+
+	ac, err := buildAutomationConfig(mdb, automationconfig.MongoDbVersionConfig{Name: mdb.Spec.Version}, automationconfig.AutomationConfig{})
+	assert.NoError(t, err)
+	acBytes, err := json.Marshal(ac)
+	assert.NoError(t, err)
+	compressed, err := compress(acBytes)
+	assert.NoError(t, err)
+
+	cm := configmap.Builder().
+		SetName(mdb.ConfigMapName()).
+		SetNamespace(mdb.Namespace).
+		SetBinaryField(AutomationConfigCompressedKey, compressed).
+		Build()
+	assert.NoError(t, mgrClient.CreateConfigMap(cm))
+
+	currentAc, err := getCurrentAutomationConfig(mgrClient, mdb)
+	assert.NoError(t, err)
+	currentAcBytes, err := json.Marshal(currentAc)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(acBytes), string(currentAcBytes))
+}
+
 func TestChangingVersion_ResultsInRollingUpdateStrategyType(t *testing.T) {
-	mdb := newTestReplicaSet()
+	mdb := testutils.NewTestReplicaSet()
 	mgr := client.NewManager(&mdb)
 	mgrClient := mgr.GetClient()
-	r := newReconciler(mgr, mockManifestProvider(mdb.Spec.Version))
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version, "4.2.3"))
 	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	// fetch updated resource after first reconciliation
 	_ = mgrClient.Get(context.TODO(), mdb.NamespacedName(), &mdb)
@@ -173,6 +246,9 @@ func TestChangingVersion_ResultsInRollingUpdateStrategyType(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, appsv1.RollingUpdateStatefulSetStrategyType, sts.Spec.UpdateStrategy.Type)
 
+	primary := 0
+	withHealthyReplicaSet(t, r, client.NewClient(mgrClient), mdb, &primary)
+
 	mdbRef := &mdb
 	mdbRef.Spec.Version = "4.2.3"
 
@@ -198,9 +274,11 @@ func TestChangingVersion_ResultsInRollingUpdateStrategyType(t *testing.T) {
 	err = mgrClient.Update(context.TODO(), &sts)
 	assert.NoError(t, err)
 
-	// reconcilliation is successful
-	res, err = r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	// reconcilliation is successful once the members have been upgraded one at a time
+	for i := 0; i < mdb.Spec.Members+1 && res.RequeueAfter > 0; i++ {
+		res, err = r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
+	}
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	sts = appsv1.StatefulSet{}
 	err = mgrClient.Get(context.TODO(), types.NamespacedName{Name: mdb.Name, Namespace: mdb.Namespace}, &sts)
@@ -212,7 +290,7 @@ func TestChangingVersion_ResultsInRollingUpdateStrategyType(t *testing.T) {
 
 func TestBuildStatefulSet_ConfiguresUpdateStrategyCorrectly(t *testing.T) {
 	t.Run("On No Version Change, Same Version", func(t *testing.T) {
-		mdb := newTestReplicaSet()
+		mdb := testutils.NewTestReplicaSet()
 		mdb.Spec.Version = "4.0.0"
 		mdb.Annotations[lastVersionAnnotationKey] = "4.0.0"
 		sts, err := buildStatefulSet(mdb)
@@ -220,7 +298,7 @@ func TestBuildStatefulSet_ConfiguresUpdateStrategyCorrectly(t *testing.T) {
 		assert.Equal(t, appsv1.RollingUpdateStatefulSetStrategyType, sts.Spec.UpdateStrategy.Type)
 	})
 	t.Run("On No Version Change, First Version", func(t *testing.T) {
-		mdb := newTestReplicaSet()
+		mdb := testutils.NewTestReplicaSet()
 		mdb.Spec.Version = "4.0.0"
 		delete(mdb.Annotations, lastVersionAnnotationKey)
 		sts, err := buildStatefulSet(mdb)
@@ -228,7 +306,7 @@ func TestBuildStatefulSet_ConfiguresUpdateStrategyCorrectly(t *testing.T) {
 		assert.Equal(t, appsv1.RollingUpdateStatefulSetStrategyType, sts.Spec.UpdateStrategy.Type)
 	})
 	t.Run("On Version Change", func(t *testing.T) {
-		mdb := newTestReplicaSet()
+		mdb := testutils.NewTestReplicaSet()
 		mdb.Spec.Version = "4.0.0"
 		mdb.Annotations[lastVersionAnnotationKey] = "4.2.0"
 		sts, err := buildStatefulSet(mdb)
@@ -238,12 +316,12 @@ func TestBuildStatefulSet_ConfiguresUpdateStrategyCorrectly(t *testing.T) {
 }
 
 func TestService_isCorrectlyCreatedAndUpdated(t *testing.T) {
-	mdb := newTestReplicaSet()
+	mdb := testutils.NewTestReplicaSet()
 
 	mgr := client.NewManager(&mdb)
-	r := newReconciler(mgr, mockManifestProvider(mdb.Spec.Version))
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
 	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	svc := corev1.Service{}
 	err = mgr.GetClient().Get(context.TODO(), types.NamespacedName{Name: mdb.ServiceName(), Namespace: mdb.Namespace}, &svc)
@@ -251,30 +329,64 @@ func TestService_isCorrectlyCreatedAndUpdated(t *testing.T) {
 	assert.Equal(t, svc.Spec.Type, corev1.ServiceTypeClusterIP)
 	assert.Equal(t, svc.Spec.Selector["app"], mdb.ServiceName())
 	assert.Len(t, svc.Spec.Ports, 1)
-	assert.Equal(t, svc.Spec.Ports[0], corev1.ServicePort{Port: 27017})
+	assert.Equal(t, svc.Spec.Ports[0], corev1.ServicePort{Name: "mongodb", Port: 27017})
 
 	res, err = r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
+}
+
+func TestStatefulSet_IsAppliedWithoutTheFieldsOfOtherControllers(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	sts, err := c.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	sts.Annotations = map[string]string{"sidecar.istio.io/status": "injected"}
+	assert.NoError(t, c.Update(context.TODO(), &sts))
+
+	applier := &statefulSetApplier{Client: r.client}
+	r.client = applier
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	assert.Len(t, applier.applied, 1)
+	assert.NotContains(t, applier.applied[0].Annotations, "sidecar.istio.io/status", "the fields set by other controllers are left to them")
+}
+
+// statefulSetApplier records the StatefulSets applied with the client it wraps
+type statefulSetApplier struct {
+	client.Client
+	applied []appsv1.StatefulSet
+}
+
+func (c *statefulSetApplier) ApplyStatefulSet(sts appsv1.StatefulSet) error {
+	c.applied = append(c.applied, sts)
+	return c.Client.ApplyStatefulSet(sts)
 }
 
 func TestAutomationConfig_versionIsBumpedOnChange(t *testing.T) {
-	mdb := newTestReplicaSet()
+	mdb := testutils.NewTestReplicaSet()
 
 	mgr := client.NewManager(&mdb)
-	r := newReconciler(mgr, mockManifestProvider(mdb.Spec.Version))
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
 	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	currentAc, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, currentAc.Version)
 
+	primary := 0
+	withHealthyReplicaSet(t, r, client.NewClient(mgr.GetClient()), mdb, &primary)
 	mdb.Spec.Members++
-	makeStatefulSetReady(mgr.GetClient(), mdb)
+	testutils.MakeStatefulSetReady(mgr.GetClient(), mdb)
 
 	_ = mgr.GetClient().Update(context.TODO(), &mdb)
 	res, err = r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	currentAc, err = getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
 	assert.NoError(t, err)
@@ -282,19 +394,19 @@ func TestAutomationConfig_versionIsBumpedOnChange(t *testing.T) {
 }
 
 func TestAutomationConfig_versionIsNotBumpedWithNoChanges(t *testing.T) {
-	mdb := newTestReplicaSet()
+	mdb := testutils.NewTestReplicaSet()
 
 	mgr := client.NewManager(&mdb)
-	r := newReconciler(mgr, mockManifestProvider(mdb.Spec.Version))
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
 	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	currentAc, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
 	assert.NoError(t, err)
 	assert.Equal(t, currentAc.Version, 1)
 
 	res, err = r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	currentAc, err = getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
 	assert.NoError(t, err)
@@ -302,7 +414,7 @@ func TestAutomationConfig_versionIsNotBumpedWithNoChanges(t *testing.T) {
 }
 
 func TestExistingPasswordAndKeyfile_AreUsedWhenTheSecretExists(t *testing.T) {
-	mdb := newScramReplicaSet()
+	mdb := testutils.NewScramReplicaSet()
 	mgr := client.NewManager(&mdb)
 
 	c := mgr.Client
@@ -317,9 +429,9 @@ func TestExistingPasswordAndKeyfile_AreUsedWhenTheSecretExists(t *testing.T) {
 			Build(),
 	)
 
-	r := newReconciler(mgr, mockManifestProvider(mdb.Spec.Version))
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
 	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	currentAc, err := getCurrentAutomationConfig(c, mdb)
 	assert.NoError(t, err)
@@ -330,14 +442,50 @@ func TestExistingPasswordAndKeyfile_AreUsedWhenTheSecretExists(t *testing.T) {
 	assert.NotEmpty(t, currentAc.Auth.KeyFileWindows)
 	assert.Equal(t, "my-pass", currentAc.Auth.AutoPwd)
 
+	agentSecret, err := c.GetSecret(scramNsName)
+	assert.NoError(t, err)
+	assert.True(t, metav1.IsControlledBy(&agentSecret, &mdb), "the existing secret is owned by the resource")
+}
+
+func TestGeneratedObjects_AreOwnedByTheResource(t *testing.T) {
+	mdb := testutils.NewScramReplicaSet()
+	mdb.UID = "my-rs-uid"
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	svc := corev1.Service{}
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: mdb.ServiceName(), Namespace: mdb.Namespace}, &svc))
+	assert.True(t, metav1.IsControlledBy(&svc, &mdb))
+	assert.Equal(t, "MongoDB", svc.OwnerReferences[0].Kind)
+	agentSecret, err := c.GetSecret(mdb.ScramCredentialsNamespacedName())
+	assert.NoError(t, err)
+	assert.True(t, metav1.IsControlledBy(&agentSecret, &mdb))
+	cm, err := c.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace})
+	assert.NoError(t, err)
+	assert.True(t, metav1.IsControlledBy(&cm, &mdb))
+
+	// the automation config written by a previous version of the operator is owned once reconciled
+	cm.OwnerReferences = nil
+	assert.NoError(t, c.UpdateConfigMap(cm))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	cm, err = c.GetConfigMap(types.NamespacedName{Name: mdb.ConfigMapName(), Namespace: mdb.Namespace})
+	assert.NoError(t, err)
+	assert.True(t, metav1.IsControlledBy(&cm, &mdb))
+	currentAc, err := getCurrentAutomationConfig(c, mdb)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, currentAc.Version, "the automation config isn't changed")
 }
 
 func TestScramIsConfigured(t *testing.T) {
-	mdb := newScramReplicaSet()
+	mdb := testutils.NewScramReplicaSet()
 	mgr := client.NewManager(&mdb)
-	r := newReconciler(mgr, mockManifestProvider(mdb.Spec.Version))
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
 	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
-	assertReconciliationSuccessful(t, res, err)
+	testutils.AssertReconciliationSuccessful(t, res, err)
 
 	currentAc, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
 	t.Run("Automation Config is configured with SCRAM", func(t *testing.T) {
@@ -356,18 +504,85 @@ func TestScramIsConfigured(t *testing.T) {
 	})
 }
 
-func assertReconciliationSuccessful(t *testing.T, result reconcile.Result, err error) {
+func TestReconcile_LogsHoldTheNamespaceAndNameOfTheResource(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	assert.NotZero(t, logs.Len())
+	for _, entry := range logs.All() {
+		assert.Equal(t, mdb.Namespace, entry.ContextMap()["namespace"], entry.Message)
+		assert.Equal(t, mdb.Name, entry.ContextMap()["name"], entry.Message)
+	}
+}
+
+type recordingSpanExporter struct {
+	spans []*tracing.Span
+}
+
+func (e *recordingSpanExporter) Export(spans []*tracing.Span) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestReconcile_StepsAreTraced(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	exporter := &recordingSpanExporter{}
+	r.tracer = tracing.NewTracer(exporter, nil)
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: mdb.Namespace, Name: mdb.Name}})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	r.tracer.Flush()
+
+	var names []string
+	for _, span := range exporter.spans {
+		names = append(names, span.Name)
+	}
+	assert.Equal(t, []string{"ValidateTLSConfig", "EnsureAutomationConfig", "CreateOrUpdateStatefulSet", "WaitForAgents", "Reconcile"}, names)
+
+	reconcileSpan := exporter.spans[len(exporter.spans)-1]
+	assert.Equal(t, map[string]string{"namespace": mdb.Namespace, "name": mdb.Name}, reconcileSpan.Attributes)
+	for _, span := range exporter.spans[:len(exporter.spans)-1] {
+		assert.Equal(t, reconcileSpan.TraceID, span.TraceID)
+		assert.Equal(t, reconcileSpan.SpanID, span.ParentSpanID)
+	}
+}
+
+func TestLogsVolume_ConfiguresMongodLogPath(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.Logs = &mdbv1.VolumeClaim{}
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	ac, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
 	assert.NoError(t, err)
-	assert.Equal(t, false, result.Requeue)
-	assert.Equal(t, time.Duration(0), result.RequeueAfter)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "/var/log/mongodb/mongodb.log", p.SystemLog.Path)
+	}
 }
 
-// makeStatefulSetReady updates the StatefulSet corresponding to the
-// provided MongoDB resource to mark it as ready for the case of `statefulset.IsReady`
-func makeStatefulSetReady(c k8sClient.Client, mdb mdbv1.MongoDB) {
-	sts := appsv1.StatefulSet{}
-	_ = c.Get(context.TODO(), mdb.NamespacedName(), &sts)
-	sts.Status.ReadyReplicas = int32(mdb.Spec.Members)
-	sts.Status.UpdatedReplicas = int32(mdb.Spec.Members)
-	_ = c.Update(context.TODO(), &sts)
+func TestDataAndLogsPaths_AreConfiguredInAutomationConfig(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Spec.Storage.DataPath = "/var/lib/mongo"
+	mdb.Spec.Storage.LogsPath = "/mnt/logs"
+	mgr := client.NewManager(&mdb)
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	ac, err := getCurrentAutomationConfig(client.NewClient(mgr.GetClient()), mdb)
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "/var/lib/mongo", p.Args26.Storage.DBPath)
+		assert.Equal(t, "/mnt/logs/mongodb.log", p.SystemLog.Path)
+	}
 }
@@ -0,0 +1,76 @@
+package mongodb
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// requeueInterval is how long a resource waits before being reconciled again, the first time it
+	// waits for a change in progress
+	requeueInterval = 10 * time.Second
+	// maxRequeueInterval is the longest a resource waits before being reconciled again, before the jitter
+	maxRequeueInterval = 5 * time.Minute
+	// requeueJitterFactor is the fraction of the interval randomly added to the requeues after the first
+	requeueJitterFactor = 0.1
+)
+
+// requeueBackoff doubles the interval a resource is requeued after while it keeps waiting for the
+// same thing, up to maxRequeueInterval, so that a resource which can't progress, such as one whose
+// Pods can't start, isn't reconciled every 10 seconds forever. The interval is reset as soon as the
+// resource waits for something else, or doesn't need to be requeued anymore. The requeues after the
+// first one are jittered, so that the resources which started waiting together don't keep being
+// reconciled together.
+type requeueBackoff struct {
+	mu     sync.Mutex
+	waits  map[types.NamespacedName]requeueWait
+	jitter func(time.Duration) time.Duration
+}
+
+// requeueWait is what a resource waits for, and how many times it was requeued for it
+type requeueWait struct {
+	reason   string
+	requeues int
+}
+
+func newRequeueBackoff() *requeueBackoff {
+	return &requeueBackoff{
+		waits: map[types.NamespacedName]requeueWait{},
+		jitter: func(interval time.Duration) time.Duration {
+			return wait.Jitter(interval, requeueJitterFactor)
+		},
+	}
+}
+
+// next returns how long the resource waits before being reconciled again, while it waits for the reason
+func (b *requeueBackoff) next(nsName types.NamespacedName, reason string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := b.waits[nsName]
+	if current.reason != reason {
+		current = requeueWait{reason: reason}
+	}
+	interval := requeueInterval
+	for i := 0; i < current.requeues && interval < maxRequeueInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxRequeueInterval {
+		interval = maxRequeueInterval
+	}
+	if current.requeues > 0 {
+		interval = b.jitter(interval)
+	}
+	current.requeues++
+	b.waits[nsName] = current
+	return interval
+}
+
+// reset forgets what the resource waited for, once it doesn't wait anymore
+func (b *requeueBackoff) reset(nsName types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.waits, nsName)
+}
@@ -0,0 +1,71 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// assertRequeued asserts that the resource is reconciled again later, after the backoff of its wait
+func assertRequeued(t *testing.T, res reconcile.Result, msgAndArgs ...interface{}) {
+	assert.False(t, res.Requeue, msgAndArgs...)
+	assert.True(t, res.RequeueAfter >= requeueInterval && res.RequeueAfter <= maxRequeueInterval+maxRequeueInterval/10, msgAndArgs...)
+}
+
+func TestRequeueBackoff(t *testing.T) {
+	backoff := newRequeueBackoff()
+	backoff.jitter = func(interval time.Duration) time.Duration { return interval + time.Second }
+	rs := types.NamespacedName{Name: "my-rs", Namespace: "my-ns"}
+	other := types.NamespacedName{Name: "other-rs", Namespace: "my-ns"}
+
+	assert.Equal(t, 10*time.Second, backoff.next(rs, "StatefulSet is not ready"))
+	assert.Equal(t, 21*time.Second, backoff.next(rs, "StatefulSet is not ready"))
+	assert.Equal(t, 41*time.Second, backoff.next(rs, "StatefulSet is not ready"))
+	assert.Equal(t, 10*time.Second, backoff.next(other, "StatefulSet is not ready"), "each resource has its own backoff")
+	for i := 0; i < 10; i++ {
+		backoff.next(rs, "StatefulSet is not ready")
+	}
+	assert.Equal(t, 5*time.Minute+time.Second, backoff.next(rs, "StatefulSet is not ready"))
+
+	assert.Equal(t, 10*time.Second, backoff.next(rs, "Waiting for member my-rs-1"), "the backoff is reset once the resource progresses")
+	backoff.reset(rs)
+	assert.Equal(t, 10*time.Second, backoff.next(rs, "Waiting for member my-rs-1"))
+}
+
+func TestReconcile_RequeueBackoff(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.requeueBackoff.jitter = func(interval time.Duration) time.Duration { return interval }
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+
+	sts, err := c.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+	sts.Status.ReadyReplicas = 2
+	assert.NoError(t, c.Update(context.TODO(), &sts))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, res.RequeueAfter)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, 20*time.Second, res.RequeueAfter, "the resource is still waiting for its StatefulSet")
+
+	testutils.MakeStatefulSetReady(c, mdb)
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &sts)
+	sts.Status.ReadyReplicas = 2
+	assert.NoError(t, c.Update(context.TODO(), &sts))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, res.RequeueAfter, "the backoff is reset once the resource is reconciled")
+}
@@ -0,0 +1,47 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// resourceSelector selects the MongoDB resources managed by the operator, all of them by default
+var resourceSelector = labels.Everything()
+
+// SetResourceSelector restricts the MongoDB resources managed by the operator to the ones whose labels
+// match the selector, so that several operators can share the namespaces they watch. It must be called
+// before the controllers are added to the Manager.
+func SetResourceSelector(selector labels.Selector) {
+	resourceSelector = selector
+}
+
+// isSelected returns true if the MongoDB resource is managed by the operator, or doesn't exist
+func isSelected(c client.Reader, selector labels.Selector, nsName types.NamespacedName) (bool, error) {
+	if selector == nil || selector.Empty() {
+		return true, nil
+	}
+	mdb := mdbv1.MongoDB{}
+	if err := c.Get(context.TODO(), nsName, &mdb); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("error getting MongoDB resource: %s", err)
+	}
+	return selector.Matches(labels.Set(mdb.Labels)), nil
+}
+
+// listSelectedResources lists the MongoDB resources managed by the operator
+func listSelectedResources(c client.Reader, selector labels.Selector, opts ...client.ListOption) (mdbv1.MongoDBList, error) {
+	mdbList := mdbv1.MongoDBList{}
+	if selector != nil && !selector.Empty() {
+		opts = append(opts, client.MatchingLabelsSelector{Selector: selector})
+	}
+	err := c.List(context.TODO(), &mdbList, opts...)
+	return mdbList, err
+}
@@ -0,0 +1,56 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcile_ResourceSelector(t *testing.T) {
+	selector, err := labels.Parse("team=payments")
+	assert.NoError(t, err)
+
+	mdb := testutils.NewTestReplicaSet()
+	mdb.Labels = map[string]string{"team": "search"}
+	mgr := client.NewManager(&mdb)
+	c := client.NewClient(mgr.GetClient())
+	r := newReconciler(mgr, testutils.MockManifestProvider(mdb.Spec.Version))
+	r.selector = selector
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, res)
+	_, err = c.GetStatefulSet(mdb.NamespacedName())
+	assert.Error(t, err, "the resources of other operators aren't reconciled")
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &mdb)
+	assert.Empty(t, mdb.Status.Phase, "the status of the resources of other operators isn't updated")
+
+	mdb.Labels["team"] = "payments"
+	assert.NoError(t, c.Update(context.TODO(), &mdb))
+	res, err = r.Reconcile(reconcile.Request{NamespacedName: mdb.NamespacedName()})
+	testutils.AssertReconciliationSuccessful(t, res, err)
+	_, err = c.GetStatefulSet(mdb.NamespacedName())
+	assert.NoError(t, err)
+}
+
+func TestBackupReconciler_ResourceSelector(t *testing.T) {
+	backup := newTestMongoDBBackup()
+	mgr := client.NewManager(&backup)
+	c := client.NewClient(mgr.GetClient())
+	r := newBackupReconciler(mgr)
+	r.selector = labels.SelectorFromSet(labels.Set{"team": "payments"})
+
+	mdb := testutils.NewScramReplicaSet()
+	mdb.Status.Phase = mdbv1.Running
+	assert.NoError(t, c.Create(context.TODO(), &mdb))
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: backup.NamespacedName()})
+	assert.NoError(t, err)
+	_ = c.Get(context.TODO(), backup.NamespacedName(), &backup)
+	assert.Empty(t, backup.Status.Phase, "the backups of the resources of other operators are left to them")
+}
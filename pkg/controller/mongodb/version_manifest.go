@@ -0,0 +1,152 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	versionManifestConfigMapEnv       = "VERSION_MANIFEST_CONFIGMAP"
+	versionManifestURLEnv             = "VERSION_MANIFEST_URL"
+	versionManifestRefreshIntervalEnv = "VERSION_MANIFEST_REFRESH_INTERVAL"
+	watchNamespaceEnv                 = "WATCH_NAMESPACE"
+	operatorNamespaceEnv              = "OPERATOR_NAMESPACE"
+
+	versionManifestConfigMapKey           = "version_manifest.json"
+	defaultVersionManifestRefreshInterval = time.Hour
+	versionManifestHTTPTimeout            = 30 * time.Second
+)
+
+// newVersionManifestProvider returns the ManifestProvider configured through the environment.
+// The version manifest is read from a ConfigMap if VERSION_MANIFEST_CONFIGMAP is set, from an
+// URL if VERSION_MANIFEST_URL is set, and from the file bundled in the operator image otherwise.
+// ConfigMaps and URLs are read again once the refresh interval has passed, so new MongoDB
+// versions can be enabled without restarting the operator. The ConfigMap is read in the namespace
+// of the operator, OPERATOR_NAMESPACE, which defaults to WATCH_NAMESPACE.
+func newVersionManifestProvider(getter configmap.Getter) (ManifestProvider, error) {
+	interval := defaultVersionManifestRefreshInterval
+	if value, ok := os.LookupEnv(versionManifestRefreshIntervalEnv); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", versionManifestRefreshIntervalEnv, err)
+		}
+		interval = parsed
+	}
+
+	if name, ok := os.LookupEnv(versionManifestConfigMapEnv); ok {
+		nsName := types.NamespacedName{Name: name, Namespace: operatorNamespace()}
+		return newRefreshingManifestProvider(func() ([]byte, error) {
+			data, err := configmap.ReadKey(getter, versionManifestConfigMapKey, nsName)
+			return []byte(data), err
+		}, interval), nil
+	}
+
+	if url, ok := os.LookupEnv(versionManifestURLEnv); ok {
+		return newRefreshingManifestProvider(func() ([]byte, error) {
+			return readURL(url)
+		}, interval), nil
+	}
+
+	return readVersionManifestFromDisk, nil
+}
+
+// operatorNamespace returns the namespace the operator runs in. WATCH_NAMESPACE is only used when
+// OPERATOR_NAMESPACE isn't set, as it may hold several namespaces, or none when all are watched.
+func operatorNamespace() string {
+	if namespace, ok := os.LookupEnv(operatorNamespaceEnv); ok {
+		return namespace
+	}
+	return os.Getenv(watchNamespaceEnv)
+}
+
+// apiConfigMapGetter reads the ConfigMaps from the API server rather than from the cache of the
+// manager, which only holds the ConfigMaps of the watched namespaces
+type apiConfigMapGetter struct {
+	reader client.Reader
+}
+
+func (g apiConfigMapGetter) GetConfigMap(objectKey client.ObjectKey) (corev1.ConfigMap, error) {
+	cm := corev1.ConfigMap{}
+	if err := g.reader.Get(context.TODO(), objectKey, &cm); err != nil {
+		return corev1.ConfigMap{}, err
+	}
+	return cm, nil
+}
+
+// refreshingManifestProvider caches the version manifest and reads it again from its
+// source once the refresh interval has passed. If the source can't be read, the
+// previously read version manifest keeps being used.
+type refreshingManifestProvider struct {
+	read     func() ([]byte, error)
+	interval time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	manifest    *automationconfig.VersionManifest
+	lastRefresh time.Time
+}
+
+func newRefreshingManifestProvider(read func() ([]byte, error), interval time.Duration) ManifestProvider {
+	p := &refreshingManifestProvider{
+		read:     read,
+		interval: interval,
+		now:      time.Now,
+	}
+	return p.get
+}
+
+func (p *refreshingManifestProvider) get() (automationconfig.VersionManifest, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.manifest != nil && p.now().Sub(p.lastRefresh) < p.interval {
+		return *p.manifest, nil
+	}
+
+	manifest, err := p.refresh()
+	if err != nil {
+		if p.manifest == nil {
+			return automationconfig.VersionManifest{}, err
+		}
+		// the refresh is only attempted again after the interval, to not slow down every reconciliation
+		zap.S().Warnf("Error refreshing the version manifest, using the previous one: %s", err)
+		p.lastRefresh = p.now()
+		return *p.manifest, nil
+	}
+	p.manifest = &manifest
+	p.lastRefresh = p.now()
+	return manifest, nil
+}
+
+func (p *refreshingManifestProvider) refresh() (automationconfig.VersionManifest, error) {
+	bytes, err := p.read()
+	if err != nil {
+		return automationconfig.VersionManifest{}, fmt.Errorf("error reading version manifest: %s", err)
+	}
+	return versionManifestFromBytes(bytes)
+}
+
+func readURL(url string) ([]byte, error) {
+	client := http.Client{Timeout: versionManifestHTTPTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
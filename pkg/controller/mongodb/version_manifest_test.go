@@ -0,0 +1,101 @@
+package mongodb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func manifestWithVersion(version string) []byte {
+	return []byte(fmt.Sprintf(`{"updated": 0, "versions": [{"name": "%s", "builds": []}]}`, version))
+}
+
+func TestRefreshingManifestProvider(t *testing.T) {
+	now := time.Now()
+	data := manifestWithVersion("4.2.6")
+	var readErr error
+	reads := 0
+
+	p := &refreshingManifestProvider{
+		read: func() ([]byte, error) {
+			reads++
+			return data, readErr
+		},
+		interval: time.Hour,
+		now:      func() time.Time { return now },
+	}
+
+	manifest, err := p.get()
+	assert.NoError(t, err)
+	assert.Equal(t, "4.2.6", manifest.Versions[0].Name)
+
+	t.Run("Cached manifest is used within the refresh interval", func(t *testing.T) {
+		data = manifestWithVersion("4.2.7")
+		manifest, err := p.get()
+		assert.NoError(t, err)
+		assert.Equal(t, "4.2.6", manifest.Versions[0].Name)
+		assert.Equal(t, 1, reads)
+	})
+
+	t.Run("Manifest is refreshed after the refresh interval", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		manifest, err := p.get()
+		assert.NoError(t, err)
+		assert.Equal(t, "4.2.7", manifest.Versions[0].Name)
+		assert.Equal(t, 2, reads)
+	})
+
+	t.Run("Previous manifest is used when the source can't be read", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		readErr = fmt.Errorf("unavailable")
+		manifest, err := p.get()
+		assert.NoError(t, err)
+		assert.Equal(t, "4.2.7", manifest.Versions[0].Name)
+	})
+}
+
+func TestVersionManifestProvider_FromConfigMap(t *testing.T) {
+	mdb := testutils.NewTestReplicaSet()
+	mgrClient := client.NewClient(client.NewManager(&mdb).GetClient())
+	err := mgrClient.CreateConfigMap(configmap.Builder().
+		SetName("version-manifest").
+		SetNamespace("my-ns").
+		SetField(versionManifestConfigMapKey, string(manifestWithVersion("6.0.5"))).
+		Build())
+	assert.NoError(t, err)
+
+	os.Setenv(versionManifestConfigMapEnv, "version-manifest")
+	os.Setenv(watchNamespaceEnv, "my-ns")
+	defer os.Unsetenv(versionManifestConfigMapEnv)
+	defer os.Unsetenv(watchNamespaceEnv)
+
+	provider, err := newVersionManifestProvider(mgrClient)
+	assert.NoError(t, err)
+	manifest, err := provider()
+	assert.NoError(t, err)
+	assert.Equal(t, "6.0.5", manifest.Versions[0].Name)
+
+	t.Run("The ConfigMap is read in the namespace of the operator", func(t *testing.T) {
+		os.Setenv(watchNamespaceEnv, "team-a,team-b")
+		os.Setenv(operatorNamespaceEnv, "my-ns")
+		defer os.Unsetenv(operatorNamespaceEnv)
+		provider, err := newVersionManifestProvider(apiConfigMapGetter{reader: mgrClient})
+		assert.NoError(t, err)
+		manifest, err := provider()
+		assert.NoError(t, err)
+		assert.Equal(t, "6.0.5", manifest.Versions[0].Name)
+	})
+
+	t.Run("Invalid refresh interval is rejected", func(t *testing.T) {
+		os.Setenv(versionManifestRefreshIntervalEnv, "often")
+		defer os.Unsetenv(versionManifestRefreshIntervalEnv)
+		_, err := newVersionManifestProvider(mgrClient)
+		assert.Error(t, err)
+	})
+}
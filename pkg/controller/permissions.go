@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/permissions"
+)
+
+// allVerbs are the verbs the operator needs on the objects it manages
+var allVerbs = []string{"create", "delete", "get", "list", "patch", "update", "watch"}
+
+// RequiredPermissions are the permissions the controllers need in the namespaces they watch, they must
+// be granted by deploy/role.yaml, deploy/cluster_role.yaml and deploy/cluster_wide/cluster_role.yaml
+var RequiredPermissions = []permissions.Permission{
+	{Resource: "pods", Verbs: allVerbs},
+	{Resource: "pods", Subresource: "eviction", Verbs: []string{"create"}},
+	{Resource: "pods", Subresource: "log", Verbs: []string{"get"}},
+	{Resource: "services", Verbs: allVerbs},
+	{Resource: "persistentvolumeclaims", Verbs: allVerbs},
+	{Resource: "events", Verbs: []string{"create", "patch"}},
+	{Resource: "configmaps", Verbs: allVerbs},
+	{Resource: "secrets", Verbs: allVerbs},
+	// the secrets of Vault are read with tokens of the service account of the members
+	{Resource: "serviceaccounts", Subresource: "token", Verbs: []string{"create"}, Optional: true},
+	{Resource: "nodes", Verbs: []string{"get", "list", "watch"}, ClusterScoped: true},
+	{Group: "apps", Resource: "statefulsets", Verbs: allVerbs},
+	{Group: "policy", Resource: "poddisruptionbudgets", Verbs: allVerbs},
+	{Group: "batch", Resource: "jobs", Verbs: allVerbs},
+	{Group: "batch", Resource: "cronjobs", Verbs: allVerbs},
+	{Group: "mongodb.com", Resource: "mongodbs", Verbs: allVerbs},
+	{Group: "mongodb.com", Resource: "mongodbs", Subresource: "status", Verbs: []string{"patch", "update"}},
+	{Group: "mongodb.com", Resource: "mongodbbackups", Verbs: allVerbs},
+	{Group: "mongodb.com", Resource: "mongodbbackups", Subresource: "status", Verbs: []string{"patch", "update"}},
+	{Group: "mongodb.com", Resource: "mongodbrestores", Verbs: allVerbs},
+	{Group: "mongodb.com", Resource: "mongodbrestores", Subresource: "status", Verbs: []string{"patch", "update"}},
+	{Group: "mongodb.com", Resource: "clustermongodbroles", Verbs: []string{"get", "list", "watch"}, ClusterScoped: true},
+	{Group: "monitoring.coreos.com", Resource: "servicemonitors", Verbs: []string{"create", "get"}, Optional: true},
+	{Group: "monitoring.coreos.com", Resource: "podmonitors", Verbs: []string{"create", "delete", "get", "update"}, Optional: true},
+	{Group: "monitoring.coreos.com", Resource: "prometheusrules", Verbs: []string{"create", "delete", "get", "update"}, Optional: true},
+	{Group: "externaldns.k8s.io", Resource: "dnsendpoints", Verbs: []string{"create", "delete", "get", "update"}, Optional: true},
+	{Group: "snapshot.storage.k8s.io", Resource: "volumesnapshots", Verbs: []string{"create", "delete", "get"}, Optional: true},
+}
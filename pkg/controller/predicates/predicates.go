@@ -4,6 +4,9 @@ import (
 	"reflect"
 
 	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
@@ -11,14 +14,100 @@ import (
 // OnlyOnSpecChange returns a set of predicates indicating
 // that reconciliations should only happen on changes to the Spec of the resource.
 // any other changes won't trigger a reconciliation. This allows us to freely update the annotations
-// of the resource without triggering unintentional reconciliations.
-func OnlyOnSpecChange() predicate.Funcs {
+// of the resource without triggering unintentional reconciliations. A change to the value of one of the
+// given annotations, which request an action from the operator, also triggers a reconciliation, as do
+// a change to the labels, which select the operator managing the resource, and the deletion.
+func OnlyOnSpecChange(triggerAnnotations ...string) predicate.Funcs {
 	return predicate.Funcs{
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			oldResource := e.ObjectOld.(*mdbv1.MongoDB)
 			newResource := e.ObjectNew.(*mdbv1.MongoDB)
-			specChanged := !reflect.DeepEqual(oldResource.Spec, newResource.Spec)
-			return specChanged
+			// the generation is only incremented by the changes to the spec, the status being a subresource
+			if oldResource.Generation != newResource.Generation || !reflect.DeepEqual(oldResource.Spec, newResource.Spec) {
+				return true
+			}
+			if !reflect.DeepEqual(oldResource.Labels, newResource.Labels) {
+				return true
+			}
+			if oldResource.DeletionTimestamp == nil && newResource.DeletionTimestamp != nil {
+				return true
+			}
+			for _, key := range triggerAnnotations {
+				if oldResource.Annotations[key] != newResource.Annotations[key] {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// OnlyOnDataChange returns a set of predicates indicating that reconciliations should only happen when
+// the data of a Secret or a ConfigMap changes, or the value of one of the given annotations. The
+// updates of their metadata only, such as the leader election records kept in the annotations of a
+// ConfigMap, won't trigger a reconciliation.
+func OnlyOnDataChange(triggerAnnotations ...string) predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			for _, key := range triggerAnnotations {
+				if e.MetaOld.GetAnnotations()[key] != e.MetaNew.GetAnnotations()[key] {
+					return true
+				}
+			}
+			switch oldObject := e.ObjectOld.(type) {
+			case *corev1.Secret:
+				newObject := e.ObjectNew.(*corev1.Secret)
+				return oldObject.Type != newObject.Type || !reflect.DeepEqual(oldObject.Data, newObject.Data) || !reflect.DeepEqual(oldObject.StringData, newObject.StringData)
+			case *corev1.ConfigMap:
+				newObject := e.ObjectNew.(*corev1.ConfigMap)
+				return !reflect.DeepEqual(oldObject.Data, newObject.Data) || !reflect.DeepEqual(oldObject.BinaryData, newObject.BinaryData)
+			}
+			return true
+		},
+	}
+}
+
+// OnlyMatchingLabels returns a set of predicates indicating that reconciliations should only happen
+// for the objects whose labels match the selector, once the change is applied. A nil selector
+// matches all the objects.
+func OnlyMatchingLabels(selector labels.Selector) predicate.Funcs {
+	matches := func(meta metav1.Object) bool {
+		return selector == nil || selector.Matches(labels.Set(meta.GetLabels()))
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return matches(e.Meta)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return matches(e.Meta)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return matches(e.Meta)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return matches(e.MetaNew)
+		},
+	}
+}
+
+// OnlyOnNodeCordoned returns a set of predicates indicating that reconciliations should only
+// happen when a node is cordoned, which is the first step of a drain. The frequent updates of
+// the status of the nodes won't trigger a reconciliation.
+func OnlyOnNodeCordoned() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool {
+			return false
+		},
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNode := e.ObjectOld.(*corev1.Node)
+			newNode := e.ObjectNew.(*corev1.Node)
+			return !oldNode.Spec.Unschedulable && newNode.Spec.Unschedulable
 		},
 	}
 }
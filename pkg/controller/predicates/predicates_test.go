@@ -0,0 +1,72 @@
+package predicates
+
+import (
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func updateEvent(oldObject, newObject interface {
+	runtime.Object
+	metav1.Object
+}) event.UpdateEvent {
+	return event.UpdateEvent{ObjectOld: oldObject, MetaOld: oldObject, ObjectNew: newObject, MetaNew: newObject}
+}
+
+func TestOnlyOnSpecChange(t *testing.T) {
+	predicate := OnlyOnSpecChange("mongodb.com/v1.rebuildAutomationConfig")
+	mdb := mdbv1.MongoDB{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-rs", Generation: 1, Labels: map[string]string{"team": "payments"}},
+		Spec:       mdbv1.MongoDBSpec{Members: 3},
+	}
+
+	updated := mdb.DeepCopy()
+	updated.Status.Phase = mdbv1.Running
+	updated.Annotations = map[string]string{"mongodb.com/v1.lastAppliedMongoDBVersion": "4.2.2"}
+	assert.False(t, predicate.Update(updateEvent(&mdb, updated)), "the status and the annotations written by the operator are ignored")
+
+	updated = mdb.DeepCopy()
+	updated.Spec.Members, updated.Generation = 5, 2
+	assert.True(t, predicate.Update(updateEvent(&mdb, updated)))
+
+	updated = mdb.DeepCopy()
+	updated.Annotations = map[string]string{"mongodb.com/v1.rebuildAutomationConfig": "true"}
+	assert.True(t, predicate.Update(updateEvent(&mdb, updated)))
+
+	updated = mdb.DeepCopy()
+	updated.Labels["team"] = "search"
+	assert.True(t, predicate.Update(updateEvent(&mdb, updated)), "the labels select the operator")
+
+	updated = mdb.DeepCopy()
+	updated.DeletionTimestamp = &metav1.Time{}
+	assert.True(t, predicate.Update(updateEvent(&mdb, updated)))
+}
+
+func TestOnlyOnDataChange(t *testing.T) {
+	predicate := OnlyOnDataChange("mongodb.com/v1.referencedBy")
+	secret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-tls"}, Data: map[string][]byte{"tls.crt": []byte("a")}}
+
+	updated := secret.DeepCopy()
+	updated.Annotations = map[string]string{"cert-manager.io/certificate-name": "my-tls"}
+	assert.False(t, predicate.Update(updateEvent(&secret, updated)))
+	updated.Data["tls.crt"] = []byte("b")
+	assert.True(t, predicate.Update(updateEvent(&secret, updated)))
+
+	updated = secret.DeepCopy()
+	updated.Annotations = map[string]string{"mongodb.com/v1.referencedBy": "my-rs"}
+	assert.True(t, predicate.Update(updateEvent(&secret, updated)))
+
+	leaderElection := corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "mongodb-kubernetes-operator-leader"}}
+	renewed := leaderElection.DeepCopy()
+	renewed.Annotations = map[string]string{"control-plane.alpha.kubernetes.io/leader": `{"holderIdentity":"operator-0"}`}
+	assert.False(t, predicate.Update(updateEvent(&leaderElection, renewed)))
+	renewed.Data = map[string]string{"key": "value"}
+	assert.True(t, predicate.Update(updateEvent(&leaderElection, renewed)))
+
+	assert.True(t, predicate.Create(event.CreateEvent{Meta: &secret, Object: &secret}))
+}
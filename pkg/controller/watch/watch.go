@@ -1,6 +1,8 @@
 package watch
 
 import (
+	"sync"
+
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/contains"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -13,18 +15,23 @@ import (
 // a watched object changes. It's designed to only be used for a single type of object.
 // If multiple types should be watched, one ResourceWatcher for each type should be used.
 type ResourceWatcher struct {
+	// mu guards watched, which is written by the concurrent reconciliations and read by the events
+	mu      *sync.RWMutex
 	watched map[types.NamespacedName][]types.NamespacedName
 }
 
 // New will create a new ResourceWatcher with no watched objects.
 func New() ResourceWatcher {
 	return ResourceWatcher{
+		mu:      &sync.RWMutex{},
 		watched: make(map[types.NamespacedName][]types.NamespacedName),
 	}
 }
 
 // Watch will add a new object to watch.
 func (w ResourceWatcher) Watch(watchedName, dependentName types.NamespacedName) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	existing, hasExisting := w.watched[watchedName]
 	if !hasExisting {
 		existing = []types.NamespacedName{}
@@ -63,6 +70,8 @@ func (w ResourceWatcher) handleEvent(meta metav1.Object, queue workqueue.RateLim
 		Namespace: meta.GetNamespace(),
 	}
 
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 	// Enqueue reconciliation for each dependent object.
 	for _, reconciledObjectName := range w.watched[changedObjectName] {
 		queue.Add(reconcile.Request{
@@ -16,6 +16,13 @@ import (
 	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// FieldManager is the field manager of the fields applied by the operator with server-side apply
+const FieldManager = "mongodb-kubernetes-operator"
+
+// WatchedLabelKey labels the Secrets and ConfigMaps written or referenced by the operator, which are
+// the only ones it caches and watches
+const WatchedLabelKey = "mongodb.com/v1.watched"
+
 func NewClient(c k8sClient.Client) Client {
 	return client{
 		Client: c,
@@ -28,8 +35,12 @@ type Client interface {
 	GetAndUpdate(nsName types.NamespacedName, obj runtime.Object, updateFunc func()) error
 	configmap.GetUpdateCreateDeleter
 	service.GetUpdateCreator
+	service.Applier
 	secret.GetUpdateCreateDeleter
+	secret.Applier
 	statefulset.GetUpdateCreateDeleter
+	statefulset.Applier
+	Patcher
 }
 
 type client struct {
@@ -49,6 +60,24 @@ func (c client) GetAndUpdate(nsName types.NamespacedName, obj runtime.Object, up
 	return c.Update(context.TODO(), obj)
 }
 
+// apply applies the object with server-side apply. The fields it holds are owned by the operator,
+// even if they were set by another field manager, and the fields it doesn't hold are left to the
+// other field managers. The object is applied as a whole, without checking its resource version.
+func (c client) apply(obj Object) error {
+	obj.SetResourceVersion("")
+	obj.SetManagedFields(nil)
+	return c.Patch(context.TODO(), obj, k8sClient.Apply, k8sClient.FieldOwner(FieldManager), k8sClient.ForceOwnership)
+}
+
+// setWatchedLabel labels the Secret or ConfigMap written by the operator, so that it's cached and watched
+func setWatchedLabel(obj metav1.Object) {
+	labels := map[string]string{WatchedLabelKey: "true"}
+	for key, value := range obj.GetLabels() {
+		labels[key] = value
+	}
+	obj.SetLabels(labels)
+}
+
 // GetConfigMap provides a thin wrapper and client.client to access corev1.ConfigMap types
 func (c client) GetConfigMap(objectKey k8sClient.ObjectKey) (corev1.ConfigMap, error) {
 	cm := corev1.ConfigMap{}
@@ -60,11 +89,13 @@ func (c client) GetConfigMap(objectKey k8sClient.ObjectKey) (corev1.ConfigMap, e
 
 // UpdateConfigMap provides a thin wrapper and client.Client to update corev1.ConfigMap types
 func (c client) UpdateConfigMap(cm corev1.ConfigMap) error {
+	setWatchedLabel(&cm)
 	return c.Update(context.TODO(), &cm)
 }
 
 // CreateConfigMap provides a thin wrapper and client.Client to create corev1.ConfigMap types
 func (c client) CreateConfigMap(cm corev1.ConfigMap) error {
+	setWatchedLabel(&cm)
 	return c.Create(context.TODO(), &cm)
 }
 
@@ -90,11 +121,13 @@ func (c client) GetSecret(objectKey k8sClient.ObjectKey) (corev1.Secret, error)
 
 // UpdateSecret provides a thin wrapper and client.Client to update corev1.Secret types
 func (c client) UpdateSecret(secret corev1.Secret) error {
+	setWatchedLabel(&secret)
 	return c.Update(context.TODO(), &secret)
 }
 
 // CreateSecret provides a thin wrapper and client.Client to create corev1.Secret types
 func (c client) CreateSecret(secret corev1.Secret) error {
+	setWatchedLabel(&secret)
 	return c.Create(context.TODO(), &secret)
 }
 
@@ -109,6 +142,13 @@ func (c client) DeleteSecret(key k8sClient.ObjectKey) error {
 	return c.Delete(context.TODO(), &s)
 }
 
+// ApplySecret provides a thin wrapper and client.Client to apply corev1.Secret types
+func (c client) ApplySecret(secret corev1.Secret) error {
+	secret.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+	setWatchedLabel(&secret)
+	return c.apply(&secret)
+}
+
 // GetService provides a thin wrapper and client.Client to access corev1.Service types
 func (c client) GetService(objectKey k8sClient.ObjectKey) (corev1.Service, error) {
 	s := corev1.Service{}
@@ -128,6 +168,12 @@ func (c client) CreateService(service corev1.Service) error {
 	return c.Create(context.TODO(), &service)
 }
 
+// ApplyService provides a thin wrapper and client.Client to apply corev1.Service types
+func (c client) ApplyService(service corev1.Service) error {
+	service.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Service"}
+	return c.apply(&service)
+}
+
 // GetStatefulSet provides a thin wrapper and client.Client to access appsv1.StatefulSet types
 func (c client) GetStatefulSet(objectKey k8sClient.ObjectKey) (appsv1.StatefulSet, error) {
 	sts := appsv1.StatefulSet{}
@@ -147,6 +193,12 @@ func (c client) CreateStatefulSet(sts appsv1.StatefulSet) error {
 	return c.Create(context.TODO(), &sts)
 }
 
+// ApplyStatefulSet provides a thin wrapper and client.Client to apply appsv1.StatefulSet types
+func (c client) ApplyStatefulSet(sts appsv1.StatefulSet) error {
+	sts.TypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"}
+	return c.apply(&sts)
+}
+
 // DeleteStatefulSet provides a thin wrapper and client.Client to delete appsv1.StatefulSet types
 func (c client) DeleteStatefulSet(objectKey k8sClient.ObjectKey) error {
 	sts := appsv1.StatefulSet{
@@ -8,7 +8,10 @@ import (
 
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -81,3 +84,62 @@ func TestDeleteConfigMap(t *testing.T) {
 	_, err = client.GetConfigMap(types.NamespacedName{Name: "config-map", Namespace: "default"})
 	assert.Equal(t, err, notFoundError())
 }
+
+// patchRecordingClient records the patches sent to the client it wraps
+type patchRecordingClient struct {
+	k8sClient.Client
+	patchType types.PatchType
+	options   k8sClient.PatchOptions
+}
+
+func (c *patchRecordingClient) Patch(ctx context.Context, obj runtime.Object, patch k8sClient.Patch, opts ...k8sClient.PatchOption) error {
+	c.patchType = patch.Type()
+	c.options.ApplyOptions(opts)
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApplyStatefulSet(t *testing.T) {
+	recorder := &patchRecordingClient{Client: NewMockedClient()}
+	client := NewClient(recorder)
+	replicas := int32(3)
+	sts := appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-rs", Namespace: "my-ns", ResourceVersion: "12"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+
+	assert.NoError(t, client.ApplyStatefulSet(sts))
+	assert.Equal(t, types.ApplyPatchType, recorder.patchType)
+	assert.Equal(t, FieldManager, recorder.options.FieldManager)
+	assert.True(t, *recorder.options.Force, "the fields applied by the operator are owned by it")
+
+	applied, err := client.GetStatefulSet(types.NamespacedName{Name: "my-rs", Namespace: "my-ns"})
+	assert.NoError(t, err)
+	assert.Equal(t, "StatefulSet", applied.Kind)
+	assert.Empty(t, applied.ResourceVersion, "the StatefulSet is applied whatever its current version")
+	assert.Equal(t, int32(3), applied.Status.ReadyReplicas)
+
+	applied.Status.ReadyReplicas = 1
+	assert.NoError(t, client.UpdateStatefulSet(applied))
+	replicas = 5
+	assert.NoError(t, client.ApplyStatefulSet(sts))
+	applied, _ = client.GetStatefulSet(types.NamespacedName{Name: "my-rs", Namespace: "my-ns"})
+	assert.Equal(t, int32(5), *applied.Spec.Replicas)
+	assert.Equal(t, int32(1), applied.Status.ReadyReplicas, "the status isn't applied")
+}
+
+func TestWrittenSecretsAndConfigMaps_AreLabelled(t *testing.T) {
+	client := NewClient(NewMockedClient())
+	cm := configmap.Builder().SetName("my-rs-config").SetNamespace("my-ns").Build()
+	cm.Labels = map[string]string{"team": "payments"}
+	assert.NoError(t, client.CreateConfigMap(cm))
+	assert.Equal(t, map[string]string{"team": "payments"}, cm.Labels, "the labels of the given ConfigMap are left unchanged")
+
+	written, err := client.GetConfigMap(types.NamespacedName{Name: "my-rs-config", Namespace: "my-ns"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments", WatchedLabelKey: "true"}, written.Labels)
+
+	assert.NoError(t, client.ApplySecret(corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-rs-keyfile", Namespace: "my-ns"}}))
+	secret, err := client.GetSecret(types.NamespacedName{Name: "my-rs-keyfile", Namespace: "my-ns"})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", secret.Labels[WatchedLabelKey])
+}
@@ -2,18 +2,32 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"reflect"
+	"sort"
+	"sync"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
 
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// mockedClient dynamically creates maps to store instances of runtime.Object
+// mockedClient dynamically creates maps to store instances of runtime.Object, it can be used
+// concurrently like the client of the manager
 type mockedClient struct {
-	backingMap map[reflect.Type]map[k8sClient.ObjectKey]runtime.Object
+	mu sync.Mutex
+	// backingMap holds the objects by type, and the unstructured objects by kind
+	backingMap map[interface{}]map[k8sClient.ObjectKey]runtime.Object
 }
 
 // notFoundError returns an error which returns true for "errors.IsNotFound"
@@ -26,11 +40,14 @@ func alreadyExistsError() error {
 }
 
 func NewMockedClient() k8sClient.Client {
-	return &mockedClient{backingMap: map[reflect.Type]map[k8sClient.ObjectKey]runtime.Object{}}
+	return &mockedClient{backingMap: map[interface{}]map[k8sClient.ObjectKey]runtime.Object{}}
 }
 
 func (m *mockedClient) ensureMapFor(obj runtime.Object) map[k8sClient.ObjectKey]runtime.Object {
-	t := reflect.TypeOf(obj)
+	var t interface{} = reflect.TypeOf(obj)
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		t = u.GroupVersionKind()
+	}
 	if _, ok := m.backingMap[t]; !ok {
 		m.backingMap[t] = map[k8sClient.ObjectKey]runtime.Object{}
 	}
@@ -38,6 +55,8 @@ func (m *mockedClient) ensureMapFor(obj runtime.Object) map[k8sClient.ObjectKey]
 }
 
 func (m *mockedClient) Get(_ context.Context, key k8sClient.ObjectKey, obj runtime.Object) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	relevantMap := m.ensureMapFor(obj)
 	if val, ok := relevantMap[key]; ok {
 		v := reflect.ValueOf(obj).Elem()
@@ -48,6 +67,8 @@ func (m *mockedClient) Get(_ context.Context, key k8sClient.ObjectKey, obj runti
 }
 
 func (m *mockedClient) Create(_ context.Context, obj runtime.Object, _ ...k8sClient.CreateOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	relevantMap := m.ensureMapFor(obj)
 	objKey, err := k8sClient.ObjectKeyFromObject(obj)
 	if err != nil {
@@ -72,11 +93,47 @@ func makeStatefulSetReady(set *appsv1.StatefulSet) {
 	set.Status.ReadyReplicas = *set.Spec.Replicas
 }
 
-func (m *mockedClient) List(_ context.Context, _ runtime.Object, _ ...k8sClient.ListOption) error {
+// List returns the objects of the type of the items of the list, ordered by namespace and name,
+// matching the namespace and the label selector of the options. The lists of unstructured objects
+// are left empty.
+func (m *mockedClient) List(_ context.Context, list runtime.Object, opts ...k8sClient.ListOption) error {
+	if _, ok := list.(*unstructured.UnstructuredList); ok {
+		return nil
+	}
+	listOpts := k8sClient.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	items := reflect.ValueOf(list).Elem().FieldByName("Items")
+	if !items.IsValid() {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	objs := m.ensureMapFor(reflect.New(items.Type().Elem()).Interface().(runtime.Object))
+	keys := make([]k8sClient.ObjectKey, 0, len(objs))
+	for key := range objs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	for _, key := range keys {
+		if listOpts.Namespace != "" && key.Namespace != listOpts.Namespace {
+			continue
+		}
+		accessor, err := meta.Accessor(objs[key])
+		if err != nil {
+			return err
+		}
+		if listOpts.LabelSelector != nil && !listOpts.LabelSelector.Matches(labels.Set(accessor.GetLabels())) {
+			continue
+		}
+		items.Set(reflect.Append(items, reflect.ValueOf(objs[key]).Elem()))
+	}
 	return nil
 }
 
 func (m *mockedClient) Delete(_ context.Context, obj runtime.Object, _ ...k8sClient.DeleteOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	relevantMap := m.ensureMapFor(obj)
 	objKey, err := k8sClient.ObjectKeyFromObject(obj)
 	if err != nil {
@@ -87,16 +144,114 @@ func (m *mockedClient) Delete(_ context.Context, obj runtime.Object, _ ...k8sCli
 }
 
 func (m *mockedClient) Update(_ context.Context, obj runtime.Object, _ ...k8sClient.UpdateOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	relevantMap := m.ensureMapFor(obj)
 	objKey, err := k8sClient.ObjectKeyFromObject(obj)
 	if err != nil {
 		return err
 	}
+	if existing, ok := relevantMap[objKey]; ok && hasStatusSubresource(obj) {
+		copyStatus(obj, existing)
+	}
 	relevantMap[objKey] = obj
 	return nil
 }
 
-func (m *mockedClient) Patch(_ context.Context, _ runtime.Object, _ k8sClient.Patch, _ ...k8sClient.PatchOption) error {
+// hasStatusSubresource returns true if the status of the object is only written through the status
+// subresource, as for the resources of the operator, and is left unchanged by the other writes
+func hasStatusSubresource(obj runtime.Object) bool {
+	switch obj.(type) {
+	case *mdbv1.MongoDB, *mdbv1.MongoDBBackup, *mdbv1.MongoDBRestore:
+		return true
+	}
+	return false
+}
+
+// copyStatus sets the status of dst to the one of src, if the object has a status
+func copyStatus(dst, src runtime.Object) {
+	if status := reflect.ValueOf(dst).Elem().FieldByName("Status"); status.IsValid() {
+		status.Set(reflect.ValueOf(src).Elem().FieldByName("Status"))
+	}
+}
+
+// Patch supports server-side apply, merge and strategic merge patches, the other patches are ignored
+func (m *mockedClient) Patch(_ context.Context, obj runtime.Object, patch k8sClient.Patch, _ ...k8sClient.PatchOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch patch.Type() {
+	case types.ApplyPatchType:
+		return m.apply(obj)
+	case types.MergePatchType, types.StrategicMergePatchType:
+		return m.mergePatch(obj, patch, false)
+	}
+	return nil
+}
+
+// apply replaces the stored object with the applied one, except for its status which is only
+// changed through the status subresource
+func (m *mockedClient) apply(obj runtime.Object) error {
+	relevantMap := m.ensureMapFor(obj)
+	objKey, err := k8sClient.ObjectKeyFromObject(obj)
+	if err != nil {
+		return err
+	}
+	existing, ok := relevantMap[objKey]
+	if !ok {
+		switch v := obj.(type) {
+		case *appsv1.StatefulSet:
+			makeStatefulSetReady(v)
+		}
+	} else {
+		copyStatus(obj, existing)
+	}
+	relevantMap[objKey] = obj
+	return nil
+}
+
+// mergePatch applies the merge or strategic merge patch to the stored object, which obj is then set to.
+// Only the status is patched through the status subresource, and only the rest of the object
+// otherwise if it has a status subresource.
+func (m *mockedClient) mergePatch(obj runtime.Object, patch k8sClient.Patch, status bool) error {
+	relevantMap := m.ensureMapFor(obj)
+	objKey, err := k8sClient.ObjectKeyFromObject(obj)
+	if err != nil {
+		return err
+	}
+	existing, ok := relevantMap[objKey]
+	if !ok {
+		return notFoundError()
+	}
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	existingBytes, err := json.Marshal(existing)
+	if err != nil {
+		return err
+	}
+	var patchedBytes []byte
+	if patch.Type() == types.StrategicMergePatchType {
+		patchedBytes, err = strategicpatch.StrategicMergePatch(existingBytes, data, obj)
+	} else {
+		patchedBytes, err = jsonpatch.MergePatch(existingBytes, data)
+	}
+	if err != nil {
+		return err
+	}
+	patched := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err := json.Unmarshal(patchedBytes, patched); err != nil {
+		return err
+	}
+	if status {
+		patchedStatus := patched
+		patched = existing.DeepCopyObject()
+		copyStatus(patched, patchedStatus)
+	} else if hasStatusSubresource(obj) {
+		copyStatus(patched, existing)
+	}
+	relevantMap[objKey] = patched
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(patched.DeepCopyObject()).Elem())
 	return nil
 }
 
@@ -105,5 +260,40 @@ func (m *mockedClient) DeleteAllOf(_ context.Context, _ runtime.Object, _ ...k8s
 }
 
 func (m *mockedClient) Status() k8sClient.StatusWriter {
-	return m
+	return mockedStatusWriter{client: m}
+}
+
+// mockedStatusWriter writes the status of the objects, the rest of them is left unchanged
+type mockedStatusWriter struct {
+	client *mockedClient
+}
+
+func (s mockedStatusWriter) Update(_ context.Context, obj runtime.Object, _ ...k8sClient.UpdateOption) error {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	relevantMap := s.client.ensureMapFor(obj)
+	objKey, err := k8sClient.ObjectKeyFromObject(obj)
+	if err != nil {
+		return err
+	}
+	existing, ok := relevantMap[objKey]
+	if !ok {
+		return notFoundError()
+	}
+	updated := existing.DeepCopyObject()
+	copyStatus(updated, obj)
+	relevantMap[objKey] = updated
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(updated.DeepCopyObject()).Elem())
+	return nil
+}
+
+// Patch supports merge and strategic merge patches, the other patches are ignored
+func (s mockedStatusWriter) Patch(_ context.Context, obj runtime.Object, patch k8sClient.Patch, _ ...k8sClient.PatchOption) error {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	switch patch.Type() {
+	case types.MergePatchType, types.StrategicMergePatchType:
+		return s.client.mergePatch(obj, patch, true)
+	}
+	return nil
 }
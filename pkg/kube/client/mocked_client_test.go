@@ -4,11 +4,17 @@ import (
 	"context"
 	"testing"
 
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/service"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func TestMockedClient(t *testing.T) {
@@ -44,3 +50,62 @@ func TestMockedClient(t *testing.T) {
 	assert.Equal(t, "svc-namespace", newSvc.Namespace)
 	assert.Equal(t, "svc-name", newSvc.Name)
 }
+
+func TestMockedClient_StatusSubresource(t *testing.T) {
+	mockedClient := NewMockedClient()
+	nsName := types.NamespacedName{Name: "my-rs", Namespace: "my-ns"}
+	mdb := mdbv1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: nsName.Name, Namespace: nsName.Namespace}, Spec: mdbv1.MongoDBSpec{Members: 3}}
+	assert.NoError(t, mockedClient.Create(context.TODO(), &mdb))
+
+	stale := mdb.DeepCopy()
+	mdb.Status.Phase = mdbv1.Running
+	assert.NoError(t, mockedClient.Status().Update(context.TODO(), &mdb))
+
+	// the spec is changed meanwhile with the resource read before the status was written
+	stale.Spec.Members = 5
+	assert.NoError(t, mockedClient.Update(context.TODO(), stale))
+
+	stored := mdbv1.MongoDB{}
+	assert.NoError(t, mockedClient.Get(context.TODO(), nsName, &stored))
+	assert.Equal(t, 5, stored.Spec.Members)
+	assert.Equal(t, mdbv1.Running, stored.Status.Phase, "the status is only written through the status subresource")
+
+	original := stored.DeepCopy()
+	stored.Spec.Members = 7
+	stored.Status.Phase = mdbv1.Failed
+	assert.NoError(t, mockedClient.Status().Patch(context.TODO(), &stored, k8sClient.MergeFrom(original)))
+	assert.NoError(t, mockedClient.Get(context.TODO(), nsName, &stored))
+	assert.Equal(t, 5, stored.Spec.Members, "the spec isn't written through the status subresource")
+	assert.Equal(t, mdbv1.Failed, stored.Status.Phase)
+}
+
+func TestMockedClient_UnstructuredObjectsAreStoredByKind(t *testing.T) {
+	mockedClient := NewMockedClient()
+	podMonitor := unstructured.Unstructured{}
+	podMonitor.SetGroupVersionKind(schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PodMonitor"})
+	podMonitor.SetName("my-rs")
+	podMonitor.SetNamespace("my-ns")
+	assert.NoError(t, mockedClient.Create(context.TODO(), &podMonitor))
+
+	rule := unstructured.Unstructured{}
+	rule.SetGroupVersionKind(schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PrometheusRule"})
+	err := mockedClient.Get(context.TODO(), types.NamespacedName{Name: "my-rs", Namespace: "my-ns"}, &rule)
+	assert.True(t, errors.IsNotFound(err), "an object of another kind with the same name isn't returned")
+}
+
+func TestMockedClient_ListNodes(t *testing.T) {
+	mockedClient := NewMockedClient()
+	for _, name := range []string{"node-b", "node-a"} {
+		assert.NoError(t, mockedClient.Create(context.TODO(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+	}
+
+	nodes := corev1.NodeList{}
+	assert.NoError(t, mockedClient.List(context.TODO(), &nodes))
+	assert.Len(t, nodes.Items, 2)
+	assert.Equal(t, "node-a", nodes.Items[0].Name)
+	assert.Equal(t, "node-b", nodes.Items[1].Name)
+
+	pods := corev1.PodList{}
+	assert.NoError(t, mockedClient.List(context.TODO(), &pods))
+	assert.Empty(t, pods.Items, "only the nodes are listed")
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Object is a Kubernetes object with metadata, which can be applied
+type Object interface {
+	runtime.Object
+	metav1.Object
+}
+
+// Patcher makes minimal writes: only the changes are sent to the API, so that the fields changed by
+// others since the object was read are kept
+type Patcher interface {
+	// MergePatch writes the changes made to obj since original, a copy of it made before the
+	// changes, with a JSON merge patch. The lists are replaced as a whole.
+	MergePatch(original, obj runtime.Object) error
+	// StrategicMergePatch writes the changes made to obj since original with a strategic merge
+	// patch, the lists Kubernetes merges by key, such as the containers of a Pod template, only
+	// have their changed items sent. Only the built-in kinds support it.
+	StrategicMergePatch(original, obj runtime.Object) error
+	// Apply applies obj with server-side apply, its kind must be set. The fields it holds are owned
+	// by the operator, the ones it doesn't hold are left to the other field managers.
+	Apply(obj Object) error
+}
+
+func (c client) MergePatch(original, obj runtime.Object) error {
+	return c.Patch(context.TODO(), obj, k8sClient.MergeFrom(original))
+}
+
+func (c client) StrategicMergePatch(original, obj runtime.Object) error {
+	return c.Patch(context.TODO(), obj, strategicMergeFrom(original))
+}
+
+func (c client) Apply(obj Object) error {
+	if obj.GetObjectKind().GroupVersionKind().Empty() {
+		return fmt.Errorf("the kind of %s must be set to apply it", obj.GetName())
+	}
+	switch obj.(type) {
+	case *corev1.Secret, *corev1.ConfigMap:
+		setWatchedLabel(obj)
+	}
+	return c.apply(obj)
+}
+
+// strategicMergeFromPatch is the strategic merge patch from the original object to the patched one,
+// the equivalent of the JSON merge patch of k8sClient.MergeFrom
+type strategicMergeFromPatch struct {
+	from runtime.Object
+}
+
+func strategicMergeFrom(obj runtime.Object) k8sClient.Patch {
+	return strategicMergeFromPatch{from: obj}
+}
+
+func (s strategicMergeFromPatch) Type() types.PatchType {
+	return types.StrategicMergePatchType
+}
+
+func (s strategicMergeFromPatch) Data(obj runtime.Object) ([]byte, error) {
+	original, err := json.Marshal(s.from)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return strategicpatch.CreateTwoWayMergePatch(original, modified, obj)
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMergePatch(t *testing.T) {
+	recorder := &patchRecordingClient{Client: NewMockedClient()}
+	client := NewClient(recorder)
+	nsName := types.NamespacedName{Name: "my-pod", Namespace: "my-ns"}
+	assert.NoError(t, client.Create(context.TODO(), &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: nsName.Name, Namespace: nsName.Namespace}}))
+
+	pod := corev1.Pod{}
+	assert.NoError(t, client.Get(context.TODO(), nsName, &pod))
+	original := pod.DeepCopy()
+	pod.Annotations = map[string]string{"a": "1"}
+
+	// the Pod is changed by another client meanwhile
+	changed := pod.DeepCopy()
+	changed.Annotations = nil
+	changed.Spec.NodeName = "node-1"
+	assert.NoError(t, client.Update(context.TODO(), changed))
+
+	assert.NoError(t, client.MergePatch(original, &pod))
+	assert.Equal(t, types.MergePatchType, recorder.patchType)
+	assert.NoError(t, client.Get(context.TODO(), nsName, &pod))
+	assert.Equal(t, map[string]string{"a": "1"}, pod.Annotations)
+	assert.Equal(t, "node-1", pod.Spec.NodeName, "only the changes are written")
+}
+
+func TestStrategicMergePatch(t *testing.T) {
+	recorder := &patchRecordingClient{Client: NewMockedClient()}
+	client := NewClient(recorder)
+	replicas := int32(3)
+	sts := appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-rs", Namespace: "my-ns"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+	sts.Spec.Template.Spec.Containers = []corev1.Container{{Name: "mongod"}, {Name: "agent"}}
+	assert.NoError(t, client.CreateStatefulSet(sts))
+
+	original := sts.DeepCopy()
+	sts.Spec.Template.Spec.Containers[1].Image = "agent:10"
+
+	// a sidecar is injected meanwhile
+	injected := original.DeepCopy()
+	injected.Spec.Template.Spec.Containers = append(injected.Spec.Template.Spec.Containers, corev1.Container{Name: "sidecar"})
+	assert.NoError(t, client.UpdateStatefulSet(*injected))
+
+	assert.NoError(t, client.StrategicMergePatch(original, &sts))
+	assert.Equal(t, types.StrategicMergePatchType, recorder.patchType)
+	patched, err := client.GetStatefulSet(types.NamespacedName{Name: "my-rs", Namespace: "my-ns"})
+	assert.NoError(t, err)
+	containers := patched.Spec.Template.Spec.Containers
+	assert.Len(t, containers, 3, "the containers are merged by name")
+	assert.Equal(t, "agent", containers[1].Name)
+	assert.Equal(t, "agent:10", containers[1].Image)
+	assert.Equal(t, "sidecar", containers[2].Name)
+}
+
+func TestApply(t *testing.T) {
+	recorder := &patchRecordingClient{Client: NewMockedClient()}
+	client := NewClient(recorder)
+	s := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-secret", Namespace: "my-ns"}}
+	assert.Error(t, client.Apply(&s), "the kind must be set")
+
+	s.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+	assert.NoError(t, client.Apply(&s))
+	assert.Equal(t, types.ApplyPatchType, recorder.patchType)
+	assert.Equal(t, FieldManager, recorder.options.FieldManager)
+	applied, err := client.GetSecret(types.NamespacedName{Name: "my-secret", Namespace: "my-ns"})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", applied.Labels[WatchedLabelKey], "the Secrets are labelled to be watched")
+}
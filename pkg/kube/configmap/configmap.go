@@ -1,10 +1,14 @@
 package configmap
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -71,19 +75,92 @@ func UpdateField(getUpdater GetUpdater, objectKey client.ObjectKey, key, value s
 	if err != nil {
 		return err
 	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
 	cm.Data[key] = value
 	return getUpdater.UpdateConfigMap(cm)
 }
 
 // CreateOrUpdate creates the given ConfigMap if it doesn't exist,
-// or updates it if it does.
+// or updates it if it does. It isn't written if the existing ConfigMap
+// already has the same data, labels, annotations and owner references.
 func CreateOrUpdate(getUpdateCreator GetUpdateCreator, cm corev1.ConfigMap) error {
-	_, err := getUpdateCreator.GetConfigMap(types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace})
+	existing, err := getUpdateCreator.GetConfigMap(types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace})
 	if err != nil {
 		if apiErrors.IsNotFound(err) {
 			return getUpdateCreator.CreateConfigMap(cm)
 		}
 		return err
 	}
+	if isUpToDate(existing, cm) {
+		return nil
+	}
 	return getUpdateCreator.UpdateConfigMap(cm)
 }
+
+// CreateOrPatch creates the given ConfigMap if it doesn't exist, otherwise it merges it into the
+// existing one with Merge, so that the keys written to the same ConfigMap by others are kept. It
+// isn't written if the existing ConfigMap already has them.
+func CreateOrPatch(getUpdateCreator GetUpdateCreator, cm corev1.ConfigMap) error {
+	existing, err := getUpdateCreator.GetConfigMap(types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return getUpdateCreator.CreateConfigMap(cm)
+		}
+		return err
+	}
+	merged := Merge(existing, cm)
+	if isUpToDate(existing, merged) {
+		return nil
+	}
+	return getUpdateCreator.UpdateConfigMap(merged)
+}
+
+// Merge returns a copy of dest with the data, binary data, labels and annotations of source set,
+// and the owner references of source if it has some. The arguments are unchanged.
+func Merge(dest, source corev1.ConfigMap) corev1.ConfigMap {
+	merged := *dest.DeepCopy()
+	merged.Data = mergeStrings(merged.Data, source.Data)
+	merged.Labels = mergeStrings(merged.Labels, source.Labels)
+	merged.Annotations = mergeStrings(merged.Annotations, source.Annotations)
+	if merged.BinaryData == nil && len(source.BinaryData) > 0 {
+		merged.BinaryData = map[string][]byte{}
+	}
+	for k, v := range source.BinaryData {
+		merged.BinaryData[k] = append([]byte{}, v...)
+	}
+	if len(source.OwnerReferences) > 0 {
+		merged.OwnerReferences = append([]metav1.OwnerReference{}, source.OwnerReferences...)
+	}
+	return merged
+}
+
+func mergeStrings(dest, source map[string]string) map[string]string {
+	if dest == nil && len(source) > 0 {
+		dest = map[string]string{}
+	}
+	for k, v := range source {
+		dest[k] = v
+	}
+	return dest
+}
+
+// DataHash returns the hash of the data and binary data of the ConfigMap, which only depends on
+// their content, e.g. to restart the Pods mounting it when it changes
+func DataHash(cm corev1.ConfigMap) string {
+	// the keys of the maps are sorted by json.Marshal, which can't fail for these types
+	bytes, _ := json.Marshal(struct {
+		Data       map[string]string `json:"data,omitempty"`
+		BinaryData map[string][]byte `json:"binaryData,omitempty"`
+	}{cm.Data, cm.BinaryData})
+	return fmt.Sprintf("%x", sha256.Sum256(bytes))
+}
+
+// isUpToDate returns true if the existing ConfigMap has the content and the metadata of the desired one
+func isUpToDate(existing, desired corev1.ConfigMap) bool {
+	return DataHash(existing) == DataHash(desired) &&
+		equality.Semantic.DeepEqual(existing.Labels, desired.Labels) &&
+		equality.Semantic.DeepEqual(existing.Annotations, desired.Annotations) &&
+		equality.Semantic.DeepEqual(existing.OwnerReferences, desired.OwnerReferences)
+}
@@ -7,6 +7,7 @@ import (
 
 type builder struct {
 	data            map[string]string
+	binaryData      map[string][]byte
 	name            string
 	namespace       string
 	ownerReferences []metav1.OwnerReference
@@ -27,6 +28,11 @@ func (b *builder) SetField(key, value string) *builder {
 	return b
 }
 
+func (b *builder) SetBinaryField(key string, value []byte) *builder {
+	b.binaryData[key] = value
+	return b
+}
+
 func (b *builder) SetOwnerReferences(ownerReferences []metav1.OwnerReference) *builder {
 	b.ownerReferences = ownerReferences
 	return b
@@ -39,13 +45,15 @@ func (b builder) Build() corev1.ConfigMap {
 			Namespace:       b.namespace,
 			OwnerReferences: b.ownerReferences,
 		},
-		Data: b.data,
+		Data:       b.data,
+		BinaryData: b.binaryData,
 	}
 }
 
 func Builder() *builder {
 	return &builder{
 		data:            map[string]string{},
+		binaryData:      map[string][]byte{},
 		ownerReferences: []metav1.OwnerReference{},
 	}
 }
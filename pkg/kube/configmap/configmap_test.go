@@ -116,3 +116,94 @@ func nsName(namespace, name string) types.NamespacedName {
 func notFoundError() error {
 	return &errors.StatusError{ErrStatus: metav1.Status{Reason: metav1.StatusReasonNotFound}}
 }
+
+func TestBuilder_SetBinaryField(t *testing.T) {
+	cm := Builder().
+		SetName("name").
+		SetNamespace("namespace").
+		SetField("key1", "value1").
+		SetBinaryField("key2", []byte{0x1f, 0x8b}).
+		Build()
+
+	assert.Equal(t, map[string]string{"key1": "value1"}, cm.Data)
+	assert.Equal(t, map[string][]byte{"key2": {0x1f, 0x8b}}, cm.BinaryData)
+}
+
+// mockConfigMaps holds the ConfigMaps by name, and counts the writes
+type mockConfigMaps struct {
+	configMaps map[string]corev1.ConfigMap
+	writes     int
+}
+
+func (m *mockConfigMaps) GetConfigMap(objectKey client.ObjectKey) (corev1.ConfigMap, error) {
+	if cm, ok := m.configMaps[objectKey.Name]; ok {
+		return *cm.DeepCopy(), nil
+	}
+	return corev1.ConfigMap{}, notFoundError()
+}
+
+func (m *mockConfigMaps) CreateConfigMap(cm corev1.ConfigMap) error {
+	m.writes++
+	m.configMaps[cm.Name] = cm
+	return nil
+}
+
+func (m *mockConfigMaps) UpdateConfigMap(cm corev1.ConfigMap) error {
+	m.writes++
+	m.configMaps[cm.Name] = cm
+	return nil
+}
+
+func TestCreateOrUpdate(t *testing.T) {
+	configMaps := &mockConfigMaps{configMaps: map[string]corev1.ConfigMap{}}
+	cm := Builder().SetName("name").SetNamespace("namespace").SetField("key1", "value1").Build()
+	assert.NoError(t, CreateOrUpdate(configMaps, cm))
+	assert.NoError(t, CreateOrUpdate(configMaps, cm))
+	assert.Equal(t, 1, configMaps.writes, "an unchanged ConfigMap isn't written")
+
+	cm = Builder().SetName("name").SetNamespace("namespace").SetField("key2", "value2").Build()
+	assert.NoError(t, CreateOrUpdate(configMaps, cm))
+	assert.Equal(t, 2, configMaps.writes)
+	assert.Equal(t, map[string]string{"key2": "value2"}, configMaps.configMaps["name"].Data)
+}
+
+func TestCreateOrPatch(t *testing.T) {
+	configMaps := &mockConfigMaps{configMaps: map[string]corev1.ConfigMap{}}
+	owner := []metav1.OwnerReference{{Kind: "MongoDB", Name: "my-rs"}}
+	assert.NoError(t, CreateOrPatch(configMaps, Builder().SetName("name").SetNamespace("namespace").SetField("key1", "value1").Build()))
+
+	assert.NoError(t, CreateOrPatch(configMaps, Builder().
+		SetName("name").
+		SetNamespace("namespace").
+		SetField("key2", "value2").
+		SetBinaryField("key3", []byte{1}).
+		SetOwnerReferences(owner).
+		Build()))
+	cm := configMaps.configMaps["name"]
+	assert.Equal(t, map[string]string{"key1": "value1", "key2": "value2"}, cm.Data, "the other keys are kept")
+	assert.Equal(t, map[string][]byte{"key3": {1}}, cm.BinaryData)
+	assert.Equal(t, owner, cm.OwnerReferences)
+	assert.Equal(t, 2, configMaps.writes)
+
+	assert.NoError(t, CreateOrPatch(configMaps, Builder().SetName("name").SetNamespace("namespace").SetField("key1", "value1").Build()))
+	assert.Equal(t, 2, configMaps.writes, "the ConfigMap isn't written if it already has the keys")
+}
+
+func TestMerge(t *testing.T) {
+	dest := Builder().SetField("key1", "value1").SetField("key2", "value2").Build()
+	source := Builder().SetField("key2", "changed").Build()
+	source.Labels = map[string]string{"app": "my-rs"}
+	merged := Merge(dest, source)
+	assert.Equal(t, map[string]string{"key1": "value1", "key2": "changed"}, merged.Data)
+	assert.Equal(t, map[string]string{"app": "my-rs"}, merged.Labels)
+	assert.Equal(t, "value2", dest.Data["key2"], "the arguments are unchanged")
+}
+
+func TestDataHash(t *testing.T) {
+	cm := Builder().SetField("key1", "value1").SetField("key2", "value2").Build()
+	same := Builder().SetName("other").SetField("key2", "value2").SetField("key1", "value1").Build()
+	assert.Equal(t, DataHash(cm), DataHash(same), "the hash only depends on the data")
+
+	assert.NotEqual(t, DataHash(cm), DataHash(Builder().SetField("key1", "value1").Build()))
+	assert.NotEqual(t, DataHash(cm), DataHash(Builder().SetField("key1", "value1").SetBinaryField("key2", []byte("value2")).Build()))
+}
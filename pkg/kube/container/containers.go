@@ -89,6 +89,13 @@ func WithCommand(cmd []string) Modification {
 	}
 }
 
+// WithArgs sets the arguments of the command of the container
+func WithArgs(args []string) Modification {
+	return func(container *corev1.Container) {
+		container.Args = args
+	}
+}
+
 // WithLifecycle applies the lifecycle Modification to this container's
 // Lifecycle
 func WithLifecycle(lifeCycleMod lifecycle.Modification) Modification {
@@ -107,6 +114,13 @@ func WithEnvs(envs ...corev1.EnvVar) Modification {
 	}
 }
 
+// WithEnvFrom sets the sources of the environment variables of the container
+func WithEnvFrom(envFrom ...corev1.EnvFromSource) Modification {
+	return func(container *corev1.Container) {
+		container.EnvFrom = envFrom
+	}
+}
+
 func mergeEnvs(existing, desired []corev1.EnvVar) []corev1.EnvVar {
 	envMap := make(map[string]corev1.EnvVar)
 	for _, env := range existing {
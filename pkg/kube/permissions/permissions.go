@@ -0,0 +1,194 @@
+// Package permissions checks that the operator has the permissions it needs in the namespaces it
+// watches, with SelfSubjectAccessReviews, so that a missing permission is reported when the operator
+// starts rather than as a Forbidden error in the middle of a reconciliation.
+package permissions
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// recheckInterval is how often the permissions are checked again while some required ones are missing
+const recheckInterval = time.Minute
+
+// Permission is a set of verbs on a resource
+type Permission struct {
+	Group       string
+	Resource    string
+	Subresource string
+	Verbs       []string
+	// ClusterScoped is true for the resources which aren't namespaced, such as the nodes
+	ClusterScoped bool
+	// Optional is true for the permissions only needed by some features, which are unavailable without
+	// them, such as the ones on the resources of the Prometheus Operator
+	Optional bool
+}
+
+// Missing is a verb on a resource the operator isn't allowed
+type Missing struct {
+	Permission Permission
+	Verb       string
+	// Namespace is the namespace the verb isn't allowed in, all the namespaces if it's empty
+	Namespace string
+}
+
+// String describes the missing permission, e.g. "list secrets in namespace my-ns"
+func (m Missing) String() string {
+	resource := m.Permission.Resource
+	if m.Permission.Group != "" {
+		resource += "." + m.Permission.Group
+	}
+	if m.Permission.Subresource != "" {
+		resource += "/" + m.Permission.Subresource
+	}
+	switch {
+	case m.Permission.ClusterScoped:
+		return fmt.Sprintf("%s %s", m.Verb, resource)
+	case m.Namespace == "":
+		return fmt.Sprintf("%s %s in all namespaces", m.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %s", m.Verb, resource, m.Namespace)
+}
+
+// Check returns the verbs of the permissions which aren't allowed in the namespaces, all the namespaces
+// if there are none. The cluster-scoped permissions are checked once.
+func Check(reviews authorizationv1client.SelfSubjectAccessReviewInterface, permissions []Permission, namespaces []string) ([]Missing, error) {
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	var missing []Missing
+	for _, permission := range permissions {
+		permissionNamespaces := namespaces
+		if permission.ClusterScoped {
+			permissionNamespaces = []string{""}
+		}
+		for _, namespace := range permissionNamespaces {
+			for _, verb := range permission.Verbs {
+				allowed, err := isAllowed(reviews, permission, verb, namespace)
+				if err != nil {
+					return nil, err
+				}
+				if !allowed {
+					missing = append(missing, Missing{Permission: permission, Verb: verb, Namespace: namespace})
+				}
+			}
+		}
+	}
+	return missing, nil
+}
+
+func isAllowed(reviews authorizationv1client.SelfSubjectAccessReviewInterface, permission Permission, verb, namespace string) (bool, error) {
+	review, err := reviews.Create(&authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Group:       permission.Group,
+				Resource:    permission.Resource,
+				Subresource: permission.Subresource,
+			},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error reviewing the access to %s: %s", Missing{Permission: permission, Verb: verb, Namespace: namespace}, err)
+	}
+	return review.Status.Allowed, nil
+}
+
+// Checker checks the permissions of the operator once it starts, and fails the readiness check of the
+// operator while some required permissions are missing. It implements manager.Runnable.
+type Checker struct {
+	reviews     authorizationv1client.SelfSubjectAccessReviewInterface
+	permissions []Permission
+	namespaces  []string
+
+	mu sync.Mutex
+	// checked is true once the permissions have been checked
+	checked bool
+	// missing are the required verbs which aren't allowed
+	missing []Missing
+}
+
+func NewChecker(reviews authorizationv1client.SelfSubjectAccessReviewInterface, permissions []Permission, namespaces []string) *Checker {
+	return &Checker{reviews: reviews, permissions: permissions, namespaces: namespaces}
+}
+
+// Start checks the permissions and logs the missing ones, again every recheckInterval while some
+// required permissions are missing, so that the operator becomes ready once they're granted. The
+// operator is considered ready if they can't be checked, as the reconciliations report the permissions
+// they're missing anyway.
+func (c *Checker) Start(stop <-chan struct{}) error {
+	for {
+		if c.check() {
+			return nil
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(recheckInterval):
+		}
+	}
+}
+
+// check checks the permissions, and returns true if none of the required ones are missing
+func (c *Checker) check() bool {
+	missing, err := Check(c.reviews, c.permissions, c.namespaces)
+	if err != nil {
+		zap.S().Warnf("Error checking the permissions of the operator: %s", err)
+	}
+	var required, optional []string
+	var missingRequired []Missing
+	for _, m := range missing {
+		if m.Permission.Optional {
+			optional = append(optional, m.String())
+		} else {
+			required = append(required, m.String())
+			missingRequired = append(missingRequired, m)
+		}
+	}
+	if len(required) > 0 {
+		zap.S().Errorf("The operator is missing required permissions, grant them with its Role or ClusterRole: %s", strings.Join(required, ", "))
+	}
+	if len(optional) > 0 {
+		zap.S().Warnf("The operator is missing the permissions of some optional features, which are unavailable: %s", strings.Join(optional, ", "))
+	}
+	if err == nil && len(missing) == 0 {
+		zap.S().Info("The operator has all the permissions it needs")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checked = true
+	c.missing = missingRequired
+	return len(missingRequired) == 0
+}
+
+// NeedLeaderElection returns false, so that the permissions of every replica of the operator are checked
+func (c *Checker) NeedLeaderElection() bool {
+	return false
+}
+
+// Readyz is the readiness check of the permissions, it fails until they have been checked, and while
+// some required permissions are missing
+func (c *Checker) Readyz(_ *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checked {
+		return fmt.Errorf("the permissions of the operator haven't been checked yet")
+	}
+	if len(c.missing) > 0 {
+		missing := make([]string, len(c.missing))
+		for i, m := range c.missing {
+			missing[i] = m.String()
+		}
+		return fmt.Errorf("missing permissions: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package permissions
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeReviews returns the SelfSubjectAccessReviews of a clientset denying the given accesses, and a
+// pointer to the number of reviews created
+func fakeReviews(denied ...string) (*fake.Clientset, *int) {
+	clientset := fake.NewSimpleClientset()
+	reviews := 0
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		access := fmt.Sprintf("%s %s/%s %s", attributes.Verb, attributes.Resource, attributes.Subresource, attributes.Namespace)
+		review.Status.Allowed = true
+		for _, d := range denied {
+			if d == access {
+				review.Status.Allowed = false
+			}
+		}
+		return true, review, nil
+	})
+	return clientset, &reviews
+}
+
+var testPermissions = []Permission{
+	{Resource: "secrets", Verbs: []string{"get", "list"}},
+	{Group: "mongodb.com", Resource: "mongodbs", Subresource: "status", Verbs: []string{"update"}},
+	{Resource: "nodes", Verbs: []string{"list"}, ClusterScoped: true},
+	{Group: "monitoring.coreos.com", Resource: "podmonitors", Verbs: []string{"create"}, Optional: true},
+}
+
+func TestCheck(t *testing.T) {
+	clientset, reviews := fakeReviews("list secrets/ team-b", "update mongodbs/status team-a", "list nodes/ ")
+	missing, err := Check(clientset.AuthorizationV1().SelfSubjectAccessReviews(), testPermissions, []string{"team-a", "team-b"})
+	assert.NoError(t, err)
+	assert.Equal(t, 9, *reviews, "the cluster-scoped permissions are checked once")
+
+	var descriptions []string
+	for _, m := range missing {
+		descriptions = append(descriptions, m.String())
+	}
+	assert.Equal(t, []string{
+		"list secrets in namespace team-b",
+		"update mongodbs.mongodb.com/status in namespace team-a",
+		"list nodes",
+	}, descriptions)
+}
+
+func TestCheck_AllNamespaces(t *testing.T) {
+	clientset, _ := fakeReviews("get secrets/ ")
+	missing, err := Check(clientset.AuthorizationV1().SelfSubjectAccessReviews(), testPermissions, nil)
+	assert.NoError(t, err)
+	assert.Len(t, missing, 1)
+	assert.Equal(t, "get secrets in all namespaces", missing[0].String())
+}
+
+func TestChecker(t *testing.T) {
+	clientset, _ := fakeReviews("create podmonitors/ my-ns")
+	checker := NewChecker(clientset.AuthorizationV1().SelfSubjectAccessReviews(), testPermissions, []string{"my-ns"})
+	assert.Error(t, checker.Readyz(nil), "the operator isn't ready until the permissions are checked")
+	assert.True(t, checker.check(), "the optional permissions don't prevent the operator from being ready")
+	assert.NoError(t, checker.Readyz(nil))
+
+	clientset, _ = fakeReviews("get secrets/ my-ns", "create podmonitors/ my-ns")
+	checker = NewChecker(clientset.AuthorizationV1().SelfSubjectAccessReviews(), testPermissions, []string{"my-ns"})
+	assert.False(t, checker.check())
+	err := checker.Readyz(nil)
+	assert.EqualError(t, err, "missing permissions: get secrets in namespace my-ns")
+}
+
+func TestChecker_ReadyIfThePermissionsCantBeChecked(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &authorizationv1.SelfSubjectAccessReview{}, fmt.Errorf("unavailable")
+	})
+	checker := NewChecker(clientset.AuthorizationV1().SelfSubjectAccessReviews(), testPermissions, []string{"my-ns"})
+	assert.True(t, checker.check())
+	assert.NoError(t, checker.Readyz(nil))
+}
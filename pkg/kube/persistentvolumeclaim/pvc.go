@@ -29,9 +29,9 @@ func WithName(name string) Modification {
 }
 
 // WithAccessModes sets the PersistentVolumeClaim's AccessModes
-func WithAccessModes(accessMode corev1.PersistentVolumeAccessMode) Modification {
+func WithAccessModes(accessModes ...corev1.PersistentVolumeAccessMode) Modification {
 	return func(claim *corev1.PersistentVolumeClaim) {
-		claim.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{accessMode}
+		claim.Spec.AccessModes = accessModes
 	}
 }
 
@@ -55,3 +55,24 @@ func WithStorageClassName(storageClassName string) Modification {
 		claim.Spec.StorageClassName = &storageClassName
 	}
 }
+
+// WithLabels sets the PersistentVolumeClaim's labels
+func WithLabels(labels map[string]string) Modification {
+	return func(claim *corev1.PersistentVolumeClaim) {
+		claim.Labels = labels
+	}
+}
+
+// WithAnnotations sets the PersistentVolumeClaim's annotations
+func WithAnnotations(annotations map[string]string) Modification {
+	return func(claim *corev1.PersistentVolumeClaim) {
+		claim.Annotations = annotations
+	}
+}
+
+// WithDataSource sets the source the PersistentVolumeClaim's volume is provisioned from
+func WithDataSource(dataSource *corev1.TypedLocalObjectReference) Modification {
+	return func(claim *corev1.PersistentVolumeClaim) {
+		claim.Spec.DataSource = dataSource
+	}
+}
@@ -0,0 +1,75 @@
+package pod
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ExecResult is the output of a command run in a container
+type ExecResult struct {
+	Stdout []byte
+	Stderr []byte
+}
+
+// Executor runs commands in the containers of Pods
+type Executor interface {
+	// Exec runs the command in the container of the Pod and returns its output once it exits. The
+	// error holds the exit code of the command if it fails, the output is returned either way.
+	Exec(nsName types.NamespacedName, container string, command []string) (ExecResult, error)
+}
+
+type spdyExecutor struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+// NewExecutor returns an Executor running the commands through the exec subresource of the Pods
+func NewExecutor(config *rest.Config) (Executor, error) {
+	if config == nil {
+		return nil, fmt.Errorf("no configuration to connect to the Kubernetes API")
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return spdyExecutor{config: config, clientset: clientset}, nil
+}
+
+func (e spdyExecutor) Exec(nsName types.NamespacedName, container string, command []string) (ExecResult, error) {
+	executor, err := remotecommand.NewSPDYExecutor(e.config, "POST", execURL(e.clientset, nsName, container, command))
+	if err != nil {
+		return ExecResult{}, err
+	}
+	var stdout, stderr bytes.Buffer
+	err = executor.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	result := ExecResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if err != nil {
+		return result, fmt.Errorf("error running %v in %s/%s: %s", command, nsName.Name, container, err)
+	}
+	return result, nil
+}
+
+// execURL is the URL of the exec subresource of the Pod running the command in the container
+func execURL(clientset kubernetes.Interface, nsName types.NamespacedName, container string, command []string) *url.URL {
+	return clientset.CoreV1().RESTClient().
+		Post().
+		Resource("pods").
+		Namespace(nsName.Namespace).
+		Name(nsName.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec).
+		URL()
+}
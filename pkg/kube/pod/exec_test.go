@@ -0,0 +1,29 @@
+package pod
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestExecURL(t *testing.T) {
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: "https://kubernetes"})
+	assert.NoError(t, err)
+
+	u := execURL(clientset, types.NamespacedName{Name: "my-rs-0", Namespace: "my-ns"}, "mongod", []string{"df", "-k", "/data"})
+	assert.Equal(t, "/api/v1/namespaces/my-ns/pods/my-rs-0/exec", u.Path)
+	query := u.Query()
+	assert.Equal(t, "mongod", query.Get("container"))
+	assert.Equal(t, []string{"df", "-k", "/data"}, query["command"])
+	assert.Equal(t, "true", query.Get("stdout"))
+	assert.Equal(t, "true", query.Get("stderr"))
+	assert.Empty(t, query.Get("stdin"))
+}
+
+func TestNewExecutor_NoConfig(t *testing.T) {
+	_, err := NewExecutor(nil)
+	assert.Error(t, err)
+}
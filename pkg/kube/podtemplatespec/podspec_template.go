@@ -107,6 +107,13 @@ func WithServiceAccount(serviceAccountName string) Modification {
 	}
 }
 
+// WithHostname sets the PodTemplateSpec's hostname
+func WithHostname(hostname string) Modification {
+	return func(podTemplateSpec *corev1.PodTemplateSpec) {
+		podTemplateSpec.Spec.Hostname = hostname
+	}
+}
+
 // WithVolume ensures the given volume exists
 func WithVolume(volume corev1.Volume) Modification {
 	return func(template *corev1.PodTemplateSpec) {
@@ -216,6 +223,19 @@ func WithAnnotations(annotations map[string]string) Modification {
 	}
 }
 
+// WithAdditionalAnnotations adds the annotations to the PodTemplateSpec's annotations, keeping the
+// other ones
+func WithAdditionalAnnotations(annotations map[string]string) Modification {
+	return func(podTemplateSpec *corev1.PodTemplateSpec) {
+		if podTemplateSpec.Annotations == nil {
+			podTemplateSpec.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			podTemplateSpec.Annotations[key] = value
+		}
+	}
+}
+
 // WithVolumeMounts will add volume mounts to a container or init container by name
 func WithVolumeMounts(containerName string, volumeMounts ...corev1.VolumeMount) Modification {
 	return func(podTemplateSpec *corev1.PodTemplateSpec) {
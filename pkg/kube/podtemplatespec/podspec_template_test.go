@@ -96,3 +96,12 @@ func TestPodTemplateSpec_MultipleEditsToContainer(t *testing.T) {
 	assert.Equal(t, corev1.PullAlways, c.ImagePullPolicy)
 	assert.Equal(t, "cmd", c.Command[0])
 }
+
+func TestPodTemplateSpec_WithAdditionalAnnotations(t *testing.T) {
+	p := New(
+		WithAnnotations(map[string]string{"a": "1"}),
+		WithAdditionalAnnotations(map[string]string{"b": "2"}),
+		WithAdditionalAnnotations(map[string]string{"a": "3"}),
+	)
+	assert.Equal(t, map[string]string{"a": "3", "b": "2"}, p.Annotations)
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -25,6 +27,17 @@ type Deleter interface {
 	DeleteSecret(objectKey client.ObjectKey) error
 }
 
+// Applier applies the Secret with server-side apply, only the fields it holds are
+// owned by the operator
+type Applier interface {
+	ApplySecret(secret corev1.Secret) error
+}
+
+type GetApplier interface {
+	Getter
+	Applier
+}
+
 type GetUpdater interface {
 	Getter
 	Updater
@@ -99,6 +112,60 @@ func CreateOrUpdate(getUpdateCreator GetUpdateCreator, secret corev1.Secret) err
 	return getUpdateCreator.UpdateSecret(secret)
 }
 
+// CreateOrPatch creates the Secret if it doesn't exist, otherwise it only sets the keys, the labels
+// and the owner references of the given Secret on the existing one, so that the keys written to the
+// same Secret by others are kept. The Secret isn't written if it already has them.
+func CreateOrPatch(getUpdateCreator GetUpdateCreator, secret corev1.Secret) error {
+	existing, err := getUpdateCreator.GetSecret(types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return getUpdateCreator.CreateSecret(secret)
+		}
+		return err
+	}
+
+	patched := *existing.DeepCopy()
+	if patched.Data == nil && (len(secret.Data) > 0 || len(secret.StringData) > 0) {
+		patched.Data = map[string][]byte{}
+	}
+	for k, v := range secret.Data {
+		patched.Data[k] = v
+	}
+	for k, v := range secret.StringData {
+		patched.Data[k] = []byte(v)
+	}
+	if patched.Labels == nil && len(secret.Labels) > 0 {
+		patched.Labels = map[string]string{}
+	}
+	for k, v := range secret.Labels {
+		patched.Labels[k] = v
+	}
+	patched.OwnerReferences = mergeOwnerReferences(patched.OwnerReferences, secret.OwnerReferences)
+
+	if equality.Semantic.DeepEqual(existing, patched) {
+		return nil
+	}
+	return getUpdateCreator.UpdateSecret(patched)
+}
+
+// mergeOwnerReferences replaces the owner references to the same owners, by kind and name, and adds
+// the other ones
+func mergeOwnerReferences(existing, refs []metav1.OwnerReference) []metav1.OwnerReference {
+	for _, ref := range refs {
+		replaced := false
+		for i, e := range existing {
+			if e.APIVersion == ref.APIVersion && e.Kind == ref.Kind && e.Name == ref.Name {
+				existing[i] = ref
+				replaced = true
+			}
+		}
+		if !replaced {
+			existing = append(existing, ref)
+		}
+	}
+	return existing
+}
+
 // HasAllKeys returns true if the provided secret contains an element for every
 // key provided. False if a single element is absent
 func HasAllKeys(secret corev1.Secret, keys ...string) bool {
@@ -28,6 +28,12 @@ func (b *builder) SetField(key, value string) *builder {
 	return b
 }
 
+// SetByteField sets the key to the binary value, which is written as is
+func (b *builder) SetByteField(key string, value []byte) *builder {
+	b.data[key] = value
+	return b
+}
+
 func (b *builder) SetOwnerReferences(ownerReferences []metav1.OwnerReference) *builder {
 	b.ownerReferences = ownerReferences
 	return b
@@ -129,3 +129,65 @@ func TestUpdateField(t *testing.T) {
 	val2, _ := ReadKey(getUpdater, "field2", nsName("namespace", "name"))
 	assert.Equal(t, "value2", val2)
 }
+
+// mockSecrets holds the Secrets by name, and counts the updates
+type mockSecrets struct {
+	secrets map[string]corev1.Secret
+	updates int
+}
+
+func (m *mockSecrets) GetSecret(objectKey client.ObjectKey) (corev1.Secret, error) {
+	if s, ok := m.secrets[objectKey.Name]; ok {
+		return *s.DeepCopy(), nil
+	}
+	return corev1.Secret{}, notFoundError()
+}
+
+func (m *mockSecrets) CreateSecret(s corev1.Secret) error {
+	m.secrets[s.Name] = s
+	return nil
+}
+
+func (m *mockSecrets) UpdateSecret(s corev1.Secret) error {
+	m.updates++
+	m.secrets[s.Name] = s
+	return nil
+}
+
+func TestCreateOrPatch(t *testing.T) {
+	secrets := &mockSecrets{secrets: map[string]corev1.Secret{}}
+	owner := metav1.OwnerReference{APIVersion: "mongodb.com/v1", Kind: "MongoDB", Name: "my-rs", UID: "1"}
+	s := Builder().
+		SetName("name").
+		SetNamespace("namespace").
+		SetField("password", "pwd").
+		SetByteField("keyfile", []byte{0, 1}).
+		SetOwnerReferences([]metav1.OwnerReference{owner}).
+		Build()
+	assert.NoError(t, CreateOrPatch(secrets, s))
+	assert.Equal(t, s, secrets.secrets["name"])
+
+	// another tool adds its own key and owner
+	external := secrets.secrets["name"]
+	external.Data["external"] = []byte("kept")
+	external.OwnerReferences = append(external.OwnerReferences, metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "other"})
+	secrets.secrets["name"] = external
+
+	recreatedOwner := owner
+	recreatedOwner.UID = "2"
+	assert.NoError(t, CreateOrPatch(secrets, Builder().
+		SetName("name").
+		SetNamespace("namespace").
+		SetField("password", "new-pwd").
+		SetLabels(map[string]string{"app": "my-rs"}).
+		SetOwnerReferences([]metav1.OwnerReference{recreatedOwner}).
+		Build()))
+	patched := secrets.secrets["name"]
+	assert.Equal(t, map[string][]byte{"password": []byte("new-pwd"), "keyfile": {0, 1}, "external": []byte("kept")}, patched.Data)
+	assert.Equal(t, map[string]string{"app": "my-rs"}, patched.Labels)
+	assert.Equal(t, []metav1.OwnerReference{recreatedOwner, external.OwnerReferences[1]}, patched.OwnerReferences)
+	assert.Equal(t, 1, secrets.updates)
+
+	assert.NoError(t, CreateOrPatch(secrets, Builder().SetName("name").SetNamespace("namespace").SetField("password", "new-pwd").Build()))
+	assert.Equal(t, 1, secrets.updates, "the Secret isn't written if it already has the keys")
+}
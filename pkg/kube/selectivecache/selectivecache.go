@@ -0,0 +1,257 @@
+// Package selectivecache restricts the Secrets and ConfigMaps cached by the operator to the ones
+// matching a label selector, so that the memory used by the operator grows with the number of
+// resources it manages, rather than with the number of Secrets and ConfigMaps of the cluster.
+package selectivecache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// defaultResync is how often the informers of controller-runtime resync by default
+const defaultResync = 10 * time.Hour
+
+// NewCacheFunc returns the function creating the cache of the manager, in which the Secrets and
+// ConfigMaps of the namespaces, all of them if there are none, are only cached if they match the
+// selector. The other objects are cached by the cache created by newCache, cache.New if it's nil.
+func NewCacheFunc(newCache cache.NewCacheFunc, namespaces []string, selector labels.Selector) cache.NewCacheFunc {
+	if newCache == nil {
+		newCache = cache.New
+	}
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		if opts.Mapper == nil {
+			mapper, err := apiutil.NewDynamicRESTMapper(config)
+			if err != nil {
+				return nil, fmt.Errorf("error creating the REST mapper: %s", err)
+			}
+			opts.Mapper = mapper
+		}
+		if opts.Scheme == nil {
+			opts.Scheme = runtime.NewScheme()
+		}
+		base, err := newCache(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the clientset: %s", err)
+		}
+		apiReader, err := client.New(config, client.Options{Scheme: opts.Scheme, Mapper: opts.Mapper})
+		if err != nil {
+			return nil, fmt.Errorf("error creating the API reader: %s", err)
+		}
+		resync := defaultResync
+		if opts.Resync != nil {
+			resync = *opts.Resync
+		}
+		return newSelectiveCache(base, clientset, apiReader, opts.Scheme, namespaces, selector, resync), nil
+	}
+}
+
+// selectiveCache reads the Secrets and ConfigMaps matching the selector from its own informers,
+// and the ones which don't from the API, as they aren't cached. The Secrets and ConfigMaps are
+// always listed from the API. The other objects are read from the base cache.
+type selectiveCache struct {
+	cache.Cache
+	apiReader  client.Reader
+	scheme     *runtime.Scheme
+	factories  []informers.SharedInformerFactory
+	secrets    map[string]toolscache.SharedIndexInformer
+	configMaps map[string]toolscache.SharedIndexInformer
+}
+
+var _ cache.Cache = &selectiveCache{}
+
+func newSelectiveCache(base cache.Cache, clientset kubernetes.Interface, apiReader client.Reader, scheme *runtime.Scheme, namespaces []string, selector labels.Selector, resync time.Duration) *selectiveCache {
+	c := &selectiveCache{
+		Cache:      base,
+		apiReader:  apiReader,
+		scheme:     scheme,
+		secrets:    map[string]toolscache.SharedIndexInformer{},
+		configMaps: map[string]toolscache.SharedIndexInformer{},
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	for _, namespace := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(clientset, resync,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = selector.String()
+			}),
+		)
+		c.factories = append(c.factories, factory)
+		c.secrets[namespace] = factory.Core().V1().Secrets().Informer()
+		c.configMaps[namespace] = factory.Core().V1().ConfigMaps().Informer()
+	}
+	return c
+}
+
+// informersFor returns the informers of the kind of the object if it's a Secret or a ConfigMap
+func (c *selectiveCache) informersFor(gvk schema.GroupVersionKind) (map[string]toolscache.SharedIndexInformer, bool) {
+	switch gvk {
+	case corev1.SchemeGroupVersion.WithKind("Secret"), corev1.SchemeGroupVersion.WithKind("SecretList"):
+		return c.secrets, true
+	case corev1.SchemeGroupVersion.WithKind("ConfigMap"), corev1.SchemeGroupVersion.WithKind("ConfigMapList"):
+		return c.configMaps, true
+	}
+	return nil, false
+}
+
+func (c *selectiveCache) informersForObject(obj runtime.Object) (map[string]toolscache.SharedIndexInformer, bool, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return nil, false, err
+	}
+	selected, ok := c.informersFor(gvk)
+	return selected, ok, nil
+}
+
+func (c *selectiveCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	selected, ok, err := c.informersForObject(obj)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.Cache.Get(ctx, key, obj)
+	}
+	informer, ok := selected[key.Namespace]
+	if !ok {
+		informer, ok = selected[metav1.NamespaceAll]
+	}
+	if ok {
+		item, exists, err := informer.GetIndexer().GetByKey(key.String())
+		if err != nil {
+			return err
+		}
+		if exists {
+			cached, ok := item.(runtime.Object)
+			if !ok {
+				return fmt.Errorf("cached object %s is a %T", key, item)
+			}
+			reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(cached.DeepCopyObject()).Elem())
+			return nil
+		}
+	}
+	// the object doesn't match the selector, or its namespace isn't cached
+	return c.apiReader.Get(ctx, key, obj)
+}
+
+func (c *selectiveCache) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	_, ok, err := c.informersForObject(list)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return c.apiReader.List(ctx, list, opts...)
+	}
+	return c.Cache.List(ctx, list, opts...)
+}
+
+func (c *selectiveCache) GetInformer(obj runtime.Object) (cache.Informer, error) {
+	selected, ok, err := c.informersForObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return newMultiInformer(selected), nil
+	}
+	return c.Cache.GetInformer(obj)
+}
+
+func (c *selectiveCache) GetInformerForKind(gvk schema.GroupVersionKind) (cache.Informer, error) {
+	if selected, ok := c.informersFor(gvk); ok {
+		return newMultiInformer(selected), nil
+	}
+	return c.Cache.GetInformerForKind(gvk)
+}
+
+func (c *selectiveCache) IndexField(obj runtime.Object, field string, extractValue client.IndexerFunc) error {
+	_, ok, err := c.informersForObject(obj)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return fmt.Errorf("the %T objects can't be indexed by the cache", obj)
+	}
+	return c.Cache.IndexField(obj, field, extractValue)
+}
+
+// Start runs the informers of the Secrets and ConfigMaps along with the base cache until the channel
+// is closed, it blocks
+func (c *selectiveCache) Start(stopCh <-chan struct{}) error {
+	for _, factory := range c.factories {
+		factory.Start(stopCh)
+	}
+	return c.Cache.Start(stopCh)
+}
+
+func (c *selectiveCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	for _, factory := range c.factories {
+		for _, synced := range factory.WaitForCacheSync(stop) {
+			if !synced {
+				return false
+			}
+		}
+	}
+	return c.Cache.WaitForCacheSync(stop)
+}
+
+// multiInformer is the informer of a kind for several namespaces
+type multiInformer []toolscache.SharedIndexInformer
+
+var _ cache.Informer = multiInformer{}
+
+func newMultiInformer(byNamespace map[string]toolscache.SharedIndexInformer) multiInformer {
+	var m multiInformer
+	for _, informer := range byNamespace {
+		m = append(m, informer)
+	}
+	return m
+}
+
+func (m multiInformer) AddEventHandler(handler toolscache.ResourceEventHandler) {
+	for _, informer := range m {
+		informer.AddEventHandler(handler)
+	}
+}
+
+func (m multiInformer) AddEventHandlerWithResyncPeriod(handler toolscache.ResourceEventHandler, resyncPeriod time.Duration) {
+	for _, informer := range m {
+		informer.AddEventHandlerWithResyncPeriod(handler, resyncPeriod)
+	}
+}
+
+func (m multiInformer) AddIndexers(indexers toolscache.Indexers) error {
+	for _, informer := range m {
+		if err := informer.AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiInformer) HasSynced() bool {
+	for _, informer := range m {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package selectivecache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// recordingReader records the objects read from it, and returns them as they are
+type recordingReader struct {
+	cache.Cache
+	reads []string
+}
+
+func (r *recordingReader) Get(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+	r.reads = append(r.reads, key.String())
+	return nil
+}
+
+func (r *recordingReader) List(_ context.Context, _ runtime.Object, _ ...client.ListOption) error {
+	r.reads = append(r.reads, "list")
+	return nil
+}
+
+func TestSelectiveCache(t *testing.T) {
+	watched := map[string]string{"mongodb.com/v1.watched": "true"}
+	clientset := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-rs-keyfile", Namespace: "my-ns", Labels: watched}, Data: map[string][]byte{"keyfile": []byte("key")}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "my-ns"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "my-rs-config", Namespace: "my-ns", Labels: watched}},
+	)
+	base := &recordingReader{}
+	apiReader := &recordingReader{}
+	c := newSelectiveCache(base, clientset, apiReader, scheme.Scheme, []string{"my-ns"}, labels.SelectorFromSet(watched), time.Hour)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, factory := range c.factories {
+		factory.Start(stop)
+		factory.WaitForCacheSync(stop)
+	}
+
+	secret := corev1.Secret{}
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-keyfile", Namespace: "my-ns"}, &secret))
+	assert.Equal(t, []byte("key"), secret.Data["keyfile"])
+	cm := corev1.ConfigMap{}
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-config", Namespace: "my-ns"}, &cm))
+	assert.Equal(t, "my-rs-config", cm.Name)
+	assert.Empty(t, apiReader.reads, "the labelled Secrets and ConfigMaps are read from the cache")
+	assert.Len(t, c.secrets["my-ns"].GetStore().List(), 1, "only the labelled Secrets are cached")
+
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "unrelated", Namespace: "my-ns"}, &corev1.Secret{}))
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-tls", Namespace: "other-ns"}, &corev1.Secret{}))
+	assert.NoError(t, c.List(context.TODO(), &corev1.SecretList{}))
+	assert.Equal(t, []string{"my-ns/unrelated", "other-ns/my-tls", "list"}, apiReader.reads)
+
+	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "my-rs-0", Namespace: "my-ns"}, &corev1.Pod{}))
+	assert.Equal(t, []string{"my-ns/my-rs-0"}, base.reads, "the other objects are read from the base cache")
+
+	informer, err := c.GetInformer(&corev1.Secret{})
+	assert.NoError(t, err)
+	assert.True(t, informer.HasSynced())
+}
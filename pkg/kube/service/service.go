@@ -2,6 +2,8 @@ package service
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -10,11 +12,17 @@ type Getter interface {
 }
 
 type Updater interface {
-	UpdateService(secret corev1.Service) error
+	UpdateService(service corev1.Service) error
 }
 
 type Creator interface {
-	CreateService(secret corev1.Service) error
+	CreateService(service corev1.Service) error
+}
+
+// Applier applies the Service with server-side apply, only the fields it holds are
+// owned by the operator
+type Applier interface {
+	ApplyService(service corev1.Service) error
 }
 
 type GetUpdater interface {
@@ -28,14 +36,34 @@ type GetUpdateCreator interface {
 	Creator
 }
 
+// CreateOrUpdate creates the given Service if it doesn't exist, or updates it if it does. The
+// given Service is merged into the existing one with Merge, so that the fields allocated by the
+// cluster, such as its cluster IP and node port, are kept.
+func CreateOrUpdate(getUpdateCreator GetUpdateCreator, service corev1.Service) error {
+	existing, err := getUpdateCreator.GetService(types.NamespacedName{Name: service.Name, Namespace: service.Namespace})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return getUpdateCreator.CreateService(service)
+		}
+		return err
+	}
+	return getUpdateCreator.UpdateService(Merge(existing, service))
+}
+
 // Merge merges `source` into `dest`. Both arguments will remain unchanged
 // a new service will be created and returned.
 // The "merging" process is arbitrary and it only handle specific attributes
 func Merge(dest corev1.Service, source corev1.Service) corev1.Service {
+	if dest.ObjectMeta.Annotations == nil && len(source.ObjectMeta.Annotations) > 0 {
+		dest.ObjectMeta.Annotations = map[string]string{}
+	}
 	for k, v := range source.ObjectMeta.Annotations {
 		dest.ObjectMeta.Annotations[k] = v
 	}
 
+	if dest.ObjectMeta.Labels == nil && len(source.ObjectMeta.Labels) > 0 {
+		dest.ObjectMeta.Labels = map[string]string{}
+	}
 	for k, v := range source.ObjectMeta.Labels {
 		dest.ObjectMeta.Labels[k] = v
 	}
@@ -47,7 +75,7 @@ func Merge(dest corev1.Service, source corev1.Service) corev1.Service {
 	}
 
 	if len(source.Spec.Ports) > 0 {
-		dest.Spec.Ports = source.Spec.Ports
+		dest.Spec.Ports = append([]corev1.ServicePort{}, source.Spec.Ports...)
 
 		if nodePort > 0 && source.Spec.Ports[0].NodePort == 0 {
 			// There *is* a nodePort defined already, and a new one is not being passed
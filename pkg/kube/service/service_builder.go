@@ -10,7 +10,7 @@ type builder struct {
 	namespace             string
 	clusterIp             string
 	serviceType           corev1.ServiceType
-	servicePort           corev1.ServicePort
+	ports                 []corev1.ServicePort
 	labels                map[string]string
 	loadBalancerIP        string
 	publishNotReady       bool
@@ -55,21 +55,44 @@ func (b *builder) SetClusterIP(clusterIP string) *builder {
 	return b
 }
 
+// SetPort sets the port of the first ServicePort of the Service
 func (b *builder) SetPort(port int32) *builder {
-	b.servicePort.Port = port
+	b.firstPort().Port = port
 	return b
 }
 
+// SetPortName sets the name of the first ServicePort of the Service
 func (b *builder) SetPortName(portName string) *builder {
-	b.servicePort.Name = portName
+	b.firstPort().Name = portName
 	return b
 }
 
+// SetNodePort sets the node port of the first ServicePort of the Service
 func (b *builder) SetNodePort(port int32) *builder {
-	b.servicePort.NodePort = port
+	b.firstPort().NodePort = port
 	return b
 }
 
+// AddPort adds a ServicePort after the ones already set, the ports of a Service exposing more than
+// one must all be named
+func (b *builder) AddPort(port corev1.ServicePort) *builder {
+	b.ports = append(b.ports, port)
+	return b
+}
+
+// SetPorts replaces all the ServicePorts of the Service
+func (b *builder) SetPorts(ports []corev1.ServicePort) *builder {
+	b.ports = append([]corev1.ServicePort{}, ports...)
+	return b
+}
+
+func (b *builder) firstPort() *corev1.ServicePort {
+	if len(b.ports) == 0 {
+		b.ports = []corev1.ServicePort{{}}
+	}
+	return &b.ports[0]
+}
+
 func (b *builder) SetServiceType(serviceType corev1.ServiceType) *builder {
 	b.serviceType = serviceType
 	return b
@@ -105,7 +128,7 @@ func (b *builder) Build() corev1.Service {
 			LoadBalancerIP:           b.loadBalancerIP,
 			Type:                     b.serviceType,
 			ClusterIP:                b.clusterIp,
-			Ports:                    []corev1.ServicePort{b.servicePort},
+			Ports:                    append([]corev1.ServicePort{}, b.ports...),
 			Selector:                 b.selector,
 		},
 	}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// mockServices holds the Services by name
+type mockServices struct {
+	services map[string]corev1.Service
+}
+
+func (m *mockServices) GetService(objectKey client.ObjectKey) (corev1.Service, error) {
+	if s, ok := m.services[objectKey.Name]; ok {
+		return s, nil
+	}
+	return corev1.Service{}, errors.NewNotFound(schema.GroupResource{}, objectKey.Name)
+}
+
+func (m *mockServices) CreateService(service corev1.Service) error {
+	m.services[service.Name] = service
+	return nil
+}
+
+func (m *mockServices) UpdateService(service corev1.Service) error {
+	m.services[service.Name] = service
+	return nil
+}
+
+func TestBuilder_Ports(t *testing.T) {
+	svc := Builder().SetName("my-svc").SetPort(27017).SetPortName("mongodb").Build()
+	assert.Equal(t, []corev1.ServicePort{{Name: "mongodb", Port: 27017}}, svc.Spec.Ports)
+
+	b := Builder().
+		SetPort(27017).
+		SetPortName("mongodb").
+		AddPort(corev1.ServicePort{Name: "metrics", Port: 9216})
+	assert.Equal(t, []corev1.ServicePort{{Name: "mongodb", Port: 27017}, {Name: "metrics", Port: 9216}}, b.Build().Spec.Ports)
+
+	b.SetPorts([]corev1.ServicePort{{Name: "other", Port: 1}})
+	assert.Equal(t, []corev1.ServicePort{{Name: "other", Port: 1}}, b.Build().Spec.Ports)
+}
+
+func TestCreateOrUpdate(t *testing.T) {
+	services := &mockServices{services: map[string]corev1.Service{}}
+	svc := Builder().
+		SetName("my-svc").
+		SetNamespace("my-ns").
+		SetServiceType(corev1.ServiceTypeNodePort).
+		SetPort(27017).
+		Build()
+	assert.NoError(t, CreateOrUpdate(services, svc))
+	assert.Equal(t, svc, services.services["my-svc"])
+
+	// the cluster allocates the cluster IP and the node port
+	allocated := services.services["my-svc"]
+	allocated.Spec.ClusterIP = "10.0.0.1"
+	allocated.Spec.Ports[0].NodePort = 30017
+	allocated.Labels = nil
+	services.services["my-svc"] = allocated
+
+	svc = Builder().
+		SetName("my-svc").
+		SetNamespace("my-ns").
+		SetServiceType(corev1.ServiceTypeNodePort).
+		SetLabels(map[string]string{"app": "my-svc"}).
+		SetPort(27018).
+		Build()
+	assert.NoError(t, CreateOrUpdate(services, svc))
+	updated := services.services["my-svc"]
+	assert.Equal(t, "10.0.0.1", updated.Spec.ClusterIP)
+	assert.Equal(t, []corev1.ServicePort{{Port: 27018, NodePort: 30017}}, updated.Spec.Ports)
+	assert.Equal(t, map[string]string{"app": "my-svc"}, updated.Labels)
+	assert.Zero(t, svc.Spec.Ports[0].NodePort, "the given Service is unchanged")
+}
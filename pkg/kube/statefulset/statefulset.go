@@ -1,6 +1,8 @@
 package statefulset
 
 import (
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/container"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/podtemplatespec"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -30,6 +32,12 @@ type Deleter interface {
 	DeleteStatefulSet(objectKey client.ObjectKey) error
 }
 
+// Applier applies the StatefulSet with server-side apply, only the fields it holds are
+// owned by the operator
+type Applier interface {
+	ApplyStatefulSet(sts appsv1.StatefulSet) error
+}
+
 type GetUpdater interface {
 	Getter
 	Updater
@@ -118,6 +126,30 @@ func CreateVolumeFromEmptyDir(name string) corev1.Volume {
 	}
 }
 
+// CreateVolumeFromPersistentVolumeClaim returns a corev1.Volume mounting the existing PersistentVolumeClaim
+func CreateVolumeFromPersistentVolumeClaim(name, claimName string) corev1.Volume {
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+			},
+		},
+	}
+}
+
+// CreateVolumeFromDownwardAPI returns a corev1.Volume exposing the given fields of the Pod as files.
+func CreateVolumeFromDownwardAPI(name string, items ...corev1.DownwardAPIVolumeFile) corev1.Volume {
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: items,
+			},
+		},
+	}
+}
+
 // CreateVolumeMount returns a corev1.VolumeMount with options.
 func CreateVolumeMount(name, path string, options ...func(*corev1.VolumeMount)) corev1.VolumeMount {
 	volumeMount := &corev1.VolumeMount{
@@ -177,6 +209,11 @@ func Apply(funcs ...Modification) func(*appsv1.StatefulSet) {
 	}
 }
 
+// NOOP is a valid Modification which applies no changes
+func NOOP() Modification {
+	return func(sts *appsv1.StatefulSet) {}
+}
+
 func WithName(name string) Modification {
 	return func(sts *appsv1.StatefulSet) {
 		sts.Name = name
@@ -258,3 +295,48 @@ func findVolumeClaimIndexByName(name string, pvcs []corev1.PersistentVolumeClaim
 	}
 	return notFound
 }
+
+// WithVolumeClaimTemplates adds the volume claim templates, replacing the ones with the same name
+func WithVolumeClaimTemplates(claims ...corev1.PersistentVolumeClaim) Modification {
+	return func(set *appsv1.StatefulSet) {
+		for _, claim := range claims {
+			claim := *claim.DeepCopy()
+			WithVolumeClaim(claim.Name, func(pvc *corev1.PersistentVolumeClaim) { *pvc = claim })(set)
+		}
+	}
+}
+
+// WithoutVolumeClaim removes the volume claim template with the given name, if there is one
+func WithoutVolumeClaim(name string) Modification {
+	return func(set *appsv1.StatefulSet) {
+		idx := findVolumeClaimIndexByName(name, set.Spec.VolumeClaimTemplates)
+		if idx == notFound {
+			return
+		}
+		set.Spec.VolumeClaimTemplates = append(set.Spec.VolumeClaimTemplates[:idx], set.Spec.VolumeClaimTemplates[idx+1:]...)
+	}
+}
+
+// WithContainer modifies the container of the Pod template with the given name, a container with
+// this name is added if there is none
+func WithContainer(name string, containerFunc func(*corev1.Container)) Modification {
+	return WithPodSpecTemplate(podtemplatespec.WithContainer(name, container.Apply(container.WithName(name), containerFunc)))
+}
+
+// WithInitContainer modifies the init container of the Pod template with the given name, an init
+// container with this name is added if there is none
+func WithInitContainer(name string, containerFunc func(*corev1.Container)) Modification {
+	return WithPodSpecTemplate(podtemplatespec.WithInitContainer(name, container.Apply(container.WithName(name), containerFunc)))
+}
+
+// WithRollingUpdatePartition sets the partition of the RollingUpdate strategy: only the Pods with
+// an ordinal greater than or equal to it are updated
+func WithRollingUpdatePartition(partition int) Modification {
+	stsPartition := int32(partition)
+	return func(set *appsv1.StatefulSet) {
+		set.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+			Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &stsPartition},
+		}
+	}
+}
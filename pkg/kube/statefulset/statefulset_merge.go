@@ -0,0 +1,58 @@
+package statefulset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// MergeSpec merges the override, the JSON of a StatefulSetSpec, into the spec of the StatefulSet with
+// a strategic merge patch. The lists Kubernetes merges by key are merged, such as the containers and
+// the volumes which are merged by name, the other ones, such as the volumeClaimTemplates, are
+// replaced, and a field set to null is removed. The StatefulSet is unchanged, the merged one only
+// depends on it and on the override, so that the same override is always applied the same way.
+func MergeSpec(sts appsv1.StatefulSet, specOverride []byte) (appsv1.StatefulSet, error) {
+	if len(specOverride) == 0 {
+		return *sts.DeepCopy(), nil
+	}
+	// the fields which aren't part of a StatefulSetSpec would be silently dropped by the merge
+	decoder := json.NewDecoder(bytes.NewReader(specOverride))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&appsv1.StatefulSetSpec{}); err != nil {
+		return appsv1.StatefulSet{}, fmt.Errorf("invalid StatefulSet spec: %s", err)
+	}
+
+	original, err := json.Marshal(sts)
+	if err != nil {
+		return appsv1.StatefulSet{}, err
+	}
+	patch, err := json.Marshal(map[string]json.RawMessage{"spec": specOverride})
+	if err != nil {
+		return appsv1.StatefulSet{}, err
+	}
+	mergedBytes, err := strategicpatch.StrategicMergePatch(original, patch, appsv1.StatefulSet{})
+	if err != nil {
+		return appsv1.StatefulSet{}, fmt.Errorf("error merging the StatefulSet spec: %s", err)
+	}
+	merged := appsv1.StatefulSet{}
+	if err := json.Unmarshal(mergedBytes, &merged); err != nil {
+		return appsv1.StatefulSet{}, err
+	}
+	return merged, nil
+}
+
+// WithSpecOverride merges the override into the spec of the StatefulSet, see MergeSpec. It must be the
+// last Modification applied, so that the override takes precedence. An override which can't be
+// merged leaves the StatefulSet unchanged, it must be validated with MergeSpec beforehand.
+func WithSpecOverride(specOverride []byte) Modification {
+	return func(set *appsv1.StatefulSet) {
+		merged, err := MergeSpec(*set, specOverride)
+		if err != nil {
+			return
+		}
+		*set = merged
+	}
+}
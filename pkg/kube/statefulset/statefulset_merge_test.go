@@ -0,0 +1,113 @@
+package statefulset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func mergeTestStatefulSet() appsv1.StatefulSet {
+	return New(
+		WithName(TestName),
+		WithNamespace(TestNamespace),
+		WithReplicas(3),
+		WithContainer("mongod", func(c *corev1.Container) {
+			c.Image = "mongo:4.2.6"
+			c.Env = []corev1.EnvVar{{Name: "A", Value: "1"}}
+		}),
+		WithContainer("agent", func(c *corev1.Container) { c.Image = "agent:10" }),
+		WithVolumeClaimTemplates(corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data"}}),
+	)
+}
+
+func TestMergeSpec(t *testing.T) {
+	sts := mergeTestStatefulSet()
+	override := []byte(`{
+		"template": {
+			"metadata": {"labels": {"team": "a"}},
+			"spec": {
+				"containers": [{"name": "mongod", "env": [{"name": "B", "value": "2"}]}, {"name": "sidecar", "image": "sidecar:1"}],
+				"priorityClassName": "high"
+			}
+		}
+	}`)
+	merged, err := MergeSpec(sts, override)
+	assert.NoError(t, err)
+
+	containers := merged.Spec.Template.Spec.Containers
+	assert.Len(t, containers, 3)
+	assert.Equal(t, "mongod", containers[0].Name)
+	assert.Equal(t, "mongo:4.2.6", containers[0].Image, "the containers are merged by name")
+	assert.Equal(t, []corev1.EnvVar{{Name: "B", Value: "2"}, {Name: "A", Value: "1"}}, containers[0].Env)
+	// the items of the override come first, in its order
+	assert.Equal(t, "sidecar:1", containers[1].Image)
+	assert.Equal(t, "agent:10", containers[2].Image)
+	assert.Equal(t, "high", merged.Spec.Template.Spec.PriorityClassName)
+	assert.Equal(t, map[string]string{"team": "a"}, merged.Spec.Template.Labels)
+	assert.Equal(t, int32(3), *merged.Spec.Replicas)
+	assert.Equal(t, TestName, merged.Name)
+
+	assert.Len(t, sts.Spec.Template.Spec.Containers, 2, "the StatefulSet is unchanged")
+
+	again, err := MergeSpec(sts, override)
+	assert.NoError(t, err)
+	assert.Equal(t, merged, again, "the same override is always merged the same way")
+}
+
+func TestMergeSpec_ReplacesTheListsWithoutMergeKey(t *testing.T) {
+	sts := mergeTestStatefulSet()
+	merged, err := MergeSpec(sts, []byte(`{"volumeClaimTemplates": [{"metadata": {"name": "logs"}}]}`))
+	assert.NoError(t, err)
+	assert.Len(t, merged.Spec.VolumeClaimTemplates, 1)
+	assert.Equal(t, "logs", merged.Spec.VolumeClaimTemplates[0].Name)
+}
+
+func TestMergeSpec_Invalid(t *testing.T) {
+	sts := mergeTestStatefulSet()
+	_, err := MergeSpec(sts, []byte(`{"template": {"spec": {"containerz": []}}}`))
+	assert.Error(t, err, "the unknown fields are rejected")
+	_, err = MergeSpec(sts, []byte(`{"replicas": "three"}`))
+	assert.Error(t, err)
+
+	unchanged := sts.DeepCopy()
+	WithSpecOverride([]byte(`{"replicas": "three"}`))(unchanged)
+	assert.Equal(t, sts, *unchanged)
+}
+
+func TestMergeSpec_NoOverride(t *testing.T) {
+	sts := mergeTestStatefulSet()
+	merged, err := MergeSpec(sts, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, sts, merged)
+}
+
+func TestWithVolumeClaimTemplates(t *testing.T) {
+	size := resource.MustParse("10G")
+	sts := New(
+		WithVolumeClaimTemplates(
+			corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data"}},
+			corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "logs"}},
+		),
+		WithVolumeClaimTemplates(corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data"},
+			Spec:       corev1.PersistentVolumeClaimSpec{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: size}}},
+		}),
+	)
+	assert.Len(t, sts.Spec.VolumeClaimTemplates, 2)
+	assert.Equal(t, size, sts.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage], "the claim with the same name is replaced")
+
+	WithoutVolumeClaim("data")(&sts)
+	WithoutVolumeClaim("missing")(&sts)
+	assert.Len(t, sts.Spec.VolumeClaimTemplates, 1)
+	assert.Equal(t, "logs", sts.Spec.VolumeClaimTemplates[0].Name)
+}
+
+func TestWithRollingUpdatePartition(t *testing.T) {
+	sts := New(WithUpdateStrategyType(appsv1.OnDeleteStatefulSetStrategyType), WithRollingUpdatePartition(2))
+	assert.Equal(t, appsv1.RollingUpdateStatefulSetStrategyType, sts.Spec.UpdateStrategy.Type)
+	assert.Equal(t, int32(2), *sts.Spec.UpdateStrategy.RollingUpdate.Partition)
+}
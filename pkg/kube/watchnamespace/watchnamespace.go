@@ -0,0 +1,152 @@
+// Package watchnamespace configures the namespaces the operator watches, from the WATCH_NAMESPACE
+// environment variable: a namespace, a comma-separated list of namespaces, or all the namespaces
+// when it is empty.
+package watchnamespace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Parse returns the namespaces of the comma-separated list, without duplicates. An empty list means
+// all the namespaces.
+func Parse(value string) []string {
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
+}
+
+// NewCacheFunc returns the function creating the cache of the manager for several namespaces. The
+// namespaced objects are cached for these namespaces only, and the cluster-scoped ones, such as the
+// nodes, for the whole cluster, as a cache restricted to namespaces can't read them.
+func NewCacheFunc(namespaces []string) cache.NewCacheFunc {
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		if opts.Mapper == nil {
+			mapper, err := apiutil.NewDynamicRESTMapper(config)
+			if err != nil {
+				return nil, fmt.Errorf("error creating the REST mapper: %s", err)
+			}
+			opts.Mapper = mapper
+		}
+		if opts.Scheme == nil {
+			opts.Scheme = runtime.NewScheme()
+		}
+		namespaced, err := cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.Namespace = ""
+		cluster, err := cache.New(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &clusterScopedCache{namespaced: namespaced, cluster: cluster, scheme: opts.Scheme, mapper: opts.Mapper}, nil
+	}
+}
+
+// clusterScopedCache reads the cluster-scoped objects from the cluster cache, and the namespaced
+// ones from the namespaced cache. The informers of the cluster cache are only started for the
+// cluster-scoped kinds which are read or watched.
+type clusterScopedCache struct {
+	namespaced cache.Cache
+	cluster    cache.Cache
+	scheme     *runtime.Scheme
+	mapper     meta.RESTMapper
+}
+
+var _ cache.Cache = &clusterScopedCache{}
+
+// cacheForKind returns the cache of the objects of the kind, or of the lists of the kind
+func (c *clusterScopedCache) cacheForKind(gvk schema.GroupVersionKind) (cache.Cache, error) {
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.cluster, nil
+	}
+	return c.namespaced, nil
+}
+
+func (c *clusterScopedCache) cacheFor(obj runtime.Object) (cache.Cache, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return nil, err
+	}
+	return c.cacheForKind(gvk)
+}
+
+func (c *clusterScopedCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	objCache, err := c.cacheFor(obj)
+	if err != nil {
+		return err
+	}
+	return objCache.Get(ctx, key, obj)
+}
+
+func (c *clusterScopedCache) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	listCache, err := c.cacheFor(list)
+	if err != nil {
+		return err
+	}
+	return listCache.List(ctx, list, opts...)
+}
+
+func (c *clusterScopedCache) GetInformer(obj runtime.Object) (cache.Informer, error) {
+	objCache, err := c.cacheFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return objCache.GetInformer(obj)
+}
+
+func (c *clusterScopedCache) GetInformerForKind(gvk schema.GroupVersionKind) (cache.Informer, error) {
+	kindCache, err := c.cacheForKind(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return kindCache.GetInformerForKind(gvk)
+}
+
+func (c *clusterScopedCache) IndexField(obj runtime.Object, field string, extractValue client.IndexerFunc) error {
+	objCache, err := c.cacheFor(obj)
+	if err != nil {
+		return err
+	}
+	return objCache.IndexField(obj, field, extractValue)
+}
+
+// Start runs the informers of both caches until the channel is closed, it blocks
+func (c *clusterScopedCache) Start(stopCh <-chan struct{}) error {
+	errs := make(chan error, 2)
+	go func() { errs <- c.cluster.Start(stopCh) }()
+	go func() { errs <- c.namespaced.Start(stopCh) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *clusterScopedCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	return c.namespaced.WaitForCacheSync(stop) && c.cluster.WaitForCacheSync(stop)
+}
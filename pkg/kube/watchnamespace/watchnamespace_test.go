@@ -0,0 +1,73 @@
+package watchnamespace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+func TestParse(t *testing.T) {
+	assert.Nil(t, Parse(""))
+	assert.Nil(t, Parse(" , "))
+	assert.Equal(t, []string{"my-ns"}, Parse("my-ns"))
+	assert.Equal(t, []string{"team-a", "team-b"}, Parse("team-a, team-b,,team-a"))
+}
+
+// recordingCache records the objects it is asked for
+type recordingCache struct {
+	cache.Cache
+	calls *[]string
+	name  string
+}
+
+func (c recordingCache) record(obj runtime.Object) {
+	gvk, _ := apiutil.GVKForObject(obj, scheme.Scheme)
+	*c.calls = append(*c.calls, c.name+":"+gvk.Kind)
+}
+
+func (c recordingCache) Get(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+	c.record(obj)
+	return nil
+}
+
+func (c recordingCache) List(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+	c.record(list)
+	return nil
+}
+
+func (c recordingCache) GetInformer(obj runtime.Object) (cache.Informer, error) {
+	c.record(obj)
+	return nil, nil
+}
+
+func TestClusterScopedCache(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Node"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, meta.RESTScopeNamespace)
+
+	var calls []string
+	c := &clusterScopedCache{
+		namespaced: recordingCache{calls: &calls, name: "namespaced"},
+		cluster:    recordingCache{calls: &calls, name: "cluster"},
+		scheme:     scheme.Scheme,
+		mapper:     mapper,
+	}
+	assert.NoError(t, c.Get(context.TODO(), client.ObjectKey{Name: "node-1"}, &corev1.Node{}))
+	assert.NoError(t, c.Get(context.TODO(), client.ObjectKey{Name: "my-rs-0", Namespace: "team-a"}, &corev1.Pod{}))
+	assert.NoError(t, c.List(context.TODO(), &corev1.NodeList{}))
+	assert.NoError(t, c.List(context.TODO(), &corev1.PodList{}))
+	_, err := c.GetInformer(&corev1.Node{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cluster:Node", "namespaced:Pod", "cluster:NodeList", "namespaced:PodList", "cluster:Node"}, calls)
+
+	assert.Error(t, c.Get(context.TODO(), client.ObjectKey{Name: "my-secret"}, &corev1.Secret{}), "unknown kinds aren't read")
+}
@@ -0,0 +1,256 @@
+package livecluster
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scramcredentials"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	connectTimeout = 30 * time.Second
+
+	scramSha1   = "SCRAM-SHA-1"
+	scramSha256 = "SCRAM-SHA-256"
+
+	// stepDownSeconds is the time during which the stepped down primary can't be re-elected
+	stepDownSeconds = 60
+	// networkErrorLabel is set by the driver on the errors caused by closed connections
+	networkErrorLabel = "NetworkError"
+)
+
+const (
+	PrimaryState   = "PRIMARY"
+	SecondaryState = "SECONDARY"
+)
+
+// ReplicaSetMember is a member as configured in rs.conf()
+type ReplicaSetMember struct {
+	Id          int     `bson:"_id"`
+	Host        string  `bson:"host"`
+	Priority    float64 `bson:"priority"`
+	Votes       int     `bson:"votes"`
+	ArbiterOnly bool    `bson:"arbiterOnly"`
+}
+
+// ReplicaSetConfig is the subset of rs.conf() required to rebuild an automation config
+type ReplicaSetConfig struct {
+	Name            string             `bson:"_id"`
+	ProtocolVersion int64              `bson:"protocolVersion"`
+	Members         []ReplicaSetMember `bson:"members"`
+}
+
+// MemberStatus is the state of a member as reported by replSetGetStatus
+type MemberStatus struct {
+	Name     string  `bson:"name"`
+	Health   float64 `bson:"health"`
+	StateStr string  `bson:"stateStr"`
+	// OptimeDate is the time of the last operation applied by the member
+	OptimeDate time.Time `bson:"optimeDate"`
+	// LastHeartbeat is the last time the member answered a heartbeat of the member which
+	// ran replSetGetStatus, it is zero for the member which ran it
+	LastHeartbeat time.Time `bson:"lastHeartbeat"`
+	// Self is true for the member which ran replSetGetStatus
+	Self bool `bson:"self"`
+}
+
+// IsHealthy returns true if the member is reachable and is either the primary or a secondary
+func (m MemberStatus) IsHealthy() bool {
+	return m.Health == 1 && (m.StateStr == PrimaryState || m.StateStr == SecondaryState)
+}
+
+// Role is a role granted to a User
+type Role struct {
+	Role     string `bson:"role"`
+	Database string `bson:"db"`
+}
+
+// User is a user as returned by the usersInfo command
+type User struct {
+	Username         string
+	Database         string
+	Roles            []Role
+	Mechanisms       []string
+	ScramSha1Creds   *scramcredentials.ScramCreds
+	ScramSha256Creds *scramcredentials.ScramCreds
+}
+
+// Reader reads the configuration and the status of a running replica set, steps down its
+// primary, and locks the writes of the member it is directly connected to
+type Reader interface {
+	ReplicaSetConfig(ctx context.Context) (ReplicaSetConfig, error)
+	ReplicaSetStatus(ctx context.Context) ([]MemberStatus, error)
+	Users(ctx context.Context) ([]User, error)
+	FeatureCompatibilityVersion(ctx context.Context) (string, error)
+	StepDown(ctx context.Context) error
+	FsyncLock(ctx context.Context) error
+	FsyncUnlock(ctx context.Context) error
+	Disconnect(ctx context.Context) error
+}
+
+// Credential is used to authenticate to the replica set
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Connector returns a Reader for the replica set reachable at the given uri.
+// A nil credential or TLS config connects without authentication or TLS respectively.
+type Connector func(uri string, credential *Credential, tlsConfig *tls.Config) (Reader, error)
+
+// Connect is the Connector which uses the MongoDB Go driver
+func Connect(uri string, credential *Credential, tlsConfig *tls.Config) (Reader, error) {
+	opts := options.Client().ApplyURI(uri).SetConnectTimeout(connectTimeout)
+	if credential != nil {
+		opts.SetAuth(options.Credential{
+			AuthMechanism: scramSha256,
+			AuthSource:    "admin",
+			Username:      credential.Username,
+			Password:      credential.Password,
+		})
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %s", uri, err)
+	}
+	return driverReader{client: client}, nil
+}
+
+type driverReader struct {
+	client *mongo.Client
+}
+
+func (d driverReader) ReplicaSetConfig(ctx context.Context) (ReplicaSetConfig, error) {
+	result := struct {
+		Config ReplicaSetConfig `bson:"config"`
+	}{}
+	if err := d.client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetConfig", Value: 1}}).Decode(&result); err != nil {
+		return ReplicaSetConfig{}, fmt.Errorf("error running replSetGetConfig: %s", err)
+	}
+	return result.Config, nil
+}
+
+func (d driverReader) ReplicaSetStatus(ctx context.Context) ([]MemberStatus, error) {
+	result := struct {
+		Members []MemberStatus `bson:"members"`
+	}{}
+	if err := d.client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error running replSetGetStatus: %s", err)
+	}
+	return result.Members, nil
+}
+
+// StepDown makes the primary step down, so that one of the secondaries is elected. The primary
+// may close the connections while stepping down, which is not reported as an error.
+func (d driverReader) StepDown(ctx context.Context) error {
+	err := d.client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetStepDown", Value: stepDownSeconds}}).Err()
+	if err == nil {
+		return nil
+	}
+	if commandErr, ok := err.(mongo.CommandError); ok && commandErr.HasErrorLabel(networkErrorLabel) {
+		return nil
+	}
+	return fmt.Errorf("error running replSetStepDown: %s", err)
+}
+
+// FsyncLock flushes the pending writes of the member to disk and blocks its writes until
+// FsyncUnlock is called, so that its volumes can be snapshotted consistently
+func (d driverReader) FsyncLock(ctx context.Context) error {
+	command := bson.D{{Key: "fsync", Value: 1}, {Key: "lock", Value: true}}
+	if err := d.client.Database("admin").RunCommand(ctx, command).Err(); err != nil {
+		return fmt.Errorf("error running fsync: %s", err)
+	}
+	return nil
+}
+
+// FsyncUnlock releases the lock taken by FsyncLock
+func (d driverReader) FsyncUnlock(ctx context.Context) error {
+	if err := d.client.Database("admin").RunCommand(ctx, bson.D{{Key: "fsyncUnlock", Value: 1}}).Err(); err != nil {
+		return fmt.Errorf("error running fsyncUnlock: %s", err)
+	}
+	return nil
+}
+
+type scramCreds struct {
+	IterationCount int    `bson:"iterationCount"`
+	Salt           string `bson:"salt"`
+	StoredKey      string `bson:"storedKey"`
+	ServerKey      string `bson:"serverKey"`
+}
+
+type userInfo struct {
+	User        string                `bson:"user"`
+	Db          string                `bson:"db"`
+	Roles       []Role                `bson:"roles"`
+	Mechanisms  []string              `bson:"mechanisms"`
+	Credentials map[string]scramCreds `bson:"credentials"`
+}
+
+func (d driverReader) Users(ctx context.Context) ([]User, error) {
+	result := struct {
+		Users []userInfo `bson:"users"`
+	}{}
+	command := bson.D{
+		{Key: "usersInfo", Value: bson.D{{Key: "forAllDBs", Value: true}}},
+		{Key: "showCredentials", Value: true},
+	}
+	if err := d.client.Database("admin").RunCommand(ctx, command).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error running usersInfo: %s", err)
+	}
+
+	users := make([]User, len(result.Users))
+	for i, u := range result.Users {
+		users[i] = User{
+			Username:         u.User,
+			Database:         u.Db,
+			Roles:            u.Roles,
+			Mechanisms:       u.Mechanisms,
+			ScramSha1Creds:   toScramCreds(u.Credentials, scramSha1),
+			ScramSha256Creds: toScramCreds(u.Credentials, scramSha256),
+		}
+	}
+	return users, nil
+}
+
+// FeatureCompatibilityVersion returns the feature compatibility version of the member the
+// client is connected to, such as "4.2"
+func (d driverReader) FeatureCompatibilityVersion(ctx context.Context) (string, error) {
+	result := struct {
+		FeatureCompatibilityVersion struct {
+			Version string `bson:"version"`
+		} `bson:"featureCompatibilityVersion"`
+	}{}
+	command := bson.D{{Key: "getParameter", Value: 1}, {Key: "featureCompatibilityVersion", Value: 1}}
+	if err := d.client.Database("admin").RunCommand(ctx, command).Decode(&result); err != nil {
+		return "", fmt.Errorf("error running getParameter: %s", err)
+	}
+	return result.FeatureCompatibilityVersion.Version, nil
+}
+
+func (d driverReader) Disconnect(ctx context.Context) error {
+	return d.client.Disconnect(ctx)
+}
+
+func toScramCreds(credentials map[string]scramCreds, mechanism string) *scramcredentials.ScramCreds {
+	c, ok := credentials[mechanism]
+	if !ok {
+		return nil
+	}
+	return &scramcredentials.ScramCreds{
+		IterationCount: c.IterationCount,
+		Salt:           c.Salt,
+		StoredKey:      c.StoredKey,
+		ServerKey:      c.ServerKey,
+	}
+}
@@ -0,0 +1,160 @@
+// Package mongodbclient is a typed client of the resources of the mongodb.com/v1 API group, to build
+// tooling against the API of the operator without unstructured access. It wraps a controller-runtime
+// client: pass the client of a manager to read from its cache, the way listers do.
+package mongodbclient
+
+import (
+	"context"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Interface gives access to the resources of the mongodb.com/v1 API group by namespace
+type Interface interface {
+	MongoDBs(namespace string) MongoDBInterface
+	MongoDBBackups(namespace string) MongoDBBackupInterface
+	MongoDBRestores(namespace string) MongoDBRestoreInterface
+}
+
+// MongoDBInterface reads and writes the MongoDB resources of a namespace
+type MongoDBInterface interface {
+	MongoDBLister
+	Create(mdb *mdbv1.MongoDB) error
+	Update(mdb *mdbv1.MongoDB) error
+	UpdateStatus(mdb *mdbv1.MongoDB) error
+	Delete(name string) error
+}
+
+// MongoDBLister reads the MongoDB resources of a namespace
+type MongoDBLister interface {
+	Get(name string) (*mdbv1.MongoDB, error)
+	List(opts ...k8sClient.ListOption) (*mdbv1.MongoDBList, error)
+}
+
+// MongoDBBackupInterface reads and writes the MongoDBBackup resources of a namespace
+type MongoDBBackupInterface interface {
+	MongoDBBackupLister
+	Create(backup *mdbv1.MongoDBBackup) error
+	Update(backup *mdbv1.MongoDBBackup) error
+	UpdateStatus(backup *mdbv1.MongoDBBackup) error
+	Delete(name string) error
+}
+
+// MongoDBBackupLister reads the MongoDBBackup resources of a namespace
+type MongoDBBackupLister interface {
+	Get(name string) (*mdbv1.MongoDBBackup, error)
+	List(opts ...k8sClient.ListOption) (*mdbv1.MongoDBBackupList, error)
+}
+
+// MongoDBRestoreInterface reads and writes the MongoDBRestore resources of a namespace
+type MongoDBRestoreInterface interface {
+	MongoDBRestoreLister
+	Create(restore *mdbv1.MongoDBRestore) error
+	Update(restore *mdbv1.MongoDBRestore) error
+	UpdateStatus(restore *mdbv1.MongoDBRestore) error
+	Delete(name string) error
+}
+
+// MongoDBRestoreLister reads the MongoDBRestore resources of a namespace
+type MongoDBRestoreLister interface {
+	Get(name string) (*mdbv1.MongoDBRestore, error)
+	List(opts ...k8sClient.ListOption) (*mdbv1.MongoDBRestoreList, error)
+}
+
+type client struct {
+	client k8sClient.Client
+}
+
+// New returns the typed client wrapping c, whose scheme must hold the mongodb.com/v1 types
+func New(c k8sClient.Client) Interface {
+	return client{client: c}
+}
+
+// NewForConfig returns the typed client connecting directly to the API, without cache
+func NewForConfig(config *rest.Config) (Interface, error) {
+	s, err := NewScheme()
+	if err != nil {
+		return nil, err
+	}
+	c, err := k8sClient.New(config, k8sClient.Options{Scheme: s})
+	if err != nil {
+		return nil, err
+	}
+	return New(c), nil
+}
+
+// NewScheme returns a scheme holding the built-in types and the mongodb.com/v1 types
+func NewScheme() (*runtime.Scheme, error) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		return nil, err
+	}
+	if err := mdbv1.SchemeBuilder.AddToScheme(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c client) MongoDBs(namespace string) MongoDBInterface {
+	return mongoDBs{namespaced: namespaced{client: c.client, namespace: namespace}}
+}
+
+func (c client) MongoDBBackups(namespace string) MongoDBBackupInterface {
+	return mongoDBBackups{namespaced: namespaced{client: c.client, namespace: namespace}}
+}
+
+func (c client) MongoDBRestores(namespace string) MongoDBRestoreInterface {
+	return mongoDBRestores{namespaced: namespaced{client: c.client, namespace: namespace}}
+}
+
+// namespaced makes the calls of the typed clients in their namespace
+type namespaced struct {
+	client    k8sClient.Client
+	namespace string
+}
+
+func (n namespaced) get(name string, obj runtime.Object) error {
+	return n.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: n.namespace}, obj)
+}
+
+func (n namespaced) list(list runtime.Object, opts []k8sClient.ListOption) error {
+	return n.client.List(context.TODO(), list, append([]k8sClient.ListOption{k8sClient.InNamespace(n.namespace)}, opts...)...)
+}
+
+// object is a resource with metadata
+type object interface {
+	runtime.Object
+	metav1.Object
+}
+
+// inNamespace sets the namespace of the client on obj when it has none
+func (n namespaced) inNamespace(obj object) object {
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(n.namespace)
+	}
+	return obj
+}
+
+func (n namespaced) create(obj object) error {
+	return n.client.Create(context.TODO(), n.inNamespace(obj))
+}
+
+func (n namespaced) update(obj object) error {
+	return n.client.Update(context.TODO(), n.inNamespace(obj))
+}
+
+func (n namespaced) updateStatus(obj object) error {
+	return n.client.Status().Update(context.TODO(), n.inNamespace(obj))
+}
+
+// delete deletes the resource named in the metadata of obj, the rest of obj is ignored
+func (n namespaced) delete(name string, obj object) error {
+	obj.SetName(name)
+	return n.client.Delete(context.TODO(), n.inNamespace(obj))
+}
@@ -0,0 +1,72 @@
+package mongodbclient
+
+import (
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/stretchr/testify/assert"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newFakeClient(t *testing.T) Interface {
+	s, err := NewScheme()
+	assert.NoError(t, err)
+	return New(fake.NewFakeClientWithScheme(s))
+}
+
+func TestMongoDBs(t *testing.T) {
+	c := newFakeClient(t)
+	mdbs := c.MongoDBs("my-ns")
+
+	mdb := &mdbv1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "my-rs", Labels: map[string]string{"team": "a"}}}
+	mdb.Spec.Members = 3
+	assert.NoError(t, mdbs.Create(mdb))
+	assert.Equal(t, "my-ns", mdb.Namespace, "the namespace of the client is set")
+	assert.NoError(t, mdbs.Create(&mdbv1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "other-rs"}}))
+	assert.NoError(t, c.MongoDBs("other-ns").Create(&mdbv1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "my-rs"}}))
+
+	got, err := mdbs.Get("my-rs")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, got.Spec.Members)
+
+	got.Status.Phase = mdbv1.Running
+	assert.NoError(t, mdbs.UpdateStatus(got))
+	got.Spec.Members = 5
+	assert.NoError(t, mdbs.Update(got))
+	got, err = mdbs.Get("my-rs")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, got.Spec.Members)
+	assert.Equal(t, mdbv1.Running, got.Status.Phase)
+
+	list, err := mdbs.List()
+	assert.NoError(t, err)
+	assert.Len(t, list.Items, 2, "only the resources of the namespace are listed")
+	list, err = mdbs.List(k8sClient.MatchingLabels{"team": "a"})
+	assert.NoError(t, err)
+	assert.Len(t, list.Items, 1)
+
+	assert.NoError(t, mdbs.Delete("my-rs"))
+	_, err = mdbs.Get("my-rs")
+	assert.True(t, apiErrors.IsNotFound(err))
+	_, err = c.MongoDBs("other-ns").Get("my-rs")
+	assert.NoError(t, err)
+}
+
+func TestMongoDBBackupsAndRestores(t *testing.T) {
+	c := newFakeClient(t)
+	assert.NoError(t, c.MongoDBBackups("my-ns").Create(&mdbv1.MongoDBBackup{ObjectMeta: metav1.ObjectMeta{Name: "my-backup"}}))
+	backups, err := c.MongoDBBackups("my-ns").List()
+	assert.NoError(t, err)
+	assert.Len(t, backups.Items, 1)
+
+	assert.NoError(t, c.MongoDBRestores("my-ns").Create(&mdbv1.MongoDBRestore{ObjectMeta: metav1.ObjectMeta{Name: "my-restore"}}))
+	restore, err := c.MongoDBRestores("my-ns").Get("my-restore")
+	assert.NoError(t, err)
+	assert.Equal(t, "my-restore", restore.Name)
+	assert.NoError(t, c.MongoDBRestores("my-ns").Delete("my-restore"))
+	_, err = c.MongoDBRestores("my-ns").Get("my-restore")
+	assert.True(t, apiErrors.IsNotFound(err))
+}
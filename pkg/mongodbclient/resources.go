@@ -0,0 +1,114 @@
+package mongodbclient
+
+import (
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type mongoDBs struct {
+	namespaced
+}
+
+func (m mongoDBs) Get(name string) (*mdbv1.MongoDB, error) {
+	mdb := &mdbv1.MongoDB{}
+	if err := m.get(name, mdb); err != nil {
+		return nil, err
+	}
+	return mdb, nil
+}
+
+func (m mongoDBs) List(opts ...k8sClient.ListOption) (*mdbv1.MongoDBList, error) {
+	list := &mdbv1.MongoDBList{}
+	if err := m.list(list, opts); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (m mongoDBs) Create(mdb *mdbv1.MongoDB) error {
+	return m.create(mdb)
+}
+
+func (m mongoDBs) Update(mdb *mdbv1.MongoDB) error {
+	return m.update(mdb)
+}
+
+func (m mongoDBs) UpdateStatus(mdb *mdbv1.MongoDB) error {
+	return m.updateStatus(mdb)
+}
+
+func (m mongoDBs) Delete(name string) error {
+	return m.delete(name, &mdbv1.MongoDB{})
+}
+
+type mongoDBBackups struct {
+	namespaced
+}
+
+func (m mongoDBBackups) Get(name string) (*mdbv1.MongoDBBackup, error) {
+	backup := &mdbv1.MongoDBBackup{}
+	if err := m.get(name, backup); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+func (m mongoDBBackups) List(opts ...k8sClient.ListOption) (*mdbv1.MongoDBBackupList, error) {
+	list := &mdbv1.MongoDBBackupList{}
+	if err := m.list(list, opts); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (m mongoDBBackups) Create(backup *mdbv1.MongoDBBackup) error {
+	return m.create(backup)
+}
+
+func (m mongoDBBackups) Update(backup *mdbv1.MongoDBBackup) error {
+	return m.update(backup)
+}
+
+func (m mongoDBBackups) UpdateStatus(backup *mdbv1.MongoDBBackup) error {
+	return m.updateStatus(backup)
+}
+
+func (m mongoDBBackups) Delete(name string) error {
+	return m.delete(name, &mdbv1.MongoDBBackup{})
+}
+
+type mongoDBRestores struct {
+	namespaced
+}
+
+func (m mongoDBRestores) Get(name string) (*mdbv1.MongoDBRestore, error) {
+	restore := &mdbv1.MongoDBRestore{}
+	if err := m.get(name, restore); err != nil {
+		return nil, err
+	}
+	return restore, nil
+}
+
+func (m mongoDBRestores) List(opts ...k8sClient.ListOption) (*mdbv1.MongoDBRestoreList, error) {
+	list := &mdbv1.MongoDBRestoreList{}
+	if err := m.list(list, opts); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (m mongoDBRestores) Create(restore *mdbv1.MongoDBRestore) error {
+	return m.create(restore)
+}
+
+func (m mongoDBRestores) Update(restore *mdbv1.MongoDBRestore) error {
+	return m.update(restore)
+}
+
+func (m mongoDBRestores) UpdateStatus(restore *mdbv1.MongoDBRestore) error {
+	return m.updateStatus(restore)
+}
+
+func (m mongoDBRestores) Delete(name string) error {
+	return m.delete(name, &mdbv1.MongoDBRestore{})
+}
@@ -0,0 +1,296 @@
+// Package opsmanager registers deployments with the monitoring of Cloud Manager and Ops Manager,
+// through their Public API authenticated with a programmatic API key.
+//
+// The hosts registered in a project are monitored by the MongoDB Agents of the project on which
+// monitoring is activated, which authenticate with an agent API key of the project.
+package opsmanager
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the URL of Cloud Manager
+	DefaultBaseURL = "https://cloud.mongodb.com"
+
+	apiPath        = "/api/public/v1.0"
+	requestTimeout = 30 * time.Second
+	// the hosts of a project are listed in a single page, a replica set has at most 50 members
+	hostsPerPage = 500
+)
+
+// API is the part of the Public API of Ops Manager registering deployments with its monitoring
+type API interface {
+	// ProjectID returns the ID of the project with the name, which is created in the organization
+	// orgID if it doesn't exist
+	ProjectID(name, orgID string) (string, error)
+	// CreateAgentAPIKey creates an agent API key in the project and returns it. The key can't be
+	// read again afterwards.
+	CreateAgentAPIKey(projectID, description string) (string, error)
+	// Hosts returns the hosts registered in the project
+	Hosts(projectID string) ([]Host, error)
+	// AddHost registers the host in the project, its monitoring starts right away
+	AddHost(projectID string, host Host) error
+	// RemoveHost unregisters the host with the ID from the project
+	RemoveHost(projectID, hostID string) error
+	// ActivateMonitoring activates monitoring on the MongoDB Agent running on hostname, with the
+	// additional settings, keeping the rest of the automation config of the project
+	ActivateMonitoring(projectID, hostname string, params map[string]string) error
+}
+
+// Host is a host registered in a project
+type Host struct {
+	ID       string `json:"id,omitempty"`
+	Hostname string `json:"hostname"`
+	Port     int    `json:"port"`
+	// Username and Password are the credentials the agents authenticate with, the password is never
+	// returned by the API
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// AuthMechanismName is NONE, SCRAM_SHA_256 or MONGODB_CR, which covers SCRAM-SHA-1
+	AuthMechanismName string `json:"authMechanismName,omitempty"`
+	SSLEnabled        bool   `json:"sslEnabled,omitempty"`
+}
+
+// Error is an error returned by the API
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+}
+
+func (e Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("status %d", e.Status)
+	}
+	return fmt.Sprintf("status %d: %s: %s", e.Status, e.Code, e.Detail)
+}
+
+// IsNotFound returns true if the error is an Error returned by the API for a missing object
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(Error)
+	return ok && apiErr.Status == http.StatusNotFound
+}
+
+// Client is the API of the Ops Manager, or Cloud Manager, at a base URL
+type Client struct {
+	baseURL    string
+	publicKey  string
+	privateKey string
+	http       *http.Client
+}
+
+var _ API = &Client{}
+
+// NewClient returns a Client of the Ops Manager at baseURL, authenticated with the public and private
+// keys of a programmatic API key. The default HTTP client with a timeout is used if httpClient is nil.
+func NewClient(baseURL, publicKey, privateKey string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		publicKey:  publicKey,
+		privateKey: privateKey,
+		http:       httpClient,
+	}
+}
+
+type project struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	OrgID string `json:"orgId,omitempty"`
+}
+
+func (c *Client) ProjectID(name, orgID string) (string, error) {
+	p := project{}
+	err := c.do(http.MethodGet, "/groups/byName/"+url.PathEscape(name), nil, &p)
+	if err == nil {
+		return p.ID, nil
+	}
+	if !IsNotFound(err) {
+		return "", fmt.Errorf("error getting project %s: %s", name, err)
+	}
+	if err := c.do(http.MethodPost, "/groups", project{Name: name, OrgID: orgID}, &p); err != nil {
+		return "", fmt.Errorf("error creating project %s in organization %s: %s", name, orgID, err)
+	}
+	return p.ID, nil
+}
+
+func (c *Client) CreateAgentAPIKey(projectID, description string) (string, error) {
+	key := struct {
+		Key string `json:"key"`
+	}{}
+	body := map[string]string{"desc": description}
+	if err := c.do(http.MethodPost, fmt.Sprintf("/groups/%s/agentapikeys", projectID), body, &key); err != nil {
+		return "", fmt.Errorf("error creating agent API key: %s", err)
+	}
+	return key.Key, nil
+}
+
+func (c *Client) Hosts(projectID string) ([]Host, error) {
+	hosts := struct {
+		Results []Host `json:"results"`
+	}{}
+	if err := c.do(http.MethodGet, fmt.Sprintf("/groups/%s/hosts?itemsPerPage=%d", projectID, hostsPerPage), nil, &hosts); err != nil {
+		return nil, fmt.Errorf("error listing hosts: %s", err)
+	}
+	return hosts.Results, nil
+}
+
+func (c *Client) AddHost(projectID string, host Host) error {
+	if err := c.do(http.MethodPost, fmt.Sprintf("/groups/%s/hosts", projectID), host, nil); err != nil {
+		return fmt.Errorf("error adding host %s: %s", host.Hostname, err)
+	}
+	return nil
+}
+
+func (c *Client) RemoveHost(projectID, hostID string) error {
+	if err := c.do(http.MethodDelete, fmt.Sprintf("/groups/%s/hosts/%s", projectID, hostID), nil, nil); err != nil && !IsNotFound(err) {
+		return fmt.Errorf("error removing host %s: %s", hostID, err)
+	}
+	return nil
+}
+
+func (c *Client) ActivateMonitoring(projectID, hostname string, params map[string]string) error {
+	path := fmt.Sprintf("/groups/%s/automationConfig", projectID)
+	// the automation config is read and written as a map, so that the fields it doesn't know are kept
+	ac := map[string]interface{}{}
+	if err := c.do(http.MethodGet, path, nil, &ac); err != nil {
+		return fmt.Errorf("error getting automation config: %s", err)
+	}
+	additionalParams := map[string]interface{}{}
+	for k, v := range params {
+		additionalParams[k] = v
+	}
+
+	versions, _ := ac["monitoringVersions"].([]interface{})
+	var agent map[string]interface{}
+	for _, v := range versions {
+		if existing, ok := v.(map[string]interface{}); ok && existing["hostname"] == hostname {
+			agent = existing
+		}
+	}
+	if agent == nil {
+		agent = map[string]interface{}{"hostname": hostname}
+		ac["monitoringVersions"] = append(versions, agent)
+	} else if existing, _ := agent["additionalParams"].(map[string]interface{}); reflect.DeepEqual(existing, additionalParams) ||
+		(len(existing) == 0 && len(additionalParams) == 0) {
+		return nil
+	}
+	agent["additionalParams"] = additionalParams
+	if err := c.do(http.MethodPut, path, ac, nil); err != nil {
+		return fmt.Errorf("error updating automation config: %s", err)
+	}
+	return nil
+}
+
+// errorResponse is the body of the responses of the API to the failed requests
+type errorResponse struct {
+	ErrorCode string `json:"errorCode"`
+	Detail    string `json:"detail"`
+}
+
+// do sends the request to the API, authenticated with HTTP digest authentication, and decodes the
+// response into out if it isn't nil
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	resp, err := c.send(method, path, body, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authorization, err := digestAuthorization(challenge, method, apiPath+path, c.publicKey, c.privateKey)
+		if err != nil {
+			return err
+		}
+		if resp, err = c.send(method, path, body, authorization); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		errResp := errorResponse{}
+		_ = json.Unmarshal(respBody, &errResp)
+		return Error{Status: resp.StatusCode, Code: errResp.ErrorCode, Detail: errResp.Detail}
+	}
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (c *Client) send(method, path string, body []byte, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+apiPath+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return c.http.Do(req)
+}
+
+// digestAuthorization returns the Authorization header answering the digest challenge of the
+// WWW-Authenticate header, with the MD5 algorithm and the auth quality of protection the API uses
+func digestAuthorization(challenge, method, uri, username, password string) (string, error) {
+	if !strings.HasPrefix(challenge, "Digest ") {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Digest "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	cnonceBytes := make([]byte, 8)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return "", err
+	}
+	cnonce, nc := hex.EncodeToString(cnonceBytes), "00000001"
+	ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", username, params["realm"], password))
+	ha2 := md5Hex(fmt.Sprintf("%s:%s", method, uri))
+	response := md5Hex(fmt.Sprintf("%s:%s:%s:%s:auth:%s", ha1, params["nonce"], nc, cnonce, ha2))
+	authorization := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=auth, nc=%s, cnonce="%s", response="%s", algorithm=MD5`,
+		username, params["realm"], params["nonce"], uri, nc, cnonce, response)
+	if opaque, ok := params["opaque"]; ok {
+		authorization += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return authorization, nil
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,187 @@
+package opsmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testPublicKey  = "public"
+	testPrivateKey = "private"
+	testRealm      = "MMS Public API"
+	testNonce      = "nonce"
+)
+
+// fakeOpsManager is a Public API which only accepts the requests with a valid digest authorization,
+// the handlers are registered by method and path
+type fakeOpsManager struct {
+	t        *testing.T
+	handlers map[string]http.HandlerFunc
+	requests []string
+}
+
+func (f *fakeOpsManager) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !f.authorized(req) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", domain="", nonce="%s", algorithm=MD5, qop="auth", stale=false`, testRealm, testNonce))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	key := req.Method + " " + strings.TrimPrefix(req.URL.Path, apiPath)
+	f.requests = append(f.requests, key)
+	handler, ok := f.handlers[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errorCode": "RESOURCE_NOT_FOUND", "detail": "not found"}`))
+		return
+	}
+	handler(w, req)
+}
+
+func (f *fakeOpsManager) authorized(req *http.Request) bool {
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Digest ") {
+		return false
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(authorization, "Digest "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+	assert.Equal(f.t, req.URL.RequestURI(), params["uri"])
+	ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", testPublicKey, testRealm, testPrivateKey))
+	ha2 := md5Hex(fmt.Sprintf("%s:%s", req.Method, params["uri"]))
+	expected := md5Hex(fmt.Sprintf("%s:%s:%s:%s:auth:%s", ha1, testNonce, params["nc"], params["cnonce"], ha2))
+	return params["username"] == testPublicKey && params["response"] == expected
+}
+
+func newFakeOpsManager(t *testing.T, handlers map[string]http.HandlerFunc) (*fakeOpsManager, *Client, func()) {
+	fake := &fakeOpsManager{t: t, handlers: handlers}
+	server := httptest.NewServer(fake)
+	return fake, NewClient(server.URL+"/", testPublicKey, testPrivateKey, server.Client()), server.Close
+}
+
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func TestClient_ProjectID(t *testing.T) {
+	_, client, stop := newFakeOpsManager(t, map[string]http.HandlerFunc{
+		"GET /groups/byName/my project": respond(`{"id": "5e1", "name": "my project"}`),
+	})
+	defer stop()
+
+	id, err := client.ProjectID("my project", "org")
+	assert.NoError(t, err)
+	assert.Equal(t, "5e1", id)
+}
+
+func TestClient_ProjectID_CreatesTheProject(t *testing.T) {
+	var created project
+	fake, client, stop := newFakeOpsManager(t, map[string]http.HandlerFunc{
+		"POST /groups": func(w http.ResponseWriter, req *http.Request) {
+			body, _ := ioutil.ReadAll(req.Body)
+			assert.NoError(t, json.Unmarshal(body, &created))
+			_, _ = w.Write([]byte(`{"id": "5e2", "name": "new"}`))
+		},
+	})
+	defer stop()
+
+	id, err := client.ProjectID("new", "org")
+	assert.NoError(t, err)
+	assert.Equal(t, "5e2", id)
+	assert.Equal(t, project{Name: "new", OrgID: "org"}, created)
+	assert.Equal(t, []string{"GET /groups/byName/new", "POST /groups"}, fake.requests)
+}
+
+func TestClient_WrongAPIKey(t *testing.T) {
+	fake := &fakeOpsManager{t: t}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := NewClient(server.URL, testPublicKey, "wrong", server.Client())
+
+	_, err := client.Hosts("5e1")
+	assert.EqualError(t, err, "error listing hosts: status 401")
+	assert.Empty(t, fake.requests)
+}
+
+func TestClient_Hosts(t *testing.T) {
+	var added Host
+	fake, client, stop := newFakeOpsManager(t, map[string]http.HandlerFunc{
+		"GET /groups/5e1/hosts": respond(`{"results": [{"id": "h1", "hostname": "my-rs-0.my-rs-svc.my-ns.svc.cluster.local", "port": 27017}]}`),
+		"POST /groups/5e1/hosts": func(w http.ResponseWriter, req *http.Request) {
+			body, _ := ioutil.ReadAll(req.Body)
+			assert.NoError(t, json.Unmarshal(body, &added))
+			w.WriteHeader(http.StatusCreated)
+		},
+	})
+	defer stop()
+
+	hosts, err := client.Hosts("5e1")
+	assert.NoError(t, err)
+	assert.Equal(t, []Host{{ID: "h1", Hostname: "my-rs-0.my-rs-svc.my-ns.svc.cluster.local", Port: 27017}}, hosts)
+
+	host := Host{Hostname: "my-rs-1.my-rs-svc.my-ns.svc.cluster.local", Port: 27017, Username: "mms-monitoring-agent", Password: "pwd", AuthMechanismName: "SCRAM_SHA_256"}
+	assert.NoError(t, client.AddHost("5e1", host))
+	assert.Equal(t, host, added)
+
+	assert.NoError(t, client.RemoveHost("5e1", "h2"), "a host which isn't registered is ignored")
+	assert.Equal(t, "DELETE /groups/5e1/hosts/h2", fake.requests[len(fake.requests)-1])
+}
+
+func TestClient_CreateAgentAPIKey(t *testing.T) {
+	_, client, stop := newFakeOpsManager(t, map[string]http.HandlerFunc{
+		"POST /groups/5e1/agentapikeys": respond(`{"_id": "k1", "key": "agent-key", "desc": "MongoDB my-ns/my-rs"}`),
+	})
+	defer stop()
+
+	key, err := client.CreateAgentAPIKey("5e1", "MongoDB my-ns/my-rs")
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-key", key)
+}
+
+func TestClient_ActivateMonitoring(t *testing.T) {
+	ac := `{"version": 3, "processes": [], "monitoringVersions": [{"hostname": "other", "name": "11.0.0"}]}`
+	var updated map[string]interface{}
+	fake, client, stop := newFakeOpsManager(t, map[string]http.HandlerFunc{
+		"GET /groups/5e1/automationConfig": func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(ac))
+		},
+		"PUT /groups/5e1/automationConfig": func(w http.ResponseWriter, req *http.Request) {
+			body, _ := ioutil.ReadAll(req.Body)
+			assert.NoError(t, json.Unmarshal(body, &updated))
+			ac = string(body)
+		},
+	})
+	defer stop()
+
+	params := map[string]string{"sslTrustedServerCertificates": "/tls/ca.crt"}
+	assert.NoError(t, client.ActivateMonitoring("5e1", "my-rs-monitoring-agent", params))
+	assert.Equal(t, float64(3), updated["version"], "the rest of the automation config is kept")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"hostname": "other", "name": "11.0.0"},
+		map[string]interface{}{"hostname": "my-rs-monitoring-agent", "additionalParams": map[string]interface{}{"sslTrustedServerCertificates": "/tls/ca.crt"}},
+	}, updated["monitoringVersions"])
+
+	requests := len(fake.requests)
+	assert.NoError(t, client.ActivateMonitoring("5e1", "my-rs-monitoring-agent", params))
+	assert.Len(t, fake.requests, requests+1, "the automation config isn't updated when monitoring is already activated")
+}
+
+func TestError(t *testing.T) {
+	_, client, stop := newFakeOpsManager(t, nil)
+	defer stop()
+
+	err := client.AddHost("5e1", Host{Hostname: "host"})
+	assert.EqualError(t, err, "error adding host host: status 404: RESOURCE_NOT_FOUND: not found")
+	assert.False(t, IsNotFound(err), "the error is wrapped")
+	assert.True(t, IsNotFound(Error{Status: http.StatusNotFound}))
+}
@@ -0,0 +1,115 @@
+package readiness
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+)
+
+// the replica set states of a member, as reported in the ReplicationStatus of the agent health status
+const (
+	primaryState    = 1
+	secondaryState  = 2
+	recoveringState = 3
+	startup2State   = 5
+	unknownState    = 6
+	arbiterState    = 7
+	downState       = 8
+)
+
+// waitSteps are the steps in which the agent waits for the other members of the replica set, such as
+// for all the members to be up before initiating it. The member is ready during these steps, as the
+// Pods of the other members are only started once it is ready when they are started in order.
+var waitSteps = map[string]bool{
+	"WaitRsInit":                             true,
+	"WaitAllRsMembersUp":                     true,
+	"WaitFeatureCompatibilityVersionCorrect": true,
+	"WaitHasCorrectAutomationCredentials":    true,
+	"WaitCanUpdate":                          true,
+}
+
+// Config holds the thresholds of the readiness probe
+type Config struct {
+	// MongodDownTimeout is how long mongod can be down while it is expected to be up before the
+	// member is unready, so that a restart of mongod by the agent doesn't make it unready
+	MongodDownTimeout time.Duration
+	// HealthStatusTimeout is how long the agent can go without updating its health status before
+	// the member is unready, as the agent isn't running or is stuck. It is ignored if zero.
+	HealthStatusTimeout time.Duration
+}
+
+// DefaultConfig is the Config of the readiness probe if no threshold is configured
+var DefaultConfig = Config{MongodDownTimeout: 30 * time.Second}
+
+// Result is the outcome of the readiness probe and the reason for it
+type Result struct {
+	Ready  bool
+	Reason string
+}
+
+func ready(format string, args ...interface{}) Result {
+	return Result{Ready: true, Reason: fmt.Sprintf(format, args...)}
+}
+
+func unready(format string, args ...interface{}) Result {
+	return Result{Ready: false, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Check returns whether the process with the given hostname is ready according to the health status
+// of the agent, last updated at updatedAt. A member is ready once its agent has reached goal state, or
+// while mongod is up and a healthy member of the replica set, or while the agent waits for the other
+// members.
+func Check(health agenthealth.Health, hostname string, updatedAt time.Time, cfg Config, now time.Time) Result {
+	if cfg.HealthStatusTimeout > 0 && now.Sub(updatedAt) > cfg.HealthStatusTimeout {
+		return unready("the agent hasn't updated its health status for %s", now.Sub(updatedAt).Round(time.Second))
+	}
+	if len(health.Healthiness) == 0 {
+		// the agent manages no process, such as once the member has been removed from the replica set
+		return ready("the agent manages no process")
+	}
+	status, ok := health.Healthiness[hostname]
+	if !ok {
+		return unready("the agent hasn't reported the status of %s", hostname)
+	}
+	if status.IsInGoalState {
+		return ready("the agent is in goal state")
+	}
+
+	step := ""
+	if memberStatus, ok := health.MemberStatusFor(hostname); ok {
+		// the current step is in the form "<move>/<step>"
+		step = memberStatus.CurrentStep[strings.LastIndex(memberStatus.CurrentStep, "/")+1:]
+	}
+	if waitSteps[step] {
+		return ready("the agent waits for the other members at step %s", step)
+	}
+
+	if status.ExpectedToBeUp {
+		downFor := now.Sub(time.Unix(status.LastMongoUpTime, 0))
+		if downFor > cfg.MongodDownTimeout {
+			return unready("mongod is down for %s", downFor.Round(time.Second))
+		}
+	}
+
+	if status.ReplicationStatus == nil {
+		return unready("the agent is not in goal state, at step %s", stepOrNone(step))
+	}
+	switch *status.ReplicationStatus {
+	case primaryState, secondaryState, arbiterState:
+		return ready("mongod is a healthy member of the replica set while the agent executes step %s", stepOrNone(step))
+	case startup2State, recoveringState:
+		return unready("mongod is syncing from the other members, at step %s", stepOrNone(step))
+	case unknownState, downState:
+		return unready("mongod is unreachable from the other members, at step %s", stepOrNone(step))
+	}
+	return unready("mongod is in replica set state %d, at step %s", *status.ReplicationStatus, stepOrNone(step))
+}
+
+func stepOrNone(step string) string {
+	if step == "" {
+		return "none"
+	}
+	return step
+}
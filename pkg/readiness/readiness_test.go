@@ -0,0 +1,124 @@
+package readiness
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/agenthealth"
+	"github.com/stretchr/testify/assert"
+)
+
+const hostname = "my-rs-0"
+
+var now = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func replicationStatus(state int) *int {
+	return &state
+}
+
+func healthAtStep(status agenthealth.ProcessHealth, step string) agenthealth.Health {
+	started := now.Add(-time.Minute)
+	return agenthealth.Health{
+		Healthiness: map[string]agenthealth.ProcessHealth{hostname: status},
+		ProcessPlans: map[string]agenthealth.MmsDirectorStatus{hostname: {
+			Plans: []*agenthealth.PlanStatus{{
+				Started: &started,
+				Moves: []*agenthealth.MoveStatus{{
+					Move:  "Start",
+					Steps: []*agenthealth.StepStatus{{Step: step, Started: &started}},
+				}},
+			}},
+		}},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	mongodUp := agenthealth.ProcessHealth{ExpectedToBeUp: true, LastMongoUpTime: now.Unix()}
+	withReplicationStatus := func(state int) agenthealth.ProcessHealth {
+		status := mongodUp
+		status.ReplicationStatus = replicationStatus(state)
+		return status
+	}
+
+	tests := []struct {
+		name          string
+		health        agenthealth.Health
+		updatedAt     time.Time
+		expectedReady bool
+		reason        string
+	}{
+		{
+			name:          "The agent manages no process",
+			health:        agenthealth.Health{},
+			expectedReady: true,
+			reason:        "the agent manages no process",
+		},
+		{
+			name:   "The process is missing",
+			health: agenthealth.Health{Healthiness: map[string]agenthealth.ProcessHealth{"my-rs-1": {IsInGoalState: true}}},
+			reason: "the agent hasn't reported the status of my-rs-0",
+		},
+		{
+			name:          "The agent is in goal state",
+			health:        healthAtStep(agenthealth.ProcessHealth{IsInGoalState: true}, ""),
+			expectedReady: true,
+			reason:        "the agent is in goal state",
+		},
+		{
+			name:      "The health status is stale",
+			health:    healthAtStep(agenthealth.ProcessHealth{IsInGoalState: true}, ""),
+			updatedAt: now.Add(-5 * time.Minute),
+			reason:    "the agent hasn't updated its health status for 5m0s",
+		},
+		{
+			name:          "The agent waits for the other members",
+			health:        healthAtStep(agenthealth.ProcessHealth{ExpectedToBeUp: true}, "WaitAllRsMembersUp"),
+			expectedReady: true,
+			reason:        "the agent waits for the other members at step WaitAllRsMembersUp",
+		},
+		{
+			name:   "mongod is down",
+			health: healthAtStep(agenthealth.ProcessHealth{ExpectedToBeUp: true, LastMongoUpTime: now.Add(-time.Minute).Unix()}, "StartFresh"),
+			reason: "mongod is down for 1m0s",
+		},
+		{
+			name:          "mongod is a secondary",
+			health:        healthAtStep(withReplicationStatus(secondaryState), "UpdateFeatureCompatibilityVersion"),
+			expectedReady: true,
+			reason:        "mongod is a healthy member of the replica set while the agent executes step UpdateFeatureCompatibilityVersion",
+		},
+		{
+			name:   "mongod is syncing",
+			health: healthAtStep(withReplicationStatus(startup2State), "WaitSecondary"),
+			reason: "mongod is syncing from the other members, at step WaitSecondary",
+		},
+		{
+			name:   "mongod is unreachable",
+			health: healthAtStep(withReplicationStatus(downState), "WaitSecondary"),
+			reason: "mongod is unreachable from the other members, at step WaitSecondary",
+		},
+		{
+			name:   "The replica set state is unknown",
+			health: healthAtStep(mongodUp, "StartFresh"),
+			reason: "the agent is not in goal state, at step StartFresh",
+		},
+	}
+
+	cfg := Config{MongodDownTimeout: 30 * time.Second, HealthStatusTimeout: time.Minute}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updatedAt := tt.updatedAt
+			if updatedAt.IsZero() {
+				updatedAt = now
+			}
+			result := Check(tt.health, hostname, updatedAt, cfg, now)
+			assert.Equal(t, Result{Ready: tt.expectedReady, Reason: tt.reason}, result)
+		})
+	}
+}
+
+func TestCheck_HealthStatusTimeoutIsIgnoredIfZero(t *testing.T) {
+	health := healthAtStep(agenthealth.ProcessHealth{IsInGoalState: true}, "")
+	result := Check(health, hostname, now.Add(-time.Hour), DefaultConfig, now)
+	assert.True(t, result.Ready)
+}
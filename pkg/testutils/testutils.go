@@ -0,0 +1,111 @@
+// Package testutils holds the helpers of the unit tests of the operator: the MongoDB resources, the
+// version manifest and the fake manager they reconcile, and the assertions on the reconciliations.
+// They are exported so that the forks and the integration tests of the operator can reuse them.
+package testutils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/client"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NewTestReplicaSet returns the my-rs replica set of 3 members in the my-ns namespace
+func NewTestReplicaSet() mdbv1.MongoDB {
+	return mdbv1.MongoDB{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-rs",
+			Namespace:   "my-ns",
+			Annotations: map[string]string{},
+		},
+		Spec: mdbv1.MongoDBSpec{
+			Members: 3,
+			Version: "4.2.2",
+		},
+	}
+}
+
+// NewScramReplicaSet returns the test replica set with SCRAM authentication enabled
+func NewScramReplicaSet() mdbv1.MongoDB {
+	mdb := NewTestReplicaSet()
+	mdb.Spec.Security.Authentication = mdbv1.Authentication{
+		Enabled: true,
+		Modes:   []mdbv1.AuthMode{"SCRAM"},
+	}
+	return mdb
+}
+
+// NewTestReplicaSetWithTLS returns the test replica set with TLS enabled, its certificate is read from
+// the certificateKeySecret Secret and its CA from the caConfigMap ConfigMap
+func NewTestReplicaSetWithTLS() mdbv1.MongoDB {
+	mdb := NewTestReplicaSet()
+	mdb.Spec.Security.TLS = mdbv1.TLS{
+		Enabled: true,
+		CaConfigMap: mdbv1.LocalObjectReference{
+			Name: "caConfigMap",
+		},
+		CertificateKeySecret: mdbv1.LocalObjectReference{
+			Name: "certificateKeySecret",
+		},
+	}
+	return mdb
+}
+
+// MockManifestProvider returns a version manifest provider listing the given versions
+func MockManifestProvider(versions ...string) func() (automationconfig.VersionManifest, error) {
+	return func() (automationconfig.VersionManifest, error) {
+		manifest := automationconfig.VersionManifest{Updated: 0}
+		for _, version := range versions {
+			manifest.Versions = append(manifest.Versions, automationconfig.MongoDbVersionConfig{
+				Name: version,
+				Builds: []automationconfig.BuildConfig{{
+					Platform:     "platform",
+					Url:          "url",
+					GitVersion:   "gitVersion",
+					Architecture: "arch",
+					Flavor:       "flavor",
+					MinOsVersion: "0",
+					MaxOsVersion: "10",
+					Modules:      []string{},
+				}},
+			})
+		}
+		return manifest, nil
+	}
+}
+
+// NewManager returns a fake manager whose in-memory client holds the given objects, and the client
+func NewManager(objs ...runtime.Object) (*client.MockedManager, client.Client) {
+	mgr := client.NewManager(nil)
+	c := client.NewClient(mgr.GetClient())
+	for _, obj := range objs {
+		_ = c.Create(context.TODO(), obj)
+	}
+	return mgr, c
+}
+
+// AssertReconciliationSuccessful asserts the reconciliation succeeded and isn't requeued
+func AssertReconciliationSuccessful(t *testing.T, result reconcile.Result, err error) {
+	assert.NoError(t, err)
+	assert.Equal(t, false, result.Requeue)
+	assert.Equal(t, time.Duration(0), result.RequeueAfter)
+}
+
+// MakeStatefulSetReady updates the StatefulSet corresponding to the
+// provided MongoDB resource to mark it as ready for the case of `statefulset.IsReady`
+func MakeStatefulSetReady(c k8sClient.Client, mdb mdbv1.MongoDB) {
+	sts := appsv1.StatefulSet{}
+	_ = c.Get(context.TODO(), mdb.NamespacedName(), &sts)
+	sts.Status.ReadyReplicas = int32(mdb.Spec.Members)
+	sts.Status.UpdatedReplicas = int32(mdb.Spec.Members)
+	_ = c.Update(context.TODO(), &sts)
+}
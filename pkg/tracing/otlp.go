@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the environment variables of the OpenTelemetry SDKs configuring the OTLP exporter
+	otlpEndpointEnv       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otlpTracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	serviceNameEnv        = "OTEL_SERVICE_NAME"
+
+	defaultServiceName = "mongodb-kubernetes-operator"
+	tracesPath         = "/v1/traces"
+	exportTimeout      = 10 * time.Second
+
+	// the values of the enums of the OTLP protocol
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+// OTLPExporter exports the spans to an OpenTelemetry collector with the JSON encoding of OTLP over HTTP
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+}
+
+// NewOTLPExporterFromEnv returns an OTLPExporter configured with the standard variables of the
+// OpenTelemetry SDKs, OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT, and
+// OTEL_SERVICE_NAME. The boolean is false if no endpoint is configured.
+func NewOTLPExporterFromEnv() (*OTLPExporter, bool) {
+	endpoint := os.Getenv(otlpTracesEndpointEnv)
+	if endpoint == "" {
+		base := os.Getenv(otlpEndpointEnv)
+		if base == "" {
+			return nil, false
+		}
+		endpoint = strings.TrimSuffix(base, "/") + tracesPath
+	}
+	serviceName := os.Getenv(serviceNameEnv)
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	return NewOTLPExporter(endpoint, serviceName), true
+}
+
+// NewOTLPExporter returns an OTLPExporter posting the spans to the endpoint, such as
+// http://otel-collector:4318/v1/traces
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	return &OTLPExporter{endpoint: endpoint, serviceName: serviceName, client: &http.Client{Timeout: exportTimeout}}
+}
+
+// Export posts the spans to the collector
+func (e *OTLPExporter) Export(spans []*Span) error {
+	body, err := json.Marshal(e.buildRequest(spans))
+	if err != nil {
+		return fmt.Errorf("error encoding spans: %s", err)
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error exporting spans: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error exporting spans: %s: %s", resp.Status, message)
+	}
+	return nil
+}
+
+// the subset of the ExportTraceServiceRequest of OTLP used by the operator
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *OTLPExporter) buildRequest(spans []*Span) exportRequest {
+	otlpSpans := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		otlpSpans[i] = otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        keyValues(s.Attributes),
+		}
+		if s.Err != nil {
+			otlpSpans[i].Status = status{Code: statusCodeError, Message: s.Err.Error()}
+		}
+	}
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: keyValues(map[string]string{"service.name": e.serviceName})},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: defaultServiceName}, Spans: otlpSpans}},
+	}}}
+}
+
+func keyValues(attributes map[string]string) []keyValue {
+	var kvs []keyValue
+	for k, v := range attributes {
+		kvs = append(kvs, keyValue{Key: k, Value: anyValue{StringValue: v}})
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs
+}
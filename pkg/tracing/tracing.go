@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// queueSize is the number of ended spans kept until they are exported, the spans ended
+	// while the queue is full are dropped
+	queueSize = 2048
+	// exportInterval is the interval at which the queued spans are exported
+	exportInterval = 5 * time.Second
+)
+
+// Exporter exports the ended spans, such as to an OTLP collector
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+// Tracer records the spans of the operator and exports them in batches. A Tracer without an
+// Exporter doesn't record anything, so that the operator can be instrumented whether tracing
+// is enabled or not.
+type Tracer struct {
+	exporter Exporter
+	queue    chan *Span
+	// onError is called with the errors of the exports, which are never retried
+	onError func(error)
+}
+
+// NewTracer returns a Tracer exporting its spans with the exporter
+func NewTracer(exporter Exporter, onError func(error)) *Tracer {
+	return &Tracer{exporter: exporter, queue: make(chan *Span, queueSize), onError: onError}
+}
+
+var (
+	globalMu     sync.RWMutex
+	globalTracer = &Tracer{}
+)
+
+// Global returns the Tracer set by ReplaceGlobal, which doesn't record anything by default
+func Global() *Tracer {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return globalTracer
+}
+
+// ReplaceGlobal replaces the Tracer returned by Global
+func ReplaceGlobal(t *Tracer) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	globalTracer = t
+}
+
+// Span is an operation of the operator, such as a reconciliation or one of its steps. A child span
+// belongs to the trace of its parent.
+type Span struct {
+	tracer *Tracer
+
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	// Err is the error the operation failed with, if any
+	Err error
+}
+
+// StartSpan starts a span, which is a child of the parent if it isn't nil
+func (t *Tracer) StartSpan(parent *Span, name string) *Span {
+	if t == nil || t.exporter == nil {
+		return nil
+	}
+	span := &Span{tracer: t, SpanID: randomID(8), Name: name, Start: time.Now(), Attributes: map[string]string{}}
+	if parent != nil {
+		span.TraceID, span.ParentSpanID = parent.TraceID, parent.SpanID
+	} else {
+		span.TraceID = randomID(16)
+	}
+	return span
+}
+
+// SetAttribute sets an attribute of the span, it can be called on a nil span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.Attributes[key] = value
+}
+
+// Finish ends the span, which failed if err isn't nil, and queues it to be exported. It can be
+// called on a nil span.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.End, s.Err = time.Now(), err
+	select {
+	case s.tracer.queue <- s:
+	default:
+	}
+}
+
+// Start exports the queued spans until the stop channel is closed, it implements manager.Runnable
+func (t *Tracer) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.Flush()
+		case <-stop:
+			t.Flush()
+			return nil
+		}
+	}
+}
+
+// Flush exports the queued spans
+func (t *Tracer) Flush() {
+	if t.exporter == nil {
+		return
+	}
+	var spans []*Span
+dequeue:
+	for {
+		select {
+		case span := <-t.queue:
+			spans = append(spans, span)
+		default:
+			break dequeue
+		}
+	}
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.exporter.Export(spans); err != nil && t.onError != nil {
+		t.onError(err)
+	}
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	// the ids only need to be unique, an id of zeros is used if no random bytes can be read
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingExporter struct {
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(spans []*Span) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTracer_WithoutExporterDoesNotRecord(t *testing.T) {
+	span := Global().StartSpan(nil, "Reconcile")
+	assert.Nil(t, span)
+
+	// the spans can be used whether they are recorded or not
+	span.SetAttribute("name", "my-rs")
+	span.Finish(nil)
+}
+
+func TestTracer_ChildSpansBelongToTheTraceOfTheirParent(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter, nil)
+
+	parent := tracer.StartSpan(nil, "Reconcile")
+	child := tracer.StartSpan(parent, "EnsureAutomationConfig")
+	child.Finish(fmt.Errorf("error"))
+	parent.SetAttribute("name", "my-rs")
+	parent.Finish(nil)
+	tracer.Flush()
+
+	assert.Len(t, exporter.spans, 2)
+	assert.Equal(t, child, exporter.spans[0])
+	assert.Len(t, parent.TraceID, 32)
+	assert.Len(t, parent.SpanID, 16)
+	assert.Empty(t, parent.ParentSpanID)
+	assert.Equal(t, parent.TraceID, child.TraceID)
+	assert.Equal(t, parent.SpanID, child.ParentSpanID)
+	assert.EqualError(t, child.Err, "error")
+	assert.Equal(t, map[string]string{"name": "my-rs"}, parent.Attributes)
+	assert.False(t, child.End.Before(child.Start))
+}
+
+func TestOTLPExporter_PostsTheSpansAsJSON(t *testing.T) {
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, tracesPath, r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &request))
+	}))
+	defer server.Close()
+
+	tracer := NewTracer(NewOTLPExporter(server.URL+tracesPath, "operator"), func(err error) { assert.NoError(t, err) })
+	span := tracer.StartSpan(nil, "Reconcile")
+	span.SetAttribute("namespace", "my-ns")
+	span.Finish(fmt.Errorf("failed"))
+	tracer.Flush()
+
+	resourceSpans := request["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"attributes": []interface{}{map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "operator"}}},
+	}, resourceSpans["resource"])
+
+	otlpSpan := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, span.TraceID, otlpSpan["traceId"])
+	assert.Equal(t, span.SpanID, otlpSpan["spanId"])
+	assert.Equal(t, "Reconcile", otlpSpan["name"])
+	assert.Equal(t, fmt.Sprint(span.Start.UnixNano()), otlpSpan["startTimeUnixNano"])
+	assert.Equal(t, map[string]interface{}{"code": float64(statusCodeError), "message": "failed"}, otlpSpan["status"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "namespace", "value": map[string]interface{}{"stringValue": "my-ns"}}}, otlpSpan["attributes"])
+}
+
+func TestOTLPExporter_ReturnsTheErrorsOfTheCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	err := NewOTLPExporter(server.URL, "operator").Export([]*Span{{Name: "Reconcile"}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+}
+
+func TestNewOTLPExporterFromEnv(t *testing.T) {
+	defer os.Unsetenv(otlpEndpointEnv)
+	defer os.Unsetenv(otlpTracesEndpointEnv)
+
+	_, ok := NewOTLPExporterFromEnv()
+	assert.False(t, ok)
+
+	os.Setenv(otlpEndpointEnv, "http://collector:4318/")
+	exporter, ok := NewOTLPExporterFromEnv()
+	assert.True(t, ok)
+	assert.Equal(t, "http://collector:4318/v1/traces", exporter.endpoint)
+	assert.Equal(t, defaultServiceName, exporter.serviceName)
+
+	os.Setenv(otlpTracesEndpointEnv, "http://traces:4318/traces")
+	exporter, _ = NewOTLPExporterFromEnv()
+	assert.Equal(t, "http://traces:4318/traces", exporter.endpoint)
+}
@@ -0,0 +1,97 @@
+package connectionstring
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+)
+
+const (
+	// DefaultPort is the port the members listen on
+	DefaultPort = 27017
+	// DefaultClusterDomain is the domain of the Kubernetes cluster when none is set
+	DefaultClusterDomain = "cluster.local"
+	defaultAuthDatabase  = "admin"
+)
+
+// User is the user authenticating with the connection string
+type User struct {
+	Username string
+	Password string
+	// Database is the authentication database of the user, admin if empty
+	Database string
+}
+
+// Options are the options of the connection strings of a resource
+type Options struct {
+	// ClusterDomain is the domain of the Kubernetes cluster, DefaultClusterDomain if empty
+	ClusterDomain string
+	// Params are added to the query of the connection string, e.g. readPreference, they take
+	// precedence over the ones set from the resource
+	Params map[string]string
+}
+
+// Hosts returns the host and port of each member of the resource
+func Hosts(mdb mdbv1.MongoDB, clusterDomain string) []string {
+	hosts := make([]string, mdb.Spec.Members)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("%s-%d.%s:%d", mdb.Name, i, serviceHost(mdb, clusterDomain), DefaultPort)
+	}
+	return hosts
+}
+
+// Standard returns the mongodb:// connection string listing every member of the resource. user may
+// be nil to connect without authenticating.
+func Standard(mdb mdbv1.MongoDB, user *User, options Options) string {
+	query := params(mdb, user, options, false)
+	return fmt.Sprintf("mongodb://%s%s/?%s", userInfo(user), strings.Join(Hosts(mdb, options.ClusterDomain), ","), query.Encode())
+}
+
+// SRV returns the mongodb+srv:// connection string of the resource, the members are looked up in the
+// SRV records the headless Service of the resource publishes for its port named mongodb. user may be
+// nil to connect without authenticating.
+func SRV(mdb mdbv1.MongoDB, user *User, options Options) string {
+	query := params(mdb, user, options, true)
+	return fmt.Sprintf("mongodb+srv://%s%s/?%s", userInfo(user), serviceHost(mdb, options.ClusterDomain), query.Encode())
+}
+
+func serviceHost(mdb mdbv1.MongoDB, clusterDomain string) string {
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+	return fmt.Sprintf("%s.%s.svc.%s", mdb.ServiceName(), mdb.Namespace, clusterDomain)
+}
+
+func userInfo(user *User) string {
+	if user == nil {
+		return ""
+	}
+	return url.UserPassword(user.Username, user.Password).String() + "@"
+}
+
+// params returns the query of the connection string: the replica set, the authentication database of
+// the user and whether TLS is required, then the params of the options
+func params(mdb mdbv1.MongoDB, user *User, options Options, srv bool) url.Values {
+	query := url.Values{}
+	query.Set("replicaSet", mdb.Name)
+	if user != nil {
+		database := user.Database
+		if database == "" {
+			database = defaultAuthDatabase
+		}
+		query.Set("authSource", database)
+	}
+	requireTLS := mdb.Spec.Security.TLS.Enabled && !mdb.Spec.Security.TLS.Optional
+	if requireTLS {
+		query.Set("tls", "true")
+	} else if srv {
+		// TLS is enabled by default by the mongodb+srv:// scheme
+		query.Set("tls", "false")
+	}
+	for key, value := range options.Params {
+		query.Set(key, value)
+	}
+	return query
+}
@@ -0,0 +1,55 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	_, err := Parse("0 2 * * 6")
+	assert.NoError(t, err)
+	_, err = Parse("*/15 1-5,22 1 */2 1-5/2")
+	assert.NoError(t, err)
+
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := Parse(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	saturday := time.Date(2020, 6, 6, 2, 0, 0, 0, time.UTC)
+
+	s, _ := Parse("0 2 * * 6")
+	assert.True(t, s.Matches(saturday))
+	assert.False(t, s.Matches(saturday.Add(time.Minute)))
+	assert.False(t, s.Matches(saturday.Add(24*time.Hour)))
+
+	s, _ = Parse("0 2 * * 7")
+	assert.True(t, s.Matches(saturday.Add(24*time.Hour)), "7 is Sunday")
+
+	s, _ = Parse("*/20 * * * *")
+	assert.True(t, s.Matches(saturday.Add(40*time.Minute)))
+	assert.False(t, s.Matches(saturday.Add(30*time.Minute)))
+
+	// either the day of month or the day of week matches
+	s, _ = Parse("0 2 1 * 6")
+	assert.True(t, s.Matches(saturday))
+	assert.True(t, s.Matches(time.Date(2020, 7, 1, 2, 0, 0, 0, time.UTC)))
+	assert.False(t, s.Matches(time.Date(2020, 7, 2, 2, 0, 0, 0, time.UTC)))
+}
+
+func TestNext(t *testing.T) {
+	s, _ := Parse("30 2 * * 6")
+	friday := time.Date(2020, 6, 5, 10, 15, 30, 0, time.UTC)
+	assert.Equal(t, time.Date(2020, 6, 6, 2, 30, 0, 0, time.UTC), s.Next(friday))
+	assert.Equal(t, time.Date(2020, 6, 13, 2, 30, 0, 0, time.UTC), s.Next(time.Date(2020, 6, 6, 2, 30, 0, 0, time.UTC)))
+
+	s, _ = Parse("0 0 29 2 *")
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), s.Next(friday))
+
+	s, _ = Parse("0 0 31 2 *")
+	assert.True(t, s.Next(friday).IsZero())
+}
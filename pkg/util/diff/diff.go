@@ -0,0 +1,143 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Redacted replaces the values of the sensitive fields
+const Redacted = "<redacted>"
+
+// Change describes a single difference between two values.
+type Change struct {
+	// Path is the location of the changed value, e.g. "processes[0].version"
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// ToTree returns the JSON encoding of the value decoded as a tree of maps and slices
+func ToTree(value interface{}) (map[string]interface{}, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	tree := map[string]interface{}{}
+	if err := json.Unmarshal(bytes, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// Trees returns the changed values between the previous and the current tree, ordered by path.
+// The values of the fields whose key is in sensitiveFields, and of the fields they contain, are
+// redacted.
+func Trees(previous, current map[string]interface{}, sensitiveFields map[string]bool) []Change {
+	var changes []Change
+	diffValues("", previous, current, false, sensitiveFields, &changes)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffValues(path string, previous, current interface{}, sensitive bool, sensitiveFields map[string]bool, changes *[]Change) {
+	// a value which was added or removed as a whole is still walked field by field
+	// so that nested sensitive values are redacted.
+	previousMap, previousIsMap := previous.(map[string]interface{})
+	currentMap, currentIsMap := current.(map[string]interface{})
+	if (previousIsMap || previous == nil) && (currentIsMap || current == nil) && (previousIsMap || currentIsMap) {
+		keys := map[string]bool{}
+		for k := range previousMap {
+			keys[k] = true
+		}
+		for k := range currentMap {
+			keys[k] = true
+		}
+		for k := range keys {
+			diffValues(joinPath(path, k), previousMap[k], currentMap[k], sensitive || sensitiveFields[k], sensitiveFields, changes)
+		}
+		return
+	}
+
+	previousSlice, previousIsSlice := previous.([]interface{})
+	currentSlice, currentIsSlice := current.([]interface{})
+	if (previousIsSlice || previous == nil) && (currentIsSlice || current == nil) && (previousIsSlice || currentIsSlice) {
+		for i := 0; i < len(previousSlice) || i < len(currentSlice); i++ {
+			var p, c interface{}
+			if i < len(previousSlice) {
+				p = previousSlice[i]
+			}
+			if i < len(currentSlice) {
+				c = currentSlice[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), p, c, sensitive, sensitiveFields, changes)
+		}
+		return
+	}
+
+	previousValue, currentValue := format(previous), format(current)
+	if previousValue == currentValue {
+		return
+	}
+	if sensitive {
+		previousValue, currentValue = redact(previous), redact(current)
+	}
+	*changes = append(*changes, Change{Path: path, Old: previousValue, New: currentValue})
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func format(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(bytes)
+}
+
+func redact(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+	return Redacted
+}
+
+// Redact replaces the values of the fields of the tree whose key is in sensitiveFields, and of the
+// fields they contain, with Redacted
+func Redact(tree map[string]interface{}, sensitiveFields map[string]bool) {
+	for k, v := range tree {
+		if sensitiveFields[k] {
+			tree[k] = redact(v)
+			continue
+		}
+		redactValue(v, sensitiveFields)
+	}
+}
+
+func redactValue(value interface{}, sensitiveFields map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		Redact(v, sensitiveFields)
+	case []interface{}:
+		for _, item := range v {
+			redactValue(item, sensitiveFields)
+		}
+	}
+}
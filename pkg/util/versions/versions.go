@@ -0,0 +1,82 @@
+package versions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MongoDBVersion is a parsed MongoDB server version, e.g. "4.2.6".
+// Any pre-release or build suffix (e.g. "-rc0" or "-ent") is ignored.
+type MongoDBVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// Parse parses a MongoDB server version of the form "major.minor[.patch]".
+func Parse(version string) (MongoDBVersion, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if idx := strings.IndexAny(trimmed, "-+"); idx != -1 {
+		trimmed = trimmed[:idx]
+	}
+
+	parts := strings.Split(trimmed, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return MongoDBVersion{}, fmt.Errorf("invalid MongoDB version \"%s\"", version)
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return MongoDBVersion{}, fmt.Errorf("invalid MongoDB version \"%s\"", version)
+		}
+		numbers[i] = n
+	}
+	return MongoDBVersion{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+// MustParse is like Parse but panics if the version can't be parsed.
+// It should only be used with constant versions.
+func MustParse(version string) MongoDBVersion {
+	v, err := Parse(version)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is lower than,
+// equal to or greater than other.
+func (v MongoDBVersion) Compare(other MongoDBVersion) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff < 0 {
+			return -1
+		}
+		if diff > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// AtLeast returns true if v is greater than or equal to other.
+func (v MongoDBVersion) AtLeast(other MongoDBVersion) bool {
+	return v.Compare(other) >= 0
+}
+
+// LessThan returns true if v is lower than other.
+func (v MongoDBVersion) LessThan(other MongoDBVersion) bool {
+	return v.Compare(other) < 0
+}
+
+// MajorMinor returns the release series of this version, e.g. "4.2".
+// This is the format used for the featureCompatibilityVersion.
+func (v MongoDBVersion) MajorMinor() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v MongoDBVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
@@ -0,0 +1,35 @@
+package versions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	v, err := Parse("4.2.6")
+	assert.NoError(t, err)
+	assert.Equal(t, MongoDBVersion{Major: 4, Minor: 2, Patch: 6}, v)
+
+	v, err = Parse("4.4")
+	assert.NoError(t, err)
+	assert.Equal(t, MongoDBVersion{Major: 4, Minor: 4}, v)
+
+	v, err = Parse("6.0.3-ent")
+	assert.NoError(t, err)
+	assert.Equal(t, MongoDBVersion{Major: 6, Minor: 0, Patch: 3}, v)
+
+	_, err = Parse("4")
+	assert.Error(t, err)
+
+	_, err = Parse("four.two")
+	assert.Error(t, err)
+}
+
+func TestCompare(t *testing.T) {
+	assert.True(t, MustParse("4.2.6").AtLeast(MustParse("4.2.6")))
+	assert.True(t, MustParse("4.2.6").AtLeast(MustParse("4.2.0")))
+	assert.True(t, MustParse("4.0.10").LessThan(MustParse("4.2.0")))
+	assert.False(t, MustParse("5.0.0").LessThan(MustParse("4.4.9")))
+	assert.Equal(t, "4.2", MustParse("4.2.6").MajorMinor())
+}
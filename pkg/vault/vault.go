@@ -0,0 +1,327 @@
+// Package vault reads the secrets of the KV version 2 secrets engine of HashiCorp Vault.
+//
+// The operator logs in with the Kubernetes auth method, with the role of the MongoDB resource it reads
+// the secrets of and a token it requests for the service account of the members of the resource, in
+// the namespace of the resource. The operator is then only allowed what the role allows the members
+// of the resource, so that the bindings of the roles to the service accounts and namespaces decide
+// which resources can read which secrets, and a resource can't log in with the role of another
+// namespace. The tokens are kept until they expire, a token which is refused is replaced by logging
+// in again.
+package vault
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/types"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	addrEnv      = "VAULT_ADDR"
+	caCertEnv    = "VAULT_CACERT"
+	authPathEnv  = "VAULT_AUTH_PATH"
+	namespaceEnv = "VAULT_NAMESPACE"
+
+	defaultAuthPath = "kubernetes"
+	namespaceHeader = "X-Vault-Namespace"
+	tokenHeader     = "X-Vault-Token"
+
+	requestTimeout = 10 * time.Second
+	// the tokens are replaced this long before they expire, or half of their lease if it is shorter,
+	// so that they don't expire while in use
+	tokenExpiryMargin = 30 * time.Second
+	// serviceAccountTokenExpiration is the lifetime of the service account tokens requested to log in,
+	// the shortest the API server allows
+	serviceAccountTokenExpiration int64 = 600
+)
+
+// Reader reads the secrets of Vault
+type Reader interface {
+	// Read returns the data of the KV version 2 secret at path, such as secret/mongodb/my-rs/tls where
+	// secret is the mount path of the engine, logged in as login
+	Read(login Login, path string) (map[string]string, error)
+}
+
+// Login is what the operator logs in to Vault as: a role of the Kubernetes auth method, and the
+// service account the token sent to Vault is requested for, which the role must be bound to
+type Login struct {
+	Role           string
+	ServiceAccount types.NamespacedName
+}
+
+// TokenRequester returns a token of the service account, which Vault reviews with the API server
+type TokenRequester func(serviceAccount types.NamespacedName) (string, error)
+
+// NewTokenRequester returns the TokenRequester requesting the tokens with the TokenRequest API
+func NewTokenRequester(serviceAccounts typedcorev1.ServiceAccountsGetter) TokenRequester {
+	return func(serviceAccount types.NamespacedName) (string, error) {
+		expiration := serviceAccountTokenExpiration
+		tr, err := serviceAccounts.ServiceAccounts(serviceAccount.Namespace).CreateToken(serviceAccount.Name, &authenticationv1.TokenRequest{
+			Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expiration},
+		})
+		if err != nil {
+			return "", err
+		}
+		return tr.Status.Token, nil
+	}
+}
+
+// NotFoundError is returned when the secret doesn't exist, or the policies of the role don't allow
+// reading it
+type NotFoundError struct {
+	Path string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("secret %s not found in Vault", e.Path)
+}
+
+// IsNotFound returns true if the error is a NotFoundError
+func IsNotFound(err error) bool {
+	_, ok := err.(NotFoundError)
+	return ok
+}
+
+// DataPath returns the path of the API of the KV version 2 engine reading the secret at path, such as
+// secret/data/mongodb/my-rs/tls for secret/mongodb/my-rs/tls. The mount path of the engine is the first
+// segment of the path.
+func DataPath(path string) string {
+	path = strings.Trim(path, "/")
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) == 1 {
+		return parts[0] + "/data"
+	}
+	return parts[0] + "/data/" + parts[1]
+}
+
+// Client is the Reader of a Vault server
+type Client struct {
+	addr      string
+	authPath  string
+	namespace string
+	http      *http.Client
+	// requestJWT returns the token of a service account sent to Vault to log in
+	requestJWT TokenRequester
+	now        func() time.Time
+
+	mu     sync.Mutex
+	tokens map[Login]token
+}
+
+// token is the Vault token of a login, which doesn't expire if expiresAt is zero
+type token struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (t token) valid(now time.Time) bool {
+	return t.expiresAt.IsZero() || now.Before(t.expiresAt)
+}
+
+// NewClientFromEnv returns a Client configured with the variables of the Vault CLI, VAULT_ADDR,
+// VAULT_CACERT and VAULT_NAMESPACE, and with VAULT_AUTH_PATH, the mount path of the Kubernetes auth
+// method, kubernetes by default. The tokens of the service accounts are requested with requestJWT. The
+// boolean is false if VAULT_ADDR isn't set.
+func NewClientFromEnv(requestJWT TokenRequester) (*Client, bool, error) {
+	addr := os.Getenv(addrEnv)
+	if addr == "" {
+		return nil, false, nil
+	}
+	httpClient := &http.Client{Timeout: requestTimeout}
+	if caFile := os.Getenv(caCertEnv); caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, true, fmt.Errorf("error reading the CA certificate of Vault: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, true, fmt.Errorf("invalid CA certificate in %s", caFile)
+		}
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	authPath := os.Getenv(authPathEnv)
+	if authPath == "" {
+		authPath = defaultAuthPath
+	}
+	c := NewClient(addr, authPath, httpClient, requestJWT)
+	c.namespace = os.Getenv(namespaceEnv)
+	return c, true, nil
+}
+
+// NewClient returns a Client of the Vault server at addr, such as https://vault.vault:8200, logging in
+// with the Kubernetes auth method mounted at authPath and the tokens of the service accounts requested
+// with requestJWT
+func NewClient(addr, authPath string, httpClient *http.Client, requestJWT TokenRequester) *Client {
+	return &Client{
+		addr:       strings.TrimSuffix(addr, "/"),
+		authPath:   strings.Trim(authPath, "/"),
+		http:       httpClient,
+		requestJWT: requestJWT,
+		now:        time.Now,
+		tokens:     map[Login]token{},
+	}
+}
+
+// Addr returns the address of the Vault server
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Read returns the data of the KV version 2 secret at path, logged in as login
+func (c *Client) Read(login Login, path string) (map[string]string, error) {
+	t, err := c.token(login)
+	if err != nil {
+		return nil, err
+	}
+	data, status, err := c.read(t, path)
+	if status == http.StatusForbidden {
+		// the token may have been revoked, the login is done again once
+		c.forget(login)
+		if t, err = c.token(login); err != nil {
+			return nil, err
+		}
+		data, status, err = c.read(t, path)
+	}
+	if status == http.StatusNotFound || status == http.StatusForbidden {
+		return nil, NotFoundError{Path: path}
+	}
+	return data, err
+}
+
+// token returns the token of the login, logging in if it has none or it is about to expire
+func (c *Client) token(login Login) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.tokens[login]; ok && t.valid(c.now()) {
+		return t.value, nil
+	}
+	t, err := c.login(login)
+	if err != nil {
+		return "", err
+	}
+	c.tokens[login] = t
+	return t.value, nil
+}
+
+func (c *Client) forget(login Login) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, login)
+}
+
+// loginResponse is the response of the login of the Kubernetes auth method
+type loginResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+func (c *Client) login(login Login) (token, error) {
+	jwt, err := c.requestJWT(login.ServiceAccount)
+	if err != nil {
+		return token{}, fmt.Errorf("error requesting a token of service account %s: %s", login.ServiceAccount, err)
+	}
+	body, err := json.Marshal(map[string]string{"role": login.Role, "jwt": jwt})
+	if err != nil {
+		return token{}, err
+	}
+	resp := loginResponse{}
+	status, err := c.do(http.MethodPost, fmt.Sprintf("auth/%s/login", c.authPath), "", body, &resp)
+	if err != nil {
+		return token{}, fmt.Errorf("error logging in to Vault with role %s: %s", login.Role, err)
+	}
+	if status != http.StatusOK || resp.Auth.ClientToken == "" {
+		return token{}, fmt.Errorf("error logging in to Vault with role %s: status %d", login.Role, status)
+	}
+	return token{value: resp.Auth.ClientToken, expiresAt: expiresAt(c.now(), resp.Auth.LeaseDuration)}, nil
+}
+
+// expiresAt returns when a token of the lease, in seconds, is replaced: never for a lease of 0, which
+// doesn't expire
+func expiresAt(now time.Time, leaseSeconds int64) time.Time {
+	if leaseSeconds <= 0 {
+		return time.Time{}
+	}
+	lease := time.Duration(leaseSeconds) * time.Second
+	margin := tokenExpiryMargin
+	if margin > lease/2 {
+		margin = lease / 2
+	}
+	return now.Add(lease - margin)
+}
+
+// kvResponse is the response of the read of a KV version 2 secret
+type kvResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+func (c *Client) read(t, path string) (map[string]string, int, error) {
+	resp := kvResponse{}
+	status, err := c.do(http.MethodGet, DataPath(path), t, nil, &resp)
+	if err != nil || status != http.StatusOK {
+		if err == nil {
+			err = fmt.Errorf("status %d", status)
+		}
+		return nil, status, fmt.Errorf("error reading secret %s from Vault: %s", path, err)
+	}
+	data := map[string]string{}
+	for key, value := range resp.Data.Data {
+		s, ok := value.(string)
+		if !ok {
+			return nil, status, fmt.Errorf("the key %s of secret %s isn't a string", key, path)
+		}
+		data[key] = s
+	}
+	return data, status, nil
+}
+
+// errorResponse is the body of the responses of Vault to the failed requests
+type errorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// do sends the request to the API of Vault and decodes the response into out when it succeeds. The
+// errors returned by Vault are returned as an error along with the status.
+func (c *Client) do(method, path, t string, body []byte, out interface{}) (int, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s", c.addr, path), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if t != "" {
+		req.Header.Set(tokenHeader, t)
+	}
+	if c.namespace != "" {
+		req.Header.Set(namespaceHeader, c.namespace)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		errResp := errorResponse{}
+		if json.Unmarshal(respBody, &errResp) == nil && len(errResp.Errors) > 0 {
+			return resp.StatusCode, fmt.Errorf("status %d: %s", resp.StatusCode, strings.Join(errResp.Errors, ", "))
+		}
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.Unmarshal(respBody, out)
+}
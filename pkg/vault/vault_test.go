@@ -0,0 +1,197 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeVault is a Vault server with the Kubernetes auth method and a KV version 2 engine mounted at secret
+type fakeVault struct {
+	secrets map[string]map[string]interface{}
+	// policies are the paths of the API each role can read
+	policies map[string][]string
+	// bindings are the service accounts each role is bound to
+	bindings map[string]types.NamespacedName
+	// leaseDuration is the lease of the tokens, in seconds
+	leaseDuration int
+	tokens        map[string]string
+	logins        int
+}
+
+// serviceAccountToken is the fake token of the service account
+func serviceAccountToken(serviceAccount types.NamespacedName) string {
+	return serviceAccount.String() + "-token"
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/auth/kubernetes/login" {
+		body := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["jwt"] != serviceAccountToken(v.bindings[body["role"]]) || v.policies[body["role"]] == nil {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		v.logins++
+		t := body["role"] + "-token"
+		v.tokens[t] = body["role"]
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"auth": {"client_token": "%s", "lease_duration": %d}}`, t, v.leaseDuration)))
+		return
+	}
+	role, ok := v.tokens[r.Header.Get(tokenHeader)]
+	allowed := false
+	for _, path := range v.policies[role] {
+		allowed = allowed || "/v1/"+path == r.URL.Path
+	}
+	if !ok || !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+		return
+	}
+	secret, ok := v.secrets[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors": []}`))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": secret, "metadata": map[string]interface{}{"version": 1}}})
+}
+
+func newFakeVault() (*fakeVault, *Client, func()) {
+	v := &fakeVault{
+		secrets: map[string]map[string]interface{}{
+			"/v1/secret/data/mongodb/my-rs/tls": {"tls.crt": "cert", "tls.key": "key"},
+			"/v1/secret/data/mongodb/my-rs/ttl": {"ttl": 3600},
+		},
+		policies: map[string][]string{
+			"my-rs":    {"secret/data/mongodb/my-rs/tls", "secret/data/mongodb/my-rs/ttl", "secret/data/mongodb/my-rs/missing"},
+			"other-rs": {"secret/data/mongodb/other-rs/tls"},
+		},
+		bindings: map[string]types.NamespacedName{
+			"my-rs":    {Namespace: "my-ns", Name: "mongodb-kubernetes-operator"},
+			"other-rs": {Namespace: "other-ns", Name: "mongodb-kubernetes-operator"},
+		},
+		leaseDuration: 3600,
+		tokens:        map[string]string{},
+	}
+	server := httptest.NewServer(v)
+	c := NewClient(server.URL+"/", "kubernetes", server.Client(), func(serviceAccount types.NamespacedName) (string, error) {
+		return serviceAccountToken(serviceAccount), nil
+	})
+	return v, c, server.Close
+}
+
+// myRS is the login of the members of my-rs
+var myRS = Login{Role: "my-rs", ServiceAccount: types.NamespacedName{Namespace: "my-ns", Name: "mongodb-kubernetes-operator"}}
+
+func TestClient_Read(t *testing.T) {
+	v, c, stop := newFakeVault()
+	defer stop()
+
+	data, err := c.Read(myRS, "secret/mongodb/my-rs/tls")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"tls.crt": "cert", "tls.key": "key"}, data)
+	_, err = c.Read(myRS, "/secret/mongodb/my-rs/tls/")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v.logins, "the token is kept")
+
+	_, err = c.Read(myRS, "secret/mongodb/my-rs/missing")
+	assert.True(t, IsNotFound(err))
+	otherRS := Login{Role: "other-rs", ServiceAccount: types.NamespacedName{Namespace: "other-ns", Name: "mongodb-kubernetes-operator"}}
+	_, err = c.Read(otherRS, "secret/mongodb/my-rs/tls")
+	assert.True(t, IsNotFound(err), "the policies of the role don't allow reading it")
+	_, err = c.Read(myRS, "secret/mongodb/my-rs/ttl")
+	assert.EqualError(t, err, "the key ttl of secret secret/mongodb/my-rs/ttl isn't a string")
+
+	_, err = c.Read(Login{Role: "unknown", ServiceAccount: myRS.ServiceAccount}, "secret/mongodb/my-rs/tls")
+	assert.EqualError(t, err, "error logging in to Vault with role unknown: status 403: permission denied")
+}
+
+func TestClient_Read_OnlyWithTheServiceAccountOfTheRole(t *testing.T) {
+	_, c, stop := newFakeVault()
+	defer stop()
+
+	_, err := c.Read(Login{Role: "other-rs", ServiceAccount: myRS.ServiceAccount}, "secret/mongodb/other-rs/tls")
+	assert.EqualError(t, err, "error logging in to Vault with role other-rs: status 403: permission denied", "the role of another namespace can't be used")
+
+	c.requestJWT = func(serviceAccount types.NamespacedName) (string, error) {
+		return "", fmt.Errorf("serviceaccounts %q is forbidden", serviceAccount.Name)
+	}
+	_, err = c.Read(myRS, "secret/mongodb/my-rs/tls")
+	assert.EqualError(t, err, `error requesting a token of service account my-ns/mongodb-kubernetes-operator: serviceaccounts "mongodb-kubernetes-operator" is forbidden`)
+}
+
+func TestClient_Read_LogsInAgain(t *testing.T) {
+	v, c, stop := newFakeVault()
+	defer stop()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	_, err := c.Read(myRS, "secret/mongodb/my-rs/tls")
+	assert.NoError(t, err)
+	now = now.Add(time.Hour - tokenExpiryMargin)
+	_, err = c.Read(myRS, "secret/mongodb/my-rs/tls")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v.logins, "the token is replaced before it expires")
+
+	v.tokens = map[string]string{}
+	_, err = c.Read(myRS, "secret/mongodb/my-rs/tls")
+	assert.NoError(t, err, "a revoked token is replaced")
+	assert.Equal(t, 3, v.logins)
+}
+
+func TestClient_Read_TokensWithoutExpiry(t *testing.T) {
+	v, c, stop := newFakeVault()
+	defer stop()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	v.leaseDuration = 0
+	_, err := c.Read(myRS, "secret/mongodb/my-rs/tls")
+	assert.NoError(t, err)
+	now = now.Add(24 * time.Hour)
+	_, err = c.Read(myRS, "secret/mongodb/my-rs/tls")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v.logins, "a token with a lease of 0 doesn't expire")
+}
+
+func TestExpiresAt(t *testing.T) {
+	now := time.Now()
+	assert.True(t, expiresAt(now, 0).IsZero())
+	assert.Equal(t, now.Add(time.Hour-tokenExpiryMargin), expiresAt(now, 3600))
+	assert.Equal(t, now.Add(10*time.Second), expiresAt(now, 20), "the margin is at most half of the lease")
+}
+
+func TestDataPath(t *testing.T) {
+	assert.Equal(t, "secret/data/mongodb/my-rs/tls", DataPath("secret/mongodb/my-rs/tls"))
+	assert.Equal(t, "kv/data/tls", DataPath("/kv/tls"))
+	assert.Equal(t, "kv/data", DataPath("kv"))
+}
+
+func TestNewTokenRequester(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateAction)
+		tr := create.GetObject().(*authenticationv1.TokenRequest)
+		assert.Equal(t, "token", create.GetSubresource())
+		assert.Equal(t, "my-ns", create.GetNamespace())
+		assert.Equal(t, serviceAccountTokenExpiration, *tr.Spec.ExpirationSeconds)
+		tr.Status.Token = "my-token"
+		return true, tr, nil
+	})
+
+	jwt, err := NewTokenRequester(clientset.CoreV1())(myRS.ServiceAccount)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-token", jwt)
+}
@@ -26,14 +26,28 @@ def _load_operator_role_binding() -> Dict:
     return load_yaml_from_file("deploy/role_binding.yaml")
 
 
+def _load_operator_cluster_role() -> Dict:
+    return load_yaml_from_file("deploy/cluster_role.yaml")
+
+
+def _load_operator_cluster_role_binding(namespace: str) -> Dict:
+    cluster_role_binding = load_yaml_from_file("deploy/cluster_role_binding.yaml")
+    cluster_role_binding["subjects"][0]["namespace"] = namespace
+    return cluster_role_binding
+
+
 def _load_operator_deployment(operator_image: str) -> Dict:
     operator = load_yaml_from_file("deploy/operator.yaml")
     operator["spec"]["template"]["spec"]["containers"][0]["image"] = operator_image
     return operator
 
 
-def _load_mongodb_crd() -> Dict:
-    return load_yaml_from_file("deploy/crds/mongodb.com_mongodb_crd.yaml")
+CRD_FILES = [
+    "deploy/crds/mongodb.com_mongodb_crd.yaml",
+    "deploy/crds/mongodb.com_mongodbbackups_crd.yaml",
+    "deploy/crds/mongodb.com_mongodbrestores_crd.yaml",
+    "deploy/crds/mongodb.com_clustermongodbroles_crd.yaml",
+]
 
 
 def load_yaml_from_file(path: str) -> Dict:
@@ -45,31 +59,35 @@ def _ensure_crds() -> None:
     """
     ensure_crds makes sure that all the required CRDs have been created
     """
-    crdv1 = client.ApiextensionsV1beta1Api()
-    crd = _load_mongodb_crd()
+    crdv1 = client.ApiextensionsV1Api()
+    for crd_file in CRD_FILES:
+        crd = load_yaml_from_file(crd_file)
+        name = crd["metadata"]["name"]
 
-    k8s_conditions.ignore_if_doesnt_exist(
-        lambda: crdv1.delete_custom_resource_definition("mongodb.mongodb.com")
-    )
+        k8s_conditions.ignore_if_doesnt_exist(
+            lambda: crdv1.delete_custom_resource_definition(name)
+        )
 
-    # Make sure that the CRD has being deleted before trying to create it again
-    if not k8s_conditions.wait(
-        lambda: crdv1.list_custom_resource_definition(
-            field_selector="metadata.name==mongodb.mongodb.com"
-        ),
-        lambda crd_list: len(crd_list.items) == 0,
-        timeout=5,
-        sleep_time=0.5,
-    ):
-        raise Exception("Execution timed out while waiting for the CRD to be deleted")
-
-    # TODO: fix this, when calling create_custom_resource_definition, we get the error
-    # ValueError("Invalid value for `conditions`, must not be `None`")
-    # but the crd is still successfully created
-    try:
-        crdv1.create_custom_resource_definition(body=crd)
-    except ValueError as e:
-        pass
+        # Make sure that the CRD has being deleted before trying to create it again
+        if not k8s_conditions.wait(
+            lambda: crdv1.list_custom_resource_definition(
+                field_selector=f"metadata.name=={name}"
+            ),
+            lambda crd_list: len(crd_list.items) == 0,
+            timeout=5,
+            sleep_time=0.5,
+        ):
+            raise Exception(
+                "Execution timed out while waiting for the CRD to be deleted"
+            )
+
+        # TODO: fix this, when calling create_custom_resource_definition, we get the error
+        # ValueError("Invalid value for `conditions`, must not be `None`")
+        # but the crd is still successfully created
+        try:
+            crdv1.create_custom_resource_definition(body=crd)
+        except ValueError as e:
+            pass
 
     print("Ensured CRDs")
 
@@ -104,6 +122,14 @@ def deploy_operator() -> None:
             dev_config.namespace, _load_operator_role_binding()
         )
     )
+    k8s_conditions.ignore_if_already_exists(
+        lambda: rbacv1.create_cluster_role(_load_operator_cluster_role())
+    )
+    k8s_conditions.ignore_if_already_exists(
+        lambda: rbacv1.create_cluster_role_binding(
+            _load_operator_cluster_role_binding(dev_config.namespace)
+        )
+    )
     k8s_conditions.ignore_if_already_exists(
         lambda: corev1.create_namespaced_service_account(
             dev_config.namespace, _load_operator_service_account()
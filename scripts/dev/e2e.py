@@ -148,6 +148,7 @@ def create_test_runner_pod(
     tag: str,
     perform_cleanup: str,
     test_runner_image_name: str,
+    environment: str,
 ) -> None:
     """
     create_test_runner_pod creates the pod which will run all of the tests.
@@ -155,7 +156,7 @@ def create_test_runner_pod(
     dev_config = load_config(config_file)
     corev1 = client.CoreV1Api()
     pod_body = _get_testrunner_pod_body(
-        test, config_file, tag, perform_cleanup, test_runner_image_name
+        test, config_file, tag, perform_cleanup, test_runner_image_name, environment
     )
 
     if not k8s_conditions.wait(
@@ -199,6 +200,7 @@ def _get_testrunner_pod_body(
     tag: str,
     perform_cleanup: str,
     test_runner_image_name: str,
+    environment: str,
 ) -> Dict:
     dev_config = load_config(config_file)
     return {
@@ -223,6 +225,7 @@ def _get_testrunner_pod_body(
                         f"--test={test}",
                         f"--namespace={dev_config.namespace}",
                         f"--performCleanup={perform_cleanup}",
+                        f"--environment={environment}",
                     ],
                 }
             ],
@@ -259,6 +262,12 @@ def parse_args() -> argparse.Namespace:
         help="Cleanup the context after executing the tests",
         action="store_true",
     )
+    parser.add_argument(
+        "--environment",
+        help="Environment of the cluster the tests run against",
+        choices=["kind", "openshift", "existing"],
+        default="existing",
+    )
     parser.add_argument("--config_file", help="Path to the config file")
     return parser.parse_args()
 
@@ -298,7 +307,12 @@ def prepare_and_run_testrunner(args: argparse.Namespace, dev_config: DevConfig)
     _prepare_testrunner_environment(args.config_file)
 
     create_test_runner_pod(
-        args.test, args.config_file, args.tag, args.perform_cleanup, test_runner_name,
+        args.test,
+        args.config_file,
+        args.tag,
+        args.perform_cleanup,
+        test_runner_name,
+        args.environment,
     )
     corev1 = client.CoreV1Api()
 
@@ -0,0 +1,16 @@
+#!/usr/bin/env bash
+set -Eeou pipefail
+
+# generates the CustomResourceDefinitions of deploy/crds from the types of pkg/apis with
+# controller-gen, which must be in the PATH:
+# go install sigs.k8s.io/controller-tools/cmd/controller-gen@v0.17.3
+
+output="$(mktemp -d)"
+trap 'rm -rf "${output}"' EXIT
+
+controller-gen crd:crdVersions=v1 paths=./pkg/apis/... output:crd:dir="${output}"
+
+for crd in "${output}"/*.yaml; do
+    name="$(basename "${crd}" .yaml)"
+    cp "${crd}" "deploy/crds/${name}_crd.yaml"
+done
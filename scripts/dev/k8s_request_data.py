@@ -5,7 +5,7 @@ from typing import Optional, List, Dict
 
 
 def get_crds() -> Optional[Dict]:
-    crdv1 = client.ApiextensionsV1beta1Api()
+    crdv1 = client.ApiextensionsV1Api()
     try:
         crd = crdv1.list_custom_resource_definition(pretty="true")
     except ApiException as e:
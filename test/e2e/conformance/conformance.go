@@ -0,0 +1,69 @@
+// Package conformance holds the suites checking that the operator works on a cluster. They can be
+// run against any cluster the operator is deployed to, from a test package with its own TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		f.MainEntry(m)
+//	}
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.ReplicaSet(t)
+//		conformance.ReplicaSetTLS(t)
+//	}
+//
+// The environment of the cluster is selected with E2E_ENVIRONMENT, see the framework package.
+package conformance
+
+import (
+	"testing"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/framework"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/mongodbtests"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/tlstests"
+	f "github.com/operator-framework/operator-sdk/pkg/test"
+)
+
+// ReplicaSet deploys a replica set with SCRAM authentication and checks that it can be connected to
+func ReplicaSet(t *testing.T) {
+	ctx, shouldCleanup := framework.Setup(t)
+	if shouldCleanup {
+		defer ctx.Cleanup()
+	}
+
+	mdb, user := framework.NewTestMongoDB("mdb0")
+	createPassword(t, user, ctx)
+
+	t.Run("Create MongoDB Resource", mongodbtests.CreateMongoDBResource(&mdb, ctx))
+	t.Run("Basic tests", mongodbtests.BasicFunctionality(&mdb))
+	t.Run("Test Basic Connectivity", mongodbtests.Connectivity(&mdb))
+	t.Run("AutomationConfig has the correct version", mongodbtests.AutomationConfigVersionHasTheExpectedVersion(&mdb, 1))
+}
+
+// ReplicaSetTLS deploys a replica set requiring TLS and checks that it can only be connected to over TLS
+func ReplicaSetTLS(t *testing.T) {
+	ctx, shouldCleanup := framework.Setup(t)
+	if shouldCleanup {
+		defer ctx.Cleanup()
+	}
+
+	mdb, user := framework.NewTestMongoDB("mdb-tls")
+	mdb.Spec.Security.TLS = framework.NewTestTLSConfig(false)
+	createPassword(t, user, ctx)
+
+	if err := framework.CreateTLSResources(mdb.Namespace, ctx); err != nil {
+		t.Fatalf("Failed to set up TLS resources: %+v", err)
+	}
+
+	t.Run("Create MongoDB Resource", mongodbtests.CreateMongoDBResource(&mdb, ctx))
+	t.Run("Basic tests", mongodbtests.BasicFunctionality(&mdb))
+	t.Run("Wait for TLS to be enabled", tlstests.WaitForTLSMode(&mdb, "requireSSL"))
+	t.Run("Test Basic TLS Connectivity", tlstests.ConnectivityWithTLS(&mdb))
+	t.Run("Test TLS required", tlstests.ConnectivityWithoutTLSShouldFail(&mdb))
+}
+
+// createPassword creates the Secret holding a random password of the user
+func createPassword(t *testing.T, user mdbv1.MongoDBUser, ctx *f.Context) {
+	if _, err := framework.GeneratePasswordForUser(user, ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,9 +4,8 @@ import (
 	"testing"
 	"time"
 
-	e2eutil "github.com/mongodb/mongodb-kubernetes-operator/test/e2e"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/framework"
 	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/mongodbtests"
-	setup "github.com/mongodb/mongodb-kubernetes-operator/test/e2e/setup"
 	f "github.com/operator-framework/operator-sdk/pkg/test"
 )
 
@@ -16,15 +15,15 @@ func TestMain(m *testing.M) {
 
 func TestFeatureCompatibilityVersion(t *testing.T) {
 
-	ctx, shouldCleanup := setup.InitTest(t)
+	ctx, shouldCleanup := framework.Setup(t)
 
 	if shouldCleanup {
 		defer ctx.Cleanup()
 	}
 
-	mdb, user := e2eutil.NewTestMongoDB("mdb0")
+	mdb, user := framework.NewTestMongoDB("mdb0")
 
-	_, err := setup.GeneratePasswordForUser(user, ctx)
+	_, err := framework.GeneratePasswordForUser(user, ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
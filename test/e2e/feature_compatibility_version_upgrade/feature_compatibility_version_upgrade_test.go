@@ -5,9 +5,8 @@ import (
 	"time"
 
 	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
-	e2eutil "github.com/mongodb/mongodb-kubernetes-operator/test/e2e"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/framework"
 	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/mongodbtests"
-	setup "github.com/mongodb/mongodb-kubernetes-operator/test/e2e/setup"
 	f "github.com/operator-framework/operator-sdk/pkg/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,15 +17,15 @@ func TestMain(m *testing.M) {
 
 func TestFeatureCompatibilityVersionUpgrade(t *testing.T) {
 
-	ctx, shouldCleanup := setup.InitTest(t)
+	ctx, shouldCleanup := framework.Setup(t)
 
 	if shouldCleanup {
 		defer ctx.Cleanup()
 	}
 
-	mdb, user := e2eutil.NewTestMongoDB("mdb0")
+	mdb, user := framework.NewTestMongoDB("mdb0")
 
-	_, err := setup.GeneratePasswordForUser(user, ctx)
+	_, err := framework.GeneratePasswordForUser(user, ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -48,7 +47,7 @@ func TestFeatureCompatibilityVersionUpgrade(t *testing.T) {
 	t.Run("MongoDB is reachable", mongodbtests.IsReachableDuring(&mdb, time.Second*10,
 		func() {
 			t.Run("Test FCV can be upgraded", func(t *testing.T) {
-				err := e2eutil.UpdateMongoDBResource(&mdb, func(db *mdbv1.MongoDB) {
+				err := framework.UpdateMongoDBResource(&mdb, func(db *mdbv1.MongoDB) {
 					db.Spec.FeatureCompatibilityVersion = "4.2"
 				})
 				assert.NoError(t, err)
@@ -0,0 +1,53 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/connectionstring"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// MongoURI returns the connection string listing the members of the resource in the cluster
+// domain of the environment. TLS isn't set in the connection string, so that it can be configured
+// with the options of the client.
+func MongoURI(mdb mdbv1.MongoDB) string {
+	return fmt.Sprintf("mongodb://%s", strings.Join(connectionstring.Hosts(mdb, currentEnvironment().ClusterDomain()), ","))
+}
+
+// Connect performs a connectivity check by initializing a mongo client
+// and inserting a document into the MongoDB resource. Custom client
+// options can be passed, for example to configure TLS.
+func Connect(mdb *mdbv1.MongoDB, opts *options.ClientOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	mongoClient, err := mongo.Connect(ctx, opts.ApplyURI(MongoURI(*mdb)))
+	if err != nil {
+		return err
+	}
+	defer mongoClient.Disconnect(ctx) //nolint
+
+	return wait.Poll(time.Second*1, time.Second*30, func() (done bool, err error) {
+		collection := mongoClient.Database("testing").Collection("numbers")
+		_, err = collection.InsertOne(ctx, bson.M{"name": "pi", "value": 3.14159})
+		if err != nil {
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// ConnectWithTLS performs the connectivity check of Connect over TLS, trusting the CA of the fixtures
+func ConnectWithTLS(mdb *mdbv1.MongoDB) error {
+	tlsConfig, err := ClientTLSConfig()
+	if err != nil {
+		return err
+	}
+	return Connect(mdb, options.Client().SetTLSConfig(tlsConfig))
+}
@@ -0,0 +1,163 @@
+package framework
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// EnvironmentEnv selects the environment the tests run in, one of the registered
+	// environments. Defaults to "existing"
+	EnvironmentEnv = "E2E_ENVIRONMENT"
+	// StorageClassEnv overrides the StorageClass of the volumes of the test resources
+	StorageClassEnv = "E2E_STORAGE_CLASS"
+	// ClusterDomainEnv overrides the cluster domain used to connect to the test resources
+	ClusterDomainEnv = "E2E_CLUSTER_DOMAIN"
+	// TimeoutMultiplierEnv multiplies the time the tests wait for, on slow clusters
+	TimeoutMultiplierEnv = "E2E_TIMEOUT_MULTIPLIER"
+
+	defaultClusterDomain = "cluster.local"
+)
+
+// Environment adapts the tests to the cluster they run against
+type Environment interface {
+	// Name is the name the environment is selected by
+	Name() string
+	// ClusterDomain is the domain of the Services of the cluster
+	ClusterDomain() string
+	// Timeout scales a duration the tests wait for to the cluster
+	Timeout(d time.Duration) time.Duration
+	// Configure adapts a MongoDB resource of the tests before it's created
+	Configure(mdb *mdbv1.MongoDB)
+}
+
+var (
+	environmentsMutex sync.Mutex
+	environments      = map[string]func() Environment{
+		"kind":      Kind,
+		"openshift": OpenShift,
+		"existing":  ExistingCluster,
+	}
+)
+
+// RegisterEnvironment makes an environment available to be selected with E2E_ENVIRONMENT, so that
+// the suites can be run against the clusters needing their own settings
+func RegisterEnvironment(name string, newEnvironment func() Environment) {
+	environmentsMutex.Lock()
+	defer environmentsMutex.Unlock()
+	environments[name] = newEnvironment
+}
+
+// CurrentEnvironment returns the environment selected with E2E_ENVIRONMENT
+func CurrentEnvironment() (Environment, error) {
+	environmentsMutex.Lock()
+	defer environmentsMutex.Unlock()
+
+	name, ok := os.LookupEnv(EnvironmentEnv)
+	if !ok {
+		name = "existing"
+	}
+	newEnvironment, ok := environments[name]
+	if !ok {
+		names := make([]string, 0, len(environments))
+		for n := range environments {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf(`unknown environment "%s", must be one of %s`, name, strings.Join(names, ", "))
+	}
+	return newEnvironment(), nil
+}
+
+// environment is configured from the environment variables of the tests, on top of the defaults
+// of the kind of cluster
+type environment struct {
+	name              string
+	storageClass      string
+	clusterDomain     string
+	timeoutMultiplier float64
+	configure         func(*mdbv1.MongoDB)
+}
+
+func newEnvironment(name string, defaults environment) environment {
+	env := defaults
+	env.name = name
+	if storageClass, ok := os.LookupEnv(StorageClassEnv); ok {
+		env.storageClass = storageClass
+	}
+	if clusterDomain, ok := os.LookupEnv(ClusterDomainEnv); ok {
+		env.clusterDomain = clusterDomain
+	}
+	if env.clusterDomain == "" {
+		env.clusterDomain = defaultClusterDomain
+	}
+	if multiplier, err := strconv.ParseFloat(os.Getenv(TimeoutMultiplierEnv), 64); err == nil && multiplier > 0 {
+		env.timeoutMultiplier = multiplier
+	}
+	if env.timeoutMultiplier == 0 {
+		env.timeoutMultiplier = 1
+	}
+	return env
+}
+
+func (e environment) Name() string {
+	return e.name
+}
+
+func (e environment) ClusterDomain() string {
+	return e.clusterDomain
+}
+
+func (e environment) Timeout(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * e.timeoutMultiplier)
+}
+
+func (e environment) Configure(mdb *mdbv1.MongoDB) {
+	if e.storageClass != "" && mdb.Spec.Storage.Data.StorageClassName == nil {
+		storageClass := e.storageClass
+		mdb.Spec.Storage.Data.StorageClassName = &storageClass
+	}
+	if e.configure != nil {
+		e.configure(mdb)
+	}
+}
+
+// Kind is a local kind cluster, with its "standard" StorageClass
+func Kind() Environment {
+	return newEnvironment("kind", environment{storageClass: "standard"})
+}
+
+// OpenShift is an OpenShift cluster. The Pods run with the restricted SecurityContextConstraints,
+// which assign the user and the group of the Pods, so the fsGroup set by the operator is removed.
+// The Pods usually take longer to be scheduled and started, so the tests wait twice as long.
+func OpenShift() Environment {
+	return newEnvironment("openshift", environment{
+		timeoutMultiplier: 2,
+		configure:         withoutPodSecurityContext,
+	})
+}
+
+// ExistingCluster is the cluster of the kubeconfig of the tests, configured only with the
+// environment variables
+func ExistingCluster() Environment {
+	return newEnvironment("existing", environment{})
+}
+
+// withoutPodSecurityContext removes the security context of the Pods with spec.statefulSet, unless
+// the resource overrides the StatefulSet itself
+func withoutPodSecurityContext(mdb *mdbv1.MongoDB) {
+	if mdb.Spec.StatefulSetConfiguration != nil {
+		return
+	}
+	mdb.Spec.StatefulSetConfiguration = &mdbv1.StatefulSetConfiguration{
+		Spec: runtime.RawExtension{Raw: []byte(`{"template": {"spec": {"securityContext": null}}}`)},
+	}
+}
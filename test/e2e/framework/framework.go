@@ -0,0 +1,150 @@
+// Package framework runs the e2e tests of the operator against a cluster: it creates the test
+// resources, adapts them to the environment of the cluster, and waits for and connects to them.
+// The suites of the test/e2e directory are built with it, and so can be other suites checking
+// that the operator works on a given cluster.
+package framework
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/apis"
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/util/generate"
+	f "github.com/operator-framework/operator-sdk/pkg/test"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	performCleanup = "PERFORM_CLEANUP"
+)
+
+// Setup prepares a test: it registers the types of the operator and selects the environment.
+// The boolean is whether the test resources must be deleted once the test is done.
+func Setup(t *testing.T) (*f.Context, bool) {
+	ctx := f.NewContext(t)
+
+	if err := registerTypesWithFramework(&mdbv1.MongoDB{}); err != nil {
+		t.Fatal(err)
+	}
+	env, err := CurrentEnvironment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Running in the %s environment", env.Name())
+
+	clean := os.Getenv(performCleanup)
+
+	return ctx, clean == "True"
+}
+
+func registerTypesWithFramework(newTypes ...runtime.Object) error {
+	for _, newType := range newTypes {
+		if err := f.AddToFrameworkScheme(apis.AddToScheme, newType); err != nil {
+			return fmt.Errorf("failed to add custom resource type %s to framework scheme: %v", newType.GetObjectKind(), err)
+		}
+	}
+	return nil
+}
+
+// currentEnvironment returns the environment selected with E2E_ENVIRONMENT, which was validated by Setup
+func currentEnvironment() Environment {
+	env, err := CurrentEnvironment()
+	if err != nil {
+		panic(err)
+	}
+	return env
+}
+
+// UpdateMongoDBResource applies the provided function to the most recent version of the MongoDB resource
+// and retries when there are conflicts
+func UpdateMongoDBResource(original *mdbv1.MongoDB, updateFunc func(*mdbv1.MongoDB)) error {
+	err := f.Global.Client.Get(context.TODO(), types.NamespacedName{Name: original.Name, Namespace: original.Namespace}, original)
+	if err != nil {
+		return err
+	}
+
+	updateFunc(original)
+
+	return f.Global.Client.Update(context.TODO(), original)
+}
+
+// NewTestMongoDB returns a replica set with SCRAM authentication and one user, configured for the
+// current environment
+func NewTestMongoDB(name string) (mdbv1.MongoDB, mdbv1.MongoDBUser) {
+	mdb := mdbv1.MongoDB{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: f.Global.OperatorNamespace,
+		},
+		Spec: mdbv1.MongoDBSpec{
+			Members:                     3,
+			Type:                        "ReplicaSet",
+			Version:                     "4.0.6",
+			FeatureCompatibilityVersion: "4.0",
+			Security: mdbv1.Security{
+				Authentication: mdbv1.Authentication{
+					Modes: []mdbv1.AuthMode{"SCRAM"},
+				},
+			},
+			Users: []mdbv1.MongoDBUser{
+				{
+					Name: fmt.Sprintf("%s-user", name),
+					DB:   "admin",
+					PasswordSecretRef: mdbv1.SecretKeyReference{
+						Key:  fmt.Sprintf("%s-password", name),
+						Name: fmt.Sprintf("%s-password-secret", name),
+					},
+					Roles: []mdbv1.Role{
+						// roles on testing db for general connectivity
+						{
+							DB:   "testing",
+							Name: "readWrite",
+						},
+						{
+							DB:   "testing",
+							Name: "clusterAdmin",
+						},
+						// admin roles for reading FCV
+						{
+							DB:   "admin",
+							Name: "readWrite",
+						},
+						{
+							DB:   "admin",
+							Name: "clusterAdmin",
+						},
+					},
+				},
+			},
+		},
+	}
+	currentEnvironment().Configure(&mdb)
+	return mdb, mdb.Spec.Users[0]
+}
+
+// GeneratePasswordForUser will create a secret with a password for the given user
+func GeneratePasswordForUser(mdbu mdbv1.MongoDBUser, ctx *f.Context) (string, error) {
+	passwordKey := mdbu.PasswordSecretRef.Key
+	if passwordKey == "" {
+		passwordKey = "password"
+	}
+
+	password, err := generate.RandomFixedLengthStringOfSize(20)
+	if err != nil {
+		return "", err
+	}
+
+	passwordSecret := secret.Builder().
+		SetName(mdbu.PasswordSecretRef.Name).
+		SetNamespace(f.Global.OperatorNamespace).
+		SetField(passwordKey, password).
+		Build()
+
+	return password, f.Global.Client.Create(context.TODO(), &passwordSecret, &f.CleanupOptions{TestContext: ctx})
+}
@@ -0,0 +1,132 @@
+package framework
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/configmap"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
+	f "github.com/operator-framework/operator-sdk/pkg/test"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// TLSFixturesEnv overrides the directory of the CA and the server certificates of the tests
+	TLSFixturesEnv = "E2E_TLS_FIXTURES"
+
+	defaultTLSFixtures = "testdata/tls"
+)
+
+// TLSFixtures is the directory holding the CA and the server certificates and keys of the tests:
+// ca.crt, server.crt and server.key, and server_rotated.crt and server_rotated.key which replace
+// them when the certificate is rotated. The server certificates must be valid for the hosts of
+// the test resources.
+func TLSFixtures() string {
+	if dir, ok := os.LookupEnv(TLSFixturesEnv); ok {
+		return dir
+	}
+	return defaultTLSFixtures
+}
+
+func readTLSFixture(name string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(TLSFixtures(), name))
+	if err != nil {
+		return "", fmt.Errorf("error reading TLS fixture: %s", err)
+	}
+	return string(data), nil
+}
+
+// NewTestTLSConfig returns the TLS configuration of the test resources, with the certificates
+// created by CreateTLSResources
+func NewTestTLSConfig(optional bool) mdbv1.TLS {
+	return mdbv1.TLS{
+		Enabled:  true,
+		Optional: optional,
+		CertificateKeySecret: mdbv1.LocalObjectReference{
+			Name: "test-tls-secret",
+		},
+		CaConfigMap: mdbv1.LocalObjectReference{
+			Name: "test-tls-ca",
+		},
+	}
+}
+
+// CreateTLSResources will setup the CA ConfigMap and cert-key Secret necessary for TLS
+func CreateTLSResources(namespace string, ctx *f.Context) error {
+	tlsConfig := NewTestTLSConfig(false)
+
+	// Create CA ConfigMap
+	ca, err := readTLSFixture("ca.crt")
+	if err != nil {
+		return err
+	}
+
+	caConfigMap := configmap.Builder().
+		SetName(tlsConfig.CaConfigMap.Name).
+		SetNamespace(namespace).
+		SetField("ca.crt", ca).
+		Build()
+
+	err = f.Global.Client.Create(context.TODO(), &caConfigMap, &f.CleanupOptions{TestContext: ctx})
+	if err != nil {
+		return err
+	}
+
+	certKeySecret, err := serverCertificateSecret(tlsConfig.CertificateKeySecret.Name, namespace, "server")
+	if err != nil {
+		return err
+	}
+	return f.Global.Client.Create(context.TODO(), &certKeySecret, &f.CleanupOptions{TestContext: ctx})
+}
+
+// RotateServerCertificate replaces the server certificate of the resource with the rotated one of
+// the fixtures
+func RotateServerCertificate(mdb *mdbv1.MongoDB) error {
+	certKeySecret, err := serverCertificateSecret(mdb.Spec.Security.TLS.CertificateKeySecret.Name, mdb.Namespace, "server_rotated")
+	if err != nil {
+		return err
+	}
+	return f.Global.Client.Update(context.TODO(), &certKeySecret)
+}
+
+// serverCertificateSecret returns the Secret holding the certificate and the key of the fixtures
+// with the given name
+func serverCertificateSecret(name, namespace, fixture string) (corev1.Secret, error) {
+	cert, err := readTLSFixture(fixture + ".crt")
+	if err != nil {
+		return corev1.Secret{}, err
+	}
+	key, err := readTLSFixture(fixture + ".key")
+	if err != nil {
+		return corev1.Secret{}, err
+	}
+	return secret.Builder().
+		SetName(name).
+		SetNamespace(namespace).
+		SetField("tls.crt", cert).
+		SetField("tls.key", key).
+		Build(), nil
+}
+
+// ClientTLSConfig returns the TLS configuration of the clients, trusting the CA of the fixtures
+func ClientTLSConfig() (*tls.Config, error) {
+	caPEM, err := readTLSFixture("ca.crt")
+	if err != nil {
+		return nil, err
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, fmt.Errorf("no certificate found in %s", filepath.Join(TLSFixtures(), "ca.crt"))
+	}
+
+	return &tls.Config{
+		RootCAs: caPool,
+	}, nil
+}
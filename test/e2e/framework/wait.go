@@ -1,4 +1,4 @@
-package e2eutil
+package framework
 
 import (
 	"context"
@@ -11,25 +11,17 @@ import (
 	f "github.com/operator-framework/operator-sdk/pkg/test"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// UpdateMongoDBResource applies the provided function to the most recent version of the MongoDB resource
-// and retries when there are conflicts
-func UpdateMongoDBResource(original *mdbv1.MongoDB, updateFunc func(*mdbv1.MongoDB)) error {
-	err := f.Global.Client.Get(context.TODO(), types.NamespacedName{Name: original.Name, Namespace: original.Namespace}, original)
-	if err != nil {
-		return err
-	}
-
-	updateFunc(original)
-
-	return f.Global.Client.Update(context.TODO(), original)
-}
+// The timeouts are scaled by the environment
+const (
+	DefaultRetryInterval = time.Second * 15
+	DefaultTimeout       = time.Minute * 5
+)
 
 // WaitForConfigMapToExist waits until a ConfigMap of the given name exists
 // using the provided retryInterval and timeout
@@ -40,23 +32,37 @@ func WaitForConfigMapToExist(cmName string, retryInterval, timeout time.Duration
 
 // WaitForMongoDBToReachPhase waits until the given MongoDB resource reaches the expected phase
 func WaitForMongoDBToReachPhase(t *testing.T, mdb *mdbv1.MongoDB, phase mdbv1.Phase, retryInterval, timeout time.Duration) error {
-	return waitForMongoDBCondition(mdb, retryInterval, timeout, func(db mdbv1.MongoDB) bool {
+	return WaitForMongoDBCondition(mdb, retryInterval, timeout, func(db mdbv1.MongoDB) bool {
 		t.Logf("current phase: %s, waiting for phase: %s", db.Status.Phase, phase)
 		return db.Status.Phase == phase
 	})
 }
 
-// waitForMongoDBCondition polls and waits for a given condition to be true
-func waitForMongoDBCondition(mdb *mdbv1.MongoDB, retryInterval, timeout time.Duration, condition func(mdbv1.MongoDB) bool) error {
+// WaitForMongoDBToBeRunning waits until the given MongoDB resource reaches the Running phase for
+// the generation it has now, so that a change which was just made isn't reported as rolled out
+func WaitForMongoDBToBeRunning(t *testing.T, mdb *mdbv1.MongoDB) error {
+	generation := mdb.Generation
+	return WaitForMongoDBCondition(mdb, DefaultRetryInterval, DefaultTimeout, func(db mdbv1.MongoDB) bool {
+		t.Logf("current phase: %s (generation %d), waiting for phase: %s", db.Status.Phase, db.Status.ObservedGeneration, mdbv1.Running)
+		return db.Status.Phase == mdbv1.Running && db.Status.ObservedGeneration >= generation
+	})
+}
+
+// WaitForMongoDBCondition polls the MongoDB resource until the condition is true
+func WaitForMongoDBCondition(mdb *mdbv1.MongoDB, retryInterval, timeout time.Duration, condition func(mdbv1.MongoDB) bool) error {
 	mdbNew := mdbv1.MongoDB{}
-	return wait.Poll(retryInterval, timeout, func() (done bool, err error) {
-		err = f.Global.Client.Get(context.TODO(), types.NamespacedName{Name: mdb.Name, Namespace: f.Global.OperatorNamespace}, &mdbNew)
+	err := wait.Poll(retryInterval, currentEnvironment().Timeout(timeout), func() (done bool, err error) {
+		err = f.Global.Client.Get(context.TODO(), types.NamespacedName{Name: mdb.Name, Namespace: mdb.Namespace}, &mdbNew)
 		if err != nil {
 			return false, err
 		}
 		ready := condition(mdbNew)
 		return ready, nil
 	})
+	if err != nil {
+		return fmt.Errorf("error waiting for MongoDB %s/%s, last phase %s: %s", mdb.Namespace, mdb.Name, mdbNew.Status.Phase, err)
+	}
+	return nil
 }
 
 // WaitForStatefulSetToExist waits until a StatefulSet of the given name exists
@@ -89,8 +95,8 @@ func waitForStatefulSetCondition(t *testing.T, mdb *mdbv1.MongoDB, retryInterval
 	}
 
 	sts := appsv1.StatefulSet{}
-	return wait.Poll(retryInterval, timeout, func() (done bool, err error) {
-		err = f.Global.Client.Get(context.TODO(), types.NamespacedName{Name: mdb.Name, Namespace: f.Global.OperatorNamespace}, &sts)
+	return wait.Poll(retryInterval, currentEnvironment().Timeout(timeout), func() (done bool, err error) {
+		err = f.Global.Client.Get(context.TODO(), types.NamespacedName{Name: mdb.Name, Namespace: mdb.Namespace}, &sts)
 		if err != nil {
 			return false, err
 		}
@@ -103,7 +109,7 @@ func waitForStatefulSetCondition(t *testing.T, mdb *mdbv1.MongoDB, retryInterval
 // waitForRuntimeObjectToExist waits until a runtime.Object of the given name exists
 // using the provided retryInterval and timeout provided.
 func waitForRuntimeObjectToExist(name string, retryInterval, timeout time.Duration, obj runtime.Object) error {
-	return wait.Poll(retryInterval, timeout, func() (done bool, err error) {
+	return wait.Poll(retryInterval, currentEnvironment().Timeout(timeout), func() (done bool, err error) {
 		err = f.Global.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: f.Global.OperatorNamespace}, obj)
 		if err != nil {
 			return false, client.IgnoreNotFound(err)
@@ -111,67 +117,3 @@ func waitForRuntimeObjectToExist(name string, retryInterval, timeout time.Durati
 		return true, nil
 	})
 }
-
-func NewTestMongoDB(name string) (mdbv1.MongoDB, mdbv1.MongoDBUser) {
-	mdb := mdbv1.MongoDB{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: f.Global.OperatorNamespace,
-		},
-		Spec: mdbv1.MongoDBSpec{
-			Members:                     3,
-			Type:                        "ReplicaSet",
-			Version:                     "4.0.6",
-			FeatureCompatibilityVersion: "4.0",
-			Security: mdbv1.Security{
-				Authentication: mdbv1.Authentication{
-					Modes: []mdbv1.AuthMode{"SCRAM"},
-				},
-			},
-			Users: []mdbv1.MongoDBUser{
-				{
-					Name: fmt.Sprintf("%s-user", name),
-					DB:   "admin",
-					PasswordSecretRef: mdbv1.SecretKeyReference{
-						Key:  fmt.Sprintf("%s-password", name),
-						Name: fmt.Sprintf("%s-password-secret", name),
-					},
-					Roles: []mdbv1.Role{
-						// roles on testing db for general connectivity
-						{
-							DB:   "testing",
-							Name: "readWrite",
-						},
-						{
-							DB:   "testing",
-							Name: "clusterAdmin",
-						},
-						// admin roles for reading FCV
-						{
-							DB:   "admin",
-							Name: "readWrite",
-						},
-						{
-							DB:   "admin",
-							Name: "clusterAdmin",
-						},
-					},
-				},
-			},
-		},
-	}
-	return mdb, mdb.Spec.Users[0]
-}
-
-func NewTestTLSConfig(optional bool) mdbv1.TLS {
-	return mdbv1.TLS{
-		Enabled:  true,
-		Optional: optional,
-		CertificateKeySecret: mdbv1.LocalObjectReference{
-			Name: "test-tls-secret",
-		},
-		CaConfigMap: mdbv1.LocalObjectReference{
-			Name: "test-tls-ca",
-		},
-	}
-}
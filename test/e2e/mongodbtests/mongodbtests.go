@@ -10,12 +10,10 @@ import (
 
 	"k8s.io/apimachinery/pkg/types"
 
-	"k8s.io/apimachinery/pkg/util/wait"
-
 	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
 	"github.com/mongodb/mongodb-kubernetes-operator/pkg/controller/mongodb"
-	e2eutil "github.com/mongodb/mongodb-kubernetes-operator/test/e2e"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/framework"
 	f "github.com/operator-framework/operator-sdk/pkg/test"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
@@ -32,7 +30,7 @@ import (
 // reaches the running state
 func StatefulSetIsReady(mdb *mdbv1.MongoDB) func(t *testing.T) {
 	return func(t *testing.T) {
-		err := e2eutil.WaitForStatefulSetToBeReady(t, mdb, time.Second*15, time.Minute*5)
+		err := framework.WaitForStatefulSetToBeReady(t, mdb, framework.DefaultRetryInterval, framework.DefaultTimeout)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -64,7 +62,7 @@ func StatefulSetHasOwnerReference(mdb *mdbv1.MongoDB, expectedOwnerReference met
 // resource has the correct Update Strategy
 func StatefulSetHasUpdateStrategy(mdb *mdbv1.MongoDB, strategy appsv1.StatefulSetUpdateStrategyType) func(t *testing.T) {
 	return func(t *testing.T) {
-		err := e2eutil.WaitForStatefulSetToHaveUpdateStrategy(t, mdb, strategy, time.Second*15, time.Minute*5)
+		err := framework.WaitForStatefulSetToHaveUpdateStrategy(t, mdb, strategy, framework.DefaultRetryInterval, framework.DefaultTimeout)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -75,7 +73,7 @@ func StatefulSetHasUpdateStrategy(mdb *mdbv1.MongoDB, strategy appsv1.StatefulSe
 // MongoDBReachesRunningPhase ensure the MongoDB resource reaches the Running phase
 func MongoDBReachesRunningPhase(mdb *mdbv1.MongoDB) func(t *testing.T) {
 	return func(t *testing.T) {
-		err := e2eutil.WaitForMongoDBToReachPhase(t, mdb, mdbv1.Running, time.Second*15, time.Minute*5)
+		err := framework.WaitForMongoDBToBeRunning(t, mdb)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -85,7 +83,7 @@ func MongoDBReachesRunningPhase(mdb *mdbv1.MongoDB) func(t *testing.T) {
 
 func AutomationConfigConfigMapExists(mdb *mdbv1.MongoDB) func(t *testing.T) {
 	return func(t *testing.T) {
-		cm, err := e2eutil.WaitForConfigMapToExist(mdb.ConfigMapName(), time.Second*5, time.Minute*1)
+		cm, err := framework.WaitForConfigMapToExist(mdb.ConfigMapName(), time.Second*5, time.Minute*1)
 		assert.NoError(t, err)
 
 		t.Logf("ConfigMap %s/%s was successfully created", mdb.ConfigMapName(), mdb.Namespace)
@@ -115,7 +113,7 @@ func HasFeatureCompatibilityVersion(mdb *mdbv1.MongoDB, fcv string, tries int) f
 	return func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 		defer cancel()
-		mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(mdb.MongoURI()))
+		mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(framework.MongoURI(*mdb)))
 		assert.NoError(t, err)
 
 		database := mongoClient.Database("admin")
@@ -214,7 +212,7 @@ func Status(mdb *mdbv1.MongoDB, expectedStatus mdbv1.MongoDBStatus) func(t *test
 func Scale(mdb *mdbv1.MongoDB, newMembers int) func(*testing.T) {
 	return func(t *testing.T) {
 		t.Logf("Scaling Mongodb %s, to %d members", mdb.Name, newMembers)
-		err := e2eutil.UpdateMongoDBResource(mdb, func(db *mdbv1.MongoDB) {
+		err := framework.UpdateMongoDBResource(mdb, func(db *mdbv1.MongoDB) {
 			db.Spec.Members = newMembers
 		})
 		if err != nil {
@@ -226,7 +224,7 @@ func Scale(mdb *mdbv1.MongoDB, newMembers int) func(*testing.T) {
 func ChangeVersion(mdb *mdbv1.MongoDB, newVersion string) func(*testing.T) {
 	return func(t *testing.T) {
 		t.Logf("Changing versions from: %s to %s", mdb.Spec.Version, newVersion)
-		err := e2eutil.UpdateMongoDBResource(mdb, func(db *mdbv1.MongoDB) {
+		err := framework.UpdateMongoDBResource(mdb, func(db *mdbv1.MongoDB) {
 			db.Spec.Version = newVersion
 		})
 		if err != nil {
@@ -239,21 +237,7 @@ func ChangeVersion(mdb *mdbv1.MongoDB, newVersion string) func(*testing.T) {
 // and inserting a document into the MongoDB resource. Custom client
 // options can be passed, for example to configure TLS.
 func Connect(mdb *mdbv1.MongoDB, opts *options.ClientOptions) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-	mongoClient, err := mongo.Connect(ctx, opts.ApplyURI(mdb.MongoURI()))
-	if err != nil {
-		return err
-	}
-
-	return wait.Poll(time.Second*1, time.Second*30, func() (done bool, err error) {
-		collection := mongoClient.Database("testing").Collection("numbers")
-		_, err = collection.InsertOne(ctx, bson.M{"name": "pi", "value": 3.14159})
-		if err != nil {
-			return false, nil
-		}
-		return true, nil
-	})
+	return framework.Connect(mdb, opts)
 }
 
 // IsReachableDuring periodically tests connectivity to the provided MongoDB resource
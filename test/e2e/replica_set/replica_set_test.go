@@ -3,9 +3,7 @@ package replica_set
 import (
 	"testing"
 
-	e2eutil "github.com/mongodb/mongodb-kubernetes-operator/test/e2e"
-	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/mongodbtests"
-	setup "github.com/mongodb/mongodb-kubernetes-operator/test/e2e/setup"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/conformance"
 	f "github.com/operator-framework/operator-sdk/pkg/test"
 )
 
@@ -14,20 +12,5 @@ func TestMain(m *testing.M) {
 }
 
 func TestReplicaSet(t *testing.T) {
-	ctx, shouldCleanup := setup.InitTest(t)
-
-	if shouldCleanup {
-		defer ctx.Cleanup()
-	}
-	mdb, user := e2eutil.NewTestMongoDB("mdb0")
-
-	_, err := setup.GeneratePasswordForUser(user, ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	t.Run("Create MongoDB Resource", mongodbtests.CreateMongoDBResource(&mdb, ctx))
-	t.Run("Basic tests", mongodbtests.BasicFunctionality(&mdb))
-	t.Run("Test Basic Connectivity", mongodbtests.Connectivity(&mdb))
-	t.Run("AutomationConfig has the correct version", mongodbtests.AutomationConfigVersionHasTheExpectedVersion(&mdb, 1))
+	conformance.ReplicaSet(t)
 }
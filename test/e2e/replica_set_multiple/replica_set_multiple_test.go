@@ -5,9 +5,8 @@ import (
 	"time"
 
 	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
-	e2eutil "github.com/mongodb/mongodb-kubernetes-operator/test/e2e"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/framework"
 	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/mongodbtests"
-	setup "github.com/mongodb/mongodb-kubernetes-operator/test/e2e/setup"
 	f "github.com/operator-framework/operator-sdk/pkg/test"
 )
 
@@ -19,21 +18,21 @@ func TestMain(m *testing.M) {
 // same time. One of them is scaled to 5 and then back to 3
 func TestReplicaSet(t *testing.T) {
 
-	ctx, shouldCleanup := setup.InitTest(t)
+	ctx, shouldCleanup := framework.Setup(t)
 
 	if shouldCleanup {
 		defer ctx.Cleanup()
 	}
 
-	mdb0, user0 := e2eutil.NewTestMongoDB("mdb0")
-	mdb1, user1 := e2eutil.NewTestMongoDB("mdb1")
+	mdb0, user0 := framework.NewTestMongoDB("mdb0")
+	mdb1, user1 := framework.NewTestMongoDB("mdb1")
 
-	_, err := setup.GeneratePasswordForUser(user0, ctx)
+	_, err := framework.GeneratePasswordForUser(user0, ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = setup.GeneratePasswordForUser(user1, ctx)
+	_, err = framework.GeneratePasswordForUser(user1, ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -6,9 +6,8 @@ import (
 	"time"
 
 	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
-	e2eutil "github.com/mongodb/mongodb-kubernetes-operator/test/e2e"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/framework"
 	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/mongodbtests"
-	setup "github.com/mongodb/mongodb-kubernetes-operator/test/e2e/setup"
 	f "github.com/operator-framework/operator-sdk/pkg/test"
 )
 
@@ -20,15 +19,15 @@ func TestReplicaSetReadinessProbeScaling(t *testing.T) {
 
 	rand.Seed(time.Now().Unix())
 
-	ctx, shouldCleanup := setup.InitTest(t)
+	ctx, shouldCleanup := framework.Setup(t)
 
 	if shouldCleanup {
 		defer ctx.Cleanup()
 	}
 
-	mdb, user := e2eutil.NewTestMongoDB("mdb0")
+	mdb, user := framework.NewTestMongoDB("mdb0")
 
-	_, err := setup.GeneratePasswordForUser(user, ctx)
+	_, err := framework.GeneratePasswordForUser(user, ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -5,9 +5,8 @@ import (
 	"time"
 
 	mdbv1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
-	e2eutil "github.com/mongodb/mongodb-kubernetes-operator/test/e2e"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/framework"
 	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/mongodbtests"
-	setup "github.com/mongodb/mongodb-kubernetes-operator/test/e2e/setup"
 	f "github.com/operator-framework/operator-sdk/pkg/test"
 )
 
@@ -17,14 +16,14 @@ func TestMain(m *testing.M) {
 
 func TestReplicaSetScale(t *testing.T) {
 
-	ctx, shouldCleanup := setup.InitTest(t)
+	ctx, shouldCleanup := framework.Setup(t)
 
 	if shouldCleanup {
 		defer ctx.Cleanup()
 	}
 
-	mdb, user := e2eutil.NewTestMongoDB("mdb0")
-	_, err := setup.GeneratePasswordForUser(user, ctx)
+	mdb, user := framework.NewTestMongoDB("mdb0")
+	_, err := framework.GeneratePasswordForUser(user, ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -6,9 +6,8 @@ import (
 
 	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/tlstests"
 
-	e2eutil "github.com/mongodb/mongodb-kubernetes-operator/test/e2e"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/framework"
 	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/mongodbtests"
-	setup "github.com/mongodb/mongodb-kubernetes-operator/test/e2e/setup"
 	f "github.com/operator-framework/operator-sdk/pkg/test"
 )
 
@@ -17,17 +16,17 @@ func TestMain(m *testing.M) {
 }
 
 func TestReplicaSetTLSUpgrade(t *testing.T) {
-	ctx, shouldCleanup := setup.InitTest(t)
+	ctx, shouldCleanup := framework.Setup(t)
 	if shouldCleanup {
 		defer ctx.Cleanup()
 	}
 
-	mdb, user := e2eutil.NewTestMongoDB("mdb-tls")
-	if err := setup.CreateTLSResources(mdb.Namespace, ctx); err != nil {
+	mdb, user := framework.NewTestMongoDB("mdb-tls")
+	if err := framework.CreateTLSResources(mdb.Namespace, ctx); err != nil {
 		t.Fatalf("Failed to set up TLS resources: %+v", err)
 	}
 
-	_, err := setup.GeneratePasswordForUser(user, ctx)
+	_, err := framework.GeneratePasswordForUser(user, ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2,20 +2,14 @@ package tlstests
 
 import (
 	"context"
-	"crypto/tls"
 	"crypto/x509"
 	"fmt"
-	"io/ioutil"
 	"math/big"
 	"testing"
 	"time"
 
-	f "github.com/operator-framework/operator-sdk/pkg/test"
-
-	"github.com/mongodb/mongodb-kubernetes-operator/pkg/kube/secret"
-
 	v1 "github.com/mongodb/mongodb-kubernetes-operator/pkg/apis/mongodb/v1"
-	e2eutil "github.com/mongodb/mongodb-kubernetes-operator/test/e2e"
+	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/framework"
 	"github.com/mongodb/mongodb-kubernetes-operator/test/e2e/mongodbtests"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
@@ -27,8 +21,8 @@ import (
 // EnableTLS will upgrade an existing TLS cluster to use TLS.
 func EnableTLS(mdb *v1.MongoDB, optional bool) func(*testing.T) {
 	return func(t *testing.T) {
-		err := e2eutil.UpdateMongoDBResource(mdb, func(db *v1.MongoDB) {
-			db.Spec.Security.TLS = e2eutil.NewTestTLSConfig(optional)
+		err := framework.UpdateMongoDBResource(mdb, func(db *v1.MongoDB) {
+			db.Spec.Security.TLS = framework.NewTestTLSConfig(optional)
 		})
 		if err != nil {
 			t.Fatal(err)
@@ -40,13 +34,7 @@ func EnableTLS(mdb *v1.MongoDB, optional bool) func(*testing.T) {
 // a basic MongoDB connectivity test over TLS
 func ConnectivityWithTLS(mdb *v1.MongoDB) func(t *testing.T) {
 	return func(t *testing.T) {
-		tlsConfig, err := getClientTLSConfig()
-		if err != nil {
-			t.Fatal(err)
-			return
-		}
-
-		if err := mongodbtests.Connect(mdb, options.Client().SetTLSConfig(tlsConfig)); err != nil {
+		if err := framework.ConnectWithTLS(mdb); err != nil {
 			t.Fatal(fmt.Sprintf("Error connecting to MongoDB deployment over TLS: %+v", err))
 		}
 	}
@@ -68,7 +56,7 @@ func connectWithoutTLS(mdb *v1.MongoDB) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(mdb.MongoURI()))
+	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(framework.MongoURI(*mdb)))
 	if err != nil {
 		return err
 	}
@@ -83,12 +71,7 @@ func connectWithoutTLS(mdb *v1.MongoDB) error {
 // The MongoDB is up throughout the test.
 func IsReachableOverTLSDuring(mdb *v1.MongoDB, interval time.Duration, testFunc func()) func(*testing.T) {
 	return mongodbtests.IsReachableDuringWithConnection(mdb, interval, testFunc, func() error {
-		tlsConfig, err := getClientTLSConfig()
-		if err != nil {
-			return err
-		}
-
-		return mongodbtests.Connect(mdb, options.Client().SetTLSConfig(tlsConfig))
+		return framework.ConnectWithTLS(mdb)
 	})
 }
 
@@ -98,7 +81,7 @@ func WaitForTLSMode(mdb *v1.MongoDB, expectedValue string) func(*testing.T) {
 		err := wait.Poll(time.Second*10, time.Minute*10, func() (done bool, err error) {
 			// Once we upgrade the tests to 4.2 we will have to change this to "tlsMode".
 			// We will also have to change the values we check for.
-			value, err := getAdminSetting(mdb.MongoURI(), "sslMode")
+			value, err := getAdminSetting(framework.MongoURI(*mdb), "sslMode")
 			if err != nil {
 				return false, err
 			}
@@ -121,7 +104,7 @@ func getAdminSetting(uri, key string) (interface{}, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	tlsConfig, err := getClientTLSConfig()
+	tlsConfig, err := framework.ClientTLSConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -141,32 +124,20 @@ func getAdminSetting(uri, key string) (interface{}, error) {
 	return value, nil
 }
 
+// RotateCertificate replaces the server certificate of the resource with the rotated one
 func RotateCertificate(mdb *v1.MongoDB) func(*testing.T) {
 	return func(t *testing.T) {
-		// Load new certificate and key
-		cert, err := ioutil.ReadFile("testdata/tls/server_rotated.crt")
-		assert.NoError(t, err)
-		key, err := ioutil.ReadFile("testdata/tls/server_rotated.key")
-		assert.NoError(t, err)
-
-		certKeySecret := secret.Builder().
-			SetName(mdb.Spec.Security.TLS.CertificateKeySecret.Name).
-			SetNamespace(mdb.Namespace).
-			SetField("tls.crt", string(cert)).
-			SetField("tls.key", string(key)).
-			Build()
-
-		err = f.Global.Client.Update(context.TODO(), &certKeySecret)
-		assert.NoError(t, err)
+		assert.NoError(t, framework.RotateServerCertificate(mdb))
 	}
 }
 
+// WaitForRotatedCertificate waits until the members serve the rotated certificate
 func WaitForRotatedCertificate(mdb *v1.MongoDB) func(*testing.T) {
 	return func(t *testing.T) {
 		// The rotated certificate has serial number 2
 		expectedSerial := big.NewInt(2)
 
-		tlsConfig, err := getClientTLSConfig()
+		tlsConfig, err := framework.ClientTLSConfig()
 		assert.NoError(t, err)
 
 		// Reject all server certificates that don't have the expected serial number
@@ -179,7 +150,7 @@ func WaitForRotatedCertificate(mdb *v1.MongoDB) func(*testing.T) {
 			return nil
 		}
 
-		opts := options.Client().SetTLSConfig(tlsConfig).ApplyURI(mdb.MongoURI())
+		opts := options.Client().SetTLSConfig(tlsConfig).ApplyURI(framework.MongoURI(*mdb))
 		mongoClient, err := mongo.Connect(context.TODO(), opts)
 		assert.NoError(t, err)
 
@@ -193,18 +164,3 @@ func WaitForRotatedCertificate(mdb *v1.MongoDB) func(*testing.T) {
 		assert.NoError(t, err)
 	}
 }
-
-func getClientTLSConfig() (*tls.Config, error) {
-	// Read the CA certificate from test data
-	caPEM, err := ioutil.ReadFile("testdata/tls/ca.crt")
-	if err != nil {
-		return nil, err
-	}
-
-	caPool := x509.NewCertPool()
-	caPool.AppendCertsFromPEM(caPEM)
-
-	return &tls.Config{
-		RootCAs: caPool,
-	}, nil
-}